@@ -16,6 +16,7 @@ import (
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
 )
 
 const BuilderId = "packer.file"
@@ -62,8 +63,13 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		}
 		defer target.Close()
 
+		info, err := source.Stat()
+		if err != nil {
+			return nil, err
+		}
+
 		ui.Say(fmt.Sprintf("Copying %s to %s", source.Name(), target.Name()))
-		bytes, err := io.Copy(target, source)
+		bytes, err := io.Copy(target, packer.ProgressReader(ui, "copy", info.Size(), source))
 		if err != nil {
 			return nil, err
 		}
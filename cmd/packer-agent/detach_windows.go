@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "syscall"
+
+const (
+	detachedProcess       = 0x00000008
+	createNewProcessGroup = 0x00000200
+)
+
+// detached starts a process outside of the console of the communicator, so
+// that it is not killed along with it.
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | createNewProcessGroup}
+}
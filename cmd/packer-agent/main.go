@@ -0,0 +1,272 @@
+// packer-agent is a small static binary uploaded to the guests by Packer. It
+// offers primitives that are hard to get right over a raw shell session:
+// hashing files, supervising long-running commands so that they survive a
+// disconnect of the communicator, and identifying the boot of the guest so that
+// reboots can be told apart from network issues.
+//
+// It only depends on the standard library, build it with CGO_ENABLED=0.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the version of the protocol spoken by the agent. It is bumped
+// whenever a subcommand changes in a backward incompatible way.
+const Version = "1"
+
+// The files written by supervise in its state directory.
+const (
+	stdoutFile     = "stdout"
+	stderrFile     = "stderr"
+	exitStatusFile = "exit-status"
+)
+
+// failureExitStatus is the exit status of the agent when it fails itself.
+const failureExitStatus = 255
+
+var subcommands = map[string]func(args []string) error{
+	"version":   version,
+	"sha256":    sha256sum,
+	"start":     start,
+	"supervise": supervise,
+	"wait":      wait,
+	"boot-id":   bootID,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: packer-agent <subcommand> [flags]
+
+Subcommands:
+	version                              print the version of the agent
+	sha256 FILE...                       print the SHA256 checksum of files
+	start -dir DIR -command COMMAND      run COMMAND in the background, its
+	                                     state is kept in DIR
+	wait -dir DIR [-stdout-offset N] [-stderr-offset N]
+	                                     stream the output of the command
+	                                     started in DIR, from the given
+	                                     offsets, and exit with its status
+	boot-id                              print an identifier of the current
+	                                     boot of the machine
+`)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("packer-agent: ")
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(failureExitStatus)
+	}
+	subcommand, ok := subcommands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(failureExitStatus)
+	}
+	if err := subcommand(os.Args[2:]); err != nil {
+		if exitErr, ok := err.(exitStatus); ok {
+			os.Exit(int(exitErr))
+		}
+		log.Print(err)
+		os.Exit(failureExitStatus)
+	}
+}
+
+// exitStatus is returned by a subcommand that exits with a given status.
+type exitStatus int
+
+func (e exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+
+func version(args []string) error {
+	fmt.Println(Version)
+	return nil
+}
+
+func sha256sum(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("sha256: at least one file is required")
+	}
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), path)
+	}
+	return nil
+}
+
+func commandFlags(name string, args []string) (dir, command string, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&dir, "dir", "", "the state directory of the command")
+	fs.StringVar(&command, "command", "", "the command to run with sh -c")
+	if err := fs.Parse(args); err != nil {
+		return "", "", err
+	}
+	if dir == "" || command == "" {
+		return "", "", fmt.Errorf("%s: -dir and -command are required", name)
+	}
+	return dir, command, nil
+}
+
+// start runs supervise in the background, in its own session, so that the
+// command keeps running when the session of the communicator is lost.
+func start(args []string) error {
+	dir, command, err := commandFlags("start", args)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, "supervise", "-dir", dir, "-command", command)
+	cmd.SysProcAttr = detached()
+	return cmd.Start()
+}
+
+// supervise runs the command, writing its output and then its exit status in
+// dir.
+func supervise(args []string) error {
+	dir, command, err := commandFlags("supervise", args)
+	if err != nil {
+		return err
+	}
+
+	stdout, err := os.Create(filepath.Join(dir, stdoutFile))
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, stderrFile))
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	status := 0
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			status = exitErr.ExitCode()
+		} else {
+			fmt.Fprintf(stderr, "packer-agent: %s\n", err)
+			status = failureExitStatus
+		}
+	}
+
+	// The exit status is written last, and atomically: once it exists the
+	// output is complete.
+	tmp := filepath.Join(dir, exitStatusFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(status)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, exitStatusFile))
+}
+
+// wait streams the output of the command started in dir from the given
+// offsets, until the command exits.
+func wait(args []string) error {
+	var dir string
+	var stdoutOffset, stderrOffset int64
+	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
+	fs.StringVar(&dir, "dir", "", "the state directory of the command")
+	fs.Int64Var(&stdoutOffset, "stdout-offset", 0, "the number of bytes of the standard output already received")
+	fs.Int64Var(&stderrOffset, "stderr-offset", 0, "the number of bytes of the standard error already received")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dir == "" {
+		return fmt.Errorf("wait: -dir is required")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	for {
+		// Read the status before the output, so that no output written
+		// in between is missed.
+		status, statusErr := os.ReadFile(filepath.Join(dir, exitStatusFile))
+
+		var err error
+		if stdoutOffset, err = follow(filepath.Join(dir, stdoutFile), stdoutOffset, os.Stdout); err != nil {
+			return err
+		}
+		if stderrOffset, err = follow(filepath.Join(dir, stderrFile), stderrOffset, os.Stderr); err != nil {
+			return err
+		}
+
+		if statusErr == nil {
+			code, err := strconv.Atoi(strings.TrimSpace(string(status)))
+			if err != nil {
+				return fmt.Errorf("wait: invalid exit status %q", status)
+			}
+			return exitStatus(code)
+		}
+		if !os.IsNotExist(statusErr) {
+			return statusErr
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// follow copies the content of path from offset to w, and returns the new
+// offset.
+func follow(path string, offset int64, w io.Writer) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return offset, nil
+	}
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(w, f)
+	return offset + n, err
+}
+
+func bootID(args []string) error {
+	// Linux
+	if id, err := os.ReadFile("/proc/sys/kernel/random/boot_id"); err == nil {
+		fmt.Println(strings.TrimSpace(string(id)))
+		return nil
+	}
+	// BSDs and macOS
+	out, err := exec.Command("sysctl", "-n", "kern.boottime").Output()
+	if err != nil {
+		return fmt.Errorf("boot-id: %s", err)
+	}
+	fmt.Println(strings.TrimSpace(string(out)))
+	return nil
+}
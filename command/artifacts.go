@@ -0,0 +1,537 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/hashicorp/packer-plugin-sdk/pathing"
+	"github.com/hashicorp/packer/internal/buildstate"
+	"github.com/hashicorp/packer/post-processor/manifest"
+	"github.com/posener/complete"
+)
+
+type ArtifactsCommand struct {
+	Meta
+}
+
+func (c *ArtifactsCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *ArtifactsCommand) ParseArgs(args []string) (*ArtifactsArgs, int) {
+	var cfg ArtifactsArgs
+	flags := c.Meta.FlagSet("artifacts", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if !cfg.ArtifactSourcesArgs.parse(flags.Args()) {
+		flags.Usage()
+		return &cfg, 1
+	}
+	if _, err := path.Match(cfg.Build, ""); err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid -build pattern %q: %s", cfg.Build, err))
+		return &cfg, 1
+	}
+	if cfg.Since < 0 {
+		c.Ui.Error("The -since duration must be positive.")
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+// historySource is the source of the artifacts of the artifact history.
+const historySource = "history"
+
+// defaultArtifactHistory returns the path of the artifact history recording
+// the artifacts of all the builds, whatever their template: artifacts.json in
+// the Packer config directory.
+func defaultArtifactHistory() (string, error) {
+	dir, err := pathing.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "artifacts.json"), nil
+}
+
+// parse sets the template of sa from the arguments of the command, and tells
+// whether they are valid. Without a template, only the given manifests and
+// the artifact history are read.
+func (sa *ArtifactSourcesArgs) parse(args []string) bool {
+	if sa.History == "" {
+		// Without a config directory, there is no history to read.
+		sa.History, _ = defaultArtifactHistory()
+	}
+	switch {
+	case len(args) == 1 && args[0] != "-":
+		sa.Path = args[0]
+		return true
+	case len(args) == 0 && sa.State == "":
+		return true
+	}
+	return false
+}
+
+// recordedArtifact is an artifact recorded by a previous run, in the build
+// state of a template, in a manifest file or in the artifact history.
+type recordedArtifact struct {
+	Build       string    `json:"build"`
+	BuilderID   string    `json:"builder_id,omitempty"`
+	BuilderType string    `json:"builder_type,omitempty"`
+	ID          string    `json:"id"`
+	Description string    `json:"description,omitempty"`
+	Files       []string  `json:"files,omitempty"`
+	CompletedAt time.Time `json:"completed_at"`
+	// Source is where the artifact is recorded: the build state, the path
+	// of a manifest or the artifact history.
+	Source string `json:"source"`
+	// Digests are the digests of the images of the artifact, by image ID,
+	// as recorded by manifests.
+	Digests map[string]string `json:"digests,omitempty"`
+	// Template, Fingerprint and RunUUID are recorded by the artifact history:
+	// the absolute path of the template of the build, the input hash of the
+	// build when its inputs were hashed, and the UUID of the run.
+	Template    string `json:"template,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	RunUUID     string `json:"run_uuid,omitempty"`
+}
+
+// key identifies the artifact in its source.
+func (a *recordedArtifact) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%d", a.Build, a.ID, a.CompletedAt.UnixNano())
+}
+
+// matches tells whether the artifact is selected by the filters of cla.
+func (a *recordedArtifact) matches(cla *ArtifactsArgs, now time.Time) bool {
+	if cla.Build != "" {
+		if ok, _ := path.Match(cla.Build, a.Build); !ok {
+			return false
+		}
+	}
+	if cla.Builder != "" && cla.Builder != a.BuilderID && cla.Builder != a.BuilderType {
+		return false
+	}
+	return cla.Since == 0 || a.CompletedAt.After(now.Add(-cla.Since))
+}
+
+// artifactLedger holds the artifacts recorded by previous runs, and the
+// records they were read from.
+type artifactLedger struct {
+	artifacts []*recordedArtifact
+
+	template  string
+	backend   buildstate.Backend
+	state     *buildstate.State
+	manifests map[string]*manifest.ManifestFile
+	history   string
+}
+
+// loadArtifactLedger reads the artifacts recorded in the sources of src.
+func loadArtifactLedger(ctx context.Context, src *ArtifactSourcesArgs) (*artifactLedger, error) {
+	l := &artifactLedger{
+		template:  src.Path,
+		manifests: map[string]*manifest.ManifestFile{},
+		history:   src.History,
+	}
+
+	if src.Path != "" {
+		var err error
+		l.backend, err = newStateBackend(src.State, src.Path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid -state location: %s", err)
+		}
+		l.state, err = l.backend.Load(ctx, stateTemplate(src.Path))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load the build state: %s", err)
+		}
+		for name, b := range l.state.Builds {
+			for _, a := range b.Artifacts {
+				l.artifacts = append(l.artifacts, &recordedArtifact{
+					Build:       name,
+					BuilderID:   a.BuilderID,
+					ID:          a.ID,
+					Description: a.Description,
+					CompletedAt: b.CompletedAt,
+					Source:      "state",
+				})
+			}
+		}
+	}
+
+	for _, p := range src.Manifests {
+		m, err := readManifest(p)
+		if err != nil {
+			return nil, err
+		}
+		l.manifests[p] = m
+		for _, a := range m.Builds {
+			l.artifacts = append(l.artifacts, &recordedArtifact{
+				Build:       a.BuildName,
+				BuilderType: a.BuilderType,
+				ID:          a.ArtifactId,
+				Description: a.String(),
+				Files:       a.Files(),
+				Digests:     a.Digests,
+				CompletedAt: time.Unix(a.BuildTime, 0).UTC(),
+				Source:      p,
+			})
+		}
+	}
+
+	if src.History != "" {
+		history, err := readHistory(src.History)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range history {
+			// Only the artifacts of the template are listed with one.
+			if src.Path != "" && a.Template != absTemplate(src.Path) {
+				continue
+			}
+			a.Source = historySource
+			l.artifacts = append(l.artifacts, a)
+		}
+	}
+	return l, nil
+}
+
+func (c *ArtifactsCommand) RunContext(ctx context.Context, cla *ArtifactsArgs) int {
+	ledger, err := loadArtifactLedger(ctx, &cla.ArtifactSourcesArgs)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	now := time.Now()
+	var selected []*recordedArtifact
+	for _, a := range ledger.artifacts {
+		if a.matches(cla, now) {
+			selected = append(selected, a)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		if !selected[i].CompletedAt.Equal(selected[j].CompletedAt) {
+			return selected[i].CompletedAt.Before(selected[j].CompletedAt)
+		}
+		return selected[i].Build < selected[j].Build
+	})
+
+	if cla.JSON {
+		if selected == nil {
+			selected = []*recordedArtifact{}
+		}
+		b, err := json.MarshalIndent(selected, "", "  ")
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.Ui.Message(string(b))
+	} else if len(selected) == 0 {
+		c.Ui.Say("No recorded artifacts match.")
+	} else {
+		for _, a := range selected {
+			c.Ui.Machine("recorded-artifact", a.Build, a.Source, a.ID)
+			c.Ui.Say(fmt.Sprintf("Build '%s': %s, completed at %s (%s)",
+				a.Build, a.Description, a.CompletedAt.Format(time.RFC3339), a.Source))
+		}
+	}
+
+	if cla.Export != "" {
+		if err := exportArtifacts(cla.Export, selected); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to export the artifacts: %s", err))
+			return 1
+		}
+		if !cla.JSON {
+			c.Ui.Say(fmt.Sprintf("Exported %d artifact(s) to %s", len(selected), cla.Export))
+		}
+	}
+
+	if !cla.Delete || len(selected) == 0 {
+		return 0
+	}
+	if err := c.confirm(&cla.ConfirmArgs, fmt.Sprintf(
+		"Do you want to delete the records of these %d artifact(s)? The artifacts themselves are not destroyed.", len(selected))); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	if err := ledger.delete(ctx, selected); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to delete the records of the artifacts: %s", err))
+		return 1
+	}
+	if !cla.JSON {
+		c.Ui.Say(fmt.Sprintf("Deleted the records of %d artifact(s)", len(selected)))
+	}
+	return 0
+}
+
+// readManifest reads the manifest file at p, written by the manifest
+// post-processor.
+func readManifest(p string) (*manifest.ManifestFile, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest %s: %s", p, err)
+	}
+	m := &manifest.ManifestFile{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to read the manifest %s: %s", p, err)
+	}
+	return m, nil
+}
+
+// writeManifest writes m to p, the way the manifest post-processor does.
+func writeManifest(p string, m *manifest.ManifestFile) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0664)
+}
+
+// exportArtifacts writes artifacts to a manifest file at p. The sizes of the
+// files still around are recorded.
+func exportArtifacts(p string, artifacts []*recordedArtifact) error {
+	m := &manifest.ManifestFile{Builds: []manifest.Artifact{}}
+	for _, a := range artifacts {
+		files := []manifest.ArtifactFile{}
+		for _, f := range a.Files {
+			af := manifest.ArtifactFile{Name: f}
+			if fi, err := os.Stat(f); err == nil {
+				af.Size = fi.Size()
+			}
+			files = append(files, af)
+		}
+		m.Builds = append(m.Builds, manifest.Artifact{
+			BuildName:     a.Build,
+			BuilderType:   a.BuilderType,
+			BuildTime:     a.CompletedAt.Unix(),
+			ArtifactFiles: files,
+			ArtifactId:    a.ID,
+			Digests:       a.Digests,
+		})
+	}
+	return writeManifest(p, m)
+}
+
+// delete removes artifacts from the build state, the manifests and the
+// artifact history recording them. A build left without artifacts is removed
+// from the state, so that `packer build -if-changed` builds it again.
+func (l *artifactLedger) delete(ctx context.Context, artifacts []*recordedArtifact) error {
+	deleted := map[string]map[string]bool{}
+	for _, a := range artifacts {
+		if deleted[a.Source] == nil {
+			deleted[a.Source] = map[string]bool{}
+		}
+		deleted[a.Source][a.key()] = true
+	}
+
+	if fromState := deleted["state"]; fromState != nil {
+		for name, b := range l.state.Builds {
+			var kept []buildstate.Artifact
+			for _, a := range b.Artifacts {
+				if !fromState[(&recordedArtifact{Build: name, ID: a.ID, CompletedAt: b.CompletedAt}).key()] {
+					kept = append(kept, a)
+				}
+			}
+			if len(kept) == len(b.Artifacts) {
+				continue
+			}
+			if len(kept) == 0 {
+				delete(l.state.Builds, name)
+				continue
+			}
+			b.Artifacts = kept
+			l.state.Builds[name] = b
+		}
+		if err := l.backend.Save(ctx, stateTemplate(l.template), l.state); err != nil {
+			return err
+		}
+	}
+
+	var paths []string
+	for p := range l.manifests {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fromManifest := deleted[p]
+		if fromManifest == nil {
+			continue
+		}
+		m := l.manifests[p]
+		kept := []manifest.Artifact{}
+		for _, a := range m.Builds {
+			recorded := &recordedArtifact{Build: a.BuildName, ID: a.ArtifactId, CompletedAt: time.Unix(a.BuildTime, 0).UTC()}
+			if !fromManifest[recorded.key()] {
+				kept = append(kept, a)
+			}
+		}
+		m.Builds = kept
+		if err := writeManifest(p, m); err != nil {
+			return err
+		}
+	}
+
+	if fromHistory := deleted[historySource]; fromHistory != nil {
+		return updateHistory(l.history, func(recorded []*recordedArtifact) []*recordedArtifact {
+			var kept []*recordedArtifact
+			for _, a := range recorded {
+				if !fromHistory[a.key()] {
+					kept = append(kept, a)
+				}
+			}
+			return kept
+		})
+	}
+	return nil
+}
+
+// absTemplate returns the absolute path of template, as recorded in the
+// artifact history.
+func absTemplate(template string) string {
+	if template == "-" {
+		return template
+	}
+	if abs, err := filepath.Abs(template); err == nil {
+		return abs
+	}
+	return template
+}
+
+// readHistory returns the artifacts of the artifact history at p, none when
+// it does not exist yet.
+func readHistory(p string) ([]*recordedArtifact, error) {
+	lock := flock.New(p + ".lock")
+	if err := lock.RLock(); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to lock the artifact history %s: %s", p, err)
+	}
+	defer lock.Unlock()
+	return readHistoryFile(p)
+}
+
+// updateHistory replaces the artifacts of the artifact history at p by the
+// ones returned by update. The history is locked meanwhile, so that
+// concurrent runs can share it.
+func updateHistory(p string, update func(recorded []*recordedArtifact) []*recordedArtifact) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create the directory of the artifact history: %s", err)
+	}
+	lock := flock.New(p + ".lock")
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock the artifact history %s: %s", p, err)
+	}
+	defer lock.Unlock()
+
+	recorded, err := readHistoryFile(p)
+	if err != nil {
+		return err
+	}
+	updated := update(recorded)
+	if updated == nil {
+		updated = []*recordedArtifact{}
+	}
+	b, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written aside then renamed, so that the history is never left truncated.
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// readHistoryFile reads the artifact history at p, which must be locked.
+func readHistoryFile(p string) ([]*recordedArtifact, error) {
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the artifact history %s: %s", p, err)
+	}
+	var recorded []*recordedArtifact
+	if err := json.Unmarshal(b, &recorded); err != nil {
+		return nil, fmt.Errorf("failed to read the artifact history %s: %s", p, err)
+	}
+	return recorded, nil
+}
+
+func (*ArtifactsCommand) Help() string {
+	helpText := `
+Usage: packer artifacts [options] [TEMPLATE]
+
+  Lists the artifacts recorded by previous runs: the artifacts of the last
+  successful builds of the template, in its build state, the artifacts of the
+  given manifest files, written by the manifest post-processor, and the
+  artifacts of the template in the artifact history. Without a template, only
+  the manifests and the whole artifact history are read.
+
+  The records of the listed artifacts can be exported to a manifest file, or
+  deleted. Deleting a record does not destroy the artifact itself.
+
+  An artifact is shown in detail with packer artifacts show.
+
+Options:
+
+  -state=path                   Where the build state is stored, see packer build -if-changed.
+                                Defaults to packer.state.json next to the template.
+  -manifest=path1,path2         Also list the artifacts of these manifest files.
+  -history=path                 List the artifacts of this artifact history.
+                                Defaults to artifacts.json in the Packer config directory.
+  -build=pattern                List the artifacts of the builds whose name matches the pattern only.
+  -builder=type                 List the artifacts of the builder type or ID only.
+  -since=duration               List the artifacts built within this duration only, e.g. 72h.
+  -json                         Print the artifacts as JSON.
+  -export=path                  Write the listed artifacts to a manifest file.
+  -delete                       Delete the records of the listed artifacts.
+  -auto-approve                 Delete without asking for confirmation.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*ArtifactsCommand) Synopsis() string {
+	return "list the artifacts recorded by previous runs"
+}
+
+func (*ArtifactsCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*ArtifactsCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-state":        complete.PredictFiles("*.json"),
+		"-manifest":     complete.PredictFiles("*.json"),
+		"-history":      complete.PredictFiles("*.json"),
+		"-build":        complete.PredictNothing,
+		"-builder":      complete.PredictNothing,
+		"-since":        complete.PredictNothing,
+		"-json":         complete.PredictNothing,
+		"-export":       complete.PredictFiles("*.json"),
+		"-delete":       complete.PredictNothing,
+		"-auto-approve": complete.PredictNothing,
+	}
+}
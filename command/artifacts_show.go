@@ -0,0 +1,145 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/posener/complete"
+)
+
+type ArtifactsShowCommand struct {
+	Meta
+}
+
+func (c *ArtifactsShowCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *ArtifactsShowCommand) ParseArgs(args []string) (*ArtifactsShowArgs, int) {
+	var cfg ArtifactsShowArgs
+	flags := c.Meta.FlagSet("artifacts show", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) == 0 || !cfg.ArtifactSourcesArgs.parse(args[1:]) {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.ID = args[0]
+	return &cfg, 0
+}
+
+func (c *ArtifactsShowCommand) RunContext(ctx context.Context, cla *ArtifactsShowArgs) int {
+	ledger, err := loadArtifactLedger(ctx, &cla.ArtifactSourcesArgs)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	// The same artifact can be recorded by several sources, the most
+	// recent record is shown.
+	var a *recordedArtifact
+	for _, recorded := range ledger.artifacts {
+		if recorded.ID == cla.ID && (a == nil || recorded.CompletedAt.After(a.CompletedAt)) {
+			a = recorded
+		}
+	}
+	if a == nil {
+		c.Ui.Error(fmt.Sprintf("No recorded artifact has the ID %q.", cla.ID))
+		return 1
+	}
+
+	if cla.JSON {
+		b, err := json.MarshalIndent(a, "", "  ")
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.Ui.Message(string(b))
+		return 0
+	}
+
+	c.Ui.Say(fmt.Sprintf("ID:           %s", a.ID))
+	c.Ui.Say(fmt.Sprintf("Build:        %s", a.Build))
+	if a.BuilderType != "" {
+		c.Ui.Say(fmt.Sprintf("Builder type: %s", a.BuilderType))
+	}
+	if a.BuilderID != "" {
+		c.Ui.Say(fmt.Sprintf("Builder ID:   %s", a.BuilderID))
+	}
+	if a.Template != "" {
+		c.Ui.Say(fmt.Sprintf("Template:     %s", a.Template))
+	}
+	if a.Fingerprint != "" {
+		c.Ui.Say(fmt.Sprintf("Fingerprint:  %s", a.Fingerprint))
+	}
+	if a.RunUUID != "" {
+		c.Ui.Say(fmt.Sprintf("Run UUID:     %s", a.RunUUID))
+	}
+	c.Ui.Say(fmt.Sprintf("Built at:     %s", a.CompletedAt.Local().Format(time.RFC3339)))
+	c.Ui.Say(fmt.Sprintf("Recorded in:  %s", a.Source))
+	for _, f := range a.Files {
+		c.Ui.Say(fmt.Sprintf("File:         %s", f))
+	}
+	if a.Description != "" {
+		c.Ui.Say("")
+		c.Ui.Say(a.Description)
+	}
+	return 0
+}
+
+func (*ArtifactsShowCommand) Help() string {
+	helpText := `
+Usage: packer artifacts show [options] ID [TEMPLATE]
+
+  Shows an artifact recorded by previous runs, read like packer artifacts
+  does: the build that produced it, when it was built and its files and,
+  when it is recorded in the artifact history, its template and the
+  fingerprint of its inputs.
+
+  ID is the ID of the artifact, like an AMI ID. When several records have
+  it, the most recent one is shown.
+
+Options:
+
+  -state=path                   Where the build state is stored, see packer build -if-changed.
+                                Defaults to packer.state.json next to the template.
+  -manifest=path1,path2         Also read the artifacts of these manifest files.
+  -history=path                 Read the artifacts of this artifact history.
+                                Defaults to artifacts.json in the Packer config directory.
+  -json                         Print the artifact as JSON.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*ArtifactsShowCommand) Synopsis() string {
+	return "show an artifact recorded by previous runs"
+}
+
+func (*ArtifactsShowCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*ArtifactsShowCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-state":    complete.PredictFiles("*.json"),
+		"-manifest": complete.PredictFiles("*.json"),
+		"-history":  complete.PredictFiles("*.json"),
+		"-json":     complete.PredictNothing,
+	}
+}
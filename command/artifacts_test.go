@@ -0,0 +1,192 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/internal/buildstate"
+	"github.com/hashicorp/packer/post-processor/manifest"
+)
+
+func TestArtifactsCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PACKER_CONFIG_DIR", dir)
+	template := filepath.Join(dir, "template.pkr.hcl")
+	if err := ioutil.WriteFile(template, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	completedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	backend, err := newStateBackend("", template, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &buildstate.State{}
+	state.Record("file.chocolate", buildstate.Build{
+		InputHash:   "abc",
+		CompletedAt: completedAt,
+		Artifacts:   []buildstate.Artifact{{BuilderID: "packer.file", ID: "chocolate", Description: "Stored file: chocolate.txt"}},
+	})
+	state.Record("file.vanilla", buildstate.Build{
+		InputHash:   "def",
+		CompletedAt: completedAt,
+		Artifacts:   []buildstate.Artifact{{BuilderID: "packer.file", ID: "vanilla", Description: "Stored file: vanilla.txt"}},
+	})
+	if err := backend.Save(context.Background(), stateTemplate(template), state); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := writeManifest(manifestPath, &manifest.ManifestFile{Builds: []manifest.Artifact{{
+		BuildName:     "chocolate",
+		BuilderType:   "file",
+		BuildTime:     completedAt.Add(time.Hour).Unix(),
+		ArtifactFiles: []manifest.ArtifactFile{{Name: "chocolate.txt", Size: 4}},
+		ArtifactId:    "chocolate",
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(t *testing.T, args ...string) []recordedArtifact {
+		c := &ArtifactsCommand{Meta: TestMetaFile(t)}
+		if code := c.Run(append([]string{"-json", "-manifest", manifestPath}, append(args, template)...)); code != 0 {
+			out, stderr := outputCommand(t, c.Meta)
+			t.Fatalf("expected the artifacts to be listed, got exit code %d:\n%s\n%s", code, out, stderr)
+		}
+		out, _ := outputCommand(t, c.Meta)
+		var artifacts []recordedArtifact
+		if err := json.Unmarshal([]byte(out), &artifacts); err != nil {
+			t.Fatalf("expected JSON output, got %s: %s", err, out)
+		}
+		return artifacts
+	}
+
+	if got := list(t); len(got) != 3 {
+		t.Fatalf("expected all 3 artifacts to be listed, got %#v", got)
+	}
+	got := list(t, "-build", "*chocolate", "-builder", "packer.file")
+	if len(got) != 1 || got[0].ID != "chocolate" || got[0].Source != "state" || !got[0].CompletedAt.Equal(completedAt) {
+		t.Fatalf("expected the chocolate artifact of the state only, got %#v", got)
+	}
+
+	exportPath := filepath.Join(dir, "export.json")
+	list(t, "-build", "*chocolate", "-export", exportPath)
+	exported, err := readManifest(exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := []string{exported.Builds[0].BuildName, exported.Builds[1].BuildName}; !reflect.DeepEqual(names, []string{"file.chocolate", "chocolate"}) {
+		t.Errorf("expected the chocolate artifacts to be exported, got %v", names)
+	}
+
+	list(t, "-build", "*chocolate", "-delete", "-auto-approve")
+	if got := list(t); len(got) != 1 || got[0].Build != "file.vanilla" {
+		t.Fatalf("expected the vanilla artifact only to be left, got %#v", got)
+	}
+	state, err = backend.Load(context.Background(), stateTemplate(template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := state.Builds["file.chocolate"]; found {
+		t.Errorf("expected the build left without artifacts to be removed from the state")
+	}
+}
+
+func TestArtifactsCommand_history(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PACKER_CONFIG_DIR", dir)
+	history, err := defaultArtifactHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtAt := time.Now().Add(-48 * time.Hour).UTC()
+	err = updateHistory(history, func([]*recordedArtifact) []*recordedArtifact {
+		return []*recordedArtifact{
+			{Build: "file.chocolate", BuilderID: "packer.file", ID: "chocolate",
+				Template: filepath.Join(dir, "a.pkr.hcl"), Fingerprint: "abc", CompletedAt: builtAt},
+			{Build: "file.vanilla", BuilderID: "packer.file", ID: "vanilla",
+				Template: filepath.Join(dir, "b.pkr.hcl"), CompletedAt: time.Now().UTC()},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(t *testing.T, args ...string) []recordedArtifact {
+		c := &ArtifactsCommand{Meta: TestMetaFile(t)}
+		if code := c.Run(append([]string{"-json"}, args...)); code != 0 {
+			fatalCommand(t, c.Meta)
+		}
+		out, _ := outputCommand(t, c.Meta)
+		var artifacts []recordedArtifact
+		if err := json.Unmarshal([]byte(out), &artifacts); err != nil {
+			t.Fatalf("failed to read the listed artifacts: %s\n%s", err, out)
+		}
+		return artifacts
+	}
+
+	if got := list(t); len(got) != 2 || got[0].Source != historySource {
+		t.Fatalf("expected both artifacts of the history to be listed, got %#v", got)
+	}
+	if got := list(t, filepath.Join(dir, "a.pkr.hcl")); len(got) != 1 || got[0].ID != "chocolate" {
+		t.Errorf("expected the artifact of template a only, got %#v", got)
+	}
+	if got := list(t, "-since", "24h"); len(got) != 1 || got[0].ID != "vanilla" {
+		t.Errorf("expected the recent artifact only, got %#v", got)
+	}
+
+	c := &ArtifactsShowCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{"-json", "chocolate"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	out, _ := outputCommand(t, c.Meta)
+	var shown recordedArtifact
+	if err := json.Unmarshal([]byte(out), &shown); err != nil || shown.Fingerprint != "abc" {
+		t.Errorf("expected the chocolate artifact to be shown, got %s, %v", out, err)
+	}
+	c = &ArtifactsShowCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{"strawberry"}); code != 1 {
+		t.Errorf("expected an unknown artifact to fail, got %d", code)
+	}
+
+	list(t, "-build", "*chocolate", "-delete", "-auto-approve")
+	if got := list(t); len(got) != 1 || got[0].ID != "vanilla" {
+		t.Errorf("expected the vanilla artifact only to be left in the history, got %#v", got)
+	}
+}
+
+func TestBuildCommand_artifactHistory(t *testing.T) {
+	t.Setenv("PACKER_CONFIG_DIR", t.TempDir())
+	history, err := defaultArtifactHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	c := &BuildCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{template}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if _, err := os.Stat(history); !os.IsNotExist(err) {
+		t.Fatalf("expected no artifact history when it is disabled, got %v", err)
+	}
+
+	// The history is recorded by default.
+	c = &BuildCommand{Meta: TestMetaFile(t)}
+	c.CoreConfig.DisableArtifactHistory = false
+	if code := c.Run([]string{template}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	recorded, err := readHistory(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) == 0 || recorded[0].Template != absTemplate(template) || recorded[0].Fingerprint == "" {
+		t.Errorf("expected the artifacts of the build to be recorded in %s, got %#v", history, recorded)
+	}
+}
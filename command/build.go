@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,9 +18,13 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template"
 	"github.com/hashicorp/packer/hcl2template"
+	"github.com/hashicorp/packer/internal/buildstate"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/hashicorp/packer/internal/notify"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
 	"github.com/hashicorp/packer/packer"
 	"github.com/hashicorp/packer/version"
-	"golang.org/x/sync/semaphore"
+	"golang.org/x/term"
 
 	"github.com/hako/durafmt"
 	"github.com/posener/complete"
@@ -26,11 +32,24 @@ import (
 
 type BuildCommand struct {
 	Meta
+
+	// interrupts receives the interrupts following the one cancelling the
+	// context of RunContext, terminated is closed when that one was a
+	// SIGTERM, see buildCancellation.
+	interrupts <-chan os.Signal
+	terminated <-chan struct{}
+	// failure is the class of the failure of the run, see fail.
+	failure packer.FailureClass
+	// budgetContext returns the context of a run with a maximum duration,
+	// context.WithTimeout when nil.
+	budgetContext func(ctx context.Context, maxDuration time.Duration) (context.Context, context.CancelFunc)
 }
 
 func (c *BuildCommand) Run(args []string) int {
-	ctx, cleanup := handleTermInterrupt(c.Ui)
+	ctx, interrupts, terminated, cleanup := handleBuildInterrupt(c.Ui)
 	defer cleanup()
+	c.interrupts = interrupts
+	c.terminated = terminated
 
 	cfg, ret := c.ParseArgs(args)
 	if ret != 0 {
@@ -49,8 +68,27 @@ func (c *BuildCommand) ParseArgs(args []string) (*BuildArgs, int) {
 		return &cfg, 1
 	}
 
-	if cfg.ParallelBuilds < 1 {
-		cfg.ParallelBuilds = math.MaxInt64
+	cfg.applyDefaults()
+
+	if cfg.Dashboard && (cfg.Debug || cfg.OnError == "ask") {
+		c.Ui.Error("-dashboard can't be used with -debug nor -on-error=ask, which ask questions.")
+		return &cfg, 1
+	}
+	if cfg.CancelGracePeriod < 0 || cfg.CleanupTimeout < 0 || cfg.TermGracePeriod < 0 {
+		c.Ui.Error("-cancel-grace-period, -cleanup-timeout and -term-grace-period can't be negative.")
+		return &cfg, 1
+	}
+	if cfg.MaxDuration < 0 {
+		c.Ui.Error("-max-duration can't be negative.")
+		return &cfg, 1
+	}
+	if cfg.ProvisionOnly != (cfg.TargetHost != "") {
+		c.Ui.Error("-provision-only and -target-host must be used together.")
+		return &cfg, 1
+	}
+	if cfg.ReplayDir != "" && (cfg.RecordDir != "" || cfg.ProvisionOnly) {
+		c.Ui.Error("-replay-dir can't be used with -record-dir nor -provision-only.")
+		return &cfg, 1
 	}
 
 	args = flags.Args()
@@ -62,12 +100,31 @@ func (c *BuildCommand) ParseArgs(args []string) (*BuildArgs, int) {
 	return &cfg, 0
 }
 
+// applyDefaults sets the settings implied by the other flags.
+func (ba *BuildArgs) applyDefaults() {
+	if ba.Force {
+		ba.ForceArtifact = true
+		ba.ForceDeregister = true
+		ba.ForceRegistry = true
+	}
+
+	// Resuming from a stage requires the snapshots of incremental builds.
+	if ba.FromStage != "" {
+		ba.Incremental = true
+	}
+
+	if ba.ParallelBuilds < 1 {
+		ba.ParallelBuilds = math.MaxInt64
+	}
+}
+
 func (m *Meta) GetConfigFromHCL(cla *MetaArgs) (*hcl2template.PackerConfig, int) {
 	parser := &hcl2template.Parser{
 		CorePackerVersion:       version.SemVer,
 		CorePackerVersionString: version.FormattedVersion(),
 		Parser:                  hclparse.NewParser(),
 		PluginConfig:            m.CoreConfig.Components.PluginConfig,
+		LocalExec:               m.CoreConfig.LocalExec,
 	}
 	cfg, diags := parser.Parse(cla.Path, cla.VarFiles, cla.Vars)
 	return cfg, writeDiags(m.Ui, parser.Files(), diags)
@@ -141,17 +198,78 @@ func (m *Meta) GetConfigFromJSON(cla *MetaArgs) (packer.Handler, int) {
 		m.Ui.Error(err.Error())
 		ret = 1
 	}
-	return &CoreWrapper{core}, ret
+	return &CoreWrapper{Core: core, varFiles: cla.VarFiles}, ret
 }
 
+// RunContext runs the builds of cla and, when they fail, reports the class of
+// the failure, see reportFailure.
 func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int {
+	c.failure = ""
+	return c.reportFailure(cla, c.runContext(buildCtx, cla))
+}
+
+func (c *BuildCommand) runContext(buildCtx context.Context, cla *BuildArgs) int {
+	// Exceeding the maximum duration cancels the run like an interrupt, but
+	// the results of the builds are still reported.
+	if cla.MaxDuration > 0 {
+		budgetContext := c.budgetContext
+		if budgetContext == nil {
+			budgetContext = context.WithTimeout
+		}
+		var cancelBudget context.CancelFunc
+		buildCtx, cancelBudget = budgetContext(buildCtx, cla.MaxDuration)
+		defer cancelBudget()
+		go warnBudgetExceeded(buildCtx, c.Ui, cla.MaxDuration)
+	}
+	if err := validateResume(cla); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	limitTypes, err := newBuildTypeLimits(cla.ParallelBuildsPerType)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	if cla.BuildLock && cla.Path != "" && cla.Path != "-" {
+		unlock, err := lockBuild(cla.Path)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		defer unlock()
+	}
+
+	// Ctrl-Z must pause the builds rather than stop their plugins.
+	if cla.PauseSignals {
+		c.CoreConfig.Components.PluginConfig.ProcessGroup = true
+	}
+
 	packerStarter, ret := c.GetConfig(&cla.MetaArgs)
 	if ret != 0 {
+		c.fail(configFailure(packerStarter))
 		return ret
 	}
 
 	diags := packerStarter.Initialize(packer.InitializeOptions{})
 	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		c.fail(configFailure(packerStarter))
+		return ret
+	}
+
+	if cla.SnapshotDir != "" {
+		if ret := c.snapshotTemplate(packerStarter, cla); ret != 0 {
+			return ret
+		}
+	}
+
+	// Start the HTTP servers before the builds are prepared, for their
+	// sources to use the URLs of the servers. They stop once the builds are
+	// over.
+	httpCtx, stopHTTPServers := context.WithCancel(buildCtx)
+	defer stopHTTPServers()
+	diags = packerStarter.StartHTTPServers(httpCtx, packer.StartHTTPServersOptions{Ui: c.Ui})
+	ret = writeDiags(c.Ui, nil, diags)
 	if ret != 0 {
 		return ret
 	}
@@ -161,12 +279,51 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 	// TODO find an option that is not managed by a globally shared Publisher.
 	ArtifactMetadataPublisher, diags := packerStarter.ConfiguredArtifactMetadataPublisher()
 	if diags.HasErrors() {
+		c.fail(packer.FailureRegistry)
 		return writeDiags(c.Ui, nil, diags)
 	}
 
+	// Provision-only builds produce no artifact to publish, replayed builds
+	// were published when recorded.
+	if (cla.ProvisionOnly || cla.ReplayDir != "") && ArtifactMetadataPublisher != nil {
+		c.Ui.Say(fmt.Sprintf("Provision-only and replayed builds are not published to the HCP Packer registry bucket %q.", ArtifactMetadataPublisher.Slug))
+		ArtifactMetadataPublisher = nil
+	}
+
+	if cla.EnvrcLock != "" {
+		lock, err := c.captureEnvLock()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to capture the build environment: %s", err))
+			return 1
+		}
+		if err := lock.Write(cla.EnvrcLock); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to write %q: %s", cla.EnvrcLock, err))
+			return 1
+		}
+		log.Printf("[INFO] build environment recorded in %s", cla.EnvrcLock)
+
+		// Record the environment with the iteration too, so that the lock
+		// file can be matched against the builds it produced.
+		if ArtifactMetadataPublisher != nil {
+			digest, err := lock.Digest()
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Failed to compute the digest of %q: %s", cla.EnvrcLock, err))
+				return 1
+			}
+			if ArtifactMetadataPublisher.BuildLabels == nil {
+				ArtifactMetadataPublisher.BuildLabels = make(map[string]string)
+			}
+			ArtifactMetadataPublisher.BuildLabels["packer_version"] = lock.PackerVersion
+			ArtifactMetadataPublisher.BuildLabels["packer_envrc_lock_sha256"] = digest
+		}
+	}
+
 	// We need to create a bucket and an empty iteration before we retrieve builds
 	// so that we can add the iteration ID to the build's eval context
 	if ArtifactMetadataPublisher != nil {
+		ArtifactMetadataPublisher.UploadBuildLogs = cla.HCPUploadLogs
+		ArtifactMetadataPublisher.HashArtifactFiles = cla.HCPChecksumFiles
+		ArtifactMetadataPublisher.ForceRebuild = cla.ForceRegistry
 		if err := ArtifactMetadataPublisher.Initialize(buildCtx); err != nil {
 			diags := hcl.Diagnostics{
 				&hcl.Diagnostic{
@@ -175,21 +332,249 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 					Severity: hcl.DiagError,
 				},
 			}
+			c.fail(packer.FailureRegistry)
 			return writeDiags(c.Ui, nil, diags)
 		}
 	}
 
+	// The input hashes of the builds are compared with, and recorded in, the
+	// state of the last successful builds.
+	useState := cla.IfChanged || cla.State != ""
+	// Checkpoints record the input hash of the builders, a build only
+	// continues with the same builder configuration.
+	useCheckpoints := cla.Checkpoint != "" || cla.Resume != ""
+	// The artifact history records the input hash of the builds as their
+	// fingerprint, unless it is disabled in the Packer config file.
+	var history string
+	if !c.CoreConfig.DisableArtifactHistory {
+		var err error
+		history, err = defaultArtifactHistory()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to find the artifact history, the artifacts will not be recorded: %s", err))
+		}
+	}
 	builds, diags := packerStarter.GetBuilds(packer.GetBuildsOptions{
-		Only:    cla.Only,
-		Except:  cla.Except,
-		Debug:   cla.Debug,
-		Force:   cla.Force,
-		OnError: cla.OnError,
+		Only:            cla.Only,
+		Except:          cla.Except,
+		Tags:            cla.Tags,
+		Debug:           cla.Debug,
+		Force:           cla.ForceArtifact,
+		ForceDeregister: cla.ForceDeregister,
+		OnError:         cla.OnError,
+		OnErrorRetries:  cla.OnErrorRetries,
+		Incremental:     cla.Incremental,
+		FromStage:       cla.FromStage,
+		HashInputs:      useState || useCheckpoints || history != "",
+		TempDirRoot:     cla.TempDirRoot,
+		TargetHost:      cla.TargetHost,
 	})
 
 	// here, something could have gone wrong but we still want to run valid
 	// builds.
 	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		c.fail(configFailure(packerStarter))
+	}
+	if checkLocalExec(c.Ui, c.CoreConfig.LocalExec, builds) != 0 {
+		c.fail(packer.FailureTemplate)
+		return 1
+	}
+
+	var state *buildstate.State
+	var stateBackend buildstate.Backend
+	if useState {
+		var err error
+		stateBackend, err = newStateBackend(cla.State, cla.Path, ArtifactMetadataPublisher)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to configure the build state: %s", err))
+			return 1
+		}
+		state, err = stateBackend.Load(buildCtx, stateTemplate(cla.Path))
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to load the build state: %s", err))
+			return 1
+		}
+	}
+	if cla.IfChanged {
+		changed := changedBuilds(builds, state)
+		run := map[packersdk.Build]bool{}
+		for _, b := range changed {
+			run[b] = true
+		}
+		for _, b := range builds {
+			if !run[b] {
+				c.Ui.Say(fmt.Sprintf("Build '%s' did not change since its last successful build, skipping.", b.Name()))
+				reportCachedArtifacts(c.Ui, b.Name(), state.Builds[b.Name()])
+			}
+		}
+		builds = changed
+		if len(builds) == 0 {
+			c.Ui.Say("Nothing changed since the last successful builds, there is nothing to build.")
+			return ret
+		}
+	}
+
+	// Fetch the assets of the builds left by -only, -except and -if-changed
+	// before any of them starts, so that a missing or corrupted file fails
+	// early.
+	buildNames := make([]string, 0, len(builds))
+	for _, b := range builds {
+		buildNames = append(buildNames, b.Name())
+	}
+	if diags := packerStarter.FetchAssets(buildCtx, packer.FetchAssetsOptions{
+		Ui:     c.Ui,
+		Builds: buildNames,
+	}); diags.HasErrors() {
+		return writeDiags(c.Ui, nil, diags)
+	}
+
+	// Builds start by priority, then in the order of the template.
+	builds = sortBuildsByPriority(builds)
+
+	var checkpoints *packer.CheckpointFile
+	if useCheckpoints {
+		var exists bool
+		var err error
+		checkpoints, exists, err = openCheckpoints(cla.Checkpoint, cla.Path)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to open the checkpoint file: %s", err))
+			return 1
+		}
+		switch {
+		case cla.Resume != "" && !exists:
+			c.Ui.Say(fmt.Sprintf("No checkpoint found at %s, building from scratch.", checkpoints.Path))
+		case cla.Resume == packer.ResumeContinue:
+			resumed := resumedBuilds(builds, checkpoints)
+			run := map[packersdk.Build]bool{}
+			for _, b := range resumed {
+				run[b] = true
+			}
+			for _, b := range builds {
+				if !run[b] {
+					c.Ui.Say(fmt.Sprintf("Build '%s' completed in the previous run, skipping.", b.Name()))
+				}
+			}
+			builds = resumed
+			if len(builds) == 0 {
+				c.Ui.Say("All the builds completed in the previous run, there is nothing to resume.")
+				if err := checkpoints.Remove(); err != nil {
+					c.Ui.Error(fmt.Sprintf("Failed to remove the checkpoint file: %s", err))
+				}
+				return ret
+			}
+		}
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.Checkpoints = checkpoints
+				cb.Resume = cla.Resume
+			}
+		}
+	}
+
+	if diags := checkHostRequirements(builds); diags.HasErrors() {
+		return writeDiags(c.Ui, nil, diags)
+	}
+
+	if effects := forceEffects(builds, ArtifactMetadataPublisher); len(effects) > 0 {
+		if err := c.confirm(&cla.ConfirmArgs, "Forcing the build may destroy existing resources:\n"+effects+"\nDo you want to continue?"); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	if cla.RecordDir != "" {
+		if err := os.MkdirAll(cla.RecordDir, 0755); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to create the recording directory: %s", err))
+			return 1
+		}
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.RecordingPath = buildFilePath(cla.RecordDir, cb.Name(), ".recording.json")
+			}
+		}
+	}
+	if cla.ReplayDir != "" {
+		for _, b := range builds {
+			cb, ok := b.(*packer.CoreBuild)
+			if !ok {
+				continue
+			}
+			rec, err := packer.ReadBuildRecording(buildFilePath(cla.ReplayDir, cb.Name(), ".recording.json"))
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Failed to read the recording of build %q: %s", cb.Name(), err))
+				return 1
+			}
+			cb.Replay(rec)
+		}
+	}
+
+	if cla.TranscriptDir != "" {
+		if err := os.MkdirAll(cla.TranscriptDir, 0755); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to create the transcript directory: %s", err))
+			return 1
+		}
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.TranscriptPath = buildFilePath(cla.TranscriptDir, cb.Name(), ".transcript.json")
+				cb.TranscriptHashOutput = cla.TranscriptHashOutput
+			}
+		}
+	}
+
+	if cla.ConsoleLogDir != "" {
+		if err := os.MkdirAll(cla.ConsoleLogDir, 0755); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to create the console log directory: %s", err))
+			return 1
+		}
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.ConsoleLogPath = buildFilePath(cla.ConsoleLogDir, cb.Name(), ".console.log")
+			}
+		}
+	}
+
+	// The resources the builders create are recorded until they are destroyed,
+	// for `packer cleanup` to destroy the ones interrupted builds leave behind.
+	if ledger, err := packer.DefaultResourceLedger(); err != nil {
+		log.Printf("[WARN] not tracking the resources of the builds: %s", err)
+	} else {
+		if runUUID := os.Getenv("PACKER_RUN_UUID"); runUUID != "" {
+			release, err := ledger.HoldRun(runUUID)
+			if err != nil {
+				log.Printf("[WARN] failed to mark the run as active: %s", err)
+			} else {
+				defer release()
+			}
+		}
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.ResourceLedger = ledger
+			}
+		}
+	}
+
+	// The post-processor chains that fail are recorded along with the builder
+	// artifact, for `packer postprocess -retry` to run them again.
+	if cla.Path != "" && cla.Path != "-" {
+		ledger := postProcessLedger(cla.Path)
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.PostProcessLedger = ledger
+			}
+		}
+	}
+
+	// With -pause-signals, the provisioning of the builds pauses on SIGTSTP
+	// and resumes on SIGCONT.
+	if cla.PauseSignals {
+		pause := &packer.PauseGate{}
+		defer handlePauseSignals(c.Ui, pause)()
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.Pause = pause
+			}
+		}
+	}
 
 	if cla.Debug {
 		c.Ui.Say("Debug mode enabled. Builds will not be parallelized.")
@@ -206,8 +591,28 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 					Severity: hcl.DiagError,
 				},
 			}
+			c.fail(packer.FailureRegistry)
 			return writeDiags(c.Ui, nil, diags)
 		}
+		// The HCP Packer registry records the input hashes with the builds,
+		// for the state to be read from the bucket.
+		if useState {
+			for _, b := range builds {
+				cb, ok := b.(*packer.CoreBuild)
+				if !ok {
+					continue
+				}
+				if rb, ok := cb.Builder.(*packer.RegistryBuilder); ok {
+					labels := map[string]string{
+						buildstate.InputHashLabel: cb.InputHash(),
+						buildstate.BuildNameLabel: cb.Name(),
+					}
+					if err := ArtifactMetadataPublisher.UpdateLabelsForBuild(rb.Name, labels); err != nil {
+						log.Printf("[TRACE] failed to record the input hash of %q for the HCP Packer registry: %s", cb.Name(), err)
+					}
+				}
+			}
+		}
 	}
 
 	// Compile all the UIs for the builds
@@ -219,9 +624,18 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		packer.UiColorBlue,
 	}
 	buildUis := make(map[packersdk.Build]packersdk.Ui)
+	var dashboard *packer.Dashboard
+	if cla.Dashboard {
+		dashboard = c.newDashboard(builds)
+	}
 	for i := range builds {
+		if dashboard != nil {
+			buildUis[builds[i]] = dashboard.Ui(builds[i].Name())
+			continue
+		}
 		ui := c.Ui
-		if cla.Color {
+		_, jsonUi := c.Ui.(*packer.JSONUi)
+		if cla.Color && !jsonUi {
 			// Only set up UI colors if -machine-readable isn't set.
 			if _, ok := c.Ui.(*packer.MachineReadableUi); !ok {
 				ui = &packer.ColoredUi{
@@ -235,21 +649,55 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 				}
 			}
 		}
-		// Now add timestamps if requested
-		if cla.TimestampUi {
+		// Now add timestamps if requested, JSON events have their own.
+		if cla.TimestampUi && !jsonUi {
 			ui = &packer.TimestampedUi{
 				Ui: ui,
 			}
 		}
+		// Render the progress reported by the steps of the builds when
+		// attached to a terminal.
+		if basicUi, ok := c.Ui.(*packersdk.BasicUi); ok {
+			if pb, ok := basicUi.PB.(packer.StepProgressTracker); ok {
+				ui = &packer.ProgressUi{
+					Ui: ui,
+					PB: pb,
+				}
+			}
+		}
 
 		buildUis[builds[i]] = ui
 	}
 	log.Printf("Build debug mode: %v", cla.Debug)
-	log.Printf("Force build: %v", cla.Force)
+	log.Printf("Force build: artifact=%v, deregister=%v, registry=%v", cla.ForceArtifact, cla.ForceDeregister, cla.ForceRegistry)
 	log.Printf("On error: %v", cla.OnError)
 
 	// Get the start of the build command
 	buildCommandStart := time.Now()
+	if dashboard != nil {
+		dashboard.Start()
+	}
+
+	// The running builds are only cancelled after the grace period, they
+	// run with their own context.
+	cancellation := &buildCancellation{
+		ui:              c.Ui,
+		GracePeriod:     cla.CancelGracePeriod,
+		CleanupTimeout:  cla.CleanupTimeout,
+		TermGracePeriod: cla.TermGracePeriod,
+		interrupts:      c.interrupts,
+		terminated:      c.terminated,
+	}
+	runCtx, cancelRun := cancellation.RunContext(buildCtx)
+	defer cancelRun()
+
+	var monitor *packer.ResourceMonitor
+	if cla.ResourceUsage {
+		monitor = packer.NewResourceMonitor(c.CoreConfig.Components.PluginConfig)
+		monitorCtx, stopMonitor := context.WithCancel(context.Background())
+		defer stopMonitor()
+		go monitor.Run(monitorCtx)
+	}
 
 	// Run all the builds in parallel and wait for them to complete
 	var wg sync.WaitGroup
@@ -257,12 +705,29 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		sync.RWMutex
 		m map[string][]packersdk.Artifact
 	}{m: make(map[string][]packersdk.Artifact)}
+	// How long each build ran, for the JUnit report.
+	var durations = struct {
+		sync.Mutex
+		m map[string]time.Duration
+	}{m: make(map[string]time.Duration)}
 	// Get the builds we care about
 	var errors = struct {
 		sync.RWMutex
 		m map[string]error
 	}{m: make(map[string]error)}
-	limitParallel := semaphore.NewWeighted(cla.ParallelBuilds)
+	// Waiting builds get a free slot in the order of builds, see buildQueue.
+	limitParallel := newBuildQueue(cla.ParallelBuilds)
+	// Builds of a same serial group run one after the other, each group is
+	// guarded by its own lock.
+	serialGroups := map[string]*buildQueue{}
+	for _, b := range builds {
+		if group := serialGroup(b); group != "" && serialGroups[group] == nil {
+			serialGroups[group] = newBuildQueue(1)
+		}
+	}
+	// Builds depending on other builds wait for them; builds are ordered so
+	// that they come after the builds they depend on.
+	dependencies := newBuildDependencies(builds)
 	for i := range builds {
 		if err := buildCtx.Err(); err != nil {
 			log.Println("Interrupted, not going to start any more builds.")
@@ -270,42 +735,116 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		}
 
 		b := builds[i]
+		rank := i
 		name := b.Name()
 		ui := buildUis[b]
-		if err := limitParallel.Acquire(buildCtx, 1); err != nil {
-			ui.Error(fmt.Sprintf("Build '%s' failed to acquire semaphore: %s", name, err))
-			errors.Lock()
-			errors.m[name] = err
-			errors.Unlock()
-			break
+		group := serialGroup(b)
+		limitedType, typeLock := limitTypes.limit(b)
+		// A build of a serial group, of a limited builder type, or depending
+		// on other builds, acquires its semaphore once it is free to start,
+		// so that waiting doesn't hold back other builds.
+		deferAcquire := group != "" || typeLock != nil || len(dependsOn(b)) > 0
+		if !deferAcquire {
+			if err := limitParallel.Acquire(buildCtx, rank); err != nil {
+				ui.Error(fmt.Sprintf("Build '%s' failed to acquire semaphore: %s", name, err))
+				errors.Lock()
+				errors.m[name] = err
+				errors.Unlock()
+				break
+			}
 		}
 		// Increment the waitgroup so we wait for this item to finish properly
 		wg.Add(1)
 
 		// Run the build in a goroutine
 		go func() {
-			// Get the start of the build
-			buildStart := time.Now()
-
 			defer wg.Done()
 
-			defer limitParallel.Release(1)
+			var runArtifacts []packersdk.Artifact
+			var err error
+			defer func() { dependencies.Done(b, runArtifacts, err) }()
+
+			if err = dependencies.Wait(buildCtx, b, ui); err != nil {
+				ui.Error(fmt.Sprintf("Build '%s' was not started: %s", name, err))
+				errors.Lock()
+				errors.m[name] = err
+				errors.Unlock()
+				return
+			}
+
+			if group != "" {
+				groupLock := serialGroups[group]
+				if !groupLock.TryAcquire() {
+					ui.Say(fmt.Sprintf("Build '%s' is waiting for the other builds of the serial group %q", name, group))
+					if err = groupLock.Acquire(buildCtx, rank); err != nil {
+						ui.Error(fmt.Sprintf("Build '%s' failed to acquire the serial group %q: %s", name, group, err))
+						errors.Lock()
+						errors.m[name] = err
+						errors.Unlock()
+						return
+					}
+				}
+				defer groupLock.Release()
+			}
+			if typeLock != nil {
+				if !typeLock.TryAcquire() {
+					ui.Say(fmt.Sprintf("Build '%s' is waiting for other %s builds to finish", name, limitedType))
+					if err = typeLock.Acquire(buildCtx, rank); err != nil {
+						ui.Error(fmt.Sprintf("Build '%s' failed to acquire the %s builds limit: %s", name, limitedType, err))
+						errors.Lock()
+						errors.m[name] = err
+						errors.Unlock()
+						return
+					}
+				}
+				defer typeLock.Release()
+			}
+			if deferAcquire {
+				if err = limitParallel.Acquire(buildCtx, rank); err != nil {
+					ui.Error(fmt.Sprintf("Build '%s' failed to acquire semaphore: %s", name, err))
+					errors.Lock()
+					errors.m[name] = err
+					errors.Unlock()
+					return
+				}
+			}
+			defer limitParallel.Release()
+
+			// Get the start of the build
+			buildStart := time.Now()
 
 			log.Printf("Starting build run: %s", name)
-			runArtifacts, err := b.Run(buildCtx, ui)
+			machineUi := &packer.TargetedUI{Target: name, Ui: ui}
+			machineUi.Machine("build", "started")
+			cancellation.Started(name)
+			if monitor != nil {
+				monitor.BuildStarted(name)
+			}
+			runArtifacts, err = b.Run(runCtx, ui)
+			if monitor != nil {
+				monitor.BuildDone(name)
+			}
+			// The build is done once its outcome is recorded, see
+			// buildCancellation.Succeeded.
+			defer cancellation.Done(name)
 
 			// Get the duration of the build and parse it
 			buildEnd := time.Now()
 			buildDuration := buildEnd.Sub(buildStart)
+			durations.Lock()
+			durations.m[name] = buildDuration
+			durations.Unlock()
 			fmtBuildDuration := durafmt.Parse(buildDuration).LimitFirstN(2)
 
 			if err != nil {
 				ui.Error(fmt.Sprintf("Build '%s' errored after %s: %s", name, fmtBuildDuration, err))
+				machineUi.Machine("build", "errored", err.Error())
 				errors.Lock()
 				errors.m[name] = err
 				errors.Unlock()
 			} else {
 				ui.Say(fmt.Sprintf("Build '%s' finished after %s.", name, fmtBuildDuration))
+				machineUi.Machine("build", "finished")
 				if runArtifacts != nil {
 					artifacts.Lock()
 					artifacts.m[name] = runArtifacts
@@ -329,7 +868,13 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 	// Wait for both the builds to complete and the interrupt handler,
 	// if it is interrupted.
 	log.Printf("Waiting on builds to complete...")
-	wg.Wait()
+	cleanedUp := cancellation.Wait(runCtx, &wg)
+	if dashboard != nil {
+		dashboard.Stop()
+	}
+	if !cleanedUp {
+		c.Ui.Error(fmt.Sprintf("Exiting without waiting for the builds %s to clean up, they may leave resources behind.", strings.Join(cancellation.Running(), ", ")))
+	}
 
 	// Get the duration of the buildCommand command and parse it
 	buildCommandEnd := time.Now()
@@ -337,11 +882,143 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 	fmtBuildCommandDuration := durafmt.Parse(buildCommandDuration).LimitFirstN(2)
 	c.Ui.Say(fmt.Sprintf("\n==> Wait completed after %s", fmtBuildCommandDuration))
 
+	// The builds abandoned while cleaning up are still running, the outcome
+	// of the others is recorded even if the run was interrupted.
+	errors.RLock()
+	succeeded := cancellation.Succeeded(builds, errors.m)
+	errors.RUnlock()
+	artifacts.RLock()
+	succeededArtifacts := map[string][]packersdk.Artifact{}
+	for name := range succeeded {
+		succeededArtifacts[name] = artifacts.m[name]
+	}
+	artifacts.RUnlock()
+
+	budgetExceeded := buildCtx.Err() == context.DeadlineExceeded
+	interrupted := !cleanedUp
 	if err := buildCtx.Err(); err != nil {
-		c.Ui.Say("Cleanly cancelled builds after being interrupted.")
+		// Builds that never started, or that were stopped before reporting
+		// their status, would otherwise be left dangling in the registry.
+		if ArtifactMetadataPublisher != nil {
+			if err := ArtifactMetadataPublisher.CancelPendingBuilds(context.Background(), packerregistry.CancellationReason(err)); err != nil {
+				c.Ui.Error(fmt.Sprintf("Failed to mark the interrupted builds as cancelled in the HCP Packer registry: %s", err))
+			}
+		}
+		if !budgetExceeded {
+			interrupted = true
+		}
+	}
+	if budgetExceeded && !interrupted {
+		// The builds that completed are reported as usual, along with the
+		// ones skipped.
+		skipped := cancellation.SkipNotStarted(builds, errors.m, cla.MaxDuration)
+		c.Ui.Machine("max-duration-exceeded", cla.MaxDuration.String(), strings.Join(skipped, ","))
+		if len(skipped) > 0 {
+			c.Ui.Say(fmt.Sprintf("\n==> The run exceeded its maximum duration of %s, the running builds were cancelled and the builds not started yet were skipped: %s.",
+				cla.MaxDuration, strings.Join(skipped, ", ")))
+		} else {
+			c.Ui.Say(fmt.Sprintf("\n==> The run exceeded its maximum duration of %s, the running builds were cancelled.", cla.MaxDuration))
+		}
+		c.fail(packer.FailureTimedOut)
+		ret = 1
+	}
+
+	if state != nil {
+		for _, b := range builds {
+			if !succeeded[b.Name()] {
+				continue
+			}
+			state.Record(b.Name(), buildstate.Build{
+				InputHash:   buildInputHash(b),
+				CompletedAt: buildCommandEnd,
+				Artifacts:   stateArtifacts(succeededArtifacts[b.Name()]),
+			})
+		}
+		if err := stateBackend.Save(context.Background(), stateTemplate(cla.Path), state); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to save the build state: %s", err))
+			ret = 1
+		}
+	}
+
+	template := absTemplate(cla.Path)
+	if history != "" {
+		var recorded []*recordedArtifact
+		for _, b := range builds {
+			if succeeded[b.Name()] {
+				recorded = append(recorded, historyArtifacts(template, b, succeededArtifacts[b.Name()], buildCommandEnd)...)
+			}
+		}
+		err := updateHistory(history, func(artifacts []*recordedArtifact) []*recordedArtifact {
+			return append(artifacts, recorded...)
+		})
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to record the artifacts in the artifact history: %s", err))
+		}
+	}
+
+	if cla.JUnitOutput != "" {
+		running := map[string]bool{}
+		for _, name := range cancellation.Running() {
+			running[name] = true
+		}
+		outcomes := map[string]buildOutcome{}
+		errors.RLock()
+		durations.Lock()
+		for _, b := range builds {
+			name := b.Name()
+			duration, started := durations.m[name]
+			o := buildOutcome{Started: started, Duration: duration, Err: errors.m[name]}
+			if cb, ok := b.(*packer.CoreBuild); ok && cla.JUnitProvisioners && started && !running[name] {
+				o.Steps = cb.Timings()
+			}
+			outcomes[name] = o
+		}
+		durations.Unlock()
+		errors.RUnlock()
+		report := newJUnitReport(template, builds, outcomes, buildCommandStart, buildCommandEnd)
+		if err := writeJUnitReport(cla.JUnitOutput, report); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to write the JUnit report: %s", err))
+			ret = 1
+		}
+	}
+
+	if interrupted {
+		if cleanedUp {
+			c.Ui.Say("Cleanly cancelled builds after being interrupted.")
+		}
+		c.fail(packer.FailureInterrupted)
 		return 1
 	}
 
+	// Failing to notify does not fail the builds.
+	if targets := c.CoreConfig.Notifications; len(targets) > 0 {
+		payload := notificationPayload(template, builds, artifacts.m, errors.m, buildCommandStart, buildCommandEnd)
+		if budgetExceeded {
+			payload.Outcome = notify.OnFailure
+		}
+		for _, err := range notify.Notify(context.Background(), targets, payload) {
+			c.Ui.Error(err.Error())
+		}
+	}
+
+	// The checkpoints are only needed until all the builds completed.
+	if checkpoints != nil && len(errors.m) == 0 {
+		if err := checkpoints.Remove(); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to remove the checkpoint file: %s", err))
+		}
+	}
+
+	// Failing to evict cached files does not fail the builds, they are
+	// evicted by the next ones.
+	if policy := c.CoreConfig.CachePolicy; policy.Enabled() {
+		if entries, err := c.cacheEntries(); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to apply the cache policy: %s", err))
+		} else if evicted, _ := evictCache(c.Ui, policy, entries, time.Now()); len(evicted) > 0 {
+			c.Ui.Say(fmt.Sprintf("\n==> Evicted %d cached file(s) per the cache policy, freeing %s",
+				len(evicted), cache.FormatSize(cache.Size(evicted))))
+		}
+	}
+
 	if len(errors.m) > 0 {
 		c.Ui.Machine("error-count", strconv.FormatInt(int64(len(errors.m)), 10))
 
@@ -354,6 +1031,8 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 			}
 
 			ui.Machine("error", err.Error())
+			class := packer.ClassifyFailure(err)
+			ui.Machine("failure", string(class), strconv.Itoa(class.ExitCode()), err.Error())
 
 			c.Ui.Error(fmt.Sprintf("--> %s: %s", name, err))
 		}
@@ -409,14 +1088,69 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		c.Ui.Say("\n==> Builds finished but no artifacts were created.")
 	}
 
+	if monitor != nil {
+		reportResourceUsage(c.Ui, builds, monitor)
+	}
+
+	// Optional builds, or builds left to other runs, do not prevent the
+	// iteration from being complete.
+	if ArtifactMetadataPublisher != nil {
+		complete, missing := ArtifactMetadataPublisher.IterationCompletion()
+		if complete {
+			c.Ui.Say(fmt.Sprintf("\n==> Iteration %s of the HCP Packer bucket %q is complete.",
+				ArtifactMetadataPublisher.Iteration.ID, ArtifactMetadataPublisher.Slug))
+			if !c.publishIteration(context.Background(), ArtifactMetadataPublisher, cla.ApprovePromotion) {
+				ret = 1
+			}
+		} else {
+			c.Ui.Machine("hcp-missing-required-builds", strings.Join(missing, ","))
+			c.Ui.Say(fmt.Sprintf("\n==> Iteration %s of the HCP Packer bucket %q is not complete, the required builds %s are not done.",
+				ArtifactMetadataPublisher.Iteration.ID, ArtifactMetadataPublisher.Slug, strings.Join(missing, ", ")))
+		}
+	}
+
 	if len(errors.m) > 0 {
 		// If any errors occurred, exit with a non-zero exit status
+		c.fail(buildsFailure(builds, errors.m))
 		ret = 1
 	}
 
 	return ret
 }
 
+// buildFilePath returns the path of the file of the named build in dir with
+// the given extension, like a transcript.
+func buildFilePath(dir, name, ext string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(name)
+	return filepath.Join(dir, name+ext)
+}
+
+// serialGroup returns the serial group of a build, if any.
+func serialGroup(b packersdk.Build) string {
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		return cb.SerialGroup
+	}
+	return ""
+}
+
+// forceEffects lists, per build, what forcing the builds may destroy.
+func forceEffects(builds []packersdk.Build, publisher *packerregistry.Bucket) string {
+	var b strings.Builder
+	for _, build := range builds {
+		var effects []string
+		if cb, ok := build.(*packer.CoreBuild); ok {
+			effects = cb.ForceEffects()
+		}
+		if publisher != nil && publisher.ForceRebuild {
+			effects = append(effects, fmt.Sprintf("a build already done in iteration %s of the HCP Packer bucket %q will be replaced", publisher.Iteration.ID, publisher.Slug))
+		}
+		for _, effect := range effects {
+			fmt.Fprintf(&b, "  * %s: %s\n", build.Name(), effect)
+		}
+	}
+	return b.String()
+}
+
 func (*BuildCommand) Help() string {
 	helpText := `
 Usage: packer build [options] TEMPLATE
@@ -426,15 +1160,53 @@ Usage: packer build [options] TEMPLATE
 
 Options:
 
+  -approve-promotion            Approve the promotions of the iteration to the channels of the publish blocks requiring approval.
+  -auto-approve                 Do not ask for confirmation before destructive operations, like -force.
+  -build-lock                   Lock the template while it is built, a concurrent build of the same template fails right away. The lock file is kept in the Packer config directory.
+  -cancel-grace-period=0s       Let the running builds run for this long after an interrupt before cancelling them, a second interrupt cancels them right away. (Default: 0s)
+  -checkpoint=path              Record the progress of the builds in this file, for -resume after a crash. (Default: packer.checkpoint.json next to the template with -resume)
+  -cleanup-timeout=0s           Stop waiting for the cancelled builds to clean up after this long, a further interrupt stops waiting right away. 0 means no limit. (Default: 0s)
+  -term-grace-period=0s         On a SIGTERM, cancel the running builds right away and exit after letting them clean up for this long at most. 0 means the cleanup timeout applies. (Default: 0s)
   -color=false                  Disable color output. (Default: color)
+  -console-log-dir=path         Capture the console output of the machine of each build in this directory, with builders supporting it.
+  -dashboard                    Show each build in its own pane, with its status, elapsed time and last output line, rather than interleaving their output.
   -debug                        Debug mode enabled for builds.
+  -detailed-exitcodes           Exit with a code telling what failed, like 7 for a provisioner failure, rather than with 1 on any failure.
+  -envrc-lock=path              Record the build environment into this lock file, see "packer envrc".
   -except=foo,bar,baz           Run all builds and post-processors other than these.
-  -only=foo,bar,baz             Build only the specified builds.
-  -force                        Force a build to continue if artifacts exist, deletes existing artifacts.
+  -only=foo,bar,baz             Build only the specified builds. Patterns like tag:foo match the tags of the builds.
+  -force                        Force a build to continue if artifacts exist, deletes existing artifacts. Implies all the -force-* flags.
+  -force-artifact               Let builders delete or overwrite the artifacts of a previous build, like local output directories.
+  -force-deregister             Deregister existing images conflicting with the build, on builders supporting force_deregister.
+  -force-registry               Rebuild the builds already done in the HCP Packer registry iteration, replacing their images.
+  -from-stage=name              Resume incremental builds from the snapshot taken before this stage. Implies -incremental.
+  -hcp-checksum-files           Record the SHA256 of the artifact files in their HCP Packer registry build, in the packer_checksums label.
+  -hcp-upload-logs              Publish the end of each build log to its HCP Packer registry build, as the packer_build_log label.
+  -if-changed                   Only run the builds whose inputs changed since their last successful build, recorded in the -state.
+  -incremental                  Snapshot the machines between provisioners and resume from the last unchanged snapshot, with builders supporting it.
+  -json                         Produce one JSON object per message or event, see the docs of the JSON output.
+  -junit-output=path            Write a JUnit XML report of the builds to this file, for CI systems to render.
+  -junit-provisioners           Also report each provisioner of the builds as a test case of the JUnit report.
   -machine-readable             Produce machine-readable output.
-  -on-error=[cleanup|abort|ask|run-cleanup-provisioner] If the build fails do: clean up (default), abort, ask, or run-cleanup-provisioner.
+  -max-duration=0s              Stop the whole run after this long: skip the builds not started yet and cancel the running ones. 0 means no limit. (Default: 0s)
+  -on-error=[cleanup|abort|ask|run-cleanup-provisioner|retry] If the build fails do: clean up (default), abort, ask, run-cleanup-provisioner, or retry the failed provisioner or post-processor before cleaning up.
+  -on-error-retries=2           Number of times a failed provisioner or post-processor runs again with -on-error=retry.
   -parallel-builds=1            Number of builds to run in parallel. 1 disables parallelization. 0 means no limit (Default: 0)
+  -parallel-builds-per-type 'type=N' Number of builds of a builder type, like vsphere-iso, or of a plugin, like vsphere, to run in parallel, can be used multiple times. 0 means no limit.
+  -pause-signals                Pause the provisioning of the builds on SIGTSTP, like Ctrl-Z, and resume it on SIGCONT, instead of stopping Packer.
+  -provision-only               Skip the builders: run the provisioners against the existing machine at -target-host, connecting with the communicator of each build.
+  -record-dir=path              Record the interactions of each build with its plugins in this directory, for -replay-dir.
+  -replay-dir=path              Replay the builds recorded with -record-dir in this directory: run the core and the provisioners against the recording, without running the builders nor the post-processors.
+  -resource-usage               Sample the CPU and memory used by the plugins of each build and report them, with the network traffic, once the builds finished.
+  -resume=[continue|cleanup]    Resume the builds that did not complete in the run recorded in the -checkpoint: continue them from their last completed step, or clean up their resources and build them again.
+  -snapshot-dir=path            Copy the template, its var files and the values of its variables into this directory before building, the sensitive values redacted.
+  -state=location               Record the input hashes of the successful builds in this file, s3://bucket/key or hcp. (Default: packer.state.json next to the template with -if-changed)
+  -tag=foo,bar                  Build only the builds tagged with all of these.
+  -target-host=host[:port]      The existing machine provisioned by -provision-only.
+  -temp-dir-root=path           Create the scratch directory of each build, removed once it completed, in this directory. (Default: the system temporary directory)
   -timestamp-ui                 Enable prefixing of each ui output with an RFC3339 timestamp.
+  -transcript-dir=path          Write the transcript of the commands run on the guest by each build in this directory.
+  -transcript-hash-output       Record the sha256 of the outputs of the commands in the transcripts.
   -var 'key=value'              Variable for templates, can be used multiple times.
   -var-file=path                JSON or HCL2 file containing user variables.
 `
@@ -442,6 +1214,25 @@ Options:
 	return strings.TrimSpace(helpText)
 }
 
+// newDashboard returns the dashboard of builds, nil when the output is not a
+// terminal.
+func (c *BuildCommand) newDashboard(builds []packersdk.Build) *packer.Dashboard {
+	basicUi, ok := c.Ui.(*packersdk.BasicUi)
+	if !ok || !term.IsTerminal(int(os.Stdout.Fd())) {
+		c.Ui.Error("Warning: -dashboard requires the output to be a terminal, it is ignored.")
+		return nil
+	}
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		log.Printf("[WARN] failed to get the width of the terminal: %s", err)
+	}
+	names := make([]string, 0, len(builds))
+	for _, b := range builds {
+		names = append(names, b.Name())
+	}
+	return packer.NewDashboard(basicUi.Writer, width, names)
+}
+
 func (*BuildCommand) Synopsis() string {
 	return "build image(s) from template"
 }
@@ -452,16 +1243,54 @@ func (*BuildCommand) AutocompleteArgs() complete.Predictor {
 
 func (*BuildCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
-		"-color":            complete.PredictNothing,
-		"-debug":            complete.PredictNothing,
-		"-except":           complete.PredictNothing,
-		"-only":             complete.PredictNothing,
-		"-force":            complete.PredictNothing,
-		"-machine-readable": complete.PredictNothing,
-		"-on-error":         complete.PredictNothing,
-		"-parallel":         complete.PredictNothing,
-		"-timestamp-ui":     complete.PredictNothing,
-		"-var":              complete.PredictNothing,
-		"-var-file":         complete.PredictNothing,
+		"-auto-approve":             complete.PredictNothing,
+		"-approve-promotion":        complete.PredictNothing,
+		"-build-lock":               complete.PredictNothing,
+		"-cancel-grace-period":      complete.PredictNothing,
+		"-checkpoint":               complete.PredictFiles("*"),
+		"-cleanup-timeout":          complete.PredictNothing,
+		"-term-grace-period":        complete.PredictNothing,
+		"-junit-output":             complete.PredictFiles("*.xml"),
+		"-junit-provisioners":       complete.PredictNothing,
+		"-color":                    complete.PredictNothing,
+		"-console-log-dir":          complete.PredictDirs("*"),
+		"-dashboard":                complete.PredictNothing,
+		"-debug":                    complete.PredictNothing,
+		"-detailed-exitcodes":       complete.PredictNothing,
+		"-envrc-lock":               complete.PredictFiles("*"),
+		"-except":                   complete.PredictNothing,
+		"-only":                     complete.PredictNothing,
+		"-tag":                      complete.PredictNothing,
+		"-force":                    complete.PredictNothing,
+		"-force-artifact":           complete.PredictNothing,
+		"-force-deregister":         complete.PredictNothing,
+		"-force-registry":           complete.PredictNothing,
+		"-from-stage":               complete.PredictNothing,
+		"-hcp-checksum-files":       complete.PredictNothing,
+		"-hcp-upload-logs":          complete.PredictNothing,
+		"-if-changed":               complete.PredictNothing,
+		"-incremental":              complete.PredictNothing,
+		"-json":                     complete.PredictNothing,
+		"-machine-readable":         complete.PredictNothing,
+		"-max-duration":             complete.PredictNothing,
+		"-on-error":                 complete.PredictNothing,
+		"-on-error-retries":         complete.PredictNothing,
+		"-parallel":                 complete.PredictNothing,
+		"-parallel-builds-per-type": complete.PredictNothing,
+		"-pause-signals":            complete.PredictNothing,
+		"-provision-only":           complete.PredictNothing,
+		"-record-dir":               complete.PredictDirs("*"),
+		"-replay-dir":               complete.PredictDirs("*"),
+		"-resource-usage":           complete.PredictNothing,
+		"-resume":                   complete.PredictSet("continue", "cleanup"),
+		"-snapshot-dir":             complete.PredictDirs("*"),
+		"-state":                    complete.PredictFiles("*"),
+		"-target-host":              complete.PredictNothing,
+		"-temp-dir-root":            complete.PredictDirs("*"),
+		"-timestamp-ui":             complete.PredictNothing,
+		"-transcript-dir":           complete.PredictDirs("*"),
+		"-transcript-hash-output":   complete.PredictNothing,
+		"-var":                      complete.PredictNothing,
+		"-var-file":                 complete.PredictNothing,
 	}
 }
@@ -0,0 +1,206 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// buildCancellation cancels the running builds after an interrupt. The first
+// interrupt cancels the context of the build command: no more builds are
+// started, and the running builds are cancelled once the grace period
+// elapsed, or right away on the next interrupt. Cancelled builds then clean up
+// their resources, for up to the cleanup timeout; another interrupt abandons
+// their cleanup. A SIGTERM cancels the running builds right away, it is
+// followed by a SIGKILL: their cleanup is bounded by the term grace period.
+type buildCancellation struct {
+	ui packersdk.Ui
+	// GracePeriod is how long the running builds can keep running after the
+	// first interrupt, 0 cancels them right away.
+	GracePeriod time.Duration
+	// CleanupTimeout is how long the cancelled builds can take to clean up,
+	// 0 means no limit.
+	CleanupTimeout time.Duration
+	// TermGracePeriod is how long the builds cancelled on a SIGTERM can take
+	// to clean up, 0 means the CleanupTimeout applies.
+	TermGracePeriod time.Duration
+	// interrupts receives the interrupts following the first one, nil when
+	// they are not handled. terminated is closed when the first one is a
+	// SIGTERM.
+	interrupts <-chan os.Signal
+	terminated <-chan struct{}
+
+	l       sync.Mutex
+	running map[string]bool
+	started map[string]bool
+}
+
+// RunContext returns the context the builds run with, cancelled GracePeriod
+// after ctx is or on the next interrupt. It must be cancelled once the builds
+// are done.
+func (bc *buildCancellation) RunContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-runCtx.Done():
+			return
+		}
+		if bc.Terminated() {
+			bc.ui.Error("Cancelling the running builds right away after receiving terminated.")
+			cancel()
+			return
+		}
+		if bc.GracePeriod <= 0 {
+			cancel()
+			return
+		}
+		bc.ui.Error(fmt.Sprintf("The running builds will be cancelled in %s, interrupt again to cancel them now.", bc.GracePeriod))
+		timer := time.NewTimer(bc.GracePeriod)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			bc.ui.Error(fmt.Sprintf("Cancelling the running builds after a grace period of %s.", bc.GracePeriod))
+		case sig := <-bc.interrupts:
+			bc.ui.Error(fmt.Sprintf("Cancelling the running builds after receiving %s.", sig))
+		case <-runCtx.Done():
+		}
+		cancel()
+	}()
+	return runCtx, cancel
+}
+
+// Terminated tells whether the run was cancelled by a SIGTERM.
+func (bc *buildCancellation) Terminated() bool {
+	select {
+	case <-bc.terminated:
+		return true
+	default:
+		return false
+	}
+}
+
+// Started records that the named build is running, until Done is called.
+func (bc *buildCancellation) Started(name string) {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+	if bc.running == nil {
+		bc.running = map[string]bool{}
+		bc.started = map[string]bool{}
+	}
+	bc.running[name] = true
+	bc.started[name] = true
+}
+
+// Done records that the named build returned.
+func (bc *buildCancellation) Done(name string) {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+	delete(bc.running, name)
+}
+
+// Running returns the names of the builds still running, sorted.
+func (bc *buildCancellation) Running() []string {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+	names := make([]string, 0, len(bc.running))
+	for name := range bc.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Wait waits for the builds of wg to return. Once runCtx is cancelled, it
+// waits for up to CleanupTimeout, or until the next interrupt; it returns
+// false when it stopped waiting before all the builds returned.
+func (bc *buildCancellation) Wait(runCtx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-runCtx.Done():
+	}
+
+	cleanupTimeout := bc.CleanupTimeout
+	if bc.Terminated() && bc.TermGracePeriod > 0 && (cleanupTimeout <= 0 || bc.TermGracePeriod < cleanupTimeout) {
+		cleanupTimeout = bc.TermGracePeriod
+	}
+	var timeout <-chan time.Time
+	if cleanupTimeout > 0 {
+		timer := time.NewTimer(cleanupTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+		return true
+	case <-timeout:
+		bc.ui.Error(fmt.Sprintf("The cancelled builds did not clean up within %s.", cleanupTimeout))
+	case sig := <-bc.interrupts:
+		bc.ui.Error(fmt.Sprintf("Abandoning the cleanup of the cancelled builds after receiving %s.", sig))
+	}
+	return false
+}
+
+// Succeeded returns the names of the builds that returned without an error in
+// errs.
+func (bc *buildCancellation) Succeeded(builds []packersdk.Build, errs map[string]error) map[string]bool {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+	succeeded := map[string]bool{}
+	for _, b := range builds {
+		name := b.Name()
+		if _, failed := errs[name]; failed || !bc.started[name] || bc.running[name] {
+			continue
+		}
+		succeeded[name] = true
+	}
+	return succeeded
+}
+
+// SkipNotStarted records the builds that were never started as skipped in
+// errs, once the run exceeded its maximum duration, and returns their names in
+// the order of builds. The builds that failed on their own before the
+// maximum duration was exceeded keep their error.
+func (bc *buildCancellation) SkipNotStarted(builds []packersdk.Build, errs map[string]error, maxDuration time.Duration) []string {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+	var skipped []string
+	for _, b := range builds {
+		name := b.Name()
+		if bc.started[name] {
+			continue
+		}
+		if err, failed := errs[name]; failed && !errors.Is(err, context.DeadlineExceeded) {
+			continue
+		}
+		errs[name] = &packer.FailureError{
+			Class: packer.FailureTimedOut,
+			Err:   fmt.Errorf("skipped, the run exceeded its maximum duration of %s", maxDuration),
+		}
+		skipped = append(skipped, name)
+	}
+	return skipped
+}
+
+// warnBudgetExceeded tells when ctx, the context of a run with a maximum
+// duration, exceeded it.
+func warnBudgetExceeded(ctx context.Context, ui packersdk.Ui, maxDuration time.Duration) {
+	<-ctx.Done()
+	if ctx.Err() == context.DeadlineExceeded {
+		ui.Error(fmt.Sprintf("The run exceeded its maximum duration of %s: no more builds are started, and the running builds are cancelled.", maxDuration))
+	}
+}
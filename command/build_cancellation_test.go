@@ -1,12 +1,18 @@
 package command
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 func TestBuildCommand_RunContext_CtxCancel(t *testing.T) {
@@ -50,6 +56,7 @@ func TestBuildCommand_RunContext_CtxCancel(t *testing.T) {
 	}
 
 	for _, tt := range tests {
+		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			b := NewParallelTestBuilder(tt.parallelPassingTests)
@@ -86,3 +93,198 @@ func TestBuildCommand_RunContext_CtxCancel(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildCommand_RunContext_CancelGracePeriod(t *testing.T) {
+	locked := &LockedBuilder{unlock: make(chan interface{}), started: make(chan struct{}, 1)}
+	interrupts := make(chan os.Signal, 1)
+	c := &BuildCommand{
+		Meta:       testMetaParallel(t, NewParallelTestBuilder(0), locked),
+		interrupts: interrupts,
+	}
+
+	cfg, ret := c.ParseArgs([]string{"-cancel-grace-period=1h", filepath.Join(testFixture("parallel"), "1lock.json")})
+	if ret != 0 {
+		t.Fatal("ParseArgs failed.")
+	}
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	codeC := make(chan int)
+	go func() {
+		codeC <- c.RunContext(ctx, cfg)
+	}()
+	<-locked.started
+	cancelCtx()
+
+	select {
+	case code := <-codeC:
+		t.Fatalf("expected the build to keep running during the grace period, got code %d", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	interrupts <- os.Interrupt
+	select {
+	case code := <-codeC:
+		if code != 1 {
+			t.Errorf("expected the cancelled build to exit with code 1, got %d", code)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("expected a second interrupt to cancel the build")
+	}
+}
+
+func TestBuildCommand_RunContext_Terminated(t *testing.T) {
+	locked := &LockedBuilder{unlock: make(chan interface{}), started: make(chan struct{}, 1)}
+	terminated := make(chan struct{})
+	c := &BuildCommand{
+		Meta:       testMetaParallel(t, NewParallelTestBuilder(0), locked),
+		interrupts: make(chan os.Signal, 1),
+		terminated: terminated,
+	}
+
+	cfg, ret := c.ParseArgs([]string{"-cancel-grace-period=1h", "-detailed-exitcodes", filepath.Join(testFixture("parallel"), "1lock.json")})
+	if ret != 0 {
+		t.Fatal("ParseArgs failed.")
+	}
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	codeC := make(chan int)
+	go func() {
+		codeC <- c.RunContext(ctx, cfg)
+	}()
+	<-locked.started
+	close(terminated)
+	cancelCtx()
+
+	select {
+	case code := <-codeC:
+		if code != 130 {
+			t.Errorf("expected the terminated build to exit with code 130, got %d", code)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("expected a SIGTERM to cancel the build without waiting for the grace period")
+	}
+}
+
+// exceededContext is the context of a run whose maximum duration is exceeded
+// once exceeded is closed.
+type exceededContext struct {
+	context.Context
+	exceeded chan struct{}
+}
+
+func (c *exceededContext) Done() <-chan struct{} { return c.exceeded }
+
+func (c *exceededContext) Err() error {
+	select {
+	case <-c.exceeded:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+func TestBuildCommand_RunContext_MaxDuration(t *testing.T) {
+	locked := &LockedBuilder{unlock: make(chan interface{}), started: make(chan struct{}, 2)}
+	budget := &exceededContext{exceeded: make(chan struct{})}
+	c := &BuildCommand{
+		Meta: testMetaParallel(t, NewParallelTestBuilder(0), locked),
+		// The maximum duration is exceeded once the first build started.
+		budgetContext: func(ctx context.Context, _ time.Duration) (context.Context, context.CancelFunc) {
+			budget.Context = ctx
+			return budget, func() {}
+		},
+	}
+
+	cfg, ret := c.ParseArgs([]string{"-max-duration=1h", "-parallel-builds=1", "-detailed-exitcodes",
+		filepath.Join(testFixture("parallel"), "2lock.json")})
+	if ret != 0 {
+		t.Fatal("ParseArgs failed.")
+	}
+	codeC := make(chan int)
+	go func() {
+		codeC <- c.RunContext(context.Background(), cfg)
+	}()
+	<-locked.started
+	close(budget.exceeded)
+
+	select {
+	case code := <-codeC:
+		if code != 124 {
+			t.Errorf("expected the run exceeding its maximum duration to exit with code 124, got %d", code)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("expected the run to be cancelled once it exceeded its maximum duration")
+	}
+	out, _ := outputCommand(t, c.Meta)
+	if !strings.Contains(out, "builds not started yet were skipped: build1.") {
+		t.Errorf("expected build1 to be reported as skipped, got:\n%s", out)
+	}
+}
+
+func TestBuildCancellation_Wait(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		interrupt  bool
+		done       bool
+		cleanedUp  bool
+		expectedUi string
+	}{
+		{"builds done", 0, false, true, true, ""},
+		{"cleanup timeout", 10 * time.Millisecond, false, false, false, "did not clean up within 10ms"},
+		{"interrupted cleanup", 0, true, false, false, "Abandoning the cleanup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errBuf bytes.Buffer
+			interrupts := make(chan os.Signal, 1)
+			bc := &buildCancellation{
+				ui:             &packersdk.BasicUi{Writer: io.Discard, ErrorWriter: &errBuf},
+				CleanupTimeout: tt.timeout,
+				interrupts:     interrupts,
+			}
+			runCtx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			if tt.done {
+				wg.Done()
+			} else {
+				defer wg.Done()
+			}
+			if tt.interrupt {
+				interrupts <- os.Interrupt
+			}
+
+			if cleanedUp := bc.Wait(runCtx, &wg); cleanedUp != tt.cleanedUp {
+				t.Errorf("expected Wait to return %t, got %t", tt.cleanedUp, cleanedUp)
+			}
+			if !strings.Contains(errBuf.String(), tt.expectedUi) {
+				t.Errorf("expected %q in the output, got %q", tt.expectedUi, errBuf.String())
+			}
+		})
+	}
+}
+
+func TestBuildCancellation_Wait_terminated(t *testing.T) {
+	var errBuf bytes.Buffer
+	terminated := make(chan struct{})
+	close(terminated)
+	bc := &buildCancellation{
+		ui:              &packersdk.BasicUi{Writer: io.Discard, ErrorWriter: &errBuf},
+		CleanupTimeout:  time.Hour,
+		TermGracePeriod: 10 * time.Millisecond,
+		terminated:      terminated,
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	defer wg.Done()
+	if bc.Wait(runCtx, &wg) {
+		t.Fatal("expected Wait to stop waiting once the term grace period elapsed")
+	}
+	if !strings.Contains(errBuf.String(), "did not clean up within 10ms") {
+		t.Errorf("expected the term grace period to be reported, got %q", errBuf.String())
+	}
+}
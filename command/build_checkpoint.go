@@ -0,0 +1,43 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// openCheckpoints opens the checkpoint file of the run: path, or
+// packer.checkpoint.json next to the template.
+func openCheckpoints(path, template string) (*packer.CheckpointFile, bool, error) {
+	if path == "" {
+		path = filepath.Join(templateDir(template), packer.DefaultCheckpointFilename)
+	}
+	_, err := os.Stat(path)
+	exists := err == nil
+	f, err := packer.OpenCheckpointFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return f, exists, nil
+}
+
+// resumedBuilds returns the builds that did not complete in the run recorded
+// in checkpoints, in order, see keepReferencedBuilds.
+func resumedBuilds(builds []packersdk.Build, checkpoints *packer.CheckpointFile) []packersdk.Build {
+	run := make([]bool, len(builds))
+	for i, b := range builds {
+		run[i] = !checkpoints.Completed(b.Name())
+	}
+	return keepReferencedBuilds(builds, run)
+}
+
+// validateResume checks that the resume flags can be used together.
+func validateResume(cla *BuildArgs) error {
+	if cla.Resume == packer.ResumeContinue && cla.Incremental {
+		return fmt.Errorf("-resume=continue cannot be used with -incremental or -from-stage, the builds continue from their checkpoint")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestBuildCommand_ResumeContinue(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	// The previous run crashed once the chocolate build completed.
+	checkpoints, err := packer.OpenCheckpointFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, status := range map[string]string{
+		"file.chocolate": packer.CheckpointDone,
+		"file.vanilla":   packer.CheckpointRunning,
+	} {
+		status := status
+		if err := checkpoints.Update(name, func(c *packer.BuildCheckpoint) { c.Status = status }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"-checkpoint=" + path, "-resume=continue", template}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if fileExists("chocolate.txt") {
+		t.Error("Expected the completed build NOT to run again")
+	}
+	if !fileExists("vanilla.txt") {
+		t.Error("Expected the interrupted build to run again")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint file to be removed once all the builds completed, got %v", err)
+	}
+}
+
+func TestBuildCommand_ResumeContinueIncremental(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	if code := c.Run([]string{"-resume=continue", "-incremental", template}); code != 1 {
+		t.Errorf("Expected -resume=continue and -incremental to conflict, got code %d", code)
+	}
+}
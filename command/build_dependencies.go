@@ -0,0 +1,142 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// buildDependencies holds back the builds depending on other build blocks, see
+// packer.CoreBuild.DependsOn, until all the builds of these blocks succeeded.
+type buildDependencies struct {
+	lock sync.Mutex
+	// blocks tracks the builds of each build block, by name.
+	blocks map[string]*buildBlockStatus
+}
+
+type buildBlockStatus struct {
+	// pending is the number of builds of the block still running or waiting
+	// to run.
+	pending int
+	failed  bool
+	// artifacts are the artifacts of the builds of the block, by build type.
+	artifacts map[string][]packersdk.Artifact
+	// done is closed once all the builds of the block completed.
+	done chan struct{}
+}
+
+func newBuildDependencies(builds []packersdk.Build) *buildDependencies {
+	d := &buildDependencies{blocks: map[string]*buildBlockStatus{}}
+	for _, b := range builds {
+		name := buildBlockName(b)
+		if name == "" {
+			continue
+		}
+		status, ok := d.blocks[name]
+		if !ok {
+			status = &buildBlockStatus{
+				artifacts: map[string][]packersdk.Artifact{},
+				done:      make(chan struct{}),
+			}
+			d.blocks[name] = status
+		}
+		status.pending++
+	}
+	return d
+}
+
+func buildBlockName(b packersdk.Build) string {
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		return cb.BuildName
+	}
+	return ""
+}
+
+func dependsOn(b packersdk.Build) []string {
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		return cb.DependsOn
+	}
+	return nil
+}
+
+// Wait waits for the builds of the blocks b depends on to complete, and
+// returns an error if any of them failed. The blocks with no build in this
+// run, for example because of -only, are assumed to be built already. Once
+// they all succeeded, their artifacts are passed to b, see
+// packer.CoreBuild.ResolveDependencies.
+func (d *buildDependencies) Wait(ctx context.Context, b packersdk.Build, ui packersdk.Ui) error {
+	var waiting []string
+	for _, name := range dependsOn(b) {
+		status, ok := d.blocks[name]
+		if !ok {
+			log.Printf("[INFO] %s depends on the build %q, which is not part of this run", b.Name(), name)
+			continue
+		}
+		select {
+		case <-status.done:
+		default:
+			waiting = append(waiting, name)
+		}
+	}
+	if len(waiting) > 0 {
+		ui.Say(fmt.Sprintf("Build '%s' is waiting for the builds it depends on: %s", b.Name(), strings.Join(waiting, ", ")))
+	}
+
+	for _, name := range dependsOn(b) {
+		status, ok := d.blocks[name]
+		if !ok {
+			continue
+		}
+		select {
+		case <-status.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		d.lock.Lock()
+		failed := status.failed
+		d.lock.Unlock()
+		if failed {
+			return fmt.Errorf("the build %q it depends on did not complete successfully", name)
+		}
+	}
+
+	cb, ok := b.(*packer.CoreBuild)
+	if !ok || cb.ResolveDependencies == nil {
+		return nil
+	}
+	artifacts := map[string]map[string][]packersdk.Artifact{}
+	for _, name := range dependsOn(b) {
+		if status, ok := d.blocks[name]; ok {
+			artifacts[name] = status.artifacts
+		}
+	}
+	if err := cb.ResolveDependencies(artifacts); err != nil {
+		return fmt.Errorf("failed to configure the build with the artifacts of the builds it depends on: %s", err)
+	}
+	return nil
+}
+
+// Done records that b completed with artifacts, successfully when err is nil.
+func (d *buildDependencies) Done(b packersdk.Build, artifacts []packersdk.Artifact, err error) {
+	status, ok := d.blocks[buildBlockName(b)]
+	if !ok {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err != nil {
+		status.failed = true
+	} else {
+		status.artifacts[b.(*packer.CoreBuild).Type] = artifacts
+	}
+	status.pending--
+	if status.pending == 0 {
+		close(status.done)
+	}
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestBuildDependencies_artifacts(t *testing.T) {
+	baseA := &packer.CoreBuild{BuildName: "base", Type: "null.a"}
+	baseB := &packer.CoreBuild{BuildName: "base", Type: "null.b"}
+	var resolved map[string]map[string][]packersdk.Artifact
+	app := &packer.CoreBuild{
+		BuildName: "app",
+		Type:      "null.app",
+		DependsOn: []string{"base", "filtered"},
+		ResolveDependencies: func(artifacts map[string]map[string][]packersdk.Artifact) error {
+			resolved = artifacts
+			return nil
+		},
+	}
+	dependencies := newBuildDependencies([]packersdk.Build{baseA, baseB, app})
+
+	artifactA := &packersdk.MockArtifact{IdValue: "a"}
+	artifactB := &packersdk.MockArtifact{IdValue: "b"}
+	dependencies.Done(baseA, []packersdk.Artifact{artifactA}, nil)
+	dependencies.Done(baseB, []packersdk.Artifact{artifactB}, nil)
+
+	if err := dependencies.Wait(context.Background(), app, packersdk.TestUi(t)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]map[string][]packersdk.Artifact{
+		"base": {
+			"null.a": {artifactA},
+			"null.b": {artifactB},
+		},
+	}
+	if diff := cmp.Diff(expected, resolved); diff != "" {
+		t.Errorf("unexpected artifacts: %s", diff)
+	}
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"strconv"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// fail records class as the failure of the run, unless a failure was already
+// recorded: the first failure is the one reported.
+func (c *BuildCommand) fail(class packer.FailureClass) {
+	if c.failure == "" {
+		c.failure = class
+	}
+}
+
+// configFailure returns the class of the failure to load or initialize the
+// config of handler: a variable failure when the variables are invalid, a
+// template failure otherwise.
+func configFailure(handler packer.Handler) packer.FailureClass {
+	if handler != nil && handler.InvalidVariables() {
+		return packer.FailureVariable
+	}
+	return packer.FailureTemplate
+}
+
+// buildsFailure returns the class of the failure of the first failed build,
+// in the order of builds.
+func buildsFailure(builds []packersdk.Build, errs map[string]error) packer.FailureClass {
+	for _, b := range builds {
+		if err, failed := errs[b.Name()]; failed {
+			return packer.ClassifyFailure(err)
+		}
+	}
+	for _, err := range errs {
+		return packer.ClassifyFailure(err)
+	}
+	return packer.FailureOther
+}
+
+// reportFailure reports the class of the failure of a failed run as a
+// machine-readable message and returns the exit code of the run: the one of
+// the class with -detailed-exitcodes, ret otherwise.
+func (c *BuildCommand) reportFailure(cla *BuildArgs, ret int) int {
+	if ret == 0 {
+		return ret
+	}
+	class := c.failure
+	if class == "" {
+		class = packer.FailureOther
+	}
+	c.Ui.Machine("failure", string(class), strconv.Itoa(class.ExitCode()))
+	if cla.DetailedExitCodes {
+		return class.ExitCode()
+	}
+	return ret
+}
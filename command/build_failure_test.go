@@ -0,0 +1,121 @@
+package command
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestBuildCommand_detailedExitCodes(t *testing.T) {
+	tc := []struct {
+		name     string
+		template string
+		args     []string
+		// restricted restricts the components running local commands.
+		restricted bool
+		class      packer.FailureClass
+		code       int
+	}{
+		{
+			name:     "template",
+			template: `source "null" "test" {`,
+			class:    packer.FailureTemplate,
+			code:     3,
+		},
+		{
+			name: "variable",
+			template: `
+variable "name" {
+  type = string
+}
+source "null" "test" {
+  communicator = "none"
+}
+build {
+  sources = ["source.null.test"]
+}`,
+			class: packer.FailureVariable,
+			code:  4,
+		},
+		{
+			name: "provisioner",
+			template: `
+source "null" "test" {
+  communicator = "none"
+}
+build {
+  sources = ["source.null.test"]
+  provisioner "shell-local" {
+    inline = ["exit 1"]
+  }
+}`,
+			class: packer.FailureProvisioner,
+			code:  7,
+		},
+		{
+			name: "post-processor",
+			template: `
+source "null" "test" {
+  communicator = "none"
+}
+build {
+  sources = ["source.null.test"]
+  post-processor "shell-local" {
+    inline = ["exit 1"]
+  }
+}`,
+			class: packer.FailurePostProcessor,
+			code:  8,
+		},
+		{
+			name: "local commands in restricted mode",
+			template: `
+source "null" "test" {
+  communicator = "none"
+}
+build {
+  sources = ["source.null.test"]
+  post-processor "shell-local" {
+    inline = ["exit 0"]
+  }
+}`,
+			restricted: true,
+			class:      packer.FailureTemplate,
+			code:       3,
+		},
+		{
+			name: "no detailed exit codes",
+			template: `
+variable "name" {
+  type = string
+}`,
+			args:  []string{"-detailed-exitcodes=false"},
+			class: packer.FailureVariable,
+			code:  1,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			template := filepath.Join(t.TempDir(), "template.pkr.hcl")
+			if err := ioutil.WriteFile(template, []byte(tt.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &BuildCommand{Meta: TestMetaFile(t)}
+			if tt.restricted {
+				c.CoreConfig.LocalExec = &packer.LocalExecPolicy{Restricted: true}
+			}
+			args := append([]string{"-detailed-exitcodes"}, tt.args...)
+			if code := c.Run(append(args, template)); code != tt.code {
+				out, stderr := outputCommand(t, c.Meta)
+				t.Fatalf("expected exit code %d, got %d:\n%s\n%s", tt.code, code, out, stderr)
+			}
+			if c.failure != tt.class {
+				t.Errorf("expected a %s failure, got %s", tt.class, c.failure)
+			}
+		})
+	}
+}
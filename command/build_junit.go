@@ -0,0 +1,149 @@
+package command
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// junitTestSuites is the JUnit XML report of a run, written with
+// -junit-output: the builds of the template are the test cases of a single
+// test suite.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     junitSeconds     `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      junitSeconds    `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      junitSeconds  `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	// Type is the failure class of the error, see packer.ClassifyFailure.
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitSeconds is a duration in seconds, the unit of the JUnit reports.
+type junitSeconds time.Duration
+
+func (s junitSeconds) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: strconv.FormatFloat(time.Duration(s).Seconds(), 'f', 3, 64)}, nil
+}
+
+func (s *junitSeconds) UnmarshalXMLAttr(attr xml.Attr) error {
+	secs, err := strconv.ParseFloat(attr.Value, 64)
+	if err != nil {
+		return err
+	}
+	*s = junitSeconds(secs * float64(time.Second))
+	return nil
+}
+
+// buildOutcome is what a build of the run did, as reported by -junit-output.
+type buildOutcome struct {
+	// Started tells whether the build ran, Duration is how long it ran for.
+	Started  bool
+	Duration time.Duration
+	Err      error
+	// Steps are the timings of the steps of the build, when they are
+	// reported as test cases of their own.
+	Steps []packer.StepTiming
+}
+
+// newJUnitReport returns the JUnit report of the builds of template, run from
+// start to end.
+func newJUnitReport(template string, builds []packersdk.Build, outcomes map[string]buildOutcome, start, end time.Time) *junitTestSuites {
+	suite := junitTestSuite{
+		Name:      template,
+		Time:      junitSeconds(end.Sub(start)),
+		Timestamp: start.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, b := range builds {
+		o := outcomes[b.Name()]
+		tc := junitTestCase{Name: b.Name(), ClassName: "packer.build", Time: junitSeconds(o.Duration)}
+		switch {
+		case !o.Started:
+			tc.Skipped = &junitSkipped{Message: "not started"}
+			if o.Err != nil {
+				tc.Skipped.Message = packer.Secrets.Redact(fmt.Sprintf("not started: %s", o.Err))
+			}
+		case o.Err != nil:
+			tc.Failure = newJUnitFailure(o.Err)
+		}
+		suite.Cases = append(suite.Cases, tc)
+
+		for _, step := range o.Steps {
+			if step.Kind != packer.TimingProvisioner {
+				continue
+			}
+			stc := junitTestCase{Name: "provisioner " + step.Name, ClassName: b.Name(), Time: junitSeconds(step.Duration)}
+			if step.Err != nil {
+				stc.Failure = newJUnitFailure(step.Err)
+			}
+			suite.Cases = append(suite.Cases, stc)
+		}
+	}
+	for _, tc := range suite.Cases {
+		suite.Tests++
+		switch {
+		case tc.Failure != nil:
+			suite.Failures++
+		case tc.Skipped != nil:
+			suite.Skipped++
+		}
+	}
+	return &junitTestSuites{
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+}
+
+func newJUnitFailure(err error) *junitFailure {
+	msg := packer.Secrets.Redact(err.Error())
+	return &junitFailure{
+		Message: msg,
+		Type:    string(packer.ClassifyFailure(err)),
+		Text:    msg,
+	}
+}
+
+// writeJUnitReport writes report to path.
+func writeJUnitReport(path string, report *junitTestSuites) error {
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(b, '\n')...), 0644)
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestBuildCommand_JUnitOutput(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	report := filepath.Join(t.TempDir(), "report.xml")
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	if code := c.Run([]string{"-junit-output=" + report, template}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	b, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to parse the report: %s\n%s", err, b)
+	}
+	if got.Tests != 2 || got.Failures != 0 || len(got.Suites) != 1 {
+		t.Fatalf("expected 2 passing test cases, got %s", b)
+	}
+	for _, tc := range got.Suites[0].Cases {
+		if tc.ClassName != "packer.build" || tc.Failure != nil || tc.Skipped != nil {
+			t.Errorf("expected build %s to pass, got %#v", tc.Name, tc)
+		}
+	}
+}
+
+func TestNewJUnitReport(t *testing.T) {
+	builds := []packersdk.Build{
+		&packer.CoreBuild{BuildName: "ubuntu", Type: "docker.focal"},
+		&packer.CoreBuild{BuildName: "ubuntu", Type: "docker.jammy"},
+		&packer.CoreBuild{BuildName: "ubuntu", Type: "docker.noble"},
+	}
+	failure := errors.New("script exited with 2")
+	outcomes := map[string]buildOutcome{
+		"ubuntu.docker.focal": {Started: true, Duration: 90 * time.Second, Steps: []packer.StepTiming{
+			{Kind: packer.TimingBuilder, Name: "docker", Duration: time.Minute},
+			{Kind: packer.TimingProvisioner, Name: "shell", Duration: 30 * time.Second},
+		}},
+		"ubuntu.docker.jammy": {Started: true, Duration: time.Minute, Err: failure, Steps: []packer.StepTiming{
+			{Kind: packer.TimingProvisioner, Name: "shell", Duration: 10 * time.Second, Err: failure},
+		}},
+	}
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	report := newJUnitReport("ubuntu.pkr.hcl", builds, outcomes, start, start.Add(2*time.Minute))
+	if report.Tests != 5 || report.Failures != 2 || report.Skipped != 1 {
+		t.Fatalf("expected 5 test cases, 2 failures and 1 skipped, got %d, %d and %d", report.Tests, report.Failures, report.Skipped)
+	}
+	cases := report.Suites[0].Cases
+	if cases[1].Name != "provisioner shell" || cases[1].ClassName != "ubuntu.docker.focal" || cases[1].Failure != nil {
+		t.Errorf("expected the provisioner of the first build to pass, got %#v", cases[1])
+	}
+	if cases[2].Failure == nil || cases[2].Failure.Message != failure.Error() {
+		t.Errorf("expected the second build to fail, got %#v", cases[2])
+	}
+	if cases[4].Name != "ubuntu.docker.noble" || cases[4].Skipped == nil {
+		t.Errorf("expected the build not started to be skipped, got %#v", cases[4])
+	}
+
+	out, err := xml.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `<testcase name="ubuntu.docker.focal" classname="packer.build" time="90.000">`) {
+		t.Errorf("expected the durations to be written in seconds, got %s", out)
+	}
+}
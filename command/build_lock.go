@@ -0,0 +1,60 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+	"github.com/hashicorp/packer-plugin-sdk/pathing"
+)
+
+// buildLocksDir is the directory of the packer config directory holding the
+// lock files of the templates being built.
+const buildLocksDir = "build-locks"
+
+// buildLockPath returns the lock file of the template at path, keyed on the
+// absolute path of the template so that the templates of a directory are
+// locked separately.
+func buildLockPath(template string) (string, error) {
+	abs, err := filepath.Abs(template)
+	if err != nil {
+		return "", err
+	}
+	dir, err := pathing.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, buildLocksDir, hex.EncodeToString(sum[:])+".lock"), nil
+}
+
+// lockBuild locks the template while it is built, so that two concurrent
+// builds of the same template fail fast rather than racing to create
+// conflicting artifacts and registry entries. The lock is advisory, and
+// released by unlock or when the process exits. The lock file is never
+// removed: removing it would let a run lock a new file while another one
+// still holds the lock of the removed one.
+func lockBuild(template string) (unlock func(), err error) {
+	path, err := buildLockPath(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the lock file of %s: %s", template, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the build lock directory: %s", err)
+	}
+	lock := flock.New(path)
+	locked, err := lock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %s", path, err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("%s is already being built by another Packer run, locked in %s. "+
+			"Wait for it to complete, or build it without -build-lock", template, path)
+	}
+	return func() {
+		_ = lock.Unlock()
+	}, nil
+}
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLockBuild(t *testing.T) {
+	t.Setenv("PACKER_CONFIG_DIR", t.TempDir())
+	dir := t.TempDir()
+	template := filepath.Join(dir, "template.pkr.hcl")
+	other := filepath.Join(dir, "other.pkr.hcl")
+	for _, path := range []string{template, other} {
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unlock, err := lockBuild(template)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := lockBuild(template); err == nil || !strings.Contains(err.Error(), "already being built") {
+		t.Fatalf("expected the template to be locked, got %v", err)
+	}
+	// The other templates of the directory are not locked.
+	unlockOther, err := lockBuild(other)
+	if err != nil {
+		t.Fatalf("expected the other template not to be locked, got %s", err)
+	}
+	unlockOther()
+
+	unlock()
+	// The lock file is kept, for all the runs to lock the same file.
+	path, err := buildLockPath(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the lock file to be kept, got %v", err)
+	}
+	unlock, err = lockBuild(template)
+	if err != nil {
+		t.Fatalf("expected the template to be unlocked, got %s", err)
+	}
+	unlock()
+}
+
+func TestBuildCommand_locked(t *testing.T) {
+	t.Setenv("PACKER_CONFIG_DIR", t.TempDir())
+	dir := t.TempDir()
+	template := filepath.Join(dir, "template.pkr.hcl")
+	if err := ioutil.WriteFile(template, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockBuild(template)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer unlock()
+
+	c := &BuildCommand{Meta: testMeta(t)}
+	if code := c.Run([]string{"-build-lock", template}); code != 1 {
+		t.Fatalf("expected the build of the locked template to fail, got %d", code)
+	}
+	if _, stderr := outputCommand(t, c.Meta); !strings.Contains(stderr, "already being built") {
+		t.Errorf("expected the lock to be reported, got %q", stderr)
+	}
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"os"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/notify"
+)
+
+// notificationPayload describes the outcome of the builds of template, run
+// from start to end, to the notification targets.
+func notificationPayload(template string, builds []packersdk.Build, artifacts map[string][]packersdk.Artifact,
+	errs map[string]error, start, end time.Time) notify.Payload {
+	p := notify.Payload{
+		Outcome:     notify.OnSuccess,
+		Template:    template,
+		RunUUID:     os.Getenv("PACKER_RUN_UUID"),
+		StartedAt:   start.UTC(),
+		CompletedAt: end.UTC(),
+		Builds:      []notify.BuildResult{},
+	}
+	for _, b := range builds {
+		res := notify.BuildResult{Name: b.Name(), Artifacts: []notify.Artifact{}}
+		if err, failed := errs[b.Name()]; failed {
+			res.Error = err.Error()
+			p.Outcome = notify.OnFailure
+		}
+		for _, a := range artifacts[b.Name()] {
+			if a == nil {
+				continue
+			}
+			res.Artifacts = append(res.Artifacts, notify.Artifact{BuilderID: a.BuilderId(), ID: a.Id(), Description: a.String()})
+		}
+		p.Builds = append(p.Builds, res)
+	}
+	return p
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer/internal/notify"
+)
+
+func TestBuildCommand_Notifications(t *testing.T) {
+	var payloads []notify.Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p notify.Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("failed to decode the payload: %s", err)
+		}
+		payloads = append(payloads, p)
+	}))
+	defer srv.Close()
+
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	c.CoreConfig.Notifications = []*notify.Target{
+		{Type: notify.TypeWebhook, URL: srv.URL},
+		{Type: notify.TypeWebhook, URL: srv.URL, On: []string{notify.OnFailure}},
+	}
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	if code := c.Run([]string{template}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("expected the success to be notified once, got %d notification(s)", len(payloads))
+	}
+	p := payloads[0]
+	if p.Outcome != notify.OnSuccess || len(p.Builds) != 2 || !filepath.IsAbs(p.Template) {
+		t.Errorf("unexpected payload %#v", p)
+	}
+	for _, b := range p.Builds {
+		if b.Error != "" || len(b.Artifacts) != 1 {
+			t.Errorf("expected build %s to succeed with an artifact, got %#v", b.Name, b)
+		}
+	}
+}
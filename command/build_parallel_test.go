@@ -5,9 +5,12 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/hcl/v2/hcldec"
 
 	"golang.org/x/sync/errgroup"
@@ -44,7 +47,11 @@ func (b *ParallelTestBuilder) Run(ctx context.Context, ui packersdk.Ui, hook pac
 }
 
 // LockedBuilder wont run until unlock is called
-type LockedBuilder struct{ unlock chan interface{} }
+type LockedBuilder struct {
+	unlock chan interface{}
+	// started, when set, receives a value each time a build starts.
+	started chan struct{}
+}
 
 func (b *LockedBuilder) ConfigSpec() hcldec.ObjectSpec { return nil }
 
@@ -54,6 +61,9 @@ func (b *LockedBuilder) Prepare(raws ...interface{}) ([]string, []string, error)
 
 func (b *LockedBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
 	ui.Say("locking build")
+	if b.started != nil {
+		b.started <- struct{}{}
+	}
 	select {
 	case <-b.unlock:
 	case <-ctx.Done():
@@ -173,3 +183,305 @@ func TestBuildParallel_Timeout(t *testing.T) {
 	close(locked.unlock) // unlock locking one
 	wg.Wait()            // wait for termination
 }
+
+// SerialTestBuilder records the highest number of builds it ran concurrently.
+type SerialTestBuilder struct {
+	l            sync.Mutex
+	running, max int
+}
+
+func (b *SerialTestBuilder) ConfigSpec() hcldec.ObjectSpec { return nil }
+
+func (b *SerialTestBuilder) Prepare(raws ...interface{}) ([]string, []string, error) {
+	return nil, nil, nil
+}
+
+func (b *SerialTestBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	b.l.Lock()
+	b.running++
+	if b.running > b.max {
+		b.max = b.running
+	}
+	b.l.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	b.l.Lock()
+	b.running--
+	b.l.Unlock()
+	return nil, nil
+}
+
+func TestBuildParallel_serialGroup(t *testing.T) {
+	// testfile has 3 builds in the host-1 serial group and one in the host-2
+	// serial group, all sharing the same builder.
+	var out, errOut bytes.Buffer
+	builder := &SerialTestBuilder{}
+
+	c := &BuildCommand{
+		Meta: Meta{
+			CoreConfig: &packer.CoreConfig{
+				Components: packer.ComponentFinder{
+					PluginConfig: &packer.PluginConfig{
+						Builders: packer.MapOfBuilder{
+							"serial": func() (packersdk.Builder, error) { return builder, nil },
+						},
+					},
+				},
+			},
+			Ui: &packersdk.BasicUi{
+				Writer:      &out,
+				ErrorWriter: &errOut,
+			},
+		},
+	}
+
+	args := []string{
+		"-parallel-builds=10",
+		filepath.Join(testFixture("parallel"), "serial-group.pkr.hcl"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	if builder.max > 2 {
+		t.Errorf("expected at most one build per serial group to run at once, got %d concurrent builds", builder.max)
+	}
+	if !strings.Contains(out.String(), `is waiting for the other builds of the serial group "host-1"`) {
+		t.Errorf("expected builds to wait for their serial group, got:\n%s", out.String())
+	}
+}
+
+func TestBuildParallel_perType(t *testing.T) {
+	// testfile has 3 builds of the builder types of the vsphere plugin and
+	// one docker build.
+	var out, errOut bytes.Buffer
+	vsphere := &SerialTestBuilder{}
+	docker := &SerialTestBuilder{}
+
+	c := &BuildCommand{
+		Meta: Meta{
+			CoreConfig: &packer.CoreConfig{
+				Components: packer.ComponentFinder{
+					PluginConfig: &packer.PluginConfig{
+						Builders: packer.MapOfBuilder{
+							"vsphere-iso":   func() (packersdk.Builder, error) { return vsphere, nil },
+							"vsphere-clone": func() (packersdk.Builder, error) { return vsphere, nil },
+							"docker":        func() (packersdk.Builder, error) { return docker, nil },
+						},
+					},
+				},
+			},
+			Ui: &packersdk.BasicUi{
+				Writer:      &out,
+				ErrorWriter: &errOut,
+			},
+		},
+	}
+
+	args := []string{
+		"-parallel-builds=10",
+		"-parallel-builds-per-type", "vsphere=1",
+		"-parallel-builds-per-type", "docker=0",
+		filepath.Join(testFixture("parallel"), "per-type.pkr.hcl"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	if vsphere.max != 1 {
+		t.Errorf("expected one vsphere build to run at once, got %d concurrent builds", vsphere.max)
+	}
+	if !strings.Contains(out.String(), "is waiting for other vsphere builds to finish") {
+		t.Errorf("expected builds to wait for the vsphere limit, got:\n%s", out.String())
+	}
+}
+
+func TestBuildTypeLimits(t *testing.T) {
+	if _, err := newBuildTypeLimits(map[string]string{"docker": "-1"}); err == nil {
+		t.Errorf("expected a negative limit to fail")
+	}
+
+	limits, err := newBuildTypeLimits(map[string]string{"vsphere": "2", "vsphere-iso": "1", "docker": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		build    packersdk.Build
+		expected string
+	}{
+		{&packer.CoreBuild{Type: "vsphere-iso.ubuntu"}, "vsphere-iso"},
+		{&packer.CoreBuild{Type: "vsphere-clone.ubuntu"}, "vsphere"},
+		{&packer.CoreBuild{Type: "ubuntu", BuilderType: "vsphere-clone"}, "vsphere"},
+		{&packer.CoreBuild{Type: "vspherefoo.ubuntu"}, ""},
+		{&packer.CoreBuild{Type: "docker.ubuntu"}, ""},
+	} {
+		if typ, _ := limits.limit(tc.build); typ != tc.expected {
+			t.Errorf("%s: expected the %q limit, got %q", tc.build.Name(), tc.expected, typ)
+		}
+	}
+}
+
+func TestSortBuildsByPriority(t *testing.T) {
+	builds := []packersdk.Build{
+		&packer.CoreBuild{Type: "null.a"},
+		&packer.CoreBuild{Type: "null.b", Priority: 5},
+		&packer.CoreBuild{Type: "null.c", BuildName: "base"},
+		&packer.CoreBuild{Type: "null.d", Priority: 10, DependsOn: []string{"base"}},
+		&packer.CoreBuild{Type: "null.e", Priority: 5},
+	}
+	var got []string
+	for _, b := range sortBuildsByPriority(builds) {
+		got = append(got, b.Name())
+	}
+	// c inherits the priority of d, which depends on it.
+	expected := []string{"base.null.c", "null.d", "null.b", "null.e", "null.a"}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected order: %s", diff)
+	}
+}
+
+func TestBuildQueue(t *testing.T) {
+	q := newBuildQueue(1)
+	if !q.TryAcquire() {
+		t.Fatalf("expected a free slot")
+	}
+	if q.TryAcquire() {
+		t.Fatalf("expected no free slot")
+	}
+
+	var l sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelled := make(chan error)
+	go func() { cancelled <- q.Acquire(ctx, 0) }()
+	for _, rank := range []int{3, 1, 2} {
+		rank := rank
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.Acquire(context.Background(), rank); err != nil {
+				t.Errorf("unexpected failure: %s", err)
+				return
+			}
+			l.Lock()
+			order = append(order, rank)
+			l.Unlock()
+			q.Release()
+		}()
+	}
+	// Wait for all the builds to be queued.
+	for {
+		q.l.Lock()
+		n := len(q.waiting)
+		q.l.Unlock()
+		if n == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-cancelled; err == nil {
+		t.Errorf("expected the cancelled build to fail to acquire a slot")
+	}
+
+	q.Release()
+	wg.Wait()
+	if diff := cmp.Diff([]int{1, 2, 3}, order); diff != "" {
+		t.Errorf("expected the builds to get a slot by rank: %s", diff)
+	}
+	if !q.TryAcquire() {
+		t.Errorf("expected the slot to be free once all builds are done")
+	}
+}
+
+// DependencyTestBuilder records when the builds of its type start and end.
+type DependencyTestBuilder struct {
+	name   string
+	fail   bool
+	events *dependencyEvents
+}
+
+type dependencyEvents struct {
+	l      sync.Mutex
+	events []string
+}
+
+func (e *dependencyEvents) add(event string) {
+	e.l.Lock()
+	defer e.l.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (b *DependencyTestBuilder) ConfigSpec() hcldec.ObjectSpec { return nil }
+
+func (b *DependencyTestBuilder) Prepare(raws ...interface{}) ([]string, []string, error) {
+	return nil, nil, nil
+}
+
+func (b *DependencyTestBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	b.events.add("start " + b.name)
+	time.Sleep(20 * time.Millisecond)
+	b.events.add("end " + b.name)
+	if b.fail {
+		return nil, fmt.Errorf("%s failed", b.name)
+	}
+	return nil, nil
+}
+
+func TestBuildParallel_dependsOn(t *testing.T) {
+	// testfile has an app build depending on the two builds of the base
+	// build block, declared after it. Running one build at a time makes sure
+	// waiting builds don't hold back the others.
+	for _, tc := range []struct {
+		name           string
+		failBase       bool
+		expectedEvents []string
+	}{
+		{"upstream succeeds", false, []string{"start base", "end base", "start base", "end base", "start app", "end app"}},
+		{"upstream fails", true, []string{"start base", "end base", "start base", "end base"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			events := &dependencyEvents{}
+			base := &DependencyTestBuilder{name: "base", fail: tc.failBase, events: events}
+			app := &DependencyTestBuilder{name: "app", events: events}
+
+			c := &BuildCommand{
+				Meta: Meta{
+					CoreConfig: &packer.CoreConfig{
+						Components: packer.ComponentFinder{
+							PluginConfig: &packer.PluginConfig{
+								Builders: packer.MapOfBuilder{
+									"base": func() (packersdk.Builder, error) { return base, nil },
+									"app":  func() (packersdk.Builder, error) { return app, nil },
+								},
+							},
+						},
+					},
+					Ui: &packersdk.BasicUi{
+						Writer:      &out,
+						ErrorWriter: &errOut,
+					},
+				},
+			}
+
+			args := []string{
+				"-parallel-builds=1",
+				filepath.Join(testFixture("parallel"), "depends-on.pkr.hcl"),
+			}
+			if code := c.Run(args); (code != 0) != tc.failBase {
+				fatalCommand(t, c.Meta)
+			}
+
+			if diff := cmp.Diff(tc.expectedEvents, events.events); diff != "" {
+				t.Errorf("unexpected build order: %s", diff)
+			}
+			if tc.failBase && !strings.Contains(errOut.String(), `the build "base" it depends on did not complete successfully`) {
+				t.Errorf("expected the app build not to start, got:\n%s", errOut.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package command
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// sortBuildsByPriority orders the builds by decreasing priority, keeping the
+// order of the template between builds of the same priority. A build inherits
+// the priority of the builds depending on it when it is higher than its own,
+// so that a critical build is not held back by the builds it waits for.
+func sortBuildsByPriority(builds []packersdk.Build) []packersdk.Build {
+	priorities := make(map[packersdk.Build]int, len(builds))
+	for _, b := range builds {
+		priorities[b] = buildPriority(b)
+	}
+	// Raise the priority of dependencies until it settles, the dependency
+	// graph being acyclic this takes at most one pass per build.
+	for range builds {
+		changed := false
+		for _, b := range builds {
+			for _, name := range dependsOn(b) {
+				for _, dep := range builds {
+					if buildBlockName(dep) == name && priorities[dep] < priorities[b] {
+						priorities[dep] = priorities[b]
+						changed = true
+					}
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	sorted := append([]packersdk.Build(nil), builds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return priorities[sorted[i]] > priorities[sorted[j]]
+	})
+	return sorted
+}
+
+func buildPriority(b packersdk.Build) int {
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		return cb.Priority
+	}
+	return 0
+}
+
+// buildQueue is a semaphore handing its slots out to the waiting builds by
+// their rank, their position in the sorted builds, rather than in the order
+// they happened to ask for one. This keeps the order the builds start in
+// independent of the scheduling of their goroutines.
+type buildQueue struct {
+	l       sync.Mutex
+	free    int64
+	waiting []*queuedBuild
+}
+
+type queuedBuild struct {
+	rank  int
+	ready chan struct{}
+}
+
+func newBuildQueue(n int64) *buildQueue {
+	return &buildQueue{free: n}
+}
+
+// TryAcquire takes a slot without waiting, it returns false if none is free.
+func (q *buildQueue) TryAcquire() bool {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	if q.free > 0 {
+		q.free--
+		return true
+	}
+	return false
+}
+
+// Acquire takes a slot, waiting for the builds of lower rank waiting for one
+// to get theirs first, or fails once ctx is done.
+func (q *buildQueue) Acquire(ctx context.Context, rank int) error {
+	q.l.Lock()
+	if q.free > 0 {
+		q.free--
+		q.l.Unlock()
+		return nil
+	}
+	w := &queuedBuild{rank: rank, ready: make(chan struct{})}
+	i := sort.Search(len(q.waiting), func(i int) bool { return q.waiting[i].rank > rank })
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = w
+	q.l.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.l.Lock()
+	defer q.l.Unlock()
+	select {
+	case <-w.ready:
+		// The slot was handed out meanwhile, pass it on.
+		q.release()
+	default:
+		for i := range q.waiting {
+			if q.waiting[i] == w {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// Release gives a slot back, to the first waiting build if any.
+func (q *buildQueue) Release() {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	q.release()
+}
+
+func (q *buildQueue) release() {
+	if len(q.waiting) == 0 {
+		q.free++
+		return
+	}
+	w := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	close(w.ready)
+}
@@ -0,0 +1,34 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/hashicorp/packer/packer"
+)
+
+// publishIteration promotes the complete iteration of bucket to the channels
+// of its publish rules. It returns false when a promotion failed; the
+// promotions pending approval or denied by their approval webhook do not fail
+// the run.
+func (c *BuildCommand) publishIteration(ctx context.Context, bucket *packerregistry.Bucket, approved bool) bool {
+	ok := true
+	for _, res := range bucket.PublishIteration(ctx, packerregistry.PublishOptions{Approved: approved}) {
+		c.Ui.Machine("hcp-publish", res.Channel, string(res.Status))
+		switch res.Status {
+		case packerregistry.PublishPromoted:
+			c.Ui.Say(fmt.Sprintf("--> Promoted iteration %s to the channel %q.", bucket.Iteration.ID, res.Channel))
+		case packerregistry.PublishPendingApproval:
+			c.Ui.Say(fmt.Sprintf("--> The promotion to the channel %q requires approval: build again with -approve-promotion, or run \"packer hcp promote %s %s %s\".",
+				res.Channel, bucket.Slug, bucket.Iteration.ID, res.Channel))
+		case packerregistry.PublishDenied:
+			c.Ui.Error(fmt.Sprintf("--> The promotion to the channel %q was not approved: %s", res.Channel, res.Err))
+		default:
+			c.Ui.Error(fmt.Sprintf("--> Failed to promote iteration %s to the channel %q: %s", bucket.Iteration.ID, res.Channel, res.Err))
+			c.fail(packer.FailureRegistry)
+			ok = false
+		}
+	}
+	return ok
+}
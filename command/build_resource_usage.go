@@ -0,0 +1,41 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/hashicorp/packer/packer"
+)
+
+// reportResourceUsage reports what the builds, and the whole run, used of the
+// machine, as sampled by monitor.
+func reportResourceUsage(ui packersdk.Ui, builds []packersdk.Build, monitor *packer.ResourceMonitor) {
+	ui.Say("\n==> Resource usage of the builds, by their plugins:")
+	for _, b := range builds {
+		usage, ok := monitor.Usage(b.Name())
+		if !ok {
+			continue
+		}
+		machineResourceUsage(&packer.TargetedUI{Target: b.Name(), Ui: ui}, usage)
+		ui.Say(fmt.Sprintf("--> %s: %s", b.Name(), formatResourceUsage(usage)))
+	}
+	total := monitor.Total()
+	machineResourceUsage(ui, total)
+	ui.Say(fmt.Sprintf("--> Total, with Packer itself: %s", formatResourceUsage(total)))
+}
+
+func machineResourceUsage(ui packersdk.Ui, usage packer.ResourceUsage) {
+	ui.Machine("resource-usage",
+		strconv.FormatFloat(usage.CPUTime.Seconds(), 'f', 3, 64),
+		strconv.FormatUint(usage.PeakMemory, 10),
+		strconv.FormatUint(usage.NetSent, 10),
+		strconv.FormatUint(usage.NetReceived, 10))
+}
+
+func formatResourceUsage(usage packer.ResourceUsage) string {
+	return fmt.Sprintf("%.1fs of CPU, %s of peak memory, %s sent and %s received over the network",
+		usage.CPUTime.Seconds(), cache.FormatSize(int64(usage.PeakMemory)),
+		cache.FormatSize(int64(usage.NetSent)), cache.FormatSize(int64(usage.NetReceived)))
+}
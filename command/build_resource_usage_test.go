@@ -0,0 +1,30 @@
+package command
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildCommand_ResourceUsage(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	if code := c.Run([]string{"-resource-usage", template}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	out, _ := outputCommand(t, c.Meta)
+	for _, want := range []string{
+		"==> Resource usage of the builds, by their plugins:",
+		"--> file.chocolate: ",
+		"--> file.vanilla: ",
+		"--> Total, with Packer itself: ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
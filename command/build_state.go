@@ -0,0 +1,156 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/buildstate"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/hashicorp/packer/packer"
+)
+
+// newStateBackend returns the backend storing the state of the last
+// successful builds of the template at path. By default, the state is stored
+// in a file next to the template; "hcp" reads it from the bucket of the HCP
+// Packer registry the template publishes to.
+func newStateBackend(location, path string, publisher *packerregistry.Bucket) (buildstate.Backend, error) {
+	switch location {
+	case "":
+		location = filepath.Join(templateDir(path), buildstate.DefaultFilename)
+	case "hcp":
+		if publisher == nil || publisher.Slug == "" {
+			return nil, fmt.Errorf("the template does not publish to the HCP Packer registry, its state can not be stored there")
+		}
+		location = "hcp://" + publisher.Slug
+	}
+	return buildstate.New(location)
+}
+
+// stateTemplate returns the name of the template at path in the build state.
+func stateTemplate(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// buildInputHash returns the input hash of b, empty when its inputs are not
+// hashed.
+func buildInputHash(b packersdk.Build) string {
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		return cb.InputHash()
+	}
+	return ""
+}
+
+// stateArtifacts returns the artifacts of a build as recorded in the state.
+func stateArtifacts(artifacts []packersdk.Artifact) []buildstate.Artifact {
+	var res []buildstate.Artifact
+	for _, a := range artifacts {
+		if a == nil {
+			continue
+		}
+		res = append(res, buildstate.Artifact{BuilderID: a.BuilderId(), ID: a.Id(), Description: a.String()})
+	}
+	return res
+}
+
+// historyArtifacts returns the artifacts of the build b of template, completed
+// at completedAt, as recorded in the artifact history.
+func historyArtifacts(template string, b packersdk.Build, artifacts []packersdk.Artifact, completedAt time.Time) []*recordedArtifact {
+	var builderType, fingerprint string
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		builderType = cb.BuilderType
+		if builderType == "" {
+			// The type of an HCL2 build is the source type followed by its
+			// name.
+			builderType = strings.SplitN(cb.Type, ".", 2)[0]
+		}
+		if cb.BuilderInputHash != "" {
+			fingerprint = cb.InputHash()
+		}
+	}
+	var res []*recordedArtifact
+	for _, a := range artifacts {
+		if a == nil {
+			continue
+		}
+		res = append(res, &recordedArtifact{
+			Build:       b.Name(),
+			BuilderID:   a.BuilderId(),
+			BuilderType: builderType,
+			ID:          a.Id(),
+			Description: a.String(),
+			Files:       a.Files(),
+			CompletedAt: completedAt.UTC(),
+			Source:      historySource,
+			Template:    template,
+			Fingerprint: fingerprint,
+			RunUUID:     os.Getenv("PACKER_RUN_UUID"),
+		})
+	}
+	return res
+}
+
+// reportCachedArtifacts reports the artifacts of the last successful build of
+// a build skipped as it did not change, the ones a new build would produce.
+func reportCachedArtifacts(ui packersdk.Ui, name string, b buildstate.Build) {
+	ui = &packer.TargetedUI{Target: name, Ui: ui}
+	ui.Machine("cached-artifact-count", strconv.Itoa(len(b.Artifacts)))
+	for i, a := range b.Artifacts {
+		iStr := strconv.Itoa(i)
+		ui.Machine("cached-artifact", iStr, "builder-id", a.BuilderID)
+		ui.Machine("cached-artifact", iStr, "id", a.ID)
+		ui.Machine("cached-artifact", iStr, "string", a.Description)
+		ui.Say(fmt.Sprintf("Artifact of the build completed at %s: %s", b.CompletedAt.Format(time.RFC3339), a.Description))
+	}
+}
+
+// changedBuilds returns the builds whose inputs changed since their last
+// successful build, along with the builds depending on them, in order, see
+// keepReferencedBuilds.
+func changedBuilds(builds []packersdk.Build, state *buildstate.State) []packersdk.Build {
+	run := make([]bool, len(builds))
+	rebuilt := map[string]bool{}
+	// Builds are ordered so that they come after the builds they depend on.
+	for i, b := range builds {
+		run[i] = state.Changed(b.Name(), buildInputHash(b))
+		for _, name := range dependsOn(b) {
+			run[i] = run[i] || rebuilt[name]
+		}
+		if run[i] {
+			rebuilt[buildBlockName(b)] = true
+		}
+	}
+
+	return keepReferencedBuilds(builds, run)
+}
+
+// keepReferencedBuilds returns the builds to run, in order, along with the
+// builds whose artifacts they reference, see
+// packer.CoreBuild.ResolveDependencies, as their artifacts are only known once
+// they ran.
+func keepReferencedBuilds(builds []packersdk.Build, run []bool) []packersdk.Build {
+	referenced := map[string]bool{}
+	for i := len(builds) - 1; i >= 0; i-- {
+		b := builds[i]
+		if !run[i] && referenced[buildBlockName(b)] {
+			run[i] = true
+		}
+		if cb, ok := b.(*packer.CoreBuild); ok && run[i] && cb.ResolveDependencies != nil {
+			for _, name := range cb.DependsOn {
+				referenced[name] = true
+			}
+		}
+	}
+
+	var res []packersdk.Build
+	for i, b := range builds {
+		if run[i] {
+			res = append(res, b)
+		}
+	}
+	return res
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/buildstate"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestBuildCommand_IfChanged(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	run := func(args ...string) {
+		t.Helper()
+		os.Remove("chocolate.txt")
+		os.Remove("vanilla.txt")
+		args = append([]string{"-if-changed", "-state=" + statePath}, args...)
+		if code := c.Run(append(args, template)); code != 0 {
+			fatalCommand(t, c.Meta)
+		}
+	}
+
+	// Nothing was built yet.
+	run()
+	for _, f := range []string{"chocolate.txt", "vanilla.txt"} {
+		if !fileExists(f) {
+			t.Errorf("Expected to find %s", f)
+		}
+	}
+
+	// Nothing changed since.
+	run()
+	for _, f := range []string{"chocolate.txt", "vanilla.txt"} {
+		if fileExists(f) {
+			t.Errorf("Expected NOT to find %s", f)
+		}
+	}
+	// The artifacts of the skipped builds are reported.
+	out, _ := outputCommand(t, c.Meta)
+	cached := regexp.MustCompile(`file.vanilla: Artifact of the build completed at .*: Stored file: vanilla.txt`)
+	if !cached.MatchString(out) {
+		t.Errorf("Expected the cached artifact of file.vanilla to be reported, got:\n%s", out)
+	}
+
+	// The chocolate build changed.
+	run("-var", "flavor=dark chocolate")
+	if !fileExists("chocolate.txt") {
+		t.Error("Expected to find chocolate.txt")
+	}
+	if fileExists("vanilla.txt") {
+		t.Error("Expected NOT to find vanilla.txt")
+	}
+}
+
+func TestChangedBuilds(t *testing.T) {
+	base := &packer.CoreBuild{BuildName: "base", Type: "null.base", BuilderInputHash: "base"}
+	app := &packer.CoreBuild{BuildName: "app", Type: "null.app", BuilderInputHash: "app", DependsOn: []string{"base"}}
+	other := &packer.CoreBuild{BuildName: "other", Type: "null.other", BuilderInputHash: "other"}
+	builds := []packersdk.Build{base, app, other}
+
+	unchanged := &buildstate.State{}
+	for _, b := range builds {
+		unchanged.Record(b.Name(), buildstate.Build{InputHash: buildInputHash(b)})
+	}
+	names := func(builds []packersdk.Build) []string {
+		var res []string
+		for _, b := range builds {
+			res = append(res, b.Name())
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		changed  []string
+		resolves bool
+		expected []string
+	}{
+		{"nothing changed", nil, false, nil},
+		{"dependency changed", []string{"base.null.base"}, false, []string{"base.null.base", "app.null.app"}},
+		{"dependent changed", []string{"app.null.app"}, false, []string{"app.null.app"}},
+		{"dependent using the artifacts changed", []string{"app.null.app"}, true, []string{"base.null.base", "app.null.app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &buildstate.State{}
+			for name, b := range unchanged.Builds {
+				state.Record(name, b)
+			}
+			for _, name := range tt.changed {
+				state.Record(name, buildstate.Build{InputHash: "previous"})
+			}
+			app.ResolveDependencies = nil
+			if tt.resolves {
+				app.ResolveDependencies = func(map[string]map[string][]packersdk.Artifact) error { return nil }
+			}
+			if diff := cmp.Diff(tt.expected, names(changedBuilds(builds, state))); diff != "" {
+				t.Errorf("unexpected builds: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/version"
+)
+
+// snapshotTemplate copies the template of the run, its var files and the
+// values of its variables into the -snapshot-dir, the sensitive values
+// redacted, so that the artifacts built next to it describe how they were
+// built.
+func (c *BuildCommand) snapshotTemplate(handler packer.Handler, cla *BuildArgs) int {
+	snapshot, diags := handler.SnapshotTemplate()
+	if ret := writeDiags(c.Ui, nil, diags); ret != 0 {
+		return ret
+	}
+	snapshot.Values.Template = cla.Path
+	if abs, err := filepath.Abs(cla.Path); err == nil && cla.Path != "-" {
+		snapshot.Values.Template = abs
+	}
+	snapshot.Values.PackerVersion = version.FormattedVersion()
+	snapshot.Values.CreatedAt = time.Now().UTC()
+	if err := snapshot.Write(cla.SnapshotDir); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to snapshot the template into %s: %s", cla.SnapshotDir, err))
+		return 1
+	}
+	c.Ui.Say(fmt.Sprintf("Template snapshotted into %s", cla.SnapshotDir))
+	return 0
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildCommand_SnapshotDir(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	dir := t.TempDir()
+	defer cleanup()
+
+	args := []string{
+		"-snapshot-dir=" + dir,
+		"-var-file=" + filepath.Join(testFixture("snapshot"), "vars.json"),
+		filepath.Join(testFixture("snapshot"), "template.json"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "values.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values struct {
+		Template      string
+		PackerVersion string `json:"packer_version"`
+		VarFiles      []string
+		Variables     map[string]string
+	}
+	if err := json.Unmarshal(b, &values); err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(values.Template) || values.PackerVersion == "" {
+		t.Errorf("expected the template path and the Packer version to be recorded, got %s", b)
+	}
+	expected := map[string]string{"flavor": "vanilla", "password": "<sensitive>"}
+	if diff := cmp.Diff(expected, values.Variables); diff != "" {
+		t.Errorf("unexpected variables: %s", diff)
+	}
+
+	for _, name := range []string{"template/template.json", "var-files/vars.json"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected %s in the snapshot: %s", name, err)
+		}
+		if strings.Contains(string(b), "hunter22") || strings.Contains(string(b), "s3cr3t") {
+			t.Errorf("expected the password to be redacted from %s:\n%s", name, b)
+		}
+		if !strings.Contains(string(b), "<sensitive>") {
+			t.Errorf("expected the password to be redacted in %s:\n%s", name, b)
+		}
+	}
+}
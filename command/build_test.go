@@ -307,6 +307,54 @@ func TestBuild(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "hcl - recipes - only dessert tag",
+			args: []string{
+				"-only", "tag:dessert",
+				testFixture("hcl", "recipes"),
+			},
+			fileCheck: fileCheck{
+				notExpected: []string{
+					"NULL.spaghetti_carbonara.txt",
+					"NULL.lasagna.txt",
+				},
+				expectedContent: map[string]string{
+					"NULL.tiramisu.txt": tiramisu,
+				},
+			},
+		},
+		{
+			name: "hcl - recipes - except baked tag",
+			args: []string{
+				"-except", "tag:bak*",
+				testFixture("hcl", "recipes"),
+			},
+			fileCheck: fileCheck{
+				notExpected: []string{
+					"NULL.lasagna.txt",
+				},
+				expected: []string{
+					"NULL.spaghetti_carbonara.txt",
+					"NULL.tiramisu.txt",
+				},
+			},
+		},
+		{
+			name: "hcl - recipes - pasta and baked tags",
+			args: []string{
+				"-tag", "pasta,baked",
+				testFixture("hcl", "recipes"),
+			},
+			fileCheck: fileCheck{
+				notExpected: []string{
+					"NULL.spaghetti_carbonara.txt",
+					"NULL.tiramisu.txt",
+				},
+				expectedContent: map[string]string{
+					"NULL.lasagna.txt": lasagna,
+				},
+			},
+		},
 		{
 			name: "hcl - build.name accessible",
 			args: []string{
@@ -836,6 +884,7 @@ func TestHCL2PostProcessorForceFlag(t *testing.T) {
 
 	args = []string{
 		"-force",
+		"-auto-approve",
 		filepath.Join(testFixture("hcl"), "force.pkr.hcl"),
 	}
 	fCheck = fileCheck{
@@ -925,6 +974,33 @@ func TestBuildCommand_HCLOnlyExceptOptions(t *testing.T) {
 	}
 }
 
+func TestBuildCommand_exceptAssets(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+	template := testFixture("hcl", "assets")
+	defer cleanup()
+
+	// The asset of file.vanilla can't be fetched.
+	c := &BuildCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{template}); code != 1 {
+		t.Fatalf("expected the missing asset to fail the build, got %d", code)
+	}
+	if fileExists("chocolate.txt") {
+		t.Errorf("expected no build to start when an asset is missing")
+	}
+
+	// The assets of the builds left out by -except are not fetched.
+	c = &BuildCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{"-except=file.vanilla", template}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if !fileExists("chocolate.txt") {
+		t.Errorf("Expected to find chocolate.txt")
+	}
+	if fileExists("vanilla.txt") {
+		t.Errorf("Expected NOT to find vanilla.txt")
+	}
+}
+
 func TestBuildWithNonExistingBuilder(t *testing.T) {
 	c := &BuildCommand{
 		Meta: TestMetaFile(t),
@@ -1046,6 +1122,7 @@ func TestBuildCommand_ParseArgs(t *testing.T) {
 				MetaArgs:       MetaArgs{Path: "file.json"},
 				ParallelBuilds: math.MaxInt64,
 				Color:          true,
+				OnErrorRetries: 2,
 			},
 			0,
 		},
@@ -1055,6 +1132,7 @@ func TestBuildCommand_ParseArgs(t *testing.T) {
 				MetaArgs:       MetaArgs{Path: "file.json"},
 				ParallelBuilds: 10,
 				Color:          true,
+				OnErrorRetries: 2,
 			},
 			0,
 		},
@@ -1064,6 +1142,7 @@ func TestBuildCommand_ParseArgs(t *testing.T) {
 				MetaArgs:       MetaArgs{Path: "file.json"},
 				ParallelBuilds: 1,
 				Color:          true,
+				OnErrorRetries: 2,
 			},
 			0,
 		},
@@ -1073,6 +1152,7 @@ func TestBuildCommand_ParseArgs(t *testing.T) {
 				MetaArgs:       MetaArgs{Path: "file.json"},
 				ParallelBuilds: 5,
 				Color:          true,
+				OnErrorRetries: 2,
 			},
 			0,
 		},
@@ -1082,9 +1162,57 @@ func TestBuildCommand_ParseArgs(t *testing.T) {
 				MetaArgs:       MetaArgs{Path: "otherfile.json"},
 				ParallelBuilds: 5,
 				Color:          true,
+				OnErrorRetries: 2,
+			},
+			0,
+		},
+		{fields{defaultMeta},
+			args{[]string{"-force", "file.json"}},
+			&BuildArgs{
+				MetaArgs:        MetaArgs{Path: "file.json"},
+				ParallelBuilds:  math.MaxInt64,
+				Color:           true,
+				OnErrorRetries:  2,
+				Force:           true,
+				ForceArtifact:   true,
+				ForceDeregister: true,
+				ForceRegistry:   true,
 			},
 			0,
 		},
+		{fields{defaultMeta},
+			args{[]string{"-force-deregister", "file.json"}},
+			&BuildArgs{
+				MetaArgs:        MetaArgs{Path: "file.json"},
+				ParallelBuilds:  math.MaxInt64,
+				Color:           true,
+				OnErrorRetries:  2,
+				ForceDeregister: true,
+			},
+			0,
+		},
+		{fields{defaultMeta},
+			args{[]string{"-on-error=retry", "-on-error-retries=5", "file.json"}},
+			&BuildArgs{
+				MetaArgs:       MetaArgs{Path: "file.json"},
+				ParallelBuilds: math.MaxInt64,
+				Color:          true,
+				OnError:        "retry",
+				OnErrorRetries: 5,
+			},
+			0,
+		},
+		{fields{defaultMeta},
+			args{[]string{"-dashboard", "-debug", "file.json"}},
+			&BuildArgs{
+				ParallelBuilds: math.MaxInt64,
+				Color:          true,
+				OnErrorRetries: 2,
+				Dashboard:      true,
+				Debug:          true,
+			},
+			1,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("%s", tt.args.args), func(t *testing.T) {
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// buildTypeLimits limits the number of builds running concurrently by builder
+// type, see -parallel-builds-per-type. A limit set for a plugin, like vsphere,
+// applies to each of its builder types, like vsphere-iso and vsphere-clone,
+// unless they have their own limit.
+type buildTypeLimits map[string]*buildQueue
+
+// newBuildTypeLimits parses the limits given as "type=N" flags, 0 meaning no
+// limit.
+func newBuildTypeLimits(raw map[string]string) (buildTypeLimits, error) {
+	limits := buildTypeLimits{}
+	for typ, value := range raw {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid -parallel-builds-per-type %s=%s: the limit must be a positive number", typ, value)
+		}
+		if n > 0 {
+			limits[typ] = newBuildQueue(n)
+		}
+	}
+	return limits, nil
+}
+
+// limit returns the limit of the builder type of b, and the type or plugin it
+// is set for, nil when the builds of this type are not limited.
+func (l buildTypeLimits) limit(b packersdk.Build) (string, *buildQueue) {
+	typ := builderType(b)
+	if typ == "" {
+		return "", nil
+	}
+	// The most specific limit wins: the one of the builder type, then the
+	// one of the longest plugin name.
+	match := ""
+	for key := range l {
+		if (typ == key || strings.HasPrefix(typ, key+"-")) && len(key) > len(match) {
+			match = key
+		}
+	}
+	if match == "" {
+		return "", nil
+	}
+	return match, l[match]
+}
+
+// builderType returns the type of the builder of a build, like vsphere-iso.
+func builderType(b packersdk.Build) string {
+	cb, ok := b.(*packer.CoreBuild)
+	if !ok {
+		return ""
+	}
+	if cb.BuilderType != "" {
+		return cb.BuilderType
+	}
+	// HCL2 builds are named after the type and name of their source.
+	return strings.SplitN(cb.Type, ".", 2)[0]
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/mitchellh/cli"
+)
+
+type CacheCommand struct {
+	Meta
+}
+
+func (c *CacheCommand) Synopsis() string {
+	return "Inspect and clean up the downloads and plugins cached by Packer"
+}
+
+func (c *CacheCommand) Help() string {
+	helpText := `
+Usage: packer cache <subcommand> [options]
+
+  This command groups subcommands for managing the files cached by Packer on
+  this machine: the downloads of the builders and of the asset blocks, stored
+  in PACKER_CACHE_DIR, and the installed plugins.
+
+  A cache policy can be set in the Packer config file to evict cached files
+  automatically at the end of each build.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *CacheCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// cacheEntries lists the downloads and the plugins cached on this machine.
+func (m *Meta) cacheEntries() ([]cache.Entry, error) {
+	dir, err := packersdk.CachePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the cache dir: %s", err)
+	}
+	entries, err := cache.Downloads(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the downloads: %s", err)
+	}
+	plugins, err := cache.Plugins(m.CoreConfig.Components.PluginConfig.KnownPluginFolders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the plugins: %s", err)
+	}
+	return append(entries, plugins...), nil
+}
+
+// evictCache removes the cached entries selected by policy at now, it returns
+// the ones it removed and whether removing some of them failed. The downloads
+// used by running Packer processes are left alone.
+func evictCache(ui packersdk.Ui, policy *cache.Policy, entries []cache.Entry, now time.Time) ([]cache.Entry, bool) {
+	var evicted []cache.Entry
+	failed := false
+	for _, e := range policy.Evict(entries, now) {
+		removed, err := cache.Remove(e)
+		switch {
+		case err != nil:
+			ui.Error(fmt.Sprintf("Failed to remove %s: %s", e.Path, err))
+			failed = true
+		case !removed:
+			ui.Say(fmt.Sprintf("Skipping %s, it is in use by another Packer process", e.Path))
+		}
+		if removed {
+			evicted = append(evicted, e)
+		}
+	}
+	return evicted, failed
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/posener/complete"
+)
+
+type CacheListCommand struct {
+	Meta
+}
+
+func (c *CacheListCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *CacheListCommand) ParseArgs(args []string) (*CacheListArgs, int) {
+	var cfg CacheListArgs
+	flags := c.Meta.FlagSet("cache list", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *CacheListCommand) RunContext(ctx context.Context, cla *CacheListArgs) int {
+	entries, err := c.cacheEntries()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Path < entries[j].Path
+	})
+
+	if cla.JSON {
+		if entries == nil {
+			entries = []cache.Entry{}
+		}
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.Ui.Message(string(b))
+		return 0
+	}
+	if len(entries) == 0 {
+		c.Ui.Say("The cache is empty.")
+		return 0
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		c.Ui.Machine("cache-entry", string(e.Kind), e.Path, fmt.Sprint(e.Size), e.ModTime.Format(time.RFC3339))
+		line := fmt.Sprintf("%s %s: %s, used %s ago", e.Kind, e.Path, cache.FormatSize(e.Size),
+			durafmt.Parse(now.Sub(e.ModTime)).LimitFirstN(2))
+		if e.Superseded {
+			line += ", superseded by a newer version"
+		}
+		c.Ui.Say(line)
+	}
+	c.Ui.Say(fmt.Sprintf("%d cached file(s), %s in total", len(entries), cache.FormatSize(cache.Size(entries))))
+	return 0
+}
+
+func (*CacheListCommand) Help() string {
+	helpText := `
+Usage: packer cache list [options]
+
+  Lists the files cached by Packer on this machine with their size and the
+  time since they were downloaded or last used: the downloads in
+  PACKER_CACHE_DIR and the installed plugins.
+
+Options:
+
+  -json                         Print the cached files as JSON.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CacheListCommand) Synopsis() string {
+	return "List the cached downloads and plugins"
+}
+
+func (*CacheListCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*CacheListCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-json": complete.PredictNothing,
+	}
+}
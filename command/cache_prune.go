@@ -0,0 +1,141 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/posener/complete"
+)
+
+type CachePruneCommand struct {
+	Meta
+}
+
+func (c *CachePruneCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *CachePruneCommand) ParseArgs(args []string) (*CachePruneArgs, int) {
+	var cfg CachePruneArgs
+	flags := c.Meta.FlagSet("cache prune", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *CachePruneCommand) RunContext(ctx context.Context, cla *CachePruneArgs) int {
+	policy := &cache.Policy{}
+	var err error
+	if cla.OlderThan != "" {
+		if policy.MaxAge, err = cache.ParseAge(cla.OlderThan); err != nil {
+			c.Ui.Error(fmt.Sprintf("Invalid -older-than: %s", err))
+			return 1
+		}
+	}
+	if cla.MaxSize != "" {
+		if policy.MaxSize, err = cache.ParseSize(cla.MaxSize); err != nil {
+			c.Ui.Error(fmt.Sprintf("Invalid -max-size: %s", err))
+			return 1
+		}
+	}
+	if !policy.Enabled() {
+		policy = c.CoreConfig.CachePolicy
+	}
+	if !policy.Enabled() {
+		c.Ui.Error("Nothing to prune by: set -older-than or -max-size, or a cache policy in the Packer config file.")
+		return 1
+	}
+
+	entries, err := c.cacheEntries()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	now := time.Now()
+	selected := policy.Evict(entries, now)
+	if len(selected) == 0 {
+		c.Ui.Say("Nothing to prune.")
+		return 0
+	}
+
+	verb := "Removing"
+	if cla.DryRun {
+		verb = "Would remove"
+	}
+	for _, e := range selected {
+		c.Ui.Say(fmt.Sprintf("%s %s %s (%s)", verb, e.Kind, e.Path, cache.FormatSize(e.Size)))
+	}
+	if cla.DryRun {
+		return 0
+	}
+	if err := c.confirm(&cla.ConfirmArgs, fmt.Sprintf("Do you want to remove these %d cached file(s), %s in total?",
+		len(selected), cache.FormatSize(cache.Size(selected)))); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	evicted, failed := evictCache(c.Ui, policy, entries, now)
+	c.Ui.Say(fmt.Sprintf("Removed %d cached file(s), freeing %s", len(evicted), cache.FormatSize(cache.Size(evicted))))
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func (*CachePruneCommand) Help() string {
+	helpText := `
+Usage: packer cache prune [options]
+
+  Removes cached files, the least recently used first: downloads are fetched
+  again when a build needs them, and plugins are only removed once a newer
+  version of the same plugin is installed. The files used by running Packer
+  processes are left alone.
+
+  Without options, the cache policy of the Packer config file is used.
+
+Options:
+
+  -auto-approve                 Remove the files without asking for confirmation.
+  -dry-run                      List the files that would be removed without removing them.
+  -max-size=20GB                Remove files until the cache is not larger than this size.
+  -older-than=30d               Remove the files not used for longer than this duration.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CachePruneCommand) Synopsis() string {
+	return "Remove cached downloads and superseded plugins by age or size"
+}
+
+func (*CachePruneCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*CachePruneCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-auto-approve": complete.PredictNothing,
+		"-dry-run":      complete.PredictNothing,
+		"-max-size":     complete.PredictNothing,
+		"-older-than":   complete.PredictNothing,
+	}
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/internal/cache"
+)
+
+func TestCachePruneCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PACKER_CACHE_DIR", dir)
+
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for name, modTime := range map[string]time.Time{
+		"old.iso":    old,
+		"recent.iso": time.Now(),
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &CachePruneCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{"-older-than=30d", "-dry-run"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.iso")); err != nil {
+		t.Fatalf("expected the dry run to remove nothing: %s", err)
+	}
+
+	if code := c.Run([]string{"-older-than=30d", "-auto-approve"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.iso")); !os.IsNotExist(err) {
+		t.Errorf("expected the old download to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "recent.iso")); err != nil {
+		t.Errorf("expected the recent download to be kept: %s", err)
+	}
+
+	// Without options, the cache policy of the config file applies.
+	c = &CachePruneCommand{Meta: TestMetaFile(t)}
+	if code := c.Run([]string{"-auto-approve"}); code != 1 {
+		t.Fatalf("expected pruning without a policy to fail, got %d", code)
+	}
+	c.CoreConfig.CachePolicy = &cache.Policy{MaxSize: 1}
+	if code := c.Run([]string{"-auto-approve"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "recent.iso")); !os.IsNotExist(err) {
+		t.Errorf("expected the download to be evicted by the cache policy")
+	}
+}
+
+func TestCacheVerifyCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PACKER_CACHE_DIR", dir)
+
+	path := filepath.Join(dir, "driver.zip")
+	if err := ioutil.WriteFile(path, []byte("driver"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Touch(path); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CacheVerifyCommand{Meta: TestMetaFile(t)}
+	if code := c.Run(nil); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := c.Run([]string{"-remove"}); code != 1 {
+		t.Fatalf("expected the corrupted download to be reported, got %d", code)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the corrupted download to be removed")
+	}
+}
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/posener/complete"
+)
+
+type CacheVerifyCommand struct {
+	Meta
+}
+
+func (c *CacheVerifyCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *CacheVerifyCommand) ParseArgs(args []string) (*CacheVerifyArgs, int) {
+	var cfg CacheVerifyArgs
+	flags := c.Meta.FlagSet("cache verify", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *CacheVerifyCommand) RunContext(ctx context.Context, cla *CacheVerifyArgs) int {
+	entries, err := c.cacheEntries()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	ret := 0
+	verified, unverified := 0, 0
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return 1
+		}
+		err := cache.Verify(e)
+		switch {
+		case err == cache.ErrNoChecksum:
+			unverified++
+			continue
+		case err == nil:
+			verified++
+			continue
+		}
+		ret = 1
+		c.Ui.Machine("cache-corrupted", string(e.Kind), e.Path)
+		c.Ui.Error(fmt.Sprintf("%s %s is corrupted: %s", e.Kind, e.Path, err))
+		if !cla.Remove {
+			continue
+		}
+		if removed, err := cache.Remove(e); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to remove %s: %s", e.Path, err))
+		} else if removed {
+			c.Ui.Say(fmt.Sprintf("Removed %s", e.Path))
+		} else {
+			c.Ui.Say(fmt.Sprintf("Skipping %s, it is in use by another Packer process", e.Path))
+		}
+	}
+	c.Ui.Say(fmt.Sprintf("Verified %d cached file(s), %d without a recorded checksum were skipped", verified, unverified))
+	return ret
+}
+
+func (*CacheVerifyCommand) Help() string {
+	helpText := `
+Usage: packer cache verify [options]
+
+  Checks that the cached files still match the checksums recorded when they
+  were cached, and reports the corrupted ones. The files cached without a
+  checksum, like the downloads of the builders, are skipped.
+
+  Exits 1 when a cached file is corrupted.
+
+Options:
+
+  -remove                       Remove the corrupted files, so that they are fetched again.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CacheVerifyCommand) Synopsis() string {
+	return "Verify the checksums of the cached downloads and plugins"
+}
+
+func (*CacheVerifyCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*CacheVerifyCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-remove": complete.PredictNothing,
+	}
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/hashicorp/packer/packer"
+	"github.com/posener/complete"
+)
+
+type CleanupCommand struct {
+	Meta
+}
+
+func (c *CleanupCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *CleanupCommand) ParseArgs(args []string) (*CleanupArgs, int) {
+	var cfg CleanupArgs
+	flags := c.Meta.FlagSet("cleanup", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *CleanupCommand) RunContext(ctx context.Context, cla *CleanupArgs) int {
+	ledger, err := packer.DefaultResourceLedger()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to find the resource ledger: %s", err))
+		return 1
+	}
+	resources, err := ledger.List()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// The resources of the builds still running are not leftovers.
+	active := map[string]bool{}
+	byBuilder := map[string][]packer.TrackedResource{}
+	count := 0
+	for _, r := range resources {
+		if cla.Builder != "" && r.BuilderType != cla.Builder {
+			continue
+		}
+		if _, checked := active[r.RunUUID]; !checked {
+			active[r.RunUUID] = ledger.RunActive(r.RunUUID)
+		}
+		if active[r.RunUUID] {
+			continue
+		}
+		byBuilder[r.BuilderType] = append(byBuilder[r.BuilderType], r)
+		count++
+	}
+	if count == 0 {
+		c.Ui.Say("Nothing to clean up.")
+		return 0
+	}
+
+	builderTypes := make([]string, 0, len(byBuilder))
+	for builderType := range byBuilder {
+		builderTypes = append(builderTypes, builderType)
+	}
+	sort.Strings(builderTypes)
+
+	verb := "Destroying"
+	if cla.DryRun {
+		verb = "Would destroy"
+	}
+	now := time.Now()
+	for _, builderType := range builderTypes {
+		for _, r := range byBuilder[builderType] {
+			c.Ui.Say(fmt.Sprintf("Build '%s': %s %s, created %s ago by run %s", r.Build, verb, r,
+				durafmt.Parse(now.Sub(r.CreatedAt)).LimitFirstN(2), r.RunUUID))
+		}
+	}
+	if cla.DryRun {
+		return 0
+	}
+	if err := c.confirm(&cla.ConfirmArgs, fmt.Sprintf("Do you want to destroy these %d resource(s)?", count)); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	ret := 0
+	pluginConfig := c.CoreConfig.Components.PluginConfig
+	for _, builderType := range builderTypes {
+		leftovers := byBuilder[builderType]
+		ui := &packer.TargetedUI{Target: builderType, Ui: c.Ui}
+		cleaner, err := pluginConfig.ResourceCleaner(builderType)
+		if err == nil {
+			var destroyed []packer.TrackedResource
+			destroyed, err = cleaner.CleanupResources(ctx, ui, leftovers)
+			if len(destroyed) > 0 {
+				if err := ledger.Remove(destroyed...); err != nil {
+					ui.Error(fmt.Sprintf("Failed to forget the destroyed resources: %s", err))
+					ret = 1
+				}
+				ui.Say(fmt.Sprintf("Destroyed %d resource(s)", len(destroyed)))
+			}
+		}
+		switch {
+		case errors.Is(err, packer.ErrCleanupUnsupported):
+			ui.Say(fmt.Sprintf("The builder cannot destroy its resources, the %d resource(s) must be deleted manually.",
+				len(leftovers)))
+			ret = 1
+		case err != nil:
+			ui.Error(fmt.Sprintf("Failed to destroy the resources: %s", err))
+			ret = 1
+		}
+	}
+	return ret
+}
+
+func (*CleanupCommand) Help() string {
+	helpText := `
+Usage: packer cleanup [options]
+
+  Destroys the resources left behind by interrupted builds, like instances, key
+  pairs or temporary security groups. The resources the builders report
+  creating are recorded in a ledger until they are destroyed; the ones of the
+  builds still running are left alone. Only the builders supporting cleanup can
+  destroy their resources, the others are listed for manual deletion.
+
+  The ledger is resources.json in the Packer config directory, or the file set
+  by PACKER_RESOURCE_LEDGER.
+
+Options:
+
+  -auto-approve                 Destroy the resources without asking for confirmation.
+  -builder=amazon-ebs           Only destroy the resources of this builder type.
+  -dry-run                      List the resources that would be destroyed without destroying them.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CleanupCommand) Synopsis() string {
+	return "destroy the resources left behind by interrupted builds"
+}
+
+func (*CleanupCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*CleanupCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-auto-approve": complete.PredictNothing,
+		"-builder":      complete.PredictNothing,
+		"-dry-run":      complete.PredictNothing,
+	}
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/builder/file"
+	"github.com/hashicorp/packer/packer"
+)
+
+// cleanedBuilder is a file builder able to destroy the resources it left
+// behind.
+type cleanedBuilder struct {
+	file.Builder
+	destroyed []string
+}
+
+func (b *cleanedBuilder) CleanupResources(_ context.Context, _ packersdk.Ui, resources []packer.TrackedResource) ([]packer.TrackedResource, error) {
+	for _, r := range resources {
+		b.destroyed = append(b.destroyed, r.ID)
+	}
+	return resources, nil
+}
+
+func TestCleanupCommand(t *testing.T) {
+	ledger := &packer.ResourceLedger{Path: filepath.Join(t.TempDir(), "resources.json")}
+	t.Setenv(packer.ResourceLedgerEnvVar, ledger.Path)
+
+	resources := []packer.TrackedResource{
+		{BuilderType: "cleaned", Kind: "instance", ID: "i-1", Build: "cleaned.app", RunUUID: "interrupted"},
+		{BuilderType: "cleaned", Kind: "key_pair", ID: "kp-1", Build: "cleaned.app", RunUUID: "interrupted"},
+		{BuilderType: "cleaned", Kind: "instance", ID: "i-2", Build: "cleaned.app", RunUUID: "running"},
+		{BuilderType: "file", Kind: "file", ID: "f-1", Build: "file.app", RunUUID: "interrupted"},
+	}
+	for _, r := range resources {
+		if err := ledger.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release, err := ledger.HoldRun("running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	builder := &cleanedBuilder{}
+	c := &CleanupCommand{Meta: TestMetaFile(t)}
+	c.CoreConfig.Components.PluginConfig.Builders.(packer.MapOfBuilder)["cleaned"] = func() (packersdk.Builder, error) {
+		return builder, nil
+	}
+
+	// The dry run destroys nothing.
+	if code := c.Run([]string{"-dry-run"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if len(builder.destroyed) != 0 {
+		t.Fatalf("expected nothing to be destroyed by the dry run, got %v", builder.destroyed)
+	}
+
+	// The file builder cannot clean up, its resource is reported.
+	if code := c.Run([]string{"-auto-approve"}); code != 1 {
+		t.Fatalf("expected the resources of the file builder to be reported, got %d", code)
+	}
+	if want := []string{"i-1", "kp-1"}; !reflect.DeepEqual(builder.destroyed, want) {
+		t.Errorf("expected %v to be destroyed, got %v", want, builder.destroyed)
+	}
+
+	left, err := ledger.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range left {
+		ids = append(ids, r.ID)
+	}
+	if want := []string{"i-2", "f-1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected %v to be left in the ledger, got %v", want, ids)
+	}
+}
@@ -3,10 +3,13 @@ package command
 import (
 	"flag"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/packer/command/enumflag"
 	kvflag "github.com/hashicorp/packer/command/flag-kv"
 	sliceflag "github.com/hashicorp/packer/command/flag-slice"
+	"github.com/hashicorp/packer/internal/envlock"
+	"github.com/hashicorp/packer/packer"
 )
 
 //go:generate enumer -type configType -trimprefix ConfigType -transform snake
@@ -53,6 +56,7 @@ func (ma *MetaArgs) GetConfigType() (configType, error) {
 func (ma *MetaArgs) AddFlagSets(fs *flag.FlagSet) {
 	fs.Var((*sliceflag.StringFlag)(&ma.Only), "only", "")
 	fs.Var((*sliceflag.StringFlag)(&ma.Except), "except", "")
+	fs.Var((*sliceflag.StringFlag)(&ma.Tags), "tag", "")
 	fs.Var((*kvflag.Flag)(&ma.Vars), "var", "")
 	fs.Var((*kvflag.StringSlice)(&ma.VarFiles), "var-file", "")
 	fs.Var(&ma.ConfigType, "config-type", "set to 'hcl2' to run in hcl2 mode when no file is passed.")
@@ -68,29 +72,266 @@ type MetaArgs struct {
 	VarFiles     []string
 	// set to "hcl2" to force hcl2 mode
 	ConfigType configType
+	// Tags select the builds tagged with all of them.
+	Tags []string
+}
+
+func (ca *ConfirmArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&ca.AutoApprove, "auto-approve", false, "skip the confirmation of destructive operations")
+}
+
+// ConfirmArgs is embedded in the args of commands that can overwrite or delete
+// existing resources; such operations require a confirmation unless
+// -auto-approve is set.
+type ConfirmArgs struct {
+	AutoApprove bool
 }
 
 func (ba *BuildArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&ba.BuildLock, "build-lock", false, "")
 	flags.BoolVar(&ba.Color, "color", true, "")
+	flags.BoolVar(&ba.Dashboard, "dashboard", false, "")
 	flags.BoolVar(&ba.Debug, "debug", false, "")
+	flags.BoolVar(&ba.DetailedExitCodes, "detailed-exitcodes", false, "")
 	flags.BoolVar(&ba.Force, "force", false, "")
+	flags.BoolVar(&ba.ForceArtifact, "force-artifact", false, "")
+	flags.BoolVar(&ba.ForceDeregister, "force-deregister", false, "")
+	flags.BoolVar(&ba.ForceRegistry, "force-registry", false, "")
+	flags.BoolVar(&ba.HCPChecksumFiles, "hcp-checksum-files", false, "")
+	flags.BoolVar(&ba.HCPUploadLogs, "hcp-upload-logs", false, "")
+	flags.BoolVar(&ba.IfChanged, "if-changed", false, "")
+	flags.BoolVar(&ba.Incremental, "incremental", false, "")
 	flags.BoolVar(&ba.TimestampUi, "timestamp-ui", false, "")
 	flags.BoolVar(&ba.MachineReadable, "machine-readable", false, "")
+	flags.BoolVar(&ba.PauseSignals, "pause-signals", false, "")
+	flags.BoolVar(&ba.ProvisionOnly, "provision-only", false, "")
+	flags.StringVar(&ba.TargetHost, "target-host", "", "")
 
 	flags.Int64Var(&ba.ParallelBuilds, "parallel-builds", 0, "")
+	flags.DurationVar(&ba.CancelGracePeriod, "cancel-grace-period", 0, "")
+	flags.DurationVar(&ba.CleanupTimeout, "cleanup-timeout", 0, "")
+	flags.DurationVar(&ba.TermGracePeriod, "term-grace-period", 0, "")
+	flags.StringVar(&ba.JUnitOutput, "junit-output", "", "")
+	flags.BoolVar(&ba.JUnitProvisioners, "junit-provisioners", false, "")
+	flags.BoolVar(&ba.ResourceUsage, "resource-usage", false, "")
+	flags.BoolVar(&ba.ApprovePromotion, "approve-promotion", false, "")
+	flags.DurationVar(&ba.MaxDuration, "max-duration", 0, "")
+	flags.Var((*kvflag.Flag)(&ba.ParallelBuildsPerType), "parallel-builds-per-type", "")
+	flags.StringVar(&ba.Checkpoint, "checkpoint", "", "")
+	flags.StringVar(&ba.EnvrcLock, "envrc-lock", "", "")
+	flags.StringVar(&ba.FromStage, "from-stage", "", "")
+	flags.StringVar(&ba.SnapshotDir, "snapshot-dir", "", "")
+	flags.StringVar(&ba.State, "state", "", "")
+	flags.StringVar(&ba.TempDirRoot, "temp-dir-root", "", "")
+	flags.StringVar(&ba.TranscriptDir, "transcript-dir", "", "")
+	flags.StringVar(&ba.RecordDir, "record-dir", "", "")
+	flags.StringVar(&ba.ReplayDir, "replay-dir", "", "")
+	flags.BoolVar(&ba.TranscriptHashOutput, "transcript-hash-output", false, "")
+	flags.StringVar(&ba.ConsoleLogDir, "console-log-dir", "", "")
 
-	flagOnError := enumflag.New(&ba.OnError, "cleanup", "abort", "ask", "run-cleanup-provisioner")
+	flagOnError := enumflag.New(&ba.OnError, "cleanup", "abort", "ask", "run-cleanup-provisioner", packer.OnErrorRetry)
 	flags.Var(flagOnError, "on-error", "")
+	flags.IntVar(&ba.OnErrorRetries, "on-error-retries", 2, "")
+	flags.Var(enumflag.New(&ba.Resume, packer.ResumeContinue, packer.ResumeCleanup), "resume", "")
 
 	ba.MetaArgs.AddFlagSets(flags)
+	ba.ConfirmArgs.AddFlagSets(flags)
 }
 
 // BuildArgs represents a parsed cli line for a `packer build`
 type BuildArgs struct {
 	MetaArgs
+	ConfirmArgs
 	Color, Debug, Force, TimestampUi, MachineReadable bool
-	ParallelBuilds                                    int64
-	OnError                                           string
+	HCPChecksumFiles, HCPUploadLogs                   bool
+	Incremental                                       bool
+	FromStage                                         string
+	// Split -force semantics, -force sets them all.
+	ForceArtifact, ForceDeregister, ForceRegistry bool
+	ParallelBuilds                                int64
+	OnError                                       string
+	EnvrcLock                                     string
+	TranscriptDir                                 string
+	TranscriptHashOutput                          bool
+	// TempDirRoot is where the scratch directory of each build is created.
+	TempDirRoot string
+	// ConsoleLogDir is where the console output of the machines is
+	// captured, by build.
+	ConsoleLogDir string
+	// OnErrorRetries is how many times a failed provisioner or
+	// post-processor runs again with -on-error=retry.
+	OnErrorRetries int
+	// ParallelBuildsPerType limits the number of builds running in parallel
+	// by builder type or plugin, like vsphere-iso=2.
+	ParallelBuildsPerType map[string]string
+	// PauseSignals pauses the provisioning of the builds on SIGTSTP and
+	// resumes it on SIGCONT, see packer.PauseGate.
+	PauseSignals bool
+	// IfChanged only runs the builds whose inputs changed since their last
+	// successful build, recorded in the State.
+	IfChanged bool
+	State     string
+	// Checkpoint records the progress of the builds, for a later run to
+	// Resume them after a crash.
+	Checkpoint string
+	Resume     string
+	// Dashboard shows each build in its own pane rather than interleaving
+	// their output, on a terminal.
+	Dashboard bool
+	// CancelGracePeriod is how long the running builds keep running after an
+	// interrupt, and CleanupTimeout how long the cancelled builds can take to
+	// clean up.
+	CancelGracePeriod time.Duration
+	CleanupTimeout    time.Duration
+	// TermGracePeriod is how long the builds cancelled on a SIGTERM can take
+	// to clean up before Packer exits.
+	TermGracePeriod time.Duration
+	// JUnitOutput is where the JUnit XML report of the builds is written,
+	// JUnitProvisioners reports their provisioners as test cases too.
+	JUnitOutput       string
+	JUnitProvisioners bool
+	// ResourceUsage reports what each build used of the machine, see
+	// packer.ResourceMonitor.
+	ResourceUsage bool
+	// ApprovePromotion approves the promotions of the publish blocks
+	// requiring approval, see packerregistry.PublishOptions.
+	ApprovePromotion bool
+	// ProvisionOnly runs the provisioners against the existing machine at
+	// TargetHost instead of running the builders, see
+	// packer.ProvisionOnlyBuilder.
+	ProvisionOnly bool
+	TargetHost    string
+	// RecordDir is where the interactions of each build with its plugins
+	// are recorded, for a later run to replay them from its ReplayDir, see
+	// packer.BuildRecording.
+	RecordDir string
+	ReplayDir string
+	// MaxDuration is the wall-clock budget of the whole run, once exceeded
+	// the run is cancelled like on an interrupt.
+	MaxDuration time.Duration
+	// SnapshotDir is where the template, its var files and the values of
+	// its variables are copied before building.
+	SnapshotDir string
+	// BuildLock locks the template while it is built, so that a concurrent
+	// build of the same template fails fast.
+	BuildLock bool
+	// DetailedExitCodes exits with the exit code of the class of the
+	// failure, see packer.FailureClass.
+	DetailedExitCodes bool
+}
+
+func (wa *WatchArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&wa.Cron, "cron", "", "")
+	flags.BoolVar(&wa.OnDataChange, "on-data-change", false, "")
+	flags.StringVar(&wa.Feed, "feed", "", "")
+	flags.StringVar(&wa.FeedPattern, "feed-pattern", "", "")
+	flags.DurationVar(&wa.Interval, "interval", 10*time.Minute, "")
+	flags.StringVar(&wa.Lock, "lock", "", "")
+	flags.StringVar(&wa.Status, "status", "", "")
+
+	wa.BuildArgs.AddFlagSets(flags)
+}
+
+// WatchArgs represents a parsed cli line for a `packer watch`
+type WatchArgs struct {
+	BuildArgs
+	// The triggers of the builds.
+	Cron         string
+	OnDataChange bool
+	Feed         string
+	FeedPattern  string
+
+	Interval     time.Duration
+	Lock, Status string
+}
+
+func (sa *ServeArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&sa.Address, "address", "127.0.0.1:8095", "")
+	flags.IntVar(&sa.MaxConcurrentBuilds, "max-concurrent-builds", 1, "")
+	flags.StringVar(&sa.Templates, "templates", "", "")
+	flags.StringVar(&sa.Token, "token", "", "")
+}
+
+// ServeArgs represents a parsed cli line for a `packer serve`
+type ServeArgs struct {
+	Address             string
+	MaxConcurrentBuilds int
+	// Templates is the directory the submitted templates must be in.
+	Templates string
+	// Token is the bearer token the requests must send, if any.
+	Token string
+}
+
+func (ga *GCArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&ga.DryRun, "dry-run", false, "")
+	flags.IntVar(&ga.KeepImages, "keep-images", 0, "")
+	flags.DurationVar(&ga.MinAge, "min-age", 24*time.Hour, "")
+
+	ga.MetaArgs.AddFlagSets(flags)
+	ga.ConfirmArgs.AddFlagSets(flags)
+}
+
+// GCArgs represents a parsed cli line for a `packer gc`
+type GCArgs struct {
+	MetaArgs
+	ConfirmArgs
+	DryRun     bool
+	KeepImages int
+	MinAge     time.Duration
+}
+
+func (ca *CleanupArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&ca.DryRun, "dry-run", false, "")
+	flags.StringVar(&ca.Builder, "builder", "", "")
+
+	ca.ConfirmArgs.AddFlagSets(flags)
+}
+
+// CleanupArgs represents a parsed cli line for a `packer cleanup`
+type CleanupArgs struct {
+	ConfirmArgs
+	DryRun bool
+	// Builder, when set, restricts the cleanup to the resources of this
+	// builder type.
+	Builder string
+}
+
+func (ca *CacheListArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&ca.JSON, "json", false, "")
+}
+
+// CacheListArgs represents a parsed cli line for a `packer cache list`
+type CacheListArgs struct {
+	JSON bool
+}
+
+func (ca *CachePruneArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&ca.OlderThan, "older-than", "", "")
+	flags.StringVar(&ca.MaxSize, "max-size", "", "")
+	flags.BoolVar(&ca.DryRun, "dry-run", false, "")
+
+	ca.ConfirmArgs.AddFlagSets(flags)
+}
+
+// CachePruneArgs represents a parsed cli line for a `packer cache prune`
+type CachePruneArgs struct {
+	ConfirmArgs
+	// OlderThan and MaxSize are the policy to prune by, like "30d" and
+	// "20GB". The policy of the Packer config file is used when both are
+	// empty.
+	OlderThan string
+	MaxSize   string
+	DryRun    bool
+}
+
+func (ca *CacheVerifyArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&ca.Remove, "remove", false, "")
+}
+
+// CacheVerifyArgs represents a parsed cli line for a `packer cache verify`
+type CacheVerifyArgs struct {
+	// Remove removes the corrupted files.
+	Remove bool
 }
 
 func (ia *InitArgs) AddFlagSets(flags *flag.FlagSet) {
@@ -110,9 +351,20 @@ type PluginsRequiredArgs struct {
 	MetaArgs
 }
 
+func (ca *ConsoleArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&ca.File, "file", "", "")
+	flags.BoolVar(&ca.JSON, "json", false, "")
+
+	ca.MetaArgs.AddFlagSets(flags)
+}
+
 // ConsoleArgs represents a parsed cli line for a `packer console`
 type ConsoleArgs struct {
 	MetaArgs
+	// File is a file of named expressions to evaluate, instead of reading
+	// them from stdin, and JSON prints their values as a JSON object.
+	File string
+	JSON bool
 }
 
 func (fa *FixArgs) AddFlagSets(flags *flag.FlagSet) {
@@ -129,6 +381,8 @@ type FixArgs struct {
 
 func (va *ValidateArgs) AddFlagSets(flags *flag.FlagSet) {
 	flags.BoolVar(&va.SyntaxOnly, "syntax-only", false, "check syntax only")
+	flags.BoolVar(&va.SkipHostChecks, "skip-host-checks", false, "do not check the host requirements of the builds")
+	flags.Var(enumflag.New(&va.Secrets, "warn", "error", "ignore"), "secrets", "what to do with the secrets written in the template")
 
 	va.MetaArgs.AddFlagSets(flags)
 }
@@ -136,7 +390,82 @@ func (va *ValidateArgs) AddFlagSets(flags *flag.FlagSet) {
 // ValidateArgs represents a parsed cli line for a `packer validate`
 type ValidateArgs struct {
 	MetaArgs
-	SyntaxOnly bool
+	SyntaxOnly, SkipHostChecks bool
+	// Secrets tells what to do with the values of the template looking like
+	// secrets: warn (default), error or ignore.
+	Secrets string
+}
+
+func (sa *ArtifactSourcesArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&sa.State, "state", "", "")
+	flags.Var((*sliceflag.StringFlag)(&sa.Manifests), "manifest", "")
+	flags.StringVar(&sa.History, "history", "", "")
+}
+
+// ArtifactSourcesArgs are where the artifacts recorded by previous runs are
+// read: the build state of the template, the files of manifest
+// post-processors, and the artifact history.
+type ArtifactSourcesArgs struct {
+	Path      string
+	State     string
+	Manifests []string
+	History   string
+}
+
+func (aa *ArtifactsArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&aa.Build, "build", "", "")
+	flags.StringVar(&aa.Builder, "builder", "", "")
+	flags.DurationVar(&aa.Since, "since", 0, "")
+	flags.BoolVar(&aa.JSON, "json", false, "")
+	flags.BoolVar(&aa.Delete, "delete", false, "")
+	flags.StringVar(&aa.Export, "export", "", "")
+
+	aa.ArtifactSourcesArgs.AddFlagSets(flags)
+	aa.ConfirmArgs.AddFlagSets(flags)
+}
+
+// ArtifactsArgs represents a parsed cli line for a `packer artifacts`
+type ArtifactsArgs struct {
+	ArtifactSourcesArgs
+	ConfirmArgs
+	// Build, Builder and Since filter the artifacts: by build name pattern,
+	// by builder type or ID, and by age.
+	Build   string
+	Builder string
+	Since   time.Duration
+	JSON    bool
+	// Delete forgets the records of the artifacts, Export writes them to a
+	// manifest file.
+	Delete bool
+	Export string
+}
+
+func (aa *ArtifactsShowArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&aa.JSON, "json", false, "")
+
+	aa.ArtifactSourcesArgs.AddFlagSets(flags)
+}
+
+// ArtifactsShowArgs represents a parsed cli line for a `packer artifacts show`
+type ArtifactsShowArgs struct {
+	ArtifactSourcesArgs
+	// ID is the ID of the artifact to show.
+	ID   string
+	JSON bool
+}
+
+func (pa *PostProcessArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&pa.Retry, "retry", false, "")
+
+	pa.MetaArgs.AddFlagSets(flags)
+}
+
+// PostProcessArgs represents a parsed cli line for a `packer postprocess`
+type PostProcessArgs struct {
+	MetaArgs
+	// Retry runs the failed post-processor chains again, rather than
+	// listing them.
+	Retry bool
 }
 
 func (va *InspectArgs) AddFlagSets(flags *flag.FlagSet) {
@@ -175,3 +504,55 @@ type FormatArgs struct {
 	MetaArgs
 	Check, Diff, Write, Recursive bool
 }
+
+func (da *HCPDeprecateArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.BoolVar(&da.DryRun, "dry-run", false, "list the iterations that would be deprecated")
+	flags.IntVar(&da.Keep, "keep", 0, "number of superseded iterations to keep")
+	flags.StringVar(&da.Message, "message", "", "reason of the deprecation")
+	flags.StringVar(&da.RevokeIn, "revoke-in", "0s", "delay after which deprecated iterations are revoked")
+
+	da.ConfirmArgs.AddFlagSets(flags)
+}
+
+// HCPDeprecateArgs represents a parsed cli line for `packer hcp deprecate`
+type HCPDeprecateArgs struct {
+	ConfirmArgs
+	Bucket, IterationID string
+	DryRun              bool
+	Keep                int
+	Message, RevokeIn   string
+}
+
+func (ea *HCPExpiringArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.DurationVar(&ea.Within, "within", 7*24*time.Hour, "list the iterations expiring within this duration")
+}
+
+// HCPExpiringArgs represents a parsed cli line for `packer hcp expiring`
+type HCPExpiringArgs struct {
+	Buckets []string
+	Within  time.Duration
+}
+
+func (pa *HCPPromoteArgs) AddFlagSets(flags *flag.FlagSet) {
+	pa.ConfirmArgs.AddFlagSets(flags)
+}
+
+// HCPPromoteArgs represents a parsed cli line for `packer hcp promote`
+type HCPPromoteArgs struct {
+	ConfirmArgs
+	Bucket, IterationID, Channel string
+}
+
+func (ea *EnvrcCaptureArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.StringVar(&ea.Output, "output", envlock.DefaultFilename, "")
+}
+
+// EnvrcCaptureArgs represents a parsed cli line for a `packer envrc capture`
+type EnvrcCaptureArgs struct {
+	Output string
+}
+
+// EnvrcVerifyArgs represents a parsed cli line for a `packer envrc verify`
+type EnvrcVerifyArgs struct {
+	Path string
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errNotApproved is returned by confirm when the user declined the operation.
+var errNotApproved = errors.New("operation cancelled, only 'yes' is accepted to approve")
+
+// confirm asks the user to approve the operation described by action, it
+// returns nil once approved. The prompt is skipped when -auto-approve is set.
+// When the UI cannot prompt, for example when running without a TTY or with
+// -machine-readable, the operation is refused so that CI runs do not hang and
+// must explicitly opt in with -auto-approve.
+func (m *Meta) confirm(cla *ConfirmArgs, action string) error {
+	if cla.AutoApprove {
+		return nil
+	}
+
+	answer, err := m.Ui.Ask(fmt.Sprintf("%s\n  Only 'yes' will be accepted to approve.\n\n  Enter a value:", action))
+	if err != nil {
+		return fmt.Errorf("cannot ask for confirmation: %s; use -auto-approve to approve without a prompt", err)
+	}
+	if answer != "yes" {
+		return errNotApproved
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+type answerTTY string
+
+func (a answerTTY) ReadString() (string, error) { return string(a) + "\n", nil }
+func (answerTTY) Close() error                  { return nil }
+
+func TestMeta_confirm(t *testing.T) {
+	tcs := []struct {
+		name        string
+		tty         packersdk.TTY
+		autoApprove bool
+		wantErr     bool
+	}{
+		{name: "auto approved without tty", autoApprove: true},
+		{name: "no tty", wantErr: true},
+		{name: "approved", tty: answerTTY("yes")},
+		{name: "declined", tty: answerTTY("no"), wantErr: true},
+		{name: "only yes approves", tty: answerTTY("y"), wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			m := &Meta{
+				Ui: &packersdk.BasicUi{
+					Writer:      &out,
+					ErrorWriter: &errOut,
+					TTY:         tc.tty,
+				},
+			}
+
+			err := m.confirm(&ConfirmArgs{AutoApprove: tc.autoApprove}, "Destroy everything?")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -3,15 +3,19 @@ package command
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/chzyer/readline"
+	"github.com/hashicorp/packer/hcl2template"
 	"github.com/hashicorp/packer/helper/wrappedreadline"
 	"github.com/hashicorp/packer/helper/wrappedstreams"
 	"github.com/hashicorp/packer/packer"
 	"github.com/posener/complete"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 var TiniestBuilder = strings.NewReader(`{
@@ -51,6 +55,10 @@ func (c *ConsoleCommand) ParseArgs(args []string) (*ConsoleArgs, int) {
 	if len(args) == 1 {
 		cfg.Path = args[0]
 	}
+	if cfg.JSON && cfg.File == "" {
+		c.Ui.Error("-json can only be used with -file")
+		return &cfg, 1
+	}
 	return &cfg, 0
 }
 
@@ -62,6 +70,10 @@ func (c *ConsoleCommand) RunContext(ctx context.Context, cla *ConsoleArgs) int {
 
 	_ = packerStarter.Initialize(packer.InitializeOptions{})
 
+	if cla.File != "" {
+		return c.modeFile(packerStarter, cla.File, cla.JSON)
+	}
+
 	// Determine if stdin is a pipe. If so, we evaluate directly.
 	if c.StdinPiped() {
 		return c.modePiped(packerStarter)
@@ -80,6 +92,10 @@ Usage: packer console [options] [TEMPLATE]
   interpolation.
 
 Options:
+  -file=path             Evaluate the named expressions of an HCL2 file, like
+                         'name = expr', and print their values.
+  -json                  Print the values of the -file expressions as a JSON
+                         object.
   -var 'key=value'       Variable for templates, can be used multiple times.
   -var-file=path         JSON or HCL2 file containing user variables.
 `
@@ -97,6 +113,8 @@ func (*ConsoleCommand) AutocompleteArgs() complete.Predictor {
 
 func (*ConsoleCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
+		"-file":     complete.PredictFiles("*"),
+		"-json":     complete.PredictNothing,
 		"-var":      complete.PredictNothing,
 		"-var-file": complete.PredictNothing,
 	}
@@ -120,6 +138,50 @@ func (c *ConsoleCommand) modePiped(cfg packer.Evaluator) int {
 	return ret
 }
 
+// modeFile evaluates the named expressions of the file at path and prints
+// their values, sorted by name, or a JSON object of them.
+func (c *ConsoleCommand) modeFile(cfg packer.Evaluator, path string, asJSON bool) int {
+	values, diags := cfg.EvaluateExpressionsFile(path)
+	if ret := writeDiags(c.Ui, nil, diags); ret != 0 {
+		return ret
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !asJSON {
+		for _, name := range names {
+			c.Ui.Say(fmt.Sprintf("%s = %s", name, hcl2template.PrintableCtyValue(values[name])))
+		}
+		return 0
+	}
+
+	out := map[string]json.RawMessage{}
+	for _, name := range names {
+		val, _ := values[name].UnmarkDeep()
+		if !val.IsWhollyKnown() {
+			c.Ui.Error(fmt.Sprintf("The value of %s is not known until the build runs", name))
+			return 1
+		}
+		b, err := ctyjson.Marshal(val, val.Type())
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to encode the value of %s: %s", name, err))
+			return 1
+		}
+		out[name] = b
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to encode the values: %s", err))
+		return 1
+	}
+	c.Ui.Message(string(b))
+	return 0
+}
+
 func (c *ConsoleCommand) modeInteractive(cfg packer.Evaluator) int {
 	// Setup the UI so we can output directly to stdout
 	l, err := readline.NewEx(wrappedreadline.Override(&readline.Config{
@@ -52,3 +52,41 @@ func Test_console(t *testing.T) {
 		})
 	}
 }
+
+func Test_console_file(t *testing.T) {
+	hclTemplate := filepath.Join(testFixture("var-arg"), "fruit_builder.pkr.hcl")
+	jsonTemplate := filepath.Join(testFixture("var-arg"), "fruit_builder.json")
+
+	tc := []struct {
+		name     string
+		command  []string
+		expected string
+		wantErr  bool
+	}{
+		{"hcl2 template", []string{"console", "-var=fruit=potato", "-file", testFixture("console", "exprs.hcl"), hclTemplate},
+			"fruit = POTATO\nfruit_count = 6\nfruits = [\n  \"potato\",\n  \"apple\",\n]\n", false},
+		{"hcl2 template with json", []string{"console", "-var=fruit=potato", "-file", testFixture("console", "exprs.hcl"), "-json", hclTemplate},
+			"{\n  \"fruit\": \"POTATO\",\n  \"fruit_count\": 6,\n  \"fruits\": [\n    \"potato\",\n    \"apple\"\n  ]\n}\n", false},
+		{"json template with json", []string{"console", "-var=fruit=potato", "-file", testFixture("console", "legacy.hcl"), "-json", jsonTemplate},
+			"{\n  \"fruit\": \"potato\"\n}\n", false},
+		{"invalid expression", []string{"console", "-var=fruit=potato", "-file", testFixture("console", "invalid.hcl"), "-json", hclTemplate},
+			`This object does not have an attribute named "vegetable".`, true},
+		{"json without file", []string{"console", "-json", hclTemplate}, "-json can only be used with -file", true},
+	}
+
+	for _, tc := range tc {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			p := helperCommand(t, tc.command...)
+			bs, err := p.Output()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v: %s", err, bs)
+			}
+			if tc.wantErr {
+				assert.Contains(t, string(bs), tc.expected)
+				return
+			}
+			assert.Equal(t, tc.expected, string(bs))
+		})
+	}
+}
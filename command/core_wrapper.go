@@ -1,16 +1,24 @@
 package command
 
 import (
+	"context"
+
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/packer/hcl2template"
 	packerregistry "github.com/hashicorp/packer/internal/registry"
 	"github.com/hashicorp/packer/packer"
 	plugingetter "github.com/hashicorp/packer/packer/plugin-getter"
+	"github.com/zclconf/go-cty/cty"
 )
 
 // CoreWrapper wraps a packer.Core in order to have it's Initialize func return
 // a diagnostic.
 type CoreWrapper struct {
 	*packer.Core
+
+	// varFiles are the var files of the template, see SnapshotTemplate.
+	varFiles []string
 }
 
 func (c *CoreWrapper) Initialize(_ packer.InitializeOptions) hcl.Diagnostics {
@@ -36,6 +44,68 @@ func (c *CoreWrapper) PluginRequirements() (plugingetter.Requirements, hcl.Diagn
 	}
 }
 
+// FetchAssets does nothing, assets can only be declared in HCL2 templates.
+func (c *CoreWrapper) FetchAssets(_ context.Context, _ packer.FetchAssetsOptions) hcl.Diagnostics {
+	return nil
+}
+
+// StartHTTPServers does nothing, HTTP servers can only be declared in HCL2
+// templates.
+func (c *CoreWrapper) StartHTTPServers(_ context.Context, _ packer.StartHTTPServersOptions) hcl.Diagnostics {
+	return nil
+}
+
+// ScanSecrets does nothing, secrets are only looked for in HCL2 templates.
+func (c *CoreWrapper) ScanSecrets() hcl.Diagnostics {
+	return nil
+}
+
+// SnapshotTemplate returns a copy of the template and of its var files, and
+// the values of its user variables, the sensitive ones redacted.
+func (c *CoreWrapper) SnapshotTemplate() (*packer.TemplateSnapshot, hcl.Diagnostics) {
+	snapshot, err := c.Core.SnapshotTemplate(c.varFiles)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			&hcl.Diagnostic{
+				Summary:  "Failed to snapshot the template",
+				Detail:   err.Error(),
+				Severity: hcl.DiagError,
+			},
+		}
+	}
+	return snapshot, nil
+}
+
+// EvaluateExpressionsFile renders the expressions of the HCL, or JSON, file at
+// path like EvaluateExpression does. The expressions are strings, like
+// "{{user `+"`"+`region`+"`"+`}}".
+func (c *CoreWrapper) EvaluateExpressionsFile(path string) (map[string]cty.Value, hcl.Diagnostics) {
+	attrs, diags := hcl2template.ParseExpressionsFile(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	values := map[string]cty.Value{}
+	for name, attr := range attrs {
+		var expr string
+		moreDiags := gohcl.DecodeExpression(attr.Expr, nil, &expr)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		rendered, _, moreDiags := c.Core.EvaluateExpression(expr)
+		diags = append(diags, moreDiags...)
+		values[name] = cty.StringVal(rendered)
+	}
+	return values, diags
+}
+
+// InvalidVariables returns false, the variable errors of JSON templates are
+// template errors.
+func (c *CoreWrapper) InvalidVariables() bool {
+	return false
+}
+
 // ConfiguredArtifactMetadataPublisher returns a configured image bucket that can be used for publishing
 // build image artifacts to a configured Packer Registry destination.
 func (c *CoreWrapper) ConfiguredArtifactMetadataPublisher() (*packerregistry.Bucket, hcl.Diagnostics) {
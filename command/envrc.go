@@ -0,0 +1,47 @@
+package command
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hashicorp/packer/internal/envlock"
+	"github.com/hashicorp/packer/version"
+	"github.com/mitchellh/cli"
+)
+
+type EnvrcCommand struct {
+	Meta
+}
+
+func (c *EnvrcCommand) Synopsis() string {
+	return "Record and verify the environment of a build"
+}
+
+func (c *EnvrcCommand) Help() string {
+	helpText := `
+Usage: packer envrc <subcommand> [options] [args]
+  This command groups subcommands for recording the environment Packer runs in
+  (Packer version, installed plugins, OS, architecture and PACKER_* and
+  HCP_PACKER_* environment variables) into a packer.envrc.lock file, and for
+  verifying that the current environment matches a recorded one.
+
+Related but not under the "envrc" command :
+
+- "packer build -envrc-lock=<path>" will record the environment of a build.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvrcCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// captureEnvLock records the environment Packer is currently running in.
+func (m *Meta) captureEnvLock() (*envlock.Lock, error) {
+	return envlock.Capture(envlock.CaptureOptions{
+		PackerVersion: version.FormattedVersion(),
+		PluginFolders: m.CoreConfig.Components.PluginConfig.KnownPluginFolders,
+		Environ:       os.Environ(),
+	})
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type EnvrcCaptureCommand struct {
+	Meta
+}
+
+func (c *EnvrcCaptureCommand) Synopsis() string {
+	return "Record the current environment into a lock file"
+}
+
+func (c *EnvrcCaptureCommand) Help() string {
+	helpText := `
+Usage: packer envrc capture [options]
+
+  This command records the current Packer version, the checksums of every
+  installed plugin, the OS and architecture and the PACKER_* and HCP_PACKER_*
+  environment variables into a lock file. Variables whose name looks sensitive
+  (containing SECRET, TOKEN, PASSWORD or KEY) are never recorded.
+
+  Use "packer envrc verify" to check that a later environment matches.
+
+Options:
+
+  -output=packer.envrc.lock     Path of the lock file to write.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvrcCaptureCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *EnvrcCaptureCommand) ParseArgs(args []string) (*EnvrcCaptureArgs, int) {
+	var cfg EnvrcCaptureArgs
+	flags := c.Meta.FlagSet("envrc capture", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *EnvrcCaptureCommand) RunContext(_ context.Context, cla *EnvrcCaptureArgs) int {
+	lock, err := c.captureEnvLock()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to capture the environment: %s", err))
+		return 1
+	}
+
+	if err := lock.Write(cla.Output); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to write %q: %s", cla.Output, err))
+		return 1
+	}
+
+	c.Ui.Say(fmt.Sprintf("Environment recorded in %s", cla.Output))
+	return 0
+}
+
+func (*EnvrcCaptureCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*EnvrcCaptureCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-output": complete.PredictFiles("*"),
+	}
+}
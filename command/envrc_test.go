@@ -0,0 +1,34 @@
+package command
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvrc_CaptureVerify(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", "/tmp/cache")
+	lockPath := filepath.Join(t.TempDir(), "packer.envrc.lock")
+
+	capture := &EnvrcCaptureCommand{Meta: testMeta(t)}
+	if code := capture.Run([]string{"-output", lockPath}); code != 0 {
+		out, stderr := outputCommand(t, capture.Meta)
+		t.Fatalf("capture: bad exit code %d\nstdout:\n%s\nstderr:\n%s", code, out, stderr)
+	}
+
+	verify := &EnvrcVerifyCommand{Meta: testMeta(t)}
+	if code := verify.Run([]string{lockPath}); code != 0 {
+		out, stderr := outputCommand(t, verify.Meta)
+		t.Fatalf("verify: bad exit code %d\nstdout:\n%s\nstderr:\n%s", code, out, stderr)
+	}
+
+	t.Setenv("PACKER_CACHE_DIR", "/var/cache")
+	verify = &EnvrcVerifyCommand{Meta: testMeta(t)}
+	if code := verify.Run([]string{lockPath}); code != 1 {
+		t.Fatalf("verify: expected a changed environment to fail, got exit code %d", code)
+	}
+	_, stderr := outputCommand(t, verify.Meta)
+	if !strings.Contains(stderr, "PACKER_CACHE_DIR") {
+		t.Errorf("expected the changed variable to be reported, got:\n%s", stderr)
+	}
+}
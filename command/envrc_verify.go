@@ -0,0 +1,100 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer/internal/envlock"
+	"github.com/posener/complete"
+)
+
+type EnvrcVerifyCommand struct {
+	Meta
+}
+
+func (c *EnvrcVerifyCommand) Synopsis() string {
+	return "Verify the current environment matches a lock file"
+}
+
+func (c *EnvrcVerifyCommand) Help() string {
+	helpText := `
+Usage: packer envrc verify [<path>]
+
+  This command verifies that the current environment matches the one recorded
+  in a lock file, written by "packer envrc capture" or "packer build
+  -envrc-lock". Every difference is listed and the command exits with a non-zero
+  status if any is found.
+
+  The lock file defaults to packer.envrc.lock in the current directory.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *EnvrcVerifyCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *EnvrcVerifyCommand) ParseArgs(args []string) (*EnvrcVerifyArgs, int) {
+	var cfg EnvrcVerifyArgs
+	flags := c.Meta.FlagSet("envrc verify", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	switch len(args) {
+	case 0:
+		cfg.Path = envlock.DefaultFilename
+	case 1:
+		cfg.Path = args[0]
+	default:
+		flags.Usage()
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *EnvrcVerifyCommand) RunContext(_ context.Context, cla *EnvrcVerifyArgs) int {
+	recorded, err := envlock.Load(cla.Path)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to read %q: %s", cla.Path, err))
+		return 1
+	}
+
+	current, err := c.captureEnvLock()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to capture the environment: %s", err))
+		return 1
+	}
+
+	diffs := recorded.Diff(current)
+	if len(diffs) == 0 {
+		c.Ui.Say(fmt.Sprintf("The current environment matches %s", cla.Path))
+		return 0
+	}
+
+	c.Ui.Error(fmt.Sprintf("The current environment does not match %s:", cla.Path))
+	for _, diff := range diffs {
+		c.Ui.Error(fmt.Sprintf("  * %s", diff))
+	}
+	return 1
+}
+
+func (*EnvrcVerifyCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*.lock")
+}
+
+func (*EnvrcVerifyCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{}
+}
@@ -0,0 +1,197 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/hashicorp/packer/packer"
+	"github.com/posener/complete"
+)
+
+type GCCommand struct {
+	Meta
+}
+
+func (c *GCCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *GCCommand) ParseArgs(args []string) (*GCArgs, int) {
+	var cfg GCArgs
+	flags := c.Meta.FlagSet("gc", FlagSetBuildFilter|FlagSetVars)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Path = args[0]
+
+	if cfg.KeepImages < 0 {
+		c.Ui.Error("-keep-images must be a positive number")
+		return &cfg, 1
+	}
+	if cfg.MinAge < 0 {
+		c.Ui.Error("-min-age must be a positive duration")
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+// collected are the orphans of a build to destroy.
+type collected struct {
+	build     string
+	collector packer.Collector
+	orphans   []packer.Orphan
+}
+
+func (c *GCCommand) RunContext(ctx context.Context, cla *GCArgs) int {
+	packerStarter, ret := c.GetConfig(&cla.MetaArgs)
+	if ret != 0 {
+		return ret
+	}
+
+	diags := packerStarter.Initialize(packer.InitializeOptions{})
+	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		return ret
+	}
+
+	builds, diags := packerStarter.GetBuilds(packer.GetBuildsOptions{
+		Only:   cla.Only,
+		Except: cla.Except,
+		Tags:   cla.Tags,
+	})
+	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		return ret
+	}
+
+	verb := "Destroying"
+	if cla.DryRun {
+		verb = "Would destroy"
+	}
+	now := time.Now()
+	var garbage []collected
+	count := 0
+	for _, b := range builds {
+		cb, ok := b.(*packer.CoreBuild)
+		if !ok {
+			continue
+		}
+		collector, ok := cb.Collector()
+		if !ok {
+			c.Ui.Say(fmt.Sprintf("Build '%s': its builder cannot list the resources of its previous builds, skipping.", cb.Name()))
+			continue
+		}
+		orphans, err := collector.ListOrphans(ctx, map[string]string{
+			packer.CollectorBuildNameTag: cb.Name(),
+		})
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Build '%s': failed to list the resources of its previous builds: %s", cb.Name(), err))
+			ret = 1
+			continue
+		}
+		selected := packer.SelectGarbage(orphans, now, cla.MinAge, cla.KeepImages)
+		for _, o := range selected {
+			msg := fmt.Sprintf("Build '%s': %s %s %s, created %s ago", cb.Name(), verb, o.Kind, o,
+				durafmt.Parse(now.Sub(o.CreatedAt)).LimitFirstN(2))
+			if run := o.Tags[packer.CollectorRunUUIDTag]; run != "" {
+				msg += " by run " + run
+			}
+			c.Ui.Say(msg)
+		}
+		if len(selected) > 0 {
+			garbage = append(garbage, collected{build: cb.Name(), collector: collector, orphans: selected})
+			count += len(selected)
+		}
+	}
+
+	if count == 0 {
+		c.Ui.Say("Nothing to collect.")
+		return ret
+	}
+	if cla.DryRun {
+		return ret
+	}
+	if err := c.confirm(&cla.ConfirmArgs, fmt.Sprintf("Do you want to destroy these %d resource(s)?", count)); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	for _, g := range garbage {
+		ui := &packer.TargetedUI{Target: g.build, Ui: c.Ui}
+		if err := g.collector.Destroy(ctx, ui, g.orphans); err != nil {
+			ui.Error(fmt.Sprintf("Failed to destroy the resources of its previous builds: %s", err))
+			ret = 1
+			continue
+		}
+		ui.Say(fmt.Sprintf("Destroyed %d resource(s)", len(g.orphans)))
+	}
+	return ret
+}
+
+func (*GCCommand) Help() string {
+	helpText := `
+Usage: packer gc [options] TEMPLATE
+
+  Destroys the resources left behind by the previous builds of the template:
+  the temporary resources of failed builds and, with -keep-images, the images
+  superseded by newer builds. The resources are found, in all the accounts and
+  regions the builders of the template are configured for, by the tags Packer
+  has the builders set when building. Only the builders supporting garbage
+  collection can be collected.
+
+Options:
+
+  -auto-approve                 Destroy the resources without asking for confirmation.
+  -dry-run                      List the resources that would be destroyed without destroying them.
+  -except=foo,bar,baz           Collect all builds other than these.
+  -only=foo,bar,baz             Collect only the specified builds.
+  -tag=foo,bar                  Collect only the builds tagged with all of these.
+  -keep-images=0                Destroy the images of a build but the N newest ones. 0 never destroys images. (Default: 0)
+  -min-age=24h                  Only destroy resources created longer ago than this, leaving running builds alone. (Default: 24h)
+  -var 'key=value'              Variable for templates, can be used multiple times.
+  -var-file=path                JSON or HCL2 file containing user variables.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*GCCommand) Synopsis() string {
+	return "destroy the resources left behind by previous builds"
+}
+
+func (*GCCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*GCCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-auto-approve": complete.PredictNothing,
+		"-dry-run":      complete.PredictNothing,
+		"-except":       complete.PredictNothing,
+		"-only":         complete.PredictNothing,
+		"-tag":          complete.PredictNothing,
+		"-keep-images":  complete.PredictNothing,
+		"-min-age":      complete.PredictNothing,
+		"-var":          complete.PredictNothing,
+		"-var-file":     complete.PredictNothing,
+	}
+}
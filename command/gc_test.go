@@ -0,0 +1,77 @@
+package command
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/builder/file"
+	"github.com/hashicorp/packer/packer"
+)
+
+// collectedBuilder is a file builder whose previous builds left resources
+// behind.
+type collectedBuilder struct {
+	file.Builder
+	orphans   []packer.Orphan
+	filter    map[string]string
+	destroyed []string
+}
+
+func (b *collectedBuilder) SetCollectorTags(map[string]string) {}
+
+func (b *collectedBuilder) ListOrphans(_ context.Context, filter map[string]string) ([]packer.Orphan, error) {
+	b.filter = filter
+	return b.orphans, nil
+}
+
+func (b *collectedBuilder) Destroy(_ context.Context, _ packersdk.Ui, orphans []packer.Orphan) error {
+	for _, o := range orphans {
+		b.destroyed = append(b.destroyed, o.ID)
+	}
+	return nil
+}
+
+func TestGCCommand(t *testing.T) {
+	now := time.Now()
+	orphans := []packer.Orphan{
+		{Kind: packer.OrphanTemporary, Type: "instance", ID: "i-old", CreatedAt: now.Add(-48 * time.Hour)},
+		{Kind: packer.OrphanTemporary, Type: "instance", ID: "i-running", CreatedAt: now.Add(-time.Hour)},
+		{Kind: packer.OrphanImage, Type: "ami", ID: "ami-1", CreatedAt: now.Add(-72 * time.Hour)},
+		{Kind: packer.OrphanImage, Type: "ami", ID: "ami-2", CreatedAt: now.Add(-50 * time.Hour)},
+		{Kind: packer.OrphanImage, Type: "ami", ID: "ami-3", CreatedAt: now.Add(-30 * time.Hour)},
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantDestroyed []string
+	}{
+		{"temporary resources", []string{"-auto-approve"}, []string{"i-old"}},
+		{"superseded images", []string{"-auto-approve", "-keep-images=1"}, []string{"ami-1", "ami-2", "i-old"}},
+		{"dry run", []string{"-dry-run", "-keep-images=1"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &collectedBuilder{orphans: orphans}
+			c := &GCCommand{Meta: TestMetaFile(t)}
+			c.CoreConfig.Components.PluginConfig.Builders.(packer.MapOfBuilder)["collected"] = func() (packersdk.Builder, error) {
+				return builder, nil
+			}
+
+			args := append(tt.args, filepath.Join(testFixture("gc"), "template.pkr.hcl"))
+			if code := c.Run(args); code != 0 {
+				fatalCommand(t, c.Meta)
+			}
+			if want := map[string]string{packer.CollectorBuildNameTag: "collected.app"}; !reflect.DeepEqual(builder.filter, want) {
+				t.Errorf("expected the orphans to be listed with %v, got %v", want, builder.filter)
+			}
+			if !reflect.DeepEqual(builder.destroyed, tt.wantDestroyed) {
+				t.Errorf("expected %v to be destroyed, got %v", tt.wantDestroyed, builder.destroyed)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/mitchellh/cli"
+)
+
+// newRegistryClient returns the client used by the hcp subcommands to talk to
+// the HCP Packer registry. It is a variable so that tests can use a mock
+// service.
+var newRegistryClient = packerregistry.NewClient
+
+type HCPCommand struct {
+	Meta
+}
+
+func (c *HCPCommand) Synopsis() string {
+	return "Interact with the HCP Packer registry"
+}
+
+func (c *HCPCommand) Help() string {
+	helpText := `
+Usage: packer hcp <subcommand> [options] [args]
+  This command groups subcommands for interacting with the HCP Packer registry.
+
+  Authentication requires either the HCP_CLIENT_ID and HCP_CLIENT_SECRET
+  environment variables, or a workload identity provider set with
+  HCP_WORKLOAD_IDENTITY_PROVIDER.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// writeTable prints rows as aligned columns, the first row being the header.
+func (m *Meta) writeTable(rows [][]string) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	m.Ui.Say(strings.TrimRight(b.String(), "\n"))
+}
+
+// formatRegistryTime formats t for the tables of the hcp subcommands, unset
+// dates are shown as "-".
+func formatRegistryTime(t strfmt.DateTime) string {
+	if time.Time(t).IsZero() {
+		return "-"
+	}
+	return time.Time(t).UTC().Format(time.RFC3339)
+}
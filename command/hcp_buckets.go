@@ -0,0 +1,29 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+type HCPBucketsCommand struct {
+	Meta
+}
+
+func (c *HCPBucketsCommand) Synopsis() string {
+	return "Interact with the buckets of the HCP Packer registry"
+}
+
+func (c *HCPBucketsCommand) Help() string {
+	helpText := `
+Usage: packer hcp buckets <subcommand> [options] [args]
+  This command groups subcommands for querying the buckets of the HCP Packer
+  registry.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPBucketsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
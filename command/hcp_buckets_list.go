@@ -0,0 +1,96 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type HCPBucketsListCommand struct {
+	Meta
+}
+
+func (c *HCPBucketsListCommand) Synopsis() string {
+	return "List the buckets of the HCP Packer registry"
+}
+
+func (c *HCPBucketsListCommand) Help() string {
+	helpText := `
+Usage: packer hcp buckets list [options]
+
+  This command lists the buckets of the HCP Packer registry project, along with
+  the version of their latest iteration. With -machine-readable, every bucket is
+  printed as a "bucket" line:
+
+    bucket,<slug>,<latest version>,<iteration count>,<platforms>
+
+Options:
+
+  -machine-readable             Produce machine-readable output.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPBucketsListCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	flags := c.Meta.FlagSet("hcp buckets list", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return 1
+	}
+
+	return c.RunContext(ctx)
+}
+
+func (c *HCPBucketsListCommand) RunContext(ctx context.Context) int {
+	client, err := newRegistryClient()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to connect to the HCP Packer registry: %s", err))
+		return 1
+	}
+
+	buckets, err := client.ListBuckets(ctx)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to list the buckets: %s", err))
+		return 1
+	}
+
+	if len(buckets) == 0 {
+		c.Ui.Say("No bucket found.")
+		return 0
+	}
+
+	rows := [][]string{{"SLUG", "LATEST VERSION", "ITERATIONS", "PLATFORMS", "UPDATED"}}
+	for _, bucket := range buckets {
+		latest := strconv.Itoa(int(bucket.LatestVersion))
+		platforms := strings.Join(bucket.Platforms, ",")
+		c.Ui.Machine("bucket", bucket.Slug, latest, bucket.IterationCount, platforms)
+		if platforms == "" {
+			platforms = "-"
+		}
+		rows = append(rows, []string{bucket.Slug, latest, bucket.IterationCount, platforms, formatRegistryTime(bucket.UpdatedAt)})
+	}
+	c.writeTable(rows)
+
+	return 0
+}
+
+func (*HCPBucketsListCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*HCPBucketsListCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-machine-readable": complete.PredictNothing,
+	}
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+type HCPChannelsCommand struct {
+	Meta
+}
+
+func (c *HCPChannelsCommand) Synopsis() string {
+	return "Interact with the channels of an HCP Packer registry bucket"
+}
+
+func (c *HCPChannelsCommand) Help() string {
+	helpText := `
+Usage: packer hcp channels <subcommand> [options] [args]
+  This command groups subcommands for querying the channels of a bucket of the
+  HCP Packer registry.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPChannelsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+type HCPChannelsListCommand struct {
+	Meta
+}
+
+func (c *HCPChannelsListCommand) Synopsis() string {
+	return "List the channels of an HCP Packer registry bucket"
+}
+
+func (c *HCPChannelsListCommand) Help() string {
+	helpText := `
+Usage: packer hcp channels list [options] <bucket>
+
+  This command lists the channels of a bucket of the HCP Packer registry, along
+  with the iteration each of them points to. With -machine-readable, every
+  channel is printed as a "channel" line:
+
+    channel,<slug>,<iteration id>,<iteration version>
+
+Options:
+
+  -machine-readable             Produce machine-readable output.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPChannelsListCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	flags := c.Meta.FlagSet("hcp channels list", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(flags.Args()) != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	return c.RunContext(ctx, flags.Arg(0))
+}
+
+func (c *HCPChannelsListCommand) RunContext(ctx context.Context, bucket string) int {
+	client, err := newRegistryClient()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to connect to the HCP Packer registry: %s", err))
+		return 1
+	}
+
+	channels, err := client.ListChannels(ctx, bucket)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to list the channels of %q: %s", bucket, err))
+		return 1
+	}
+
+	if len(channels) == 0 {
+		c.Ui.Say(fmt.Sprintf("No channel found in %q.", bucket))
+		return 0
+	}
+
+	rows := [][]string{{"SLUG", "ITERATION", "VERSION", "UPDATED"}}
+	for _, channel := range channels {
+		iterationID, version := "", ""
+		if channel.Iteration != nil {
+			iterationID = channel.Iteration.ID
+			version = strconv.Itoa(int(channel.Iteration.IncrementalVersion))
+		}
+		c.Ui.Machine("channel", channel.Slug, iterationID, version)
+		if iterationID == "" {
+			iterationID, version = "-", "-"
+		}
+		rows = append(rows, []string{channel.Slug, iterationID, version, formatRegistryTime(channel.UpdatedAt)})
+	}
+	c.writeTable(rows)
+
+	return 0
+}
+
+func (*HCPChannelsListCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*HCPChannelsListCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-machine-readable": complete.PredictNothing,
+	}
+}
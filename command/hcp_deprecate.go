@@ -0,0 +1,139 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/posener/complete"
+)
+
+type HCPDeprecateCommand struct {
+	Meta
+}
+
+func (c *HCPDeprecateCommand) Synopsis() string {
+	return "Deprecate iterations superseded by a more recent one"
+}
+
+func (c *HCPDeprecateCommand) Help() string {
+	helpText := `
+Usage: packer hcp deprecate [options] <bucket> [<iteration-id>]
+
+  This command revokes every complete iteration of a bucket that is older than
+  the given iteration, so that consumers can no longer be pointed at their
+  images. When no iteration is given, the most recent complete iteration of the
+  bucket is used. Iterations already revoked, or scheduled for revocation, are
+  left untouched.
+
+Options:
+
+  -auto-approve                 Deprecate the iterations without asking for confirmation.
+  -dry-run                      List the iterations that would be deprecated without changing anything.
+  -keep=0                       Number of superseded iterations to keep, most recent first.
+  -message="..."                Reason of the deprecation, recorded as the revocation message.
+  -revoke-in=0s                 Delay after which the deprecated iterations are revoked, for example "30d".
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPDeprecateCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *HCPDeprecateCommand) ParseArgs(args []string) (*HCPDeprecateArgs, int) {
+	var cfg HCPDeprecateArgs
+	flags := c.Meta.FlagSet("hcp deprecate", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) < 1 || len(args) > 2 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Bucket = args[0]
+	if len(args) == 2 {
+		cfg.IterationID = args[1]
+	}
+
+	if cfg.Keep < 0 {
+		c.Ui.Error("-keep must be a positive number")
+		return &cfg, 1
+	}
+
+	return &cfg, 0
+}
+
+func (c *HCPDeprecateCommand) RunContext(ctx context.Context, cla *HCPDeprecateArgs) int {
+	client, err := newRegistryClient()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to connect to the HCP Packer registry: %s", err))
+		return 1
+	}
+
+	deprecated, err := client.DeprecatePreviousIterations(ctx, cla.Bucket, packerregistry.DeprecateOptions{
+		IterationID: cla.IterationID,
+		Keep:        cla.Keep,
+		RevokeIn:    cla.RevokeIn,
+		Message:     cla.Message,
+		DryRun:      cla.DryRun,
+		Confirm: func(iterations []*models.HashicorpCloudPackerIterationforList) error {
+			ids := make([]string, 0, len(iterations))
+			for _, iteration := range iterations {
+				ids = append(ids, iteration.ID)
+			}
+			return c.confirm(&cla.ConfirmArgs, fmt.Sprintf(
+				"Do you want to deprecate %d iteration(s) of %q?\n  %s",
+				len(iterations), cla.Bucket, strings.Join(ids, ", ")))
+		},
+	})
+
+	verb := "Deprecated"
+	if cla.DryRun {
+		verb = "Would deprecate"
+	}
+	for _, iteration := range deprecated {
+		c.Ui.Say(fmt.Sprintf("%s iteration %s (version %d, fingerprint %s)",
+			verb, iteration.ID, iteration.IncrementalVersion, iteration.Fingerprint))
+	}
+
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if len(deprecated) == 0 {
+		c.Ui.Say(fmt.Sprintf("No iteration of %q needs to be deprecated.", cla.Bucket))
+	}
+
+	return 0
+}
+
+func (*HCPDeprecateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*HCPDeprecateCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-auto-approve": complete.PredictNothing,
+		"-dry-run":      complete.PredictNothing,
+		"-keep":         complete.PredictNothing,
+		"-message":      complete.PredictNothing,
+		"-revoke-in":    complete.PredictNothing,
+	}
+}
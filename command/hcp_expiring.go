@@ -0,0 +1,117 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/posener/complete"
+)
+
+type HCPExpiringCommand struct {
+	Meta
+}
+
+func (c *HCPExpiringCommand) Synopsis() string {
+	return "List the iterations expiring soon"
+}
+
+func (c *HCPExpiringCommand) Help() string {
+	helpText := `
+Usage: packer hcp expiring [options] [<bucket>...]
+
+  This command lists the complete iterations of the given buckets, or of all the
+  buckets of the HCP Packer registry project, that expire soon or already
+  expired, soonest first. The expiry of an iteration is recorded when it is
+  built, from the expires_after setting of the hcp_packer_registry block.
+  Revoked iterations are not listed. With -machine-readable, every iteration is
+  printed as an "expiring-iteration" line:
+
+    expiring-iteration,<bucket>,<id>,<version>,<expires at>
+
+Options:
+
+  -machine-readable             Produce machine-readable output.
+  -within=168h                  List the iterations expiring within this duration.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPExpiringCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *HCPExpiringCommand) ParseArgs(args []string) (*HCPExpiringArgs, int) {
+	var cfg HCPExpiringArgs
+	flags := c.Meta.FlagSet("hcp expiring", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+	cfg.Buckets = flags.Args()
+
+	if cfg.Within < 0 {
+		c.Ui.Error("-within must be a positive duration")
+		return &cfg, 1
+	}
+
+	return &cfg, 0
+}
+
+func (c *HCPExpiringCommand) RunContext(ctx context.Context, cla *HCPExpiringArgs) int {
+	client, err := newRegistryClient()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to connect to the HCP Packer registry: %s", err))
+		return 1
+	}
+
+	now := time.Now()
+	iterations, err := client.ExpiringIterations(ctx, cla.Buckets, cla.Within, now)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to list the expiring iterations: %s", err))
+		return 1
+	}
+
+	if len(iterations) == 0 {
+		c.Ui.Say(fmt.Sprintf("No iteration expiring within %s.", cla.Within))
+		return 0
+	}
+
+	rows := [][]string{{"BUCKET", "ITERATION", "VERSION", "EXPIRES AT", "STATUS"}}
+	for _, iteration := range iterations {
+		version := strconv.Itoa(int(iteration.IncrementalVersion))
+		expiresAt := iteration.ExpiresAt.UTC().Format(time.RFC3339)
+		status := "expiring"
+		if !iteration.ExpiresAt.After(now) {
+			status = "expired"
+		}
+		c.Ui.Machine("expiring-iteration", iteration.BucketSlug, iteration.IterationID, version, expiresAt)
+		rows = append(rows, []string{iteration.BucketSlug, iteration.IterationID, version, expiresAt, status})
+	}
+	c.writeTable(rows)
+
+	return 0
+}
+
+func (*HCPExpiringCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*HCPExpiringCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-machine-readable": complete.PredictNothing,
+		"-within":           complete.PredictNothing,
+	}
+}
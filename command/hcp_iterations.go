@@ -0,0 +1,29 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+type HCPIterationsCommand struct {
+	Meta
+}
+
+func (c *HCPIterationsCommand) Synopsis() string {
+	return "Interact with the iterations of an HCP Packer registry bucket"
+}
+
+func (c *HCPIterationsCommand) Help() string {
+	helpText := `
+Usage: packer hcp iterations <subcommand> [options] [args]
+  This command groups subcommands for querying the iterations of a bucket of the
+  HCP Packer registry.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPIterationsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/posener/complete"
+)
+
+type HCPIterationsListCommand struct {
+	Meta
+}
+
+func (c *HCPIterationsListCommand) Synopsis() string {
+	return "List the iterations of an HCP Packer registry bucket"
+}
+
+func (c *HCPIterationsListCommand) Help() string {
+	helpText := `
+Usage: packer hcp iterations list [options] <bucket>
+
+  This command lists the iterations of a bucket of the HCP Packer registry,
+  most recent first. With -machine-readable, every iteration is printed as an
+  "iteration" line:
+
+    iteration,<id>,<version>,<fingerprint>,<complete>,<revoke at>
+
+Options:
+
+  -machine-readable             Produce machine-readable output.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPIterationsListCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	flags := c.Meta.FlagSet("hcp iterations list", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(flags.Args()) != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	return c.RunContext(ctx, flags.Arg(0))
+}
+
+func (c *HCPIterationsListCommand) RunContext(ctx context.Context, bucket string) int {
+	client, err := newRegistryClient()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to connect to the HCP Packer registry: %s", err))
+		return 1
+	}
+
+	iterations, err := client.ListIterations(ctx, bucket)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to list the iterations of %q: %s", bucket, err))
+		return 1
+	}
+
+	if len(iterations) == 0 {
+		c.Ui.Say(fmt.Sprintf("No iteration found in %q.", bucket))
+		return 0
+	}
+
+	sort.SliceStable(iterations, func(i, j int) bool {
+		return iterations[i].IncrementalVersion > iterations[j].IncrementalVersion
+	})
+
+	rows := [][]string{{"ID", "VERSION", "FINGERPRINT", "COMPLETE", "REVOKE AT", "CREATED"}}
+	for _, iteration := range iterations {
+		version := strconv.Itoa(int(iteration.IncrementalVersion))
+		isComplete := strconv.FormatBool(iteration.Complete)
+		revokeAt := formatRegistryTime(iteration.RevokeAt)
+		machineRevokeAt := ""
+		if !time.Time(iteration.RevokeAt).IsZero() {
+			machineRevokeAt = revokeAt
+		}
+		c.Ui.Machine("iteration", iteration.ID, version, iteration.Fingerprint, isComplete, machineRevokeAt)
+		rows = append(rows, []string{iteration.ID, version, iteration.Fingerprint, isComplete, revokeAt, formatRegistryTime(iteration.CreatedAt)})
+	}
+	c.writeTable(rows)
+
+	return 0
+}
+
+func (*HCPIterationsListCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*HCPIterationsListCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-machine-readable": complete.PredictNothing,
+	}
+}
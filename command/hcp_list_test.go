@@ -0,0 +1,111 @@
+package command
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func useMockRegistry(t *testing.T, svc *registrytest.MockPackerClientService) {
+	t.Helper()
+	old := newRegistryClient
+	newRegistryClient = func() (*packerregistry.Client, error) {
+		return &packerregistry.Client{Packer: svc}, nil
+	}
+	t.Cleanup(func() { newRegistryClient = old })
+}
+
+func TestHCPList(t *testing.T) {
+	svc := registrytest.NewMockPackerClientService()
+	svc.ExistingBuckets = []*models.HashicorpCloudPackerBucket{
+		{Slug: "ubuntu", LatestVersion: 3, IterationCount: "3", Platforms: []string{"aws", "azure"}},
+		{Slug: "windows", LatestVersion: 1, IterationCount: "1"},
+	}
+	svc.ExistingIterations = []*models.HashicorpCloudPackerIterationforList{
+		{ID: "iteration-1", IncrementalVersion: 1, Fingerprint: "aaa", Complete: true},
+		{ID: "iteration-3", IncrementalVersion: 3, Fingerprint: "ccc"},
+		{ID: "iteration-2", IncrementalVersion: 2, Fingerprint: "bbb", Complete: true},
+	}
+	svc.ExistingChannels = []*models.HashicorpCloudPackerChannel{
+		{Slug: "production", Iteration: &models.HashicorpCloudPackerIteration{ID: "iteration-2", IncrementalVersion: 2}},
+		{Slug: "staging"},
+	}
+	svc.ExistingBuilds = []string{"happycloud.image"}
+	svc.ExistingIterationLabels = map[string]map[string]string{
+		"iteration-1": {packerregistry.ExpiresAtLabel: "2020-01-01T00:00:00Z"},
+		"iteration-2": {packerregistry.ExpiresAtLabel: "2999-01-01T00:00:00Z"},
+	}
+	useMockRegistry(t, svc)
+
+	tests := []struct {
+		name     string
+		run      func(m Meta) int
+		expected []string
+	}{
+		{
+			name: "buckets",
+			run:  func(m Meta) int { return (&HCPBucketsListCommand{Meta: m}).RunContext(context.Background()) },
+			expected: []string{
+				"SLUG     LATEST VERSION  ITERATIONS  PLATFORMS  UPDATED",
+				"ubuntu   3               3           aws,azure  -",
+				"windows  1               1           -          -",
+			},
+		},
+		{
+			name: "iterations",
+			run: func(m Meta) int {
+				return (&HCPIterationsListCommand{Meta: m}).RunContext(context.Background(), "ubuntu")
+			},
+			expected: []string{
+				"ID           VERSION  FINGERPRINT  COMPLETE  REVOKE AT  CREATED",
+				"iteration-3  3        ccc          false     -          -",
+				"iteration-2  2        bbb          true      -          -",
+				"iteration-1  1        aaa          true      -          -",
+			},
+		},
+		{
+			name: "channels",
+			run: func(m Meta) int {
+				return (&HCPChannelsListCommand{Meta: m}).RunContext(context.Background(), "ubuntu")
+			},
+			expected: []string{
+				"SLUG        ITERATION    VERSION  UPDATED",
+				"production  iteration-2  2        -",
+				"staging     -            -        -",
+			},
+		},
+		{
+			name: "expiring",
+			run: func(m Meta) int {
+				args := &HCPExpiringArgs{Buckets: []string{"ubuntu"}, Within: 7 * 24 * time.Hour}
+				return (&HCPExpiringCommand{Meta: m}).RunContext(context.Background(), args)
+			},
+			expected: []string{
+				"BUCKET  ITERATION    VERSION  EXPIRES AT            STATUS",
+				"ubuntu  iteration-1  1        2020-01-01T00:00:00Z  expired",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMeta(t)
+			if code := tt.run(m); code != 0 {
+				_, stderr := outputCommand(t, m)
+				t.Fatalf("unexpected exit code %d: %s", code, stderr)
+			}
+			stdout, _ := outputCommand(t, m)
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+				lines = append(lines, strings.TrimRight(line, " "))
+			}
+			if got := strings.Join(lines, "\n"); got != strings.Join(tt.expected, "\n") {
+				t.Errorf("unexpected output:\n%s\nexpected:\n%s", got, strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/posener/complete"
+)
+
+type HCPPromoteCommand struct {
+	Meta
+}
+
+func (c *HCPPromoteCommand) Synopsis() string {
+	return "Promote an iteration to a channel"
+}
+
+func (c *HCPPromoteCommand) Help() string {
+	helpText := `
+Usage: packer hcp promote [options] <bucket> <iteration-id> <channel>
+
+  This command points a channel of a bucket to the given iteration, so that
+  consumers of the channel get the images of this iteration. The channel is
+  created when it does not exist yet. Only complete iterations that are not
+  revoked can be promoted.
+
+  When the channel points to another iteration, a confirmation is asked before
+  reassigning it.
+
+Options:
+
+  -auto-approve                 Reassign the channel without asking for confirmation.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *HCPPromoteCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *HCPPromoteCommand) ParseArgs(args []string) (*HCPPromoteArgs, int) {
+	var cfg HCPPromoteArgs
+	flags := c.Meta.FlagSet("hcp promote", 0)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Bucket, cfg.IterationID, cfg.Channel = args[0], args[1], args[2]
+
+	return &cfg, 0
+}
+
+func (c *HCPPromoteCommand) RunContext(ctx context.Context, cla *HCPPromoteArgs) int {
+	client, err := newRegistryClient()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to connect to the HCP Packer registry: %s", err))
+		return 1
+	}
+
+	previous, err := client.PromoteIteration(ctx, cla.Bucket, cla.IterationID, cla.Channel, packerregistry.PromoteOptions{
+		Confirm: func(channel *models.HashicorpCloudPackerChannel) error {
+			current := "no iteration"
+			if channel.Iteration != nil {
+				current = fmt.Sprintf("iteration %s (version %d)", channel.Iteration.ID, channel.Iteration.IncrementalVersion)
+			}
+			return c.confirm(&cla.ConfirmArgs, fmt.Sprintf(
+				"The channel %q of %q points to %s. Do you want to reassign it to iteration %s?",
+				cla.Channel, cla.Bucket, current, cla.IterationID))
+		},
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	switch {
+	case previous == nil:
+		c.Ui.Say(fmt.Sprintf("Created channel %q of %q for iteration %s.", cla.Channel, cla.Bucket, cla.IterationID))
+	case previous.Iteration != nil && previous.Iteration.ID == cla.IterationID:
+		c.Ui.Say(fmt.Sprintf("The channel %q of %q already points to iteration %s.", cla.Channel, cla.Bucket, cla.IterationID))
+	default:
+		c.Ui.Say(fmt.Sprintf("Promoted iteration %s to the channel %q of %q.", cla.IterationID, cla.Channel, cla.Bucket))
+	}
+
+	return 0
+}
+
+func (*HCPPromoteCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*HCPPromoteCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-auto-approve": complete.PredictNothing,
+	}
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestHCPPromote(t *testing.T) {
+	svc := registrytest.NewMockPackerClientService()
+	svc.ExistingIterations = []*models.HashicorpCloudPackerIterationforList{
+		{ID: "iteration-1", IncrementalVersion: 1, Complete: true},
+		{ID: "iteration-2", IncrementalVersion: 2, Complete: true},
+	}
+	svc.ExistingChannels = []*models.HashicorpCloudPackerChannel{
+		{Slug: "production", Iteration: &models.HashicorpCloudPackerIteration{ID: "iteration-1", IncrementalVersion: 1}},
+	}
+	useMockRegistry(t, svc)
+
+	promote := func(args ...string) (int, string, string) {
+		m := testMeta(t)
+		c := &HCPPromoteCommand{Meta: m}
+		cfg, ret := c.ParseArgs(args)
+		if ret != 0 {
+			t.Fatalf("failed to parse %v", args)
+		}
+		code := c.RunContext(context.Background(), cfg)
+		stdout, stderr := outputCommand(t, m)
+		return code, stdout, stderr
+	}
+
+	// Without a TTY nor -auto-approve, reassigning a channel is refused.
+	if code, _, stderr := promote("ubuntu", "iteration-2", "production"); code != 1 || !strings.Contains(stderr, "-auto-approve") {
+		t.Fatalf("expected the reassignment to be refused, got %d: %s", code, stderr)
+	}
+	if svc.UpdateChannelCalled {
+		t.Fatalf("didn't expect the channel to be updated")
+	}
+
+	if code, stdout, stderr := promote("-auto-approve", "ubuntu", "iteration-2", "production"); code != 0 || !strings.Contains(stdout, "Promoted iteration iteration-2") {
+		t.Fatalf("unexpected result %d: %s%s", code, stdout, stderr)
+	}
+
+	// Creating a channel is not destructive and needs no confirmation.
+	if code, stdout, stderr := promote("ubuntu", "iteration-1", "staging"); code != 0 || !strings.Contains(stdout, "Created channel") {
+		t.Fatalf("unexpected result %d: %s%s", code, stdout, stderr)
+	}
+}
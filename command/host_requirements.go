@@ -0,0 +1,30 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// checkHostRequirements returns an error diagnostic for each host requirement
+// of the builds, see packer.CoreBuild.HostRequirements, this machine does not
+// meet.
+func checkHostRequirements(builds []packersdk.Build) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, b := range builds {
+		cb, ok := b.(*packer.CoreBuild)
+		if !ok {
+			continue
+		}
+		for _, err := range cb.CheckHost(packer.LocalHost) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Build '%s' cannot run on this machine", cb.Name()),
+				Detail:   err.Error(),
+			})
+		}
+	}
+	return diags
+}
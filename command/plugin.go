@@ -24,13 +24,16 @@ import (
 	manifestpostprocessor "github.com/hashicorp/packer/post-processor/manifest"
 	shelllocalpostprocessor "github.com/hashicorp/packer/post-processor/shell-local"
 	breakpointprovisioner "github.com/hashicorp/packer/provisioner/breakpoint"
+	cloudinitfinalizeprovisioner "github.com/hashicorp/packer/provisioner/cloud-init-finalize"
 	fileprovisioner "github.com/hashicorp/packer/provisioner/file"
+	packagesprovisioner "github.com/hashicorp/packer/provisioner/packages"
 	powershellprovisioner "github.com/hashicorp/packer/provisioner/powershell"
 	shellprovisioner "github.com/hashicorp/packer/provisioner/shell"
 	shelllocalprovisioner "github.com/hashicorp/packer/provisioner/shell-local"
 	sleepprovisioner "github.com/hashicorp/packer/provisioner/sleep"
 	windowsrestartprovisioner "github.com/hashicorp/packer/provisioner/windows-restart"
 	windowsshellprovisioner "github.com/hashicorp/packer/provisioner/windows-shell"
+	windowssysprepprovisioner "github.com/hashicorp/packer/provisioner/windows-sysprep"
 )
 
 type PluginCommand struct {
@@ -43,14 +46,17 @@ var Builders = map[string]packersdk.Builder{
 }
 
 var Provisioners = map[string]packersdk.Provisioner{
-	"breakpoint":      new(breakpointprovisioner.Provisioner),
-	"file":            new(fileprovisioner.Provisioner),
-	"powershell":      new(powershellprovisioner.Provisioner),
-	"shell":           new(shellprovisioner.Provisioner),
-	"shell-local":     new(shelllocalprovisioner.Provisioner),
-	"sleep":           new(sleepprovisioner.Provisioner),
-	"windows-restart": new(windowsrestartprovisioner.Provisioner),
-	"windows-shell":   new(windowsshellprovisioner.Provisioner),
+	"breakpoint":          new(breakpointprovisioner.Provisioner),
+	"cloud-init-finalize": new(cloudinitfinalizeprovisioner.Provisioner),
+	"file":                new(fileprovisioner.Provisioner),
+	"packages":            new(packagesprovisioner.Provisioner),
+	"powershell":          new(powershellprovisioner.Provisioner),
+	"shell":               new(shellprovisioner.Provisioner),
+	"shell-local":         new(shelllocalprovisioner.Provisioner),
+	"sleep":               new(sleepprovisioner.Provisioner),
+	"windows-restart":     new(windowsrestartprovisioner.Provisioner),
+	"windows-shell":       new(windowsshellprovisioner.Provisioner),
+	"windows-sysprep":     new(windowssysprepprovisioner.Provisioner),
 }
 
 var PostProcessors = map[string]packersdk.PostProcessor{
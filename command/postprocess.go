@@ -0,0 +1,196 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/posener/complete"
+)
+
+type PostProcessCommand struct {
+	Meta
+}
+
+func (c *PostProcessCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *PostProcessCommand) ParseArgs(args []string) (*PostProcessArgs, int) {
+	var cfg PostProcessArgs
+	flags := c.Meta.FlagSet("postprocess", FlagSetBuildFilter|FlagSetVars)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 || args[0] == "-" {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Path = args[0]
+	return &cfg, 0
+}
+
+// postProcessLedger returns the post-process ledger of the template at path,
+// packer.postprocess.json next to the template.
+func postProcessLedger(path string) *packer.PostProcessLedger {
+	return &packer.PostProcessLedger{Path: filepath.Join(templateDir(path), packer.DefaultPostProcessLedgerFilename)}
+}
+
+func (c *PostProcessCommand) RunContext(ctx context.Context, cla *PostProcessArgs) int {
+	ledger := postProcessLedger(cla.Path)
+	names, err := ledger.Builds()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	if len(names) == 0 {
+		c.Ui.Say("No failed post-processors are recorded for this template.")
+		return 0
+	}
+
+	if !cla.Retry {
+		for _, name := range names {
+			failed, err := ledger.Get(name)
+			if err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			ui := &packer.TargetedUI{Target: name, Ui: c.Ui}
+			ui.Machine("failed-post-processors", strings.Trim(fmt.Sprint(failed.Chains), "[]"), failed.Artifact.ID)
+			ui.Say(fmt.Sprintf("%d post-processor chains failed at %s, against the artifact %s: %s",
+				len(failed.Chains), failed.RecordedAt.Format(time.RFC3339), failed.Artifact.Description, failed.Error))
+		}
+		c.Ui.Say("\nRun `packer postprocess -retry` to run them again.")
+		return 0
+	}
+
+	packerStarter, ret := c.GetConfig(&cla.MetaArgs)
+	if ret != 0 {
+		return ret
+	}
+	diags := packerStarter.Initialize(packer.InitializeOptions{})
+	if ret := writeDiags(c.Ui, nil, diags); ret != 0 {
+		return ret
+	}
+	// Publishing to the registry takes the iteration of a whole build run.
+	if publisher, _ := packerStarter.ConfiguredArtifactMetadataPublisher(); publisher != nil {
+		c.Ui.Error("The template publishes to the HCP Packer registry, its post-processors can only run again with `packer build`.")
+		return 1
+	}
+	builds, diags := packerStarter.GetBuilds(packer.GetBuildsOptions{
+		Only:   cla.Only,
+		Except: cla.Except,
+		Tags:   cla.Tags,
+	})
+	if ret := writeDiags(c.Ui, nil, diags); ret != 0 {
+		return ret
+	}
+	if ret := checkLocalExec(c.Ui, c.CoreConfig.LocalExec, builds); ret != 0 {
+		return ret
+	}
+
+	byName := map[string]*packer.CoreBuild{}
+	for _, b := range builds {
+		if cb, ok := b.(*packer.CoreBuild); ok {
+			byName[cb.Name()] = cb
+		}
+	}
+	ret = 0
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			c.Ui.Error("Interrupted, not running the post-processors of the other builds.")
+			return 1
+		}
+		cb, found := byName[name]
+		if !found {
+			c.Ui.Say(fmt.Sprintf("Build '%s' was not selected or is not part of the template anymore, skipping.", name))
+			continue
+		}
+		failed, err := ledger.Get(name)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		cb.PostProcessLedger = ledger
+		artifacts, err := cb.RetryPostProcessors(ctx, c.Ui, failed)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Build '%s' errored: %s", name, err))
+			ret = 1
+		}
+		reportPostProcessArtifacts(c.Ui, name, artifacts)
+	}
+	return ret
+}
+
+// reportPostProcessArtifacts reports the artifacts of the post-processors of
+// the named build that ran again.
+func reportPostProcessArtifacts(ui packersdk.Ui, name string, artifacts []packersdk.Artifact) {
+	ui = &packer.TargetedUI{Target: name, Ui: ui}
+	for i, a := range artifacts {
+		if a == nil {
+			continue
+		}
+		iStr := fmt.Sprint(i)
+		ui.Machine("artifact", iStr, "builder-id", a.BuilderId())
+		ui.Machine("artifact", iStr, "id", a.Id())
+		ui.Machine("artifact", iStr, "string", a.String())
+		ui.Say(fmt.Sprintf("Artifact: %s", a.String()))
+	}
+}
+
+func (*PostProcessCommand) Help() string {
+	helpText := `
+Usage: packer postprocess [options] TEMPLATE
+
+  Lists the post-processor chains of the builds of the template that failed
+  in their last run, recorded along with the artifact of their builder, kept
+  for them. With -retry, runs these chains again against the recorded
+  artifacts, without building them again.
+
+Options:
+
+  -retry                        Run the failed post-processor chains again.
+  -except=foo,bar,baz           Run the failed post-processors of all builds other than these.
+  -only=foo,bar,baz             Run the failed post-processors of the specified builds only.
+  -tag=foo,bar                  Run the failed post-processors of the builds tagged with all of these only.
+  -var 'key=value'              Variable for templates, can be used multiple times.
+  -var-file=path                JSON or HCL2 file containing user variables.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*PostProcessCommand) Synopsis() string {
+	return "run failed post-processors again"
+}
+
+func (*PostProcessCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*PostProcessCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-retry":    complete.PredictNothing,
+		"-except":   complete.PredictNothing,
+		"-only":     complete.PredictNothing,
+		"-tag":      complete.PredictNothing,
+		"-var":      complete.PredictNothing,
+		"-var-file": complete.PredictFiles("*.json"),
+	}
+}
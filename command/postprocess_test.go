@@ -0,0 +1,67 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessCommand_retry(t *testing.T) {
+	dir := t.TempDir()
+	b, err := ioutil.ReadFile(filepath.Join(testFixture("postprocess"), "template.pkr.hcl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := filepath.Join(dir, "template.pkr.hcl")
+	if err := ioutil.WriteFile(template, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(dir, "marker")
+	ledgerPath := filepath.Join(dir, packer.DefaultPostProcessLedgerFilename)
+
+	// The post-processor fails until the marker exists.
+	build := &BuildCommand{Meta: TestMetaFile(t)}
+	if code := build.Run([]string{"-var", "marker=" + marker, template}); code != 1 {
+		out, stderr := outputCommand(t, build.Meta)
+		t.Fatalf("expected the post-processor to fail, got exit code %d:\n%s\n%s", code, out, stderr)
+	}
+	if _, err := os.Stat(ledgerPath); err != nil {
+		t.Fatalf("expected the failed post-processors to be recorded: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "chocolate.txt")); err != nil {
+		t.Fatalf("expected the builder artifact to be kept: %s", err)
+	}
+
+	list := &PostProcessCommand{Meta: TestMetaFile(t)}
+	if code := list.Run([]string{template}); code != 0 {
+		out, stderr := outputCommand(t, list.Meta)
+		t.Fatalf("expected the failed post-processors to be listed, got exit code %d:\n%s\n%s", code, out, stderr)
+	}
+	if out, _ := outputCommand(t, list.Meta); !strings.Contains(out, "1 post-processor chains failed") {
+		t.Errorf("expected the failed chain to be listed, got:\n%s", out)
+	}
+
+	retry := &PostProcessCommand{Meta: TestMetaFile(t)}
+	if code := retry.Run([]string{"-retry", "-var", "marker=" + marker, template}); code != 1 {
+		t.Fatalf("expected the post-processor to fail again, got exit code %d", code)
+	}
+	if _, err := os.Stat(ledgerPath); err != nil {
+		t.Fatalf("expected the post-processors failing again to stay recorded: %s", err)
+	}
+
+	if err := ioutil.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	retry = &PostProcessCommand{Meta: TestMetaFile(t)}
+	if code := retry.Run([]string{"-retry", "-var", "marker=" + marker, template}); code != 0 {
+		out, stderr := outputCommand(t, retry.Meta)
+		t.Fatalf("expected the post-processor to succeed, got exit code %d:\n%s\n%s", code, out, stderr)
+	}
+	if _, err := os.Stat(ledgerPath); !os.IsNotExist(err) {
+		t.Errorf("expected the ledger to be removed once the post-processors succeeded, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer/internal/serve"
+	"github.com/posener/complete"
+)
+
+// serveShutdownTimeout is how long the running builds get to clean up once
+// the server is interrupted.
+const serveShutdownTimeout = 5 * time.Minute
+
+// serveTokenEnvVar sets the token of `packer serve` when -token is not set,
+// keeping it out of the process list.
+const serveTokenEnvVar = "PACKER_SERVE_TOKEN"
+
+type ServeCommand struct {
+	Meta
+}
+
+func (c *ServeCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *ServeCommand) ParseArgs(args []string) (*ServeArgs, int) {
+	var cfg ServeArgs
+	flags := c.Meta.FlagSet("serve", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	if len(flags.Args()) != 0 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	if cfg.MaxConcurrentBuilds < 1 {
+		c.Ui.Error(fmt.Sprintf("The -max-concurrent-builds must be at least 1, got %d.", cfg.MaxConcurrentBuilds))
+		return &cfg, 1
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv(serveTokenEnvVar)
+	}
+	if cfg.Token == "" && !isLoopback(cfg.Address) {
+		c.Ui.Error(fmt.Sprintf("Refusing to listen on %s without authentication: "+
+			"set -token or %s, or listen on a loopback address.", cfg.Address, serveTokenEnvVar))
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+// isLoopback reports whether the host of address only resolves to loopback
+// addresses. An empty host listens on all the interfaces.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *ServeCommand) RunContext(ctx context.Context, cla *ServeArgs) int {
+	root := cla.Templates
+	if root == "" {
+		var err error
+		if root, err = os.Getwd(); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to find the packer executable: %s", err))
+		return 1
+	}
+
+	s := &serve.Server{
+		TemplateRoot:  root,
+		MaxConcurrent: cla.MaxConcurrentBuilds,
+		Token:         cla.Token,
+		Run: func(ctx context.Context, req serve.BuildRequest, w io.Writer) error {
+			return runServedBuild(ctx, exe, req, w)
+		},
+	}
+
+	listener, err := net.Listen("tcp", cla.Address)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to listen on %s: %s", cla.Address, err))
+		return 1
+	}
+	srv := &http.Server{Handler: s.Handler()}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(listener) }()
+	c.Ui.Say(fmt.Sprintf("Serving the builds of the templates in %s on http://%s, %d at a time",
+		root, listener.Addr(), cla.MaxConcurrentBuilds))
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+
+	c.Ui.Say("Shutting down, cancelling the builds")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil {
+		c.Ui.Error(fmt.Sprintf("Some builds did not stop in time: %s", shutdownErr))
+	}
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("[WARN] (serve) failed to stop the HTTP server: %s", shutdownErr)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
+
+// runServedBuild runs `packer build` for req, writing its output to w. The
+// build is interrupted, for it to clean up, when ctx is cancelled.
+func runServedBuild(ctx context.Context, exe string, req serve.BuildRequest, w io.Writer) error {
+	cmd := exec.Command(exe, append([]string{"build", "-color=false"}, req.BuildArgs()...)...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sig := os.Interrupt
+			if runtime.GOOS == "windows" {
+				// Interrupts cannot be sent on Windows.
+				sig = os.Kill
+			}
+			if err := cmd.Process.Signal(sig); err != nil {
+				log.Printf("[WARN] (serve) failed to interrupt build: %s", err)
+			}
+		case <-done:
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("packer build failed: %s", err)
+	}
+	return nil
+}
+
+func (*ServeCommand) Help() string {
+	helpText := `
+Usage: packer serve [options]
+
+  Runs a build server: templates are submitted to its HTTP API, their builds
+  are queued and run with a concurrency limit, and their status and logs can
+  be queried while they run. Without a token, the server only listens on
+  loopback addresses.
+
+Options:
+
+  -address=host:port            The address to listen on. (Default: 127.0.0.1:8095)
+  -max-concurrent-builds=1      How many submitted templates are built at a time. (Default: 1)
+  -templates=path               The directory the submitted templates and variable files must be in, unless uploaded. (Default: the current directory)
+  -token=token                  The bearer token the requests must send. Can also be set with PACKER_SERVE_TOKEN.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*ServeCommand) Synopsis() string {
+	return "run a server queueing the builds of submitted templates"
+}
+
+func (*ServeCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*ServeCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-address":               complete.PredictNothing,
+		"-max-concurrent-builds": complete.PredictNothing,
+		"-templates":             complete.PredictDirs("*"),
+		"-token":                 complete.PredictNothing,
+	}
+}
@@ -0,0 +1,27 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestServeCommand_ParseArgs_token(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		env  string
+		ret  int
+	}{
+		{[]string{}, "", 0},
+		{[]string{"-address", "localhost:8095"}, "", 0},
+		{[]string{"-address", "[::1]:8095"}, "", 0},
+		{[]string{"-address", "0.0.0.0:8095"}, "", 1},
+		{[]string{"-address", ":8095"}, "", 1},
+		{[]string{"-address", "10.0.0.1:8095", "-token", "secret"}, "", 0},
+		{[]string{"-address", "10.0.0.1:8095"}, "secret", 0},
+	} {
+		t.Setenv(serveTokenEnvVar, tc.env)
+		c := &ServeCommand{Meta: testMeta(t)}
+		if _, ret := c.ParseArgs(tc.args); ret != tc.ret {
+			t.Errorf("%q with %s=%q: expected %d, got %d", tc.args, serveTokenEnvVar, tc.env, tc.ret, ret)
+		}
+	}
+}
@@ -35,3 +35,44 @@ func handleTermInterrupt(ui packersdk.Ui) (context.Context, func()) {
 	}()
 	return ctx, cleanup
 }
+
+// handleBuildInterrupt is handleTermInterrupt for builds: the context is
+// cancelled on the first interrupt, the following interrupts are sent to the
+// returned channel instead of being ignored. The terminated channel is closed
+// when the first interrupt is a SIGTERM, as sent by CI systems and Kubernetes
+// before killing the process. See buildCancellation.
+func handleBuildInterrupt(ui packersdk.Ui) (ctx context.Context, interrupts <-chan os.Signal, terminated <-chan struct{}, cleanup func()) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	interruptsCh := make(chan os.Signal, 1)
+	terminatedCh := make(chan struct{})
+	done := make(chan struct{})
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	cleanup = func() {
+		cancelCtx()
+		signal.Stop(sigCh)
+		close(done)
+	}
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if ctx.Err() == nil {
+					ui.Error(fmt.Sprintf("Cancelling build after receiving %s", sig))
+					if sig == syscall.SIGTERM {
+						close(terminatedCh)
+					}
+					cancelCtx()
+					continue
+				}
+				select {
+				case interruptsCh <- sig:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ctx, interruptsCh, terminatedCh, cleanup
+}
@@ -0,0 +1,40 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin freebsd linux netbsd openbsd solaris
+
+package command
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// handlePauseSignals pauses gate on SIGTSTP and resumes it on SIGCONT, until
+// the returned func is called. Packer itself is not stopped by SIGTSTP then.
+func handlePauseSignals(ui packersdk.Ui, gate *packer.PauseGate) func() {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, syscall.SIGTSTP, syscall.SIGCONT)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				switch {
+				case sig == syscall.SIGTSTP && gate.Pause():
+					ui.Say("Pausing the provisioning of the builds once the running provisioners are done, send SIGCONT to resume")
+				case sig == syscall.SIGCONT && gate.Resume():
+					ui.Say("Resuming the provisioning of the builds")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
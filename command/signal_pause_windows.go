@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package command
+
+import (
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// handlePauseSignals does nothing, Windows has no signal to pause a process.
+func handlePauseSignals(packersdk.Ui, *packer.PauseGate) func() {
+	return func() {}
+}
@@ -0,0 +1,3 @@
+fruit       = upper(var.fruit)
+fruit_count = length(var.fruit)
+fruits      = [local.fruit, "apple"]
@@ -0,0 +1 @@
+fruit = var.vegetable
@@ -0,0 +1 @@
+fruit = "{{user `fruit`}}"
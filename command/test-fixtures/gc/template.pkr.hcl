@@ -0,0 +1,16 @@
+source "collected" "app" {
+  target  = "app.txt"
+  content = "app"
+}
+
+source "file" "plain" {
+  target  = "plain.txt"
+  content = "plain"
+}
+
+build {
+  sources = [
+    "source.collected.app",
+    "source.file.plain",
+  ]
+}
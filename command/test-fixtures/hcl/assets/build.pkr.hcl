@@ -0,0 +1,32 @@
+asset "chocolate" {
+  url       = "${path.root}/chocolate.txt.src"
+  checksum  = "none"
+  cache_key = "chocolate.txt"
+}
+
+asset "vanilla" {
+  url       = "${path.root}/missing.txt.src"
+  checksum  = "none"
+  cache_key = "vanilla.txt"
+}
+
+locals {
+  vanilla = asset.vanilla.path
+}
+
+source "file" "chocolate" {
+  content = asset.chocolate.path
+  target  = "chocolate.txt"
+}
+
+source "file" "vanilla" {
+  content = local.vanilla
+  target  = "vanilla.txt"
+}
+
+build {
+  sources = [
+    "file.chocolate",
+    "file.vanilla",
+  ]
+}
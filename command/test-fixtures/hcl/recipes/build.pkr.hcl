@@ -1,5 +1,6 @@
 
 build {
+  tags = ["dessert"]
   source "source.null.base" {
     name  = "tiramisu"
     // pull me up !
@@ -25,11 +26,13 @@ build {
 
 build {
   name = "recipes"
+  tags = ["pasta"]
   source "source.null.base" {
     name   = "spaghetti_carbonara"
   }
   source "source.null.base" {
     name   = "lasagna"
+    tags   = ["baked"]
   }
 
   provisioner "shell-local" {
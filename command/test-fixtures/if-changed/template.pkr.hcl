@@ -0,0 +1,21 @@
+variable "flavor" {
+  type    = string
+  default = "chocolate"
+}
+
+source "file" "chocolate" {
+  target  = "chocolate.txt"
+  content = var.flavor
+}
+
+source "file" "vanilla" {
+  target  = "vanilla.txt"
+  content = "vanilla"
+}
+
+build {
+  sources = [
+    "source.file.chocolate",
+    "source.file.vanilla",
+  ]
+}
@@ -0,0 +1,20 @@
+source "base" "a" {
+}
+
+source "base" "b" {
+}
+
+source "app" "c" {
+}
+
+build {
+  name       = "app"
+  depends_on = ["build.base"]
+
+  sources = ["source.app.c"]
+}
+
+build {
+  name    = "base"
+  sources = ["source.base.a", "source.base.b"]
+}
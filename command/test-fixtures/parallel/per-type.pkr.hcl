@@ -0,0 +1,20 @@
+source "vsphere-iso" "a" {
+}
+
+source "vsphere-iso" "b" {
+}
+
+source "vsphere-clone" "c" {
+}
+
+source "docker" "d" {
+}
+
+build {
+  sources = [
+    "source.vsphere-iso.a",
+    "source.vsphere-iso.b",
+    "source.vsphere-clone.c",
+    "source.docker.d",
+  ]
+}
@@ -0,0 +1,27 @@
+source "serial" "host-1-a" {
+  serial_group = "host-1"
+}
+
+source "serial" "host-1-b" {
+  serial_group = "host-1"
+}
+
+source "serial" "host-2" {
+  serial_group = "host-2"
+}
+
+source "serial" "ungrouped" {
+}
+
+build {
+  sources = [
+    "source.serial.host-1-a",
+    "source.serial.host-1-b",
+    "source.serial.host-2",
+  ]
+
+  source "source.serial.ungrouped" {
+    name         = "host-1-c"
+    serial_group = "host-1"
+  }
+}
@@ -0,0 +1,16 @@
+variable "marker" {
+  type = string
+}
+
+source "file" "chocolate" {
+  content = "chocolate"
+  target  = "${path.root}/chocolate.txt"
+}
+
+build {
+  sources = ["source.file.chocolate"]
+
+  post-processor "shell-local" {
+    inline = ["test -f ${var.marker}"]
+  }
+}
@@ -0,0 +1,12 @@
+source "file" "chocolate" {
+  host_requirements {
+    commands = ["packer-test-command-that-does-not-exist"]
+  }
+
+  target  = "chocolate.txt"
+  content = "chocolate"
+}
+
+build {
+  sources = ["source.file.chocolate"]
+}
@@ -60,5 +60,8 @@ func testCoreConfigBuilder(t *testing.T) *packer.CoreConfig {
 	}
 	return &packer.CoreConfig{
 		Components: components,
+		// The builds of the tests are not recorded in the artifact history of
+		// the user.
+		DisableArtifactHistory: true,
 	}
 }
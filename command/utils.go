@@ -1,8 +1,13 @@
 package command
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
 )
 
 func isDir(name string) (bool, error) {
@@ -20,3 +25,30 @@ func isHCLLoaded(name string) (bool, error) {
 	}
 	return isDir(name)
 }
+
+// templateDir returns the directory of the template at path, path itself when
+// it is a directory of templates.
+func templateDir(path string) string {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// checkLocalExec reports the components of builds running commands on the
+// machine running Packer that policy does not allow, see
+// packer.LocalExecPolicy. It returns 1 when there are some.
+func checkLocalExec(ui packersdk.Ui, policy *packer.LocalExecPolicy, builds []packersdk.Build) int {
+	ret := 0
+	for _, b := range builds {
+		cb, ok := b.(*packer.CoreBuild)
+		if !ok {
+			continue
+		}
+		for _, err := range policy.CheckBuild(cb) {
+			ui.Error(fmt.Sprintf("Build '%s': %s", cb.Name(), err))
+			ret = 1
+		}
+	}
+	return ret
+}
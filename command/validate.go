@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/packer/packer"
 
 	"github.com/posener/complete"
@@ -64,10 +65,23 @@ func (c *ValidateCommand) RunContext(ctx context.Context, cla *ValidateArgs) int
 		return ret
 	}
 
-	_, diags = packerStarter.GetBuilds(packer.GetBuildsOptions{
+	builds, diags := packerStarter.GetBuilds(packer.GetBuildsOptions{
 		Only:   cla.Only,
 		Except: cla.Except,
+		Tags:   cla.Tags,
 	})
+	if !cla.SkipHostChecks {
+		diags = append(diags, checkHostRequirements(builds)...)
+	}
+	if cla.Secrets != "ignore" {
+		secretDiags := packerStarter.ScanSecrets()
+		if cla.Secrets == "error" {
+			for _, diag := range secretDiags {
+				diag.Severity = hcl.DiagError
+			}
+		}
+		diags = append(diags, secretDiags...)
+	}
 
 	fixerDiags := packerStarter.FixConfig(packer.FixConfigOptions{
 		Mode: packer.Diff,
@@ -96,9 +110,12 @@ Usage: packer validate [options] TEMPLATE
 Options:
 
   -syntax-only           Only check syntax. Do not verify config of the template.
+  -skip-host-checks      Do not check this machine meets the host requirements of the builds.
+  -secrets=warn          What to do with the values looking like secrets written in the template: warn, error or ignore. (Default: warn)
   -except=foo,bar,baz    Validate all builds other than these.
   -machine-readable      Produce machine-readable output.
   -only=foo,bar,baz      Validate only these builds.
+  -tag=foo,bar           Validate only the builds tagged with all of these.
   -var 'key=value'       Variable for templates, can be used multiple times.
   -var-file=path         JSON or HCL2 file containing user variables.
 `
@@ -117,8 +134,11 @@ func (*ValidateCommand) AutocompleteArgs() complete.Predictor {
 func (*ValidateCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		"-syntax-only":      complete.PredictNothing,
+		"-skip-host-checks": complete.PredictNothing,
+		"-secrets":          complete.PredictSet("warn", "error", "ignore"),
 		"-except":           complete.PredictNothing,
 		"-only":             complete.PredictNothing,
+		"-tag":              complete.PredictNothing,
 		"-var":              complete.PredictNothing,
 		"-machine-readable": complete.PredictNothing,
 		"-var-file":         complete.PredictNothing,
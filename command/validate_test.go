@@ -2,6 +2,7 @@ package command
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -78,6 +79,59 @@ func TestValidateCommand_SkipDatasourceExecution(t *testing.T) {
 	}
 }
 
+func TestValidateCommand_HostRequirements(t *testing.T) {
+	path := filepath.Join(testFixture("validate"), "host_requirements.pkr.hcl")
+
+	c := &ValidateCommand{
+		Meta: TestMetaFile(t),
+	}
+	if code := c.Run([]string{path}); code != 1 {
+		fatalCommand(t, c.Meta)
+	}
+	out, stderr := outputCommand(t, c.Meta)
+	if !strings.Contains(stderr, "the packer-test-command-that-does-not-exist command is not installed") {
+		t.Errorf("expected the missing command to be reported, got:\n%s\n%s", out, stderr)
+	}
+
+	c = &ValidateCommand{
+		Meta: TestMetaFile(t),
+	}
+	if code := c.Run([]string{"-skip-host-checks", path}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+}
+
+func TestValidateCommand_Secrets(t *testing.T) {
+	path := filepath.Join(testFixture("validate"), "secrets.pkr.hcl")
+
+	tests := []struct {
+		flag         string
+		exitCode     int
+		expectReport bool
+	}{
+		{"", 0, true},
+		{"-secrets=error", 1, true},
+		{"-secrets=ignore", 0, false},
+	}
+	for _, tt := range tests {
+		c := &ValidateCommand{
+			Meta: TestMetaFile(t),
+		}
+		args := []string{path}
+		if tt.flag != "" {
+			args = append([]string{tt.flag}, args...)
+		}
+		if code := c.Run(args); code != tt.exitCode {
+			fatalCommand(t, c.Meta)
+		}
+		out, stderr := outputCommand(t, c.Meta)
+		reported := strings.Contains(out+stderr, "looks like an AWS access key ID")
+		if reported != tt.expectReport {
+			t.Errorf("%q: expected the secret to be reported: %t, got:\n%s\n%s", tt.flag, tt.expectReport, out, stderr)
+		}
+	}
+}
+
 func TestValidateCommand_SyntaxOnly(t *testing.T) {
 	tt := []struct {
 		path     string
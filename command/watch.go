@@ -0,0 +1,188 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer/internal/watch"
+	"github.com/hashicorp/packer/packer"
+	"github.com/posener/complete"
+)
+
+type WatchCommand struct {
+	Meta
+}
+
+func (c *WatchCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *WatchCommand) ParseArgs(args []string) (*WatchArgs, int) {
+	var cfg WatchArgs
+	flags := c.Meta.FlagSet("watch", FlagSetBuildFilter|FlagSetVars)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+	cfg.applyDefaults()
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Path = args[0]
+
+	if cfg.Cron == "" && !cfg.OnDataChange && cfg.Feed == "" {
+		c.Ui.Error("At least one trigger is required: -cron, -on-data-change or -feed.")
+		return &cfg, 1
+	}
+	if cfg.Interval <= 0 {
+		c.Ui.Error(fmt.Sprintf("The -interval must be positive, got %s.", cfg.Interval))
+		return &cfg, 1
+	}
+	return &cfg, 0
+}
+
+func (c *WatchCommand) RunContext(ctx context.Context, cla *WatchArgs) int {
+	triggers, err := c.triggers(cla)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	lockPath := cla.Lock
+	if lockPath == "" {
+		lockPath = filepath.Join(templateDir(cla.Path), watch.DefaultLockFilename)
+	}
+
+	w := &watch.Watcher{
+		Template:   cla.Path,
+		Triggers:   triggers,
+		Interval:   cla.Interval,
+		LockPath:   lockPath,
+		StatusPath: cla.Status,
+		Ui:         c.Ui,
+		Build: func(ctx context.Context, _ []string) error {
+			// Each build parses the template again, to pick up its changes.
+			args := cla.BuildArgs
+			if ret := (&BuildCommand{Meta: c.Meta}).RunContext(ctx, &args); ret != 0 {
+				return fmt.Errorf("packer build exited with code %d", ret)
+			}
+			return nil
+		},
+	}
+	if err := w.Run(ctx); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
+
+// triggers returns the triggers set by the flags of cla.
+func (c *WatchCommand) triggers(cla *WatchArgs) ([]watch.Trigger, error) {
+	var triggers []watch.Trigger
+	if cla.Cron != "" {
+		t, err := watch.NewCronTrigger(cla.Cron)
+		if err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, t)
+	}
+	if cla.OnDataChange {
+		configType, err := cla.GetConfigType()
+		if err != nil {
+			return nil, err
+		}
+		if configType != ConfigTypeHCL2 {
+			return nil, fmt.Errorf("-on-data-change requires an HCL2 template, JSON templates have no data sources")
+		}
+		triggers = append(triggers, &watch.ChangeTrigger{
+			Name: "data sources",
+			Value: func(context.Context) (string, error) {
+				return c.datasourcesHash(&cla.MetaArgs)
+			},
+		})
+	}
+	if cla.Feed != "" {
+		t := &watch.FeedTrigger{URL: cla.Feed}
+		if cla.FeedPattern != "" {
+			pattern, err := regexp.Compile(cla.FeedPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -feed-pattern: %s", err)
+			}
+			t.Pattern = pattern
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// datasourcesHash executes the data sources of the template and returns the
+// hash of their values.
+func (c *WatchCommand) datasourcesHash(cla *MetaArgs) (string, error) {
+	cfg, ret := c.GetConfigFromHCL(cla)
+	if ret != 0 {
+		return "", fmt.Errorf("failed to parse %s", cla.Path)
+	}
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if diags.HasErrors() {
+		return "", diags
+	}
+	return cfg.Datasources.InputHash()
+}
+
+func (*WatchCommand) Help() string {
+	helpText := `
+Usage: packer watch [options] TEMPLATE
+
+  Watches the triggers of a template and builds it again every time one of
+  them fires, until interrupted. Builds never overlap, and a template can only
+  be watched once at a time. All the options of "packer build" are accepted,
+  -if-changed limits the builds run to the ones whose inputs changed.
+
+Options:
+
+  -cron='0 3 * * 1'             Build on this cron schedule, in the local time zone.
+  -on-data-change               Build when the values of the data sources of the HCL2 template change, like a newer base image.
+  -feed=url                     Build when a new entry matching -feed-pattern appears in the document at this URL, like a security advisories feed.
+  -feed-pattern=regexp          The entries of the -feed. (Default: CVE identifiers)
+  -interval=10m                 How often to check the -on-data-change and -feed triggers. (Default: 10m)
+  -lock=path                    The file locked while watching. (Default: packer.watch.lock next to the template)
+  -status=path                  Write the status of the watcher, as JSON, to this file every time it changes.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*WatchCommand) Synopsis() string {
+	return "build image(s) again when their triggers fire"
+}
+
+func (*WatchCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*WatchCommand) AutocompleteFlags() complete.Flags {
+	flags := (&BuildCommand{}).AutocompleteFlags()
+	flags["-cron"] = complete.PredictNothing
+	flags["-on-data-change"] = complete.PredictNothing
+	flags["-feed"] = complete.PredictNothing
+	flags["-feed-pattern"] = complete.PredictNothing
+	flags["-interval"] = complete.PredictNothing
+	flags["-lock"] = complete.PredictFiles("*")
+	flags["-status"] = complete.PredictFiles("*")
+	return flags
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/internal/watch"
+)
+
+func TestWatchCommand_ParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"no trigger", []string{"template.pkr.hcl"}, 1},
+		{"no template", []string{"-cron=@daily"}, 1},
+		{"invalid interval", []string{"-on-data-change", "-interval=0s", "template.pkr.hcl"}, 1},
+		{"cron", []string{"-cron=@daily", "template.pkr.hcl"}, 0},
+		{"feed", []string{"-feed=https://example.com/feed", "-interval=1h", "template.pkr.hcl"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &WatchCommand{Meta: TestMetaFile(t)}
+			_, code := c.ParseArgs(tt.args)
+			if code != tt.wantCode {
+				t.Errorf("expected code %d, got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestWatchCommand_Feed(t *testing.T) {
+	var polls int32
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// A new advisory is published after the first poll.
+		if atomic.AddInt32(&polls, 1) == 1 {
+			fmt.Fprint(w, "CVE-2022-0001")
+			return
+		}
+		fmt.Fprint(w, "CVE-2022-0001\nCVE-2022-0002")
+	}))
+	defer feed.Close()
+
+	c := &WatchCommand{Meta: TestMetaFile(t)}
+	dir := t.TempDir()
+	statusPath := filepath.Join(dir, "status.json")
+	template := filepath.Join(testFixture("if-changed"), "template.pkr.hcl")
+	defer cleanup()
+
+	cla, code := c.ParseArgs([]string{
+		"-feed=" + feed.URL,
+		"-interval=10ms",
+		"-lock=" + filepath.Join(dir, "watch.lock"),
+		"-status=" + statusPath,
+		template,
+	})
+	if code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- c.RunContext(ctx, cla) }()
+
+	// Wait for the watcher to be back waiting after a build.
+	readStatus := func() (watch.Status, []byte) {
+		var status watch.Status
+		raw, _ := os.ReadFile(statusPath)
+		_ = json.Unmarshal(raw, &status)
+		return status, raw
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for status, _ := readStatus(); status.Builds == 0 || status.State != watch.StateWaiting; status, _ = readStatus() {
+		if time.Now().After(deadline) {
+			cancel()
+			<-done
+			fatalCommand(t, c.Meta)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if code := <-done; code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	status, raw := readStatus()
+	if status.State != watch.StateStopped || status.Builds != 1 || status.LastBuild == nil || !status.LastBuild.Succeeded {
+		t.Errorf("unexpected status: %s", raw)
+	}
+	for _, f := range []string{"chocolate.txt", "vanilla.txt"} {
+		if !fileExists(f) {
+			t.Errorf("Expected to find %s", f)
+		}
+	}
+}
@@ -20,12 +20,71 @@ func init() {
 		"build": func() (cli.Command, error) {
 			return &command.BuildCommand{Meta: *CommandMeta}, nil
 		},
+		"artifacts": func() (cli.Command, error) {
+			return &command.ArtifactsCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"artifacts show": func() (cli.Command, error) {
+			return &command.ArtifactsShowCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache": func() (cli.Command, error) {
+			return &command.CacheCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache list": func() (cli.Command, error) {
+			return &command.CacheListCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache prune": func() (cli.Command, error) {
+			return &command.CachePruneCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache verify": func() (cli.Command, error) {
+			return &command.CacheVerifyCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cleanup": func() (cli.Command, error) {
+			return &command.CleanupCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
 		"console": func() (cli.Command, error) {
 			return &command.ConsoleCommand{
 				Meta: *CommandMeta,
 			}, nil
 		},
 
+		"envrc": func() (cli.Command, error) {
+			return &command.EnvrcCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"envrc capture": func() (cli.Command, error) {
+			return &command.EnvrcCaptureCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"envrc verify": func() (cli.Command, error) {
+			return &command.EnvrcVerifyCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"fix": func() (cli.Command, error) {
 			return &command.FixCommand{
 				Meta: *CommandMeta,
@@ -38,12 +97,78 @@ func init() {
 			}, nil
 		},
 
+		"gc": func() (cli.Command, error) {
+			return &command.GCCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"hcl2_upgrade": func() (cli.Command, error) {
 			return &command.HCL2UpgradeCommand{
 				Meta: *CommandMeta,
 			}, nil
 		},
 
+		"hcp": func() (cli.Command, error) {
+			return &command.HCPCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp buckets": func() (cli.Command, error) {
+			return &command.HCPBucketsCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp buckets list": func() (cli.Command, error) {
+			return &command.HCPBucketsListCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp channels": func() (cli.Command, error) {
+			return &command.HCPChannelsCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp channels list": func() (cli.Command, error) {
+			return &command.HCPChannelsListCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp deprecate": func() (cli.Command, error) {
+			return &command.HCPDeprecateCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp expiring": func() (cli.Command, error) {
+			return &command.HCPExpiringCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp iterations": func() (cli.Command, error) {
+			return &command.HCPIterationsCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp iterations list": func() (cli.Command, error) {
+			return &command.HCPIterationsListCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"hcp promote": func() (cli.Command, error) {
+			return &command.HCPPromoteCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"init": func() (cli.Command, error) {
 			return &command.InitCommand{
 				Meta: *CommandMeta,
@@ -92,6 +217,18 @@ func init() {
 			}, nil
 		},
 
+		"postprocess": func() (cli.Command, error) {
+			return &command.PostProcessCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"serve": func() (cli.Command, error) {
+			return &command.ServeCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"validate": func() (cli.Command, error) {
 			return &command.ValidateCommand{
 				Meta: *CommandMeta,
@@ -104,5 +241,11 @@ func init() {
 				CheckFunc: commandVersionCheck,
 			}, nil
 		},
+
+		"watch": func() (cli.Command, error) {
+			return &command.WatchCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
 	}
 }
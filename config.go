@@ -13,6 +13,8 @@ import (
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer/command"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/hashicorp/packer/internal/notify"
 	"github.com/hashicorp/packer/packer"
 )
 
@@ -21,11 +23,24 @@ import (
 const PACKERSPACE = "-PACKERSPACE-"
 
 type config struct {
-	DisableCheckpoint          bool              `json:"disable_checkpoint"`
-	DisableCheckpointSignature bool              `json:"disable_checkpoint_signature"`
-	RawBuilders                map[string]string `json:"builders"`
-	RawProvisioners            map[string]string `json:"provisioners"`
-	RawPostProcessors          map[string]string `json:"post-processors"`
+	DisableCheckpoint          bool                `json:"disable_checkpoint"`
+	DisableCheckpointSignature bool                `json:"disable_checkpoint_signature"`
+	DisableArtifactHistory     bool                `json:"disable_artifact_history"`
+	RawBuilders                map[string]string   `json:"builders"`
+	RawProvisioners            map[string]string   `json:"provisioners"`
+	RawPostProcessors          map[string]string   `json:"post-processors"`
+	Profiles                   map[string]*profile `json:"profiles"`
+
+	// LocalExec restricts the components of templates running commands on
+	// this machine.
+	LocalExec *packer.LocalExecPolicy `json:"local_exec"`
+
+	// Cache is the policy evicting the cached downloads and plugins at the
+	// end of builds.
+	Cache *cache.Policy `json:"cache"`
+
+	// Notifications are notified of the outcome of the builds.
+	Notifications []*notify.Target `json:"notifications"`
 
 	Plugins *packer.PluginConfig
 }
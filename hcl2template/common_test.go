@@ -346,9 +346,12 @@ var cmpOpts = []cmp.Option{
 		PackerConfig{},
 		Variable{},
 		SourceBlock{},
+		HCPPackerRegistryBlock{},
 		DatasourceBlock{},
 		ProvisionerBlock{},
 		PostProcessorBlock{},
+		BuildBlock{},
+		ProvisionerOverride{},
 		packer.CoreBuild{},
 		HCL2Provisioner{},
 		HCL2PostProcessor{},
@@ -366,6 +369,10 @@ var cmpOpts = []cmp.Option{
 	cmpopts.IgnoreFields(packerregistry.Iteration{},
 		"Fingerprint", // Fingerprint will change everytime
 	),
+	cmpopts.IgnoreFields(packer.CoreBuild{},
+		"TempDir",        // TempDir is named after the PID of the test
+		"DebugEvaluator", // DebugEvaluator is a func
+	),
 	cmpopts.IgnoreFields(VariableAssignment{},
 		"Expr", // its an interface
 	),
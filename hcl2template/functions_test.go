@@ -0,0 +1,72 @@
+package hcl2template
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+var mockValidNameFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "name", Type: cty.String}},
+	Type:   function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		return cty.BoolVal(!strings.ContainsAny(args[0].AsString(), " _")), nil
+	},
+})
+
+func TestPackerConfig_pluginFunctions(t *testing.T) {
+	tests := []struct {
+		name        string
+		vars        map[string]string
+		wantLocal   string
+		wantInvalid bool
+	}{
+		{"valid name", nil, "MY-IMAGE", false},
+		{"invalid name", map[string]string{"image_name": "my image"}, "", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			parser := getBasicParser()
+			if err := parser.PluginConfig.RegisterFunction("mock_valid_name", mockValidNameFunc); err != nil {
+				t.Fatalf("failed to register the function: %s", err)
+			}
+			cfg, diags := parser.Parse("testdata/functions/plugin.pkr.hcl", nil, tt.vars)
+			if diags.HasErrors() {
+				t.Fatalf("failed to parse the template: %s", diags)
+			}
+			diags = cfg.Initialize(packer.InitializeOptions{})
+			if diags.HasErrors() != tt.wantInvalid {
+				t.Fatalf("unexpected diagnostics: %s", diags)
+			}
+			if tt.wantInvalid {
+				if !cfg.InvalidVariables() {
+					t.Errorf("expected the variables to be invalid")
+				}
+				return
+			}
+			got := cfg.LocalVariables["image_name"].Value()
+			if got.AsString() != tt.wantLocal {
+				t.Errorf("unexpected local value %#v, expected %q", got, tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestPackerConfig_pluginFunctions_builtinsWin(t *testing.T) {
+	parser := getBasicParser()
+	if err := parser.PluginConfig.RegisterFunction("upper", mockValidNameFunc); err != nil {
+		t.Fatalf("failed to register the function: %s", err)
+	}
+	cfg := &PackerConfig{parser: parser}
+	val, err := cfg.functions()["upper"].Call([]cty.Value{cty.StringVal("a b")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if val.AsString() != "A B" {
+		t.Errorf("the builtin upper function was overridden, got %#v", val)
+	}
+}
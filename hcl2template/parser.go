@@ -9,7 +9,6 @@ import (
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/ext/dynblock"
 	"github.com/hashicorp/hcl/v2/hclparse"
-	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -24,6 +23,8 @@ const (
 	dataSourceLabel   = "data"
 	buildLabel        = "build"
 	communicatorLabel = "communicator"
+	assetLabel        = "asset"
+	httpServerLabel   = "http_server"
 )
 
 var configSchema = &hcl.BodySchema{
@@ -37,6 +38,8 @@ var configSchema = &hcl.BodySchema{
 		{Type: dataSourceLabel, LabelNames: []string{"type", "name"}},
 		{Type: buildLabel},
 		{Type: communicatorLabel, LabelNames: []string{"type", "name"}},
+		{Type: assetLabel, LabelNames: []string{"name"}},
+		{Type: httpServerLabel, LabelNames: []string{"name"}},
 	},
 }
 
@@ -63,6 +66,10 @@ type Parser struct {
 	*hclparse.Parser
 
 	PluginConfig *packer.PluginConfig
+
+	// LocalExec, when set, restricts the data sources running commands on
+	// the machine running Packer.
+	LocalExec *packer.LocalExecPolicy
 }
 
 const (
@@ -192,6 +199,16 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 			diags = append(diags, morediags...)
 		}
 
+		for _, file := range files {
+			morediags := p.decodeAssets(file, cfg)
+			diags = append(diags, morediags...)
+		}
+
+		for _, file := range files {
+			morediags := p.decodeHTTPServers(file, cfg)
+			diags = append(diags, morediags...)
+		}
+
 		for _, file := range files {
 			moreLocals, morediags := parseLocalVariableBlocks(file)
 			diags = append(diags, morediags...)
@@ -235,7 +252,10 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 			varFiles = append(varFiles, f)
 		}
 
-		diags = append(diags, cfg.collectInputVariableValues(os.Environ(), varFiles, argVars)...)
+		cfg.varFiles = varFiles
+		moreDiags = cfg.collectInputVariableValues(os.Environ(), varFiles, argVars)
+		diags = append(diags, moreDiags...)
+		cfg.invalidVariables = len(varFiles) != len(hclVarFiles)+len(jsonVarFiles) || moreDiags.HasErrors()
 	}
 
 	return cfg, diags
@@ -285,6 +305,21 @@ func sniffCoreVersionRequirements(body hcl.Body) ([]VersionConstraint, hcl.Diagn
 	return constraints, diags
 }
 
+// registerConfigSecrets registers the communicator passwords of the decoded
+// configuration of a builder or provisioner to packer.Secrets, see
+// packer.IsSecretConfigKey.
+func registerConfigSecrets(config cty.Value) {
+	_ = cty.Walk(config, func(path cty.Path, nested cty.Value) (bool, error) {
+		if len(path) == 0 || !nested.IsWhollyKnown() || nested.IsNull() || !nested.Type().Equals(cty.String) {
+			return true, nil
+		}
+		if attr, ok := path[len(path)-1].(cty.GetAttrStep); ok && packer.IsSecretConfigKey(attr.Name) {
+			packer.Secrets.Register(nested.AsString())
+		}
+		return true, nil
+	})
+}
+
 func filterVarsFromLogs(inputOrLocal Variables) {
 	for _, variable := range inputOrLocal {
 		if !variable.Sensitive {
@@ -293,7 +328,7 @@ func filterVarsFromLogs(inputOrLocal Variables) {
 		value := variable.Value()
 		_ = cty.Walk(value, func(_ cty.Path, nested cty.Value) (bool, error) {
 			if nested.IsWhollyKnown() && !nested.IsNull() && nested.Type().Equals(cty.String) {
-				packersdk.LogSecretFilter.Set(nested.AsString())
+				packer.Secrets.Register(nested.AsString())
 			}
 			return true, nil
 		})
@@ -310,11 +345,14 @@ func (cfg *PackerConfig) Initialize(opts packer.InitializeOptions) hcl.Diagnosti
 		return diags
 	}
 
-	moreDiags = cfg.InputVariables.ValidateValues()
+	moreDiags = cfg.InputVariables.ValidateValues(cfg.functions())
 	diags = append(diags, moreDiags...)
-	moreDiags = cfg.LocalVariables.ValidateValues()
+	cfg.invalidVariables = cfg.invalidVariables || moreDiags.HasErrors()
+	moreDiags = cfg.LocalVariables.ValidateValues(cfg.functions())
 	diags = append(diags, moreDiags...)
 	diags = append(diags, cfg.evaluateDatasources(opts.SkipDatasourcesExecution)...)
+	diags = append(diags, cfg.evaluateAssets()...)
+	diags = append(diags, cfg.evaluateHTTPServers()...)
 	diags = append(diags, checkForDuplicateLocalDefinition(cfg.LocalBlocks)...)
 	diags = append(diags, cfg.evaluateLocalVariables(cfg.LocalBlocks)...)
 
@@ -325,12 +363,24 @@ func (cfg *PackerConfig) Initialize(opts packer.InitializeOptions) hcl.Diagnosti
 	for _, file := range cfg.files {
 		diags = append(diags, cfg.parser.parseConfig(file, cfg)...)
 	}
+	diags = append(diags, cfg.selectSources()...)
+	diags = append(diags, cfg.orderBuilds()...)
+	if !diags.HasErrors() {
+		diags = append(diags, cfg.checkBuildContracts()...)
+	}
 
 	diags = append(diags, cfg.initializeBlocks()...)
+	diags = append(diags, cfg.checkRegistryDatasourceAncestry()...)
 
 	return diags
 }
 
+// InvalidVariables tells whether a var file could not be parsed, or an input
+// variable has no value or an invalid one, when parsing or initializing cfg.
+func (cfg *PackerConfig) InvalidVariables() bool {
+	return cfg != nil && cfg.invalidVariables
+}
+
 // parseConfig looks in the found blocks for everything that is not a variable
 // block.
 func (p *Parser) parseConfig(f *hcl.File, cfg *PackerConfig) hcl.Diagnostics {
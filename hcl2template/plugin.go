@@ -143,16 +143,27 @@ func (cfg *PackerConfig) initializeBlocks() hcl.Diagnostics {
 				continue
 			}
 
-			body := sourceDefinition.block.Body
+			body := sourceDefinition.body
 			if srcUsage.Body != nil {
 				// merge additions into source definition to get a new body.
 				body = hcl.MergeBodies([]hcl.Body{body, srcUsage.Body})
 			}
 
 			srcUsage.Body = body
+			if srcUsage.SerialGroup == "" {
+				srcUsage.SerialGroup = sourceDefinition.SerialGroup
+			}
+			if srcUsage.HostRequirements == nil {
+				srcUsage.HostRequirements = sourceDefinition.HostRequirements
+			}
+			srcUsage.Tags = mergeTags(sourceDefinition.Tags, srcUsage.Tags)
 		}
 
-		for _, provBlock := range build.ProvisionerBlocks {
+		provBlocks := build.ProvisionerBlocks
+		for _, override := range build.ProvisionerOverrides {
+			provBlocks = append(provBlocks[:len(provBlocks):len(provBlocks)], override.Provisioner)
+		}
+		for _, provBlock := range provBlocks {
 			if !cfg.parser.PluginConfig.Provisioners.Has(provBlock.PType) {
 				diags = append(diags, &hcl.Diagnostic{
 					Summary:  fmt.Sprintf("Unknown "+buildProvisionerLabel+" type %q", provBlock.PType),
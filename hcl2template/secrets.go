@@ -0,0 +1,272 @@
+package hcl2template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// secretAllowAnnotation, in a comment on the line of a value or on the line
+// above it, tells the secret scanner the value is not a secret.
+const secretAllowAnnotation = "packer:allow-secret"
+
+// secretFormats are the formats of well-known credentials.
+var secretFormats = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"an AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"a GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"a Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"a Vault token", regexp.MustCompile(`\bhv[sbr]\.[A-Za-z0-9_-]{24,}`)},
+	{"a JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+}
+
+// secretNames matches the names of the settings and variables holding
+// secrets, like ssh_password or api_token.
+var secretNames = regexp.MustCompile(`(?i)(password|passwd|passphrase|secret|token|api_?key|private_?key|access_?key|credentials)`)
+
+// Random strings are told apart from words and hexadecimal digests, like
+// checksums, by the entropy of their characters.
+const (
+	secretMinEntropyLength = 32
+	secretMinEntropy       = 4.5
+)
+
+var secretEntropyTokens = regexp.MustCompile(`[A-Za-z0-9+=_-]+`)
+
+// secretFinding is a literal value of a template that looks like a secret.
+type secretFinding struct {
+	// name is the setting or variable the value is set to.
+	name   string
+	reason string
+	rng    hcl.Range
+}
+
+// ScanSecrets looks for secrets written in clear in the config files and var
+// files of the template: values in well-known credential formats, random
+// looking strings, and literal values of settings or variables named like
+// passwords. It returns a warning for each of them.
+func (cfg *PackerConfig) ScanSecrets() hcl.Diagnostics {
+	var findings []secretFinding
+	for _, file := range append(cfg.files[:len(cfg.files):len(cfg.files)], cfg.varFiles...) {
+		var found []secretFinding
+		switch body := file.Body.(type) {
+		case *hclsyntax.Body:
+			found = scanBodySecrets(body)
+		default:
+			found = scanJSONSecrets(file)
+		}
+		for _, f := range found {
+			if !secretAllowed(file.Bytes, f.rng) {
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].rng.Filename != findings[j].rng.Filename {
+			return findings[i].rng.Filename < findings[j].rng.Filename
+		}
+		return findings[i].rng.Start.Byte < findings[j].rng.Start.Byte
+	})
+
+	var diags hcl.Diagnostics
+	for _, f := range findings {
+		rng := f.rng
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("Possible secret in %s", f.name),
+			Detail: fmt.Sprintf("The value of %s looks like %s. Secrets committed with "+
+				"templates leak to anyone reading them: set it from a sensitive variable "+
+				"instead, or add a `# %s` comment above it if it is not a secret.",
+				f.name, f.reason, secretAllowAnnotation),
+			Subject: &rng,
+		})
+	}
+	return diags
+}
+
+// scanBodySecrets returns the secrets of the attributes of body and of its
+// nested blocks.
+func scanBodySecrets(body *hclsyntax.Body) []secretFinding {
+	var findings []secretFinding
+	for _, attr := range body.Attributes {
+		findings = append(findings, scanExprSecrets(attr.Expr, attr.Name)...)
+	}
+	for _, block := range body.Blocks {
+		if block.Type == variableLabel && len(block.Labels) == 1 {
+			findings = append(findings, scanVariableSecrets(block)...)
+			continue
+		}
+		findings = append(findings, scanBodySecrets(block.Body)...)
+	}
+	return findings
+}
+
+// scanVariableSecrets returns the secrets of a variable block: its default is
+// named after the variable, and is a secret when the variable is sensitive.
+func scanVariableSecrets(block *hclsyntax.Block) []secretFinding {
+	name := block.Labels[0]
+	def, ok := block.Body.Attributes["default"]
+	if !ok {
+		return nil
+	}
+	if sensitive, ok := block.Body.Attributes["sensitive"]; ok {
+		v, diags := sensitive.Expr.Value(nil)
+		if !diags.HasErrors() && v.IsKnown() && !v.IsNull() && v.Type() == cty.Bool && v.True() {
+			if value, ok := literalString(def.Expr); ok && value != "" {
+				return []secretFinding{{name: "variable " + name, reason: "the default of a sensitive variable", rng: def.Expr.Range()}}
+			}
+		}
+	}
+	return scanExprSecrets(def.Expr, "variable "+name)
+}
+
+// scanExprSecrets returns the secrets of the literal strings of expr, set to
+// name. The items of objects are named after their key.
+func scanExprSecrets(expr hclsyntax.Expression, name string) []secretFinding {
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		var findings []secretFinding
+		for _, item := range e.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			if s, ok := literalString(item.KeyExpr); ok {
+				key = s
+			}
+			if key == "" {
+				key = name
+			}
+			findings = append(findings, scanExprSecrets(item.ValueExpr, key)...)
+		}
+		return findings
+	case *hclsyntax.TupleConsExpr:
+		var findings []secretFinding
+		for _, item := range e.Exprs {
+			findings = append(findings, scanExprSecrets(item, name)...)
+		}
+		return findings
+	}
+
+	value, ok := literalString(expr)
+	if !ok {
+		return nil
+	}
+	if reason := secretReason(name, value); reason != "" {
+		return []secretFinding{{name: name, reason: reason, rng: expr.Range()}}
+	}
+	return nil
+}
+
+// literalString returns the value of expr when it is a literal string, like
+// "foo" but not "${var.foo}".
+func literalString(expr hcl.Expression) (string, bool) {
+	if key, ok := expr.(*hclsyntax.ObjectConsKeyExpr); ok {
+		expr = key.Wrapped
+	}
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		if !e.IsStringLiteral() {
+			return "", false
+		}
+	case *hclsyntax.LiteralValueExpr:
+	default:
+		return "", false
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+// secretReason tells why value, set to name, looks like a secret, empty when
+// it does not.
+func secretReason(name, value string) string {
+	for _, format := range secretFormats {
+		if format.pattern.MatchString(value) {
+			return format.name
+		}
+	}
+	for _, token := range secretEntropyTokens.FindAllString(value, -1) {
+		if len(token) >= secretMinEntropyLength && shannonEntropy(token) >= secretMinEntropy {
+			return "a random string"
+		}
+	}
+	if value != "" && secretNames.MatchString(name) {
+		return "a password written in clear"
+	}
+	return ""
+}
+
+// shannonEntropy returns the entropy, in bits per character, of s.
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	var entropy float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// scanJSONSecrets returns the secrets of a JSON config or var file. The
+// objects are named after their key. JSON has no comment, the findings are
+// reported on the whole file.
+func scanJSONSecrets(file *hcl.File) []secretFinding {
+	var content interface{}
+	if err := json.Unmarshal(file.Bytes, &content); err != nil {
+		return nil
+	}
+	rng := file.Body.MissingItemRange()
+	var findings []secretFinding
+	var walk func(v interface{}, name string)
+	walk = func(v interface{}, name string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				walk(item, k)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item, name)
+			}
+		case string:
+			if reason := secretReason(name, v); reason != "" {
+				findings = append(findings, secretFinding{name: name, reason: reason, rng: rng})
+			}
+		}
+	}
+	walk(content, "")
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].name < findings[j].name })
+	return findings
+}
+
+// secretAllowed tells whether the finding at rng is allowed by an annotation
+// on its line or on the line above.
+func secretAllowed(src []byte, rng hcl.Range) bool {
+	if rng.Start.Line < 1 {
+		return false
+	}
+	lines := bytes.Split(src, []byte("\n"))
+	for _, l := range []int{rng.Start.Line - 1, rng.Start.Line - 2} {
+		if l >= 0 && l < len(lines) && strings.Contains(string(lines[l]), secretAllowAnnotation) {
+			return true
+		}
+	}
+	return false
+}
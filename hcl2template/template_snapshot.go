@@ -0,0 +1,193 @@
+package hcl2template
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/packer/packer"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// SnapshotTemplate returns a copy of the config files and var files of the
+// template, and the values of its input and local variables. The defaults of
+// the sensitive variables, the values set to them in the var files, and the
+// values the secret scanner finds are redacted, see ScanSecrets.
+func (cfg *PackerConfig) SnapshotTemplate() (*packer.TemplateSnapshot, hcl.Diagnostics) {
+	snapshot := &packer.TemplateSnapshot{
+		Values: packer.SnapshotValues{
+			Variables: snapshotValues(cfg.InputVariables),
+			Locals:    snapshotValues(cfg.LocalVariables),
+		},
+	}
+	for _, file := range cfg.files {
+		path := file.Body.MissingItemRange().Filename
+		snapshot.AddFile(packer.SnapshotTemplateDir, path, cfg.redactFile(file, false))
+	}
+	for _, file := range cfg.varFiles {
+		path := file.Body.MissingItemRange().Filename
+		snapshot.Values.VarFiles = append(snapshot.Values.VarFiles, path)
+		snapshot.AddFile(packer.SnapshotVarFilesDir, path, cfg.redactFile(file, true))
+	}
+	return snapshot, nil
+}
+
+// snapshotValues returns the values of vars by name, for a snapshot. The
+// sensitive ones are redacted, the unknown ones are null.
+func snapshotValues(vars Variables) map[string]interface{} {
+	values := make(map[string]interface{}, len(vars))
+	for name, v := range vars {
+		if v.Sensitive {
+			values[name] = packer.SnapshotRedacted
+			continue
+		}
+		value, _ := v.Value().UnmarkDeep()
+		if !value.IsWhollyKnown() {
+			values[name] = nil
+			continue
+		}
+		raw, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			values[name] = nil
+			continue
+		}
+		values[name] = json.RawMessage(raw)
+	}
+	return values
+}
+
+// sensitive tells whether the input variable name is sensitive.
+func (cfg *PackerConfig) sensitive(name string) bool {
+	v, ok := cfg.InputVariables[name]
+	return ok && v.Sensitive
+}
+
+// sensitiveLocal tells whether the local variable name is sensitive.
+func (cfg *PackerConfig) sensitiveLocal(name string) bool {
+	v, ok := cfg.LocalVariables[name]
+	return ok && v.Sensitive
+}
+
+// redactFile returns the content of file with its sensitive values redacted:
+// the secrets the scanner finds, the defaults and expressions of the sensitive
+// variables and, in a var file, the values set to the sensitive variables.
+func (cfg *PackerConfig) redactFile(file *hcl.File, varFile bool) []byte {
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return cfg.redactJSONFile(file, varFile)
+	}
+
+	var ranges []hcl.Range
+	for _, f := range scanBodySecrets(body) {
+		if !secretAllowed(file.Bytes, f.rng) {
+			ranges = append(ranges, f.rng)
+		}
+	}
+	if varFile {
+		for name, attr := range body.Attributes {
+			if cfg.sensitive(name) {
+				ranges = append(ranges, attr.Expr.Range())
+			}
+		}
+	}
+	for _, block := range body.Blocks {
+		if len(block.Labels) != 1 {
+			continue
+		}
+		switch {
+		case block.Type == variableLabel && cfg.sensitive(block.Labels[0]):
+			if def, ok := block.Body.Attributes["default"]; ok {
+				ranges = append(ranges, def.Expr.Range())
+			}
+		case block.Type == localLabel && cfg.sensitiveLocal(block.Labels[0]):
+			if expr, ok := block.Body.Attributes["expression"]; ok {
+				ranges = append(ranges, expr.Expr.Range())
+			}
+		}
+	}
+	return redactRanges(file.Bytes, ranges)
+}
+
+// redactRanges replaces the ranges of src with SnapshotRedacted. The ranges
+// nested in another one are redacted with it.
+func redactRanges(src []byte, ranges []hcl.Range) []byte {
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].Start.Byte != ranges[j].Start.Byte {
+			return ranges[i].Start.Byte < ranges[j].Start.Byte
+		}
+		return ranges[i].End.Byte > ranges[j].End.Byte
+	})
+	redacted := strconv.Quote(packer.SnapshotRedacted)
+	var out []byte
+	last := 0
+	for _, rng := range ranges {
+		if rng.Start.Byte < last || rng.End.Byte > len(src) {
+			continue
+		}
+		out = append(out, src[last:rng.Start.Byte]...)
+		out = append(out, redacted...)
+		last = rng.End.Byte
+	}
+	return append(out, src[last:]...)
+}
+
+// redactJSONFile returns the content of a JSON config or var file with its
+// sensitive values redacted. As the file is encoded again, its formatting is
+// not kept.
+func (cfg *PackerConfig) redactJSONFile(file *hcl.File, varFile bool) []byte {
+	var content interface{}
+	if err := json.Unmarshal(file.Bytes, &content); err != nil {
+		return file.Bytes
+	}
+	var redact func(v interface{}, name string) interface{}
+	redact = func(v interface{}, name string) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				v[k] = redact(item, k)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = redact(item, name)
+			}
+		case string:
+			if secretReason(name, v) != "" {
+				return packer.SnapshotRedacted
+			}
+		}
+		return v
+	}
+
+	if root, ok := content.(map[string]interface{}); ok {
+		if varFile {
+			for name := range root {
+				if cfg.sensitive(name) {
+					root[name] = packer.SnapshotRedacted
+				}
+			}
+		}
+		redactBlocks := func(label, attr string, sensitive func(string) bool) {
+			blocks, _ := root[label].(map[string]interface{})
+			for name, block := range blocks {
+				if block, ok := block.(map[string]interface{}); ok && sensitive(name) {
+					if _, ok := block[attr]; ok {
+						block[attr] = packer.SnapshotRedacted
+					}
+				}
+			}
+		}
+		if !varFile {
+			redactBlocks(variableLabel, "default", cfg.sensitive)
+			redactBlocks(localLabel, "expression", cfg.sensitiveLocal)
+		}
+	}
+	content = redact(content, "")
+
+	b, err := packer.MarshalSnapshotJSON(content)
+	if err != nil {
+		return file.Bytes
+	}
+	return b
+}
@@ -0,0 +1,103 @@
+package hcl2template
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPackerConfig_SnapshotTemplate(t *testing.T) {
+	parser := getBasicParser()
+	cfg, diags := parser.Parse("testdata/snapshot/template.pkr.hcl",
+		[]string{"testdata/snapshot/prod.pkrvars.hcl", "testdata/snapshot/token.pkrvars.json"}, nil)
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse the template: %s", diags)
+	}
+	if diags := cfg.Initialize(packer.InitializeOptions{}); diags.HasErrors() {
+		t.Fatalf("failed to initialize the template: %s", diags)
+	}
+
+	snapshot, diags := cfg.SnapshotTemplate()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected failure: %s", diags)
+	}
+
+	expectedTemplate := `variable "region" {
+  type    = string
+  default = "us-east-1"
+}
+
+variable "vault_token" {
+  type      = string
+  default   = "<sensitive>"
+  sensitive = true
+}
+
+variable "db" {
+  type      = map(string)
+  sensitive = true
+}
+
+local "connection" {
+  expression = "<sensitive>"
+  sensitive  = true
+}
+
+source "null" "example" {
+  communicator = "none"
+}
+
+build {
+  sources = ["source.null.example"]
+
+  provisioner "shell" {
+    environment_vars = ["<sensitive>", "REGION=${var.region}"]
+    inline           = ["echo ${local.connection}"]
+  }
+}
+`
+	if diff := cmp.Diff(expectedTemplate, string(snapshot.Files[filepath.Join("template", "template.pkr.hcl")])); diff != "" {
+		t.Errorf("unexpected template snapshot: %s", diff)
+	}
+	expectedVarFile := `region = "eu-west-1"
+db = "<sensitive>"
+`
+	if diff := cmp.Diff(expectedVarFile, string(snapshot.Files[filepath.Join("var-files", "prod.pkrvars.hcl")])); diff != "" {
+		t.Errorf("unexpected var file snapshot: %s", diff)
+	}
+	expectedJSONVarFile := `{
+  "region": "eu-west-3",
+  "vault_token": "<sensitive>"
+}
+`
+	if diff := cmp.Diff(expectedJSONVarFile, string(snapshot.Files[filepath.Join("var-files", "token.pkrvars.json")])); diff != "" {
+		t.Errorf("unexpected JSON var file snapshot: %s", diff)
+	}
+	if len(snapshot.Files) != 3 {
+		t.Errorf("expected 3 files in the snapshot, got %d", len(snapshot.Files))
+	}
+
+	values, err := packer.MarshalSnapshotJSON(map[string]interface{}{
+		"variables": snapshot.Values.Variables,
+		"locals":    snapshot.Values.Locals,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedValues := `{
+  "locals": {
+    "connection": "<sensitive>"
+  },
+  "variables": {
+    "db": "<sensitive>",
+    "region": "eu-west-3",
+    "vault_token": "<sensitive>"
+  }
+}
+`
+	if diff := cmp.Diff(expectedValues, string(values)); diff != "" {
+		t.Errorf("unexpected values: %s", diff)
+	}
+}
@@ -0,0 +1,17 @@
+variable "iso_url" {
+  type = string
+}
+
+variable "iso_checksum" {
+  type = string
+}
+
+asset "iso" {
+  url       = var.iso_url
+  checksum  = var.iso_checksum
+  cache_key = "test.iso"
+}
+
+locals {
+  iso_path = asset.iso.path
+}
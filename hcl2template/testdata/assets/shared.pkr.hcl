@@ -0,0 +1,20 @@
+variable "iso_url" {
+  type = string
+}
+
+variable "iso_checksum" {
+  type    = string
+  default = "none"
+}
+
+asset "iso" {
+  url       = var.iso_url
+  checksum  = "none"
+  cache_key = "shared.iso"
+}
+
+asset "same_iso" {
+  url       = var.iso_url
+  checksum  = var.iso_checksum
+  cache_key = "shared.iso"
+}
@@ -0,0 +1,18 @@
+source "virtualbox-iso" "base" {
+}
+
+source "amazon-ebs" "app" {
+    string       = build.base.artifact.id
+    slice_string = build.base.artifact.files
+}
+
+build {
+    name    = "base"
+    sources = ["source.virtualbox-iso.base"]
+}
+
+build {
+    name       = "app"
+    depends_on = ["build.base"]
+    sources    = ["source.amazon-ebs.app"]
+}
@@ -0,0 +1,23 @@
+source "virtualbox-iso" "base" {
+}
+
+source "virtualbox-iso" "base-2" {
+}
+
+source "amazon-ebs" "app" {
+    string = build.base.artifact.id
+}
+
+build {
+    name = "base"
+    sources = [
+        "source.virtualbox-iso.base",
+        "source.virtualbox-iso.base-2",
+    ]
+}
+
+build {
+    name       = "app"
+    depends_on = ["build.base"]
+    sources    = ["source.amazon-ebs.app"]
+}
@@ -0,0 +1,22 @@
+source "virtualbox-iso" "base" {
+}
+
+source "amazon-ebs" "app" {
+    string = build.base.artifact.id
+}
+
+build {
+    name    = "base"
+    sources = ["source.virtualbox-iso.base"]
+}
+
+build {
+    name       = "app"
+    depends_on = ["build.other"]
+    sources    = ["source.amazon-ebs.app"]
+}
+
+build {
+    name    = "other"
+    sources = ["source.virtualbox-iso.base"]
+}
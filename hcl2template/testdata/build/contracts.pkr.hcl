@@ -0,0 +1,21 @@
+build {
+    name     = "template"
+    provides = ["vsphere-template"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+build {
+    name         = "clone"
+    depends_on   = ["build.template"]
+    expect_input = ["vsphere-template"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,19 @@
+build {
+    name       = "app"
+    depends_on = ["build.base"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+build {
+    name = "base"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
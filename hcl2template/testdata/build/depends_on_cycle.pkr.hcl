@@ -0,0 +1,20 @@
+build {
+    name       = "app"
+    depends_on = ["build.base"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+build {
+    name       = "base"
+    depends_on = ["build.app"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
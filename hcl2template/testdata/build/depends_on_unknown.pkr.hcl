@@ -0,0 +1,11 @@
+build {
+    name       = "app"
+    depends_on = ["build.base"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
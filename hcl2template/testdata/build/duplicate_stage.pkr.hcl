@@ -0,0 +1,18 @@
+build {
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204"
+    ]
+
+    stage "harden" {
+        provisioner "shell" {
+        }
+    }
+
+    stage "harden" {
+        provisioner "file" {
+        }
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
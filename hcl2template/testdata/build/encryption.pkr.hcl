@@ -0,0 +1,12 @@
+build {
+    name               = "encrypted"
+    require_encryption = true
+    allowed_kms_keys   = ["alias/images"]
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,21 @@
+build {
+    name = "hooked"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    pre_build {
+        inline = ["./warm-cache.sh"]
+    }
+
+    post_build {
+        inline            = ["./notify.sh $PACKER_ARTIFACT_ID"]
+        shell             = "bash"
+        env               = { CHANNEL = "images" }
+        working_directory = "scripts"
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,12 @@
+build {
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    pre_build {
+        inline = []
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
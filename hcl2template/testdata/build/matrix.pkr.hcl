@@ -0,0 +1,16 @@
+build {
+    name = "images"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    matrix {
+        region     = ["us-east-1", "eu-west-1"]
+        os_version = ["22.04", "24.04"]
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+    string = "${matrix.region}/${matrix.os_version}"
+}
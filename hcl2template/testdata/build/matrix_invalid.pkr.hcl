@@ -0,0 +1,12 @@
+build {
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    matrix {
+        region = ["us-east-1", "us-east-1"]
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
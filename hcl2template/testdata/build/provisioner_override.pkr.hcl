@@ -0,0 +1,36 @@
+build {
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+        "source.amazon-ebs.ubuntu-1604",
+    ]
+
+    provisioner "shell" {
+        name = "install"
+    }
+
+    provisioner "file" {
+        name = "configure"
+    }
+
+    override "source.amazon-ebs.*" {
+        provisioner "file" {
+            replace = "install"
+        }
+
+        provisioner "shell" {
+            append = "configure"
+        }
+    }
+
+    override "source.virtualbox-iso.ubuntu-1204" {
+        provisioner "file" {
+            prepend = "install"
+        }
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
+
+source "amazon-ebs" "ubuntu-1604" {
+}
@@ -0,0 +1,18 @@
+build {
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    provisioner "shell" {
+        name = "install"
+    }
+
+    override "source.virtualbox-iso.ubuntu-1204" {
+        provisioner "file" {
+            replace = "configure"
+        }
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
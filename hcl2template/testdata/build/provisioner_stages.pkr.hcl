@@ -0,0 +1,22 @@
+// starts resources to provision them.
+build {
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204"
+    ]
+
+    provisioner "shell" {
+    }
+
+    stage "harden" {
+        provisioner "shell" {
+        }
+        provisioner "file" {
+        }
+    }
+
+    provisioner "file" {
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,15 @@
+build {
+    name = "flaky"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    retries {
+        attempts = 3
+        backoff  = "30s"
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,14 @@
+build {
+    name = "flaky"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+
+    retries {
+        attempts = 0
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
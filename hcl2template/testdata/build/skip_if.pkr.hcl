@@ -0,0 +1,21 @@
+variable "build_arm" {
+  type    = bool
+  default = false
+}
+
+build {
+  name    = "amd64"
+  sources = ["source.virtualbox-iso.ubuntu-1204"]
+}
+
+build {
+  name    = "arm64"
+  skip_if = !var.build_arm
+  sources = ["source.amazon-ebs.ubuntu-1604"]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
+
+source "amazon-ebs" "ubuntu-1604" {
+}
@@ -0,0 +1,7 @@
+build {
+  skip_if = "sometimes"
+  sources = ["source.virtualbox-iso.ubuntu-1204"]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
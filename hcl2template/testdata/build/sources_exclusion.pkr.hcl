@@ -0,0 +1,12 @@
+build {
+    sources = [
+        "source.*",
+        "!source.amazon-ebs.*",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
+
+source "amazon-ebs" "ubuntu-1604" {
+}
@@ -0,0 +1,11 @@
+build {
+    name    = "bounded"
+    timeout = "90m"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
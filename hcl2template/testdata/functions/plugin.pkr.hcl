@@ -0,0 +1,21 @@
+
+variable "image_name" {
+  type    = string
+  default = "my-image"
+  validation {
+    condition     = mock_valid_name(var.image_name)
+    error_message = "The image_name value must be a valid image name."
+  }
+}
+
+locals {
+  image_name = mock_valid_name(var.image_name) ? upper(var.image_name) : ""
+}
+
+source "null" "example" {
+  communicator = "none"
+}
+
+build {
+  sources = ["source.null.example"]
+}
@@ -0,0 +1,18 @@
+build {
+    name = "bucket-slug"
+
+    hcp_packer_registry {
+        build_labels = {
+            "python_version" = "3.0"
+            "image_id"       = build.ID
+            "source"         = "${source.name}-${build.ID}"
+        }
+    }
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
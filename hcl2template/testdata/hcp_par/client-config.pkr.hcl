@@ -0,0 +1,17 @@
+build {
+    name = "bucket-slug"
+
+    hcp_packer_registry {
+        fingerprint   = "template-fingerprint"
+        client_id     = "template-client-id"
+        client_secret = "template-client-secret"
+        api_host      = "api.hcp.example.com"
+    }
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
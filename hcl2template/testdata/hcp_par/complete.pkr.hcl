@@ -11,6 +11,17 @@ Some description
         build_labels = {
             "python_version" = "3.0"
         }
+        iteration_labels = {
+            "release" = "1.2.0"
+        }
+        fingerprint_collision = "new"
+        expires_after = "720h"
+        wait_for_concurrent_builds = "30m"
+        lock_iteration = true
+        pipeline {
+            parent_bucket  = "hardened-base"
+            parent_channel = "production"
+        }
     }
 
     sources = [
@@ -0,0 +1,24 @@
+data "hcp-packer-iteration" "parent" {
+  bucket_name = "bucket-slug"
+  channel     = "production"
+}
+
+data "hcp-packer-iteration" "other" {
+  bucket_name = "other-bucket-slug"
+  channel     = "production"
+}
+
+build {
+  name = "bucket-slug"
+
+  hcp_packer_registry {
+    description = "Some description"
+  }
+
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204",
+  ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,13 @@
+build {
+  name = "bucket-slug"
+  hcp_packer_registry {
+    owner {
+      components = ["virtualbox-iso.ubuntu-1204"]
+      team       = "images"
+    }
+    owner {
+      components = ["virtualbox-iso.ubuntu-1204"]
+      team       = "desktop"
+    }
+  }
+}
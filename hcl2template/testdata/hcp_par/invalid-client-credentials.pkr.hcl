@@ -0,0 +1,6 @@
+build {
+  name = "bucket-slug"
+  hcp_packer_registry {
+    client_id = "template-client-id"
+  }
+}
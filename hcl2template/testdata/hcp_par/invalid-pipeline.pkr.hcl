@@ -0,0 +1,10 @@
+build {
+  name = "bucket-slug"
+  hcp_packer_registry {
+    pipeline {
+      parent_bucket       = "hardened-base"
+      parent_iteration_id = "01FHGF3M2AK4TS6PCZES4VX2ED"
+      parent_channel      = "production"
+    }
+  }
+}
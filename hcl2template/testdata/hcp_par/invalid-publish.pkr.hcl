@@ -0,0 +1,12 @@
+build {
+  name = "bucket-slug"
+  hcp_packer_registry {
+    publish {
+      channel = "prod"
+    }
+    publish {
+      channel          = "prod"
+      require_approval = true
+    }
+  }
+}
@@ -0,0 +1,8 @@
+build {
+  name = "bucket-slug"
+  hcp_packer_registry {
+    target "oci" {
+      path = "registry.example.com/images"
+    }
+  }
+}
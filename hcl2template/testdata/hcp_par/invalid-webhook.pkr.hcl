@@ -0,0 +1,9 @@
+build {
+  name = "bucket-slug"
+  hcp_packer_registry {
+    on_complete_webhook {
+      url    = "ftp://example.com/hook"
+      secret = "s3cr3t"
+    }
+  }
+}
@@ -0,0 +1,24 @@
+build {
+    name = "bucket-slug"
+
+    hcp_packer_registry {
+        owner {
+            team         = "images"
+            contact      = "images@example.com"
+            pipeline_url = "https://ci.example.com/images/pipelines/42"
+        }
+
+        owner {
+            components = ["virtualbox-iso.ubuntu-1204"]
+            team       = "desktop"
+            contact    = "desktop@example.com"
+        }
+    }
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
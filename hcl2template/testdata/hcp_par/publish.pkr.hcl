@@ -0,0 +1,24 @@
+build {
+    name = "bucket-slug"
+
+    hcp_packer_registry {
+        publish {
+            channel = "dev"
+        }
+        publish {
+            channel          = "prod"
+            require_approval = true
+            approval_webhook {
+                url    = "https://example.com/approve"
+                secret = "s3cr3t"
+            }
+        }
+    }
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
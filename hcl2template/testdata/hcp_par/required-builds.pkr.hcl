@@ -0,0 +1,14 @@
+build {
+    name = "bucket-slug"
+
+    hcp_packer_registry {
+        required_builds = ["virtualbox-iso.ubuntu-1204"]
+    }
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
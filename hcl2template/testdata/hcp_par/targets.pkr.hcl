@@ -0,0 +1,18 @@
+build {
+    name = "bucket-slug"
+
+    hcp_packer_registry {
+        target_failure = "all"
+
+        target "file" {
+            path = "registry"
+        }
+    }
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204",
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
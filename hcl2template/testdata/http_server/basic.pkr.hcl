@@ -0,0 +1,17 @@
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+http_server "boot" {
+  address = "127.0.0.1"
+  content = {
+    "/ks.cfg" = "rootpw ${var.password}"
+  }
+  tls   = true
+  token = true
+}
+
+locals {
+  ks_url = "${http_server.boot.url}/ks.cfg?token=${http_server.boot.token}"
+}
@@ -0,0 +1,12 @@
+http_server "boot" {
+  directory = "http"
+  content = {
+    "/ks.cfg" = "rootpw packer"
+  }
+  templates = {
+    "/user-data" = "user-data.pkrtpl.hcl"
+  }
+  port_min     = 9000
+  port_max     = 8000
+  tls_key_file = "server.key"
+}
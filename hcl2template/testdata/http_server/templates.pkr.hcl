@@ -0,0 +1,24 @@
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+locals {
+  user = "packer"
+}
+
+http_server "boot" {
+  address = "127.0.0.1"
+  token   = true
+  templates = {
+    "user-data" = "${path.root}/user-data.pkrtpl.hcl"
+  }
+}
+
+source "null" "test" {
+  communicator = "none"
+}
+
+build {
+  sources = ["source.null.test"]
+}
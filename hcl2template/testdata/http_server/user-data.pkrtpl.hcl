@@ -0,0 +1,3 @@
+user: ${local.user}
+password: ${var.password}
+key: ${build.SSHPublicKey}
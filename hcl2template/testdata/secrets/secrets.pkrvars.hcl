@@ -0,0 +1 @@
+ssh_password = "vagrant"
@@ -0,0 +1,5 @@
+region = "eu-west-1"
+db = {
+  user     = "admin"
+  password = "hunter22"
+}
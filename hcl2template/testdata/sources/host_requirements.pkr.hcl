@@ -0,0 +1,13 @@
+source "virtualbox-iso" "ubuntu-1204" {
+    host_requirements {
+        virtualization = ["kvm"]
+        min_memory     = "8GB"
+        min_free_disk  = "512MB"
+        disk_path      = "output"
+        commands       = ["qemu-img"]
+    }
+}
+
+build {
+    sources = ["source.virtualbox-iso.ubuntu-1204"]
+}
@@ -0,0 +1,6 @@
+source "virtualbox-iso" "ubuntu-1204" {
+    host_requirements {
+        virtualization = ["warp-drive"]
+        min_memory     = "a lot"
+    }
+}
@@ -0,0 +1,4 @@
+source "virtualbox-iso" "ubuntu-1204" {
+    serial_group = "host-1"
+    string       = "string"
+}
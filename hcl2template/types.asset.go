@@ -0,0 +1,542 @@
+package hcl2template
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-getter/v2"
+	urlhelper "github.com/hashicorp/go-getter/v2/helper/url"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/packer-plugin-sdk/filelock"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// AssetBlock references an HCL 'asset' block: an external file, like an ISO
+// or a driver, that is downloaded and verified once before any build starts.
+type AssetBlock struct {
+	Name string
+
+	// URLs are tried in order until one of them succeeds.
+	URLs []string
+	// Checksum is a go-getter checksum, ex: "sha256:abc..." or
+	// "file:https://example.com/SHA256SUMS". "none" disables verification.
+	Checksum string
+	// CacheKey is the name of the file in the assets cache folder. Assets
+	// sharing a cache key are only downloaded once.
+	CacheKey string
+
+	// Path is where the asset will be stored, it is known as soon as the
+	// block is evaluated, before the asset is fetched.
+	Path string
+
+	// known is false when the block depends on values that are not known
+	// yet, for example a data source during validation.
+	known bool
+	block *hcl.Block
+}
+
+type Assets map[string]*AssetBlock
+
+var assetBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "url"},
+		{Name: "urls"},
+		{Name: "checksum", Required: true},
+		{Name: "cache_key"},
+	},
+}
+
+// Values returns the cty values of the assets, for use in an eval context:
+//
+//	asset.<name>.path
+func (assets Assets) Values() map[string]cty.Value {
+	res := map[string]cty.Value{}
+	for name, asset := range assets {
+		if !asset.known {
+			res[name] = cty.ObjectVal(map[string]cty.Value{
+				"path": cty.UnknownVal(cty.String),
+			})
+			continue
+		}
+		res[name] = cty.ObjectVal(map[string]cty.Value{
+			"path": cty.StringVal(filepath.ToSlash(asset.Path)),
+		})
+	}
+	return res
+}
+
+func (p *Parser) decodeAssetBlock(block *hcl.Block) (*AssetBlock, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	asset := &AssetBlock{
+		Name:  block.Labels[0],
+		block: block,
+	}
+
+	if !hclsyntax.ValidIdentifier(asset.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid asset name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		})
+	}
+
+	return asset, diags
+}
+
+func (p *Parser) decodeAssets(file *hcl.File, cfg *PackerConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	content, moreDiags := file.Body.Content(configSchema)
+	diags = append(diags, moreDiags...)
+
+	for _, block := range content.Blocks {
+		if block.Type != assetLabel {
+			continue
+		}
+		asset, moreDiags := p.decodeAssetBlock(block)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		if existing, found := cfg.Assets[asset.Name]; found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate " + assetLabel + " block",
+				Detail: fmt.Sprintf("This "+assetLabel+" block has the "+
+					"same name as a previous block declared at %s. Each "+
+					assetLabel+" must have a unique name.",
+					existing.block.DefRange.Ptr()),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		if cfg.Assets == nil {
+			cfg.Assets = Assets{}
+		}
+		cfg.Assets[asset.Name] = asset
+	}
+
+	return diags
+}
+
+// evaluateAssets evaluates the attributes of the asset blocks and sets where
+// each asset will be stored. Assets can use input variables and data
+// sources.
+func (cfg *PackerConfig) evaluateAssets() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	ectx := cfg.EvalContext(DatasourceContext, nil)
+	for _, asset := range cfg.Assets {
+		diags = append(diags, asset.evaluate(ectx)...)
+	}
+	return diags
+}
+
+func (asset *AssetBlock) evaluate(ectx *hcl.EvalContext) hcl.Diagnostics {
+	content, diags := asset.block.Body.Content(assetBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	asset.known = true
+	decode := func(name string, ty cty.Type, v interface{}) {
+		attr, ok := content.Attributes[name]
+		if !ok {
+			return
+		}
+		val, moreDiags := attr.Expr.Value(ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return
+		}
+		if !val.IsWhollyKnown() {
+			asset.known = false
+			return
+		}
+		val, err := convert.Convert(val, ty)
+		if err == nil {
+			err = gocty.FromCtyValue(val, v)
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %q value", name),
+				Detail:   err.Error(),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+		}
+	}
+
+	var url string
+	decode("url", cty.String, &url)
+	decode("urls", cty.List(cty.String), &asset.URLs)
+	decode("checksum", cty.String, &asset.Checksum)
+	decode("cache_key", cty.String, &asset.CacheKey)
+	if diags.HasErrors() || !asset.known {
+		return diags
+	}
+
+	if url != "" {
+		asset.URLs = append([]string{url}, asset.URLs...)
+	}
+	if len(asset.URLs) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing asset URL",
+			Detail:   "One of url or urls must be set.",
+			Subject:  asset.block.DefRange.Ptr(),
+		})
+	}
+	if asset.Checksum == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing asset checksum",
+			Detail: "A checksum is required to verify the asset, ex: " +
+				`"sha256:..." or "file:https://example.com/SHA256SUMS". ` +
+				`Set it to "none" to skip the verification.`,
+			Subject: asset.block.DefRange.Ptr(),
+		})
+	}
+	key := asset.CacheKey
+	if key != "" && (filepath.Base(key) != key || key == "." || key == "..") {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid asset cache_key",
+			Detail:   "The cache_key is a file name and cannot contain path separators.",
+			Subject:  content.Attributes["cache_key"].Expr.Range().Ptr(),
+		})
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	if key == "" {
+		key = defaultAssetCacheKey(asset.URLs[0], asset.Checksum)
+	}
+	p, err := packersdk.CachePath("assets", key)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to compute the asset cache path",
+			Detail:   err.Error(),
+			Subject:  asset.block.DefRange.Ptr(),
+		})
+		return diags
+	}
+	asset.Path = p
+
+	return diags
+}
+
+// defaultAssetCacheKey mimics the cache naming of the download step of the
+// builders: the sha1 of the checksum, or of the URL when the asset is not
+// verified, followed by the extension of the downloaded file.
+func defaultAssetCacheKey(url, checksum string) string {
+	var sum [20]byte
+	if checksum != "none" {
+		sum = sha1.Sum([]byte(checksum))
+	} else {
+		sum = sha1.Sum([]byte(url))
+	}
+	key := hex.EncodeToString(sum[:])
+
+	if u, err := urlhelper.Parse(url); err == nil {
+		key += path.Ext(u.Path)
+	}
+	return key
+}
+
+var assetsGetterClient = getter.Client{
+	Getters: getter.Getters,
+}
+
+// FetchAssets downloads and verifies the assets of the builds in parallel.
+// Assets that are already cached with the expected checksum are not
+// downloaded again, and assets sharing a cache path are only downloaded once.
+func (cfg *PackerConfig) FetchAssets(ctx context.Context, opts packer.FetchAssetsOptions) hcl.Diagnostics {
+	if len(cfg.Assets) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(cfg.Assets))
+	for name := range cfg.Assets {
+		if opts.Builds != nil && !cfg.buildsReferenceAsset(opts.Builds, name) {
+			log.Printf("[INFO] not fetching asset %q: the builds do not reference it", name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Assets are grouped by path, the first asset of each group is fetched
+	// and the others share its file.
+	var paths []string
+	groups := map[string][]*AssetBlock{}
+	for _, name := range names {
+		asset := cfg.Assets[name]
+		if _, found := groups[asset.Path]; !found {
+			paths = append(paths, asset.Path)
+		}
+		groups[asset.Path] = append(groups[asset.Path], asset)
+	}
+
+	errs := make(map[*AssetBlock]error, len(names))
+	var l sync.Mutex
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		wg.Add(1)
+		go func(group []*AssetBlock) {
+			defer wg.Done()
+			err := group[0].fetch(ctx, opts.Ui, cfg.Cwd)
+			l.Lock()
+			defer l.Unlock()
+			errs[group[0]] = err
+			for _, asset := range group[1:] {
+				switch {
+				case asset.Checksum != group[0].Checksum:
+					errs[asset] = fmt.Errorf("the asset is stored at the same path as asset %q, "+
+						"with a different checksum; set a different cache_key", group[0].Name)
+				case err != nil:
+					errs[asset] = err
+				default:
+					opts.Ui.Say(fmt.Sprintf("Asset %q is available at %s", asset.Name, asset.Path))
+				}
+			}
+		}(groups[path])
+	}
+	wg.Wait()
+
+	var diags hcl.Diagnostics
+	for _, name := range names {
+		asset := cfg.Assets[name]
+		err := errs[asset]
+		if err == nil {
+			continue
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Failed to fetch asset %q", asset.Name),
+			Detail:   err.Error(),
+			Subject:  asset.block.DefRange.Ptr(),
+		})
+	}
+	return diags
+}
+
+// buildsReferenceAsset tells whether one of the builds references the asset,
+// or may reference it when its references are unknown.
+func (cfg *PackerConfig) buildsReferenceAsset(builds []string, asset string) bool {
+	for _, build := range builds {
+		refs, found := cfg.buildAssets[build]
+		if !found || refs == nil {
+			return true
+		}
+		for _, ref := range refs {
+			if ref == asset {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assetReferences returns the names of the assets the build of srcUsage
+// references, from its source, its build block or the local variables they
+// use. It returns nil when a block is not native HCL, like in JSON templates,
+// as its references are then unknown.
+func (cfg *PackerConfig) assetReferences(build *BuildBlock, srcUsage SourceUseBlock, src SourceBlock) []string {
+	srcBlock := cfg.syntaxBlock(src.block.DefRange)
+	buildBlock := cfg.syntaxBlock(build.HCL2Ref.DefRange)
+	if srcBlock == nil || buildBlock == nil {
+		return nil
+	}
+	// The source blocks of the build block are used by other builds, except
+	// for the ones of srcUsage.
+	traversals := bodyTraversals(srcBlock.Body, "")
+	traversals = append(traversals, bodyTraversals(buildBlock.Body, srcUsage.SourceRef.String())...)
+
+	locals := map[string]*LocalBlock{}
+	for _, local := range cfg.LocalBlocks {
+		locals[local.Name] = local
+	}
+	refs := []string{}
+	seen := map[string]bool{}
+	for len(traversals) > 0 {
+		traversal := traversals[0]
+		traversals = traversals[1:]
+		ref := traversal.RootName() + "." + traversalAttr(traversal, 1)
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		switch traversal.RootName() {
+		case assetAccessor:
+			if name := traversalAttr(traversal, 1); name != "" {
+				refs = append(refs, name)
+			}
+		case localsAccessor:
+			if local, found := locals[traversalAttr(traversal, 1)]; found {
+				traversals = append(traversals, local.Expr.Variables()...)
+			}
+		}
+	}
+	return refs
+}
+
+// syntaxBlock returns the native HCL block defined at rng in the files of the
+// config, or nil if there is none.
+func (cfg *PackerConfig) syntaxBlock(rng hcl.Range) *hclsyntax.Block {
+	for _, file := range cfg.files {
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.DefRange() == rng {
+				return block
+			}
+		}
+	}
+	return nil
+}
+
+// bodyTraversals returns the variables used by the attributes of body and its
+// nested blocks. When source is set, the source blocks of body are skipped,
+// except for the ones using source.
+func bodyTraversals(body *hclsyntax.Body, source string) []hcl.Traversal {
+	var traversals []hcl.Traversal
+	for _, attr := range body.Attributes {
+		traversals = append(traversals, attr.Expr.Variables()...)
+	}
+	for _, block := range body.Blocks {
+		if source != "" && block.Type == buildSourceLabel && (len(block.Labels) == 0 || block.Labels[0] != source) {
+			continue
+		}
+		traversals = append(traversals, bodyTraversals(block.Body, "")...)
+	}
+	return traversals
+}
+
+// assetLockRetryDelay is how often the lock of an asset fetched by another
+// Packer process is tried again.
+var assetLockRetryDelay = time.Second
+
+// lock locks the asset against the other Packer processes fetching it, and
+// tells whether one of them held the lock, in which case it likely just
+// fetched the asset.
+func (asset *AssetBlock) lock(ctx context.Context, ui packersdk.Ui) (unlock func(), waited bool, err error) {
+	lock := filelock.New(asset.Path + ".lock")
+	for {
+		locked, err := lock.TryLock()
+		if err != nil {
+			return nil, waited, err
+		}
+		if locked {
+			return func() { _ = lock.Unlock() }, waited, nil
+		}
+		if !waited {
+			ui.Say(fmt.Sprintf("Waiting for another Packer process fetching asset %q...", asset.Name))
+			waited = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, waited, ctx.Err()
+		case <-time.After(assetLockRetryDelay):
+		}
+	}
+}
+
+func (asset *AssetBlock) fetch(ctx context.Context, ui packersdk.Ui, pwd string) error {
+	if !asset.known {
+		return fmt.Errorf("the asset depends on values that are not known")
+	}
+
+	unlock, waited, err := asset.lock(ctx, ui)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// An asset that is not verified can't be told apart from a partial
+	// download, it is only reused when another process just fetched it.
+	// Verified assets are checked by the download.
+	if waited && asset.Checksum == "none" {
+		if _, err := os.Stat(asset.Path); err == nil {
+			ui.Say(fmt.Sprintf("Asset %q was fetched by another Packer process, it is available at %s", asset.Name, asset.Path))
+			return nil
+		}
+	}
+
+	var errs []string
+	for _, source := range asset.URLs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := asset.download(ctx, ui, pwd, source)
+		if err == nil {
+			// The asset is evicted from the cache after the ones used less
+			// recently, and can be verified by packer cache verify.
+			if err := cache.Touch(asset.Path); err != nil {
+				log.Printf("[WARN] failed to track asset %q in the cache: %s", asset.Name, err)
+			}
+			ui.Say(fmt.Sprintf("Asset %q is available at %s", asset.Name, asset.Path))
+			return nil
+		}
+		// another URL may work
+		errs = append(errs, fmt.Sprintf("%s: %s", source, err))
+	}
+	// A partial download must not be reused by the processes waiting for it.
+	if asset.Checksum == "none" {
+		if err := os.Remove(asset.Path); err != nil && !os.IsNotExist(err) {
+			ui.Error(fmt.Sprintf("Failed to remove %s, please remove it manually", asset.Path))
+		}
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "\n"))
+}
+
+func (asset *AssetBlock) download(ctx context.Context, ui packersdk.Ui, pwd, source string) error {
+	u, err := urlhelper.Parse(source)
+	if err != nil {
+		return fmt.Errorf("url parse: %s", err)
+	}
+	if asset.Checksum != "none" {
+		// go-getter verifies the checksum and skips the download when the
+		// cached file already matches it.
+		q := u.Query()
+		q.Set("checksum", asset.Checksum)
+		u.RawQuery = q.Encode()
+	}
+
+	log.Printf("[INFO] fetching asset %q from %s", asset.Name, u.String())
+	_, err = assetsGetterClient.Get(ctx, &getter.Request{
+		Src:              u.String(),
+		Dst:              asset.Path,
+		Pwd:              pwd,
+		GetMode:          getter.ModeFile,
+		Copy:             true,
+		ProgressListener: ui,
+	})
+	if _, ok := err.(*getter.ChecksumError); ok {
+		if rmErr := os.Remove(asset.Path); rmErr != nil && !os.IsNotExist(rmErr) {
+			ui.Error(fmt.Sprintf("Failed to remove %s, please remove it manually", asset.Path))
+		}
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package hcl2template
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPackerConfig_FetchAssets(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("PACKER_CACHE_DIR", cacheDir)
+
+	iso := filepath.Join(t.TempDir(), "source.iso")
+	if err := os.WriteFile(iso, []byte("iso content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("iso content"))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	expectedPath := filepath.Join(cacheDir, "assets", "test.iso")
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"valid checksum", checksum, false},
+		{"invalid checksum", "sha256:" + hex.EncodeToString(make([]byte, 32)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(expectedPath)
+
+			cfg, diags := getBasicParser().Parse("testdata/assets/basic.pkr.hcl", nil, map[string]string{
+				"iso_url":      iso,
+				"iso_checksum": tt.checksum,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected parse errors: %s", diags)
+			}
+			diags = cfg.Initialize(packer.InitializeOptions{})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected initialize errors: %s", diags)
+			}
+
+			// The path is known before the asset is fetched.
+			local := cfg.LocalVariables["iso_path"].Value()
+			if got := local.AsString(); got != filepath.ToSlash(expectedPath) {
+				t.Errorf("expected asset.iso.path to be %q, got %q", expectedPath, got)
+			}
+
+			diags = cfg.FetchAssets(context.Background(), packer.FetchAssetsOptions{Ui: packer.TestUi(t)})
+			if tt.wantErr {
+				if !diags.HasErrors() {
+					t.Fatalf("expected the checksum verification to fail")
+				}
+				if _, err := os.Stat(expectedPath); !os.IsNotExist(err) {
+					t.Errorf("expected the corrupted asset to be removed")
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected fetch errors: %s", diags)
+			}
+			b, err := os.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatalf("expected the asset to be cached: %s", err)
+			}
+			if string(b) != "iso content" {
+				t.Errorf("unexpected asset content %q", b)
+			}
+		})
+	}
+}
+
+func Test_defaultAssetCacheKey(t *testing.T) {
+	a := defaultAssetCacheKey("https://example.com/ubuntu.iso?foo=bar", "sha256:abc")
+	b := defaultAssetCacheKey("https://mirror.example.com/ubuntu.iso", "sha256:abc")
+	if a != b {
+		t.Errorf("expected assets with the same checksum to share a cache key, got %q and %q", a, b)
+	}
+	if filepath.Ext(a) != ".iso" {
+		t.Errorf("expected the cache key to keep the extension, got %q", a)
+	}
+	if defaultAssetCacheKey("https://example.com/a.iso", "none") == defaultAssetCacheKey("https://example.com/b.iso", "none") {
+		t.Errorf("expected unverified assets to be keyed by URL")
+	}
+}
+
+func TestPackerConfig_FetchAssets_shared(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("PACKER_CACHE_DIR", cacheDir)
+	expectedPath := filepath.Join(cacheDir, "assets", "shared.iso")
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&requests, 1)
+		}
+		_, _ = w.Write([]byte("iso content"))
+	}))
+	defer server.Close()
+
+	fetch := func(t *testing.T, vars map[string]string) hcl.Diagnostics {
+		vars["iso_url"] = server.URL + "/shared.iso"
+		cfg, diags := getBasicParser().Parse("testdata/assets/shared.pkr.hcl", nil, vars)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected parse errors: %s", diags)
+		}
+		if diags := cfg.Initialize(packer.InitializeOptions{}); diags.HasErrors() {
+			t.Fatalf("unexpected initialize errors: %s", diags)
+		}
+		// Downloads over HTTP track their progress.
+		ui := packer.TestUi(t).(*packersdk.BasicUi)
+		ui.PB = &packersdk.NoopProgressTracker{}
+		return cfg.FetchAssets(context.Background(), packer.FetchAssetsOptions{Ui: ui})
+	}
+
+	t.Run("assets sharing a path are downloaded once", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		os.Remove(expectedPath)
+		if diags := fetch(t, map[string]string{}); diags.HasErrors() {
+			t.Fatalf("unexpected fetch errors: %s", diags)
+		}
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Errorf("expected the shared asset to be downloaded once, got %d downloads", n)
+		}
+	})
+
+	t.Run("assets sharing a path with different checksums", func(t *testing.T) {
+		os.Remove(expectedPath)
+		diags := fetch(t, map[string]string{"iso_checksum": "sha256:" + hex.EncodeToString(make([]byte, 32))})
+		if len(diags) != 1 || !strings.Contains(diags[0].Detail, "different checksum") {
+			t.Fatalf("expected the conflicting asset to be reported, got %s", diags)
+		}
+	})
+
+	t.Run("waits for another process fetching the asset", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		os.Remove(expectedPath)
+		defer func(delay time.Duration) { assetLockRetryDelay = delay }(assetLockRetryDelay)
+		assetLockRetryDelay = 10 * time.Millisecond
+
+		lock := flock.New(expectedPath + ".lock")
+		if err := lock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_ = os.WriteFile(expectedPath, []byte("iso content"), 0644)
+			_ = lock.Unlock()
+		}()
+		if diags := fetch(t, map[string]string{}); diags.HasErrors() {
+			t.Fatalf("unexpected fetch errors: %s", diags)
+		}
+		if n := atomic.LoadInt32(&requests); n != 0 {
+			t.Errorf("expected the asset fetched by the other process to be reused, got %d downloads", n)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// artifactType is the type of the artifact of a build, as referenced by the
+// sources of the builds depending on it, for example `build.base.artifact.id`.
+var artifactType = cty.Object(map[string]cty.Type{
+	"id":         cty.String,
+	"builder_id": cty.String,
+	"files":      cty.List(cty.String),
+	"string":     cty.String,
+})
+
+func artifactValue(artifact packersdk.Artifact) cty.Value {
+	files := make([]cty.Value, 0, len(artifact.Files()))
+	for _, file := range artifact.Files() {
+		files = append(files, cty.StringVal(file))
+	}
+	filesVal := cty.ListValEmpty(cty.String)
+	if len(files) > 0 {
+		filesVal = cty.ListVal(files)
+	}
+	return cty.ObjectVal(map[string]cty.Value{
+		"id":         cty.StringVal(artifact.Id()),
+		"builder_id": cty.StringVal(artifact.BuilderId()),
+		"files":      filesVal,
+		"string":     cty.StringVal(artifact.String()),
+	})
+}
+
+// upstreamReferences returns the references of a source to the builds its
+// build depends on. Other builds cannot be referenced: only the builds listed
+// in depends_on are part of the build variable of the source, see
+// upstreamBuildValues.
+func (cfg *PackerConfig) upstreamReferences(build *BuildBlock, source SourceUseBlock, spec hcldec.Spec) ([]hcl.Traversal, hcl.Diagnostics) {
+	var refs []hcl.Traversal
+	var diags hcl.Diagnostics
+	for _, traversal := range hcldec.Variables(source.Body, spec) {
+		if traversal.RootName() != buildAccessor {
+			continue
+		}
+		name := traversalAttr(traversal, 1)
+		if traversalAttr(traversal, 2) == "artifact" {
+			if upstream := cfg.buildBlock(name); upstream != nil && len(upstream.Sources) != 1 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Ambiguous reference to the artifact of %s.%s", buildAccessor, name),
+					Detail: fmt.Sprintf("The %s %q has %d sources, reference the artifact of one of them "+
+						"with `%s.%s.artifacts[\"<type>.<name>\"]`.", buildLabel, name, len(upstream.Sources), buildAccessor, name),
+					Subject: traversal.SourceRange().Ptr(),
+				})
+				continue
+			}
+		}
+		refs = append(refs, traversal)
+	}
+	return refs, diags
+}
+
+func traversalAttr(traversal hcl.Traversal, i int) string {
+	if len(traversal) <= i {
+		return ""
+	}
+	if attr, ok := traversal[i].(hcl.TraverseAttr); ok {
+		return attr.Name
+	}
+	return ""
+}
+
+func (cfg *PackerConfig) buildBlock(name string) *BuildBlock {
+	for _, build := range cfg.Builds {
+		if build.Name == name {
+			return build
+		}
+	}
+	return nil
+}
+
+// upstreamBuildValues returns the value of the build variable in the sources
+// of a build depending on other builds: for each of these builds, their
+// artifact and their artifacts by source. The artifacts are unknown until the
+// builds completed, when artifacts is nil.
+func upstreamBuildValues(build *BuildBlock, artifacts map[string]map[string][]packersdk.Artifact) cty.Value {
+	values := map[string]cty.Value{}
+	for _, name := range build.DependsOn {
+		if artifacts == nil {
+			values[name] = cty.ObjectVal(map[string]cty.Value{
+				"artifact":  cty.UnknownVal(artifactType),
+				"artifacts": cty.UnknownVal(cty.Map(artifactType)),
+			})
+			continue
+		}
+
+		bySource := map[string]cty.Value{}
+		for source, sourceArtifacts := range artifacts[name] {
+			// The final artifact of the build, once post-processed.
+			if len(sourceArtifacts) == 0 {
+				bySource[source] = cty.NullVal(artifactType)
+				continue
+			}
+			bySource[source] = artifactValue(sourceArtifacts[len(sourceArtifacts)-1])
+		}
+		artifact := cty.NullVal(artifactType)
+		artifactsVal := cty.MapValEmpty(artifactType)
+		if len(bySource) > 0 {
+			artifactsVal = cty.MapVal(bySource)
+		}
+		if len(bySource) == 1 {
+			for _, v := range bySource {
+				artifact = v
+			}
+		}
+		values[name] = cty.ObjectVal(map[string]cty.Value{
+			"artifact":  artifact,
+			"artifacts": artifactsVal,
+		})
+	}
+	return cty.ObjectVal(values)
+}
+
+// dependencyResolver returns the packer.CoreBuild.ResolveDependencies function
+// of pcb, restarting its builder with the artifacts referenced by refs.
+func (cfg *PackerConfig) dependencyResolver(build *BuildBlock, source SourceUseBlock, refs []hcl.Traversal, pcb *packer.CoreBuild) func(map[string]map[string][]packersdk.Artifact) error {
+	return func(artifacts map[string]map[string][]packersdk.Artifact) error {
+		for _, ref := range refs {
+			name := traversalAttr(ref, 1)
+			if _, ok := artifacts[name]; !ok {
+				return fmt.Errorf("the artifacts of %s.%s are referenced but it is not part of this run", buildAccessor, name)
+			}
+		}
+
+		ectx := cfg.EvalContext(BuildContext, map[string]cty.Value{
+			buildAccessor: upstreamBuildValues(build, artifacts),
+		})
+		builder, diags, _, hash := cfg.startBuilder(source, pcb.TempDir, ectx)
+		if diags.HasErrors() {
+			return diags
+		}
+		if rb, ok := pcb.Builder.(*packer.RegistryBuilder); ok {
+			rb.Builder = builder
+		} else {
+			pcb.Builder = builder
+		}
+		pcb.BuilderInputHash = hash
+		return nil
+	}
+}
@@ -1,7 +1,12 @@
 package hcl2template
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/hashicorp/hcl/v2"
 )
 
 func sourceRefFromString(in string) SourceRef {
@@ -18,3 +23,139 @@ func sourceRefFromString(in string) SourceRef {
 		Name: args[1],
 	}
 }
+
+// sourcePattern is a glob pattern matching sources by their `type.name`, used
+// in the sources list of a build block and in override blocks.
+type sourcePattern struct {
+	// pattern is the pattern as written, for diagnostics.
+	pattern string
+	glob    glob.Glob
+}
+
+// isSourcePattern tells whether an entry of the sources list of a build block
+// is a glob pattern rather than a source reference.
+func isSourcePattern(in string) bool {
+	return strings.HasPrefix(in, "!") || strings.ContainsAny(in, "*?[{")
+}
+
+// sourcePatternFromString compiles a source pattern. Like source references,
+// patterns can start with `source.`.
+func sourcePatternFromString(in string) (sourcePattern, error) {
+	pattern := in
+	for _, prefix := range []string{sourceLabel + ".", sourceLabel + "s."} {
+		pattern = strings.TrimPrefix(pattern, prefix)
+	}
+	g, err := glob.Compile(pattern)
+	if err != nil {
+		return sourcePattern{}, fmt.Errorf("invalid source pattern %q: %s", in, err)
+	}
+	return sourcePattern{pattern: in, glob: g}, nil
+}
+
+func (p sourcePattern) Match(source SourceUseBlock) bool {
+	return p.glob.Match(source.String())
+}
+
+// selectSources resolves the patterns of the sources lists of the build blocks
+// once all the source blocks are known: the sources matching a pattern are
+// added to the build, then the sources matching an exclusion pattern are
+// removed from it.
+func (cfg *PackerConfig) selectSources() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	refs := make([]SourceRef, 0, len(cfg.Sources))
+	for ref := range cfg.Sources {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+
+	for _, build := range cfg.Builds {
+		for _, pattern := range build.sourcePatterns {
+			matched := false
+			for _, ref := range refs {
+				source := SourceUseBlock{SourceRef: ref}
+				if !pattern.Match(source) {
+					continue
+				}
+				matched = true
+				if !build.hasSource(source) {
+					build.Sources = append(build.Sources, source)
+				}
+			}
+			if !matched {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("No %s matches %q", sourceLabel, pattern.pattern),
+					Detail:   fmt.Sprintf("Known: %v", listAvailableSourceNames(cfg.Sources)),
+					Subject:  build.HCL2Ref.DefRange.Ptr(),
+				})
+			}
+		}
+
+		if len(build.excludedSources) > 0 {
+			excluded := map[int]bool{}
+			var sources []SourceUseBlock
+			for _, source := range build.Sources {
+				keep := true
+				for i, pattern := range build.excludedSources {
+					if pattern.Match(source) {
+						excluded[i] = true
+						keep = false
+					}
+				}
+				if keep {
+					sources = append(sources, source)
+				}
+			}
+			for i, pattern := range build.excludedSources {
+				if !excluded[i] {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagWarning,
+						Summary:  fmt.Sprintf("The exclusion %q matches none of the sources of the build", "!"+pattern.pattern),
+						Subject:  build.HCL2Ref.DefRange.Ptr(),
+					})
+				}
+			}
+			build.Sources = sources
+		}
+
+		if build.Matrix != nil {
+			build.Sources = build.Matrix.expand(build.Sources)
+		}
+
+		for _, override := range build.ProvisionerOverrides {
+			matched := false
+			for _, source := range build.Sources {
+				if override.source.Match(source) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  fmt.Sprintf("The %s %q matches none of the sources of the build", buildOverrideLabel, override.Source),
+					Subject:  override.Provisioner.HCL2Ref.DefRange.Ptr(),
+				})
+			}
+		}
+
+		if cfg.bucket != nil && !build.Skip {
+			for _, source := range build.Sources {
+				cfg.bucket.RegisterBuildForComponent(source.String())
+			}
+		}
+	}
+	return diags
+}
+
+// hasSource tells whether the source is already started by the build, without
+// any local name.
+func (b *BuildBlock) hasSource(source SourceUseBlock) bool {
+	for _, existing := range b.Sources {
+		if existing.SourceRef == source.SourceRef && existing.LocalName == "" {
+			return true
+		}
+	}
+	return false
+}
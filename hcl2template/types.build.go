@@ -2,13 +2,17 @@ package hcl2template
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	packerregistry "github.com/hashicorp/packer/internal/registry"
 	"github.com/hashicorp/packer/internal/registry/env"
+	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 )
 
 const (
@@ -25,6 +29,18 @@ const (
 	buildPostProcessorsLabel = "post-processors"
 
 	buildHCPPackerRegistryLabel = "hcp_packer_registry"
+
+	buildStageLabel = "stage"
+
+	buildOverrideLabel = "override"
+
+	buildRetriesLabel = "retries"
+
+	buildMatrixLabel = "matrix"
+
+	buildPreBuildLabel = "pre_build"
+
+	buildPostBuildLabel = "post_build"
 )
 
 var buildSchema = &hcl.BodySchema{
@@ -36,6 +52,18 @@ var buildSchema = &hcl.BodySchema{
 		{Type: buildPostProcessorLabel, LabelNames: []string{"type"}},
 		{Type: buildPostProcessorsLabel, LabelNames: []string{}},
 		{Type: buildHCPPackerRegistryLabel},
+		{Type: buildStageLabel, LabelNames: []string{"name"}},
+		{Type: buildOverrideLabel, LabelNames: []string{"source"}},
+		{Type: buildRetriesLabel},
+		{Type: buildMatrixLabel},
+		{Type: buildPreBuildLabel},
+		{Type: buildPostBuildLabel},
+	},
+}
+
+var stageSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: buildProvisionerLabel, LabelNames: []string{"type"}},
 	},
 }
 
@@ -50,9 +78,20 @@ var postProcessorsSchema = &hcl.BodySchema{
 //	build {
 //		sources = [
 //			...
+//			"!excluded.*",
 //		]
 //		provisioner "" { ... }
+//		stage "name" {
+//			provisioner "" { ... }
+//		}
+//		override "source.type.name" {
+//			provisioner "" { ... }
+//		}
 //		post-processor "" { ... }
+//		retries { ... }
+//		matrix { ... }
+//		pre_build { ... }
+//		post_build { ... }
 //	}
 type BuildBlock struct {
 	// Name is a string representing the named build to show in the logs
@@ -68,10 +107,32 @@ type BuildBlock struct {
 	// Sources is the list of sources that we want to start in this build block.
 	Sources []SourceUseBlock
 
+	// sourcePatterns are the glob patterns of the sources list, and
+	// excludedSources its patterns prefixed with `!`. They select sources once
+	// all the source blocks are known, see selectSources.
+	sourcePatterns  []sourcePattern
+	excludedSources []sourcePattern
+
+	// DependsOn lists the names of the build blocks whose builds must all
+	// succeed before the builds of this block start.
+	DependsOn []string
+
+	// ExpectInput lists the types of artifacts the builds of this block
+	// consume, and Provides the types of artifacts they produce, like
+	// "vsphere-template". They let the chain of dependencies be verified
+	// before anything runs, see checkBuildContracts.
+	ExpectInput []string
+	Provides    []string
+
 	// ProvisionerBlocks references a list of HCL provisioner block that will
-	// will be ran against the sources.
+	// will be ran against the sources. The provisioners of stage blocks are
+	// part of the list, see ProvisionerBlock.Stage.
 	ProvisionerBlocks []*ProvisionerBlock
 
+	// ProvisionerOverrides change the provisioners run for some of the
+	// sources, see provisionersFor.
+	ProvisionerOverrides []*ProvisionerOverride
+
 	// ErrorCleanupProvisionerBlock references a special provisioner block that
 	// will be ran only if the provision step fails.
 	ErrorCleanupProvisionerBlock *ProvisionerBlock
@@ -81,6 +142,38 @@ type BuildBlock struct {
 	// steps.
 	PostProcessorsLists [][]*PostProcessorBlock
 
+	// Retries is the retry policy of the builds when their builder fails,
+	// if any.
+	Retries *RetriesBlock
+
+	// Timeout is how long each build of the block can run, if set.
+	Timeout time.Duration
+
+	// Priority orders the builds of the block among the others, the builds
+	// of higher priority start first.
+	Priority int
+
+	// PreBuild and PostBuild are the local commands run before each build of
+	// the block starts, and once it succeeded.
+	PreBuild  []packer.LocalCommand
+	PostBuild []packer.LocalCommand
+
+	// EncryptionPolicy is what the block requires of the encryption of the
+	// images of its builds, if anything.
+	EncryptionPolicy *packer.EncryptionPolicy
+
+	// Tags select the builds of the block with -only, -except and -tag, along
+	// with the tags of their sources.
+	Tags []string
+
+	// Skip is set when the skip_if expression of the block is true: none of
+	// its builds run.
+	Skip bool
+
+	// Matrix expands each source into one build per combination of its
+	// values, if set. Sources are expanded once selected, see selectSources.
+	Matrix *MatrixBlock
+
 	HCL2Ref HCL2Ref
 }
 
@@ -93,10 +186,21 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 	body := block.Body
 
 	var b struct {
-		Name        string   `hcl:"name,optional"`
-		Description string   `hcl:"description,optional"`
-		FromSources []string `hcl:"sources,optional"`
-		Config      hcl.Body `hcl:",remain"`
+		Name        string         `hcl:"name,optional"`
+		Description string         `hcl:"description,optional"`
+		FromSources []string       `hcl:"sources,optional"`
+		DependsOn   []string       `hcl:"depends_on,optional"`
+		ExpectInput []string       `hcl:"expect_input,optional"`
+		Provides    []string       `hcl:"provides,optional"`
+		Timeout     string         `hcl:"timeout,optional"`
+		SkipIf      hcl.Expression `hcl:"skip_if,optional"`
+		Tags        []string       `hcl:"tags,optional"`
+		Priority    int            `hcl:"priority,optional"`
+
+		RequireEncryption bool     `hcl:"require_encryption,optional"`
+		AllowedKMSKeys    []string `hcl:"allowed_kms_keys,optional"`
+
+		Config hcl.Body `hcl:",remain"`
 	}
 	diags := gohcl.DecodeBody(body, cfg.EvalContext(LocalContext, nil), &b)
 	if diags.HasErrors() {
@@ -105,6 +209,41 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 
 	build.Name = b.Name
 	build.Description = b.Description
+	build.Tags = b.Tags
+	build.Priority = b.Priority
+	build.ExpectInput = b.ExpectInput
+	build.Provides = b.Provides
+	build.HCL2Ref = newHCL2Ref(block, b.Config)
+
+	skip, moreDiags := decodeSkipIf(b.SkipIf, cfg.EvalContext(LocalContext, nil))
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+	build.Skip = skip
+
+	if b.RequireEncryption || len(b.AllowedKMSKeys) > 0 {
+		build.EncryptionPolicy = &packer.EncryptionPolicy{
+			Required:       b.RequireEncryption,
+			AllowedKMSKeys: b.AllowedKMSKeys,
+		}
+	}
+
+	if b.Timeout != "" {
+		timeout, err := time.ParseDuration(b.Timeout)
+		if err == nil && timeout <= 0 {
+			err = fmt.Errorf("the timeout must be positive, got %s", b.Timeout)
+		}
+		if err != nil {
+			return nil, append(diags, &hcl.Diagnostic{
+				Summary:  "Failed to parse timeout duration",
+				Severity: hcl.DiagError,
+				Detail:   err.Error(),
+				Subject:  &block.DefRange,
+			})
+		}
+		build.Timeout = timeout
+	}
 
 	// Expose build.name during parsing of pps and provisioners
 	ectx := cfg.EvalContext(BuildContext, nil)
@@ -113,6 +252,26 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 	})
 
 	for _, buildFrom := range b.FromSources {
+		if isSourcePattern(buildFrom) {
+			exclude := strings.HasPrefix(buildFrom, "!")
+			pattern, err := sourcePatternFromString(strings.TrimPrefix(buildFrom, "!"))
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid " + sourceLabel + " pattern",
+					Detail:   err.Error(),
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			if exclude {
+				build.excludedSources = append(build.excludedSources, pattern)
+			} else {
+				build.sourcePatterns = append(build.sourcePatterns, pattern)
+			}
+			continue
+		}
+
 		ref := sourceRefFromString(buildFrom)
 
 		if ref == NoSource ||
@@ -134,14 +293,38 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 		build.Sources = append(build.Sources, SourceUseBlock{SourceRef: ref})
 	}
 
+	for _, dependency := range b.DependsOn {
+		name := strings.TrimPrefix(dependency, buildLabel+".")
+		if name == dependency || name == "" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid " + buildLabel + " reference",
+				Detail: fmt.Sprintf("depends_on references the builds by their name, "+
+					"like `%s.<name>`, got %q.", buildLabel, dependency),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		build.DependsOn = append(build.DependsOn, name)
+	}
+
 	body = b.Config
 	content, moreDiags := body.Content(buildSchema)
 	diags = append(diags, moreDiags...)
 	if diags.HasErrors() {
 		return nil, diags
 	}
+	stages := map[string]*hcl.Block{}
 	for _, block := range content.Blocks {
 		switch block.Type {
+		case buildStageLabel:
+			provisioners, moreDiags := p.decodeStage(block, stages, ectx)
+			diags = append(diags, moreDiags...)
+			build.ProvisionerBlocks = append(build.ProvisionerBlocks, provisioners...)
+		case buildOverrideLabel:
+			overrides, moreDiags := p.decodeOverride(block, ectx)
+			diags = append(diags, moreDiags...)
+			build.ProvisionerOverrides = append(build.ProvisionerOverrides, overrides...)
 		case buildHCPPackerRegistryLabel:
 			if build.HCPPackerRegistry != nil {
 				diags = append(diags, &hcl.Diagnostic{
@@ -157,6 +340,47 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 				continue
 			}
 			build.HCPPackerRegistry = hcpPackerRegistry
+		case buildRetriesLabel:
+			if build.Retries != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Only one " + buildRetriesLabel + " block is allowed"),
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			retries, moreDiags := p.decodeRetries(block, ectx)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			build.Retries = retries
+		case buildMatrixLabel:
+			if build.Matrix != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Only one " + buildMatrixLabel + " block is allowed"),
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			matrix, moreDiags := p.decodeMatrix(block, ectx)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			build.Matrix = matrix
+		case buildPreBuildLabel, buildPostBuildLabel:
+			command, moreDiags := p.decodeLocalCommand(block, ectx)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			if block.Type == buildPreBuildLabel {
+				build.PreBuild = append(build.PreBuild, command)
+			} else {
+				build.PostBuild = append(build.PostBuild, command)
+			}
 		case sourceLabel:
 			ref, moreDiags := p.decodeBuildSource(block)
 			diags = append(diags, moreDiags...)
@@ -217,14 +441,19 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 			}
 		}
 	}
+	diags = append(diags, build.checkOverrides()...)
 
 	// Creates a bucket if either a hcp_packer_registry block is set or the HCP
 	// Packer registry is enabled via environment variable
 	if build.HCPPackerRegistry != nil || env.IsPAREnabled() {
-		var err error
-		cfg.bucket, err = packerregistry.NewBucketWithIteration(packerregistry.IterationOptions{
+		opts := packerregistry.IterationOptions{
 			TemplateBaseDir: cfg.Basedir,
-		})
+		}
+		if build.HCPPackerRegistry != nil {
+			opts.Fingerprint = build.HCPPackerRegistry.Fingerprint
+		}
+		var err error
+		cfg.bucket, err = packerregistry.NewBucketWithIteration(opts)
 
 		if err != nil {
 			diags = append(diags, &hcl.Diagnostic{
@@ -239,6 +468,17 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 		cfg.bucket.LoadDefaultSettingsFromEnv()
 		build.HCPPackerRegistry.WriteToBucketConfig(cfg.bucket)
 
+		cfg.bucket.ClientConfig, err = build.HCPPackerRegistry.ClientConfig()
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Summary:  "Invalid HCP Packer Registry client configuration",
+				Detail:   err.Error(),
+				Severity: hcl.DiagError,
+			})
+
+			return build, diags
+		}
+
 		// If at this point the bucket.Slug is still empty,
 		// last try is to use the build.Name if present
 		if cfg.bucket.Slug == "" && build.Name != "" {
@@ -249,11 +489,229 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 		if cfg.bucket.Description == "" {
 			cfg.bucket.Description = build.Description
 		}
+		// The builds of the bucket are registered once its sources are
+		// selected, see selectSources.
+	}
+
+	return build, diags
+}
 
-		for _, source := range build.Sources {
-			cfg.bucket.RegisterBuildForComponent(source.String())
+// decodeSkipIf evaluates the skip_if expression of a build block. An unknown
+// value, like the output of a data source that was not executed, does not
+// skip the builds, so that they are still validated.
+func decodeSkipIf(expr hcl.Expression, ectx *hcl.EvalContext) (bool, hcl.Diagnostics) {
+	if expr == nil {
+		return false, nil
+	}
+	value, diags := expr.Value(ectx)
+	if diags.HasErrors() || value.IsNull() {
+		return false, diags
+	}
+	value, err := convert.Convert(value, cty.Bool)
+	if err != nil {
+		return false, append(diags, &hcl.Diagnostic{
+			Summary:  "Invalid skip_if value",
+			Severity: hcl.DiagError,
+			Detail:   fmt.Sprintf("skip_if must be a boolean: %s", err),
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+	if !value.IsKnown() {
+		return false, diags
+	}
+	return value.True(), diags
+}
+
+// decodeStage decodes the provisioners of a 'stage' block of a build. A stage
+// groups provisioners: incremental builds snapshot the machine after each stage
+// instead of after each provisioner. seen records the stages of the build, by
+// name.
+func (p *Parser) decodeStage(block *hcl.Block, seen map[string]*hcl.Block, ectx *hcl.EvalContext) ([]*ProvisionerBlock, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	name := block.Labels[0]
+	if !hclsyntax.ValidIdentifier(name) {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + buildStageLabel + " name",
+			Detail: "A " + buildStageLabel + " name must start with a letter and " +
+				"may contain only letters, digits, underscores, and dashes.",
+			Subject: block.LabelRanges[0].Ptr(),
+		})
+	}
+	if previous, ok := seen[name]; ok {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Duplicate %s %q", buildStageLabel, name),
+			Detail:   fmt.Sprintf("The %s %q was already defined at %s.", buildStageLabel, name, previous.DefRange),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+	seen[name] = block
+
+	content, moreDiags := block.Body.Content(stageSchema)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+	if len(content.Blocks) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("Empty %s %q", buildStageLabel, name),
+			Detail:   fmt.Sprintf("The %s %q has no provisioner, it is ignored.", buildStageLabel, name),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+
+	var provisioners []*ProvisionerBlock
+	for _, block := range content.Blocks {
+		pb, moreDiags := p.decodeProvisioner(block, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
 		}
+		pb.Stage = name
+		provisioners = append(provisioners, pb)
 	}
+	return provisioners, diags
+}
 
-	return build, diags
+// orderBuilds checks the dependencies between the build blocks, and sorts the
+// blocks so that each of them comes after the blocks it depends on. The order
+// of the blocks is kept otherwise.
+func (cfg *PackerConfig) orderBuilds() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	byName := map[string][]*BuildBlock{}
+	for _, build := range cfg.Builds {
+		if build.Name != "" {
+			byName[build.Name] = append(byName[build.Name], build)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[*BuildBlock]int{}
+	var ordered Builds
+	var visit func(build *BuildBlock, path []string) bool
+	visit = func(build *BuildBlock, path []string) bool {
+		switch state[build] {
+		case visited:
+			return true
+		case visiting:
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Cyclic " + buildLabel + " dependencies",
+				Detail: fmt.Sprintf("The %s blocks depend on each other: %s.",
+					buildLabel, strings.Join(append(path, build.Name), " -> ")),
+				Subject: build.HCL2Ref.DefRange.Ptr(),
+			})
+			return false
+		}
+
+		state[build] = visiting
+		for _, name := range build.DependsOn {
+			upstreams, found := byName[name]
+			if !found {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unknown " + buildLabel + " " + buildLabel + "." + name,
+					Detail:   fmt.Sprintf("No %s block is named %q.", buildLabel, name),
+					Subject:  build.HCL2Ref.DefRange.Ptr(),
+				})
+				continue
+			}
+			for _, upstream := range upstreams {
+				if !visit(upstream, append(path, build.Name)) {
+					return false
+				}
+			}
+		}
+		state[build] = visited
+		ordered = append(ordered, build)
+		return true
+	}
+
+	for _, build := range cfg.Builds {
+		if !visit(build, nil) {
+			return diags
+		}
+	}
+	if !diags.HasErrors() {
+		cfg.Builds = ordered
+	}
+	return diags
+}
+
+// checkBuildContracts verifies that the artifact types each build block
+// expects as input are provided by the blocks it depends on. Blocks that do
+// not declare what they provide cannot be verified, the chain is then only
+// reported as unverified.
+func (cfg *PackerConfig) checkBuildContracts() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	byName := map[string][]*BuildBlock{}
+	for _, build := range cfg.Builds {
+		if build.Name != "" {
+			byName[build.Name] = append(byName[build.Name], build)
+		}
+	}
+
+	for _, build := range cfg.Builds {
+		if len(build.ExpectInput) == 0 {
+			continue
+		}
+		if len(build.DependsOn) == 0 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unmet " + buildLabel + " input",
+				Detail: fmt.Sprintf("The %s block expects %s as input but depends "+
+					"on no other %s block; set depends_on to the blocks providing them.",
+					buildLabel, strings.Join(build.ExpectInput, ", "), buildLabel),
+				Subject: build.HCL2Ref.DefRange.Ptr(),
+			})
+			continue
+		}
+
+		provided := map[string]bool{}
+		var undeclared []string
+		for _, name := range build.DependsOn {
+			for _, upstream := range byName[name] {
+				if upstream.Provides == nil {
+					undeclared = append(undeclared, name)
+				}
+				for _, typ := range upstream.Provides {
+					provided[typ] = true
+				}
+			}
+		}
+		for _, typ := range build.ExpectInput {
+			if provided[typ] {
+				continue
+			}
+			if len(undeclared) > 0 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Unverified " + buildLabel + " input",
+					Detail: fmt.Sprintf("The %s block expects %q as input, which is "+
+						"provided by none of the blocks declaring what they provide; "+
+						"%s.%s does not set provides, so the chain cannot be verified.",
+						buildLabel, typ, buildLabel, undeclared[0]),
+					Subject: build.HCL2Ref.DefRange.Ptr(),
+				})
+				continue
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unmet " + buildLabel + " input",
+				Detail: fmt.Sprintf("The %s block expects %q as input, but none of "+
+					"the blocks it depends on provides it: %s.",
+					buildLabel, typ, strings.Join(build.DependsOn, ", ")),
+				Subject: build.HCL2Ref.DefRange.Ptr(),
+			})
+		}
+	}
+	return diags
 }
@@ -2,10 +2,15 @@ package hcl2template
 
 import (
 	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 )
 
 type HCPPackerRegistryBlock struct {
@@ -17,6 +22,48 @@ type HCPPackerRegistryBlock struct {
 	BucketLabels map[string]string
 	// Build labels
 	BuildLabels map[string]string
+	// Iteration labels
+	IterationLabels map[string]string
+	// Webhook notified once all the builds of the iteration are done
+	OnCompleteWebhook *packerregistry.Webhook
+	// Channels the complete iteration is promoted to
+	Publish []packerregistry.PublishRule
+	// Pipeline the iteration is a stage of
+	Pipeline *packerregistry.Pipeline
+	// What to do when an iteration already exists for the fingerprint
+	FingerprintCollision packerregistry.FingerprintCollision
+	// Delay after which the iteration should be rotated
+	ExpiresAfter time.Duration
+	// How long to wait for the builds running in another Packer run
+	WaitForConcurrentBuilds time.Duration
+	// Fail when another Packer run is running builds of the iteration
+	LockIteration bool
+	// Registries receiving the completed builds besides HCP Packer
+	Targets []packerregistry.Target
+	// Which failures to publish a build fail it
+	TargetFailure packerregistry.TargetFailurePolicy
+	// What to do when only some of the builds run, like with -only
+	PartialRun packerregistry.PartialRun
+	// Builds required for the iteration to be complete, all when empty
+	RequiredBuilds []string
+	// Owner of the components without an owner of their own
+	Owner *packerregistry.Owner
+	// Owners of the components, by component type
+	ComponentOwners map[string]*packerregistry.Owner
+	// Fingerprint of the iteration
+	Fingerprint string
+	// Credentials of the HCP service principal
+	ClientID     string
+	ClientSecret string
+	// Endpoints of the HCP API
+	APIHost string
+	AuthURL string
+
+	// buildLabels is the build_labels expression. When some labels reference
+	// values only known once a build completed, like build.ID, it is
+	// evaluated again at that time, see resolveBuildLabels.
+	buildLabels hcl.Expression
+	evalContext *hcl.EvalContext
 
 	HCL2Ref
 }
@@ -28,6 +75,23 @@ func (b *HCPPackerRegistryBlock) WriteToBucketConfig(bucket *packerregistry.Buck
 	bucket.Description = b.Description
 	bucket.BucketLabels = b.BucketLabels
 	bucket.BuildLabels = b.BuildLabels
+	bucket.IterationLabels = b.IterationLabels
+	bucket.OnCompleteWebhook = b.OnCompleteWebhook
+	bucket.Publish = b.Publish
+	bucket.Pipeline = b.Pipeline
+	bucket.FingerprintCollision = b.FingerprintCollision
+	bucket.ExpiresAfter = b.ExpiresAfter
+	bucket.ConcurrentBuildsWait = b.WaitForConcurrentBuilds
+	bucket.LockIteration = b.LockIteration
+	bucket.Targets = b.Targets
+	bucket.TargetFailure = b.TargetFailure
+	bucket.PartialRun = b.PartialRun
+	bucket.RequiredBuilds = b.RequiredBuilds
+	bucket.Owner = b.Owner
+	bucket.ComponentOwners = b.ComponentOwners
+	if b.buildLabels != nil {
+		bucket.BuildLabelsResolver = b.resolveBuildLabels
+	}
 	// If there's already a Slug this was set from env variable.
 	// In Packer, env variable overrides config values so we keep it that way for consistency.
 	if bucket.Slug == "" && b.Slug != "" {
@@ -35,6 +99,38 @@ func (b *HCPPackerRegistryBlock) WriteToBucketConfig(bucket *packerregistry.Buck
 	}
 }
 
+// ClientConfig returns the configuration of the client to the HCP Packer
+// registry: the configuration read from the environment, overridden by the
+// credentials and endpoints set in the block. It returns nil when the block
+// sets none of them, the client is then configured from the environment only.
+func (b *HCPPackerRegistryBlock) ClientConfig() (*packerregistry.ClientConfig, error) {
+	if b == nil || (b.ClientID == "" && b.APIHost == "" && b.AuthURL == "") {
+		return nil, nil
+	}
+	cfg, err := packerregistry.ClientConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if b.ClientID != "" {
+		// The credentials of the template take precedence over a workload
+		// identity configured in the environment.
+		cfg.ClientID = b.ClientID
+		cfg.ClientSecret = b.ClientSecret
+		cfg.WorkloadIdentityProvider = ""
+		cfg.WorkloadIdentityToken = nil
+		if cfg.AuditLog != nil {
+			cfg.AuditLog.Actor.Principal = "client_id:" + b.ClientID
+		}
+	}
+	if b.APIHost != "" {
+		cfg.APIHost = b.APIHost
+	}
+	if b.AuthURL != "" {
+		cfg.AuthURL = b.AuthURL
+	}
+	return &cfg, nil
+}
+
 func (p *Parser) decodeHCPRegistry(block *hcl.Block, cfg *PackerConfig) (*HCPPackerRegistryBlock, hcl.Diagnostics) {
 	par := &HCPPackerRegistryBlock{}
 	body := block.Body
@@ -43,16 +139,67 @@ func (p *Parser) decodeHCPRegistry(block *hcl.Block, cfg *PackerConfig) (*HCPPac
 		Slug        string `hcl:"bucket_name,optional"`
 		Description string `hcl:"description,optional"`
 		//Deprecated labels for bucket_labels
-		Labels       map[string]string `hcl:"labels,optional"`
-		BucketLabels map[string]string `hcl:"bucket_labels,optional"`
-		BuildLabels  map[string]string `hcl:"build_labels,optional"`
-		Config       hcl.Body          `hcl:",remain"`
+		Labels               map[string]string `hcl:"labels,optional"`
+		BucketLabels         map[string]string `hcl:"bucket_labels,optional"`
+		BuildLabels          hcl.Expression    `hcl:"build_labels,optional"`
+		IterationLabels      map[string]string `hcl:"iteration_labels,optional"`
+		FingerprintCollision string            `hcl:"fingerprint_collision,optional"`
+		ExpiresAfter         string            `hcl:"expires_after,optional"`
+		WaitForConcurrent    string            `hcl:"wait_for_concurrent_builds,optional"`
+		LockIteration        bool              `hcl:"lock_iteration,optional"`
+		TargetFailure        string            `hcl:"target_failure,optional"`
+		PartialRun           string            `hcl:"partial_run,optional"`
+		RequiredBuilds       []string          `hcl:"required_builds,optional"`
+		Fingerprint          string            `hcl:"fingerprint,optional"`
+		ClientID             string            `hcl:"client_id,optional"`
+		ClientSecret         string            `hcl:"client_secret,optional"`
+		APIHost              string            `hcl:"api_host,optional"`
+		AuthURL              string            `hcl:"auth_url,optional"`
+
+		Webhook *registryWebhookBlock `hcl:"on_complete_webhook,block"`
+		Publish []struct {
+			Channel         string                `hcl:"channel"`
+			RequireApproval bool                  `hcl:"require_approval,optional"`
+			ApprovalWebhook *registryWebhookBlock `hcl:"approval_webhook,block"`
+		} `hcl:"publish,block"`
+		Pipeline *struct {
+			ParentBucket      string `hcl:"parent_bucket"`
+			ParentIterationID string `hcl:"parent_iteration_id,optional"`
+			ParentChannel     string `hcl:"parent_channel,optional"`
+			Stage             int    `hcl:"stage,optional"`
+		} `hcl:"pipeline,block"`
+		Targets []struct {
+			Type string   `hcl:"type,label"`
+			Body hcl.Body `hcl:",remain"`
+		} `hcl:"target,block"`
+		Owners []struct {
+			Components  []string `hcl:"components,optional"`
+			Team        string   `hcl:"team,optional"`
+			Contact     string   `hcl:"contact,optional"`
+			PipelineURL string   `hcl:"pipeline_url,optional"`
+		} `hcl:"owner,block"`
+		Config hcl.Body `hcl:",remain"`
 	}
 	diags := gohcl.DecodeBody(body, cfg.EvalContext(LocalContext, nil), &b)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
+	// Build labels can reference the data generated by a build, which is
+	// unknown until the build completes.
+	ectx := cfg.EvalContext(LocalContext, map[string]cty.Value{
+		buildAccessor: cty.DynamicVal,
+	})
+	buildLabels, deferred, moreDiags := evaluateBuildLabels(b.BuildLabels, ectx)
+	diags = append(diags, moreDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if deferred {
+		par.buildLabels = b.BuildLabels
+		par.evalContext = ectx
+	}
+
 	if len(b.Description) > 255 {
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
@@ -84,7 +231,400 @@ func (p *Parser) decodeHCPRegistry(block *hcl.Block, cfg *PackerConfig) (*HCPPac
 	}
 
 	par.BucketLabels = b.BucketLabels
-	par.BuildLabels = b.BuildLabels
+	par.BuildLabels = buildLabels
+	par.IterationLabels = b.IterationLabels
+
+	par.FingerprintCollision = packerregistry.FingerprintCollision(b.FingerprintCollision)
+	if err := par.FingerprintCollision.Validate(); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s.fingerprint_collision", buildHCPPackerRegistryLabel),
+			Detail:   err.Error(),
+			Subject:  block.DefRange.Ptr(),
+		})
+		return nil, diags
+	}
+
+	par.PartialRun = packerregistry.PartialRun(b.PartialRun)
+	if err := par.PartialRun.Validate(); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s.partial_run", buildHCPPackerRegistryLabel),
+			Detail:   err.Error(),
+			Subject:  block.DefRange.Ptr(),
+		})
+		return nil, diags
+	}
+
+	par.RequiredBuilds = b.RequiredBuilds
+
+	if b.ExpiresAfter != "" {
+		expiresAfter, err := time.ParseDuration(b.ExpiresAfter)
+		if err == nil && expiresAfter <= 0 {
+			err = fmt.Errorf("the duration must be positive")
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %s.expires_after", buildHCPPackerRegistryLabel),
+				Detail:   fmt.Sprintf("expires_after must be a duration like \"720h\": %s", err),
+				Subject:  block.DefRange.Ptr(),
+			})
+			return nil, diags
+		}
+		par.ExpiresAfter = expiresAfter
+	}
+
+	if b.WaitForConcurrent != "" {
+		wait, err := time.ParseDuration(b.WaitForConcurrent)
+		if err == nil && wait <= 0 {
+			err = fmt.Errorf("the duration must be positive")
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %s.wait_for_concurrent_builds", buildHCPPackerRegistryLabel),
+				Detail:   fmt.Sprintf("wait_for_concurrent_builds must be a duration like \"30m\": %s", err),
+				Subject:  block.DefRange.Ptr(),
+			})
+			return nil, diags
+		}
+		par.WaitForConcurrentBuilds = wait
+	}
+	par.LockIteration = b.LockIteration
+
+	if (b.ClientID == "") != (b.ClientSecret == "") {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("%s.client_id and %[1]s.client_secret must be set together", buildHCPPackerRegistryLabel),
+			Subject:  block.DefRange.Ptr(),
+		})
+		return nil, diags
+	}
+	if b.ClientSecret != "" {
+		packer.Secrets.Register(b.ClientSecret)
+	}
+	if b.AuthURL != "" {
+		u, err := url.Parse(b.AuthURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("%s.auth_url must be an https URL", buildHCPPackerRegistryLabel),
+				Subject:  block.DefRange.Ptr(),
+			})
+			return nil, diags
+		}
+	}
+	par.Fingerprint = b.Fingerprint
+	par.ClientID = b.ClientID
+	par.ClientSecret = b.ClientSecret
+	par.APIHost = b.APIHost
+	par.AuthURL = b.AuthURL
+
+	if b.Webhook != nil {
+		webhook, moreDiags := b.Webhook.decode("on_complete_webhook", block)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return nil, diags
+		}
+		par.OnCompleteWebhook = webhook
+	}
+
+	for _, p := range b.Publish {
+		rule := packerregistry.PublishRule{
+			Channel:         p.Channel,
+			RequireApproval: p.RequireApproval,
+		}
+		if p.ApprovalWebhook != nil {
+			webhook, moreDiags := p.ApprovalWebhook.decode("publish.approval_webhook", block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				return nil, diags
+			}
+			rule.ApprovalWebhook = webhook
+		}
+		par.Publish = append(par.Publish, rule)
+	}
+	if err := packerregistry.ValidatePublishRules(par.Publish); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s.publish", buildHCPPackerRegistryLabel),
+			Detail:   err.Error(),
+			Subject:  block.DefRange.Ptr(),
+		})
+		return nil, diags
+	}
+
+	if b.Pipeline != nil {
+		pipeline := &packerregistry.Pipeline{
+			ParentBucket:      b.Pipeline.ParentBucket,
+			ParentIterationID: b.Pipeline.ParentIterationID,
+			ParentChannel:     b.Pipeline.ParentChannel,
+			Stage:             b.Pipeline.Stage,
+		}
+		if err := pipeline.Validate(); err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %s.pipeline", buildHCPPackerRegistryLabel),
+				Detail:   err.Error(),
+				Subject:  block.DefRange.Ptr(),
+			})
+			return nil, diags
+		}
+		par.Pipeline = pipeline
+	}
+
+	par.TargetFailure = packerregistry.TargetFailurePolicy(b.TargetFailure)
+	if err := par.TargetFailure.Validate(); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s.target_failure", buildHCPPackerRegistryLabel),
+			Detail:   err.Error(),
+			Subject:  block.DefRange.Ptr(),
+		})
+		return nil, diags
+	}
+
+	for _, t := range b.Targets {
+		target, moreDiags := decodeRegistryTarget(t.Type, t.Body, block, cfg.EvalContext(LocalContext, nil))
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return nil, diags
+		}
+		par.Targets = append(par.Targets, target)
+	}
+
+	for _, o := range b.Owners {
+		owner := &packerregistry.Owner{
+			Team:        o.Team,
+			Contact:     o.Contact,
+			PipelineURL: o.PipelineURL,
+		}
+		if len(o.Components) == 0 {
+			if par.Owner != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Duplicate %s.owner block", buildHCPPackerRegistryLabel),
+					Detail:   "Only one owner block can apply to all the components, set components on the others.",
+					Subject:  block.DefRange.Ptr(),
+				})
+				return nil, diags
+			}
+			par.Owner = owner
+			continue
+		}
+		if par.ComponentOwners == nil {
+			par.ComponentOwners = map[string]*packerregistry.Owner{}
+		}
+		for _, component := range o.Components {
+			if _, exists := par.ComponentOwners[component]; exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Duplicate %s.owner for %q", buildHCPPackerRegistryLabel, component),
+					Detail:   "A component can only have one owner.",
+					Subject:  block.DefRange.Ptr(),
+				})
+				return nil, diags
+			}
+			par.ComponentOwners[component] = owner
+		}
+	}
 
 	return par, diags
 }
+
+// registryWebhookBlock is a webhook of the hcp_packer_registry block, like
+// on_complete_webhook.
+type registryWebhookBlock struct {
+	URL    string `hcl:"url"`
+	Secret string `hcl:"secret"`
+}
+
+// decode validates the webhook block named name of block.
+func (w *registryWebhookBlock) decode(name string, block *hcl.Block) (*packerregistry.Webhook, hcl.Diagnostics) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("%s.%s.url must be an http or https URL", buildHCPPackerRegistryLabel, name),
+			Subject:  block.DefRange.Ptr(),
+		}}
+	}
+	if w.Secret == "" {
+		return nil, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("%s.%s.secret cannot be empty, it is used to sign the payloads", buildHCPPackerRegistryLabel, name),
+			Subject:  block.DefRange.Ptr(),
+		}}
+	}
+	packer.Secrets.Register(w.Secret)
+	return &packerregistry.Webhook{URL: w.URL, Secret: w.Secret}, nil
+}
+
+// decodeRegistryTarget decodes a target block of the hcp_packer_registry
+// block, a registry receiving the completed builds besides HCP Packer. For
+// example:
+//
+//	target "file" {
+//		path = "/var/lib/packer/registry"
+//	}
+func decodeRegistryTarget(targetType string, body hcl.Body, block *hcl.Block, ectx *hcl.EvalContext) (packerregistry.Target, hcl.Diagnostics) {
+	switch targetType {
+	case "file":
+		var b struct {
+			Path string `hcl:"path"`
+		}
+		diags := gohcl.DecodeBody(body, ectx, &b)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		if b.Path == "" {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("%s.target.path cannot be empty", buildHCPPackerRegistryLabel),
+				Subject:  block.DefRange.Ptr(),
+			})
+		}
+		return &packerregistry.FileTarget{Path: b.Path}, diags
+	}
+	return nil, hcl.Diagnostics{&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Unknown %s.target type %q", buildHCPPackerRegistryLabel, targetType),
+		Detail:   `The supported target types are: "file".`,
+		Subject:  block.DefRange.Ptr(),
+	}}
+}
+
+// evaluateBuildLabels evaluates the build_labels expression and returns the
+// labels whose value is known. deferred is true when some labels are not known
+// yet and the expression has to be evaluated again once the build completed.
+func evaluateBuildLabels(expr hcl.Expression, ectx *hcl.EvalContext) (labels map[string]string, deferred bool, diags hcl.Diagnostics) {
+	val, diags := expr.Value(ectx)
+	if diags.HasErrors() || val.IsNull() {
+		return nil, false, diags
+	}
+
+	val, err := convert.Convert(val, cty.Map(cty.String))
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s.build_labels", buildHCPPackerRegistryLabel),
+			Detail:   fmt.Sprintf("build_labels must be a map of strings: %s", err),
+			Subject:  expr.Range().Ptr(),
+		})
+		return nil, false, diags
+	}
+
+	if !val.IsKnown() {
+		return nil, true, diags
+	}
+
+	labels = map[string]string{}
+	for k, v := range val.AsValueMap() {
+		if !v.IsKnown() {
+			deferred = true
+			continue
+		}
+		if v.IsNull() {
+			continue
+		}
+		labels[k] = v.AsString()
+	}
+	return labels, deferred, diags
+}
+
+// resolveBuildLabels evaluates the build labels once the build referred to by
+// componentType completed, generatedData being the data generated by the build.
+func (b *HCPPackerRegistryBlock) resolveBuildLabels(componentType string, generatedData map[string]interface{}) (map[string]string, error) {
+	buildValues := map[string]cty.Value{}
+	for k, v := range generatedData {
+		val, err := ConvertPluginConfigValueToHCLValue(v)
+		if err != nil {
+			return nil, err
+		}
+		buildValues[k] = val
+	}
+
+	ref := sourceRefFromString(componentType)
+	ectx := b.evalContext.NewChild()
+	ectx.Variables = map[string]cty.Value{
+		buildAccessor: cty.ObjectVal(buildValues),
+		sourcesAccessor: cty.ObjectVal(map[string]cty.Value{
+			"type": cty.StringVal(ref.Type),
+			"name": cty.StringVal(ref.Name),
+		}),
+	}
+
+	labels, deferred, diags := evaluateBuildLabels(b.buildLabels, ectx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if deferred {
+		return labels, fmt.Errorf("some build labels are still unknown once the build completed")
+	}
+	return labels, nil
+}
+
+// registryDatasourceTypes are the data sources reading from the HCP Packer
+// registry. They all take a bucket_name argument.
+var registryDatasourceTypes = []string{
+	"hcp-packer-image",
+	"hcp-packer-iteration",
+}
+
+// checkRegistryDatasourceAncestry looks for HCP Packer registry data sources
+// reading from the bucket this config publishes to. Data sources are all
+// evaluated before any build starts, so such a data source will never see the
+// images produced by the current run: it will either fail or resolve the
+// images of a previous iteration. Since this can be wanted, for example when
+// an image is rebuilt from its own previous version, a warning is returned
+// describing how to run the parent build beforehand.
+func (cfg *PackerConfig) checkRegistryDatasourceAncestry() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	if cfg.bucket == nil || cfg.bucket.Slug == "" {
+		return diags
+	}
+
+	ectx := cfg.EvalContext(DatasourceContext, nil)
+	for ref, ds := range cfg.Datasources {
+		isRegistryDatasource := false
+		for _, t := range registryDatasourceTypes {
+			if ref.Type == t {
+				isRegistryDatasource = true
+				break
+			}
+		}
+		if !isRegistryDatasource {
+			continue
+		}
+
+		attrs, _ := ds.block.Body.JustAttributes()
+		attr, ok := attrs["bucket_name"]
+		if !ok {
+			continue
+		}
+		value, moreDiags := attr.Expr.Value(ectx)
+		if moreDiags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() || !value.Type().Equals(cty.String) {
+			continue
+		}
+		if value.AsString() != cfg.bucket.Slug {
+			continue
+		}
+
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("data.%s.%s reads from the bucket published by this build", ref.Type, ref.Name),
+			Detail: fmt.Sprintf("The bucket %q is both published to and consumed by this configuration. "+
+				"Data sources are evaluated before any build starts, so this data source cannot return "+
+				"images produced during this run; it will resolve images from a previous iteration, "+
+				"or fail if none was published yet.\n"+
+				"If the builds consuming this data source depend on images built in this run, "+
+				"move the build publishing to %[1]q into its own template and run it to completion "+
+				"before this one.", cfg.bucket.Slug),
+			Subject: ds.block.DefRange.Ptr(),
+		})
+	}
+
+	return diags
+}
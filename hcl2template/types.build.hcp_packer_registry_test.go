@@ -2,8 +2,12 @@ package hcl2template
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	packer_registry "github.com/hashicorp/packer/internal/registry"
 	"github.com/hashicorp/packer/packer"
@@ -12,6 +16,12 @@ import (
 
 func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 	defaultParser := getBasicParser()
+	imagesOwner := &packer_registry.Owner{
+		Team:        "images",
+		Contact:     "images@example.com",
+		PipelineURL: "https://ci.example.com/images/pipelines/42",
+	}
+	desktopOwner := &packer_registry.Owner{Team: "desktop", Contact: "desktop@example.com"}
 
 	tests := []parseTest{
 		{"complete working build with hcp_packer_registry block",
@@ -28,9 +38,15 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 					&BuildBlock{
 						Name: "bucket-slug",
 						HCPPackerRegistry: &HCPPackerRegistryBlock{
-							Description:  "Some description\n",
-							BucketLabels: map[string]string{"foo": "bar"},
-							BuildLabels:  map[string]string{"python_version": "3.0"},
+							Description:             "Some description\n",
+							BucketLabels:            map[string]string{"foo": "bar"},
+							BuildLabels:             map[string]string{"python_version": "3.0"},
+							IterationLabels:         map[string]string{"release": "1.2.0"},
+							Pipeline:                &packer_registry.Pipeline{ParentBucket: "hardened-base", ParentChannel: "production"},
+							FingerprintCollision:    packer_registry.FingerprintCollisionNew,
+							ExpiresAfter:            720 * time.Hour,
+							WaitForConcurrentBuilds: 30 * time.Minute,
+							LockIteration:           true,
 						},
 						Sources: []SourceUseBlock{
 							{
@@ -54,10 +70,16 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 						Name:    "virtualbox-iso.ubuntu-1204",
 						Builder: emptyMockBuilder,
 						ArtifactMetadataPublisher: &packer_registry.Bucket{
-							Slug:         "bucket-slug",
-							Description:  "Some description\n",
-							BucketLabels: map[string]string{"foo": "bar"},
-							BuildLabels:  map[string]string{"python_version": "3.0"},
+							Slug:                 "bucket-slug",
+							Description:          "Some description\n",
+							BucketLabels:         map[string]string{"foo": "bar"},
+							BuildLabels:          map[string]string{"python_version": "3.0"},
+							IterationLabels:      map[string]string{"release": "1.2.0"},
+							Pipeline:             &packer_registry.Pipeline{ParentBucket: "hardened-base", ParentChannel: "production"},
+							FingerprintCollision: packer_registry.FingerprintCollisionNew,
+							ExpiresAfter:         720 * time.Hour,
+							ConcurrentBuildsWait: 30 * time.Minute,
+							LockIteration:        true,
 							Iteration: &packer_registry.Iteration{
 								Fingerprint: "ignored-fingerprint", // this will be different everytime so it's ignored
 							},
@@ -70,10 +92,16 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 								PostProcessor: &packer.RegistryPostProcessor{
 									BuilderType: "virtualbox-iso.ubuntu-1204",
 									ArtifactMetadataPublisher: &packer_registry.Bucket{
-										Slug:         "bucket-slug",
-										Description:  "Some description\n",
-										BucketLabels: map[string]string{"foo": "bar"},
-										BuildLabels:  map[string]string{"python_version": "3.0"},
+										Slug:                 "bucket-slug",
+										Description:          "Some description\n",
+										BucketLabels:         map[string]string{"foo": "bar"},
+										BuildLabels:          map[string]string{"python_version": "3.0"},
+										IterationLabels:      map[string]string{"release": "1.2.0"},
+										Pipeline:             &packer_registry.Pipeline{ParentBucket: "hardened-base", ParentChannel: "production"},
+										FingerprintCollision: packer_registry.FingerprintCollisionNew,
+										ExpiresAfter:         720 * time.Hour,
+										ConcurrentBuildsWait: 30 * time.Minute,
+										LockIteration:        true,
 										Iteration: &packer_registry.Iteration{
 											Fingerprint: "ignored-fingerprint",
 										},
@@ -91,10 +119,16 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 						Name:    "amazon-ebs.aws-ubuntu-16.04",
 						Builder: emptyMockBuilder,
 						ArtifactMetadataPublisher: &packer_registry.Bucket{
-							Slug:         "bucket-slug",
-							Description:  "Some description\n",
-							BucketLabels: map[string]string{"foo": "bar"},
-							BuildLabels:  map[string]string{"python_version": "3.0"},
+							Slug:                 "bucket-slug",
+							Description:          "Some description\n",
+							BucketLabels:         map[string]string{"foo": "bar"},
+							BuildLabels:          map[string]string{"python_version": "3.0"},
+							IterationLabels:      map[string]string{"release": "1.2.0"},
+							Pipeline:             &packer_registry.Pipeline{ParentBucket: "hardened-base", ParentChannel: "production"},
+							FingerprintCollision: packer_registry.FingerprintCollisionNew,
+							ExpiresAfter:         720 * time.Hour,
+							ConcurrentBuildsWait: 30 * time.Minute,
+							LockIteration:        true,
 							Iteration: &packer_registry.Iteration{
 								Fingerprint: "ignored-fingerprint", // this will be different everytime so it's ignored
 							},
@@ -107,10 +141,16 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 								PostProcessor: &packer.RegistryPostProcessor{
 									BuilderType: "amazon-ebs.aws-ubuntu-16.04",
 									ArtifactMetadataPublisher: &packer_registry.Bucket{
-										Slug:         "bucket-slug",
-										Description:  "Some description\n",
-										BucketLabels: map[string]string{"foo": "bar"},
-										BuildLabels:  map[string]string{"python_version": "3.0"},
+										Slug:                 "bucket-slug",
+										Description:          "Some description\n",
+										BucketLabels:         map[string]string{"foo": "bar"},
+										BuildLabels:          map[string]string{"python_version": "3.0"},
+										IterationLabels:      map[string]string{"release": "1.2.0"},
+										Pipeline:             &packer_registry.Pipeline{ParentBucket: "hardened-base", ParentChannel: "production"},
+										FingerprintCollision: packer_registry.FingerprintCollisionNew,
+										ExpiresAfter:         720 * time.Hour,
+										ConcurrentBuildsWait: 30 * time.Minute,
+										LockIteration:        true,
 										Iteration: &packer_registry.Iteration{
 											Fingerprint: "ignored-fingerprint",
 										},
@@ -581,6 +621,346 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 			},
 			false,
 		},
+		{"hcp_packer_registry block with targets",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/targets.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "bucket-slug",
+						HCPPackerRegistry: &HCPPackerRegistryBlock{
+							Targets:       []packer_registry.Target{&packer_registry.FileTarget{Path: "registry"}},
+							TargetFailure: packer_registry.TargetFailureAll,
+						},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName: "bucket-slug",
+					Type:      "virtualbox-iso.ubuntu-1204",
+					Prepared:  true,
+					Builder: &packer.RegistryBuilder{
+						Name:    "virtualbox-iso.ubuntu-1204",
+						Builder: emptyMockBuilder,
+						ArtifactMetadataPublisher: &packer_registry.Bucket{
+							Slug:          "bucket-slug",
+							Targets:       []packer_registry.Target{&packer_registry.FileTarget{Path: "registry"}},
+							TargetFailure: packer_registry.TargetFailureAll,
+							Iteration: &packer_registry.Iteration{
+								Fingerprint: "ignored-fingerprint", // this will be different everytime so it's ignored
+							},
+						},
+					},
+					Provisioners: []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{
+						{
+							{
+								PostProcessor: &packer.RegistryPostProcessor{
+									BuilderType: "virtualbox-iso.ubuntu-1204",
+									ArtifactMetadataPublisher: &packer_registry.Bucket{
+										Slug:          "bucket-slug",
+										Targets:       []packer_registry.Target{&packer_registry.FileTarget{Path: "registry"}},
+										TargetFailure: packer_registry.TargetFailureAll,
+										Iteration: &packer_registry.Iteration{
+											Fingerprint: "ignored-fingerprint",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{"hcp_packer_registry block with client settings",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/client-config.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "bucket-slug",
+						HCPPackerRegistry: &HCPPackerRegistryBlock{
+							Fingerprint:  "template-fingerprint",
+							ClientID:     "template-client-id",
+							ClientSecret: "template-client-secret",
+							APIHost:      "api.hcp.example.com",
+						},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName: "bucket-slug",
+					Type:      "virtualbox-iso.ubuntu-1204",
+					Prepared:  true,
+					Builder: &packer.RegistryBuilder{
+						Name:    "virtualbox-iso.ubuntu-1204",
+						Builder: emptyMockBuilder,
+						ArtifactMetadataPublisher: &packer_registry.Bucket{
+							Slug: "bucket-slug",
+							ClientConfig: &packer_registry.ClientConfig{
+								ClientID:     "template-client-id",
+								ClientSecret: "template-client-secret",
+								APIHost:      "api.hcp.example.com",
+							},
+							Iteration: &packer_registry.Iteration{
+								Fingerprint: "template-fingerprint",
+							},
+						},
+					},
+					Provisioners: []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{
+						{
+							{
+								PostProcessor: &packer.RegistryPostProcessor{
+									BuilderType: "virtualbox-iso.ubuntu-1204",
+									ArtifactMetadataPublisher: &packer_registry.Bucket{
+										Slug: "bucket-slug",
+										ClientConfig: &packer_registry.ClientConfig{
+											ClientID:     "template-client-id",
+											ClientSecret: "template-client-secret",
+											APIHost:      "api.hcp.example.com",
+										},
+										Iteration: &packer_registry.Iteration{
+											Fingerprint: "template-fingerprint",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{"hcp_packer_registry block with owners",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/owners.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "bucket-slug",
+						HCPPackerRegistry: &HCPPackerRegistryBlock{
+							Owner:           imagesOwner,
+							ComponentOwners: map[string]*packer_registry.Owner{"virtualbox-iso.ubuntu-1204": desktopOwner},
+						},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName: "bucket-slug",
+					Type:      "virtualbox-iso.ubuntu-1204",
+					Prepared:  true,
+					Builder: &packer.RegistryBuilder{
+						Name:    "virtualbox-iso.ubuntu-1204",
+						Builder: emptyMockBuilder,
+						ArtifactMetadataPublisher: &packer_registry.Bucket{
+							Slug:            "bucket-slug",
+							Owner:           imagesOwner,
+							ComponentOwners: map[string]*packer_registry.Owner{"virtualbox-iso.ubuntu-1204": desktopOwner},
+							Iteration: &packer_registry.Iteration{
+								Fingerprint: "ignored-fingerprint", // this will be different everytime so it's ignored
+							},
+						},
+					},
+					Provisioners: []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{
+						{
+							{
+								PostProcessor: &packer.RegistryPostProcessor{
+									BuilderType: "virtualbox-iso.ubuntu-1204",
+									ArtifactMetadataPublisher: &packer_registry.Bucket{
+										Slug:            "bucket-slug",
+										Owner:           imagesOwner,
+										ComponentOwners: map[string]*packer_registry.Owner{"virtualbox-iso.ubuntu-1204": desktopOwner},
+										Iteration: &packer_registry.Iteration{
+											Fingerprint: "ignored-fingerprint",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{"hcp_packer_registry block with required builds",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/required-builds.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "bucket-slug",
+						HCPPackerRegistry: &HCPPackerRegistryBlock{
+							RequiredBuilds: []string{"virtualbox-iso.ubuntu-1204"},
+						},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName: "bucket-slug",
+					Type:      "virtualbox-iso.ubuntu-1204",
+					Prepared:  true,
+					Builder: &packer.RegistryBuilder{
+						Name:    "virtualbox-iso.ubuntu-1204",
+						Builder: emptyMockBuilder,
+						ArtifactMetadataPublisher: &packer_registry.Bucket{
+							Slug:           "bucket-slug",
+							RequiredBuilds: []string{"virtualbox-iso.ubuntu-1204"},
+							Iteration: &packer_registry.Iteration{
+								Fingerprint: "ignored-fingerprint", // this will be different everytime so it's ignored
+							},
+						},
+					},
+					Provisioners: []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{
+						{
+							{
+								PostProcessor: &packer.RegistryPostProcessor{
+									BuilderType: "virtualbox-iso.ubuntu-1204",
+									ArtifactMetadataPublisher: &packer_registry.Bucket{
+										Slug:           "bucket-slug",
+										RequiredBuilds: []string{"virtualbox-iso.ubuntu-1204"},
+										Iteration: &packer_registry.Iteration{
+											Fingerprint: "ignored-fingerprint",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{"hcp_packer_registry block with publish rules",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/publish.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "bucket-slug",
+						HCPPackerRegistry: &HCPPackerRegistryBlock{
+							Publish: []packer_registry.PublishRule{
+								{Channel: "dev"},
+								{Channel: "prod", RequireApproval: true, ApprovalWebhook: &packer_registry.Webhook{
+									URL:    "https://example.com/approve",
+									Secret: "s3cr3t",
+								}},
+							},
+						},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName: "bucket-slug",
+					Type:      "virtualbox-iso.ubuntu-1204",
+					Prepared:  true,
+					Builder: &packer.RegistryBuilder{
+						Name:    "virtualbox-iso.ubuntu-1204",
+						Builder: emptyMockBuilder,
+						ArtifactMetadataPublisher: &packer_registry.Bucket{
+							Slug: "bucket-slug",
+							Publish: []packer_registry.PublishRule{
+								{Channel: "dev"},
+								{Channel: "prod", RequireApproval: true, ApprovalWebhook: &packer_registry.Webhook{
+									URL:    "https://example.com/approve",
+									Secret: "s3cr3t",
+								}},
+							},
+							Iteration: &packer_registry.Iteration{
+								Fingerprint: "ignored-fingerprint", // this will be different everytime so it's ignored
+							},
+						},
+					},
+					Provisioners: []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{
+						{
+							{
+								PostProcessor: &packer.RegistryPostProcessor{
+									BuilderType: "virtualbox-iso.ubuntu-1204",
+									ArtifactMetadataPublisher: &packer_registry.Bucket{
+										Slug: "bucket-slug",
+										Publish: []packer_registry.PublishRule{
+											{Channel: "dev"},
+											{Channel: "prod", RequireApproval: true, ApprovalWebhook: &packer_registry.Webhook{
+												URL:    "https://example.com/approve",
+												Secret: "s3cr3t",
+											}},
+										},
+										Iteration: &packer_registry.Iteration{
+											Fingerprint: "ignored-fingerprint",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
 		{"invalid hcp_packer_registry config",
 			defaultParser,
 			parseTestArgs{"testdata/hcp_par/invalid.pkr.hcl", nil, nil},
@@ -603,6 +983,186 @@ func Test_ParseHCPPackerRegistryBlock(t *testing.T) {
 			nil,
 			false,
 		},
+		{"invalid hcp_packer_registry.fingerprint_collision",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-fingerprint-collision.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"invalid hcp_packer_registry.partial_run",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-partial-run.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"invalid hcp_packer_registry.pipeline",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-pipeline.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"invalid hcp_packer_registry.expires_after",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-expires-after.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"duplicate hcp_packer_registry.owner of a component",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/duplicate-owner.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"invalid hcp_packer_registry.wait_for_concurrent_builds",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-wait-for-concurrent-builds.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"unknown hcp_packer_registry.target type",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-target.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"invalid hcp_packer_registry.on_complete_webhook url",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-webhook.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"hcp_packer_registry.publish to a channel twice",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-publish.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
+		{"hcp_packer_registry.client_id without client_secret",
+			defaultParser,
+			parseTestArgs{"testdata/hcp_par/invalid-client-credentials.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "hcp_par"),
+			},
+			true, true,
+			nil,
+			false,
+		},
 	}
 	testParse(t, tests)
 }
+
+func Test_checkRegistryDatasourceAncestry(t *testing.T) {
+	parser := getBasicParser()
+
+	cfg, diags := parser.Parse("testdata/hcp_par/datasource-same-bucket.pkr.hcl", nil, nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse errors: %s", diags)
+	}
+
+	diags = cfg.checkRegistryDatasourceAncestry()
+	if len(diags) != 0 {
+		t.Fatalf("expected no diagnostics without a bucket, got %s", diags)
+	}
+
+	cfg.bucket = &packer_registry.Bucket{
+		Slug:      "bucket-slug",
+		Iteration: &packer_registry.Iteration{},
+	}
+	diags = cfg.checkRegistryDatasourceAncestry()
+	if len(diags) != 1 {
+		t.Fatalf("expected exactly one diagnostic, got %d: %s", len(diags), diags)
+	}
+	if diags[0].Severity != hcl.DiagWarning {
+		t.Errorf("expected a warning, got %v", diags[0].Severity)
+	}
+	if !strings.Contains(diags[0].Summary, "data.hcp-packer-iteration.parent") {
+		t.Errorf("expected the diagnostic to reference the parent data source, got %q", diags[0].Summary)
+	}
+}
+
+func Test_resolveBuildLabels(t *testing.T) {
+	parser := getBasicParser()
+
+	cfg, diags := parser.Parse("testdata/hcp_par/build-labels-runtime.pkr.hcl", nil, nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse errors: %s", diags)
+	}
+	diags = cfg.Initialize(packer.InitializeOptions{})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected initialize errors: %s", diags)
+	}
+
+	registryBlock := cfg.Builds[0].HCPPackerRegistry
+	if diff := cmp.Diff(map[string]string{"python_version": "3.0"}, registryBlock.BuildLabels); diff != "" {
+		t.Errorf("expected only the labels known at parse time, got: %s", diff)
+	}
+
+	bucket := &packer_registry.Bucket{}
+	registryBlock.WriteToBucketConfig(bucket)
+	if bucket.BuildLabelsResolver == nil {
+		t.Fatalf("expected labels referencing the build to be resolved at runtime")
+	}
+
+	labels, err := bucket.BuildLabelsResolver("virtualbox-iso.ubuntu-1204", map[string]interface{}{"ID": "ami-123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{
+		"python_version": "3.0",
+		"image_id":       "ami-123",
+		"source":         "ubuntu-1204-ami-123",
+	}
+	if diff := cmp.Diff(expected, labels); diff != "" {
+		t.Errorf("unexpected resolved labels: %s", diff)
+	}
+
+	if _, err := bucket.BuildLabelsResolver("virtualbox-iso.ubuntu-1204", map[string]interface{}{}); err == nil {
+		t.Errorf("expected an error when the build didn't generate the referenced data")
+	}
+}
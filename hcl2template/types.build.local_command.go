@@ -0,0 +1,52 @@
+package hcl2template
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/packer/internal/hostexec"
+	"github.com/hashicorp/packer/packer"
+)
+
+// decodeLocalCommand decodes a pre_build or post_build block, running local
+// commands before or after the builds of the block. For example:
+//
+//	post_build {
+//		inline            = ["./notify.sh $PACKER_ARTIFACT_ID"]
+//		shell             = "bash"
+//		env               = { CHANNEL = "images" }
+//		working_directory = "scripts"
+//	}
+func (p *Parser) decodeLocalCommand(block *hcl.Block, ectx *hcl.EvalContext) (packer.LocalCommand, hcl.Diagnostics) {
+	var b struct {
+		Inline     []string          `hcl:"inline"`
+		Shell      string            `hcl:"shell,optional"`
+		Env        map[string]string `hcl:"env,optional"`
+		WorkingDir string            `hcl:"working_directory,optional"`
+	}
+	diags := gohcl.DecodeBody(block.Body, ectx, &b)
+	if diags.HasErrors() {
+		return packer.LocalCommand{}, diags
+	}
+	if len(b.Inline) == 0 {
+		return packer.LocalCommand{}, append(diags, &hcl.Diagnostic{
+			Summary:  "Empty " + block.Type + " block",
+			Severity: hcl.DiagError,
+			Detail:   "inline must list at least one command to run.",
+			Subject:  &block.DefRange,
+		})
+	}
+	if _, err := hostexec.ParseShell(b.Shell); err != nil {
+		return packer.LocalCommand{}, append(diags, &hcl.Diagnostic{
+			Summary:  "Invalid " + block.Type + ".shell",
+			Severity: hcl.DiagError,
+			Detail:   err.Error(),
+			Subject:  &block.DefRange,
+		})
+	}
+	return packer.LocalCommand{
+		Inline:     b.Inline,
+		Shell:      b.Shell,
+		Env:        b.Env,
+		WorkingDir: b.WorkingDir,
+	}, diags
+}
@@ -0,0 +1,146 @@
+package hcl2template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// MatrixBlock expands each source of a build block into one build per
+// combination of its values, instead of copy-pasting near-identical build
+// blocks. For example:
+//
+//	matrix {
+//		region     = ["us-east-1", "eu-west-1"]
+//		os_version = ["22.04", "24.04"]
+//	}
+//
+// builds each source four times, the values of a combination being available
+// to the source, provisioners and post-processors as `matrix.region` and
+// `matrix.os_version`.
+type MatrixBlock struct {
+	// Axes are the keys of the matrix, in the order they are declared.
+	Axes []MatrixAxis
+
+	HCL2Ref
+}
+
+// MatrixAxis is a key of a matrix and the values it takes.
+type MatrixAxis struct {
+	Key    string
+	Values []string
+}
+
+func (p *Parser) decodeMatrix(block *hcl.Block, ectx *hcl.EvalContext) (*MatrixBlock, hcl.Diagnostics) {
+	attrs, diags := block.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	sorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Range.Start.Byte < sorted[j].Range.Start.Byte
+	})
+
+	matrix := &MatrixBlock{HCL2Ref: newHCL2Ref(block, nil)}
+	for _, attr := range sorted {
+		axis, moreDiags := decodeMatrixAxis(attr, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		matrix.Axes = append(matrix.Axes, axis)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if len(matrix.Axes) == 0 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Summary:  "Empty " + buildMatrixLabel,
+			Severity: hcl.DiagError,
+			Detail:   "A " + buildMatrixLabel + " must set at least one key to a list of values.",
+			Subject:  &block.DefRange,
+		})
+	}
+	return matrix, diags
+}
+
+func decodeMatrixAxis(attr *hcl.Attribute, ectx *hcl.EvalContext) (MatrixAxis, hcl.Diagnostics) {
+	axis := MatrixAxis{Key: attr.Name}
+	value, diags := attr.Expr.Value(ectx)
+	if diags.HasErrors() {
+		return axis, diags
+	}
+
+	invalid := func(detail string) hcl.Diagnostics {
+		return append(diags, &hcl.Diagnostic{
+			Summary:  fmt.Sprintf("Invalid %s key %q", buildMatrixLabel, attr.Name),
+			Severity: hcl.DiagError,
+			Detail:   detail,
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+
+	if !value.IsWhollyKnown() || value.IsNull() || !value.CanIterateElements() || value.Type().IsMapType() || value.Type().IsObjectType() {
+		return axis, invalid("The values of a key must be a known list of strings.")
+	}
+	if value.LengthInt() == 0 {
+		return axis, invalid("A key must take at least one value.")
+	}
+
+	seen := map[string]bool{}
+	for it := value.ElementIterator(); it.Next(); {
+		_, v := it.Element()
+		s, err := convert.Convert(v, cty.String)
+		if err != nil || s.IsNull() {
+			return axis, invalid("The values of a key must be strings.")
+		}
+		str := s.AsString()
+		if seen[str] {
+			return axis, invalid(fmt.Sprintf("The value %q is listed twice, the builds of its combinations would have the same name.", str))
+		}
+		seen[str] = true
+		axis.Values = append(axis.Values, str)
+	}
+	return axis, diags
+}
+
+// expand returns the sources started once per combination of the matrix, named
+// after the values of their combination, the first key varying the slowest.
+func (m *MatrixBlock) expand(sources []SourceUseBlock) []SourceUseBlock {
+	var expanded []SourceUseBlock
+	for _, source := range sources {
+		indexes := make([]int, len(m.Axes))
+		for {
+			combination := source
+			combination.Matrix = make(map[string]cty.Value, len(m.Axes))
+			values := make([]string, len(m.Axes))
+			for i, axis := range m.Axes {
+				values[i] = axis.Values[indexes[i]]
+				combination.Matrix[axis.Key] = cty.StringVal(values[i])
+			}
+			combination.LocalName = source.name() + "-" + strings.Join(values, "-")
+			expanded = append(expanded, combination)
+
+			i := len(indexes) - 1
+			for ; i >= 0; i-- {
+				if indexes[i]++; indexes[i] < len(m.Axes[i].Values) {
+					break
+				}
+				indexes[i] = 0
+			}
+			if i < 0 {
+				break
+			}
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,170 @@
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// The ways an override block can change a provisioner of a build.
+const (
+	overridePrepend = "prepend"
+	overrideAppend  = "append"
+	overrideReplace = "replace"
+)
+
+var overrideSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: buildProvisionerLabel, LabelNames: []string{"type"}},
+	},
+}
+
+var overrideProvisionerSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: overridePrepend},
+		{Name: overrideAppend},
+		{Name: overrideReplace},
+	},
+}
+
+// ProvisionerOverride changes the provisioners run for some of the sources of
+// a build: its provisioner runs before, after or instead of the provisioners
+// of the build named Target. For example:
+//
+//	override "source.amazon-ebs.legacy" {
+//		provisioner "shell" {
+//			replace = "install"
+//			...
+//		}
+//	}
+type ProvisionerOverride struct {
+	// Source is the glob pattern of the sources the override applies to.
+	Source string
+	// Mode is one of prepend, append or replace.
+	Mode string
+	// Target is the name of the provisioners of the build to override.
+	Target      string
+	Provisioner *ProvisionerBlock
+
+	source sourcePattern
+}
+
+func (p *Parser) decodeOverride(block *hcl.Block, ectx *hcl.EvalContext) ([]*ProvisionerOverride, hcl.Diagnostics) {
+	pattern, err := sourcePatternFromString(block.Labels[0])
+	if err != nil {
+		return nil, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + buildOverrideLabel + " block",
+			Detail:   err.Error(),
+			Subject:  block.LabelRanges[0].Ptr(),
+		}}
+	}
+
+	content, diags := block.Body.Content(overrideSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var overrides []*ProvisionerOverride
+	for _, pblock := range content.Blocks {
+		modes, rest, moreDiags := pblock.Body.PartialContent(overrideProvisionerSchema)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		if len(modes.Attributes) != 1 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid " + buildOverrideLabel + " " + buildProvisionerLabel,
+				Detail: fmt.Sprintf("Exactly one of %s, %s or %s must name the %s to override.",
+					overridePrepend, overrideAppend, overrideReplace, buildProvisionerLabel),
+				Subject: pblock.DefRange.Ptr(),
+			})
+			continue
+		}
+
+		override := &ProvisionerOverride{Source: pattern.pattern, source: pattern}
+		for mode, attr := range modes.Attributes {
+			override.Mode = mode
+			moreDiags = gohcl.DecodeExpression(attr.Expr, ectx, &override.Target)
+			diags = append(diags, moreDiags...)
+		}
+		if diags.HasErrors() {
+			continue
+		}
+
+		// The provisioner itself is decoded without the override attributes.
+		provisionerBlock := *pblock
+		provisionerBlock.Body = rest
+		override.Provisioner, moreDiags = p.decodeProvisioner(&provisionerBlock, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, diags
+}
+
+// checkOverrides checks that the overrides of the build target one of its
+// named provisioners.
+func (b *BuildBlock) checkOverrides() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, override := range b.ProvisionerOverrides {
+		found := false
+		for _, pb := range b.ProvisionerBlocks {
+			if pb.PName != "" && pb.PName == override.Target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Unknown %s %q", buildProvisionerLabel, override.Target),
+				Detail: fmt.Sprintf("An %s %s must %s a named %s of the build.",
+					buildOverrideLabel, buildProvisionerLabel, override.Mode, buildProvisionerLabel),
+				Subject: override.Provisioner.HCL2Ref.DefRange.Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+// provisionersFor returns the provisioners of the build to run for source,
+// with the overrides applying to it. Provisioners added by an override are
+// part of the stage of the provisioner they override.
+func (b *BuildBlock) provisionersFor(source SourceUseBlock) []*ProvisionerBlock {
+	if len(b.ProvisionerOverrides) == 0 {
+		return b.ProvisionerBlocks
+	}
+
+	res := make([]*ProvisionerBlock, 0, len(b.ProvisionerBlocks))
+	for _, pb := range b.ProvisionerBlocks {
+		var before, after, replacements []*ProvisionerBlock
+		for _, override := range b.ProvisionerOverrides {
+			if pb.PName == "" || override.Target != pb.PName || !override.source.Match(source) {
+				continue
+			}
+			provisioner := *override.Provisioner
+			provisioner.Stage = pb.Stage
+			switch override.Mode {
+			case overridePrepend:
+				before = append(before, &provisioner)
+			case overrideAppend:
+				after = append(after, &provisioner)
+			case overrideReplace:
+				replacements = append(replacements, &provisioner)
+			}
+		}
+		res = append(res, before...)
+		if replacements == nil {
+			res = append(res, pb)
+		} else {
+			res = append(res, replacements...)
+		}
+		res = append(res, after...)
+	}
+	return res
+}
@@ -67,6 +67,9 @@ type ProvisionerBlock struct {
 	Timeout     time.Duration
 	Override    map[string]interface{}
 	OnlyExcept  OnlyExcept
+	// Stage is the name of the stage block the provisioner is defined in,
+	// if any.
+	Stage string
 	HCL2Ref
 }
 
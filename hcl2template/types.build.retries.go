@@ -0,0 +1,67 @@
+package hcl2template
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// RetriesBlock is the retry policy of the builds of a build block: when their
+// builder fails, the whole build runs again, up to Attempts times in total,
+// waiting Backoff between two attempts. For example:
+//
+//	retries {
+//		attempts = 3
+//		backoff  = "30s"
+//	}
+type RetriesBlock struct {
+	Attempts int
+	Backoff  time.Duration
+
+	HCL2Ref
+}
+
+func (p *Parser) decodeRetries(block *hcl.Block, ectx *hcl.EvalContext) (*RetriesBlock, hcl.Diagnostics) {
+	var b struct {
+		Attempts int    `hcl:"attempts"`
+		Backoff  string `hcl:"backoff,optional"`
+	}
+	diags := gohcl.DecodeBody(block.Body, ectx, &b)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	retries := &RetriesBlock{
+		Attempts: b.Attempts,
+		HCL2Ref:  newHCL2Ref(block, nil),
+	}
+
+	if b.Attempts < 1 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Summary:  "Invalid " + buildRetriesLabel + " attempts",
+			Severity: hcl.DiagError,
+			Detail:   "attempts is the number of times the build runs at most, it must be at least 1.",
+			Subject:  &block.DefRange,
+		})
+	}
+
+	if b.Backoff != "" {
+		backoff, err := time.ParseDuration(b.Backoff)
+		if err == nil && backoff < 0 {
+			err = fmt.Errorf("backoff must not be negative, got %s", b.Backoff)
+		}
+		if err != nil {
+			return nil, append(diags, &hcl.Diagnostic{
+				Summary:  "Failed to parse backoff duration",
+				Severity: hcl.DiagError,
+				Detail:   err.Error(),
+				Subject:  &block.DefRange,
+			})
+		}
+		retries.Backoff = backoff
+	}
+
+	return retries, diags
+}
@@ -3,6 +3,7 @@ package hcl2template
 import (
 	"path/filepath"
 	"testing"
+	"time"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	. "github.com/hashicorp/packer/hcl2template/internal"
@@ -648,6 +649,995 @@ func TestParse_build(t *testing.T) {
 			},
 			false,
 		},
+		{"provisioner stages",
+			defaultParser,
+			parseTestArgs{"testdata/build/provisioner_stages.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+						ProvisionerBlocks: []*ProvisionerBlock{
+							{
+								PType: "shell",
+							},
+							{
+								PType: "shell",
+								Stage: "harden",
+							},
+							{
+								PType: "file",
+								Stage: "harden",
+							},
+							{
+								PType: "file",
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					Type:     "virtualbox-iso.ubuntu-1204",
+					Prepared: true,
+					Builder:  emptyMockBuilder,
+					Provisioners: []packer.CoreBuildProvisioner{
+						{
+							PType: "shell",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: &MockProvisioner{
+									Config: MockConfig{
+										NestedMockConfig: NestedMockConfig{Tags: []MockTag{}},
+										NestedSlice:      []NestedMockConfig{},
+									},
+								},
+							},
+						},
+						{
+							PType: "shell",
+							Stage: "harden",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: &MockProvisioner{
+									Config: MockConfig{
+										NestedMockConfig: NestedMockConfig{Tags: []MockTag{}},
+										NestedSlice:      []NestedMockConfig{},
+									},
+								},
+							},
+						},
+						{
+							PType: "file",
+							Stage: "harden",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: &MockProvisioner{
+									Config: MockConfig{
+										NestedMockConfig: NestedMockConfig{Tags: []MockTag{}},
+										NestedSlice:      []NestedMockConfig{},
+									},
+								},
+							},
+						},
+						{
+							PType: "file",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: &MockProvisioner{
+									Config: MockConfig{
+										NestedMockConfig: NestedMockConfig{Tags: []MockTag{}},
+										NestedSlice:      []NestedMockConfig{},
+									},
+								},
+							},
+						},
+					},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"duplicate stage",
+			defaultParser,
+			parseTestArgs{"testdata/build/duplicate_stage.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"build dependencies",
+			defaultParser,
+			parseTestArgs{"testdata/build/depends_on.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "base",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+					&BuildBlock{
+						Name:      "app",
+						DependsOn: []string{"base"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "base",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					BuildName:      "app",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					DependsOn:      []string{"base"},
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"unknown build dependency",
+			defaultParser,
+			parseTestArgs{"testdata/build/depends_on_unknown.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name:      "app",
+						DependsOn: []string{"base"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"cyclic build dependencies",
+			defaultParser,
+			parseTestArgs{"testdata/build/depends_on_cycle.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name:      "app",
+						DependsOn: []string{"base"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+					&BuildBlock{
+						Name:      "base",
+						DependsOn: []string{"app"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"build contracts",
+			defaultParser,
+			parseTestArgs{"testdata/build/contracts.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name:     "template",
+						Provides: []string{"vsphere-template"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+					&BuildBlock{
+						Name:        "clone",
+						DependsOn:   []string{"template"},
+						ExpectInput: []string{"vsphere-template"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "template",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					BuildName:      "clone",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					DependsOn:      []string{"template"},
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"unmet build contracts",
+			defaultParser,
+			parseTestArgs{"testdata/build/contracts_unmet.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name:     "template",
+						Provides: []string{"ovf"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+					&BuildBlock{
+						Name:        "clone",
+						DependsOn:   []string{"template"},
+						ExpectInput: []string{"vsphere-template"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"unverified build contracts",
+			defaultParser,
+			parseTestArgs{"testdata/build/contracts_unverified.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "template",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+					&BuildBlock{
+						Name:        "clone",
+						DependsOn:   []string{"template"},
+						ExpectInput: []string{"vsphere-template"},
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			true, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "template",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					BuildName:      "clone",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					DependsOn:      []string{"template"},
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"build retries",
+			defaultParser,
+			parseTestArgs{"testdata/build/retries.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "flaky",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+						Retries: &RetriesBlock{
+							Attempts: 3,
+							Backoff:  30 * time.Second,
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "flaky",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+					RetryAttempts:  3,
+					RetryBackoff:   30 * time.Second,
+				},
+			},
+			false,
+		},
+		{"invalid build retries",
+			defaultParser,
+			parseTestArgs{"testdata/build/retries_invalid.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"build matrix",
+			defaultParser,
+			parseTestArgs{"testdata/build/matrix.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "images",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+								LocalName: "ubuntu-1204-us-east-1-22.04",
+								Matrix: map[string]cty.Value{
+									"region":     cty.StringVal("us-east-1"),
+									"os_version": cty.StringVal("22.04"),
+								},
+							},
+							{
+								SourceRef: refVBIsoUbuntu1204,
+								LocalName: "ubuntu-1204-us-east-1-24.04",
+								Matrix: map[string]cty.Value{
+									"region":     cty.StringVal("us-east-1"),
+									"os_version": cty.StringVal("24.04"),
+								},
+							},
+							{
+								SourceRef: refVBIsoUbuntu1204,
+								LocalName: "ubuntu-1204-eu-west-1-22.04",
+								Matrix: map[string]cty.Value{
+									"region":     cty.StringVal("eu-west-1"),
+									"os_version": cty.StringVal("22.04"),
+								},
+							},
+							{
+								SourceRef: refVBIsoUbuntu1204,
+								LocalName: "ubuntu-1204-eu-west-1-24.04",
+								Matrix: map[string]cty.Value{
+									"region":     cty.StringVal("eu-west-1"),
+									"os_version": cty.StringVal("24.04"),
+								},
+							},
+						},
+						Matrix: &MatrixBlock{
+							Axes: []MatrixAxis{
+								{Key: "region", Values: []string{"us-east-1", "eu-west-1"}},
+								{Key: "os_version", Values: []string{"22.04", "24.04"}},
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName: "images",
+					Type:      "virtualbox-iso.ubuntu-1204-us-east-1-22.04",
+					Prepared:  true,
+					Builder: &MockBuilder{
+						Config: MockConfig{
+							NestedMockConfig: NestedMockConfig{
+								String: "us-east-1/22.04",
+								Tags:   []MockTag{},
+							},
+							Nested:      NestedMockConfig{},
+							NestedSlice: []NestedMockConfig{},
+						},
+					},
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					BuildName: "images",
+					Type:      "virtualbox-iso.ubuntu-1204-us-east-1-24.04",
+					Prepared:  true,
+					Builder: &MockBuilder{
+						Config: MockConfig{
+							NestedMockConfig: NestedMockConfig{
+								String: "us-east-1/24.04",
+								Tags:   []MockTag{},
+							},
+							Nested:      NestedMockConfig{},
+							NestedSlice: []NestedMockConfig{},
+						},
+					},
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					BuildName: "images",
+					Type:      "virtualbox-iso.ubuntu-1204-eu-west-1-22.04",
+					Prepared:  true,
+					Builder: &MockBuilder{
+						Config: MockConfig{
+							NestedMockConfig: NestedMockConfig{
+								String: "eu-west-1/22.04",
+								Tags:   []MockTag{},
+							},
+							Nested:      NestedMockConfig{},
+							NestedSlice: []NestedMockConfig{},
+						},
+					},
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					BuildName: "images",
+					Type:      "virtualbox-iso.ubuntu-1204-eu-west-1-24.04",
+					Prepared:  true,
+					Builder: &MockBuilder{
+						Config: MockConfig{
+							NestedMockConfig: NestedMockConfig{
+								String: "eu-west-1/24.04",
+								Tags:   []MockTag{},
+							},
+							Nested:      NestedMockConfig{},
+							NestedSlice: []NestedMockConfig{},
+						},
+					},
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"invalid build matrix",
+			defaultParser,
+			parseTestArgs{"testdata/build/matrix_invalid.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"build skip_if",
+			defaultParser,
+			parseTestArgs{"testdata/build/skip_if.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				InputVariables: Variables{
+					"build_arm": &Variable{
+						Name:   "build_arm",
+						Type:   cty.Bool,
+						Values: []VariableAssignment{{From: "default", Value: cty.False}},
+					},
+				},
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204:  {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+					refAWSEBSUbuntu1604: {Type: "amazon-ebs", Name: "ubuntu-1604"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "amd64",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+					&BuildBlock{
+						Name: "arm64",
+						Skip: true,
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refAWSEBSUbuntu1604,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "amd64",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"invalid build skip_if",
+			defaultParser,
+			parseTestArgs{"testdata/build/skip_if_invalid.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"build encryption policy",
+			defaultParser,
+			parseTestArgs{"testdata/build/encryption.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "encrypted",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+						EncryptionPolicy: &packer.EncryptionPolicy{
+							Required:       true,
+							AllowedKMSKeys: []string{"alias/images"},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "encrypted",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+					EncryptionPolicy: &packer.EncryptionPolicy{
+						Required:       true,
+						AllowedKMSKeys: []string{"alias/images"},
+					},
+				},
+			},
+			false,
+		},
+		{"build local commands",
+			defaultParser,
+			parseTestArgs{"testdata/build/local_commands.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "hooked",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+						PreBuild: []packer.LocalCommand{
+							{Inline: []string{"./warm-cache.sh"}},
+						},
+						PostBuild: []packer.LocalCommand{
+							{
+								Inline:     []string{"./notify.sh $PACKER_ARTIFACT_ID"},
+								Shell:      "bash",
+								Env:        map[string]string{"CHANNEL": "images"},
+								WorkingDir: "scripts",
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "hooked",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+					PreBuild: []packer.LocalCommand{
+						{Inline: []string{"./warm-cache.sh"}},
+					},
+					PostBuild: []packer.LocalCommand{
+						{
+							Inline:     []string{"./notify.sh $PACKER_ARTIFACT_ID"},
+							Shell:      "bash",
+							Env:        map[string]string{"CHANNEL": "images"},
+							WorkingDir: "scripts",
+						},
+					},
+				},
+			},
+			false,
+		},
+		{"build empty local commands",
+			defaultParser,
+			parseTestArgs{"testdata/build/local_commands_empty.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
+		{"build timeout",
+			defaultParser,
+			parseTestArgs{"testdata/build/timeout.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Name: "bounded",
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+						Timeout: 90 * time.Minute,
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					BuildName:      "bounded",
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+					Timeout:        90 * time.Minute,
+				},
+			},
+			false,
+		},
+		{"sources exclusion",
+			defaultParser,
+			parseTestArgs{"testdata/build/sources_exclusion.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204:  {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+					refAWSEBSUbuntu1604: {Type: "amazon-ebs", Name: "ubuntu-1604"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					Type:           "virtualbox-iso.ubuntu-1204",
+					Prepared:       true,
+					Builder:        emptyMockBuilder,
+					Provisioners:   []packer.CoreBuildProvisioner{},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"provisioner overrides",
+			defaultParser,
+			parseTestArgs{"testdata/build/provisioner_override.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204:  {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+					refAWSEBSUbuntu1604: {Type: "amazon-ebs", Name: "ubuntu-1604"},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Sources: []SourceUseBlock{
+							{
+								SourceRef: refVBIsoUbuntu1204,
+							},
+							{
+								SourceRef: refAWSEBSUbuntu1604,
+							},
+						},
+						ProvisionerBlocks: []*ProvisionerBlock{
+							{
+								PType: "shell",
+								PName: "install",
+							},
+							{
+								PType: "file",
+								PName: "configure",
+							},
+						},
+						ProvisionerOverrides: []*ProvisionerOverride{
+							{
+								Source:      "source.amazon-ebs.*",
+								Mode:        "replace",
+								Target:      "install",
+								Provisioner: &ProvisionerBlock{PType: "file"},
+							},
+							{
+								Source:      "source.amazon-ebs.*",
+								Mode:        "append",
+								Target:      "configure",
+								Provisioner: &ProvisionerBlock{PType: "shell"},
+							},
+							{
+								Source:      "source.virtualbox-iso.ubuntu-1204",
+								Mode:        "prepend",
+								Target:      "install",
+								Provisioner: &ProvisionerBlock{PType: "file"},
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					Type:     "virtualbox-iso.ubuntu-1204",
+					Prepared: true,
+					Builder:  emptyMockBuilder,
+					Provisioners: []packer.CoreBuildProvisioner{
+						{
+							PType: "file",
+							PName: "",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: emptyMockProvisioner,
+							},
+						},
+						{
+							PType: "shell",
+							PName: "install",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: emptyMockProvisioner,
+							},
+						},
+						{
+							PType: "file",
+							PName: "configure",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: emptyMockProvisioner,
+							},
+						},
+					},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+				&packer.CoreBuild{
+					Type:     "amazon-ebs.ubuntu-1604",
+					Prepared: true,
+					Builder:  emptyMockBuilder,
+					Provisioners: []packer.CoreBuildProvisioner{
+						{
+							PType: "file",
+							PName: "",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: emptyMockProvisioner,
+							},
+						},
+						{
+							PType: "file",
+							PName: "configure",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: emptyMockProvisioner,
+							},
+						},
+						{
+							PType: "shell",
+							PName: "",
+							Provisioner: &HCL2Provisioner{
+								Provisioner: emptyMockProvisioner,
+							},
+						},
+					},
+					PostProcessors: [][]packer.CoreBuildPostProcessor{},
+				},
+			},
+			false,
+		},
+		{"provisioner override of an unknown provisioner",
+			defaultParser,
+			parseTestArgs{"testdata/build/provisioner_override_unknown.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "build"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {Type: "virtualbox-iso", Name: "ubuntu-1204"},
+				},
+			},
+			true, true,
+			[]packersdk.Build{},
+			false,
+		},
 	}
 	testParse(t, tests)
 }
+
+func TestGetBuilds_artifactReferences(t *testing.T) {
+	for _, tc := range []struct {
+		file         string
+		getBuildsErr bool
+	}{
+		{"testdata/build/artifact_reference.pkr.hcl", false},
+		{"testdata/build/artifact_reference_not_dependency.pkr.hcl", true},
+		{"testdata/build/artifact_reference_ambiguous.pkr.hcl", true},
+	} {
+		t.Run(filepath.Base(tc.file), func(t *testing.T) {
+			cfg, diags := getBasicParser().Parse(tc.file, nil, nil)
+			diags = append(diags, cfg.Initialize(packer.InitializeOptions{})...)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diags)
+			}
+			builds, diags := cfg.GetBuilds(packer.GetBuildsOptions{})
+			if diags.HasErrors() != tc.getBuildsErr {
+				t.Fatalf("unexpected diagnostics: %s", diags)
+			}
+			if tc.getBuildsErr {
+				return
+			}
+
+			var base, app *packer.CoreBuild
+			for _, b := range builds {
+				switch cb := b.(*packer.CoreBuild); cb.BuildName {
+				case "base":
+					base = cb
+				case "app":
+					app = cb
+				}
+			}
+			if base.ResolveDependencies != nil {
+				t.Errorf("the base build references no artifact")
+			}
+			if app.ResolveDependencies == nil {
+				t.Fatalf("the app build should resolve the artifacts of the base build")
+			}
+
+			artifacts := map[string]map[string][]packersdk.Artifact{
+				"base": {
+					"virtualbox-iso.base": {&packersdk.MockArtifact{
+						IdValue:    "base-image",
+						FilesValue: []string{"base.ova"},
+					}},
+				},
+			}
+			if err := app.ResolveDependencies(artifacts); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			config := app.Builder.(*MockBuilder).Config
+			if config.String != "base-image" {
+				t.Errorf("expected the artifact ID of the base build, got %q", config.String)
+			}
+			if len(config.SliceString) != 1 || config.SliceString[0] != "base.ova" {
+				t.Errorf("expected the artifact files of the base build, got %q", config.SliceString)
+			}
+
+			if err := app.ResolveDependencies(map[string]map[string][]packersdk.Artifact{}); err == nil {
+				t.Errorf("expected an error when the base build did not run")
+			}
+		})
+	}
+}
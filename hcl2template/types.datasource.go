@@ -62,6 +62,16 @@ func (ds *Datasources) Values() (map[string]cty.Value, hcl.Diagnostics) {
 	return res, diags
 }
 
+// InputHash returns packer.InputHash of the values of the data sources, so
+// that a change of any of them can be told.
+func (ds *Datasources) InputHash() (string, error) {
+	values, diags := ds.Values()
+	if diags.HasErrors() {
+		return "", diags
+	}
+	return inputHash("data", cty.ObjectVal(values))
+}
+
 func (cfg *PackerConfig) startDatasource(dataSourceStore packer.DatasourceStore, ref DatasourceRef, secondaryEvaluation bool) (packersdk.Datasource, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	block := cfg.Datasources[ref].block
@@ -86,6 +96,16 @@ func (cfg *PackerConfig) startDatasource(dataSourceStore packer.DatasourceStore,
 		return nil, diags
 	}
 
+	if err := cfg.parser.LocalExec.Check(dataSourceLabel + "." + ref.Type); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Summary:  "Data source disabled in restricted mode",
+			Detail:   err.Error(),
+			Subject:  block.LabelRanges[0].Ptr(),
+			Severity: hcl.DiagError,
+		})
+		return nil, diags
+	}
+
 	datasource, err := dataSourceStore.Start(ref.Type)
 	if err != nil {
 		diags = append(diags, &hcl.Diagnostic{
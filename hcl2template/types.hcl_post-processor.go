@@ -7,6 +7,7 @@ import (
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
+	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -62,6 +63,44 @@ func (p *HCL2PostProcessor) HCL2Prepare(buildVars map[string]interface{}) error
 	return p.PostProcessor.Configure(p.builderVariables, flatPostProcessorCfg)
 }
 
+// inputHash returns the hash of the configuration of the post-processor,
+// before the build variables are known, see packer.InputHash.
+func (p *HCL2PostProcessor) inputHash() (string, error) {
+	flatPostProcessorCfg, diags := decodeHCL2Spec(p.postProcessorBlock.HCL2Ref.Rest, p.evalContext, p.PostProcessor)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	return inputHash(p.postProcessorBlock.PType, flatPostProcessorCfg)
+}
+
+// postProcessorsInputHash returns the hash of the configuration of the
+// post-processors of a build, see packer.CoreBuild.PostProcessorsInputHash.
+func postProcessorsInputHash(pps [][]packer.CoreBuildPostProcessor) (string, error) {
+	hashes := make([][]string, 0, len(pps))
+	for _, seq := range pps {
+		seqHashes := make([]string, 0, len(seq))
+		for _, pp := range seq {
+			postProcessor := pp.PostProcessor
+			if rpp, ok := postProcessor.(*packer.RegistryPostProcessor); ok {
+				postProcessor = rpp.PostProcessor
+			}
+			// The post-processor of the HCP Packer registry has no
+			// configuration.
+			hp, ok := postProcessor.(*HCL2PostProcessor)
+			if !ok {
+				continue
+			}
+			hash, err := hp.inputHash()
+			if err != nil {
+				return "", err
+			}
+			seqHashes = append(seqHashes, hash)
+		}
+		hashes = append(hashes, seqHashes)
+	}
+	return packer.InputHash("post-processors", hashes)
+}
+
 func (p *HCL2PostProcessor) Configure(args ...interface{}) error {
 	return p.PostProcessor.Configure(args...)
 }
@@ -26,26 +26,36 @@ func (p *HCL2Provisioner) ConfigSpec() hcldec.ObjectSpec {
 	return p.Provisioner.ConfigSpec()
 }
 
-func (p *HCL2Provisioner) HCL2Prepare(buildVars map[string]interface{}) error {
-	var diags hcl.Diagnostics
-	ectx := p.evalContext
-	if len(buildVars) > 0 {
-		ectx = p.evalContext.NewChild()
-		buildValues := map[string]cty.Value{}
-		if !p.evalContext.Variables[buildAccessor].IsNull() {
-			buildValues = p.evalContext.Variables[buildAccessor].AsValueMap()
+// withBuildVariables returns ectx, with the build variables set to buildVars
+// when there are some, like the data generated by the builder.
+func withBuildVariables(ectx *hcl.EvalContext, buildVars map[string]interface{}) (*hcl.EvalContext, error) {
+	if len(buildVars) == 0 {
+		return ectx, nil
+	}
+	buildValues := map[string]cty.Value{}
+	if !ectx.Variables[buildAccessor].IsNull() {
+		buildValues = ectx.Variables[buildAccessor].AsValueMap()
+	}
+	for k, v := range buildVars {
+		val, err := ConvertPluginConfigValueToHCLValue(v)
+		if err != nil {
+			return nil, err
 		}
-		for k, v := range buildVars {
-			val, err := ConvertPluginConfigValueToHCLValue(v)
-			if err != nil {
-				return err
-			}
 
-			buildValues[k] = val
-		}
-		ectx.Variables = map[string]cty.Value{
-			buildAccessor: cty.ObjectVal(buildValues),
-		}
+		buildValues[k] = val
+	}
+	child := ectx.NewChild()
+	child.Variables = map[string]cty.Value{
+		buildAccessor: cty.ObjectVal(buildValues),
+	}
+	return child, nil
+}
+
+func (p *HCL2Provisioner) HCL2Prepare(buildVars map[string]interface{}) error {
+	var diags hcl.Diagnostics
+	ectx, err := withBuildVariables(p.evalContext, buildVars)
+	if err != nil {
+		return err
 	}
 
 	flatProvisionerCfg, moreDiags := decodeHCL2Spec(p.provisionerBlock.HCL2Ref.Rest, ectx, p.Provisioner)
@@ -54,6 +64,8 @@ func (p *HCL2Provisioner) HCL2Prepare(buildVars map[string]interface{}) error {
 		return diags
 	}
 
+	registerConfigSecrets(flatProvisionerCfg)
+
 	// In case of cty.Unknown values, this will write a equivalent placeholder of the same type
 	// Unknown types are not recognized by the json marshal during the RPC call and we have to do this here
 	// to avoid json parsing failures when running the validate command.
@@ -63,6 +75,16 @@ func (p *HCL2Provisioner) HCL2Prepare(buildVars map[string]interface{}) error {
 	return p.Provisioner.Prepare(p.builderVariables, flatProvisionerCfg, p.override)
 }
 
+// inputHash returns the hash of the configuration of the provisioner, before
+// the build variables are known, see packer.InputHash.
+func (p *HCL2Provisioner) inputHash() (string, error) {
+	flatProvisionerCfg, diags := decodeHCL2Spec(p.provisionerBlock.HCL2Ref.Rest, p.evalContext, p.Provisioner)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	return inputHash(p.provisionerBlock.PType, flatProvisionerCfg)
+}
+
 func (p *HCL2Provisioner) Prepare(args ...interface{}) error {
 	return p.Provisioner.Prepare(args...)
 }
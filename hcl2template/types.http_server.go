@@ -0,0 +1,471 @@
+package hcl2template
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	"github.com/hashicorp/packer/internal/httpserver"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// HTTPServerBlock references an HCL 'http_server' block: a server serving
+// files to the machines being built, like the kickstart or preseed files
+// fetched by installers while they boot. packer build starts it before the
+// builds are prepared, so that their sources can use its URL.
+type HTTPServerBlock struct {
+	Name string
+
+	// Directory is served as is, or else the Content of each path.
+	Directory string
+	Content   map[string]string
+	// Templates are the template files rendered at each request, by path,
+	// see httpTemplateContext. They take precedence over Directory and
+	// Content.
+	Templates map[string]string
+
+	Address          string
+	PortMin, PortMax int
+	// Host is the address the machines reach the server at.
+	Host string
+
+	// TLS serves the files over HTTPS, with the certificate and key files
+	// when set or with a self-signed certificate.
+	TLS                bool
+	TLSCertificateFile string
+	TLSKeyFile         string
+	// Token makes the server only serve the requests sending the token
+	// generated for the run.
+	Token bool
+
+	// server is set once the server is started.
+	server *httpserver.Server
+	// known is false when the block depends on values that are not known
+	// yet, for example a data source during validation.
+	known bool
+	block *hcl.Block
+}
+
+type HTTPServers map[string]*HTTPServerBlock
+
+var httpServerBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "directory"},
+		{Name: "content"},
+		{Name: "templates"},
+		{Name: "address"},
+		{Name: "port_min"},
+		{Name: "port_max"},
+		{Name: "host"},
+		{Name: "tls"},
+		{Name: "tls_certificate_file"},
+		{Name: "tls_key_file"},
+		{Name: "token"},
+	},
+}
+
+// Values returns the cty values of the HTTP servers, for use in an eval
+// context. They are unknown until the servers are started:
+//
+//	http_server.<name>.url
+//	http_server.<name>.port
+//	http_server.<name>.token
+func (servers HTTPServers) Values() map[string]cty.Value {
+	res := map[string]cty.Value{}
+	for name, server := range servers {
+		if server.server == nil {
+			res[name] = cty.ObjectVal(map[string]cty.Value{
+				"url":   cty.UnknownVal(cty.String),
+				"port":  cty.UnknownVal(cty.Number),
+				"token": cty.UnknownVal(cty.String),
+			})
+			continue
+		}
+		res[name] = cty.ObjectVal(map[string]cty.Value{
+			"url":   cty.StringVal(server.server.URL),
+			"port":  cty.NumberIntVal(int64(server.server.Port)),
+			"token": cty.StringVal(server.server.Token),
+		})
+	}
+	return res
+}
+
+func (p *Parser) decodeHTTPServers(file *hcl.File, cfg *PackerConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	content, moreDiags := file.Body.Content(configSchema)
+	diags = append(diags, moreDiags...)
+
+	for _, block := range content.Blocks {
+		if block.Type != httpServerLabel {
+			continue
+		}
+		server := &HTTPServerBlock{
+			Name:  block.Labels[0],
+			block: block,
+		}
+		if !hclsyntax.ValidIdentifier(server.Name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid " + httpServerLabel + " name",
+				Detail:   badIdentifierDetail,
+				Subject:  &block.LabelRanges[0],
+			})
+			continue
+		}
+		if existing, found := cfg.HTTPServers[server.Name]; found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate " + httpServerLabel + " block",
+				Detail: fmt.Sprintf("This "+httpServerLabel+" block has the "+
+					"same name as a previous block declared at %s. Each "+
+					httpServerLabel+" must have a unique name.",
+					existing.block.DefRange.Ptr()),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		if cfg.HTTPServers == nil {
+			cfg.HTTPServers = HTTPServers{}
+		}
+		cfg.HTTPServers[server.Name] = server
+	}
+
+	return diags
+}
+
+// evaluateHTTPServers evaluates the attributes of the http_server blocks.
+// HTTP servers can use input variables and data sources.
+func (cfg *PackerConfig) evaluateHTTPServers() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	ectx := cfg.EvalContext(DatasourceContext, nil)
+	for _, server := range cfg.HTTPServers {
+		diags = append(diags, server.evaluate(ectx, cfg.Cwd)...)
+	}
+	return diags
+}
+
+func (server *HTTPServerBlock) evaluate(ectx *hcl.EvalContext, cwd string) hcl.Diagnostics {
+	content, diags := server.block.Body.Content(httpServerBlockSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	server.known = true
+	server.Address = "0.0.0.0"
+	server.PortMin, server.PortMax = 8000, 9000
+	decode := func(name string, ty cty.Type, v interface{}) {
+		attr, ok := content.Attributes[name]
+		if !ok {
+			return
+		}
+		val, moreDiags := attr.Expr.Value(ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return
+		}
+		if !val.IsWhollyKnown() {
+			server.known = false
+			return
+		}
+		val, err := convert.Convert(val, ty)
+		if err == nil {
+			err = gocty.FromCtyValue(val, v)
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %q value", name),
+				Detail:   err.Error(),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+		}
+	}
+
+	decode("directory", cty.String, &server.Directory)
+	decode("content", cty.Map(cty.String), &server.Content)
+	decode("templates", cty.Map(cty.String), &server.Templates)
+	decode("address", cty.String, &server.Address)
+	decode("port_min", cty.Number, &server.PortMin)
+	decode("port_max", cty.Number, &server.PortMax)
+	decode("host", cty.String, &server.Host)
+	decode("tls", cty.Bool, &server.TLS)
+	decode("tls_certificate_file", cty.String, &server.TLSCertificateFile)
+	decode("tls_key_file", cty.String, &server.TLSKeyFile)
+	decode("token", cty.Bool, &server.Token)
+	if diags.HasErrors() || !server.known {
+		return diags
+	}
+
+	invalid := func(summary, detail string) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  summary,
+			Detail:   detail,
+			Subject:  server.block.DefRange.Ptr(),
+		})
+	}
+	switch {
+	case server.Directory != "" && len(server.Content) > 0:
+		invalid("Conflicting "+httpServerLabel+" contents", "Only one of directory or content can be set.")
+	case server.Directory == "" && len(server.Content) == 0 && len(server.Templates) == 0:
+		invalid("Missing "+httpServerLabel+" contents", "One of directory, content or templates must be set.")
+	}
+	if server.PortMin < 1 || server.PortMax < server.PortMin {
+		invalid("Invalid "+httpServerLabel+" ports",
+			fmt.Sprintf("The port_min %d and port_max %d must be a range of ports.", server.PortMin, server.PortMax))
+	}
+	if (server.TLSCertificateFile == "") != (server.TLSKeyFile == "") {
+		invalid("Incomplete "+httpServerLabel+" TLS certificate",
+			"Both tls_certificate_file and tls_key_file must be set, or neither for a self-signed certificate.")
+	}
+	if server.TLSCertificateFile != "" {
+		server.TLS = true
+	}
+	// The templates are rendered with the values of the variables and the
+	// data generated by the builds, like their passwords.
+	if len(server.Templates) > 0 && !server.Token {
+		invalid("Missing "+httpServerLabel+" token",
+			"The templates are rendered with the variables and the data generated by the builds, token must be set to serve them.")
+	}
+
+	// Paths are relative to the directory Packer runs in, like the
+	// http_directory of the builders.
+	for _, path := range []*string{&server.Directory, &server.TLSCertificateFile, &server.TLSKeyFile} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(cwd, *path)
+		}
+	}
+	// The templates are looked up by the cleaned path of the requests.
+	templates := make(map[string]string, len(server.Templates))
+	for urlPath, file := range server.Templates {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(cwd, file)
+		}
+		templates[path.Clean("/"+urlPath)] = file
+	}
+	server.Templates = templates
+	return diags
+}
+
+// handler returns the handler serving the files of server, rendering its
+// templates with templates.
+func (server *HTTPServerBlock) handler(templates *httpTemplateContext) http.Handler {
+	var files http.Handler = commonsteps.MapServer(server.Content)
+	if server.Directory != "" {
+		files = http.FileServer(http.Dir(server.Directory))
+	}
+	if len(server.Templates) == 0 {
+		return files
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, found := server.Templates[path.Clean(r.URL.Path)]
+		if !found {
+			files.ServeHTTP(w, r)
+			return
+		}
+		templates.serve(w, file, r.URL.Query().Get(buildParameter))
+	})
+}
+
+// buildParameter is the query parameter naming the build requesting a
+// template, like qemu.ubuntu, for the template to use the data it generated.
+const buildParameter = "build"
+
+// httpTemplateContext renders the templates of the HTTP servers with the
+// values of the config, known once the servers started, and the data
+// generated by each build.
+type httpTemplateContext struct {
+	l    sync.Mutex
+	ectx *hcl.EvalContext
+	// generated is the data generated by each build, by build type, see
+	// packer.CoreBuild.OnGeneratedData.
+	generated map[string]map[string]interface{}
+}
+
+func (t *httpTemplateContext) setEvalContext(ectx *hcl.EvalContext) {
+	t.l.Lock()
+	defer t.l.Unlock()
+	t.ectx = ectx
+}
+
+// generatedSecrets are the keys of the data generated by the builds holding a
+// secret, like the password of their communicator.
+var generatedSecrets = []string{"Password", "SSHPrivateKey", "WinRMPassword"}
+
+func (t *httpTemplateContext) setGeneratedData(build string, data map[string]interface{}) {
+	// The secrets rendered in the templates are redacted from the logs.
+	for _, key := range generatedSecrets {
+		if s, ok := data[key].(string); ok {
+			packer.Secrets.Register(s)
+		}
+	}
+
+	t.l.Lock()
+	defer t.l.Unlock()
+	if t.generated == nil {
+		t.generated = map[string]map[string]interface{}{}
+	}
+	t.generated[build] = data
+}
+
+// serve renders file for the requests of build. The templates using values
+// that are not known yet, like the data of a build that did not connect to
+// its machine, are answered with 503 for the clients to try again later.
+func (t *httpTemplateContext) serve(w http.ResponseWriter, file, build string) {
+	content, known, err := t.render(file, build)
+	switch {
+	case err != nil:
+		log.Printf("[ERROR] failed to render %s: %s", file, err)
+		http.Error(w, fmt.Sprintf("failed to render %s", filepath.Base(file)), http.StatusInternalServerError)
+	case !known:
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, fmt.Sprintf("%s uses values that are not known yet", filepath.Base(file)), http.StatusServiceUnavailable)
+	default:
+		if _, err := w.Write([]byte(content)); err != nil {
+			log.Printf("[WARN] failed to serve %s: %s", file, err)
+		}
+	}
+}
+
+func (t *httpTemplateContext) render(file, build string) (string, bool, error) {
+	t.l.Lock()
+	ectx, data := t.ectx, t.generated[build]
+	t.l.Unlock()
+	if ectx == nil {
+		return "", false, nil
+	}
+
+	if data != nil {
+		var err error
+		if ectx, err = withBuildVariables(ectx, data); err != nil {
+			return "", false, err
+		}
+	} else {
+		// The data of the build is not known yet.
+		ectx = ectx.NewChild()
+		ectx.Variables = map[string]cty.Value{buildAccessor: cty.DynamicVal}
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, err
+	}
+	expr, diags := hclsyntax.ParseTemplate(src, file, hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", false, diags
+	}
+	val, diags := expr.Value(ectx)
+	if diags.HasErrors() {
+		return "", false, diags
+	}
+	if !val.IsWhollyKnown() {
+		return "", false, nil
+	}
+	val, err = convert.Convert(val, cty.String)
+	if err != nil {
+		return "", false, err
+	}
+	return val.AsString(), true, nil
+}
+
+// StartHTTPServers starts the HTTP servers, which stop when ctx is done.
+// Their URLs are known to the builds prepared after they started.
+func (cfg *PackerConfig) StartHTTPServers(ctx context.Context, opts packer.StartHTTPServersOptions) hcl.Diagnostics {
+	if len(cfg.HTTPServers) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.HTTPServers))
+	for name := range cfg.HTTPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfg.httpTemplates = &httpTemplateContext{}
+	var diags hcl.Diagnostics
+	for _, name := range names {
+		server := cfg.HTTPServers[name]
+		err := server.start(ctx, cfg.httpTemplates)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Failed to start %s %q", httpServerLabel, name),
+				Detail:   err.Error(),
+				Subject:  server.block.DefRange.Ptr(),
+			})
+			continue
+		}
+		opts.Ui.Say(fmt.Sprintf("HTTP server %q serving on %s", name, server.server.URL))
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// The locals using the servers were not known when they were evaluated.
+	var unknown []*LocalBlock
+	for _, local := range cfg.LocalBlocks {
+		if v, ok := cfg.LocalVariables[local.Name]; ok && !v.Value().IsWhollyKnown() {
+			unknown = append(unknown, local)
+		}
+	}
+	diags = append(diags, cfg.evaluateLocalVariables(unknown)...)
+	// The sensitive values rendered in the templates are redacted from the
+	// logs, the locals evaluated again included.
+	filterVarsFromLogs(cfg.InputVariables)
+	filterVarsFromLogs(cfg.LocalVariables)
+	// The build variables of the templates are the data generated by the
+	// build requesting them.
+	ectx := cfg.EvalContext(BuildContext, nil)
+	ectx.Variables[buildAccessor] = cty.NullVal(cty.EmptyObject)
+	cfg.httpTemplates.setEvalContext(ectx)
+	return diags
+}
+
+func (server *HTTPServerBlock) start(ctx context.Context, templates *httpTemplateContext) error {
+	if !server.known {
+		return fmt.Errorf("the server depends on values that are not known")
+	}
+	if server.Directory != "" {
+		if _, err := os.Stat(server.Directory); err != nil {
+			return err
+		}
+	}
+
+	s, err := httpserver.Start(ctx, httpserver.Config{
+		Address:  server.Address,
+		PortMin:  server.PortMin,
+		PortMax:  server.PortMax,
+		Host:     server.Host,
+		TLS:      server.TLS,
+		CertFile: server.TLSCertificateFile,
+		KeyFile:  server.TLSKeyFile,
+		Token:    server.Token,
+		Handler:  server.handler(templates),
+	})
+	if err != nil {
+		return err
+	}
+	packer.Secrets.Register(s.Token)
+	server.server = s
+
+	go func() {
+		<-ctx.Done()
+		if err := s.Close(); err != nil {
+			log.Printf("[WARN] failed to stop %s %q: %s", httpServerLabel, server.Name, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,136 @@
+package hcl2template
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPackerConfig_StartHTTPServers(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	cfg, diags := getBasicParser().Parse("testdata/http_server/basic.pkr.hcl", nil, map[string]string{
+		"password": "s3cr3t",
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse errors: %s", diags)
+	}
+	if diags := cfg.Initialize(packer.InitializeOptions{}); diags.HasErrors() {
+		t.Fatalf("unexpected initialize errors: %s", diags)
+	}
+	if cfg.LocalVariables["ks_url"].Value().IsKnown() {
+		t.Fatal("expected the URL to be unknown before the server starts")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if diags := cfg.StartHTTPServers(ctx, packer.StartHTTPServersOptions{Ui: packer.TestUi(t)}); diags.HasErrors() {
+		t.Fatalf("unexpected start errors: %s", diags)
+	}
+
+	url := cfg.LocalVariables["ks_url"].Value().AsString()
+	if !strings.HasPrefix(url, "https://127.0.0.1:") {
+		t.Fatalf("expected the local to use the URL of the server, got %q", url)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(b) != "rootpw s3cr3t" {
+		t.Errorf("unexpected response %d %q", resp.StatusCode, b)
+	}
+
+	resp, err = client.Get(strings.Split(url, "?")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a request without the token to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestPackerConfig_StartHTTPServers_templates(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	cfg, diags := getBasicParser().Parse("testdata/http_server/templates.pkr.hcl", nil, map[string]string{
+		"password": "s3cr3t",
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse errors: %s", diags)
+	}
+	if diags := cfg.Initialize(packer.InitializeOptions{}); diags.HasErrors() {
+		t.Fatalf("unexpected initialize errors: %s", diags)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if diags := cfg.StartHTTPServers(ctx, packer.StartHTTPServersOptions{Ui: packer.TestUi(t)}); diags.HasErrors() {
+		t.Fatalf("unexpected start errors: %s", diags)
+	}
+	builds, diags := cfg.GetBuilds(packer.GetBuildsOptions{})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected build errors: %s", diags)
+	}
+
+	server := cfg.HTTPServers["boot"].server
+	get := func() (int, string) {
+		resp, err := http.Get(server.URL + "/user-data?build=null.test&token=" + server.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// The build did not generate its data yet.
+	if code, _ := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected the template to be unavailable, got %d", code)
+	}
+
+	builds[0].(*packer.CoreBuild).OnGeneratedData(map[string]interface{}{
+		"SSHPublicKey": "ssh-ed25519 AAAA",
+		"Password":     "g3n3rat3d",
+	})
+	code, body := get()
+	if want := "user: packer\npassword: s3cr3t\nkey: ssh-ed25519 AAAA\n"; code != http.StatusOK || body != want {
+		t.Errorf("expected %q, got %d %q", want, code, body)
+	}
+	for _, secret := range []string{"s3cr3t", "g3n3rat3d"} {
+		if redacted := packer.Secrets.Redact("password: " + secret); strings.Contains(redacted, secret) {
+			t.Errorf("expected %q to be redacted from the logs, got %q", secret, redacted)
+		}
+	}
+}
+
+func TestPackerConfig_evaluateHTTPServers_invalid(t *testing.T) {
+	cfg, diags := getBasicParser().Parse("testdata/http_server/invalid.pkr.hcl", nil, nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse errors: %s", diags)
+	}
+	diags = cfg.Initialize(packer.InitializeOptions{})
+
+	var summaries []string
+	for _, diag := range diags {
+		summaries = append(summaries, diag.Summary)
+	}
+	want := []string{
+		"Conflicting http_server contents",
+		"Invalid http_server ports",
+		"Incomplete http_server TLS certificate",
+		"Missing http_server token",
+	}
+	if strings.Join(summaries, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the errors %q, got %q", want, summaries)
+	}
+}
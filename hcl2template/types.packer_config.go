@@ -3,16 +3,19 @@ package hcl2template
 import (
 	"fmt"
 	"log"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/gobwas/glob"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	pkrfunction "github.com/hashicorp/packer/hcl2template/function"
 	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/hashicorp/packer/internal/registry/env"
 	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
@@ -47,6 +50,19 @@ type PackerConfig struct {
 
 	Datasources Datasources
 
+	// Assets are the external files to fetch before any build starts.
+	Assets Assets
+	// buildAssets are the names of the assets referenced by each build
+	// returned by GetBuilds, by build name. A nil entry means the references
+	// are unknown, and all the assets are fetched for the build.
+	buildAssets map[string][]string
+
+	// HTTPServers serve files to the machines being built.
+	HTTPServers HTTPServers
+	// httpTemplates renders the templates of the HTTP servers once they
+	// started.
+	httpTemplates *httpTemplateContext
+
 	LocalBlocks []*LocalBlock
 
 	ValidationOptions
@@ -59,13 +75,28 @@ type PackerConfig struct {
 
 	parser *Parser
 	files  []*hcl.File
+	// varFiles are the var files of the template, see ScanSecrets.
+	varFiles []*hcl.File
+	// invalidVariables is set when a var file can't be parsed or a variable
+	// has no value or an invalid one, see InvalidVariables.
+	invalidVariables bool
 
 	// Fields passed as command line flags
-	except  []glob.Glob
-	only    []glob.Glob
-	force   bool
-	debug   bool
-	onError string
+	except          []glob.Glob
+	only            []glob.Glob
+	force           bool
+	forceDeregister bool
+	debug           bool
+	incremental     bool
+	fromStage       string
+	onError         string
+	onErrorRetries  int
+	// hashInputs computes the input hashes of the components of the builds,
+	// for incremental builds or to detect changes.
+	hashInputs bool
+	// targetHost provisions an existing machine instead of running the
+	// builders, see packer.ProvisionOnlyBuilder.
+	targetHost string
 }
 
 type ValidationOptions struct {
@@ -80,6 +111,9 @@ const (
 	buildAccessor          = "build"
 	packerAccessor         = "packer"
 	dataAccessor           = "data"
+	assetAccessor          = "asset"
+	httpServerAccessor     = "http_server"
+	matrixAccessor         = "matrix"
 )
 
 type BlockContext int
@@ -92,6 +126,24 @@ const (
 	NilContext
 )
 
+// functions returns the functions available to the expressions of the
+// config: the builtin functions of Functions, along with the functions of the
+// plugins. A plugin function named like a builtin one is ignored.
+func (cfg *PackerConfig) functions() map[string]function.Function {
+	funcs := Functions(cfg.Basedir)
+	if cfg.parser == nil || cfg.parser.PluginConfig == nil {
+		return funcs
+	}
+	for name, fn := range cfg.parser.PluginConfig.Functions {
+		if _, exists := funcs[name]; exists {
+			log.Printf("[WARN] ignoring plugin function %s, it is a builtin function", name)
+			continue
+		}
+		funcs[name] = fn
+	}
+	return funcs
+}
+
 // EvalContext returns the *hcl.EvalContext that will be passed to an hcl
 // decoder in order to tell what is the actual value of a var or a local and
 // the list of defined functions.
@@ -99,7 +151,7 @@ func (cfg *PackerConfig) EvalContext(ctx BlockContext, variables map[string]cty.
 	inputVariables := cfg.InputVariables.Values()
 	localVariables := cfg.LocalVariables.Values()
 	ectx := &hcl.EvalContext{
-		Functions: Functions(cfg.Basedir),
+		Functions: cfg.functions(),
 		Variables: map[string]cty.Value{
 			inputVariablesAccessor: cty.ObjectVal(inputVariables),
 			localsAccessor:         cty.ObjectVal(localVariables),
@@ -107,26 +159,18 @@ func (cfg *PackerConfig) EvalContext(ctx BlockContext, variables map[string]cty.
 				"type": cty.UnknownVal(cty.String),
 				"name": cty.UnknownVal(cty.String),
 			}),
-			buildAccessor: cty.UnknownVal(cty.EmptyObject),
-			packerAccessor: cty.ObjectVal(map[string]cty.Value{
-				"version":     cty.StringVal(cfg.CorePackerVersionString),
-				"iterationID": cty.UnknownVal(cty.String),
-			}),
+			buildAccessor:  cty.UnknownVal(cty.EmptyObject),
+			matrixAccessor: cty.UnknownVal(cty.DynamicPseudoType),
+			packerAccessor: cfg.packerValues(nil),
 			pathVariablesAccessor: cty.ObjectVal(map[string]cty.Value{
 				"cwd":  cty.StringVal(strings.ReplaceAll(cfg.Cwd, `\`, `/`)),
 				"root": cty.StringVal(strings.ReplaceAll(cfg.Basedir, `\`, `/`)),
 			}),
+			assetAccessor:      cty.ObjectVal(cfg.Assets.Values()),
+			httpServerAccessor: cty.ObjectVal(cfg.HTTPServers.Values()),
 		},
 	}
 
-	// Store the iteration_id, if it exists. Otherwise, it'll be "unknown"
-	if cfg.bucket != nil {
-		ectx.Variables[packerAccessor] = cty.ObjectVal(map[string]cty.Value{
-			"version":     cty.StringVal(cfg.CorePackerVersionString),
-			"iterationID": cty.StringVal(cfg.bucket.Iteration.ID),
-		})
-	}
-
 	// In the future we'd like to load and execute HCL blocks using a graph
 	// dependency tree, so that any block can use any block whatever the
 	// order.
@@ -144,6 +188,27 @@ func (cfg *PackerConfig) EvalContext(ctx BlockContext, variables map[string]cty.
 	return ectx
 }
 
+// packerValues returns the value of the packer accessor, for the blocks of a
+// source built with builder, or for the other blocks when builder is nil.
+func (cfg *PackerConfig) packerValues(builder packersdk.Builder) cty.Value {
+	// Store the iteration_id, if it exists. Otherwise, it'll be "unknown"
+	iterationID := cty.UnknownVal(cty.String)
+	if cfg.bucket != nil {
+		iterationID = cty.StringVal(cfg.bucket.Iteration.ID)
+	}
+	return cty.ObjectVal(map[string]cty.Value{
+		"version":     cty.StringVal(cfg.CorePackerVersionString),
+		"iterationID": iterationID,
+		// features is a map rather than an object so that templates can
+		// lookup() the features unknown to older versions of Packer.
+		"features": cty.MapVal(map[string]cty.Value{
+			"registry":     cty.BoolVal(cfg.bucket != nil || env.IsPAREnabled()),
+			"snapshots":    cty.BoolVal(builder != nil && packer.SupportsSnapshots(builder)),
+			"reproducible": cty.BoolVal(packer.Reproducible()),
+		}),
+	})
+}
+
 // decodeInputVariables looks in the found blocks for 'variables' and
 // 'variable' blocks. It should be called firsthand so that other blocks can
 // use the variables.
@@ -232,6 +297,9 @@ func (c *PackerConfig) evaluateLocalVariables(locals []*LocalBlock) hcl.Diagnost
 		c.LocalVariables = Variables{}
 	}
 
+	// The evaluated locals are removed from the list, leave the caller's
+	// untouched.
+	locals = append([]*LocalBlock(nil), locals...)
 	for foundSomething := true; foundSomething; {
 		foundSomething = false
 		for i := 0; i < len(locals); {
@@ -485,17 +553,35 @@ func (cfg *PackerConfig) getCoreBuildProvisioner(source SourceUseBlock, pb *Prov
 		return packer.CoreBuildProvisioner{}, diags
 	}
 
+	var inputHash string
+	if cfg.hashInputs {
+		var err error
+		inputHash, err = provisioner.(*HCL2Provisioner).inputHash()
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Failed to hash the inputs of %s", pb),
+				Detail:   err.Error(),
+				Subject:  pb.HCL2Ref.DefRange.Ptr(),
+			})
+			return packer.CoreBuildProvisioner{}, diags
+		}
+	}
+
+	// The timeout wraps the provisioner before the pauser does, so that the
+	// pause does not count against the timeout.
+	if pb.Timeout != 0 {
+		provisioner = &packer.TimeoutProvisioner{
+			Timeout:     pb.Timeout,
+			Provisioner: provisioner,
+		}
+	}
 	// If we're pausing, we wrap the provisioner in a special pauser.
 	if pb.PauseBefore != 0 {
 		provisioner = &packer.PausedProvisioner{
 			PauseBefore: pb.PauseBefore,
 			Provisioner: provisioner,
 		}
-	} else if pb.Timeout != 0 {
-		provisioner = &packer.TimeoutProvisioner{
-			Timeout:     pb.Timeout,
-			Provisioner: provisioner,
-		}
 	}
 	if pb.MaxRetries != 0 {
 		provisioner = &packer.RetriedProvisioner{
@@ -508,6 +594,8 @@ func (cfg *PackerConfig) getCoreBuildProvisioner(source SourceUseBlock, pb *Prov
 		PType:       pb.PType,
 		PName:       pb.PName,
 		Provisioner: provisioner,
+		InputHash:   inputHash,
+		Stage:       pb.Stage,
 	}, diags
 }
 
@@ -575,12 +663,25 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 	res := []packersdk.Build{}
 	var diags hcl.Diagnostics
 	possibleBuildNames := []string{}
+	tagMatches := 0
 
 	cfg.debug = opts.Debug
 	cfg.force = opts.Force
+	cfg.forceDeregister = opts.ForceDeregister
 	cfg.onError = opts.OnError
+	cfg.onErrorRetries = opts.OnErrorRetries
+	cfg.incremental = opts.Incremental
+	cfg.fromStage = opts.FromStage
+	cfg.hashInputs = opts.Incremental || opts.HashInputs
+	cfg.targetHost = opts.TargetHost
+	cfg.buildAssets = map[string][]string{}
+	defer cfg.parser.PluginConfig.AttributeProcesses("")
 
 	for _, build := range cfg.Builds {
+		if build.Skip {
+			log.Printf("[INFO] skipping the builds of the build block %q: its skip_if expression is true", build.Name)
+			continue
+		}
 		for _, srcUsage := range build.Sources {
 			src, found := cfg.Sources[srcUsage.SourceRef]
 			if !found {
@@ -594,32 +695,56 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 			}
 
 			pcb := &packer.CoreBuild{
-				BuildName: build.Name,
-				Type:      srcUsage.String(),
+				BuildName:        build.Name,
+				Type:             srcUsage.String(),
+				SerialGroup:      srcUsage.SerialGroup,
+				HostRequirements: srcUsage.HostRequirements,
+				DependsOn:        build.DependsOn,
+				Priority:         build.Priority,
+				Timeout:          build.Timeout,
+				EncryptionPolicy: build.EncryptionPolicy,
+				PreBuild:         build.PreBuild,
+				PostBuild:        build.PostBuild,
+			}
+			if build.Retries != nil {
+				pcb.RetryAttempts = build.Retries.Attempts
+				pcb.RetryBackoff = build.Retries.Backoff
+			}
+
+			if cfg.httpTemplates != nil {
+				templates, buildType := cfg.httpTemplates, pcb.Type
+				pcb.OnGeneratedData = func(data map[string]interface{}) {
+					templates.setGeneratedData(buildType, data)
+				}
 			}
 
 			pcb.SetDebug(cfg.debug)
 			pcb.SetForce(cfg.force)
+			pcb.SetForceDeregister(cfg.forceDeregister)
 			pcb.SetOnError(cfg.onError)
+			pcb.SetOnErrorRetries(cfg.onErrorRetries)
+			pcb.SetIncremental(cfg.incremental)
+			pcb.SetFromStage(cfg.fromStage)
 
-			// Apply the -only and -except command-line options to exclude matching builds.
+			// Apply the -tag, -only and -except command-line options to exclude
+			// matching builds.
 			buildName := pcb.Name()
 			possibleBuildNames = append(possibleBuildNames, buildName)
+			tags := mergeTags(build.Tags, srcUsage.Tags)
+			// -tag
+			if !hasTags(tags, opts.Tags) {
+				continue
+			}
+			tagMatches++
+
 			// -only
 			if len(opts.Only) > 0 {
-				onlyGlobs, diags := convertFilterOption(opts.Only, "only")
+				onlyFilter, diags := convertBuildFilterOption(opts.Only, "only")
 				if diags.HasErrors() {
 					return nil, diags
 				}
-				cfg.only = onlyGlobs
-				include := false
-				for _, onlyGlob := range onlyGlobs {
-					if onlyGlob.Match(buildName) {
-						include = true
-						break
-					}
-				}
-				if !include {
+				cfg.only = onlyFilter.names
+				if !onlyFilter.match(buildName, tags) {
 					continue
 				}
 				opts.OnlyMatches++
@@ -627,29 +752,48 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 
 			// -except
 			if len(opts.Except) > 0 {
-				exceptGlobs, diags := convertFilterOption(opts.Except, "except")
+				exceptFilter, diags := convertBuildFilterOption(opts.Except, "except")
 				if diags.HasErrors() {
 					return nil, diags
 				}
-				cfg.except = exceptGlobs
-				exclude := false
-				for _, exceptGlob := range exceptGlobs {
-					if exceptGlob.Match(buildName) {
-						exclude = true
-						break
-					}
-				}
-				if exclude {
+				cfg.except = exceptFilter.names
+				if exceptFilter.match(buildName, tags) {
 					opts.ExceptMatches++
 					continue
 				}
 			}
 
-			builder, moreDiags, generatedVars := cfg.startBuilder(srcUsage, cfg.EvalContext(BuildContext, nil))
+			// The sources of a build depending on other builds can reference
+			// their artifacts, which are unknown until these builds ran.
+			var sourceVariables map[string]cty.Value
+			if len(build.DependsOn) > 0 {
+				sourceVariables = map[string]cty.Value{
+					buildAccessor: upstreamBuildValues(build, nil),
+				}
+			}
+			// The builds left out by the options are not published to
+			// the HCP Packer registry by this run, see PartialRun.
+			cfg.bucket.SelectBuildForComponent(srcUsage.String())
+
+			cfg.parser.PluginConfig.AttributeProcesses(buildName)
+			pcb.TempDir = packer.BuildTempDir(opts.TempDirRoot, buildName)
+			builder, moreDiags, generatedVars, builderInputHash := cfg.startBuilder(srcUsage, pcb.TempDir, cfg.EvalContext(BuildContext, sourceVariables))
 			diags = append(diags, moreDiags...)
 			if moreDiags.HasErrors() {
 				continue
 			}
+			pcb.BuilderInputHash = builderInputHash
+			cfg.buildAssets[buildName] = cfg.assetReferences(build, srcUsage, src)
+			if len(build.DependsOn) > 0 {
+				refs, moreDiags := cfg.upstreamReferences(build, srcUsage, builder.ConfigSpec())
+				diags = append(diags, moreDiags...)
+				if moreDiags.HasErrors() {
+					continue
+				}
+				if len(refs) > 0 {
+					pcb.ResolveDependencies = cfg.dependencyResolver(build, srcUsage, refs, pcb)
+				}
+			}
 
 			// If the builder has provided a list of to-be-generated variables that
 			// should be made accessible to provisioners, pass that list into
@@ -661,13 +805,27 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 				unknownBuildValues[k] = cty.StringVal("<unknown>")
 			}
 			unknownBuildValues["name"] = cty.StringVal(build.Name)
+			unknownBuildValues[packer.TempDirDataKey] = cty.StringVal(pcb.TempDir)
+			if cfg.bucket != nil {
+				// The post-processors can read the status of the iteration,
+				// see packer.RegistryPostProcessor.
+				unknownBuildValues[packer.HCPBucketSlugDataKey] = cty.UnknownVal(cty.String)
+				unknownBuildValues[packer.HCPIterationIDDataKey] = cty.UnknownVal(cty.String)
+				unknownBuildValues[packer.HCPBuildStatusesDataKey] = cty.UnknownVal(cty.Map(cty.String))
+				unknownBuildValues[packer.HCPChannelsDataKey] = cty.UnknownVal(cty.List(cty.String))
+				unknownBuildValues[packer.HCPSiblingBuildsDoneDataKey] = cty.UnknownVal(cty.Bool)
+			}
 
 			variables := map[string]cty.Value{
 				sourcesAccessor: cty.ObjectVal(srcUsage.ctyValues()),
 				buildAccessor:   cty.ObjectVal(unknownBuildValues),
+				matrixAccessor:  cty.ObjectVal(srcUsage.Matrix),
+				packerAccessor:  cfg.packerValues(builder),
 			}
 
-			provisioners, moreDiags := cfg.getCoreBuildProvisioners(srcUsage, build.ProvisionerBlocks, cfg.EvalContext(BuildContext, variables))
+			pcb.DebugEvaluator = debugEvaluator(cfg.EvalContext(BuildContext, variables))
+
+			provisioners, moreDiags := cfg.getCoreBuildProvisioners(srcUsage, build.provisionersFor(srcUsage), cfg.EvalContext(BuildContext, variables))
 			diags = append(diags, moreDiags...)
 			if moreDiags.HasErrors() {
 				continue
@@ -677,6 +835,19 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 			if moreDiags.HasErrors() {
 				continue
 			}
+			if cfg.hashInputs {
+				hash, err := postProcessorsInputHash(pps)
+				if err != nil {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Failed to hash the inputs of the post-processors of " + srcUsage.String(),
+						Detail:   err.Error(),
+						Subject:  build.HCL2Ref.DefRange.Ptr(),
+					})
+					continue
+				}
+				pcb.PostProcessorsInputHash = hash
+			}
 
 			if cfg.bucket != nil {
 				pps = append(pps, []packer.CoreBuildPostProcessor{
@@ -700,7 +871,8 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 				}
 			}
 
-			if cfg.bucket != nil && cfg.bucket.Validate() == nil {
+			// Provision-only builds produce no artifact to publish.
+			if cfg.bucket != nil && cfg.bucket.Validate() == nil && cfg.targetHost == "" {
 				builder = &packer.RegistryBuilder{
 					Name:                      srcUsage.String(),
 					Builder:                   builder,
@@ -729,6 +901,12 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 			res = append(res, pcb)
 		}
 	}
+	if len(opts.Tags) > 0 && tagMatches == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("a 'tag' option was passed, but no build is tagged with all of %v.", opts.Tags),
+		})
+	}
 	if len(opts.Only) > opts.OnlyMatches {
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagWarning,
@@ -869,6 +1047,69 @@ func (p *PackerConfig) handleEval(line string) (out string, exit bool, diags hcl
 	return PrintableCtyValue(val), false, diags
 }
 
+// EvaluateExpressionsFile evaluates the expressions of the HCL, or JSON, file
+// at path in the context of the config, like EvaluateExpression does.
+func (p *PackerConfig) EvaluateExpressionsFile(path string) (map[string]cty.Value, hcl.Diagnostics) {
+	attrs, diags := ParseExpressionsFile(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	ectx := p.EvalContext(NilContext, nil)
+	values := map[string]cty.Value{}
+	for name, attr := range attrs {
+		val, moreDiags := attr.Expr.Value(ectx)
+		diags = append(diags, moreDiags...)
+		values[name] = val
+	}
+	return values, diags
+}
+
+// ParseExpressionsFile returns the attributes of the HCL, or JSON, file at
+// path: the named expressions to evaluate with EvaluateExpressionsFile.
+func ParseExpressionsFile(path string) (hcl.Attributes, hcl.Diagnostics) {
+	parser := hclparse.NewParser()
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if filepath.Ext(path) == ".json" {
+		file, diags = parser.ParseJSONFile(path)
+	} else {
+		file, diags = parser.ParseHCLFile(path)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	attrs, moreDiags := file.Body.JustAttributes()
+	return attrs, append(diags, moreDiags...)
+}
+
+// debugEvaluator returns the packer.DebugEvaluator of a build, evaluating the
+// expressions like the console does, in ectx, the context of the provisioners
+// of the build, with the build variables set to the data generated by its
+// builder.
+func debugEvaluator(ectx *hcl.EvalContext) packer.DebugEvaluator {
+	return func(line string, generatedData map[string]interface{}) (string, hcl.Diagnostics) {
+		expr, diags := hclsyntax.ParseExpression([]byte(line), "<debug-input>", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return "", diags
+		}
+		buildCtx, err := withBuildVariables(ectx, generatedData)
+		if err != nil {
+			return "", append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read the data generated by the builder",
+				Detail:   err.Error(),
+			})
+		}
+		val, moreDiags := expr.Value(buildCtx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return "", diags
+		}
+		return PrintableCtyValue(val), diags
+	}
+}
+
 func (p *PackerConfig) FixConfig(_ packer.FixConfigOptions) (diags hcl.Diagnostics) {
 	// No Fixers exist for HCL2 configs so there is nothing to do here for now.
 	return
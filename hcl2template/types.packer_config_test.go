@@ -1,6 +1,7 @@
 package hcl2template
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 	"time"
@@ -662,3 +663,78 @@ func mustVersionConstraints(vs version.Constraints, err error) version.Constrain
 	}
 	return vs
 }
+
+func TestPackerConfig_debugEvaluator(t *testing.T) {
+	parser := getBasicParser()
+	if err := parser.PluginConfig.RegisterFunction("mock_valid_name", mockValidNameFunc); err != nil {
+		t.Fatalf("failed to register the function: %s", err)
+	}
+	cfg, diags := parser.Parse("testdata/functions/plugin.pkr.hcl", nil, nil)
+	if diags.HasErrors() {
+		t.Fatalf("failed to parse the template: %s", diags)
+	}
+	if diags := cfg.Initialize(packer.InitializeOptions{}); diags.HasErrors() {
+		t.Fatalf("failed to initialize the template: %s", diags)
+	}
+	builds, diags := cfg.GetBuilds(packer.GetBuildsOptions{})
+	if diags.HasErrors() {
+		t.Fatalf("failed to get the builds: %s", diags)
+	}
+	evaluate := builds[0].(*packer.CoreBuild).DebugEvaluator
+
+	tests := []struct {
+		expr      string
+		data      map[string]interface{}
+		want      string
+		wantError bool
+	}{
+		{`"${local.image_name}/${source.name}"`, nil, "MY-IMAGE/example", false},
+		{`build.Host`, nil, "<unknown>", false},
+		{`build.Host`, map[string]interface{}{"Host": "10.0.0.1"}, "10.0.0.1", false},
+		{`lookup(packer.features, "snapshots", true)`, nil, "false", false},
+		{`var.nope`, nil, "", true},
+		{`upper(`, nil, "", true},
+	}
+	for _, tt := range tests {
+		got, diags := evaluate(tt.expr, tt.data)
+		if diags.HasErrors() != tt.wantError {
+			t.Errorf("%s: unexpected diagnostics: %s", tt.expr, diags)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, expected %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+type snapshottingMockBuilder struct {
+	MockBuilder
+}
+
+func (*snapshottingMockBuilder) Snapshot(context.Context, packersdk.Ui, string) (string, error) {
+	return "", nil
+}
+
+func (*snapshottingMockBuilder) ResumeFrom(string) error { return nil }
+
+func TestPackerConfig_packerValues(t *testing.T) {
+	t.Setenv(packer.SourceDateEpochEnvVar, "1622548800")
+	t.Setenv("HCP_PACKER_REGISTRY", "off")
+
+	cfg := &PackerConfig{CorePackerVersionString: lockedVersion}
+	tests := []struct {
+		builder packersdk.Builder
+		want    map[string]bool
+	}{
+		{nil, map[string]bool{"registry": false, "snapshots": false, "reproducible": true}},
+		{&MockBuilder{}, map[string]bool{"registry": false, "snapshots": false, "reproducible": true}},
+		{&snapshottingMockBuilder{}, map[string]bool{"registry": false, "snapshots": true, "reproducible": true}},
+	}
+	for _, tt := range tests {
+		features := cfg.packerValues(tt.builder).GetAttr("features")
+		for name, want := range tt.want {
+			if got := features.Index(cty.StringVal(name)); got.True() != want {
+				t.Errorf("%T: expected feature %s to be %t, got %#v", tt.builder, name, want, got)
+			}
+		}
+	}
+}
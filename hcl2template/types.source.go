@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/hcl/v2/gohcl"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
+	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -20,7 +21,21 @@ type SourceBlock struct {
 	// Given name; if any
 	Name string
 
+	// SerialGroup is an optional name shared by sources contending for the
+	// same resource, builds of a same serial group never run concurrently.
+	SerialGroup string
+
+	// HostRequirements is what the machine running Packer must provide to
+	// build the source, if set.
+	HostRequirements *packer.HostRequirements
+
+	// Tags select the builds of the source with -only, -except and -tag.
+	Tags []string
+
 	block *hcl.Block
+	// body is the body of the block, without the settings handled by Packer
+	// itself, like serial_group.
+	body hcl.Body
 
 	// LocalName can be set in a singular source block from a build block, it
 	// allows to give a special name to a build in the logs.
@@ -38,6 +53,22 @@ type SourceUseBlock struct {
 	// allows to give a special name to a build in the logs.
 	LocalName string
 
+	// SerialGroup can be set in a singular source block from a build block,
+	// it overrides the serial group of the source definition.
+	SerialGroup string
+
+	// HostRequirements can be set in a singular source block from a build
+	// block, it overrides the host requirements of the source definition.
+	HostRequirements *packer.HostRequirements
+
+	// Tags can be set in a singular source block from a build block, they are
+	// added to the tags of the source definition.
+	Tags []string
+
+	// Matrix holds the values of the combination of the matrix of the build
+	// the source is started for, if any, see MatrixBlock.
+	Matrix map[string]cty.Value
+
 	// Rest of the body, in case the build.source block has more specific
 	// content
 	// Body can be expanded by a dynamic tag.
@@ -73,16 +104,26 @@ func (p *Parser) decodeBuildSource(block *hcl.Block) (SourceUseBlock, hcl.Diagno
 	ref := sourceRefFromString(block.Labels[0])
 	out := SourceUseBlock{SourceRef: ref}
 	var b struct {
-		Name string   `hcl:"name,optional"`
-		Rest hcl.Body `hcl:",remain"`
+		Name             string                 `hcl:"name,optional"`
+		SerialGroup      string                 `hcl:"serial_group,optional"`
+		HostRequirements *HostRequirementsBlock `hcl:"host_requirements,block"`
+		Tags             []string               `hcl:"tags,optional"`
+		Rest             hcl.Body               `hcl:",remain"`
 	}
 	diags := gohcl.DecodeBody(block.Body, nil, &b)
 	if diags.HasErrors() {
 		return out, diags
 	}
 	out.LocalName = b.Name
+	out.SerialGroup = b.SerialGroup
+	out.Tags = b.Tags
 	out.Body = b.Rest
-	return out, nil
+	if b.HostRequirements != nil {
+		var moreDiags hcl.Diagnostics
+		out.HostRequirements, moreDiags = b.HostRequirements.requirements(&block.DefRange)
+		diags = append(diags, moreDiags...)
+	}
+	return out, diags
 }
 
 func (p *Parser) decodeSource(block *hcl.Block) (SourceBlock, hcl.Diagnostics) {
@@ -91,33 +132,55 @@ func (p *Parser) decodeSource(block *hcl.Block) (SourceBlock, hcl.Diagnostics) {
 		Name:  block.Labels[1],
 		block: block,
 	}
-	var diags hcl.Diagnostics
+	var b struct {
+		SerialGroup      string                 `hcl:"serial_group,optional"`
+		HostRequirements *HostRequirementsBlock `hcl:"host_requirements,block"`
+		Tags             []string               `hcl:"tags,optional"`
+		Rest             hcl.Body               `hcl:",remain"`
+	}
+	diags := gohcl.DecodeBody(block.Body, nil, &b)
+	if diags.HasErrors() {
+		return source, diags
+	}
+	source.SerialGroup = b.SerialGroup
+	source.Tags = b.Tags
+	source.body = b.Rest
+	if b.HostRequirements != nil {
+		var moreDiags hcl.Diagnostics
+		source.HostRequirements, moreDiags = b.HostRequirements.requirements(&block.DefRange)
+		diags = append(diags, moreDiags...)
+	}
 
 	return source, diags
 }
 
-func (cfg *PackerConfig) startBuilder(source SourceUseBlock, ectx *hcl.EvalContext) (packersdk.Builder, hcl.Diagnostics, []string) {
+// startBuilder starts and prepares the builder of source, its plugin creating
+// its temporary files in tempDir, see packer.CoreBuild.TempDir.
+func (cfg *PackerConfig) startBuilder(source SourceUseBlock, tempDir string, ectx *hcl.EvalContext) (packersdk.Builder, hcl.Diagnostics, []string, string) {
 	var diags hcl.Diagnostics
 
-	builder, err := cfg.parser.PluginConfig.Builders.Start(source.Type)
+	builder, err := cfg.parser.PluginConfig.StartBuilder(source.Type, tempDir)
 	if err != nil {
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "Failed to load " + sourceLabel + " type",
 			Detail:   err.Error(),
 		})
-		return builder, diags, nil
+		return builder, diags, nil, ""
 	}
 
 	body := source.Body
 	// Add known values to source accessor in eval context.
 	ectx.Variables[sourcesAccessor] = cty.ObjectVal(source.ctyValues())
+	ectx.Variables[matrixAccessor] = cty.ObjectVal(source.Matrix)
+	ectx.Variables[packerAccessor] = cfg.packerValues(builder)
 
 	decoded, moreDiags := decodeHCL2Spec(body, ectx, builder)
 	diags = append(diags, moreDiags...)
 	if moreDiags.HasErrors() {
-		return builder, diags, nil
+		return builder, diags, nil, ""
 	}
+	registerConfigSecrets(decoded)
 
 	// In case of cty.Unknown values, this will write a equivalent placeholder of the same type
 	// Unknown types are not recognized by the json marshal during the RPC call and we have to do this here
@@ -125,6 +188,15 @@ func (cfg *PackerConfig) startBuilder(source SourceUseBlock, ectx *hcl.EvalConte
 	// We don't do this before so we can validate if variable types matches correctly on decodeHCL2Spec.
 	decoded = hcl2shim.WriteUnknownPlaceholderValues(decoded)
 
+	// -force-deregister takes precedence over the force_deregister setting of
+	// the source.
+	if cfg.forceDeregister && decoded.IsKnown() && !decoded.IsNull() &&
+		decoded.Type().IsObjectType() && decoded.Type().HasAttribute(packer.ForceDeregisterConfigKey) {
+		vals := decoded.AsValueMap()
+		vals[packer.ForceDeregisterConfigKey] = cty.True
+		decoded = cty.ObjectVal(vals)
+	}
+
 	// Note: HCL prepares inside of the Start func, but Json does not. Json
 	// builds are instead prepared only in command/build.go
 	// TODO: either make json prepare when plugins are loaded, or make HCL
@@ -136,10 +208,27 @@ func (cfg *PackerConfig) startBuilder(source SourceUseBlock, ectx *hcl.EvalConte
 	builderVars["packer_force"] = strconv.FormatBool(cfg.force)
 	builderVars["packer_on_error"] = cfg.onError
 
+	if cfg.targetHost != "" {
+		builder = &packer.ProvisionOnlyBuilder{Builder: builder, Host: cfg.targetHost}
+	}
 	generatedVars, warning, err := builder.Prepare(builderVars, decoded)
 	moreDiags = warningErrorsToDiags(cfg.Sources[source.SourceRef].block, warning, err)
 	diags = append(diags, moreDiags...)
-	return builder, diags, generatedVars
+
+	// Incremental builds only resume from the snapshots of a builder whose
+	// configuration did not change.
+	var hash string
+	if cfg.hashInputs && !diags.HasErrors() {
+		hash, err = inputHash(source.Type, decoded)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to hash the inputs of " + source.String(),
+				Detail:   err.Error(),
+			})
+		}
+	}
+	return builder, diags, generatedVars, hash
 }
 
 // These variables will populate the PackerConfig inside of the builders.
@@ -0,0 +1,80 @@
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/packer/packer"
+)
+
+// HostRequirementsBlock is what the machine running Packer must provide to
+// build a source, checked by validate and before building. For example:
+//
+//	host_requirements {
+//		virtualization = ["kvm"]
+//		min_memory     = "8GB"
+//		min_free_disk  = "40GB"
+//		disk_path      = "output"
+//		commands       = ["qemu-img", "xorriso"]
+//	}
+type HostRequirementsBlock struct {
+	Virtualization []string `hcl:"virtualization,optional"`
+	MinMemory      string   `hcl:"min_memory,optional"`
+	MinFreeDisk    string   `hcl:"min_free_disk,optional"`
+	DiskPath       string   `hcl:"disk_path,optional"`
+	Commands       []string `hcl:"commands,optional"`
+}
+
+// requirements validates b and returns the corresponding requirements,
+// reporting errors on subject.
+func (b *HostRequirementsBlock) requirements(subject *hcl.Range) (*packer.HostRequirements, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	req := &packer.HostRequirements{
+		DiskPath: b.DiskPath,
+		Commands: b.Commands,
+	}
+
+	for _, feature := range b.Virtualization {
+		known := false
+		for _, f := range packer.VirtualizationFeatures {
+			known = known || f == feature
+		}
+		if !known {
+			diags = append(diags, &hcl.Diagnostic{
+				Summary:  "Unknown virtualization feature " + feature,
+				Severity: hcl.DiagError,
+				Detail:   fmt.Sprintf("Known features: %v", packer.VirtualizationFeatures),
+				Subject:  subject,
+			})
+			continue
+		}
+		req.Virtualization = append(req.Virtualization, feature)
+	}
+
+	for _, size := range []struct {
+		name  string
+		value string
+		dst   *uint64
+	}{
+		{"min_memory", b.MinMemory, &req.MinMemory},
+		{"min_free_disk", b.MinFreeDisk, &req.MinFreeDisk},
+	} {
+		if size.value == "" {
+			continue
+		}
+		var v datasize.ByteSize
+		if err := v.UnmarshalText([]byte(size.value)); err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Summary:  "Failed to parse " + size.name,
+				Severity: hcl.DiagError,
+				Detail:   fmt.Sprintf("%s must be a size like \"8GB\" or \"512MB\": %s", size.name, err),
+				Subject:  subject,
+			})
+			continue
+		}
+		*size.dst = v.Bytes()
+	}
+
+	return req, diags
+}
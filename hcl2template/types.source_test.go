@@ -5,10 +5,18 @@ import (
 	"testing"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
 )
 
 func TestParse_source(t *testing.T) {
 	defaultParser := getBasicParser()
+	hostRequirements := &packer.HostRequirements{
+		Virtualization: []string{"kvm"},
+		MinMemory:      8 << 30,
+		MinFreeDisk:    512 << 20,
+		DiskPath:       "output",
+		Commands:       []string{"qemu-img"},
+	}
 
 	tests := []parseTest{
 		{"two basic sources",
@@ -31,6 +39,75 @@ func TestParse_source(t *testing.T) {
 			[]packersdk.Build{},
 			false,
 		},
+		{"source with a serial group",
+			defaultParser,
+			parseTestArgs{"testdata/sources/serial_group.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "sources"),
+				Sources: map[SourceRef]SourceBlock{
+					{
+						Type: "virtualbox-iso",
+						Name: "ubuntu-1204",
+					}: {
+						Type:        "virtualbox-iso",
+						Name:        "ubuntu-1204",
+						SerialGroup: "host-1",
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{},
+			false,
+		},
+		{"source with host requirements",
+			defaultParser,
+			parseTestArgs{"testdata/sources/host_requirements.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "sources"),
+				Sources: map[SourceRef]SourceBlock{
+					refVBIsoUbuntu1204: {
+						Type:             "virtualbox-iso",
+						Name:             "ubuntu-1204",
+						HostRequirements: hostRequirements,
+					},
+				},
+				Builds: Builds{
+					&BuildBlock{
+						Sources: []SourceUseBlock{
+							{
+								SourceRef:        refVBIsoUbuntu1204,
+								HostRequirements: hostRequirements,
+							},
+						},
+					},
+				},
+			},
+			false, false,
+			[]packersdk.Build{
+				&packer.CoreBuild{
+					Type:             "virtualbox-iso.ubuntu-1204",
+					Prepared:         true,
+					Builder:          emptyMockBuilder,
+					Provisioners:     []packer.CoreBuildProvisioner{},
+					PostProcessors:   [][]packer.CoreBuildPostProcessor{},
+					HostRequirements: hostRequirements,
+				},
+			},
+			false,
+		},
+		{"source with invalid host requirements",
+			defaultParser,
+			parseTestArgs{"testdata/sources/host_requirements_invalid.pkr.hcl", nil, nil},
+			&PackerConfig{
+				CorePackerVersionString: lockedVersion,
+				Basedir:                 filepath.Join("testdata", "sources"),
+			},
+			true, true,
+			nil,
+			false,
+		},
 		{"untyped source",
 			defaultParser,
 			parseTestArgs{"testdata/sources/untyped.pkr.hcl", nil, nil},
@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/packer/hcl2template/addrs"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
 )
 
 // A consistent detail message for all "not a valid identifier" diagnostics.
@@ -81,8 +82,8 @@ func (v *Variable) GoString() string {
 }
 
 // validateValue ensures that all of the configured custom validations for a
-// variable value are passing.
-func (v *Variable) validateValue(val VariableAssignment) (diags hcl.Diagnostics) {
+// variable value are passing. The validations can call funcs.
+func (v *Variable) validateValue(val VariableAssignment, funcs map[string]function.Function) (diags hcl.Diagnostics) {
 	if len(v.Validations) == 0 {
 		log.Printf("[TRACE] validateValue: not active for %s, so skipping", v.Name)
 		return nil
@@ -94,7 +95,7 @@ func (v *Variable) validateValue(val VariableAssignment) (diags hcl.Diagnostics)
 				v.Name: val.Value,
 			}),
 		},
-		Functions: Functions(""),
+		Functions: funcs,
 	}
 
 	for _, validation := range v.Validations {
@@ -161,8 +162,8 @@ func (v *Variable) Value() cty.Value {
 }
 
 // ValidateValue tells if the selected value for the Variable is valid according
-// to its validation settings.
-func (v *Variable) ValidateValue() hcl.Diagnostics {
+// to its validation settings, which can call funcs.
+func (v *Variable) ValidateValue(funcs map[string]function.Function) hcl.Diagnostics {
 	if len(v.Values) == 0 {
 		return hcl.Diagnostics{&hcl.Diagnostic{
 			Severity: hcl.DiagError,
@@ -174,7 +175,7 @@ func (v *Variable) ValidateValue() hcl.Diagnostics {
 		}}
 	}
 
-	return v.validateValue(v.Values[len(v.Values)-1])
+	return v.validateValue(v.Values[len(v.Values)-1], funcs)
 }
 
 type Variables map[string]*Variable
@@ -196,10 +197,10 @@ func (variables Variables) Values() map[string]cty.Value {
 	return res
 }
 
-func (variables Variables) ValidateValues() hcl.Diagnostics {
+func (variables Variables) ValidateValues(funcs map[string]function.Function) hcl.Diagnostics {
 	var diags hcl.Diagnostics
 	for _, v := range variables {
-		diags = append(diags, v.ValidateValue()...)
+		diags = append(diags, v.ValidateValue(funcs)...)
 	}
 	return diags
 }
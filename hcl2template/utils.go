@@ -1,6 +1,7 @@
 package hcl2template
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,7 +12,9 @@ import (
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/packer/hcl2template/repl"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
+	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 func warningErrorsToDiags(block *hcl.Block, warnings []string, err error) hcl.Diagnostics {
@@ -115,6 +118,83 @@ func convertFilterOption(patterns []string, optionName string) ([]glob.Glob, hcl
 	return globs, diags
 }
 
+// tagFilterPrefix prefixes the -only and -except patterns matching the tags of
+// the builds rather than their name, like `tag:linux`.
+const tagFilterPrefix = "tag:"
+
+// buildFilter is a parsed -only or -except option: the globs matching the
+// names of the builds, and the ones matching their tags.
+type buildFilter struct {
+	names []glob.Glob
+	tags  []glob.Glob
+}
+
+// Convert -only and -except patterns to a buildFilter.
+func convertBuildFilterOption(patterns []string, optionName string) (buildFilter, hcl.Diagnostics) {
+	var names, tags []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, tagFilterPrefix) {
+			tags = append(tags, strings.TrimPrefix(pattern, tagFilterPrefix))
+			continue
+		}
+		names = append(names, pattern)
+	}
+
+	var filter buildFilter
+	var diags, moreDiags hcl.Diagnostics
+	filter.names, diags = convertFilterOption(names, optionName)
+	filter.tags, moreDiags = convertFilterOption(tags, optionName)
+	return filter, append(diags, moreDiags...)
+}
+
+// match tells whether the build of name, tagged with tags, is matched by one
+// of the patterns of the filter.
+func (f buildFilter) match(name string, tags []string) bool {
+	for _, g := range f.names {
+		if g.Match(name) {
+			return true
+		}
+	}
+	for _, g := range f.tags {
+		for _, tag := range tags {
+			if g.Match(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeTags returns the tags of both lists, without duplicates.
+func mergeTags(a, b []string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range append(a[:len(a):len(a)], b...) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// hasTags tells whether tags contains all the required tags.
+func hasTags(tags, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, tag := range tags {
+			if tag == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func PrintableCtyValue(v cty.Value) string {
 	if !v.IsWhollyKnown() {
 		return "<unknown>"
@@ -179,8 +259,32 @@ func ConvertPluginConfigValueToHCLValue(v interface{}) (cty.Value, error) {
 		} else {
 			buildValue = cty.ListVal(vals)
 		}
+	case map[string]string:
+		vals := make(map[string]cty.Value, len(v))
+		for k, ev := range v {
+			vals[k] = cty.StringVal(ev)
+		}
+		if len(vals) == 0 {
+			buildValue = cty.MapValEmpty(cty.String)
+		} else {
+			buildValue = cty.MapVal(vals)
+		}
 	default:
 		return cty.Value{}, fmt.Errorf("unhandled buildvar type: %T", v)
 	}
 	return buildValue, nil
 }
+
+// inputHash returns packer.InputHash of a decoded component configuration.
+func inputHash(componentType string, v cty.Value) (string, error) {
+	v, _ = hcl2shim.WriteUnknownPlaceholderValues(v).UnmarkDeep()
+	raw, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return "", err
+	}
+	var config interface{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return "", err
+	}
+	return packer.InputHash(componentType, config)
+}
@@ -0,0 +1,333 @@
+// Package agent installs and drives packer-agent, see cmd/packer-agent, on the
+// guests. Provisioners use it when it is available to get more reliable
+// primitives than a raw shell session offers, and fall back to the
+// communicator otherwise.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+// PathEnvVar lists the directories, separated by the OS path list separator,
+// where the agent binaries are looked up. The directory of the Packer
+// executable is always searched last.
+const PathEnvVar = "PACKER_AGENT_PATH"
+
+// BinaryPrefix prefixes the name of the agent binaries, that are named after
+// the platform they run on, ex: packer-agent_linux_amd64.
+const BinaryPrefix = "packer-agent_"
+
+// RemoteDir is the directory of the guest where the agent is installed, and
+// where it keeps the state of the commands it supervises.
+var RemoteDir = "/tmp/packer-agent"
+
+// DefaultReconnectTimeout is how long Run waits for the guest to come back
+// after a disconnect.
+var DefaultReconnectTimeout = 5 * time.Minute
+
+// ErrUnavailable is returned by Install when the agent cannot be used on the
+// guest, either because no agent binary is found for its platform, or because
+// the guest is not supported.
+var ErrUnavailable = errors.New("the packer agent is not available for the guest")
+
+// Agent is an agent installed on a guest.
+type Agent struct {
+	// Path is the path of the agent on the guest.
+	Path string
+	// ReconnectTimeout is how long Run waits for the guest to come back
+	// after a disconnect. Defaults to DefaultReconnectTimeout.
+	ReconnectTimeout time.Duration
+
+	runs uint64
+}
+
+// searchPath returns the directories where the agent binaries are looked up.
+func searchPath() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(PathEnvVar)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	return dirs
+}
+
+// Available tells whether any agent binary can be found, without looking at
+// the guest.
+func Available() bool {
+	for _, dir := range searchPath() {
+		if matches, _ := filepath.Glob(filepath.Join(dir, BinaryPrefix+"*")); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the path of the agent binary for the goos/goarch platform.
+func Find(goos, goarch string) (string, error) {
+	name := BinaryPrefix + goos + "_" + goarch
+	for _, dir := range searchPath() {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no %s binary found", ErrUnavailable, name)
+}
+
+// platform returns the GOOS and GOARCH of a guest from the output of `uname
+// -sm`.
+func platform(uname string) (string, string, error) {
+	fields := strings.Fields(uname)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("%w: unexpected platform %q", ErrUnavailable, strings.TrimSpace(uname))
+	}
+
+	goos := strings.ToLower(fields[0])
+	switch goos {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+	default:
+		return "", "", fmt.Errorf("%w: unsupported operating system %q", ErrUnavailable, fields[0])
+	}
+
+	var goarch string
+	switch fields[1] {
+	case "x86_64", "amd64":
+		goarch = "amd64"
+	case "aarch64", "arm64":
+		goarch = "arm64"
+	case "i386", "i686":
+		goarch = "386"
+	default:
+		return "", "", fmt.Errorf("%w: unsupported architecture %q", ErrUnavailable, fields[1])
+	}
+	return goos, goarch, nil
+}
+
+// Install uploads the agent matching the platform of the guest, unless it is
+// already there. An error wrapping ErrUnavailable is returned when the agent
+// cannot be used; the guest is not touched when no agent binary is found at
+// all.
+func Install(ctx context.Context, comm packersdk.Communicator) (*Agent, error) {
+	if !Available() {
+		return nil, ErrUnavailable
+	}
+
+	var uname bytes.Buffer
+	status, err := run(ctx, comm, "uname -sm", &uname)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("%w: the guest is not a Unix system", ErrUnavailable)
+	}
+	goos, goarch, err := platform(uname.String())
+	if err != nil {
+		return nil, err
+	}
+	local, err := Find(goos, goarch)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	// The agent is installed under its checksum, so that an agent left by a
+	// previous run is only reused when it is the same.
+	a := &Agent{
+		Path: fmt.Sprintf("%s/packer-agent-%s", RemoteDir, hex.EncodeToString(h.Sum(nil))[:12]),
+	}
+
+	if status, err := run(ctx, comm, "test -x "+a.Path, nil); err != nil {
+		return nil, err
+	} else if status == 0 {
+		log.Printf("[INFO] packer agent already installed at %s", a.Path)
+		return a, nil
+	}
+
+	log.Printf("[INFO] installing the packer agent %s at %s", local, a.Path)
+	if status, err := run(ctx, comm, fmt.Sprintf("mkdir -p %s && chmod 0700 %s", RemoteDir, RemoteDir), nil); err != nil {
+		return nil, err
+	} else if status != 0 {
+		return nil, fmt.Errorf("failed to create %s on the guest: exit status %d", RemoteDir, status)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := comm.Upload(a.Path, f, &fi); err != nil {
+		return nil, fmt.Errorf("failed to upload the packer agent: %s", err)
+	}
+	if status, err := run(ctx, comm, "chmod 0755 "+a.Path, nil); err != nil {
+		return nil, err
+	} else if status != 0 {
+		return nil, fmt.Errorf("failed to make the packer agent executable: exit status %d", status)
+	}
+	return a, nil
+}
+
+// SHA256 returns the hex encoded SHA256 checksum of the file at path on the
+// guest.
+func (a *Agent) SHA256(ctx context.Context, comm packersdk.Communicator, path string) (string, error) {
+	var stdout bytes.Buffer
+	status, err := run(ctx, comm, fmt.Sprintf("%s sha256 %s", a.Path, quote(path)), &stdout)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		return "", fmt.Errorf("failed to compute the checksum of %s: exit status %d", path, status)
+	}
+	fields := strings.Fields(stdout.String())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("failed to compute the checksum of %s: no output", path)
+	}
+	return fields[0], nil
+}
+
+// BootID returns an identifier of the current boot of the guest, it changes
+// whenever the guest reboots.
+func (a *Agent) BootID(ctx context.Context, comm packersdk.Communicator) (string, error) {
+	var stdout bytes.Buffer
+	status, err := run(ctx, comm, a.Path+" boot-id", &stdout)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		return "", fmt.Errorf("failed to get the boot ID of the guest: exit status %d", status)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Run runs command on the guest under the supervision of the agent, streaming
+// its output to ui, and returns its exit status.
+//
+// The command runs detached from the session of the communicator: when the
+// connection is lost, Run reconnects and resumes streaming the output where it
+// stopped. When the guest rebooted in the meantime, the command was
+// interrupted and packersdk.CmdDisconnect is returned, like the communicator
+// does.
+func (a *Agent) Run(ctx context.Context, comm packersdk.Communicator, ui packersdk.Ui, command string) (int, error) {
+	bootID, err := a.BootID(ctx, comm)
+	if err != nil {
+		return 0, err
+	}
+
+	dir := fmt.Sprintf("%s/run-%d-%d", RemoteDir, time.Now().UnixNano(), atomic.AddUint64(&a.runs, 1))
+	status, err := run(ctx, comm, fmt.Sprintf("%s start -dir %s -command %s", a.Path, dir, quote(command)), nil)
+	if err != nil {
+		return 0, err
+	}
+	if status != 0 {
+		return 0, fmt.Errorf("the packer agent failed to start the command: exit status %d", status)
+	}
+
+	var stdout, stderr offsetWriter
+	for {
+		cmd := &packersdk.RemoteCmd{
+			Command: fmt.Sprintf("%s wait -dir %s -stdout-offset %d -stderr-offset %d",
+				a.Path, dir, stdout.Offset(), stderr.Offset()),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		}
+		err := cmd.RunWithUi(ctx, comm, ui)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if err == nil && cmd.ExitStatus() != packersdk.CmdDisconnect {
+			if _, err := run(ctx, comm, "rm -rf "+dir, nil); err != nil {
+				log.Printf("[WARN] failed to remove %s from the guest: %s", dir, err)
+			}
+			return cmd.ExitStatus(), nil
+		}
+
+		log.Printf("[INFO] lost the connection to the guest while waiting for the command, reconnecting: %v", err)
+		rebooted, err := a.rebooted(ctx, comm, bootID)
+		if err != nil {
+			return 0, err
+		}
+		if rebooted {
+			ui.Error("The guest rebooted while the command was running.")
+			return packersdk.CmdDisconnect, nil
+		}
+	}
+}
+
+// rebooted waits for the guest to come back, and tells whether it rebooted
+// since bootID.
+func (a *Agent) rebooted(ctx context.Context, comm packersdk.Communicator, bootID string) (bool, error) {
+	timeout := a.ReconnectTimeout
+	if timeout == 0 {
+		timeout = DefaultReconnectTimeout
+	}
+
+	var current string
+	err := retry.Config{
+		StartTimeout: timeout,
+		RetryDelay:   func() time.Duration { return 2 * time.Second },
+	}.Run(ctx, func(ctx context.Context) error {
+		var err error
+		current, err = a.BootID(ctx, comm)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("the guest did not come back after a disconnect: %s", err)
+	}
+	return current != bootID, nil
+}
+
+// offsetWriter counts the bytes of output received, to resume streaming
+// after a disconnect.
+type offsetWriter struct {
+	n int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&w.n, int64(len(p)))
+	return len(p), nil
+}
+
+func (w *offsetWriter) Offset() int64 {
+	return atomic.LoadInt64(&w.n)
+}
+
+// run runs command on the guest and returns its exit status.
+func run(ctx context.Context, comm packersdk.Communicator, command string, stdout io.Writer) (int, error) {
+	cmd := &packersdk.RemoteCmd{Command: command, Stdout: stdout}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return 0, err
+	}
+	return cmd.Wait(), nil
+}
+
+// quote quotes s for a POSIX shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
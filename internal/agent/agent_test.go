@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// localCommunicator runs the commands on the local machine.
+type localCommunicator struct {
+	packersdk.Communicator
+
+	commands []string
+	// disconnectWait makes the next wait command disconnect.
+	disconnectWait bool
+}
+
+func (c *localCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	c.commands = append(c.commands, cmd.Command)
+	if c.disconnectWait && strings.Contains(cmd.Command, " wait ") {
+		c.disconnectWait = false
+		go cmd.SetExited(packersdk.CmdDisconnect)
+		return nil
+	}
+
+	local := exec.CommandContext(ctx, "/bin/sh", "-c", cmd.Command)
+	local.Stdout = cmd.Stdout
+	local.Stderr = cmd.Stderr
+	if err := local.Start(); err != nil {
+		return err
+	}
+	go func() {
+		status := 0
+		if err := local.Wait(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+			}
+		}
+		cmd.SetExited(status)
+	}()
+	return nil
+}
+
+func (c *localCommunicator) Upload(path string, r io.Reader, _ *os.FileInfo) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// installAgent builds the agent for the local machine and installs it with a
+// localCommunicator.
+func installAgent(t *testing.T) (*Agent, *localCommunicator) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the agent does not support Windows guests")
+	}
+
+	bin := t.TempDir()
+	build := exec.Command("go", "build", "-o", filepath.Join(bin, BinaryPrefix+runtime.GOOS+"_"+runtime.GOARCH), "github.com/hashicorp/packer/cmd/packer-agent")
+	build.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the agent: %s\n%s", err, out)
+	}
+	t.Setenv(PathEnvVar, bin)
+
+	oldRemoteDir := RemoteDir
+	RemoteDir = filepath.Join(t.TempDir(), "packer-agent")
+	t.Cleanup(func() { RemoteDir = oldRemoteDir })
+
+	comm := &localCommunicator{}
+	a, err := Install(context.Background(), comm)
+	if err != nil {
+		t.Fatalf("failed to install the agent: %s", err)
+	}
+	return a, comm
+}
+
+func TestPlatform(t *testing.T) {
+	tests := []struct {
+		uname        string
+		goos, goarch string
+		wantErr      bool
+	}{
+		{"Linux x86_64\n", "linux", "amd64", false},
+		{"Linux aarch64\n", "linux", "arm64", false},
+		{"FreeBSD amd64\n", "freebsd", "amd64", false},
+		{"Darwin arm64\n", "darwin", "arm64", false},
+		{"Linux s390x\n", "", "", true},
+		{"MINGW64_NT-10.0 x86_64\n", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		goos, goarch, err := platform(tt.uname)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("platform(%q) error = %v, wantErr %v", tt.uname, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrUnavailable) {
+			t.Errorf("platform(%q) error should wrap ErrUnavailable: %v", tt.uname, err)
+		}
+		if goos != tt.goos || goarch != tt.goarch {
+			t.Errorf("platform(%q) = %s/%s, want %s/%s", tt.uname, goos, goarch, tt.goos, tt.goarch)
+		}
+	}
+}
+
+func TestInstall_unavailable(t *testing.T) {
+	t.Setenv(PathEnvVar, t.TempDir())
+	if Available() {
+		t.Skip("an agent binary is next to the test executable")
+	}
+
+	comm := &localCommunicator{}
+	if _, err := Install(context.Background(), comm); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if len(comm.commands) != 0 {
+		t.Errorf("the guest should not be touched, got %q", comm.commands)
+	}
+}
+
+func TestAgent(t *testing.T) {
+	a, comm := installAgent(t)
+
+	// A second install reuses the agent.
+	if _, err := Install(context.Background(), comm); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum, err := a.SHA256(context.Background(), comm, file)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if sum != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+		t.Errorf("unexpected checksum %s", sum)
+	}
+
+	bootID, err := a.BootID(context.Background(), comm)
+	if err != nil || bootID == "" {
+		t.Errorf("unexpected boot ID %q: %v", bootID, err)
+	}
+}
+
+func TestAgentRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect bool
+	}{
+		{"connected", false},
+		{"disconnected", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, comm := installAgent(t)
+			comm.disconnectWait = tt.disconnect
+
+			var out, errOut bytes.Buffer
+			ui := &packersdk.BasicUi{Writer: &out, ErrorWriter: &errOut}
+			status, err := a.Run(context.Background(), comm, ui, "echo one; sleep 1; echo 'two'; echo three >&2; exit 3")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if status != 3 {
+				t.Errorf("unexpected exit status %d", status)
+			}
+			if got := out.String(); strings.Count(got, "one") != 1 || strings.Count(got, "two") != 1 {
+				t.Errorf("unexpected output %q", got)
+			}
+			if got := errOut.String(); !strings.Contains(got, "three") {
+				t.Errorf("unexpected error output %q", got)
+			}
+		})
+	}
+}
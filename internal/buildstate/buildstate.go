@@ -0,0 +1,130 @@
+// Package buildstate records the input hashes of the last successful builds of
+// templates, so that a later run can tell whether anything relevant changed
+// since, and skip the builds that did not change.
+package buildstate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultFilename is the name of the state file written next to a template
+// when no other location is given.
+const DefaultFilename = "packer.state.json"
+
+// The labels recording the state of a build in the HCP Packer registry.
+const (
+	InputHashLabel = "packer_input_hash"
+	BuildNameLabel = "packer_build_name"
+)
+
+// State holds the last successful builds of a template, by build name.
+type State struct {
+	Builds map[string]Build `json:"builds"`
+}
+
+// Build describes a successful build.
+type Build struct {
+	// InputHash identifies all the inputs of the build, see
+	// packer.CoreBuild.InputHash.
+	InputHash   string    `json:"input_hash"`
+	CompletedAt time.Time `json:"completed_at"`
+	// Artifacts are the artifacts of the build, reported when the build is
+	// skipped as it did not change.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// Artifact describes an artifact of a successful build.
+type Artifact struct {
+	BuilderID   string `json:"builder_id,omitempty"`
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+}
+
+// Record sets the last successful build of the named build.
+func (s *State) Record(name string, b Build) {
+	if s.Builds == nil {
+		s.Builds = map[string]Build{}
+	}
+	s.Builds[name] = b
+}
+
+// Changed tells whether the named build has no successful build with
+// inputHash.
+func (s *State) Changed(name, inputHash string) bool {
+	b, ok := s.Builds[name]
+	return !ok || b.InputHash != inputHash
+}
+
+// Backend stores the state of templates. Templates are identified by their
+// path as given to Packer.
+type Backend interface {
+	// Load returns the state of template, an empty state when none was
+	// stored yet.
+	Load(ctx context.Context, template string) (*State, error)
+	// Save stores the state of template, replacing the previous one.
+	Save(ctx context.Context, template string, s *State) error
+}
+
+// document is the content of the files storing the state, holding the state
+// of several templates.
+type document struct {
+	Templates map[string]*State `json:"templates"`
+}
+
+func decode(raw []byte) (*document, error) {
+	d := &document{}
+	if err := json.Unmarshal(raw, d); err != nil {
+		return nil, fmt.Errorf("failed to decode the build state: %s", err)
+	}
+	if d.Templates == nil {
+		d.Templates = map[string]*State{}
+	}
+	return d, nil
+}
+
+func (d *document) state(template string) *State {
+	if s := d.Templates[template]; s != nil {
+		return s
+	}
+	return &State{}
+}
+
+func (d *document) encode() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// New returns the backend storing the state at location, which is one of:
+//
+//   - s3://<bucket>/<key>, optionally with a region query parameter, for an
+//     object of AWS S3.
+//   - hcp://<bucket>, for the labels of the builds of the latest complete
+//     iteration of a bucket of the HCP Packer registry.
+//   - the path of a local file.
+func New(location string) (Backend, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state location %q: %s", location, err)
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("invalid state location %q, expected s3://<bucket>/<key>", location)
+		}
+		return &S3Backend{Bucket: u.Host, Key: key, Region: u.Query().Get("region")}, nil
+	case strings.HasPrefix(location, "hcp://"):
+		slug := strings.TrimPrefix(location, "hcp://")
+		if slug == "" || strings.Contains(slug, "/") {
+			return nil, fmt.Errorf("invalid state location %q, expected hcp://<bucket>", location)
+		}
+		return &RegistryBackend{BucketSlug: slug}, nil
+	case location == "":
+		return nil, fmt.Errorf("no state location given")
+	}
+	return &FileBackend{Path: location}, nil
+}
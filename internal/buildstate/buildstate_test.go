@@ -0,0 +1,109 @@
+package buildstate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/internal/registry"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		location  string
+		expected  Backend
+		expectErr bool
+	}{
+		{"packer.state.json", &FileBackend{Path: "packer.state.json"}, false},
+		{"s3://bucket/path/state.json", &S3Backend{Bucket: "bucket", Key: "path/state.json"}, false},
+		{"s3://bucket/state.json?region=eu-west-1", &S3Backend{Bucket: "bucket", Key: "state.json", Region: "eu-west-1"}, false},
+		{"s3://bucket", nil, true},
+		{"hcp://ubuntu", &RegistryBackend{BucketSlug: "ubuntu"}, false},
+		{"hcp://", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		backend, err := New(tt.location)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("%q: unexpected error: %v", tt.location, err)
+		}
+		if diff := cmp.Diff(tt.expected, backend, cmp.AllowUnexported(S3Backend{})); diff != "" {
+			t.Errorf("%q: unexpected backend: %s", tt.location, diff)
+		}
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := &FileBackend{Path: filepath.Join(t.TempDir(), DefaultFilename)}
+
+	s, err := backend.Load(ctx, "ubuntu.pkr.hcl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !s.Changed("ubuntu", "hash") {
+		t.Errorf("expected a build never built to have changed")
+	}
+
+	completedAt := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	s.Record("ubuntu", Build{InputHash: "hash", CompletedAt: completedAt})
+	if err := backend.Save(ctx, "ubuntu.pkr.hcl", s); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	other := &State{}
+	other.Record("ubuntu", Build{InputHash: "other-hash", CompletedAt: completedAt})
+	if err := backend.Save(ctx, "debian.pkr.hcl", other); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	s, err = backend.Load(ctx, "ubuntu.pkr.hcl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s.Changed("ubuntu", "hash") {
+		t.Errorf("expected the build not to have changed")
+	}
+	if !s.Changed("ubuntu", "other-hash") {
+		t.Errorf("expected the build to have changed")
+	}
+	if !s.Builds["ubuntu"].CompletedAt.Equal(completedAt) {
+		t.Errorf("unexpected completion time %s", s.Builds["ubuntu"].CompletedAt)
+	}
+}
+
+func TestRegistryBackend(t *testing.T) {
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.BuildAlreadyDone = true
+	mockService.ExistingIterations = []*models.HashicorpCloudPackerIterationforList{
+		{ID: "old", Complete: true, CreatedAt: strfmt.DateTime(time.Now().Add(-2 * time.Hour))},
+		{ID: "latest", Complete: true, CreatedAt: strfmt.DateTime(time.Now().Add(-time.Hour))},
+		{ID: "running", Complete: false, CreatedAt: strfmt.DateTime(time.Now())},
+	}
+	mockService.ExistingBuilds = []string{"amazon-ebs.ubuntu", "amazon-ebs.debian"}
+	mockService.ExistingBuildLabels = map[string]map[string]string{
+		"amazon-ebs.ubuntu": {InputHashLabel: "hash", BuildNameLabel: "base.amazon-ebs.ubuntu"},
+	}
+
+	backend := &RegistryBackend{
+		BucketSlug: "base",
+		Client:     &registry.Client{Packer: mockService},
+	}
+	s, err := backend.Load(context.Background(), "base.pkr.hcl")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s.Changed("base.amazon-ebs.ubuntu", "hash") {
+		t.Errorf("expected the build not to have changed")
+	}
+	if len(s.Builds) != 1 {
+		t.Errorf("expected only the labelled build to be recorded, got %v", s.Builds)
+	}
+	if artifacts := s.Builds["base.amazon-ebs.ubuntu"].Artifacts; len(artifacts) == 0 {
+		t.Errorf("expected the images of the build to be its artifacts")
+	}
+}
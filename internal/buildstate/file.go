@@ -0,0 +1,58 @@
+package buildstate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// FileBackend stores the state in a local file.
+type FileBackend struct {
+	Path string
+}
+
+func (b *FileBackend) load() (*document, error) {
+	raw, err := os.ReadFile(b.Path)
+	if os.IsNotExist(err) {
+		return decode([]byte("{}"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(raw)
+}
+
+func (b *FileBackend) Load(_ context.Context, template string) (*State, error) {
+	d, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	return d.state(template), nil
+}
+
+// Save writes the state to a temporary file renamed over the state file, so
+// that an interrupted write never leaves a truncated state.
+func (b *FileBackend) Save(_ context.Context, template string, s *State) error {
+	d, err := b.load()
+	if err != nil {
+		return err
+	}
+	d.Templates[template] = s
+	raw, err := d.encode()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.Path), filepath.Base(b.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), b.Path)
+}
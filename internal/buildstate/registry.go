@@ -0,0 +1,84 @@
+package buildstate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/internal/registry"
+)
+
+// RegistryBackend reads the state from the HCP Packer registry: the last
+// successful builds are the builds of the latest complete iteration of the
+// bucket, labelled with InputHashLabel and BuildNameLabel, and their artifacts
+// are the images of the builds. Packer sets these labels on the builds it
+// publishes, so there is nothing to save.
+type RegistryBackend struct {
+	BucketSlug string
+
+	// Client defaults to a client configured from the environment.
+	Client *registry.Client
+}
+
+func (b *RegistryBackend) Load(ctx context.Context, _ string) (*State, error) {
+	if b.Client == nil {
+		client, err := registry.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		b.Client = client
+	}
+
+	iterations, err := b.Client.ListIterations(ctx, b.BucketSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the iterations of bucket %q: %w", b.BucketSlug, err)
+	}
+	var latest *models.HashicorpCloudPackerIterationforList
+	sort.SliceStable(iterations, func(i, j int) bool {
+		return time.Time(iterations[i].CreatedAt).After(time.Time(iterations[j].CreatedAt))
+	})
+	for _, iteration := range iterations {
+		if iteration.Complete && time.Time(iteration.RevokeAt).IsZero() {
+			latest = iteration
+			break
+		}
+	}
+
+	s := &State{}
+	if latest == nil {
+		return s, nil
+	}
+	builds, err := b.Client.ListBuilds(ctx, b.BucketSlug, latest.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the builds of iteration %q: %w", latest.ID, err)
+	}
+	for _, build := range builds {
+		if build.Status != models.HashicorpCloudPackerBuildStatusDONE || build.Labels[InputHashLabel] == "" {
+			continue
+		}
+		name := build.Labels[BuildNameLabel]
+		if name == "" {
+			name = build.ComponentType
+		}
+		var artifacts []Artifact
+		for _, image := range build.Images {
+			description := fmt.Sprintf("%s image %s", build.CloudProvider, image.ImageID)
+			if image.Region != "" {
+				description += " in " + image.Region
+			}
+			artifacts = append(artifacts, Artifact{ID: image.ImageID, Description: description})
+		}
+		s.Record(name, Build{
+			InputHash:   build.Labels[InputHashLabel],
+			CompletedAt: time.Time(build.UpdatedAt),
+			Artifacts:   artifacts,
+		})
+	}
+	return s, nil
+}
+
+func (b *RegistryBackend) Save(_ context.Context, _ string, _ *State) error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package buildstate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Backend stores the state in an object of AWS S3. The credentials are
+// loaded like with the AWS CLI, from the environment or the shared config.
+type S3Backend struct {
+	Bucket string
+	Key    string
+	// Region of the bucket, defaults to the region of the AWS config.
+	Region string
+
+	client *s3.S3
+}
+
+func (b *S3Backend) connect() error {
+	if b.client != nil {
+		return nil
+	}
+	opts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if b.Region != "" {
+		opts.Config.Region = aws.String(b.Region)
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return fmt.Errorf("failed to create the AWS session: %s", err)
+	}
+	b.client = s3.New(sess)
+	return nil
+}
+
+func (b *S3Backend) load(ctx context.Context) (*document, error) {
+	if err := b.connect(); err != nil {
+		return nil, err
+	}
+	out, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.Key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return decode([]byte("{}"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %s", b.Bucket, b.Key, err)
+	}
+	defer out.Body.Close()
+	raw, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %s", b.Bucket, b.Key, err)
+	}
+	return decode(raw)
+}
+
+func (b *S3Backend) Load(ctx context.Context, template string) (*State, error) {
+	d, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.state(template), nil
+}
+
+func (b *S3Backend) Save(ctx context.Context, template string, s *State) error {
+	d, err := b.load(ctx)
+	if err != nil {
+		return err
+	}
+	d.Templates[template] = s
+	raw, err := d.encode()
+	if err != nil {
+		return err
+	}
+	_, err = b.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(b.Bucket),
+		Key:         aws.String(b.Key),
+		Body:        bytes.NewReader(raw),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write s3://%s/%s: %s", b.Bucket, b.Key, err)
+	}
+	return nil
+}
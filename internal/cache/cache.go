@@ -0,0 +1,301 @@
+// Package cache lists, verifies and evicts the files cached by Packer on the
+// machine running it: the downloads of the builders and of the asset blocks,
+// stored in PACKER_CACHE_DIR, and the installed plugin binaries.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/hashicorp/go-version"
+	plugingetter "github.com/hashicorp/packer/packer/plugin-getter"
+)
+
+// Kind tells which cache an entry belongs to.
+type Kind string
+
+const (
+	KindDownload Kind = "download"
+	KindPlugin   Kind = "plugin"
+)
+
+// stagesDir holds the records of the incremental build snapshots in the
+// cache dir, they are not downloads.
+const stagesDir = "stages"
+
+// ErrNoChecksum is returned by Verify for the entries whose checksum was never
+// recorded.
+var ErrNoChecksum = errors.New("no checksum recorded")
+
+// Entry is a cached file.
+type Entry struct {
+	Kind Kind   `json:"kind"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// ModTime is the time the file was downloaded, or last used for the
+	// downloads tracked with Touch.
+	ModTime time.Time `json:"modified_at"`
+	// Superseded tells whether a newer version of the plugin is installed
+	// next to it. Only the superseded plugins can be evicted.
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+// Evictable tells whether the entry can be removed without breaking an
+// installation: downloads are fetched again when needed, plugins are only
+// evicted once a newer version is installed.
+func (e Entry) Evictable() bool {
+	return e.Kind == KindDownload || e.Superseded
+}
+
+func checksummer() *plugingetter.Checksummer {
+	return &plugingetter.Checksummer{Type: "sha256", Hash: sha256.New()}
+}
+
+// Downloads lists the files cached in dir, usually PACKER_CACHE_DIR, leaving
+// out the lock and checksum files.
+func Downloads(dir string) ([]Entry, error) {
+	ext := checksummer().FileExt()
+	var entries []Entry
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path == filepath.Join(dir, stagesDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".lock") || strings.HasSuffix(path, ext) {
+			return nil
+		}
+		entries = append(entries, Entry{
+			Kind:    KindDownload,
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// Plugins lists the plugin binaries installed in folders, usually
+// PluginConfig.KnownPluginFolders, and tells which ones are superseded by a
+// newer version of the same plugin.
+func Plugins(folders []string) ([]Entry, error) {
+	opts := plugingetter.ListInstallationsOptions{
+		FromFolders: folders,
+		BinaryInstallationOptions: plugingetter.BinaryInstallationOptions{
+			OS:           runtime.GOOS,
+			ARCH:         runtime.GOARCH,
+			Checksummers: []plugingetter.Checksummer{*checksummer()},
+		},
+	}
+	if runtime.GOOS == "windows" {
+		opts.BinaryInstallationOptions.Ext = ".exe"
+	}
+	// a plugin requirement that matches them all
+	installations, err := plugingetter.Requirement{}.ListInstallations(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	newest := map[string]*version.Version{}
+	versions := make([]*version.Version, len(installations))
+	for i, installation := range installations {
+		info, err := os.Stat(installation.BinaryPath)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{
+			Kind:    KindPlugin,
+			Path:    installation.BinaryPath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		v, err := version.NewVersion(installation.Version)
+		if err != nil {
+			continue
+		}
+		versions[i] = v
+		if key := pluginKey(installation.BinaryPath); newest[key] == nil || v.GreaterThan(newest[key]) {
+			newest[key] = v
+		}
+	}
+	for i := range entries {
+		if v := versions[i]; v != nil {
+			entries[i].Superseded = v.LessThan(newest[pluginKey(entries[i].Path)])
+		}
+	}
+	return entries, nil
+}
+
+// pluginKey identifies the plugin of a binary regardless of its version, ex:
+// ".../github.com/hashicorp/amazon/packer-plugin-amazon" for
+// ".../github.com/hashicorp/amazon/packer-plugin-amazon_v1.0.0_x5.0_linux_amd64".
+func pluginKey(binaryPath string) string {
+	if i := strings.LastIndex(binaryPath, "_v"); i > 0 {
+		return binaryPath[:i]
+	}
+	return binaryPath
+}
+
+// Remove removes the cached file of entry along with its checksum. It tells
+// whether it did, a download locked by a running Packer process is left
+// alone.
+func Remove(entry Entry) (bool, error) {
+	if entry.Kind == KindDownload {
+		lock := flock.New(entry.Path + ".lock")
+		locked, err := lock.TryLock()
+		if err != nil {
+			return false, err
+		}
+		if !locked {
+			return false, nil
+		}
+		defer lock.Unlock()
+	}
+	if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Remove(entry.Path + checksummer().FileExt()); err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	return true, nil
+}
+
+// Verify checks that the cached file of entry still matches the checksum
+// recorded next to it when it was cached, it returns ErrNoChecksum when there
+// is none.
+func Verify(entry Entry) error {
+	c := checksummer()
+	expected, err := c.GetCacheChecksumOfFile(entry.Path)
+	if os.IsNotExist(err) {
+		return ErrNoChecksum
+	}
+	if err != nil {
+		return err
+	}
+	err = c.ChecksumFile(expected, entry.Path)
+	if cerr, ok := err.(*plugingetter.ChecksumError); ok {
+		return fmt.Errorf("its sha256 checksum %x does not match the recorded %x", cerr.Actual, cerr.Expected)
+	}
+	return err
+}
+
+// Touch marks the cached file at path as just used, so that it is evicted
+// after the files used less recently, and records its checksum for Verify
+// when the file changed since it was last recorded.
+func Touch(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sumPath := path + checksummer().FileExt()
+	if sumInfo, err := os.Stat(sumPath); err != nil || sumInfo.ModTime().Before(info.ModTime()) {
+		if err := recordChecksum(path, sumPath); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return err
+	}
+	return os.Chtimes(sumPath, now, now)
+}
+
+func recordChecksum(path, sumPath string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	return os.WriteFile(sumPath, []byte(hex.EncodeToString(h.Sum(nil))), 0644)
+}
+
+// Size returns the total size of entries.
+func Size(entries []Entry) int64 {
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	return total
+}
+
+// sizeUnits are the units of the sizes of the policies, in powers of 1024.
+var sizeUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// ParseSize parses a size like "20GB", "512MB" or a plain number of bytes.
+// Units are powers of 1024, "GiB" is the same as "GB".
+func ParseSize(s string) (int64, error) {
+	num := strings.ToUpper(strings.TrimSpace(s))
+	num = strings.Replace(num, "IB", "B", 1)
+	mult := int64(1)
+	for i := len(sizeUnits) - 1; i >= 0; i-- {
+		if strings.HasSuffix(num, sizeUnits[i]) {
+			num = strings.TrimSpace(strings.TrimSuffix(num, sizeUnits[i]))
+			mult = int64(1) << (10 * i)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a size like 20GB", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// FormatSize formats size in the largest unit of sizeUnits it fits in.
+func FormatSize(size int64) string {
+	i := 0
+	f := float64(size)
+	for f >= 1024 && i < len(sizeUnits)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.1f%s", f, sizeUnits[i])
+}
+
+// ParseAge parses a duration like "720h", also accepting days like "30d".
+func ParseAge(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, expected a duration like 720h or 30d", s)
+	}
+	return d, nil
+}
+
+// sortOldestFirst sorts entries by ModTime, the least recently used first.
+func sortOldestFirst(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func paths(entries []Entry) []string {
+	res := []string{}
+	for _, e := range entries {
+		res = append(res, filepath.Base(e.Path))
+	}
+	return res
+}
+
+func TestDownloads(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, filepath.Join(dir, "ubuntu.iso"), "iso", now)
+	writeFile(t, filepath.Join(dir, "ubuntu.iso.lock"), "", now)
+	writeFile(t, filepath.Join(dir, "ubuntu.iso_SHA256SUM"), "", now)
+	writeFile(t, filepath.Join(dir, "assets", "driver.zip"), "driver", now)
+	writeFile(t, filepath.Join(dir, "stages", "linux.json"), "{}", now)
+
+	entries, err := Downloads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"driver.zip", "ubuntu.iso"}, paths(entries)); diff != "" {
+		t.Errorf("unexpected downloads: %s", diff)
+	}
+
+	entries, err = Downloads(filepath.Join(dir, "missing"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected a missing cache dir to be empty, got %v, %v", entries, err)
+	}
+}
+
+func TestPlugins_superseded(t *testing.T) {
+	folder := t.TempDir()
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+	for _, v := range []string{"1.0.0", "1.2.0", "1.10.0"} {
+		name := "packer-plugin-happycloud_v" + v + "_x5.0_" + runtime.GOOS + "_" + runtime.GOARCH + ext
+		path := filepath.Join(folder, "github.com", "hashicorp", "happycloud", name)
+		writeFile(t, path, "happycloud", time.Now())
+		if err := Touch(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := Plugins([]string{folder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	superseded := map[string]bool{}
+	for _, e := range entries {
+		superseded[filepath.Base(e.Path)] = e.Superseded
+	}
+	suffix := "_x5.0_" + runtime.GOOS + "_" + runtime.GOARCH + ext
+	want := map[string]bool{
+		"packer-plugin-happycloud_v1.0.0" + suffix:  true,
+		"packer-plugin-happycloud_v1.2.0" + suffix:  true,
+		"packer-plugin-happycloud_v1.10.0" + suffix: false,
+	}
+	if diff := cmp.Diff(want, superseded); diff != "" {
+		t.Errorf("unexpected superseded plugins: %s", diff)
+	}
+}
+
+func TestPolicy_Evict(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	entries := []Entry{
+		{Kind: KindDownload, Path: "recent.iso", Size: 400, ModTime: now.Add(-1 * day)},
+		{Kind: KindDownload, Path: "old.iso", Size: 300, ModTime: now.Add(-40 * day)},
+		{Kind: KindDownload, Path: "older.iso", Size: 200, ModTime: now.Add(-50 * day)},
+		{Kind: KindPlugin, Path: "plugin_v1.0.0", Size: 100, ModTime: now.Add(-60 * day)},
+		{Kind: KindPlugin, Path: "plugin_v0.9.0", Size: 100, ModTime: now.Add(-90 * day), Superseded: true},
+	}
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{"nothing", Policy{}, []string{}},
+		{"age", Policy{MaxAge: 30 * day}, []string{"plugin_v0.9.0", "older.iso", "old.iso"}},
+		{"size", Policy{MaxSize: 800}, []string{"plugin_v0.9.0", "older.iso"}},
+		{"age and size", Policy{MaxAge: 45 * day, MaxSize: 600}, []string{"plugin_v0.9.0", "older.iso", "old.iso"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Evict(entries, now)
+			if diff := cmp.Diff(tt.want, paths(got)); diff != "" {
+				t.Errorf("unexpected evictions: %s", diff)
+			}
+		})
+	}
+}
+
+func TestPolicy_UnmarshalJSON(t *testing.T) {
+	var p Policy
+	if err := json.Unmarshal([]byte(`{"max_age": "30d", "max_size": "1.5GB"}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := Policy{MaxAge: 30 * 24 * time.Hour, MaxSize: 3 << 29}
+	if p != want {
+		t.Errorf("expected %+v, got %+v", want, p)
+	}
+	if err := json.Unmarshal([]byte(`{"max_size": "20 parsecs"}`), &p); err == nil {
+		t.Error("expected an invalid size to fail")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ubuntu.iso")
+	writeFile(t, path, "iso", time.Now().Add(-time.Hour))
+	entry := Entry{Kind: KindDownload, Path: path}
+
+	if err := Verify(entry); err != ErrNoChecksum {
+		t.Fatalf("expected no checksum, got %v", err)
+	}
+	if err := Touch(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(entry); err != nil {
+		t.Fatalf("expected the download to be valid: %s", err)
+	}
+	if err := os.WriteFile(path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(entry); err == nil {
+		t.Fatal("expected the corrupted download to fail verification")
+	}
+}
+
+func TestRemove_locked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ubuntu.iso")
+	writeFile(t, path, "iso", time.Now())
+	entry := Entry{Kind: KindDownload, Path: path}
+
+	lock := flock.New(path + ".lock")
+	if err := lock.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := Remove(entry); removed || err != nil {
+		t.Fatalf("expected a download in use to be left alone, got %t, %v", removed, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := Remove(entry); !removed || err != nil {
+		t.Fatalf("expected the download to be removed, got %t, %v", removed, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", path)
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Policy selects the cached files to evict. The zero value evicts nothing.
+type Policy struct {
+	// MaxAge evicts the files not used for longer than it.
+	MaxAge time.Duration
+	// MaxSize evicts the least recently used files until the cache is not
+	// larger than it.
+	MaxSize int64
+}
+
+// UnmarshalJSON decodes the policy set in the Packer config file, like
+// {"max_age": "30d", "max_size": "20GB"}.
+func (p *Policy) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		MaxAge  string `json:"max_age"`
+		MaxSize string `json:"max_size"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*p = Policy{}
+	var err error
+	if raw.MaxAge != "" {
+		if p.MaxAge, err = ParseAge(raw.MaxAge); err != nil {
+			return err
+		}
+	}
+	if raw.MaxSize != "" {
+		if p.MaxSize, err = ParseSize(raw.MaxSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enabled tells whether the policy evicts anything.
+func (p *Policy) Enabled() bool {
+	return p != nil && (p.MaxAge > 0 || p.MaxSize > 0)
+}
+
+// Evict returns the evictable entries to remove at now to honor the policy,
+// the least recently used first. The entries that can't be evicted still
+// count in the size of the cache.
+func (p *Policy) Evict(entries []Entry, now time.Time) []Entry {
+	if !p.Enabled() {
+		return nil
+	}
+	candidates := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.Evictable() {
+			candidates = append(candidates, e)
+		}
+	}
+	sortOldestFirst(candidates)
+
+	var evicted []Entry
+	size := Size(entries)
+	for _, e := range candidates {
+		tooOld := p.MaxAge > 0 && now.Sub(e.ModTime) > p.MaxAge
+		tooLarge := p.MaxSize > 0 && size > p.MaxSize
+		if !tooOld && !tooLarge {
+			// Candidates are sorted, the next ones are more recent.
+			break
+		}
+		evicted = append(evicted, e)
+		size -= e.Size
+	}
+	return evicted
+}
@@ -0,0 +1,279 @@
+// Package envlock records the execution environment of a Packer run into a
+// lock file so that a later run can check it is about to rebuild with the same
+// Packer version, plugins and settings.
+package envlock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	plugingetter "github.com/hashicorp/packer/packer/plugin-getter"
+)
+
+// DefaultFilename is the name of the lock file written next to a template
+// when no other path is given.
+const DefaultFilename = "packer.envrc.lock"
+
+// envPrefixes lists the prefixes of the environment variables that can change
+// the outcome of a build and are therefore recorded. PKR_VAR_ variables are
+// left out on purpose as they can hold sensitive values.
+var envPrefixes = []string{"PACKER_", "HCP_PACKER_"}
+
+// envIgnored lists environment variables matching envPrefixes that are
+// expected to change between runs without changing the outcome of a build.
+var envIgnored = map[string]bool{
+	"PACKER_RUN_UUID": true,
+	"PACKER_LOG":      true,
+	"PACKER_LOG_PATH": true,
+}
+
+// envSensitive lists name fragments of environment variables whose value must
+// never be written to disk.
+var envSensitive = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "KEY"}
+
+// Lock describes the environment a Packer run was executed in.
+type Lock struct {
+	PackerVersion string            `json:"packer_version"`
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	Plugins       []Plugin          `json:"plugins"`
+	Env           map[string]string `json:"env"`
+}
+
+// Plugin describes an installed plugin binary.
+type Plugin struct {
+	// Path of the binary relative to the plugin folder it was found in.
+	// Ex: github.com/hashicorp/amazon/packer-plugin-amazon_v1.0.0_x5.0_linux_amd64
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+// CaptureOptions configures what Capture records.
+type CaptureOptions struct {
+	// PackerVersion is the formatted version of the running Packer.
+	PackerVersion string
+
+	// PluginFolders are the folders plugins are installed in, usually
+	// PluginConfig.KnownPluginFolders.
+	PluginFolders []string
+
+	// Environ is the environment to record, in the form of os.Environ().
+	Environ []string
+}
+
+// Capture records the current environment as described by opts.
+func Capture(opts CaptureOptions) (*Lock, error) {
+	l := &Lock{
+		PackerVersion: opts.PackerVersion,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Plugins:       []Plugin{},
+		Env:           map[string]string{},
+	}
+
+	seen := map[string]bool{}
+	for _, folder := range opts.PluginFolders {
+		installations, err := listInstallations(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, installation := range installations {
+			rel, err := filepath.Rel(folder, installation.BinaryPath)
+			if err != nil {
+				return nil, err
+			}
+			rel = filepath.ToSlash(rel)
+			// Folders are listed by precedence, the first binary found is
+			// the one Packer will use.
+			if seen[rel] {
+				continue
+			}
+			seen[rel] = true
+
+			sum, err := checksumFile(installation.BinaryPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to checksum plugin %q: %s", installation.BinaryPath, err)
+			}
+			l.Plugins = append(l.Plugins, Plugin{
+				Path:    rel,
+				Version: installation.Version,
+				SHA256:  sum,
+			})
+		}
+	}
+	sort.Slice(l.Plugins, func(i, j int) bool { return l.Plugins[i].Path < l.Plugins[j].Path })
+
+	for _, kv := range opts.Environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !isRecordedEnv(parts[0]) {
+			continue
+		}
+		l.Env[parts[0]] = parts[1]
+	}
+
+	return l, nil
+}
+
+func listInstallations(folder string) (plugingetter.InstallList, error) {
+	opts := plugingetter.ListInstallationsOptions{
+		FromFolders: []string{folder},
+		BinaryInstallationOptions: plugingetter.BinaryInstallationOptions{
+			OS:   runtime.GOOS,
+			ARCH: runtime.GOARCH,
+			Checksummers: []plugingetter.Checksummer{
+				{Type: "sha256", Hash: sha256.New()},
+			},
+		},
+	}
+	if runtime.GOOS == "windows" {
+		opts.BinaryInstallationOptions.Ext = ".exe"
+	}
+
+	// a plugin requirement that matches them all
+	allPlugins := plugingetter.Requirement{}
+	return allPlugins.ListInstallations(opts)
+}
+
+func checksumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isRecordedEnv(name string) bool {
+	if envIgnored[name] {
+		return false
+	}
+	for _, fragment := range envSensitive {
+		if strings.Contains(strings.ToUpper(name), fragment) {
+			return false
+		}
+	}
+	for _, prefix := range envPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads a lock file previously written with Write.
+func Load(path string) (*Lock, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lock{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %s", path, err)
+	}
+	return l, nil
+}
+
+// Write stores the lock in the file at path, overwriting it if present.
+func (l *Lock) Write(path string) error {
+	b, err := l.encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Digest returns the hex encoded sha256 of the encoded lock, it can be used to
+// tell whether two runs were executed in the same environment.
+func (l *Lock) Digest() (string, error) {
+	b, err := l.encode()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (l *Lock) encode() ([]byte, error) {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Diff lists, in a human readable form, every difference found between the
+// recorded lock l and the current environment. An empty list means both
+// environments match.
+func (l *Lock) Diff(current *Lock) []string {
+	var diffs []string
+
+	if l.PackerVersion != current.PackerVersion {
+		diffs = append(diffs, fmt.Sprintf("Packer version is %q, expected %q", current.PackerVersion, l.PackerVersion))
+	}
+	if l.OS != current.OS || l.Arch != current.Arch {
+		diffs = append(diffs, fmt.Sprintf("platform is %s/%s, expected %s/%s", current.OS, current.Arch, l.OS, l.Arch))
+	}
+
+	currentPlugins := map[string]Plugin{}
+	for _, p := range current.Plugins {
+		currentPlugins[p.Path] = p
+	}
+	for _, expected := range l.Plugins {
+		p, ok := currentPlugins[expected.Path]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("plugin %q is not installed", expected.Path))
+			continue
+		}
+		delete(currentPlugins, expected.Path)
+		if p.SHA256 != expected.SHA256 {
+			diffs = append(diffs, fmt.Sprintf("plugin %q has checksum %s, expected %s", expected.Path, p.SHA256, expected.SHA256))
+		}
+	}
+	var extraPlugins []string
+	for path := range currentPlugins {
+		extraPlugins = append(extraPlugins, path)
+	}
+	sort.Strings(extraPlugins)
+	for _, path := range extraPlugins {
+		diffs = append(diffs, fmt.Sprintf("plugin %q is installed but was not recorded", path))
+	}
+
+	var names []string
+	for name := range l.Env {
+		names = append(names, name)
+	}
+	for name := range current.Env {
+		if _, ok := l.Env[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expected, wasSet := l.Env[name]
+		value, isSet := current.Env[name]
+		switch {
+		case !isSet:
+			diffs = append(diffs, fmt.Sprintf("environment variable %s is not set, expected %q", name, expected))
+		case !wasSet:
+			diffs = append(diffs, fmt.Sprintf("environment variable %s is set to %q but was not recorded", name, value))
+		case value != expected:
+			diffs = append(diffs, fmt.Sprintf("environment variable %s is %q, expected %q", name, value, expected))
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,171 @@
+package envlock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writePlugin(t *testing.T, folder, name, content string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	path := filepath.Join(folder, "github.com", "hashicorp", "happycloud", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if err := os.WriteFile(path+"_SHA256SUM", []byte(hex.EncodeToString(sum[:])), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCapture(t *testing.T) {
+	folder := t.TempDir()
+	binName := "packer-plugin-happycloud_v1.2.3_x5.0_" + runtime.GOOS + "_" + runtime.GOARCH
+	sum := writePlugin(t, folder, binName, "happycloud")
+
+	// Shadowed by the first folder, should not be recorded twice.
+	shadowFolder := t.TempDir()
+	writePlugin(t, shadowFolder, binName, "other happycloud")
+
+	got, err := Capture(CaptureOptions{
+		PackerVersion: "1.7.9",
+		PluginFolders: []string{folder, shadowFolder},
+		Environ: []string{
+			"PACKER_CACHE_DIR=/tmp/cache",
+			"PACKER_RUN_UUID=c3bbd7b6-4d9e-4f37-9d2b-d8b4a5e0a7b1",
+			"PACKER_GITHUB_API_TOKEN=hunter2",
+			"HCP_PACKER_BUCKET_NAME=happycloud",
+			"HCP_CLIENT_SECRET=hunter2",
+			"PKR_VAR_password=hunter2",
+			"HOME=/home/packer",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Capture: %s", err)
+	}
+
+	expectedPath := "github.com/hashicorp/happycloud/" + binName
+	if runtime.GOOS == "windows" {
+		expectedPath += ".exe"
+	}
+	expected := &Lock{
+		PackerVersion: "1.7.9",
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Plugins: []Plugin{
+			{Path: expectedPath, Version: "v1.2.3", SHA256: sum},
+		},
+		Env: map[string]string{
+			"PACKER_CACHE_DIR":       "/tmp/cache",
+			"HCP_PACKER_BUCKET_NAME": "happycloud",
+		},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected lock: %s", diff)
+	}
+}
+
+func TestLock_WriteLoad(t *testing.T) {
+	l := &Lock{
+		PackerVersion: "1.7.9",
+		OS:            "linux",
+		Arch:          "amd64",
+		Plugins:       []Plugin{{Path: "github.com/hashicorp/happycloud/packer-plugin-happycloud", Version: "v1.2.3", SHA256: "abc"}},
+		Env:           map[string]string{"PACKER_CACHE_DIR": "/tmp/cache"},
+	}
+
+	path := filepath.Join(t.TempDir(), DefaultFilename)
+	if err := l.Write(path); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if diff := cmp.Diff(l, got); diff != "" {
+		t.Errorf("unexpected lock: %s", diff)
+	}
+
+	digest, err := l.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %s", err)
+	}
+	loadedDigest, _ := got.Digest()
+	if digest != loadedDigest {
+		t.Errorf("expected digests to match, got %q and %q", digest, loadedDigest)
+	}
+}
+
+func TestLock_Diff(t *testing.T) {
+	recorded := &Lock{
+		PackerVersion: "1.7.9",
+		OS:            "linux",
+		Arch:          "amd64",
+		Plugins: []Plugin{
+			{Path: "a", Version: "v1.0.0", SHA256: "aaa"},
+			{Path: "b", Version: "v1.0.0", SHA256: "bbb"},
+		},
+		Env: map[string]string{
+			"PACKER_CACHE_DIR":  "/tmp/cache",
+			"PACKER_CONFIG_DIR": "/etc/packer",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		current  *Lock
+		expected []string
+	}{
+		{
+			name:     "same environment",
+			current:  recorded,
+			expected: nil,
+		},
+		{
+			name: "everything differs",
+			current: &Lock{
+				PackerVersion: "1.8.0",
+				OS:            "darwin",
+				Arch:          "arm64",
+				Plugins: []Plugin{
+					{Path: "a", Version: "v1.0.0", SHA256: "zzz"},
+					{Path: "c", Version: "v1.0.0", SHA256: "ccc"},
+				},
+				Env: map[string]string{
+					"PACKER_CACHE_DIR":   "/var/cache",
+					"PACKER_PLUGIN_PATH": "/opt/plugins",
+				},
+			},
+			expected: []string{
+				`Packer version is "1.8.0", expected "1.7.9"`,
+				`platform is darwin/arm64, expected linux/amd64`,
+				`plugin "a" has checksum zzz, expected aaa`,
+				`plugin "b" is not installed`,
+				`plugin "c" is installed but was not recorded`,
+				`environment variable PACKER_CACHE_DIR is "/var/cache", expected "/tmp/cache"`,
+				`environment variable PACKER_CONFIG_DIR is not set, expected "/etc/packer"`,
+				`environment variable PACKER_PLUGIN_PATH is set to "/opt/plugins" but was not recorded`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recorded.Diff(tt.current)
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("unexpected diff: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package hostexec runs commands on the machine running Packer. It hides the
+// differences between the shells of Linux, macOS and Windows hosts: which
+// shell runs a script and how, how arguments are quoted, how environment
+// variables are set and what exit code a failed command has. It is used by the
+// shell-local provisioner and post-processor and by the pre_build and
+// post_build commands of builds.
+package hostexec
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Shell is a shell able to run scripts on the host.
+type Shell string
+
+// The supported shells.
+const (
+	ShellSh         Shell = "sh"
+	ShellBash       Shell = "bash"
+	ShellCmd        Shell = "cmd"
+	ShellPowerShell Shell = "powershell"
+	ShellPwsh       Shell = "pwsh"
+)
+
+// Shells are the supported shells.
+var Shells = []Shell{ShellSh, ShellBash, ShellCmd, ShellPowerShell, ShellPwsh}
+
+// DefaultShell returns the shell of the host: cmd on Windows, sh elsewhere.
+func DefaultShell() Shell {
+	return defaultShell(runtime.GOOS)
+}
+
+func defaultShell(goos string) Shell {
+	if goos == "windows" {
+		return ShellCmd
+	}
+	return ShellSh
+}
+
+// ParseShell returns the shell named name, the default shell of the host when
+// name is empty.
+func ParseShell(name string) (Shell, error) {
+	if name == "" {
+		return DefaultShell(), nil
+	}
+	for _, s := range Shells {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	names := make([]string, len(Shells))
+	for i, s := range Shells {
+		names[i] = string(s)
+	}
+	return "", fmt.Errorf("unknown shell %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// program returns the program of the shell.
+func (s Shell) program() string {
+	if s == ShellSh && runtime.GOOS != "windows" {
+		return "/bin/sh"
+	}
+	return string(s)
+}
+
+func (s Shell) isPowerShell() bool {
+	return s == ShellPowerShell || s == ShellPwsh
+}
+
+// InlineArgs returns the command line running commands one after the other,
+// stopping at the first one failing.
+func (s Shell) InlineArgs(commands []string) []string {
+	switch {
+	case s == ShellCmd:
+		return []string{s.program(), "/C", strings.Join(commands, " && ")}
+	case s.isPowerShell():
+		// Cmdlets stop the script on errors, programs by their exit code.
+		var script strings.Builder
+		script.WriteString("$ErrorActionPreference = 'Stop'\n")
+		for _, c := range commands {
+			script.WriteString(c + "\nif ($LASTEXITCODE) { exit $LASTEXITCODE }\n")
+		}
+		return []string{s.program(), "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", script.String()}
+	}
+	return []string{s.program(), "-e", "-c", strings.Join(commands, "\n")}
+}
+
+// ScriptArgs returns the command line running the script file at path.
+func (s Shell) ScriptArgs(path string) []string {
+	switch {
+	case s == ShellCmd:
+		return []string{s.program(), "/V", "/C", "call", path}
+	case s.isPowerShell():
+		return []string{s.program(), "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", path}
+	}
+	return []string{s.program(), path}
+}
+
+// ScriptExtension returns the extension the script files of the shell need,
+// without the dot; none for the POSIX shells.
+func (s Shell) ScriptExtension() string {
+	switch {
+	case s == ShellCmd:
+		return "cmd"
+	case s.isPowerShell():
+		return "ps1"
+	}
+	return ""
+}
+
+// Quote quotes arg for the shell, so that it is read as a single argument
+// with no expansion.
+func (s Shell) Quote(arg string) string {
+	switch {
+	case s == ShellCmd:
+		// cmd has no single quotes: the special characters are escaped
+		// with a caret, and the double quotes doubled.
+		var b strings.Builder
+		b.WriteByte('"')
+		for _, r := range arg {
+			switch r {
+			case '"':
+				b.WriteString(`""`)
+			case '%', '^', '&', '|', '<', '>', '!':
+				b.WriteRune('^')
+				b.WriteRune(r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteByte('"')
+		return b.String()
+	case s.isPowerShell():
+		return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// SetEnv returns the prefix of a command line of the shell setting the
+// environment variable name to value for the command following it.
+func (s Shell) SetEnv(name, value string) string {
+	switch {
+	case s == ShellCmd:
+		return fmt.Sprintf(`set "%s=%s" && `, name, value)
+	case s.isPowerShell():
+		return fmt.Sprintf("$env:%s=%s; ", name, s.Quote(value))
+	}
+	return fmt.Sprintf("%s=%s ", name, s.Quote(value))
+}
+
+// Command returns the command running args in dir, with env set in addition
+// to the environment of Packer, in the order of their names.
+func Command(ctx context.Context, args []string, env map[string]string, dir string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+env[k])
+	}
+	return cmd
+}
+
+// Run runs cmd, writing its standard output to ui as messages and its standard
+// error as errors, and returns its exit code, see ExitCode.
+func Run(cmd *exec.Cmd, ui packersdk.Ui) (int, error) {
+	stdout, stdoutDone := lines(ui.Message)
+	stderr, stderrDone := lines(ui.Error)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	stdout.Close()
+	stderr.Close()
+	<-stdoutDone
+	<-stderrDone
+	return ExitCode(err)
+}
+
+// lines returns a writer calling fn with each line written to it, until it is
+// closed and done is closed.
+func lines(fn func(string)) (w io.WriteCloser, done <-chan struct{}) {
+	r, w := io.Pipe()
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			fn(scanner.Text())
+		}
+		// Drain what the scanner could not read, like too long lines.
+		_, _ = io.Copy(io.Discard, r)
+	}()
+	return w, c
+}
+
+// ExitCode returns the exit code of a command from the error of its run. A
+// command killed by a signal exits with 128 plus the number of the signal, as
+// reported by POSIX shells, whatever the host. The error is only returned
+// when the command could not run at all.
+func ExitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return -1, err
+	}
+	if code := exitErr.ExitCode(); code >= 0 {
+		return code, nil
+	}
+	if ws, ok := exitErr.Sys().(interface{ Signal() syscall.Signal }); ok && ws.Signal() > 0 {
+		return 128 + int(ws.Signal()), nil
+	}
+	return -1, err
+}
@@ -0,0 +1,92 @@
+package hostexec
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestParseShell(t *testing.T) {
+	if s, err := ParseShell(""); err != nil || s != DefaultShell() {
+		t.Errorf("expected the default shell, got %q, %v", s, err)
+	}
+	if s, err := ParseShell("pwsh"); err != nil || s != ShellPwsh {
+		t.Errorf("expected pwsh, got %q, %v", s, err)
+	}
+	if _, err := ParseShell("zsh"); err == nil {
+		t.Error("expected an unknown shell to fail")
+	}
+	if defaultShell("windows") != ShellCmd || defaultShell("darwin") != ShellSh {
+		t.Error("unexpected default shells")
+	}
+}
+
+func TestShell_Quote(t *testing.T) {
+	tests := []struct {
+		shell    Shell
+		arg      string
+		expected string
+	}{
+		{ShellSh, "it's $HOME", `'it'"'"'s $HOME'`},
+		{ShellBash, "a b", `'a b'`},
+		{ShellPowerShell, "it's $env:HOME", `'it''s $env:HOME'`},
+		{ShellCmd, `say "hi" & 100%`, `"say ""hi"" ^& 100^%"`},
+	}
+	for _, tt := range tests {
+		if got := tt.shell.Quote(tt.arg); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.shell, tt.expected, got)
+		}
+	}
+}
+
+func TestShell_Args(t *testing.T) {
+	if got := ShellCmd.InlineArgs([]string{"echo a", "echo b"}); !reflect.DeepEqual(got, []string{"cmd", "/C", "echo a && echo b"}) {
+		t.Errorf("unexpected cmd command line %q", got)
+	}
+	if got := ShellPwsh.ScriptArgs("x.ps1"); got[len(got)-2] != "-File" || got[len(got)-1] != "x.ps1" {
+		t.Errorf("unexpected pwsh command line %q", got)
+	}
+	if got := ShellBash.ScriptArgs("x.sh"); !reflect.DeepEqual(got, []string{"bash", "x.sh"}) {
+		t.Errorf("unexpected bash command line %q", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a POSIX shell")
+	}
+
+	var out, errOut bytes.Buffer
+	ui := &packersdk.BasicUi{Writer: &out, ErrorWriter: &errOut}
+	cmd := Command(context.Background(), ShellSh.InlineArgs([]string{"echo $GREETING", "echo oops >&2", "exit 3", "echo unreachable"}),
+		map[string]string{"GREETING": "hello"}, "")
+	code, err := Run(cmd, ui)
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+	if !strings.Contains(out.String(), "hello") || strings.Contains(out.String(), "unreachable") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "oops") {
+		t.Errorf("expected the standard error to be written as errors, got %q", errOut.String())
+	}
+
+	// A command killed by a signal exits like in a POSIX shell.
+	cmd = Command(context.Background(), ShellSh.InlineArgs([]string{"kill -9 $$"}), nil, "")
+	if code, err := Run(cmd, ui); err != nil || code != 137 {
+		t.Errorf("expected exit code 137, got %d, %v", code, err)
+	}
+
+	if _, err := ExitCode(exec.Command("/does/not/exist").Run()); err == nil {
+		t.Error("expected a command that could not start to fail")
+	}
+}
@@ -0,0 +1,217 @@
+// Package httpserver serves files to the machines being built, like the
+// kickstart, preseed or cloud-init files fetched by installers while they
+// boot. The files can be served over TLS, and only to the requests sending the
+// token generated for the run.
+package httpserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	sdknet "github.com/hashicorp/packer-plugin-sdk/net"
+)
+
+// TokenParameter is the query parameter carrying the token of a server.
+const TokenParameter = "token"
+
+// Config configures a server.
+type Config struct {
+	// Address is the address to listen on, all the interfaces when empty.
+	Address string
+	// The server listens on a free port of [PortMin, PortMax).
+	PortMin, PortMax int
+	// Host is the address the machines reach the server at, used in its URL.
+	// Defaults to Address when set, to an address of the host otherwise.
+	Host string
+
+	// TLS serves the files over HTTPS, with the certificate and key of
+	// CertFile and KeyFile, or with a self-signed certificate for Host when
+	// they are not set.
+	TLS               bool
+	CertFile, KeyFile string
+
+	// Token makes the server only serve the requests sending the random
+	// token generated when it starts, see TokenParameter.
+	Token bool
+
+	Handler http.Handler
+}
+
+// Server is a started server.
+type Server struct {
+	// URL is the base URL of the server, like https://10.0.0.2:8123.
+	URL  string
+	Port int
+	// Token is the token the requests must send, if any.
+	Token string
+
+	listener *sdknet.Listener
+	srv      *http.Server
+}
+
+// Start starts a server serving cfg.Handler until it is closed.
+func Start(ctx context.Context, cfg Config) (*Server, error) {
+	host := cfg.Host
+	if host == "" {
+		host = cfg.Address
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = hostAddress()
+	}
+
+	s := &Server{}
+	handler := cfg.Handler
+	if cfg.Token {
+		token, err := newToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the token: %s", err)
+		}
+		s.Token = token
+		handler = tokenHandler(token, handler)
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		var cert tls.Certificate
+		var err error
+		if cfg.CertFile != "" || cfg.KeyFile != "" {
+			cert, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		} else {
+			cert, err = selfSignedCertificate(host)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the TLS certificate: %s", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	l, err := sdknet.ListenRangeConfig{
+		Min:     cfg.PortMin,
+		Max:     cfg.PortMax,
+		Addr:    cfg.Address,
+		Network: "tcp",
+	}.Listen(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a port: %s", err)
+	}
+	s.listener = l
+	s.Port = l.Port
+
+	scheme := "http"
+	var listener net.Listener = l
+	if tlsConfig != nil {
+		scheme = "https"
+		listener = tls.NewListener(l, tlsConfig)
+	}
+	s.URL = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(l.Port))
+
+	s.srv = &http.Server{Handler: handler}
+	go func() {
+		if err := s.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[WARN] (httpserver) failed to serve on %s: %s", s.URL, err)
+		}
+	}()
+	return s, nil
+}
+
+// Close stops the server and releases its port.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	// The listener is closed already, this only closes the connections.
+	_ = s.srv.Close()
+	return err
+}
+
+// tokenHandler only lets the requests sending token through to h.
+func tokenHandler(token string, h http.Handler) http.Handler {
+	want := []byte(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.URL.Query().Get(TokenParameter))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			log.Printf("[WARN] (httpserver) refused %s from %s: invalid token", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "invalid token", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hostAddress returns an address of the host the machines are likely to
+// reach it at: the first IPv4 address of an interface that is up and not a
+// loopback, or the loopback address when there is none.
+func hostAddress() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "127.0.0.1"
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				return ipNet.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// selfSignedCertificate returns a certificate for host, valid for a day,
+// signed by its own key.
+func selfSignedCertificate(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"Packer"}, CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,90 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestStart(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "served "+r.URL.Path)
+	})
+	insecure := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	for _, tc := range []struct {
+		name   string
+		cfg    Config
+		scheme string
+	}{
+		{"plain", Config{}, "http://"},
+		{"self-signed", Config{TLS: true}, "https://"},
+		{"token", Config{TLS: true, Token: true}, "https://"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Address = "127.0.0.1"
+			tc.cfg.PortMin, tc.cfg.PortMax = 8000, 9000
+			tc.cfg.Handler = handler
+			s, err := Start(context.Background(), tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if !strings.HasPrefix(s.URL, tc.scheme+"127.0.0.1:") {
+				t.Errorf("unexpected URL %q", s.URL)
+			}
+			if tc.cfg.Token != (s.Token != "") {
+				t.Fatalf("unexpected token %q", s.Token)
+			}
+
+			url := s.URL + "/ks.cfg"
+			if tc.cfg.Token {
+				if code, _ := get(t, insecure, url); code != http.StatusForbidden {
+					t.Errorf("expected a request without the token to be refused, got %d", code)
+				}
+				if code, _ := get(t, insecure, url+"?token=wrong"); code != http.StatusForbidden {
+					t.Errorf("expected a request with a wrong token to be refused, got %d", code)
+				}
+				url += "?token=" + s.Token
+			}
+			code, body := get(t, insecure, url)
+			if code != http.StatusOK || body != "served /ks.cfg" {
+				t.Errorf("unexpected response %d %q", code, body)
+			}
+		})
+	}
+}
+
+func TestStart_certificateFiles(t *testing.T) {
+	_, err := Start(context.Background(), Config{
+		Address:  "127.0.0.1",
+		PortMin:  8000,
+		PortMax:  9000,
+		TLS:      true,
+		CertFile: "missing.crt",
+		KeyFile:  "missing.key",
+	})
+	if err == nil || !strings.Contains(err.Error(), "TLS certificate") {
+		t.Errorf("expected the missing certificate to fail, got %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+// Package notify notifies the targets set in the notifications of the Packer
+// config file once the builds of a run completed: webhooks receiving a JSON
+// payload, Slack incoming webhooks receiving a summary, and commands run on
+// this machine receiving the payload on their standard input.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SignatureHeader holds the hex encoded HMAC-SHA256 of the payload sent to a
+// webhook, keyed with its secret, ex: "sha256=4f2a...".
+const SignatureHeader = "X-Packer-Signature"
+
+// The types of targets.
+const (
+	TypeWebhook = "webhook"
+	TypeSlack   = "slack"
+	TypeExec    = "exec"
+)
+
+// The outcomes of a run, selecting the targets notified, see Target.On.
+const (
+	OnSuccess = "success"
+	OnFailure = "failure"
+)
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// execTimeout is how long the command of an exec target can run.
+var execTimeout = time.Minute
+
+// Target is notified of the outcome of the runs.
+type Target struct {
+	Type string
+	// URL is where the payload of webhook and slack targets is POSTed.
+	URL string
+	// Headers are added to the requests of webhook targets, Secret signs
+	// their payload, see SignatureHeader.
+	Headers map[string]string
+	Secret  string
+	// Command is the command of exec targets and its arguments.
+	Command []string
+	// On are the outcomes notified, both when empty.
+	On []string
+}
+
+// UnmarshalJSON decodes and checks the target set in the Packer config file,
+// like {"type": "slack", "url": "https://hooks.slack.com/...", "on": ["failure"]}.
+func (t *Target) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Type    string            `json:"type"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Secret  string            `json:"secret"`
+		Command []string          `json:"command"`
+		On      []string          `json:"on"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*t = Target(raw)
+
+	switch t.Type {
+	case TypeWebhook, TypeSlack:
+		if t.URL == "" {
+			return fmt.Errorf("the %s notification needs a url", t.Type)
+		}
+	case TypeExec:
+		if len(t.Command) == 0 {
+			return fmt.Errorf("the exec notification needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown notification type %q, expected %s, %s or %s", t.Type, TypeWebhook, TypeSlack, TypeExec)
+	}
+	for _, on := range t.On {
+		if on != OnSuccess && on != OnFailure {
+			return fmt.Errorf("unknown notification outcome %q, expected %s or %s", on, OnSuccess, OnFailure)
+		}
+	}
+	return nil
+}
+
+// String describes t in errors, without its secrets.
+func (t *Target) String() string {
+	if t.Type == TypeExec {
+		return fmt.Sprintf("exec %s", t.Command[0])
+	}
+	// The URLs of Slack webhooks are secrets.
+	host := t.URL
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		host = host[:i]
+	}
+	return fmt.Sprintf("%s %s", t.Type, host)
+}
+
+// Notifies tells whether t is notified of the runs with this outcome.
+func (t *Target) Notifies(outcome string) bool {
+	if len(t.On) == 0 {
+		return true
+	}
+	for _, on := range t.On {
+		if on == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload describes a completed run and its builds.
+type Payload struct {
+	// Outcome is OnSuccess when all the builds succeeded, OnFailure
+	// otherwise.
+	Outcome     string        `json:"outcome"`
+	Template    string        `json:"template"`
+	RunUUID     string        `json:"run_uuid,omitempty"`
+	StartedAt   time.Time     `json:"started_at"`
+	CompletedAt time.Time     `json:"completed_at"`
+	Builds      []BuildResult `json:"builds"`
+}
+
+// BuildResult is the result of a build of a run.
+type BuildResult struct {
+	Name string `json:"name"`
+	// Error is why the build failed, empty when it succeeded.
+	Error     string     `json:"error,omitempty"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+type Artifact struct {
+	BuilderID   string `json:"builder_id"`
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+}
+
+// Summary is the one line summary of p sent to Slack.
+func (p *Payload) Summary() string {
+	var failed []string
+	for _, b := range p.Builds {
+		if b.Error != "" {
+			failed = append(failed, b.Name)
+		}
+	}
+	duration := p.CompletedAt.Sub(p.StartedAt).Round(time.Second)
+	if len(failed) == 0 {
+		return fmt.Sprintf("Packer build of %s succeeded after %s: %d build(s) completed.", p.Template, duration, len(p.Builds))
+	}
+	return fmt.Sprintf("Packer build of %s failed after %s: %d of %d build(s) failed: %s.",
+		p.Template, duration, len(failed), len(p.Builds), strings.Join(failed, ", "))
+}
+
+// Notify notifies the targets of the outcome of p, it returns the errors of
+// the ones that could not be notified.
+func Notify(ctx context.Context, targets []*Target, p Payload) []error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, t := range targets {
+		if !t.Notifies(p.Outcome) {
+			continue
+		}
+		var err error
+		switch t.Type {
+		case TypeWebhook:
+			err = t.post(ctx, body)
+		case TypeSlack:
+			var msg []byte
+			if msg, err = json.Marshal(map[string]string{"text": p.Summary()}); err == nil {
+				err = t.post(ctx, msg)
+			}
+		case TypeExec:
+			err = t.run(ctx, p, body)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %s", t, err))
+		}
+	}
+	return errs
+}
+
+// post POSTs body to the URL of t.
+func (t *Target) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(t.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// run runs the command of t with body on its standard input, and the outcome
+// and the template of p in PACKER_NOTIFY_OUTCOME and PACKER_NOTIFY_TEMPLATE.
+func (t *Target) run(ctx context.Context, p Payload, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.Command[0], t.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"PACKER_NOTIFY_OUTCOME="+p.Outcome,
+		"PACKER_NOTIFY_TEMPLATE="+p.Template)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if out := strings.TrimSpace(string(out)); out != "" {
+			return fmt.Errorf("%s: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTarget_UnmarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		wantErr string
+	}{
+		{raw: `{"type": "webhook", "url": "https://example.com/hook", "on": ["failure"]}`},
+		{raw: `{"type": "exec", "command": ["notify-send", "packer"]}`},
+		{raw: `{"type": "slack"}`, wantErr: "needs a url"},
+		{raw: `{"type": "exec"}`, wantErr: "needs a command"},
+		{raw: `{"type": "email", "url": "mailto:ops@example.com"}`, wantErr: "unknown notification type"},
+		{raw: `{"type": "webhook", "url": "https://example.com/hook", "on": ["always"]}`, wantErr: "unknown notification outcome"},
+	} {
+		var target Target
+		err := json.Unmarshal([]byte(tc.raw), &target)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", tc.raw, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: expected an error containing %q, got %v", tc.raw, tc.wantErr, err)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var received []*http.Request
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, string(b))
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	started := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	p := Payload{
+		Outcome:     OnFailure,
+		Template:    "ubuntu.pkr.hcl",
+		StartedAt:   started,
+		CompletedAt: started.Add(90 * time.Second),
+		Builds: []BuildResult{
+			{Name: "amazon-ebs.ubuntu", Artifacts: []Artifact{{BuilderID: "mitchellh.amazonebs", ID: "us-east-1:ami-1"}}},
+			{Name: "docker.ubuntu", Error: "pull failed", Artifacts: []Artifact{}},
+		},
+	}
+	targets := []*Target{
+		{Type: TypeWebhook, URL: srv.URL + "/hook", Secret: "s3cr3t", Headers: map[string]string{"X-Team": "images"}},
+		{Type: TypeSlack, URL: srv.URL + "/slack", On: []string{OnFailure}},
+		{Type: TypeWebhook, URL: srv.URL + "/success", On: []string{OnSuccess}},
+		{Type: TypeWebhook, URL: srv.URL + "/broken"},
+	}
+
+	errs := Notify(context.Background(), targets, p)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "500") {
+		t.Fatalf("expected the broken webhook to fail only, got %v", errs)
+	}
+	if len(received) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(received))
+	}
+
+	var got Payload
+	if err := json.Unmarshal([]byte(bodies[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Outcome != OnFailure || len(got.Builds) != 2 || got.Builds[1].Error != "pull failed" {
+		t.Errorf("unexpected payload %s", bodies[0])
+	}
+	if received[0].Header.Get("X-Team") != "images" || !strings.HasPrefix(received[0].Header.Get(SignatureHeader), "sha256=") {
+		t.Errorf("expected the headers of the webhook to be set, got %v", received[0].Header)
+	}
+
+	if received[1].URL.Path != "/slack" || !strings.Contains(bodies[1], "1 of 2 build(s) failed: docker.ubuntu") {
+		t.Errorf("expected a summary to be sent to slack, got %s %s", received[1].URL.Path, bodies[1])
+	}
+}
+
+func TestNotify_exec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command needs sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	target := &Target{Type: TypeExec, Command: []string{"sh", "-c", `cat > "$0"; echo "$PACKER_NOTIFY_OUTCOME" >> "$0"`, out}}
+	if errs := Notify(context.Background(), []*Target{target}, Payload{Outcome: OnSuccess, Builds: []BuildResult{}}); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), `{"outcome":"success"`) || !strings.HasSuffix(string(b), "success\n") {
+		t.Errorf("expected the payload and the outcome to be given to the command, got %s", b)
+	}
+
+	target.Command = []string{"sh", "-c", "echo unreachable >&2; exit 3"}
+	if errs := Notify(context.Background(), []*Target{target}, Payload{Outcome: OnFailure}); len(errs) != 1 || !strings.Contains(errs[0].Error(), "unreachable") {
+		t.Errorf("expected the failure of the command to be reported, got %v", errs)
+	}
+}
@@ -0,0 +1,229 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/internal/registry/env"
+)
+
+// RequestIDHeader identifies a request sent to the HCP API. Packer sets it on
+// the requests it audits, and records the value echoed back by HCP when it
+// differs.
+const RequestIDHeader = "X-Request-Id"
+
+// Audited registry operations.
+const (
+	AuditCreateBucket    = "create_bucket"
+	AuditUpdateBucket    = "update_bucket"
+	AuditDeleteBucket    = "delete_bucket"
+	AuditCreateIteration = "create_iteration"
+	AuditRevokeIteration = "revoke_iteration"
+	AuditCreateBuild     = "create_build"
+	AuditUpdateBuild     = "update_build"
+	AuditCreateChannel   = "create_channel"
+	AuditUpdateChannel   = "update_channel"
+)
+
+// AuditLog records every mutation made to the HCP Packer registry in a local
+// file, one JSON entry per line. Entries are only ever appended to the file, so
+// that it can prove what was published, when and by whom.
+type AuditLog struct {
+	Path  string
+	Actor AuditActor
+
+	lock sync.Mutex
+}
+
+// AuditActor identifies who made a registry mutation.
+type AuditActor struct {
+	// User is the local user running Packer.
+	User     string `json:"user,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	// Principal is the HCP identity the requests are authenticated as:
+	// "client_id:<id>" or "workload_identity:<provider>".
+	Principal string `json:"principal,omitempty"`
+}
+
+// AuditEntry is a registry mutation recorded in an AuditLog.
+type AuditEntry struct {
+	Time           time.Time    `json:"time"`
+	Operation      string       `json:"operation"`
+	OrganizationID string       `json:"organization_id,omitempty"`
+	ProjectID      string       `json:"project_id,omitempty"`
+	BucketSlug     string       `json:"bucket_slug,omitempty"`
+	IterationID    string       `json:"iteration_id,omitempty"`
+	Fingerprint    string       `json:"fingerprint,omitempty"`
+	BuildID        string       `json:"build_id,omitempty"`
+	ComponentType  string       `json:"component_type,omitempty"`
+	ChannelSlug    string       `json:"channel_slug,omitempty"`
+	Status         string       `json:"status,omitempty"`
+	Images         []AuditImage `json:"images,omitempty"`
+	RequestID      string       `json:"request_id,omitempty"`
+	// Error is set when the registry refused the mutation.
+	Error string     `json:"error,omitempty"`
+	Actor AuditActor `json:"actor"`
+}
+
+// AuditImage is an image uploaded to the registry along with a build.
+type AuditImage struct {
+	ImageID string `json:"image_id"`
+	Region  string `json:"region"`
+}
+
+// NewAuditLogFromEnv returns the audit log configured with the
+// HCP_PACKER_AUDIT_LOG environment variable, or nil when auditing is not
+// enabled.
+func NewAuditLogFromEnv() *AuditLog {
+	path := os.Getenv(env.HCPPackerAuditLog)
+	if path == "" {
+		return nil
+	}
+
+	actor := AuditActor{}
+	if u, err := user.Current(); err == nil {
+		actor.User = u.Username
+	}
+	actor.Hostname, _ = os.Hostname()
+	switch {
+	case env.HasWorkloadIdentity():
+		actor.Principal = "workload_identity:" + os.Getenv(env.HCPWorkloadIdentityProvider)
+	case env.HasClientID():
+		actor.Principal = "client_id:" + os.Getenv(env.HCPClientID)
+	}
+	return &AuditLog{Path: path, Actor: actor}
+}
+
+// Record appends entry to the audit log, setting its actor and timestamp.
+func (a *AuditLog) Record(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.Actor = a.Actor
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open the registry audit log: %s", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write to the registry audit log: %s", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write to the registry audit log: %s", err)
+	}
+	return f.Close()
+}
+
+// audit records a mutation made through ctx, once done. The request ID of
+// the mutation is collected from ctx, see withRequestID.
+//
+// A mutation that cannot be recorded fails, even when the registry accepted
+// it: an audit log missing entries cannot be trusted.
+func (client *Client) audit(ctx context.Context, entry AuditEntry, err error) error {
+	if client.Audit == nil {
+		return err
+	}
+
+	entry.OrganizationID = client.OrganizationID
+	entry.ProjectID = client.ProjectID
+	if id, ok := ctx.Value(requestIDKey{}).(*requestID); ok {
+		entry.RequestID = id.Get()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if auditErr := client.Audit.Record(entry); auditErr != nil {
+		log.Printf("[ERROR] failed to audit the %s registry operation: %s", entry.Operation, auditErr)
+		if err == nil {
+			return auditErr
+		}
+	}
+	return err
+}
+
+// auditImages returns the images of a build update, as recorded in the audit
+// log.
+func auditImages(images []*models.HashicorpCloudPackerImageCreateBody) []AuditImage {
+	var res []AuditImage
+	for _, image := range images {
+		res = append(res, AuditImage{ImageID: image.ImageID, Region: image.Region})
+	}
+	return res
+}
+
+type requestIDKey struct{}
+
+// requestID holds the ID of the request sent with a context.
+type requestID struct {
+	lock sync.Mutex
+	id   string
+}
+
+func (r *requestID) Get() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.id
+}
+
+func (r *requestID) Set(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.id = id
+}
+
+// withRequestID returns a context collecting the ID of the request sent with
+// it, when auditing is enabled.
+func (client *Client) withRequestID(ctx context.Context) context.Context {
+	if client.Audit == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, &requestID{})
+}
+
+// requestIDRoundTripper sets the RequestIDHeader of the requests whose context
+// collects their request ID, see withRequestID.
+type requestIDRoundTripper struct {
+	http.RoundTripper
+}
+
+func (rt *requestIDRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	holder, ok := req.Context().Value(requestIDKey{}).(*requestID)
+	if !ok {
+		return rt.RoundTripper.RoundTrip(req)
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestIDHeader, id)
+	holder.Set(id)
+
+	resp, err := rt.RoundTripper.RoundTrip(req)
+	if resp != nil {
+		if echoed := resp.Header.Get(RequestIDHeader); echoed != "" {
+			holder.Set(echoed)
+		}
+	}
+	return resp, err
+}
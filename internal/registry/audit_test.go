@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func readAuditLog(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open the audit log: %s", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit log line %q: %s", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestClient_audit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	actor := AuditActor{User: "packer", Hostname: "ci", Principal: "client_id:abc"}
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.CreateBuildResp.Build.ID = "build-id"
+	client := &Client{
+		Packer:         mockService,
+		OrganizationID: "org",
+		ProjectID:      "project",
+		Audit:          &AuditLog{Path: path, Actor: actor},
+	}
+	ctx := context.Background()
+
+	if _, err := client.CreateBuild(ctx, "bucket", "run", "iteration", "fingerprint", "source.null.test",
+		models.HashicorpCloudPackerBuildStatusUNSET); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	images := []*models.HashicorpCloudPackerImageCreateBody{{ImageID: "ami-1", Region: "us-east-1"}}
+	if _, err := client.UpdateBuild(ctx, "build-id", "run", "aws", "", nil,
+		models.HashicorpCloudPackerBuildStatusDONE, images); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// A mutation refused by the registry is recorded along with its error.
+	if _, err := client.UpdateBuild(ctx, "", "run", "aws", "", nil,
+		models.HashicorpCloudPackerBuildStatusDONE, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	expected := []AuditEntry{
+		{
+			Operation:      AuditCreateBuild,
+			OrganizationID: "org",
+			ProjectID:      "project",
+			BucketSlug:     "bucket",
+			IterationID:    "iteration",
+			Fingerprint:    "fingerprint",
+			BuildID:        "build-id",
+			ComponentType:  "source.null.test",
+			Status:         "UNSET",
+			Actor:          actor,
+		},
+		{
+			Operation:      AuditUpdateBuild,
+			OrganizationID: "org",
+			ProjectID:      "project",
+			BuildID:        "build-id",
+			Status:         "DONE",
+			Images:         []AuditImage{{ImageID: "ami-1", Region: "us-east-1"}},
+			Actor:          actor,
+		},
+		{
+			Operation:      AuditUpdateBuild,
+			OrganizationID: "org",
+			ProjectID:      "project",
+			Status:         "DONE",
+			Error:          "No valid BuildID was passed in",
+			Actor:          actor,
+		},
+	}
+	entries := readAuditLog(t, path)
+	if diff := cmp.Diff(expected, entries, cmpopts.IgnoreFields(AuditEntry{}, "Time")); diff != "" {
+		t.Errorf("unexpected audit log: %s", diff)
+	}
+	for _, entry := range entries {
+		if entry.Time.IsZero() {
+			t.Errorf("the %s entry has no timestamp", entry.Operation)
+		}
+	}
+
+	// The log is only appended to.
+	client.Audit = &AuditLog{Path: path, Actor: actor}
+	if err := client.UpsertBucket(ctx, "bucket", "", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if entries := readAuditLog(t, path); len(entries) != 4 || entries[3].Operation != AuditCreateBucket {
+		t.Errorf("expected the bucket creation to be appended, got %v", entries)
+	}
+}
+
+func TestClient_audit_unwritable(t *testing.T) {
+	client := &Client{
+		Packer: registrytest.NewMockPackerClientService(),
+		Audit:  &AuditLog{Path: filepath.Join(t.TempDir(), "missing", "audit.log")},
+	}
+	if err := client.UpsertBucket(context.Background(), "bucket", "", nil); err == nil {
+		t.Errorf("a mutation that cannot be audited should fail")
+	}
+}
+
+func TestRequestIDRoundTripper(t *testing.T) {
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get(RequestIDHeader)
+		if r.URL.Path == "/echo" {
+			w.Header().Set(RequestIDHeader, "server-id")
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{Audit: &AuditLog{}}
+	httpClient := &http.Client{Transport: &requestIDRoundTripper{RoundTripper: http.DefaultTransport}}
+	for _, tc := range []struct {
+		path     string
+		expected func(sent string) string
+	}{
+		{"/", func(sent string) string { return sent }},
+		{"/echo", func(string) string { return "server-id" }},
+	} {
+		ctx := client.withRequestID(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+tc.path, nil)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		resp.Body.Close()
+
+		if sent == "" {
+			t.Errorf("%s: no request ID was sent", tc.path)
+		}
+		if got := ctx.Value(requestIDKey{}).(*requestID).Get(); got != tc.expected(sent) {
+			t.Errorf("%s: unexpected request ID %q", tc.path, got)
+		}
+	}
+
+	// Requests that are not audited are left untouched.
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if sent != "" {
+		t.Errorf("unexpected request ID %q", sent)
+	}
+}
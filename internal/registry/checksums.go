@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChecksumsLabel is the build label holding the checksums of the artifacts of a build, so that their consumers can
+// verify them once exported or downloaded. Its value is comma separated name=digest pairs, sorted by name, like
+// "output/image.qcow2=sha256:9f86d0…". The names are the paths of the local files of the artifacts, or the image IDs
+// of the digests reported by the plugins.
+const ChecksumsLabel = "packer_checksums"
+
+// UpdateChecksumsForBuild merges checksums, by file path or image ID, to the ChecksumsLabel of the build referred to
+// by componentType. Like the other labels, it is sent with the next status update of the build.
+func (b *Bucket) UpdateChecksumsForBuild(componentType string, checksums map[string]string) error {
+	if len(checksums) == 0 {
+		return nil
+	}
+	for name, digest := range checksums {
+		if name == "" || strings.ContainsAny(name, ",=") || !strings.Contains(digest, ":") {
+			return fmt.Errorf("invalid checksum %q for %q, expected a name without ',' or '=' and a digest like sha256:<hex>", digest, name)
+		}
+	}
+	return b.Iteration.builds.Update(componentType, func(build *Build) error {
+		merged := ParseChecksumsLabel(build.Labels[ChecksumsLabel])
+		for name, digest := range checksums {
+			merged[name] = digest
+		}
+		if build.Labels == nil {
+			build.Labels = make(map[string]string)
+		}
+		build.Labels[ChecksumsLabel] = formatChecksumsLabel(merged)
+		return nil
+	})
+}
+
+// ParseChecksumsLabel returns the checksums of a ChecksumsLabel, by file path or image ID.
+func ParseChecksumsLabel(value string) map[string]string {
+	checksums := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			checksums[kv[0]] = kv[1]
+		}
+	}
+	return checksums
+}
+
+func formatChecksumsLabel(checksums map[string]string) string {
+	pairs := make([]string, 0, len(checksums))
+	for name, digest := range checksums {
+		pairs = append(pairs, name+"="+digest)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
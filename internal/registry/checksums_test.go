@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBucket_UpdateChecksumsForBuild(t *testing.T) {
+	subject := createInitialBucket(t)
+
+	componentName := "happycloud.image"
+	subject.RegisterBuildForComponent(componentName)
+	err := subject.CreateInitialBuildForIteration(context.TODO(), componentName)
+	checkError(t, err)
+
+	err = subject.UpdateChecksumsForBuild(componentName, map[string]string{
+		"output/image.qcow2": "sha256:aaaa",
+		"output/image.vmdk":  "sha256:bbbb",
+	})
+	checkError(t, err)
+	// A post-processor artifact is merged with the builder one.
+	err = subject.UpdateChecksumsForBuild(componentName, map[string]string{
+		"output/image.vmdk":          "sha256:cccc",
+		"registry.example.com/app:1": "sha256:dddd",
+	})
+	checkError(t, err)
+
+	build, ok := subject.Iteration.builds.Get(componentName)
+	if !ok {
+		t.Fatalf("expected a build for %s", componentName)
+	}
+	expected := "output/image.qcow2=sha256:aaaa,output/image.vmdk=sha256:cccc,registry.example.com/app:1=sha256:dddd"
+	if got := build.Labels[ChecksumsLabel]; got != expected {
+		t.Errorf("expected the %s label to be %q, got %q", ChecksumsLabel, expected, got)
+	}
+	if build.Labels["version"] != "1.7.0" {
+		t.Errorf("expected the other labels to be kept, got %v", build.Labels)
+	}
+
+	parsed := ParseChecksumsLabel(build.Labels[ChecksumsLabel])
+	if diff := cmp.Diff(map[string]string{
+		"output/image.qcow2":         "sha256:aaaa",
+		"output/image.vmdk":          "sha256:cccc",
+		"registry.example.com/app:1": "sha256:dddd",
+	}, parsed); diff != "" {
+		t.Errorf("unexpected parsed checksums: %s", diff)
+	}
+
+	for name, digest := range map[string]string{
+		"a,b":   "sha256:aaaa",
+		"a=b":   "sha256:aaaa",
+		"image": "aaaa",
+	} {
+		if err := subject.UpdateChecksumsForBuild(componentName, map[string]string{name: digest}); err == nil {
+			t.Errorf("expected an error for the checksum %q of %q", digest, name)
+		}
+	}
+	if err := subject.UpdateChecksumsForBuild("unknown.image", map[string]string{"a": "sha256:aaaa"}); err == nil {
+		t.Errorf("expected an error for an unknown build")
+	}
+}
@@ -1,15 +1,22 @@
 package registry
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/hcp-sdk-go/auth"
 	packerSvc "github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/client/packer_service"
 	organizationSvc "github.com/hashicorp/hcp-sdk-go/clients/cloud-resource-manager/preview/2019-12-10/client/organization_service"
 	projectSvc "github.com/hashicorp/hcp-sdk-go/clients/cloud-resource-manager/preview/2019-12-10/client/project_service"
 	rmmodels "github.com/hashicorp/hcp-sdk-go/clients/cloud-resource-manager/preview/2019-12-10/models"
 	"github.com/hashicorp/hcp-sdk-go/httpclient"
+	sdkversion "github.com/hashicorp/hcp-sdk-go/version"
 	"github.com/hashicorp/packer/internal/registry/env"
 	"github.com/hashicorp/packer/version"
+	"golang.org/x/oauth2"
 )
 
 // Client is an HCP client capable of making requests on behalf of a service principal
@@ -23,22 +30,47 @@ type Client struct {
 
 	// ProjectID  is the project unique identifier on HCP.
 	ProjectID string
+
+	// Audit, when set, records every mutation made to the registry.
+	Audit *AuditLog
 }
 
-// NewClient returns an authenticated client to a HCP Packer Registry.
-// Client authentication requires the following environment variables be set HCP_CLIENT_ID and HCP_CLIENT_SECRET.
+// NewClient returns an authenticated client to a HCP Packer Registry, configured from the environment, see
+// ClientConfigFromEnv.
+// Client authentication requires either the HCP_CLIENT_ID and HCP_CLIENT_SECRET environment variables, or a workload
+// identity provider set with HCP_WORKLOAD_IDENTITY_PROVIDER along with an OIDC token source; see env.HasWorkloadIdentity.
 // Upon error a HCPClientError will be returned.
 func NewClient() (*Client, error) {
-	if !env.HasHCPCredentials() {
+	cfg, err := ClientConfigFromEnv()
+	if err != nil {
 		return nil, &ClientError{
 			StatusCode: InvalidClientConfig,
-			Err:        fmt.Errorf("the client authentication requires both %s and %s environment variables to be set", env.HCPClientID, env.HCPClientSecret),
+			Err:        err,
 		}
 	}
+	return NewClientWithConfig(cfg)
+}
 
-	cl, err := httpclient.New(httpclient.Config{
-		SourceChannel: fmt.Sprintf("packer/%s", version.PackerVersion.FormattedVersion()),
-	})
+// NewClientWithConfig returns an authenticated client to a HCP Packer Registry configured with cfg only, regardless of
+// the environment, so that clients with different configurations can be used in the same process.
+// Upon error a HCPClientError will be returned.
+func NewClientWithConfig(cfg ClientConfig) (*Client, error) {
+	cfg.canonicalize()
+
+	var hc *http.Client
+	var err error
+	switch {
+	case cfg.WorkloadIdentityProvider != "":
+		hc, err = newWorkloadIdentityHTTPClient(cfg)
+	case cfg.ClientID != "" && cfg.ClientSecret != "":
+		hc, err = newClientCredentialsHTTPClient(cfg)
+	default:
+		return nil, &ClientError{
+			StatusCode: InvalidClientConfig,
+			Err: fmt.Errorf("the client authentication requires either both %s and %s environment variables to be set, or a workload identity provider set with %s",
+				env.HCPClientID, env.HCPClientSecret, env.HCPWorkloadIdentityProvider),
+		}
+	}
 	if err != nil {
 		return nil, &ClientError{
 			StatusCode: InvalidClientConfig,
@@ -46,10 +78,19 @@ func NewClient() (*Client, error) {
 		}
 	}
 
+	if cfg.AuditLog != nil {
+		hc.Transport = &requestIDRoundTripper{RoundTripper: hc.Transport}
+	}
+	if cfg.DebugCapture != nil {
+		hc.Transport = cfg.DebugCapture.RoundTripper(hc.Transport)
+	}
+	cl := httptransport.NewWithClient(cfg.APIHost, "", []string{"https"}, hc)
+
 	client := &Client{
 		Packer:       packerSvc.New(cl, nil),
 		Organization: organizationSvc.New(cl, nil),
 		Project:      projectSvc.New(cl, nil),
+		Audit:        cfg.AuditLog,
 	}
 
 	if err := client.loadOrganizationID(); err != nil {
@@ -99,3 +140,70 @@ func (c *Client) loadProjectID() error {
 	c.ProjectID = listProjResp.Payload.Projects[0].ID
 	return nil
 }
+
+func sourceChannel() string {
+	return fmt.Sprintf("packer/%s", version.PackerVersion.FormattedVersion())
+}
+
+// newClientCredentialsHTTPClient returns an HTTP client authenticated with
+// the credentials of the service principal of cfg, like the clients created
+// with httpclient.New.
+func newClientCredentialsHTTPClient(cfg ClientConfig) (*http.Client, error) {
+	// All the fields are set, so that the HCP SDK does not read them from the
+	// environment.
+	hcpCfg := httpclient.Config{
+		HostPath:     cfg.APIHost,
+		AuthURL:      cfg.AuthURL,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+	}
+	if err := hcpCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	base := cleanhttp.DefaultPooledClient()
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+
+	client, err := auth.WithClientCredentials(ctx, hcpCfg.ClientID, hcpCfg.ClientSecret, hcpCfg.AuthURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain credentials: %w", err)
+	}
+	client.Transport = &sourceChannelRoundTripper{
+		RoundTripper:  client.Transport,
+		SourceChannel: fmt.Sprintf("%s hcp-go-sdk/%s", sourceChannel(), sdkversion.Version),
+	}
+	return client, nil
+}
+
+// newWorkloadIdentityHTTPClient returns an HTTP client authenticated with
+// access tokens obtained by exchanging the OIDC token of the current workload
+// through the workload identity provider of cfg. Tokens are exchanged again
+// once expired.
+func newWorkloadIdentityHTTPClient(cfg ClientConfig) (*http.Client, error) {
+	if cfg.WorkloadIdentityToken == nil {
+		return nil, fmt.Errorf("failed to configure workload identity: no workload identity token source")
+	}
+
+	base := cleanhttp.DefaultPooledClient()
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+
+	ts := newWorkloadIdentityTokenSource(ctx, cfg.APIHost, cfg.WorkloadIdentityProvider, cfg.WorkloadIdentityToken, base)
+	client := oauth2.NewClient(ctx, ts)
+	client.Transport = &sourceChannelRoundTripper{
+		RoundTripper:  client.Transport,
+		SourceChannel: fmt.Sprintf("%s hcp-go-sdk/%s", sourceChannel(), sdkversion.Version),
+	}
+	return client, nil
+}
+
+// sourceChannelRoundTripper sets the X-HCP-Source-Channel header, like the
+// clients created with httpclient.New.
+type sourceChannelRoundTripper struct {
+	http.RoundTripper
+	SourceChannel string
+}
+
+func (rt *sourceChannelRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-HCP-Source-Channel", rt.SourceChannel)
+	return rt.RoundTripper.RoundTrip(req)
+}
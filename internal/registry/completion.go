@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// RequiredBuildsLabel lists, comma separated, the builds required for the iteration to be complete when only some of
+// its builds are, see Bucket.RequiredBuilds. Like the iteration labels, it is set on every build of the iteration.
+const RequiredBuildsLabel = "packer_required_builds"
+
+// checkRequiredBuilds verifies that the RequiredBuilds of b are registered, to catch misspelled component types. It
+// must be called before a partial run restricts the expected builds, see applyPartialRun.
+func (b *Bucket) checkRequiredBuilds() error {
+	var unknown []string
+	for _, name := range b.RequiredBuilds {
+		registered := false
+		for _, expected := range b.Iteration.expectedBuilds {
+			if expected == name {
+				registered = true
+				break
+			}
+		}
+		if !registered {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("the required builds %s of bucket %q are not builds of the template, expected some of %s",
+			strings.Join(unknown, ", "), b.Slug, strings.Join(b.Iteration.expectedBuilds, ", "))
+	}
+	return nil
+}
+
+// requiredBuilds returns the expected builds required for the iteration to be complete: the ones in RequiredBuilds, or
+// all of them when RequiredBuilds is empty or when none of them is expected, like in a scoped partial run.
+func (b *Bucket) requiredBuilds() []string {
+	var required []string
+	for _, expected := range b.Iteration.expectedBuilds {
+		for _, name := range b.RequiredBuilds {
+			if name == expected {
+				required = append(required, expected)
+				break
+			}
+		}
+	}
+	if len(required) == 0 {
+		return b.Iteration.expectedBuilds
+	}
+	return required
+}
+
+// IsRequiredBuildForComponent tells whether the build of the component referenced by buildName is required for the
+// iteration to be complete. The builds that are not are optional: the iteration can be complete without them.
+func (b *Bucket) IsRequiredBuildForComponent(buildName string) bool {
+	for _, name := range b.requiredBuilds() {
+		if name == buildName {
+			return true
+		}
+	}
+	return false
+}
+
+// IterationCompletion tells whether the iteration is complete, all its required builds being DONE, and returns the
+// required builds that are not, sorted. The optional builds are not taken into account. The iteration is only
+// complete on the HCP Packer registry once all its builds are DONE, optional or not.
+func (b *Bucket) IterationCompletion() (bool, []string) {
+	var missing []string
+	for _, name := range b.requiredBuilds() {
+		build, ok := b.Iteration.builds.Get(name)
+		if !ok || build.Status != models.HashicorpCloudPackerBuildStatusDONE {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return len(missing) == 0, missing
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+func TestBucket_IterationCompletion(t *testing.T) {
+	b, _ := newPartialRunBucket(t, "")
+	b.RequiredBuilds = []string{"happycloud.windows", "happycloud.image"}
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if got := b.Iteration.Labels[RequiredBuildsLabel]; got != "happycloud.image,happycloud.windows" {
+		t.Errorf("expected the required builds to be labelled, got %q", got)
+	}
+	if b.IsRequiredBuildForComponent("happycloud.arm") {
+		t.Error("expected happycloud.arm to be optional")
+	}
+
+	setStatus := func(name string, status models.HashicorpCloudPackerBuildStatus) {
+		b.Iteration.builds.Store(name, &Build{ID: name + "-build", ComponentType: name, Status: status})
+	}
+	setStatus("happycloud.image", models.HashicorpCloudPackerBuildStatusDONE)
+	setStatus("happycloud.windows", models.HashicorpCloudPackerBuildStatusFAILED)
+	setStatus("happycloud.arm", models.HashicorpCloudPackerBuildStatusFAILED)
+
+	complete, missing := b.IterationCompletion()
+	if complete {
+		t.Error("expected the iteration not to be complete")
+	}
+	if diff := cmp.Diff([]string{"happycloud.windows"}, missing); diff != "" {
+		t.Errorf("unexpected missing builds: %s", diff)
+	}
+
+	// The optional build failing does not matter.
+	setStatus("happycloud.windows", models.HashicorpCloudPackerBuildStatusDONE)
+	if complete, missing := b.IterationCompletion(); !complete {
+		t.Errorf("expected the iteration to be complete, missing %v", missing)
+	}
+}
+
+func TestBucket_IterationCompletion_allRequired(t *testing.T) {
+	b, _ := newPartialRunBucket(t, "")
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if _, ok := b.Iteration.Labels[RequiredBuildsLabel]; ok {
+		t.Error("expected no required builds label when all builds are required")
+	}
+
+	complete, missing := b.IterationCompletion()
+	if complete {
+		t.Error("expected the iteration not to be complete")
+	}
+	expected := []string{"happycloud.arm", "happycloud.image", "happycloud.windows"}
+	if diff := cmp.Diff(expected, missing); diff != "" {
+		t.Errorf("unexpected missing builds: %s", diff)
+	}
+}
+
+func TestBucket_IterationCompletion_scoped(t *testing.T) {
+	b, _ := newPartialRunBucket(t, PartialRunScoped)
+	b.RequiredBuilds = []string{"happycloud.image"}
+	b.SelectBuildForComponent("happycloud.arm")
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	// None of the builds of the scoped iteration is required, so all are.
+	if !b.IsRequiredBuildForComponent("happycloud.arm") {
+		t.Error("expected happycloud.arm to be required in its scoped iteration")
+	}
+}
+
+func TestBucket_Initialize_unknownRequiredBuild(t *testing.T) {
+	b, _ := newPartialRunBucket(t, "")
+	b.RequiredBuilds = []string{"happycloud.image", "happycloud.imag"}
+	err := b.Initialize(context.TODO())
+	if err == nil || !strings.Contains(err.Error(), "happycloud.imag ") {
+		t.Fatalf("expected the unknown required build to be reported, got %v", err)
+	}
+}
+
+func TestBucket_completedIterationPayload_optionalBuilds(t *testing.T) {
+	b, _ := newPartialRunBucket(t, "")
+	b.RequiredBuilds = []string{"happycloud.image"}
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	b.Iteration.builds.Store("happycloud.image", &Build{ComponentType: "happycloud.image",
+		Status: models.HashicorpCloudPackerBuildStatusDONE})
+	b.Iteration.builds.Store("happycloud.windows", &Build{ComponentType: "happycloud.windows",
+		Status: models.HashicorpCloudPackerBuildStatusRUNNING})
+
+	payload, complete := b.completedIterationPayload()
+	if !complete {
+		t.Fatal("expected the iteration to be complete once its required builds are done")
+	}
+	if len(payload.Builds) != 1 || payload.Builds[0].ComponentType != "happycloud.image" {
+		t.Errorf("expected only the builds done in the payload, got %#v", payload.Builds)
+	}
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// The intervals between two listings of the builds of an iteration while waiting for concurrent builds, see
+// waitForConcurrentBuilds. The interval doubles after each listing, up to the maximum.
+var (
+	concurrentBuildsPollInterval    = 10 * time.Second
+	concurrentBuildsMaxPollInterval = 2 * time.Minute
+)
+
+// waitForConcurrentBuilds lists the builds of the iteration until none of the expected builds is being run by another
+// Packer run, so that the builds that run completes are not run again by this one. It returns the last listing of the
+// builds; when ConcurrentBuildsWait elapses first, the builds still running are run again by this run.
+func (b *Bucket) waitForConcurrentBuilds(ctx context.Context, builds []*models.HashicorpCloudPackerBuild) ([]*models.HashicorpCloudPackerBuild, error) {
+	deadline := time.Now().Add(b.ConcurrentBuildsWait)
+	interval := concurrentBuildsPollInterval
+	for {
+		running := b.concurrentBuilds(builds)
+		if len(running) == 0 {
+			return builds, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			log.Printf("[WARN] builds %v of iteration %s are still running in another Packer run after %s; running them again",
+				running, b.Iteration.ID, b.ConcurrentBuildsWait)
+			return builds, nil
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		log.Printf("[INFO] waiting %s for builds %v of iteration %s running in another Packer run", interval, running, b.Iteration.ID)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		listed, err := b.client.ListBuilds(ctx, b.Slug, b.Iteration.ID)
+		if err != nil {
+			return nil, err
+		}
+		builds = listed
+
+		interval *= 2
+		if interval > concurrentBuildsMaxPollInterval {
+			interval = concurrentBuildsMaxPollInterval
+		}
+	}
+}
+
+// concurrentBuilds returns the component types of the expected builds of the iteration that another Packer run is
+// running.
+func (b *Bucket) concurrentBuilds(builds []*models.HashicorpCloudPackerBuild) []string {
+	var running []string
+	for _, build := range builds {
+		if build.Status != models.HashicorpCloudPackerBuildStatusRUNNING {
+			continue
+		}
+		if build.PackerRunUUID != "" && build.PackerRunUUID == b.Iteration.RunUUID {
+			continue
+		}
+		for _, expected := range b.Iteration.expectedBuilds {
+			if expected == build.ComponentType {
+				running = append(running, build.ComponentType)
+				break
+			}
+		}
+	}
+	return running
+}
+
+// checkIterationLock fails when another Packer run is running some of the expected builds of the iteration: with
+// LockIteration, the iteration is locked by the runs of its builds, so that two runs of the same template and
+// fingerprint do not race to publish conflicting builds.
+func (b *Bucket) checkIterationLock(builds []*models.HashicorpCloudPackerBuild) error {
+	running := b.concurrentBuilds(builds)
+	if len(running) == 0 {
+		return nil
+	}
+	runs := map[string]bool{}
+	for _, build := range builds {
+		for _, name := range running {
+			if build.ComponentType == name && build.PackerRunUUID != "" {
+				runs[build.PackerRunUUID] = true
+			}
+		}
+	}
+	var runUUIDs []string
+	for runUUID := range runs {
+		runUUIDs = append(runUUIDs, runUUID)
+	}
+	sort.Strings(runUUIDs)
+	holder := "another Packer run"
+	if len(runUUIDs) > 0 {
+		holder = fmt.Sprintf("the Packer run %s", strings.Join(runUUIDs, ", "))
+	}
+	return fmt.Errorf("iteration %s of bucket %q is locked: its builds %s are being run by %s. "+
+		"Wait for them to complete, or mark them as cancelled if that run crashed.",
+		b.Iteration.ID, b.Slug, strings.Join(running, ", "), holder)
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestBucket_PopulateIteration_waitsForConcurrentBuilds(t *testing.T) {
+	defer func(interval, max time.Duration) {
+		concurrentBuildsPollInterval, concurrentBuildsMaxPollInterval = interval, max
+	}(concurrentBuildsPollInterval, concurrentBuildsMaxPollInterval)
+	concurrentBuildsPollInterval, concurrentBuildsMaxPollInterval = time.Millisecond, 2*time.Millisecond
+
+	running := models.HashicorpCloudPackerBuildStatusRUNNING
+	done := models.HashicorpCloudPackerBuildStatusDONE
+	tests := []struct {
+		name           string
+		wait           time.Duration
+		statuses       []models.HashicorpCloudPackerBuildStatus
+		expectedStatus models.HashicorpCloudPackerBuildStatus
+		expectedLists  int
+	}{
+		{"not waiting", 0, []models.HashicorpCloudPackerBuildStatus{running, done}, running, 1},
+		{"build done", time.Minute, []models.HashicorpCloudPackerBuildStatus{done}, done, 1},
+		{"build completed while waiting", time.Minute, []models.HashicorpCloudPackerBuildStatus{running, running, done}, done, 3},
+		{"build still running", 20 * time.Millisecond, []models.HashicorpCloudPackerBuildStatus{running}, running, -1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := registrytest.NewMockPackerClientService()
+			mockService.ExistingBuilds = []string{"happycloud.image"}
+			mockService.ExistingBuildStatuses = map[string][]models.HashicorpCloudPackerBuildStatus{
+				"happycloud.image": tt.statuses,
+			}
+
+			subject := createInitialBucket(t)
+			subject.client = &Client{Packer: mockService}
+			subject.Iteration.ID = "iteration-id"
+			subject.Iteration.RunUUID = "this-run"
+			subject.ConcurrentBuildsWait = tt.wait
+			subject.RegisterBuildForComponent("happycloud.image")
+
+			if err := subject.PopulateIteration(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			build, ok := subject.Iteration.builds.Get("happycloud.image")
+			if !ok {
+				t.Fatal("expected the build to be tracked")
+			}
+			if build.Status != tt.expectedStatus {
+				t.Errorf("expected the build to be %s, got %s", tt.expectedStatus, build.Status)
+			}
+			if tt.expectedLists > 0 && mockService.ListBuildsCount != tt.expectedLists {
+				t.Errorf("expected %d listings of the builds, got %d", tt.expectedLists, mockService.ListBuildsCount)
+			}
+			if tt.expectedLists < 0 && mockService.ListBuildsCount < 2 {
+				t.Errorf("expected the builds to be listed again while waiting, got %d listings", mockService.ListBuildsCount)
+			}
+			if build.Status == done && subject.IsExpectingBuildForComponent("happycloud.image") {
+				t.Errorf("didn't expect the build completed by the other run to be run again")
+			}
+		})
+	}
+}
+
+func TestBucket_PopulateIteration_concurrentBuildsCancelled(t *testing.T) {
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.ExistingBuilds = []string{"happycloud.image"}
+	mockService.ExistingBuildStatuses = map[string][]models.HashicorpCloudPackerBuildStatus{
+		"happycloud.image": {models.HashicorpCloudPackerBuildStatusRUNNING},
+	}
+
+	subject := createInitialBucket(t)
+	subject.client = &Client{Packer: mockService}
+	subject.Iteration.ID = "iteration-id"
+	subject.ConcurrentBuildsWait = time.Hour
+	subject.RegisterBuildForComponent("happycloud.image")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := subject.PopulateIteration(ctx); err == nil {
+		t.Fatal("expected waiting for the concurrent builds to be cancelled")
+	}
+}
+
+func TestBucket_PopulateIteration_lockIteration(t *testing.T) {
+	running := models.HashicorpCloudPackerBuildStatusRUNNING
+	done := models.HashicorpCloudPackerBuildStatusDONE
+	tests := []struct {
+		name        string
+		statuses    []models.HashicorpCloudPackerBuildStatus
+		wait        time.Duration
+		expectError bool
+	}{
+		{"build running", []models.HashicorpCloudPackerBuildStatus{running}, 0, true},
+		{"build done", []models.HashicorpCloudPackerBuildStatus{done}, 0, false},
+		{"build completed while waiting", []models.HashicorpCloudPackerBuildStatus{running, done}, time.Minute, false},
+	}
+	defer func(interval, max time.Duration) {
+		concurrentBuildsPollInterval, concurrentBuildsMaxPollInterval = interval, max
+	}(concurrentBuildsPollInterval, concurrentBuildsMaxPollInterval)
+	concurrentBuildsPollInterval, concurrentBuildsMaxPollInterval = time.Millisecond, 2*time.Millisecond
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := registrytest.NewMockPackerClientService()
+			mockService.ExistingBuilds = []string{"happycloud.image"}
+			mockService.ExistingBuildStatuses = map[string][]models.HashicorpCloudPackerBuildStatus{
+				"happycloud.image": tt.statuses,
+			}
+
+			subject := createInitialBucket(t)
+			subject.client = &Client{Packer: mockService}
+			subject.Iteration.ID = "iteration-id"
+			subject.Iteration.RunUUID = "this-run"
+			subject.ConcurrentBuildsWait = tt.wait
+			subject.LockIteration = true
+			subject.RegisterBuildForComponent("happycloud.image")
+
+			err := subject.PopulateIteration(context.Background())
+			if tt.expectError {
+				if err == nil || !strings.Contains(err.Error(), "is locked") {
+					t.Fatalf("expected the iteration to be locked, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"os"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/packer/internal/registry/env"
+)
+
+const (
+	// DefaultAPIHost is the host of the HCP API used when none is configured.
+	DefaultAPIHost = "api.cloud.hashicorp.com"
+	// DefaultAuthURL is the URL of the HCP authentication endpoint used when none is configured.
+	DefaultAuthURL = "https://auth.hashicorp.com"
+)
+
+// ClientConfig is the configuration of a Client to the HCP Packer registry. It is read by NewClientWithConfig only:
+// unlike NewClient, nothing is read from the environment, so that builds configured differently can run concurrently
+// in the same process. Unset fields take their default value.
+type ClientConfig struct {
+	// ClientID and ClientSecret are the credentials of the HCP service principal to authenticate with.
+	ClientID     string
+	ClientSecret string
+
+	// WorkloadIdentityProvider is the resource name of the HCP workload identity provider to exchange the tokens
+	// returned by WorkloadIdentityToken with. When set, it takes precedence over ClientID and ClientSecret.
+	WorkloadIdentityProvider string
+	WorkloadIdentityToken    SubjectTokenFunc
+
+	// APIHost is the host of the HCP API, without scheme; DefaultAPIHost when unset.
+	APIHost string
+	// AuthURL is the URL of the HCP authentication endpoint; DefaultAuthURL when unset.
+	AuthURL string
+
+	// AuditLog, when set, records every mutation made to the registry.
+	AuditLog *AuditLog
+	// DebugCapture, when set, writes a redacted transcript of every request sent to the HCP API.
+	DebugCapture *DebugCapture
+}
+
+// ClientConfigFromEnv returns the configuration of a Client read from the environment: the HCP_CLIENT_ID and
+// HCP_CLIENT_SECRET credentials or the HCP_WORKLOAD_IDENTITY_* settings, the HCP_API_HOST and HCP_AUTH_URL endpoints,
+// HCP_PACKER_AUDIT_LOG and PACKER_HCP_DEBUG.
+func ClientConfigFromEnv() (ClientConfig, error) {
+	cfg := ClientConfig{
+		APIHost:  os.Getenv("HCP_API_HOST"),
+		AuthURL:  os.Getenv("HCP_AUTH_URL"),
+		AuditLog: NewAuditLogFromEnv(),
+	}
+
+	switch {
+	case env.HasWorkloadIdentity():
+		subjectToken, err := subjectTokenFromEnv(cleanhttp.DefaultPooledClient())
+		if err != nil {
+			return ClientConfig{}, err
+		}
+		cfg.WorkloadIdentityProvider = os.Getenv(env.HCPWorkloadIdentityProvider)
+		cfg.WorkloadIdentityToken = subjectToken
+	case env.HasHCPCredentials():
+		cfg.ClientID = os.Getenv(env.HCPClientID)
+		cfg.ClientSecret = os.Getenv(env.HCPClientSecret)
+	}
+
+	capture, err := NewDebugCaptureFromEnv()
+	if err != nil {
+		return ClientConfig{}, err
+	}
+	cfg.DebugCapture = capture
+
+	return cfg, nil
+}
+
+// canonicalize sets the default value of the unset endpoints.
+func (cfg *ClientConfig) canonicalize() {
+	if cfg.APIHost == "" {
+		cfg.APIHost = DefaultAPIHost
+	}
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = DefaultAuthURL
+	}
+}
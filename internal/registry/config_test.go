@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/packer/internal/registry/env"
+)
+
+func TestClientConfigFromEnv(t *testing.T) {
+	t.Setenv(env.HCPClientID, "env-id")
+	t.Setenv(env.HCPClientSecret, "env-secret")
+	t.Setenv("HCP_API_HOST", "api.example.com")
+	t.Setenv(env.HCPWorkloadIdentityProvider, "")
+	t.Setenv(env.HCPPackerAuditLog, "")
+
+	cfg, err := ClientConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.ClientID != "env-id" || cfg.ClientSecret != "env-secret" {
+		t.Errorf("unexpected credentials %q/%q", cfg.ClientID, cfg.ClientSecret)
+	}
+	if cfg.APIHost != "api.example.com" || cfg.AuthURL != "" {
+		t.Errorf("unexpected endpoints %q, %q", cfg.APIHost, cfg.AuthURL)
+	}
+	if cfg.WorkloadIdentityProvider != "" || cfg.AuditLog != nil || cfg.DebugCapture != nil {
+		t.Errorf("unexpected config %#v", cfg)
+	}
+}
+
+func TestClientConfig_canonicalize(t *testing.T) {
+	// The environment is never read by a ClientConfig.
+	t.Setenv("HCP_API_HOST", "api.example.com")
+	t.Setenv("HCP_AUTH_URL", "https://auth.example.com")
+
+	cfg := ClientConfig{}
+	cfg.canonicalize()
+	if cfg.APIHost != DefaultAPIHost || cfg.AuthURL != DefaultAuthURL {
+		t.Errorf("expected the default endpoints, got %q, %q", cfg.APIHost, cfg.AuthURL)
+	}
+
+	cfg = ClientConfig{APIHost: "api.internal", AuthURL: "https://auth.internal"}
+	cfg.canonicalize()
+	if cfg.APIHost != "api.internal" || cfg.AuthURL != "https://auth.internal" {
+		t.Errorf("expected the configured endpoints, got %q, %q", cfg.APIHost, cfg.AuthURL)
+	}
+}
+
+func TestNewClientWithConfig_invalid(t *testing.T) {
+	// Credentials in the environment are ignored.
+	t.Setenv(env.HCPClientID, "env-id")
+	t.Setenv(env.HCPClientSecret, "env-secret")
+
+	tests := []struct {
+		name string
+		cfg  ClientConfig
+	}{
+		{"no credentials", ClientConfig{}},
+		{"client id only", ClientConfig{ClientID: "id"}},
+		{"workload identity without token", ClientConfig{WorkloadIdentityProvider: "iam/project/p/service-principal/sp/workload-identity-provider/wip"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClientWithConfig(tt.cfg)
+			var clientErr *ClientError
+			if !errors.As(err, &clientErr) || clientErr.StatusCode != InvalidClientConfig {
+				t.Fatalf("expected an InvalidClientConfig error, got %v", err)
+			}
+		})
+	}
+}
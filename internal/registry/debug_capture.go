@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/packer/internal/registry/env"
+)
+
+// DebugCaptureMode is the value of PACKER_HCP_DEBUG enabling the DebugCapture.
+const DebugCaptureMode = "capture"
+
+// DefaultDebugCaptureDir is where the transcripts are written unless PACKER_HCP_DEBUG_DIR is set.
+const DefaultDebugCaptureDir = "packer_hcp_debug"
+
+// redactedValue replaces the sensitive values in the transcripts.
+const redactedValue = "REDACTED"
+
+// sensitiveName matches the names of the headers, query parameters and JSON fields whose values are redacted.
+var sensitiveName = regexp.MustCompile(`(?i)authorization|cookie|secret|token|password|credential|private_?key|api_?key|signature`)
+
+// DebugCapture writes a transcript of every request sent to the HCP API, along with its response, to a directory,
+// one JSON file per request. Credentials are redacted, so that the transcripts can be shared to diagnose
+// serialization issues without setting up a proxy.
+type DebugCapture struct {
+	Dir string
+
+	seq uint64
+}
+
+// NewDebugCaptureFromEnv returns the capture enabled with PACKER_HCP_DEBUG=capture, creating its directory, or nil
+// when capturing is not enabled.
+func NewDebugCaptureFromEnv() (*DebugCapture, error) {
+	mode := os.Getenv(env.HCPDebug)
+	if mode == "" {
+		return nil, nil
+	}
+	if mode != DebugCaptureMode {
+		return nil, fmt.Errorf("invalid %s %q, the only mode is %q", env.HCPDebug, mode, DebugCaptureMode)
+	}
+
+	dir := os.Getenv(env.HCPDebugDir)
+	if dir == "" {
+		dir = DefaultDebugCaptureDir
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the HCP debug capture directory: %w", err)
+	}
+	log.Printf("[INFO] capturing the HCP API requests to %s", dir)
+	return &DebugCapture{Dir: dir}, nil
+}
+
+// RoundTripper returns a RoundTripper capturing the requests sent through next.
+func (c *DebugCapture) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &captureRoundTripper{RoundTripper: next, capture: c}
+}
+
+// debugExchange is a captured request and its response.
+type debugExchange struct {
+	Time       time.Time     `json:"time"`
+	DurationMS int64         `json:"duration_ms"`
+	Request    debugMessage  `json:"request"`
+	Response   *debugMessage `json:"response,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type debugMessage struct {
+	Method  string              `json:"method,omitempty"`
+	URL     string              `json:"url,omitempty"`
+	Status  string              `json:"status,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	// Body is the JSON body as is, or else a string.
+	Body interface{} `json:"body,omitempty"`
+}
+
+type captureRoundTripper struct {
+	http.RoundTripper
+	capture *DebugCapture
+}
+
+func (rt *captureRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := debugExchange{
+		Time: time.Now().UTC(),
+		Request: debugMessage{
+			Method:  req.Method,
+			URL:     redactURL(req.URL),
+			Headers: redactHeaders(req.Header),
+		},
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		exchange.Request.Body = redactBody(body, req.Header.Get("Content-Type"))
+	}
+
+	resp, err := rt.RoundTripper.RoundTrip(req)
+	exchange.DurationMS = time.Since(exchange.Time).Milliseconds()
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	if resp != nil {
+		exchange.Response = &debugMessage{
+			Status:  resp.Status,
+			Headers: redactHeaders(resp.Header),
+		}
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			exchange.Error = readErr.Error()
+		} else {
+			exchange.Response.Body = redactBody(body, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	// A transcript that cannot be written does not fail the request.
+	if writeErr := rt.capture.write(req, exchange); writeErr != nil {
+		log.Printf("[WARN] failed to capture the HCP API request %s %s: %s", req.Method, req.URL.Path, writeErr)
+	}
+	return resp, err
+}
+
+// nonFileNameChars are replaced in the names of the transcript files.
+var nonFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (c *DebugCapture) write(req *http.Request, exchange debugExchange) error {
+	seq := atomic.AddUint64(&c.seq, 1)
+	path := strings.Trim(nonFileNameChars.ReplaceAllString(req.URL.Path, "_"), "_")
+	if len(path) > 100 {
+		path = path[len(path)-100:]
+	}
+	name := fmt.Sprintf("%04d-%s-%s.json", seq, req.Method, path)
+
+	content, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, name), append(content, '\n'), 0600)
+}
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	query := redacted.Query()
+	for name := range query {
+		if sensitiveName.MatchString(name) {
+			query[name] = []string{redactedValue}
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+func redactHeaders(headers http.Header) map[string][]string {
+	res := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		if sensitiveName.MatchString(name) {
+			res[name] = []string{redactedValue}
+			continue
+		}
+		res[name] = values
+	}
+	return res
+}
+
+// redactBody returns the body as JSON with its sensitive fields redacted, or as a string when it is not JSON. Form
+// encoded bodies, like OAuth token requests, get their sensitive fields redacted too.
+func redactBody(body []byte, contentType string) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		return redactJSON(value)
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return redactedValue
+		}
+		for name := range form {
+			if sensitiveName.MatchString(name) {
+				form[name] = []string{redactedValue}
+			}
+		}
+		return form.Encode()
+	}
+	return string(body)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if sensitiveName.MatchString(k) {
+				v[k] = redactedValue
+				continue
+			}
+			v[k] = redactJSON(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	}
+	return value
+}
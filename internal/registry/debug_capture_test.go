@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer/internal/registry/env"
+)
+
+func TestDebugCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "s3cr3t") {
+			t.Errorf("expected the request to be sent as is, got %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Write([]byte(`{"bucket": {"slug": "app", "webhook": {"secret": "whsec"}}}`))
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "capture")
+	t.Setenv(env.HCPDebug, DebugCaptureMode)
+	t.Setenv(env.HCPDebugDir, dir)
+	capture, err := NewDebugCaptureFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	client := &http.Client{Transport: capture.RoundTripper(nil)}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/packer/buckets?access_token=tok&page=2",
+		strings.NewReader(`{"slug": "app", "client_secret": "s3cr3t", "labels": [{"api_key": "k"}]}`))
+	req.Header.Set("Authorization", "Bearer tok")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "whsec") {
+		t.Errorf("expected the response to be returned as is, got %s", body)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one transcript, got %v (%v)", files, err)
+	}
+	if got := filepath.Base(files[0]); got != "0001-POST-packer_buckets.json" {
+		t.Errorf("unexpected transcript name %q", got)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cr3t", "Bearer", "tok&", "whsec", "session=abc", `"k"`} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("expected %q to be redacted from the transcript:\n%s", secret, content)
+		}
+	}
+
+	var exchange debugExchange
+	if err := json.Unmarshal(content, &exchange); err != nil {
+		t.Fatalf("invalid transcript: %s", err)
+	}
+	expectedRequest := map[string]interface{}{
+		"slug":          "app",
+		"client_secret": redactedValue,
+		"labels":        []interface{}{map[string]interface{}{"api_key": redactedValue}},
+	}
+	if diff := cmp.Diff(expectedRequest, exchange.Request.Body); diff != "" {
+		t.Errorf("unexpected request body: %s", diff)
+	}
+	if !strings.HasSuffix(exchange.Request.URL, "/packer/buckets?access_token=REDACTED&page=2") {
+		t.Errorf("unexpected request URL %q", exchange.Request.URL)
+	}
+	if exchange.Response == nil || exchange.Response.Status != "200 OK" {
+		t.Errorf("expected the response to be captured, got %#v", exchange.Response)
+	}
+}
+
+func TestNewDebugCaptureFromEnv(t *testing.T) {
+	t.Setenv(env.HCPDebug, "")
+	if capture, err := NewDebugCaptureFromEnv(); capture != nil || err != nil {
+		t.Errorf("expected no capture by default, got %v, %v", capture, err)
+	}
+	t.Setenv(env.HCPDebug, "verbose")
+	if _, err := NewDebugCaptureFromEnv(); err == nil {
+		t.Errorf("expected an unknown mode to fail")
+	}
+}
@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// DeprecateOptions configures which iterations of a bucket are considered
+// superseded, and how they get deprecated.
+type DeprecateOptions struct {
+	// IterationID is the iteration superseding older ones. When empty, the
+	// most recent complete iteration of the bucket is used.
+	IterationID string
+	// Keep is the number of complete iterations, preceding IterationID, to
+	// leave untouched.
+	Keep int
+	// RevokeIn is the delay after which deprecated iterations will be
+	// revoked, for example "30d". Defaults to "0s", meaning right away.
+	RevokeIn string
+	// Message explains why the iterations are deprecated.
+	Message string
+	// DryRun only computes the iterations to deprecate without revoking them.
+	DryRun bool
+	// Confirm, when set, is called with the iterations about to be
+	// deprecated before any of them is revoked. Returning an error aborts the
+	// deprecation.
+	Confirm func([]*models.HashicorpCloudPackerIterationforList) error
+}
+
+// DeprecatePreviousIterations revokes every complete iteration of bucketSlug
+// that was created before the iteration referenced in opts. Iterations that
+// are incomplete, or that are already revoked or scheduled for revocation are
+// skipped. The iterations that were, or in dry-run mode would have been,
+// deprecated are returned.
+func (client *Client) DeprecatePreviousIterations(ctx context.Context, bucketSlug string, opts DeprecateOptions) ([]*models.HashicorpCloudPackerIterationforList, error) {
+	iterations, err := client.ListIterations(ctx, bucketSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list iterations for bucket %q: %w", bucketSlug, err)
+	}
+
+	toDeprecate, err := supersededIterations(iterations, opts.IterationID, opts.Keep)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun || len(toDeprecate) == 0 {
+		return toDeprecate, nil
+	}
+
+	if opts.Confirm != nil {
+		if err := opts.Confirm(toDeprecate); err != nil {
+			return nil, err
+		}
+	}
+
+	revokeIn := opts.RevokeIn
+	if revokeIn == "" {
+		revokeIn = "0s"
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = "superseded by a more recent iteration"
+	}
+
+	for i, iteration := range toDeprecate {
+		log.Printf("[TRACE] deprecating iteration %q of bucket %q", iteration.ID, bucketSlug)
+		if err := client.RevokeIteration(ctx, bucketSlug, iteration.ID, revokeIn, message); err != nil {
+			return toDeprecate[:i], fmt.Errorf("failed to deprecate iteration %q: %w", iteration.ID, err)
+		}
+	}
+
+	return toDeprecate, nil
+}
+
+// supersededIterations returns the iterations superseded by the iteration
+// referenced by iterationID, most recent first. The first keep superseded
+// iterations are excluded from the result.
+func supersededIterations(iterations []*models.HashicorpCloudPackerIterationforList, iterationID string, keep int) ([]*models.HashicorpCloudPackerIterationforList, error) {
+	sorted := make([]*models.HashicorpCloudPackerIterationforList, len(iterations))
+	copy(sorted, iterations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return time.Time(sorted[i].CreatedAt).After(time.Time(sorted[j].CreatedAt))
+	})
+
+	current := -1
+	for i, iteration := range sorted {
+		if iterationID == "" && iteration.Complete && isIterationActive(iteration) {
+			current = i
+			break
+		}
+		if iterationID != "" && iteration.ID == iterationID {
+			current = i
+			break
+		}
+	}
+
+	if current == -1 {
+		if iterationID == "" {
+			return nil, fmt.Errorf("no complete iteration found")
+		}
+		return nil, fmt.Errorf("no iteration found with the id %q", iterationID)
+	}
+
+	if !sorted[current].Complete {
+		return nil, fmt.Errorf("the iteration %q is not complete and can not supersede other iterations", sorted[current].ID)
+	}
+
+	var res []*models.HashicorpCloudPackerIterationforList
+	for _, iteration := range sorted[current+1:] {
+		if !iteration.Complete || !isIterationActive(iteration) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		res = append(res, iteration)
+	}
+
+	return res, nil
+}
+
+// isIterationActive returns true when the iteration is neither revoked nor
+// scheduled to be revoked.
+func isIterationActive(iteration *models.HashicorpCloudPackerIterationforList) bool {
+	return time.Time(iteration.RevokeAt).IsZero()
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func testIterationsForList() []*models.HashicorpCloudPackerIterationforList {
+	now := time.Now()
+	at := func(d time.Duration) strfmt.DateTime {
+		return strfmt.DateTime(now.Add(-d))
+	}
+
+	return []*models.HashicorpCloudPackerIterationforList{
+		{ID: "iteration-1", Complete: true, CreatedAt: at(5 * time.Hour)},
+		{ID: "iteration-2", Complete: true, CreatedAt: at(4 * time.Hour), RevokeAt: at(time.Hour)},
+		{ID: "iteration-3", Complete: false, CreatedAt: at(3 * time.Hour)},
+		{ID: "iteration-4", Complete: true, CreatedAt: at(2 * time.Hour)},
+		{ID: "iteration-5", Complete: true, CreatedAt: at(time.Hour)},
+		{ID: "iteration-6", Complete: false, CreatedAt: at(0)},
+	}
+}
+
+func TestSupersededIterations(t *testing.T) {
+	tcs := []struct {
+		name          string
+		iterationID   string
+		keep          int
+		expected      []string
+		errorExpected bool
+	}{
+		{
+			name:     "latest complete iteration",
+			expected: []string{"iteration-4", "iteration-1"},
+		},
+		{
+			name:     "latest complete iteration keeping one",
+			keep:     1,
+			expected: []string{"iteration-1"},
+		},
+		{
+			name:        "specific iteration",
+			iterationID: "iteration-4",
+			expected:    []string{"iteration-1"},
+		},
+		{
+			name:        "oldest iteration",
+			iterationID: "iteration-1",
+			expected:    nil,
+		},
+		{
+			name:          "incomplete iteration",
+			iterationID:   "iteration-6",
+			errorExpected: true,
+		},
+		{
+			name:          "unknown iteration",
+			iterationID:   "iteration-42",
+			errorExpected: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := supersededIterations(testIterationsForList(), tc.iterationID, tc.keep)
+			if tc.errorExpected {
+				if err == nil {
+					t.Fatalf("expected %q to return an error, but it didn't", tc.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+
+			var got []string
+			for _, iteration := range res {
+				got = append(got, iteration.ID)
+			}
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("unexpected superseded iterations: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDeprecatePreviousIterations(t *testing.T) {
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.ExistingIterations = testIterationsForList()
+
+	client := &Client{
+		Packer: mockService,
+	}
+
+	deprecated, err := client.DeprecatePreviousIterations(context.TODO(), "TestBucket", DeprecateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if len(deprecated) != 2 {
+		t.Errorf("expected two iterations to be deprecated, got %d", len(deprecated))
+	}
+	if mockService.UpdateIterationCalled {
+		t.Errorf("didn't expect a call to UpdateIteration in dry-run mode")
+	}
+
+	_, err = client.DeprecatePreviousIterations(context.TODO(), "TestBucket", DeprecateOptions{
+		Confirm: func([]*models.HashicorpCloudPackerIterationforList) error { return errors.New("declined") },
+	})
+	if err == nil {
+		t.Fatalf("expected a declined confirmation to abort the deprecation")
+	}
+	if mockService.UpdateIterationCalled {
+		t.Errorf("didn't expect a call to UpdateIteration once the confirmation is declined")
+	}
+
+	var confirmed []*models.HashicorpCloudPackerIterationforList
+	_, err = client.DeprecatePreviousIterations(context.TODO(), "TestBucket", DeprecateOptions{
+		Confirm: func(iterations []*models.HashicorpCloudPackerIterationforList) error {
+			confirmed = iterations
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if diff := cmp.Diff([]string{"iteration-4", "iteration-1"}, mockService.RevokedIterations); diff != "" {
+		t.Errorf("unexpected revoked iterations: %s", diff)
+	}
+	if len(confirmed) != 2 {
+		t.Errorf("expected two iterations to be confirmed, got %d", len(confirmed))
+	}
+}
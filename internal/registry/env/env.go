@@ -35,6 +35,21 @@ func HasHCPCredentials() bool {
 	return true
 }
 
+// HasWorkloadIdentity returns true when a workload identity provider is
+// configured, along with a source for the OIDC token to exchange.
+func HasWorkloadIdentity() bool {
+	if _, ok := os.LookupEnv(HCPWorkloadIdentityProvider); !ok {
+		return false
+	}
+
+	for _, name := range []string{HCPWorkloadIdentityToken, HCPWorkloadIdentityTokenFile, GitHubActionsIDTokenRequestURL} {
+		if _, ok := os.LookupEnv(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func IsPAREnabled() bool {
 	val, ok := os.LookupEnv(HCPPackerRegistry)
 	return ok && strings.ToLower(val) != "off" && val != "0"
@@ -5,4 +5,31 @@ const (
 	HCPClientSecret   = "HCP_CLIENT_SECRET"
 	HCPPackerRegistry = "HCP_PACKER_REGISTRY"
 	HCPPackerBucket   = "HCP_PACKER_BUCKET_NAME"
+	// HCPPackerAuditLog is the path of a file where every mutation made to
+	// the registry is appended, see registry.AuditLog.
+	HCPPackerAuditLog = "HCP_PACKER_AUDIT_LOG"
+	// HCPDebug set to "capture" writes a redacted transcript of every request
+	// sent to the HCP API to HCPDebugDir, see registry.DebugCapture.
+	HCPDebug = "PACKER_HCP_DEBUG"
+	// HCPDebugDir is where the transcripts are written, packer_hcp_debug in
+	// the current directory by default.
+	HCPDebugDir = "PACKER_HCP_DEBUG_DIR"
+
+	// HCPWorkloadIdentityProvider is the resource name of the HCP workload
+	// identity provider to exchange OIDC tokens with.
+	// Ex: iam/project/<id>/service-principal/<name>/workload-identity-provider/<name>
+	HCPWorkloadIdentityProvider = "HCP_WORKLOAD_IDENTITY_PROVIDER"
+	// HCPWorkloadIdentityToken holds an OIDC token, as exposed by the
+	// id_tokens keyword of GitLab CI for example.
+	HCPWorkloadIdentityToken = "HCP_WORKLOAD_IDENTITY_TOKEN"
+	// HCPWorkloadIdentityTokenFile is the path of a file holding an OIDC
+	// token, it is read again every time the token needs to be refreshed.
+	HCPWorkloadIdentityTokenFile = "HCP_WORKLOAD_IDENTITY_TOKEN_FILE"
+	// HCPWorkloadIdentityAudience is the audience requested to the GitHub
+	// Actions OIDC provider.
+	HCPWorkloadIdentityAudience = "HCP_WORKLOAD_IDENTITY_AUDIENCE"
+
+	// Set by GitHub Actions in jobs granted the id-token: write permission.
+	GitHubActionsIDTokenRequestURL   = "ACTIONS_ID_TOKEN_REQUEST_URL"
+	GitHubActionsIDTokenRequestToken = "ACTIONS_ID_TOKEN_REQUEST_TOKEN"
 )
@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// ExpiresAtLabel records when an iteration expires, as an RFC 3339 date. Like the iteration labels, it is set on every
+// build of the iteration. See Bucket.ExpiresAfter.
+const ExpiresAtLabel = "packer_expires_at"
+
+// expiresAt returns the ExpiresAtLabel of an iteration created at now, expiring after d.
+func expiresAt(now time.Time, d time.Duration) string {
+	return now.Add(d).UTC().Format(time.RFC3339)
+}
+
+// ExpiringIteration is an iteration expiring soon, or already expired, see ExpiringIterations.
+type ExpiringIteration struct {
+	BucketSlug         string
+	IterationID        string
+	IncrementalVersion int32
+	ExpiresAt          time.Time
+}
+
+// ExpiringIterations returns the complete iterations of bucketSlugs, or of all the buckets of the project when empty,
+// expiring before now plus within, or already expired, by expiry date. Iterations revoked or scheduled for
+// revocation are skipped: they are already rotated.
+func (client *Client) ExpiringIterations(ctx context.Context, bucketSlugs []string, within time.Duration, now time.Time) ([]ExpiringIteration, error) {
+	if len(bucketSlugs) == 0 {
+		buckets, err := client.ListBuckets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list buckets: %w", err)
+		}
+		for _, bucket := range buckets {
+			bucketSlugs = append(bucketSlugs, bucket.Slug)
+		}
+	}
+
+	deadline := now.Add(within)
+	var res []ExpiringIteration
+	for _, slug := range bucketSlugs {
+		iterations, err := client.ListIterations(ctx, slug)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list iterations for bucket %q: %w", slug, err)
+		}
+		for _, iteration := range iterations {
+			if !iteration.Complete || !isIterationActive(iteration) {
+				continue
+			}
+			builds, err := client.ListBuilds(ctx, slug, iteration.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list builds of iteration %q: %w", iteration.ID, err)
+			}
+			at, ok, err := iterationExpiresAt(builds)
+			if err != nil {
+				return nil, fmt.Errorf("iteration %q of bucket %q: %w", iteration.ID, slug, err)
+			}
+			if !ok || at.After(deadline) {
+				continue
+			}
+			res = append(res, ExpiringIteration{
+				BucketSlug:         slug,
+				IterationID:        iteration.ID,
+				IncrementalVersion: iteration.IncrementalVersion,
+				ExpiresAt:          at,
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].ExpiresAt.Before(res[j].ExpiresAt)
+	})
+	return res, nil
+}
+
+// iterationExpiresAt returns when an iteration expires, from the ExpiresAtLabel of its builds. The builds of an
+// iteration can be added by different runs, the iteration expires with its first build expiring. ok is false when no
+// build has an expiry date.
+func iterationExpiresAt(builds []*models.HashicorpCloudPackerBuild) (at time.Time, ok bool, err error) {
+	for _, build := range builds {
+		label, found := build.Labels[ExpiresAtLabel]
+		if !found {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, label)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s label %q: %w", ExpiresAtLabel, label, err)
+		}
+		if !ok || t.Before(at) {
+			at, ok = t, true
+		}
+	}
+	return at, ok, nil
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestExpiringIterations(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.ExistingIterations = testIterationsForList()
+	mockService.ExistingBuilds = []string{"happycloud.image"}
+	mockService.ExistingIterationLabels = map[string]map[string]string{
+		"iteration-1": {ExpiresAtLabel: expiresAt(now, -time.Hour)},
+		"iteration-2": {ExpiresAtLabel: expiresAt(now, -time.Hour)},
+		"iteration-3": {ExpiresAtLabel: expiresAt(now, -time.Hour)},
+		"iteration-4": {ExpiresAtLabel: expiresAt(now, 48*time.Hour)},
+		"iteration-5": {ExpiresAtLabel: expiresAt(now, 30*24*time.Hour)},
+	}
+
+	client := &Client{
+		Packer: mockService,
+	}
+
+	tcs := []struct {
+		name     string
+		within   time.Duration
+		expected []string
+	}{
+		{
+			name:     "expired",
+			expected: []string{"iteration-1"},
+		},
+		{
+			name:     "expiring within a week",
+			within:   7 * 24 * time.Hour,
+			expected: []string{"iteration-1", "iteration-4"},
+		},
+		{
+			name:     "expiring within two months",
+			within:   60 * 24 * time.Hour,
+			expected: []string{"iteration-1", "iteration-4", "iteration-5"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := client.ExpiringIterations(context.TODO(), []string{"TestBucket"}, tc.within, now)
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+			var got []string
+			for _, iteration := range res {
+				if iteration.BucketSlug != "TestBucket" {
+					t.Errorf("unexpected bucket %q", iteration.BucketSlug)
+				}
+				got = append(got, iteration.IterationID)
+			}
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("unexpected expiring iterations: %s", diff)
+			}
+		})
+	}
+}
+
+func TestIterationExpiresAt(t *testing.T) {
+	build := func(labels map[string]string) *models.HashicorpCloudPackerBuild {
+		return &models.HashicorpCloudPackerBuild{Labels: labels}
+	}
+
+	at, ok, err := iterationExpiresAt([]*models.HashicorpCloudPackerBuild{
+		build(nil),
+		build(map[string]string{ExpiresAtLabel: "2022-06-01T00:00:00Z"}),
+		build(map[string]string{ExpiresAtLabel: "2022-05-01T00:00:00Z"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if !ok || !at.Equal(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the iteration to expire with its first build, got %s", at)
+	}
+
+	if _, ok, _ := iterationExpiresAt([]*models.HashicorpCloudPackerBuild{build(nil)}); ok {
+		t.Errorf("expected no expiry without label")
+	}
+
+	if _, _, err := iterationExpiresAt([]*models.HashicorpCloudPackerBuild{build(map[string]string{ExpiresAtLabel: "next week"})}); err == nil {
+		t.Errorf("expected an invalid label to fail")
+	}
+}
@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// The build labels recording who owns the component of a build, so that the builds of a bucket shared by many teams
+// stay attributable. They are reserved: they are set from the Owner of the component, over any build label.
+const (
+	OwnerTeamLabel        = "packer_owner_team"
+	OwnerContactLabel     = "packer_owner_contact"
+	OwnerPipelineURLLabel = "packer_owner_pipeline_url"
+)
+
+// RequiredOwnerLabel is the bucket label listing, comma separated, the fields of the Owner every build published to
+// the bucket must set, among "team", "contact" and "pipeline_url". It is the policy of the bucket: it is read from the
+// bucket when a run starts, and kept when the run updates the labels of the bucket.
+const RequiredOwnerLabel = "packer_required_owner"
+
+// Owner is who owns the builds of a component.
+type Owner struct {
+	Team        string
+	Contact     string
+	PipelineURL string
+}
+
+type ownerField struct {
+	label, value string
+}
+
+// fields returns the fields of the owner by their name in RequiredOwnerLabel, with the label recording each of them.
+func (o *Owner) fields() map[string]ownerField {
+	if o == nil {
+		o = &Owner{}
+	}
+	return map[string]ownerField{
+		"team":         {OwnerTeamLabel, o.Team},
+		"contact":      {OwnerContactLabel, o.Contact},
+		"pipeline_url": {OwnerPipelineURLLabel, o.PipelineURL},
+	}
+}
+
+// labels returns the owner labels of the fields set.
+func (o *Owner) labels() map[string]string {
+	labels := map[string]string{}
+	for _, field := range o.fields() {
+		if field.value != "" {
+			labels[field.label] = field.value
+		}
+	}
+	return labels
+}
+
+// OwnerOf returns the owner of the component type, its entry in ComponentOwners or else Owner; nil when the component
+// has no owner.
+func (b *Bucket) OwnerOf(componentType string) *Owner {
+	if owner, ok := b.ComponentOwners[componentType]; ok {
+		return owner
+	}
+	return b.Owner
+}
+
+// parseRequiredOwner parses the value of a RequiredOwnerLabel, returning the sorted fields it requires.
+func parseRequiredOwner(value string) ([]string, error) {
+	var fields []string
+	known := (*Owner)(nil).fields()
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, ok := known[field]; !ok {
+			return nil, fmt.Errorf("unknown owner field %q in the %s label, expected team, contact or pipeline_url",
+				field, RequiredOwnerLabel)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// loadOwnerPolicy reads the owner fields required by the bucket, from its RequiredOwnerLabel on the HCP Packer
+// registry or else from BucketLabels. The label of the registry is added to BucketLabels, for the bucket to keep its
+// policy once its labels are updated by this run.
+func (b *Bucket) loadOwnerPolicy(ctx context.Context) error {
+	bucket, err := b.client.GetBucket(ctx, b.Slug)
+	if err != nil && !checkErrorCode(err, codes.NotFound) {
+		return fmt.Errorf("failed to read the owner policy of bucket %q: %w", b.Slug, err)
+	}
+
+	policy, ok := b.BucketLabels[RequiredOwnerLabel]
+	if bucket != nil {
+		if existing, found := bucket.Labels[RequiredOwnerLabel]; found {
+			if ok && policy != existing {
+				return fmt.Errorf("the %s label of bucket %q is %q, it cannot be changed to %q by a build",
+					RequiredOwnerLabel, b.Slug, existing, policy)
+			}
+			policy, ok = existing, true
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	b.requiredOwner, err = parseRequiredOwner(policy)
+	if err != nil {
+		return fmt.Errorf("invalid owner policy of bucket %q: %w", b.Slug, err)
+	}
+	labels := make(map[string]string, len(b.BucketLabels)+1)
+	for k, v := range b.BucketLabels {
+		labels[k] = v
+	}
+	labels[RequiredOwnerLabel] = policy
+	b.BucketLabels = labels
+	return nil
+}
+
+// checkOwners verifies that the owners of the expected builds set the fields required by the bucket.
+func (b *Bucket) checkOwners() error {
+	if len(b.requiredOwner) == 0 {
+		return nil
+	}
+	var missing []string
+	for _, name := range b.Iteration.expectedBuilds {
+		fields := b.OwnerOf(name).fields()
+		var unset []string
+		for _, required := range b.requiredOwner {
+			if fields[required].value == "" {
+				unset = append(unset, required)
+			}
+		}
+		if len(unset) > 0 {
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, strings.Join(unset, ", ")))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("bucket %q requires the owner %s of every build, missing for %s",
+			b.Slug, strings.Join(b.requiredOwner, ", "), strings.Join(missing, "; "))
+	}
+	return nil
+}
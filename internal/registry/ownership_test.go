@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func newOwnedBucket(t *testing.T, bucketLabels map[string]string, components ...string) (*Bucket, *registrytest.MockPackerClientService) {
+	t.Helper()
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.ExistingBuckets = []*models.HashicorpCloudPackerBucket{{
+		Slug:   "TestBucket",
+		Labels: map[string]string{RequiredOwnerLabel: "team, contact"},
+	}}
+
+	b := &Bucket{
+		Slug:         "TestBucket",
+		BucketLabels: bucketLabels,
+		client: &Client{
+			Packer: mockService,
+		},
+	}
+	var err error
+	b.Iteration, err = NewIteration(IterationOptions{})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	b.Iteration.expectedBuilds = append(b.Iteration.expectedBuilds, components...)
+	return b, mockService
+}
+
+func TestBucket_Owners(t *testing.T) {
+	b, mockService := newOwnedBucket(t, map[string]string{"os": "linux"}, "happycloud.image", "happycloud.windows")
+	b.Owner = &Owner{Team: "images", Contact: "images@example.com", PipelineURL: "https://ci.example.com/42"}
+	b.ComponentOwners = map[string]*Owner{
+		"happycloud.windows": {Team: "windows", Contact: "windows@example.com"},
+	}
+
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if !mockService.GetBucketCalled {
+		t.Errorf("expected the policy of the bucket to be read")
+	}
+	expectedBucketLabels := map[string]string{"os": "linux", RequiredOwnerLabel: "team, contact"}
+	if diff := cmp.Diff(expectedBucketLabels, b.BucketLabels); diff != "" {
+		t.Errorf("expected the bucket to keep its policy: %s", diff)
+	}
+
+	if err := b.PopulateIteration(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	expected := map[string]map[string]string{
+		"happycloud.image": {
+			OwnerTeamLabel:        "images",
+			OwnerContactLabel:     "images@example.com",
+			OwnerPipelineURLLabel: "https://ci.example.com/42",
+		},
+		"happycloud.windows": {
+			OwnerTeamLabel:    "windows",
+			OwnerContactLabel: "windows@example.com",
+		},
+	}
+	for name, labels := range expected {
+		build, ok := b.Iteration.builds.Get(name)
+		if !ok {
+			t.Fatalf("expected a build entry for %q to be created", name)
+		}
+		if diff := cmp.Diff(labels, build.Labels); diff != "" {
+			t.Errorf("unexpected labels for %q: %s", name, diff)
+		}
+	}
+}
+
+func TestBucket_Owners_required(t *testing.T) {
+	b, mockService := newOwnedBucket(t, nil, "happycloud.image", "happycloud.windows")
+	b.ComponentOwners = map[string]*Owner{
+		"happycloud.image":   {Team: "images", Contact: "images@example.com"},
+		"happycloud.windows": {Team: "windows"},
+	}
+
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	err := b.PopulateIteration(context.TODO())
+	if err == nil {
+		t.Fatal("expected a build without the required owner to fail")
+	}
+	if !strings.Contains(err.Error(), "happycloud.windows (contact)") || strings.Contains(err.Error(), "happycloud.image") {
+		t.Errorf("expected only the builds missing owner fields to be reported, got %q", err)
+	}
+	if mockService.CreateBuildCalled {
+		t.Errorf("didn't expect builds to be created")
+	}
+}
+
+func TestBucket_Owners_policyChange(t *testing.T) {
+	b, _ := newOwnedBucket(t, map[string]string{RequiredOwnerLabel: "team"}, "happycloud.image")
+	if err := b.Initialize(context.TODO()); err == nil {
+		t.Fatal("expected a build changing the policy of the bucket to fail")
+	}
+}
+
+func TestParseRequiredOwner(t *testing.T) {
+	fields, err := parseRequiredOwner("pipeline_url,team,")
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if diff := cmp.Diff([]string{"pipeline_url", "team"}, fields); diff != "" {
+		t.Errorf("unexpected fields: %s", diff)
+	}
+	if _, err := parseRequiredOwner("team,manager"); err == nil {
+		t.Error("expected an unknown field to be rejected")
+	}
+}
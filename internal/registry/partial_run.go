@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// PartialRun is what to do when a run only builds some of the builds of the template, like with -only: the builds left
+// out would otherwise be expected by the iteration all the same.
+type PartialRun string
+
+const (
+	// PartialRunContribute adds the builds of the run to the iteration of the template; the builds left out are
+	// expected until another run builds them, and the iteration is complete once they all are.
+	PartialRunContribute PartialRun = "contribute"
+	// PartialRunScoped publishes the builds of the run to an iteration of their own, complete once they are all done.
+	// Its fingerprint is the fingerprint of the template followed by a hash of the builds of the run, so that running
+	// the same builds again reuses it.
+	PartialRunScoped PartialRun = "scoped"
+	// PartialRunRefuse errors out before any build starts.
+	PartialRunRefuse PartialRun = "refuse"
+)
+
+// ScopedBuildsLabel lists, comma separated, the builds of an iteration created for a partial run, see PartialRunScoped.
+// Like the iteration labels, it is set on every build of the iteration.
+const ScopedBuildsLabel = "packer_scoped_builds"
+
+func (p PartialRun) Validate() error {
+	switch p {
+	case "", PartialRunContribute, PartialRunScoped, PartialRunRefuse:
+		return nil
+	}
+	return fmt.Errorf("unknown partial run mode %q, expected one of %q, %q or %q",
+		p, PartialRunContribute, PartialRunScoped, PartialRunRefuse)
+}
+
+// SelectBuildForComponent records that the build of sourceName, registered with RegisterBuildForComponent, is run.
+// Once a build is selected, the registered builds that are not are left out of the run, see PartialRun.
+func (b *Bucket) SelectBuildForComponent(sourceName string) {
+	if b == nil {
+		return
+	}
+	for _, selected := range b.selectedBuilds {
+		if selected == sourceName {
+			return
+		}
+	}
+	b.selectedBuilds = append(b.selectedBuilds, sourceName)
+}
+
+// leftOutBuilds returns the registered builds that are not selected to run, none when no build was selected.
+func (b *Bucket) leftOutBuilds() []string {
+	if b.selectedBuilds == nil {
+		return nil
+	}
+	var leftOut []string
+	for _, expected := range b.Iteration.expectedBuilds {
+		selected := false
+		for _, name := range b.selectedBuilds {
+			if name == expected {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			leftOut = append(leftOut, expected)
+		}
+	}
+	return leftOut
+}
+
+// applyPartialRun applies the PartialRun of b when some registered builds are left out of the run. It must be called
+// before the iteration is initialized, as a scoped run changes its fingerprint.
+func (b *Bucket) applyPartialRun() error {
+	leftOut := b.leftOutBuilds()
+	if len(leftOut) == 0 {
+		return nil
+	}
+
+	switch b.PartialRun {
+	case PartialRunRefuse:
+		return fmt.Errorf("the builds %s of bucket %q are not part of this run, and its partial run mode is %q. "+
+			"Run all the builds, or set the partial run mode to %q or %q.",
+			strings.Join(leftOut, ", "), b.Slug, PartialRunRefuse, PartialRunContribute, PartialRunScoped)
+	case PartialRunScoped:
+		selected := make([]string, 0, len(b.selectedBuilds))
+		for _, name := range b.Iteration.expectedBuilds {
+			for _, s := range b.selectedBuilds {
+				if s == name {
+					selected = append(selected, name)
+					break
+				}
+			}
+		}
+		sort.Strings(selected)
+		sum := sha256.Sum256([]byte(strings.Join(selected, "\n")))
+		fingerprint := b.Iteration.Fingerprint + "-scoped-" + hex.EncodeToString(sum[:])[:12]
+		log.Printf("[INFO] publishing the builds %s to the scoped iteration of fingerprint %s",
+			strings.Join(selected, ", "), fingerprint)
+		b.Iteration.Fingerprint = fingerprint
+		b.Iteration.expectedBuilds = selected
+		b.scopedBuilds = strings.Join(selected, ",")
+	default:
+		log.Printf("[INFO] the builds %s are not part of this run, the iteration will be complete once another run "+
+			"built them", strings.Join(leftOut, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func newPartialRunBucket(t *testing.T, mode PartialRun) (*Bucket, *registrytest.MockPackerClientService) {
+	t.Helper()
+	mockService := registrytest.NewMockPackerClientService()
+	b := &Bucket{
+		Slug:       "TestBucket",
+		PartialRun: mode,
+		client: &Client{
+			Packer: mockService,
+		},
+	}
+	var err error
+	b.Iteration, err = NewIteration(IterationOptions{Fingerprint: "template-fingerprint"})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	for _, name := range []string{"happycloud.image", "happycloud.windows", "happycloud.arm"} {
+		b.RegisterBuildForComponent(name)
+	}
+	return b, mockService
+}
+
+func TestBucket_PartialRun(t *testing.T) {
+	t.Run("all builds selected", func(t *testing.T) {
+		b, _ := newPartialRunBucket(t, PartialRunRefuse)
+		for _, name := range []string{"happycloud.arm", "happycloud.image", "happycloud.windows"} {
+			b.SelectBuildForComponent(name)
+		}
+		if err := b.Initialize(context.TODO()); err != nil {
+			t.Fatalf("unexpected failure: %v", err)
+		}
+		if b.Iteration.Fingerprint != "template-fingerprint" {
+			t.Errorf("expected the fingerprint of the template, got %q", b.Iteration.Fingerprint)
+		}
+	})
+
+	t.Run("contribute", func(t *testing.T) {
+		b, _ := newPartialRunBucket(t, "")
+		b.SelectBuildForComponent("happycloud.windows")
+		if err := b.Initialize(context.TODO()); err != nil {
+			t.Fatalf("unexpected failure: %v", err)
+		}
+		if b.Iteration.Fingerprint != "template-fingerprint" {
+			t.Errorf("expected the fingerprint of the template, got %q", b.Iteration.Fingerprint)
+		}
+		expected := []string{"happycloud.image", "happycloud.windows", "happycloud.arm"}
+		if diff := cmp.Diff(expected, b.Iteration.expectedBuilds); diff != "" {
+			t.Errorf("expected all the builds of the template: %s", diff)
+		}
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		b, mockService := newPartialRunBucket(t, PartialRunScoped)
+		b.SelectBuildForComponent("happycloud.windows")
+		b.SelectBuildForComponent("happycloud.image")
+		if err := b.Initialize(context.TODO()); err != nil {
+			t.Fatalf("unexpected failure: %v", err)
+		}
+		if !strings.HasPrefix(b.Iteration.Fingerprint, "template-fingerprint-scoped-") {
+			t.Errorf("expected a scoped fingerprint, got %q", b.Iteration.Fingerprint)
+		}
+		if !mockService.CreateIterationCalled {
+			t.Errorf("expected a scoped iteration to be created")
+		}
+		expected := []string{"happycloud.image", "happycloud.windows"}
+		if diff := cmp.Diff(expected, b.Iteration.expectedBuilds); diff != "" {
+			t.Errorf("expected the selected builds only: %s", diff)
+		}
+		if got := b.Iteration.Labels[ScopedBuildsLabel]; got != "happycloud.image,happycloud.windows" {
+			t.Errorf("unexpected %s label %q", ScopedBuildsLabel, got)
+		}
+
+		// The same builds are published to the same scoped iteration.
+		other, _ := newPartialRunBucket(t, PartialRunScoped)
+		other.SelectBuildForComponent("happycloud.image")
+		other.SelectBuildForComponent("happycloud.windows")
+		if err := other.applyPartialRun(); err != nil {
+			t.Fatalf("unexpected failure: %v", err)
+		}
+		if other.Iteration.Fingerprint != b.Iteration.Fingerprint {
+			t.Errorf("expected the fingerprint %q, got %q", b.Iteration.Fingerprint, other.Iteration.Fingerprint)
+		}
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		b, mockService := newPartialRunBucket(t, PartialRunRefuse)
+		b.SelectBuildForComponent("happycloud.windows")
+		err := b.Initialize(context.TODO())
+		if err == nil {
+			t.Fatal("expected the partial run to be refused")
+		}
+		if !strings.Contains(err.Error(), "happycloud.image, happycloud.arm") {
+			t.Errorf("expected the error to list the builds left out, got %q", err)
+		}
+		if mockService.CreateBucketCalled || mockService.CreateIterationCalled {
+			t.Errorf("expected nothing to be published")
+		}
+	})
+}
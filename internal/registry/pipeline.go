@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// The labels recording the pipeline an iteration belongs to. Like the iteration labels, they are set on every build of
+// the iteration.
+const (
+	PipelineStageLabel           = "pipeline_stage"
+	PipelineParentBucketLabel    = "pipeline_parent_bucket"
+	PipelineParentIterationLabel = "pipeline_parent_iteration_id"
+	PipelineRootBucketLabel      = "pipeline_root_bucket"
+	PipelineRootIterationLabel   = "pipeline_root_iteration_id"
+)
+
+// Pipeline declares that an iteration is a stage of a pipeline of images, like base image → hardened image → app
+// image, by referencing the iteration it is built from.
+type Pipeline struct {
+	ParentBucket string
+	// Exactly one of ParentIterationID and ParentChannel must be set.
+	ParentIterationID string
+	ParentChannel     string
+	// Stage is the position of the iteration in the pipeline, the root being stage 1. When 0, it is the stage of the
+	// parent plus one.
+	Stage int
+}
+
+func (p *Pipeline) Validate() error {
+	if p.ParentBucket == "" {
+		return fmt.Errorf("a pipeline must have a parent bucket")
+	}
+	if (p.ParentIterationID == "") == (p.ParentChannel == "") {
+		return fmt.Errorf("a pipeline must have exactly one of a parent iteration ID or a parent channel")
+	}
+	if p.Stage < 0 || p.Stage == 1 {
+		return fmt.Errorf("the stage of a pipeline with a parent must be greater than 1, got %d", p.Stage)
+	}
+	return nil
+}
+
+// initializePipeline fetches the parent iteration of the pipeline of b, and records the pipeline in the labels of the
+// iteration.
+func (b *Bucket) initializePipeline(ctx context.Context) error {
+	if b.Pipeline == nil {
+		return nil
+	}
+
+	var parent *models.HashicorpCloudPackerIteration
+	var err error
+	if b.Pipeline.ParentChannel != "" {
+		parent, err = b.client.GetIterationFromChannel(ctx, b.Pipeline.ParentBucket, b.Pipeline.ParentChannel)
+	} else {
+		parent, err = b.client.GetIteration(ctx, b.Pipeline.ParentBucket, GetIteration_byID(b.Pipeline.ParentIterationID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get the parent iteration of the pipeline from bucket %q: %w",
+			b.Pipeline.ParentBucket, err)
+	}
+
+	labels, err := pipelineLabels(b.Pipeline, parent)
+	if err != nil {
+		return err
+	}
+	for k, v := range labels {
+		b.Iteration.Labels[k] = v
+	}
+	return nil
+}
+
+// pipelineLabels returns the labels linking an iteration to its parent, and to the root of the pipeline. When the
+// parent is not itself part of a pipeline, it is the root.
+func pipelineLabels(p *Pipeline, parent *models.HashicorpCloudPackerIteration) (map[string]string, error) {
+	labels := map[string]string{
+		PipelineParentBucketLabel:    p.ParentBucket,
+		PipelineParentIterationLabel: parent.ID,
+		PipelineRootBucketLabel:      p.ParentBucket,
+		PipelineRootIterationLabel:   parent.ID,
+	}
+
+	parentStage := 1
+	for _, build := range parent.Builds {
+		stage, ok := build.Labels[PipelineStageLabel]
+		if !ok {
+			continue
+		}
+		s, err := strconv.Atoi(stage)
+		if err != nil {
+			return nil, fmt.Errorf("the parent iteration %q has an invalid %s label %q", parent.ID, PipelineStageLabel, stage)
+		}
+		parentStage = s
+		labels[PipelineRootBucketLabel] = build.Labels[PipelineRootBucketLabel]
+		labels[PipelineRootIterationLabel] = build.Labels[PipelineRootIterationLabel]
+		break
+	}
+
+	stage := parentStage + 1
+	if p.Stage != 0 && p.Stage != stage {
+		return nil, fmt.Errorf("the iteration is declared as stage %d of the pipeline, but its parent iteration %q is stage %d",
+			p.Stage, parent.ID, parentStage)
+	}
+	labels[PipelineStageLabel] = strconv.Itoa(stage)
+	return labels, nil
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+func TestPipeline_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline Pipeline
+		wantErr  bool
+	}{
+		{"parent iteration", Pipeline{ParentBucket: "base", ParentIterationID: "iteration-id"}, false},
+		{"parent channel", Pipeline{ParentBucket: "base", ParentChannel: "production", Stage: 2}, false},
+		{"no parent bucket", Pipeline{ParentChannel: "production"}, true},
+		{"no parent iteration", Pipeline{ParentBucket: "base"}, true},
+		{"parent iteration and channel", Pipeline{ParentBucket: "base", ParentIterationID: "iteration-id", ParentChannel: "production"}, true},
+		{"root stage", Pipeline{ParentBucket: "base", ParentChannel: "production", Stage: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.pipeline.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPipelineLabels(t *testing.T) {
+	root := &models.HashicorpCloudPackerIteration{
+		ID: "root-iteration",
+		Builds: []*models.HashicorpCloudPackerBuild{
+			{Labels: map[string]string{"os": "ubuntu"}},
+		},
+	}
+	hardened := &models.HashicorpCloudPackerIteration{
+		ID: "hardened-iteration",
+		Builds: []*models.HashicorpCloudPackerBuild{
+			{Labels: map[string]string{
+				PipelineStageLabel:           "2",
+				PipelineParentBucketLabel:    "base",
+				PipelineParentIterationLabel: "root-iteration",
+				PipelineRootBucketLabel:      "base",
+				PipelineRootIterationLabel:   "root-iteration",
+			}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		pipeline *Pipeline
+		parent   *models.HashicorpCloudPackerIteration
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			"parent is the root",
+			&Pipeline{ParentBucket: "base"},
+			root,
+			map[string]string{
+				PipelineStageLabel:           "2",
+				PipelineParentBucketLabel:    "base",
+				PipelineParentIterationLabel: "root-iteration",
+				PipelineRootBucketLabel:      "base",
+				PipelineRootIterationLabel:   "root-iteration",
+			},
+			false,
+		},
+		{
+			"root is inherited from the parent",
+			&Pipeline{ParentBucket: "hardened", Stage: 3},
+			hardened,
+			map[string]string{
+				PipelineStageLabel:           "3",
+				PipelineParentBucketLabel:    "hardened",
+				PipelineParentIterationLabel: "hardened-iteration",
+				PipelineRootBucketLabel:      "base",
+				PipelineRootIterationLabel:   "root-iteration",
+			},
+			false,
+		},
+		{
+			"declared stage does not follow the parent",
+			&Pipeline{ParentBucket: "hardened", Stage: 2},
+			hardened,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pipelineLabels(tt.pipeline, tt.parent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pipelineLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected labels: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// PromoteOptions configures how an iteration gets promoted to a channel.
+type PromoteOptions struct {
+	// Confirm, when set, is called with the current state of the channel
+	// before it is reassigned from another iteration. Returning an error
+	// aborts the promotion. It is not called when the channel is created.
+	Confirm func(*models.HashicorpCloudPackerChannel) error
+}
+
+// PromoteIteration points the channel channelSlug of bucketSlug to the
+// iteration referenced by iterationID, creating the channel if it does not
+// exist yet. Only complete iterations that are not revoked can be promoted.
+//
+// The channel as it was before the promotion is returned, it is nil when the
+// channel was created. A channel already pointing to the iteration is left
+// untouched.
+func (client *Client) PromoteIteration(ctx context.Context, bucketSlug, iterationID, channelSlug string, opts PromoteOptions) (*models.HashicorpCloudPackerChannel, error) {
+	iterations, err := client.ListIterations(ctx, bucketSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list iterations for bucket %q: %w", bucketSlug, err)
+	}
+
+	var iteration *models.HashicorpCloudPackerIterationforList
+	for _, it := range iterations {
+		if it.ID == iterationID {
+			iteration = it
+			break
+		}
+	}
+	switch {
+	case iteration == nil:
+		return nil, fmt.Errorf("no iteration found with the id %q in bucket %q", iterationID, bucketSlug)
+	case !iteration.Complete:
+		return nil, fmt.Errorf("the iteration %q is not complete and can not be promoted", iterationID)
+	case !isIterationActive(iteration):
+		return nil, fmt.Errorf("the iteration %q is revoked and can not be promoted", iterationID)
+	}
+
+	channels, err := client.ListChannels(ctx, bucketSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channels for bucket %q: %w", bucketSlug, err)
+	}
+
+	var previous *models.HashicorpCloudPackerChannel
+	for _, channel := range channels {
+		if channel.Slug == channelSlug {
+			previous = channel
+			break
+		}
+	}
+
+	if previous == nil {
+		log.Printf("[TRACE] creating channel %q of bucket %q for iteration %q", channelSlug, bucketSlug, iterationID)
+		if _, err := client.CreateChannel(ctx, bucketSlug, channelSlug, iterationID); err != nil {
+			return nil, fmt.Errorf("failed to create channel %q: %w", channelSlug, err)
+		}
+		return nil, nil
+	}
+
+	if previous.Iteration != nil && previous.Iteration.ID == iterationID {
+		return previous, nil
+	}
+
+	if opts.Confirm != nil {
+		if err := opts.Confirm(previous); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[TRACE] promoting iteration %q of bucket %q to channel %q", iterationID, bucketSlug, channelSlug)
+	if _, err := client.UpdateChannel(ctx, bucketSlug, channelSlug, iterationID); err != nil {
+		return nil, fmt.Errorf("failed to update channel %q: %w", channelSlug, err)
+	}
+
+	return previous, nil
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestPromoteIteration(t *testing.T) {
+	mockService := registrytest.NewMockPackerClientService()
+	mockService.ExistingIterations = testIterationsForList()
+
+	client := &Client{
+		Packer: mockService,
+	}
+
+	for _, iterationID := range []string{"iteration-2", "iteration-3", "iteration-42"} {
+		if _, err := client.PromoteIteration(context.TODO(), "TestBucket", iterationID, "production", PromoteOptions{}); err == nil {
+			t.Errorf("expected promoting %q to fail", iterationID)
+		}
+	}
+
+	previous, err := client.PromoteIteration(context.TODO(), "TestBucket", "iteration-4", "production", PromoteOptions{
+		Confirm: func(*models.HashicorpCloudPackerChannel) error {
+			t.Fatalf("didn't expect a confirmation when creating a channel")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if previous != nil || !mockService.CreateChannelCalled {
+		t.Fatalf("expected the channel to be created")
+	}
+
+	_, err = client.PromoteIteration(context.TODO(), "TestBucket", "iteration-5", "production", PromoteOptions{
+		Confirm: func(*models.HashicorpCloudPackerChannel) error { return errors.New("declined") },
+	})
+	if err == nil {
+		t.Fatalf("expected a declined confirmation to abort the promotion")
+	}
+	if mockService.UpdateChannelCalled {
+		t.Errorf("didn't expect a call to UpdateChannel once the confirmation is declined")
+	}
+
+	previous, err = client.PromoteIteration(context.TODO(), "TestBucket", "iteration-5", "production", PromoteOptions{})
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if previous == nil || previous.Iteration.ID != "iteration-4" {
+		t.Errorf("expected the channel to point to iteration-4 before the promotion, got %#v", previous)
+	}
+	if got := mockService.ExistingChannels[0].Iteration.ID; got != "iteration-5" {
+		t.Errorf("expected the channel to point to iteration-5, got %q", got)
+	}
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// WebhookEventPromotionApproval is sent to the approval webhook of a
+// PublishRule, to approve the promotion of a complete iteration.
+const WebhookEventPromotionApproval = "promotion.approval"
+
+// PublishRule promotes the iterations of a bucket to a channel once they are
+// complete, see Bucket.PublishIteration. Without approval gates, the
+// iterations are promoted automatically.
+type PublishRule struct {
+	Channel string
+	// RequireApproval only promotes the iteration when the run approves the
+	// promotions, see PublishOptions.
+	RequireApproval bool
+	// ApprovalWebhook, when set, is asked to approve the promotion: the
+	// iteration is only promoted when it answers with a 2xx status.
+	ApprovalWebhook *Webhook
+}
+
+// ValidatePublishRules checks that the rules promote to distinct channels.
+func ValidatePublishRules(rules []PublishRule) error {
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Channel == "" {
+			return fmt.Errorf("a publish rule must name a channel")
+		}
+		if seen[rule.Channel] {
+			return fmt.Errorf("the channel %q is published to more than once", rule.Channel)
+		}
+		seen[rule.Channel] = true
+	}
+	return nil
+}
+
+// PublishOptions configures the promotions of PublishIteration.
+type PublishOptions struct {
+	// Approved approves the promotions of the rules requiring approval, like
+	// with packer build -approve-promotion.
+	Approved bool
+}
+
+// PublishStatus is what happened to the promotion of a PublishRule.
+type PublishStatus string
+
+const (
+	// PublishPromoted tells the channel points to the iteration.
+	PublishPromoted PublishStatus = "promoted"
+	// PublishPendingApproval tells the rule requires an approval the run did
+	// not give.
+	PublishPendingApproval PublishStatus = "pending-approval"
+	// PublishDenied tells the approval webhook did not approve the promotion.
+	PublishDenied PublishStatus = "denied"
+	// PublishFailed tells the promotion failed.
+	PublishFailed PublishStatus = "failed"
+)
+
+// PublishResult is the outcome of a PublishRule. Err tells why the promotion
+// was denied or failed.
+type PublishResult struct {
+	Channel string
+	Status  PublishStatus
+	Err     error
+}
+
+// PublishIteration applies the Publish rules of b to its iteration, once it is
+// complete, see IterationCompletion. It returns the outcome of each rule, in
+// order, or nothing when the iteration is not complete.
+//
+// The HCP Packer registry only promotes the iterations whose builds are all
+// done: an optional build missing prevents the promotions.
+func (b *Bucket) PublishIteration(ctx context.Context, opts PublishOptions) []PublishResult {
+	if len(b.Publish) == 0 {
+		return nil
+	}
+	payload, complete := b.completedIterationPayload()
+	if !complete {
+		return nil
+	}
+	payload.Event = WebhookEventPromotionApproval
+
+	var results []PublishResult
+	for _, rule := range b.Publish {
+		res := PublishResult{Channel: rule.Channel, Status: PublishPromoted}
+		switch {
+		case rule.RequireApproval && !opts.Approved:
+			res.Status = PublishPendingApproval
+		case rule.ApprovalWebhook != nil:
+			payload.Channel = rule.Channel
+			if err := rule.ApprovalWebhook.Notify(ctx, payload); err != nil {
+				res.Status, res.Err = PublishDenied, err
+			}
+		}
+		if res.Status == PublishPromoted {
+			log.Printf("[TRACE] publishing iteration %q of bucket %q to channel %q", b.Iteration.ID, b.Slug, rule.Channel)
+			if _, err := b.client.PromoteIteration(ctx, b.Slug, b.Iteration.ID, rule.Channel, PromoteOptions{}); err != nil {
+				res.Status, res.Err = PublishFailed, err
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
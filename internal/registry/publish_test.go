@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestBucket_PublishIteration(t *testing.T) {
+	var asked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("failed to decode payload: %s", err)
+		}
+		if payload.Event != WebhookEventPromotionApproval || payload.IterationID != "iteration-id" {
+			t.Errorf("unexpected payload %#v", payload)
+		}
+		asked = append(asked, payload.Channel)
+		if r.URL.Path == "/deny" {
+			http.Error(w, "not during the freeze", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	subject := createInitialBucket(t)
+	subject.Iteration.ID = "iteration-id"
+	mockService := subject.client.Packer.(*registrytest.MockPackerClientService)
+	mockService.ExistingIterations = []*models.HashicorpCloudPackerIterationforList{
+		{ID: "iteration-id", Complete: true},
+	}
+	subject.Publish = []PublishRule{
+		{Channel: "dev"},
+		{Channel: "prod", RequireApproval: true},
+		{Channel: "staging", ApprovalWebhook: &Webhook{URL: server.URL + "/approve", Secret: "s3cr3t"}},
+		{Channel: "qa", ApprovalWebhook: &Webhook{URL: server.URL + "/deny", Secret: "s3cr3t"}},
+	}
+	checkError(t, ValidatePublishRules(subject.Publish))
+
+	name := "happycloud.image"
+	subject.RegisterBuildForComponent(name)
+	subject.Iteration.builds.Store(name, &Build{
+		ID:            name + "-build",
+		ComponentType: name,
+		Labels:        map[string]string{},
+		Images:        map[string]registryimage.Image{},
+	})
+	if results := subject.PublishIteration(context.TODO(), PublishOptions{}); len(results) != 0 {
+		t.Fatalf("expected an incomplete iteration not to be published, got %#v", results)
+	}
+
+	checkError(t, subject.UpdateImageForBuild(name, registryimage.Image{ImageID: "image-id", ProviderName: "happycloud", ProviderRegion: "west"}))
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), name, models.HashicorpCloudPackerBuildStatusDONE))
+
+	results := subject.PublishIteration(context.TODO(), PublishOptions{})
+	var statuses []PublishStatus
+	for _, res := range results {
+		statuses = append(statuses, res.Status)
+	}
+	expected := []PublishStatus{PublishPromoted, PublishPendingApproval, PublishPromoted, PublishDenied}
+	if diff := cmp.Diff(expected, statuses); diff != "" {
+		t.Errorf("unexpected statuses: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"staging", "qa"}, asked); diff != "" {
+		t.Errorf("unexpected approval requests: %s", diff)
+	}
+	var channels []string
+	for _, channel := range mockService.ExistingChannels {
+		channels = append(channels, channel.Slug)
+	}
+	if diff := cmp.Diff([]string{"dev", "staging"}, channels); diff != "" {
+		t.Errorf("unexpected channels: %s", diff)
+	}
+
+	results = subject.PublishIteration(context.TODO(), PublishOptions{Approved: true})
+	if results[1].Status != PublishPromoted {
+		t.Errorf("expected the approved promotion to prod to be done, got %#v", results[1])
+	}
+}
+
+func TestValidatePublishRules(t *testing.T) {
+	if err := ValidatePublishRules([]PublishRule{{Channel: "dev"}, {Channel: "dev", RequireApproval: true}}); err == nil {
+		t.Error("expected publishing twice to a channel to fail")
+	}
+	if err := ValidatePublishRules([]PublishRule{{}}); err == nil {
+		t.Error("expected a rule without channel to fail")
+	}
+}
@@ -18,7 +18,8 @@ func (client *Client) CreateBucket(
 	bucketLabels map[string]string,
 ) (*packer_service.PackerServiceCreateBucketOK, error) {
 
-	createBktParams := packer_service.NewPackerServiceCreateBucketParams()
+	ctx = client.withRequestID(ctx)
+	createBktParams := packer_service.NewPackerServiceCreateBucketParamsWithContext(ctx)
 	createBktParams.LocationOrganizationID = client.OrganizationID
 	createBktParams.LocationProjectID = client.ProjectID
 	createBktParams.Body = &models.HashicorpCloudPackerCreateBucketRequest{
@@ -27,7 +28,11 @@ func (client *Client) CreateBucket(
 		Labels:      bucketLabels,
 	}
 
-	return client.Packer.PackerServiceCreateBucket(createBktParams, nil)
+	resp, err := client.Packer.PackerServiceCreateBucket(createBktParams, nil)
+	return resp, client.audit(ctx, AuditEntry{
+		Operation:  AuditCreateBucket,
+		BucketSlug: bucketSlug,
+	}, err)
 }
 
 func (client *Client) DeleteBucket(
@@ -35,12 +40,17 @@ func (client *Client) DeleteBucket(
 	bucketSlug string,
 ) (*packer_service.PackerServiceDeleteBucketOK, error) {
 
+	ctx = client.withRequestID(ctx)
 	deleteBktParams := packer_service.NewPackerServiceDeleteBucketParamsWithContext(ctx)
 	deleteBktParams.LocationOrganizationID = client.OrganizationID
 	deleteBktParams.LocationProjectID = client.ProjectID
 	deleteBktParams.BucketSlug = bucketSlug
 
-	return client.Packer.PackerServiceDeleteBucket(deleteBktParams, nil)
+	resp, err := client.Packer.PackerServiceDeleteBucket(deleteBktParams, nil)
+	return resp, client.audit(ctx, AuditEntry{
+		Operation:  AuditDeleteBucket,
+		BucketSlug: bucketSlug,
+	}, err)
 }
 
 // UpsertBucket tries to create a bucket on a HCP Packer Registry. If the bucket
@@ -64,6 +74,7 @@ func (client *Client) UpsertBucket(
 		return nil
 	}
 
+	ctx = client.withRequestID(ctx)
 	params := packer_service.NewPackerServiceUpdateBucketParamsWithContext(ctx)
 	params.LocationOrganizationID = client.OrganizationID
 	params.LocationProjectID = client.ProjectID
@@ -75,7 +86,10 @@ func (client *Client) UpsertBucket(
 	}
 	_, err = client.Packer.PackerServiceUpdateBucket(params, nil)
 
-	return err
+	return client.audit(ctx, AuditEntry{
+		Operation:  AuditUpdateBucket,
+		BucketSlug: bucketSlug,
+	}, err)
 }
 
 func (client *Client) CreateIteration(
@@ -84,6 +98,7 @@ func (client *Client) CreateIteration(
 	fingerprint string,
 ) (*packer_service.PackerServiceCreateIterationOK, error) {
 
+	ctx = client.withRequestID(ctx)
 	params := packer_service.NewPackerServiceCreateIterationParamsWithContext(ctx)
 	params.LocationOrganizationID = client.OrganizationID
 	params.LocationProjectID = client.ProjectID
@@ -93,7 +108,16 @@ func (client *Client) CreateIteration(
 		BucketSlug:  bucketSlug,
 	}
 
-	return client.Packer.PackerServiceCreateIteration(params, nil)
+	resp, err := client.Packer.PackerServiceCreateIteration(params, nil)
+	entry := AuditEntry{
+		Operation:   AuditCreateIteration,
+		BucketSlug:  bucketSlug,
+		Fingerprint: fingerprint,
+	}
+	if err == nil && resp.Payload.Iteration != nil {
+		entry.IterationID = resp.Payload.Iteration.ID
+	}
+	return resp, client.audit(ctx, entry, err)
 }
 
 type GetIterationOption func(*packer_service.PackerServiceGetIterationParams)
@@ -149,6 +173,7 @@ func (client *Client) CreateBuild(
 	status models.HashicorpCloudPackerBuildStatus,
 ) (*packer_service.PackerServiceCreateBuildOK, error) {
 
+	ctx = client.withRequestID(ctx)
 	params := packer_service.NewPackerServiceCreateBuildParamsWithContext(ctx)
 
 	params.LocationOrganizationID = client.OrganizationID
@@ -166,7 +191,19 @@ func (client *Client) CreateBuild(
 		},
 	}
 
-	return client.Packer.PackerServiceCreateBuild(params, nil)
+	resp, err := client.Packer.PackerServiceCreateBuild(params, nil)
+	entry := AuditEntry{
+		Operation:     AuditCreateBuild,
+		BucketSlug:    bucketSlug,
+		IterationID:   iterationID,
+		Fingerprint:   fingerprint,
+		ComponentType: componentType,
+		Status:        string(status),
+	}
+	if err == nil && resp.Payload.Build != nil {
+		entry.BuildID = resp.Payload.Build.ID
+	}
+	return resp, client.audit(ctx, entry, err)
 }
 
 // ListBuilds queries an Iteration on HCP Packer registry for all of it's
@@ -204,6 +241,7 @@ func (client *Client) UpdateBuild(
 	images []*models.HashicorpCloudPackerImageCreateBody,
 ) (string, error) {
 
+	ctx = client.withRequestID(ctx)
 	params := packer_service.NewPackerServiceUpdateBuildParamsWithContext(ctx)
 	params.BuildID = buildID
 	params.LocationOrganizationID = client.OrganizationID
@@ -222,6 +260,12 @@ func (client *Client) UpdateBuild(
 	}
 
 	resp, err := client.Packer.PackerServiceUpdateBuild(params, nil)
+	err = client.audit(ctx, AuditEntry{
+		Operation: AuditUpdateBuild,
+		BuildID:   buildID,
+		Status:    string(status),
+		Images:    auditImages(images),
+	}, err)
 	if err != nil {
 		return "", err
 	}
@@ -269,3 +313,203 @@ func (client *Client) GetIterationFromChannel(
 	return nil, fmt.Errorf("there is no channel with the name %s associated with the bucket %s",
 		channelName, bucketSlug)
 }
+
+// ListIterations queries a bucket on the HCP Packer registry for all of its
+// iterations. All pages of results are retrieved before returning.
+func (client *Client) ListIterations(
+	ctx context.Context,
+	bucketSlug string,
+) ([]*models.HashicorpCloudPackerIterationforList, error) {
+
+	var iterations []*models.HashicorpCloudPackerIterationforList
+	var nextPageToken *string
+	for {
+		params := packer_service.NewPackerServiceListIterationsParamsWithContext(ctx)
+		params.LocationOrganizationID = client.OrganizationID
+		params.LocationProjectID = client.ProjectID
+		params.BucketSlug = bucketSlug
+		params.PaginationNextPageToken = nextPageToken
+
+		resp, err := client.Packer.PackerServiceListIterations(params, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		iterations = append(iterations, resp.Payload.Iterations...)
+
+		pagination := resp.Payload.Pagination
+		if pagination == nil || pagination.NextPageToken == "" {
+			return iterations, nil
+		}
+		nextPageToken = &pagination.NextPageToken
+	}
+}
+
+// RevokeIteration revokes the iteration referenced by iterationID. revokeIn
+// is a duration, such as "30d" or "2h45m", after which the revocation takes
+// effect; "0s" revokes the iteration right away. Once revoked, an iteration
+// can no longer be used by Packer builds nor be returned through a channel.
+func (client *Client) RevokeIteration(
+	ctx context.Context,
+	bucketSlug,
+	iterationID,
+	revokeIn,
+	message string,
+) error {
+
+	ctx = client.withRequestID(ctx)
+	params := packer_service.NewPackerServiceUpdateIterationParamsWithContext(ctx)
+	params.LocationOrganizationID = client.OrganizationID
+	params.LocationProjectID = client.ProjectID
+	params.IterationID = iterationID
+	params.Body = &models.HashicorpCloudPackerUpdateIterationRequest{
+		BucketSlug:        bucketSlug,
+		IterationID:       iterationID,
+		RevokeIn:          revokeIn,
+		RevocationMessage: message,
+	}
+
+	_, err := client.Packer.PackerServiceUpdateIteration(params, nil)
+	return client.audit(ctx, AuditEntry{
+		Operation:   AuditRevokeIteration,
+		BucketSlug:  bucketSlug,
+		IterationID: iterationID,
+	}, err)
+}
+
+// GetBucket queries the HCP Packer registry for the bucket bucketSlug.
+func (client *Client) GetBucket(
+	ctx context.Context,
+	bucketSlug string,
+) (*models.HashicorpCloudPackerBucket, error) {
+
+	params := packer_service.NewPackerServiceGetBucketParamsWithContext(ctx)
+	params.LocationOrganizationID = client.OrganizationID
+	params.LocationProjectID = client.ProjectID
+	params.BucketSlug = bucketSlug
+
+	resp, err := client.Packer.PackerServiceGetBucket(params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Payload.Bucket, nil
+}
+
+// ListBuckets queries the HCP Packer registry for all the buckets of the
+// project. All pages of results are retrieved before returning.
+func (client *Client) ListBuckets(
+	ctx context.Context,
+) ([]*models.HashicorpCloudPackerBucket, error) {
+
+	var buckets []*models.HashicorpCloudPackerBucket
+	var nextPageToken *string
+	for {
+		params := packer_service.NewPackerServiceListBucketsParamsWithContext(ctx)
+		params.LocationOrganizationID = client.OrganizationID
+		params.LocationProjectID = client.ProjectID
+		params.PaginationNextPageToken = nextPageToken
+
+		resp, err := client.Packer.PackerServiceListBuckets(params, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, resp.Payload.Buckets...)
+
+		pagination := resp.Payload.Pagination
+		if pagination == nil || pagination.NextPageToken == "" {
+			return buckets, nil
+		}
+		nextPageToken = &pagination.NextPageToken
+	}
+}
+
+// ListChannels queries a bucket on the HCP Packer registry for all of its
+// channels, along with the iteration each of them points to.
+func (client *Client) ListChannels(
+	ctx context.Context,
+	bucketSlug string,
+) ([]*models.HashicorpCloudPackerChannel, error) {
+
+	params := packer_service.NewPackerServiceListChannelsParamsWithContext(ctx)
+	params.LocationOrganizationID = client.OrganizationID
+	params.LocationProjectID = client.ProjectID
+	params.BucketSlug = bucketSlug
+
+	resp, err := client.Packer.PackerServiceListChannels(params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Payload.Channels, nil
+}
+
+// CreateChannel creates the channel channelSlug in a bucket, pointing to the
+// iteration referenced by iterationID.
+func (client *Client) CreateChannel(
+	ctx context.Context,
+	bucketSlug,
+	channelSlug,
+	iterationID string,
+) (*models.HashicorpCloudPackerChannel, error) {
+
+	ctx = client.withRequestID(ctx)
+	params := packer_service.NewPackerServiceCreateChannelParamsWithContext(ctx)
+	params.LocationOrganizationID = client.OrganizationID
+	params.LocationProjectID = client.ProjectID
+	params.BucketSlug = bucketSlug
+	params.Body = &models.HashicorpCloudPackerCreateChannelRequest{
+		BucketSlug:  bucketSlug,
+		Slug:        channelSlug,
+		IterationID: iterationID,
+	}
+
+	resp, err := client.Packer.PackerServiceCreateChannel(params, nil)
+	err = client.audit(ctx, AuditEntry{
+		Operation:   AuditCreateChannel,
+		BucketSlug:  bucketSlug,
+		ChannelSlug: channelSlug,
+		IterationID: iterationID,
+	}, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Payload.Channel, nil
+}
+
+// UpdateChannel points the existing channel channelSlug of a bucket to the
+// iteration referenced by iterationID.
+func (client *Client) UpdateChannel(
+	ctx context.Context,
+	bucketSlug,
+	channelSlug,
+	iterationID string,
+) (*models.HashicorpCloudPackerChannel, error) {
+
+	ctx = client.withRequestID(ctx)
+	params := packer_service.NewPackerServiceUpdateChannelParamsWithContext(ctx)
+	params.LocationOrganizationID = client.OrganizationID
+	params.LocationProjectID = client.ProjectID
+	params.BucketSlug = bucketSlug
+	params.Slug = channelSlug
+	params.Body = &models.HashicorpCloudPackerUpdateChannelRequest{
+		BucketSlug:  bucketSlug,
+		Slug:        channelSlug,
+		IterationID: iterationID,
+	}
+
+	resp, err := client.Packer.PackerServiceUpdateChannel(params, nil)
+	err = client.audit(ctx, AuditEntry{
+		Operation:   AuditUpdateChannel,
+		BucketSlug:  bucketSlug,
+		ChannelSlug: channelSlug,
+		IterationID: iterationID,
+	}, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Payload.Channel, nil
+}
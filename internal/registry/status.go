@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+// IterationStatus is the state of the iteration of a bucket as known by the running build, for post-processors to
+// act upon, like only uploading an image once the other builds of the iteration succeeded. See Bucket.IterationStatus.
+type IterationStatus struct {
+	BucketSlug  string
+	IterationID string
+	// Builds are the statuses of the builds of the iteration, by component type.
+	Builds map[string]models.HashicorpCloudPackerBuildStatus
+	// Channels are the channels of the bucket pointing to the iteration, sorted.
+	Channels []string
+}
+
+// SiblingBuildsDone tells whether all the builds of the iteration, but the one of the component type name, are DONE.
+func (s *IterationStatus) SiblingBuildsDone(name string) bool {
+	for component, status := range s.Builds {
+		if component != name && status != models.HashicorpCloudPackerBuildStatusDONE {
+			return false
+		}
+	}
+	return true
+}
+
+// IterationStatus returns the current status of the iteration of the bucket. The statuses of the builds are the ones
+// known to this run, which updates them as its builds progress; the channels are queried from the HCP Packer
+// registry.
+func (b *Bucket) IterationStatus(ctx context.Context) (*IterationStatus, error) {
+	if b.Iteration == nil || b.Iteration.ID == "" {
+		return nil, fmt.Errorf("the iteration of the bucket %q is not initialized", b.Slug)
+	}
+
+	status := &IterationStatus{
+		BucketSlug:  b.Slug,
+		IterationID: b.Iteration.ID,
+		Builds:      make(map[string]models.HashicorpCloudPackerBuildStatus),
+	}
+	b.Iteration.builds.Range(func(name string, build *Build) bool {
+		status.Builds[name] = build.Status
+		return true
+	})
+
+	channels, err := b.client.ListChannels(ctx, b.Slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the channels of the bucket %q: %w", b.Slug, err)
+	}
+	for _, channel := range channels {
+		if channel.Iteration != nil && channel.Iteration.ID == b.Iteration.ID {
+			status.Channels = append(status.Channels, channel.Slug)
+		}
+	}
+	sort.Strings(status.Channels)
+	return status, nil
+}
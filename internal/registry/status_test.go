@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func TestBucket_IterationStatus(t *testing.T) {
+	subject := createInitialBucket(t)
+	mockService := subject.client.Packer.(*registrytest.MockPackerClientService)
+	mockService.ExistingChannels = []*models.HashicorpCloudPackerChannel{
+		{Slug: "production", Iteration: &models.HashicorpCloudPackerIteration{ID: "other-iteration"}},
+		{Slug: "staging", Iteration: &models.HashicorpCloudPackerIteration{ID: "iteration-id"}},
+		{Slug: "latest", Iteration: &models.HashicorpCloudPackerIteration{ID: "iteration-id"}},
+	}
+
+	if _, err := subject.IterationStatus(context.TODO()); err == nil {
+		t.Errorf("expected an error for an iteration not initialized")
+	}
+
+	subject.Iteration.ID = "iteration-id"
+	for name, status := range map[string]models.HashicorpCloudPackerBuildStatus{
+		"happycloud.image":   models.HashicorpCloudPackerBuildStatusRUNNING,
+		"happycloud.image2":  models.HashicorpCloudPackerBuildStatusDONE,
+		"happycloud.another": models.HashicorpCloudPackerBuildStatusDONE,
+	} {
+		subject.Iteration.builds.Store(name, &Build{ComponentType: name, Status: status})
+	}
+
+	status, err := subject.IterationStatus(context.TODO())
+	checkError(t, err)
+
+	expected := &IterationStatus{
+		BucketSlug:  "TestBucket",
+		IterationID: "iteration-id",
+		Builds: map[string]models.HashicorpCloudPackerBuildStatus{
+			"happycloud.image":   models.HashicorpCloudPackerBuildStatusRUNNING,
+			"happycloud.image2":  models.HashicorpCloudPackerBuildStatusDONE,
+			"happycloud.another": models.HashicorpCloudPackerBuildStatusDONE,
+		},
+		Channels: []string{"latest", "staging"},
+	}
+	if diff := cmp.Diff(expected, status); diff != "" {
+		t.Errorf("unexpected iteration status: %s", diff)
+	}
+
+	if !status.SiblingBuildsDone("happycloud.image") {
+		t.Errorf("expected the siblings of happycloud.image to be done")
+	}
+	if status.SiblingBuildsDone("happycloud.image2") {
+		t.Errorf("expected happycloud.image to be a sibling of happycloud.image2 not done")
+	}
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HCPTargetName is the name of the HCP Packer registry in the results of the
+// publication of a build, see TargetResult.
+const HCPTargetName = "HCP Packer registry"
+
+// Target is a registry receiving the metadata of the completed builds of an
+// iteration, in addition to the HCP Packer registry. See Bucket.Targets.
+type Target interface {
+	// Name identifies the target in the messages of Packer.
+	Name() string
+	// PublishBuild publishes a completed build.
+	PublishBuild(ctx context.Context, build PublishedBuild) error
+}
+
+// PublishedBuild is the metadata of a completed build sent to the Targets of a
+// bucket.
+type PublishedBuild struct {
+	BucketSlug  string       `json:"bucket_slug"`
+	IterationID string       `json:"iteration_id"`
+	Fingerprint string       `json:"fingerprint"`
+	RunUUID     string       `json:"run_uuid"`
+	Build       WebhookBuild `json:"build"`
+}
+
+// FileTarget writes the metadata of each build to a JSON file, at
+// <Path>/<bucket>/<fingerprint>/<component type>.json, replacing the file of a
+// previous run for the same fingerprint.
+type FileTarget struct {
+	Path string
+}
+
+func (t *FileTarget) Name() string {
+	return "file " + t.Path
+}
+
+func (t *FileTarget) PublishBuild(_ context.Context, build PublishedBuild) error {
+	dir := filepath.Join(t.Path, build.BucketSlug, build.Fingerprint)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(build, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The file is renamed once written so that readers never see a partial
+	// build.
+	f, err := os.CreateTemp(dir, ".build-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, build.Build.ComponentType+".json"))
+}
+
+// TargetFailurePolicy tells which failures to publish a build to the targets
+// of a bucket, the HCP Packer registry included, fail the build.
+type TargetFailurePolicy string
+
+const (
+	// TargetFailureAny fails the build when publishing to any target failed.
+	TargetFailureAny TargetFailurePolicy = "any"
+	// TargetFailureAll only fails the build when publishing to every target
+	// failed.
+	TargetFailureAll TargetFailurePolicy = "all"
+	// TargetFailureNone never fails the build, the failures are only reported.
+	TargetFailureNone TargetFailurePolicy = "none"
+)
+
+func (p TargetFailurePolicy) Validate() error {
+	switch p {
+	case "", TargetFailureAny, TargetFailureAll, TargetFailureNone:
+		return nil
+	}
+	return fmt.Errorf("unknown target failure policy %q, expected one of %q, %q or %q",
+		p, TargetFailureAny, TargetFailureAll, TargetFailureNone)
+}
+
+// TargetResult is the outcome of publishing a build to a target.
+type TargetResult struct {
+	Target string
+	Err    error
+}
+
+// Check returns an error listing the failed targets of results when they fail
+// the build according to the policy. Defaults to TargetFailureAny.
+func (p TargetFailurePolicy) Check(results []TargetResult) error {
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Target, r.Err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	switch p {
+	case TargetFailureNone:
+		return nil
+	case TargetFailureAll:
+		if len(failed) < len(results) {
+			return nil
+		}
+	}
+	if len(failed) == 1 {
+		return fmt.Errorf("failed to publish to the %s", failed[0])
+	}
+	return fmt.Errorf("failed to publish to %d targets:\n* %s", len(failed), strings.Join(failed, "\n* "))
+}
+
+// PublishBuildToTargets publishes the completed build referred to by name to
+// the Targets of the bucket, concurrently, whether publishing it to the HCP
+// Packer registry succeeded or not. It returns the result of each
+// target, in the order of Targets.
+func (b *Bucket) PublishBuildToTargets(ctx context.Context, name string) []TargetResult {
+	if len(b.Targets) == 0 {
+		return nil
+	}
+
+	results := make([]TargetResult, len(b.Targets))
+	build, ok := b.Iteration.builds.Get(name)
+	if !ok {
+		err := fmt.Errorf("no build for the component %q associated to the iteration %q", name, b.Iteration.ID)
+		for i, t := range b.Targets {
+			results[i] = TargetResult{Target: t.Name(), Err: err}
+		}
+		return results
+	}
+	published := PublishedBuild{
+		BucketSlug:  b.Slug,
+		IterationID: b.Iteration.ID,
+		Fingerprint: b.Iteration.Fingerprint,
+		RunUUID:     b.Iteration.RunUUID,
+		Build:       newWebhookBuild(build),
+	}
+
+	var wg sync.WaitGroup
+	for i, t := range b.Targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			results[i] = TargetResult{Target: t.Name(), Err: t.PublishBuild(ctx, published)}
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+)
+
+type failingTarget struct{}
+
+func (failingTarget) Name() string { return "failing" }
+
+func (failingTarget) PublishBuild(context.Context, PublishedBuild) error {
+	return errors.New("unreachable")
+}
+
+func TestBucket_PublishBuildToTargets(t *testing.T) {
+	dir := t.TempDir()
+	subject := createInitialBucket(t)
+	subject.Iteration.ID = "iteration-id"
+	subject.Iteration.RunUUID = "run-uuid"
+	subject.Targets = []Target{&FileTarget{Path: dir}, failingTarget{}}
+
+	name := "happycloud.image"
+	subject.RegisterBuildForComponent(name)
+	subject.Iteration.builds.Store(name, &Build{
+		ID:            "build-id",
+		ComponentType: name,
+		Labels:        map[string]string{"version": "1.7.0"},
+		Images:        map[string]registryimage.Image{},
+	})
+	checkError(t, subject.UpdateImageForBuild(name, registryimage.Image{
+		ImageID:        "image-id",
+		ProviderName:   "happycloud",
+		ProviderRegion: "west",
+	}))
+
+	results := subject.PublishBuildToTargets(context.TODO(), name)
+	if len(results) != 2 {
+		t.Fatalf("expected a result per target, got %v", results)
+	}
+	if results[0].Target != "file "+dir || results[0].Err != nil {
+		t.Errorf("expected the file target to succeed, got %v", results[0])
+	}
+	if results[1].Target != "failing" || results[1].Err == nil {
+		t.Errorf("expected the failing target to fail, got %v", results[1])
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "TestBucket", subject.Iteration.Fingerprint, name+".json"))
+	if err != nil {
+		t.Fatalf("expected the build to be written: %s", err)
+	}
+	var got PublishedBuild
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to decode the build: %s", err)
+	}
+	expected := PublishedBuild{
+		BucketSlug:  "TestBucket",
+		IterationID: "iteration-id",
+		Fingerprint: subject.Iteration.Fingerprint,
+		RunUUID:     "run-uuid",
+		Build: WebhookBuild{
+			ID:            "build-id",
+			ComponentType: name,
+			CloudProvider: "happycloud",
+			Labels:        map[string]string{"version": "1.7.0"},
+			Images:        []WebhookImage{{ImageID: "image-id", Region: "west"}},
+		},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected build: %s", diff)
+	}
+}
+
+func TestTargetFailurePolicy_Check(t *testing.T) {
+	ok := TargetResult{Target: HCPTargetName}
+	failed := TargetResult{Target: "file /registry", Err: errors.New("read-only file system")}
+
+	tests := []struct {
+		policy  TargetFailurePolicy
+		results []TargetResult
+		wantErr string
+	}{
+		{"", []TargetResult{ok, ok}, ""},
+		{"", []TargetResult{ok, failed}, "failed to publish to the file /registry: read-only file system"},
+		{TargetFailureAny, []TargetResult{failed, failed}, "failed to publish to 2 targets"},
+		{TargetFailureAll, []TargetResult{ok, failed}, ""},
+		{TargetFailureAll, []TargetResult{failed, failed}, "failed to publish to 2 targets"},
+		{TargetFailureNone, []TargetResult{failed, failed}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.policy.Check(tt.results)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%q: unexpected error: %s", tt.policy, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%q: expected an error containing %q, got %v", tt.policy, tt.wantErr, err)
+		}
+	}
+
+	if err := TargetFailurePolicy("first").Validate(); err == nil {
+		t.Error("expected an unknown policy to be invalid")
+	}
+}
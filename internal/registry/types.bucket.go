@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
@@ -22,16 +24,99 @@ type Bucket struct {
 	Destination  string
 	BucketLabels map[string]string
 	BuildLabels  map[string]string
-	Iteration    *Iteration
+	// IterationLabels describe the iteration as a whole, like a release version. The HCP Packer registry does not
+	// store labels on iterations, so they are attached to every build of the iteration, see Initialize.
+	IterationLabels map[string]string
+	Iteration       *Iteration
+	// UploadBuildLogs enables storing the log of each build in its labels, see UpdateLogForBuild.
+	UploadBuildLogs bool
+	// HashArtifactFiles enables recording the SHA256 of the local files of the artifacts of each build in its
+	// ChecksumsLabel. The digests reported by the plugins are always recorded.
+	HashArtifactFiles bool
+	// BuildLabelsResolver, when set, returns the build labels that can only be known once a build completed, from the
+	// data generated by the build. See ResolveLabelsForBuild.
+	BuildLabelsResolver func(componentType string, generatedData map[string]interface{}) (map[string]string, error)
+	// ForceRebuild runs again the builds already marked as DONE in the iteration, replacing their images.
+	ForceRebuild bool
+	// ConcurrentBuildsWait, when set, is how long PopulateIteration waits for the builds of the iteration running in
+	// another Packer run to complete, rather than running them again. This lets several pipeline jobs contribute
+	// builds to the same iteration. See waitForConcurrentBuilds.
+	ConcurrentBuildsWait time.Duration
+	// LockIteration, when set, makes PopulateIteration fail when another Packer run is running builds of the
+	// iteration, once done waiting for them, rather than running them again. See checkIterationLock.
+	LockIteration bool
+	// OnCompleteWebhook, when set, is notified once all the required builds of the iteration are done.
+	OnCompleteWebhook *Webhook
+	// Publish are the channels the iteration is promoted to once complete, see PublishIteration.
+	Publish []PublishRule
+	// Pipeline, when set, links the iteration to the iteration it is built from, see initializePipeline.
+	Pipeline *Pipeline
+	// ExpiresAfter, when set, records on the iteration when its images should be rotated, in its ExpiresAtLabel.
+	ExpiresAfter time.Duration
+	// FingerprintCollision is what to do when an iteration already exists for the fingerprint. Defaults to
+	// FingerprintCollisionReuse.
+	FingerprintCollision FingerprintCollision
+	// Targets receive the metadata of the completed builds in addition to the HCP Packer registry, see
+	// PublishBuildToTargets.
+	Targets []Target
+	// TargetFailure tells which failures to publish a build to the HCP Packer registry and to the Targets fail the
+	// build. Defaults to TargetFailureAny.
+	TargetFailure TargetFailurePolicy
+	// Owner owns the builds of the components not in ComponentOwners. The owner of a build is recorded in its owner
+	// labels, see OwnerTeamLabel, and the bucket can require some of them, see RequiredOwnerLabel.
+	Owner *Owner
+	// ComponentOwners are the owners of the builds, by component type.
+	ComponentOwners map[string]*Owner
+	// RequiredBuilds are the component types of the builds required for the iteration to be complete; the other builds
+	// are optional, like experimental ones. All the builds are required when empty. See IterationCompletion.
+	RequiredBuilds []string
+	// PartialRun is what to do when only some of the registered builds are selected to run, see
+	// SelectBuildForComponent. Defaults to PartialRunContribute.
+	PartialRun PartialRun
+	// ClientConfig, when set, configures the client to the HCP Packer registry, regardless of the environment. See
+	// NewClientWithConfig.
+	ClientConfig *ClientConfig
 	client       *Client
+
+	// requiredOwner are the fields of the Owner required by the bucket, see loadOwnerPolicy.
+	requiredOwner []string
+	// selectedBuilds are the registered builds selected to run, see SelectBuildForComponent.
+	selectedBuilds []string
+	// scopedBuilds is the ScopedBuildsLabel of a scoped iteration, see applyPartialRun.
+	scopedBuilds string
+
+	webhookLock     sync.Mutex
+	webhookNotified bool
+}
+
+// FingerprintCollision is the strategy used when an iteration already exists for the fingerprint of a run.
+type FingerprintCollision string
+
+const (
+	// FingerprintCollisionReuse adds the builds to the existing iteration.
+	FingerprintCollisionReuse FingerprintCollision = "reuse"
+	// FingerprintCollisionFail errors out.
+	FingerprintCollisionFail FingerprintCollision = "fail"
+	// FingerprintCollisionNew creates a new iteration, salting the fingerprint with the run UUID.
+	FingerprintCollisionNew FingerprintCollision = "new"
+)
+
+func (s FingerprintCollision) Validate() error {
+	switch s {
+	case "", FingerprintCollisionReuse, FingerprintCollisionFail, FingerprintCollisionNew:
+		return nil
+	}
+	return fmt.Errorf("unknown fingerprint collision strategy %q, expected one of %q, %q or %q",
+		s, FingerprintCollisionReuse, FingerprintCollisionFail, FingerprintCollisionNew)
 }
 
 // NewBucketWithIteration initializes a simple Bucket that can be used publishing Packer build
 // images to the HCP Packer registry.
 func NewBucketWithIteration(opts IterationOptions) (*Bucket, error) {
 	b := Bucket{
-		BucketLabels: make(map[string]string),
-		BuildLabels:  make(map[string]string),
+		BucketLabels:    make(map[string]string),
+		BuildLabels:     make(map[string]string),
+		IterationLabels: make(map[string]string),
 	}
 
 	i, err := NewIteration(opts)
@@ -47,6 +132,21 @@ func (b *Bucket) Validate() error {
 	if b.Slug == "" {
 		return fmt.Errorf("no Packer bucket name defined; either the environment variable %q is undefined or the HCL configuration has no build name", env.HCPPackerBucket)
 	}
+	if err := b.FingerprintCollision.Validate(); err != nil {
+		return err
+	}
+	if err := b.TargetFailure.Validate(); err != nil {
+		return err
+	}
+	if err := b.PartialRun.Validate(); err != nil {
+		return err
+	}
+	if err := ValidatePublishRules(b.Publish); err != nil {
+		return err
+	}
+	if b.Pipeline != nil {
+		return b.Pipeline.Validate()
+	}
 	return nil
 }
 
@@ -57,7 +157,13 @@ func (b *Bucket) connect() error {
 		return nil
 	}
 
-	registryClient, err := NewClient()
+	var registryClient *Client
+	var err error
+	if b.ClientConfig != nil {
+		registryClient, err = NewClientWithConfig(*b.ClientConfig)
+	} else {
+		registryClient, err = NewClient()
+	}
 	if err != nil {
 		return errors.New("Failed to create client connection to artifact registry: " + err.Error())
 	}
@@ -68,11 +174,20 @@ func (b *Bucket) connect() error {
 // Initialize registers the Bucket b with the configured HCP Packer Registry.
 // Upon initialization a Bucket will be upserted to, and new iteration will be created for the build if the configured
 // fingerprint has no associated iterations. Lastly, the initialization process with register the builds that need to be
-// completed before an iteration can be marked as DONE.
+// completed before an iteration can be marked as DONE. The iteration labels, and the labels linking the iteration to
+// its pipeline, are set on the iteration, and published with every build created for it. When only some of the
+// registered builds are selected to run, the PartialRun of the bucket applies. When only some builds are required, they
+// are listed in the RequiredBuildsLabel of the iteration.
 //
 // b.Initialize() must be called before any data can be published to the configured HCP Packer Registry.
 // TODO ensure initialize can only be called once
 func (b *Bucket) Initialize(ctx context.Context) error {
+	if err := b.checkRequiredBuilds(); err != nil {
+		return err
+	}
+	if err := b.applyPartialRun(); err != nil {
+		return err
+	}
 
 	if err := b.connect(); err != nil {
 		return err
@@ -80,12 +195,33 @@ func (b *Bucket) Initialize(ctx context.Context) error {
 
 	b.Destination = fmt.Sprintf("%s/%s", b.client.OrganizationID, b.client.ProjectID)
 
+	if err := b.loadOwnerPolicy(ctx); err != nil {
+		return err
+	}
+
 	err := b.client.UpsertBucket(ctx, b.Slug, b.Description, b.BucketLabels)
 	if err != nil {
 		return fmt.Errorf("failed to initialize bucket %q: %w", b.Slug, err)
 	}
 
-	return b.initializeIteration(ctx)
+	if err := b.initializeIteration(ctx); err != nil {
+		return err
+	}
+
+	b.Iteration.Labels = make(map[string]string, len(b.IterationLabels))
+	for k, v := range b.IterationLabels {
+		b.Iteration.Labels[k] = v
+	}
+	if b.scopedBuilds != "" {
+		b.Iteration.Labels[ScopedBuildsLabel] = b.scopedBuilds
+	}
+	if required := b.requiredBuilds(); len(required) < len(b.Iteration.expectedBuilds) {
+		b.Iteration.Labels[RequiredBuildsLabel] = strings.Join(required, ",")
+	}
+	if b.ExpiresAfter > 0 {
+		b.Iteration.Labels[ExpiresAtLabel] = expiresAt(time.Now(), b.ExpiresAfter)
+	}
+	return b.initializePipeline(ctx)
 }
 
 func (b *Bucket) RegisterBuildForComponent(sourceName string) {
@@ -93,7 +229,7 @@ func (b *Bucket) RegisterBuildForComponent(sourceName string) {
 		return
 	}
 
-	if _, ok := b.Iteration.builds.Load(sourceName); ok {
+	if _, ok := b.Iteration.builds.Get(sourceName); ok {
 		return
 	}
 	b.Iteration.expectedBuilds = append(b.Iteration.expectedBuilds, sourceName)
@@ -126,9 +262,16 @@ func (b *Bucket) CreateInitialBuildForIteration(ctx context.Context, componentTy
 		Images:        make(map[string]registryimage.Image),
 	}
 
+	// Build labels take precedence over the labels of the iteration.
+	for k, v := range b.Iteration.Labels {
+		build.Labels[k] = v
+	}
 	for k, v := range b.BuildLabels {
 		build.Labels[k] = v
 	}
+	for k, v := range b.OwnerOf(componentType).labels() {
+		build.Labels[k] = v
+	}
 
 	log.Println("[TRACE] creating initial build for component", componentType)
 	b.Iteration.builds.Store(componentType, &build)
@@ -137,57 +280,106 @@ func (b *Bucket) CreateInitialBuildForIteration(ctx context.Context, componentTy
 }
 
 // UpdateBuildStatus updates the status of a build entry on the HCP Packer registry with its current local status.
+// The labels of the build are sent along: the registry replaces the labels of the build with the ones of an update, so
+// all of them are sent, for the labels removed locally to be removed from the registry too. The update is skipped when
+// neither the status nor the labels changed since the last update.
 func (b *Bucket) UpdateBuildStatus(ctx context.Context, name string, status models.HashicorpCloudPackerBuildStatus) error {
 	if status == models.HashicorpCloudPackerBuildStatusDONE {
 		return b.markBuildComplete(ctx, name)
 	}
 
 	// Lets check if we have something already for this build
-	build, ok := b.Iteration.builds.Load(name)
+	buildToUpdate, ok := b.Iteration.builds.Get(name)
 	if !ok {
 		return fmt.Errorf("no build for the component %q associated to the iteration %q", name, b.Iteration.ID)
 	}
 
-	buildToUpdate, ok := build.(*Build)
-	if !ok {
-		return fmt.Errorf("the build for the component %q does not appear to be a valid registry Build", name)
-	}
-
 	if buildToUpdate.ID == "" {
 		return fmt.Errorf("the build for the component %q does not have a valid id", name)
 	}
 
+	if buildToUpdate.Status == status && !buildToUpdate.labelsChanged() {
+		log.Printf("[TRACE] the build of %q is already %s on the HCP Packer registry; skipping the update", name, status)
+		return nil
+	}
+	labels := buildToUpdate.Labels
+
 	_, err := b.client.UpdateBuild(ctx,
 		buildToUpdate.ID,
 		buildToUpdate.RunUUID,
 		buildToUpdate.CloudProvider,
 		"",
-		buildToUpdate.Labels,
+		labels,
 		status,
 		nil,
 	)
 	if err != nil {
 		return err
 	}
-	buildToUpdate.Status = status
-	b.Iteration.builds.Store(name, buildToUpdate)
-	return nil
+	return b.Iteration.builds.Update(name, func(build *Build) error {
+		build.Status = status
+		build.labelsSynced(labels)
+		return nil
+	})
+}
+
+// CancellationReason describes why a build was cancelled, from the error of its cancelled context.
+func CancellationReason(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "the build timed out"
+	case errors.Is(err, context.Canceled):
+		return "the build was interrupted"
+	case err != nil:
+		return err.Error()
+	}
+	return "the build was cancelled"
+}
+
+// MarkBuildCancelled sets the build referred to by name to CANCELLED on the HCP Packer registry, recording reason in
+// its BuildCancellationReasonLabel label. The context of an interrupted build is already cancelled, so ctx should not
+// be derived from it.
+func (b *Bucket) MarkBuildCancelled(ctx context.Context, name, reason string) error {
+	if err := b.Iteration.SetBuildCancellationReason(name, reason); err != nil {
+		return err
+	}
+	return b.UpdateBuildStatus(ctx, name, models.HashicorpCloudPackerBuildStatusCANCELLED)
+}
+
+// CancelPendingBuilds marks every build of the iteration that did not complete, either because it never started or
+// because it was still running, as CANCELLED with reason. It is used once Packer is interrupted, so that no build is
+// left dangling on the HCP Packer registry.
+func (b *Bucket) CancelPendingBuilds(ctx context.Context, reason string) error {
+	var errs *multierror.Error
+	b.Iteration.builds.Range(func(name string, build *Build) bool {
+		if build.ID == "" {
+			return true
+		}
+		switch build.Status {
+		case models.HashicorpCloudPackerBuildStatusDONE,
+			models.HashicorpCloudPackerBuildStatusFAILED,
+			models.HashicorpCloudPackerBuildStatusCANCELLED:
+			return true
+		}
+		if err := b.MarkBuildCancelled(ctx, name, reason); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to cancel the build of %q: %w", name, err))
+		}
+		return true
+	})
+	return errs.ErrorOrNil()
 }
 
 // markBuildComplete should be called to set a build on the HCP Packer registry to DONE.
 // Upon a successful call markBuildComplete will publish all images created by the named build,
 // and set the registry build to done. A build with no images can not be set to DONE.
+// Once all the required builds of the iteration are done, the OnCompleteWebhook is notified; a *WebhookError is
+// returned when that notification fails, the build is DONE nonetheless.
 func (b *Bucket) markBuildComplete(ctx context.Context, name string) error {
-	build, ok := b.Iteration.builds.Load(name)
+	buildToUpdate, ok := b.Iteration.builds.Get(name)
 	if !ok {
 		return fmt.Errorf("no build for the component %q associated to the iteration %q", name, b.Iteration.ID)
 	}
 
-	buildToUpdate, ok := build.(*Build)
-	if !ok {
-		return fmt.Errorf("the build for the component %q does not appear to be a valid registry Build", name)
-	}
-
 	if buildToUpdate.ID == "" {
 		return fmt.Errorf("the build for the component %q does not have a valid id", name)
 	}
@@ -203,6 +395,7 @@ func (b *Bucket) markBuildComplete(ctx context.Context, name string) error {
 		return fmt.Errorf("setting a build to DONE with no published images is not currently supported.")
 	}
 
+	labels := buildToUpdate.Labels
 	var providerName, sourceID string
 	images := make([]*models.HashicorpCloudPackerImageCreateBody, 0, len(buildToUpdate.Images))
 	for _, image := range buildToUpdate.Images {
@@ -223,7 +416,7 @@ func (b *Bucket) markBuildComplete(ctx context.Context, name string) error {
 		buildToUpdate.RunUUID,
 		buildToUpdate.CloudProvider,
 		sourceID,
-		buildToUpdate.Labels,
+		labels,
 		status,
 		images,
 	)
@@ -231,9 +424,15 @@ func (b *Bucket) markBuildComplete(ctx context.Context, name string) error {
 		return err
 	}
 
-	buildToUpdate.Status = status
-	b.Iteration.builds.Store(name, buildToUpdate)
-	return nil
+	err = b.Iteration.builds.Update(name, func(build *Build) error {
+		build.Status = status
+		build.labelsSynced(labels)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return b.notifyIterationComplete(ctx)
 }
 
 // UpdateImageForBuild appends one or more images artifacts to the build referred to by componentType.
@@ -242,10 +441,34 @@ func (b *Bucket) UpdateImageForBuild(componentType string, images ...registryima
 }
 
 // UpdateLabelsForBuild merges the contents of data to the labels associated with the build referred to by componentType.
+// The labels are not sent on their own: they are sent with the next status update of the build, so that the labels
+// changed in a row, like the ones of successive provisioners, cost no API call. Every build ends with a status update,
+// DONE, FAILED or CANCELLED, sending the labels changed until then before the run exits.
 func (b *Bucket) UpdateLabelsForBuild(componentType string, data map[string]string) error {
 	return b.Iteration.AddLabelsToBuild(componentType, data)
 }
 
+// ResolveLabelsForBuild merges the labels returned by BuildLabelsResolver, for the data generated by the build referred
+// to by componentType, to the labels associated with the build.
+func (b *Bucket) ResolveLabelsForBuild(componentType string, generatedData map[string]interface{}) error {
+	if b.BuildLabelsResolver == nil {
+		return nil
+	}
+
+	labels, err := b.BuildLabelsResolver(componentType, generatedData)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the build labels of %q: %w", componentType, err)
+	}
+
+	return b.UpdateLabelsForBuild(componentType, labels)
+}
+
+// UpdateLogForBuild stores the log of the build referred to by componentType; it will be published with the next
+// status update of the build.
+func (b *Bucket) UpdateLogForBuild(componentType string, buildLog string) error {
+	return b.Iteration.SetBuildLog(componentType, buildLog)
+}
+
 // Load defaults from environment variables
 func (b *Bucket) LoadDefaultSettingsFromEnv() {
 	// Configure HCP Packer Registry destination
@@ -283,6 +506,20 @@ func (b *Bucket) createIteration() (*models.HashicorpCloudPackerIteration, error
 func (b *Bucket) initializeIteration(ctx context.Context) error {
 	// load existing iteration using fingerprint.
 	iteration, err := b.client.GetIteration(ctx, b.Slug, GetIteration_byFingerprint(b.Iteration.Fingerprint))
+	if err == nil && iteration != nil {
+		switch b.FingerprintCollision {
+		case FingerprintCollisionFail:
+			return fmt.Errorf("the iteration %s already exists for the fingerprint %s. "+
+				"Change the build fingerprint, or set the fingerprint collision strategy to %q or %q.",
+				iteration.ID, b.Iteration.Fingerprint, FingerprintCollisionReuse, FingerprintCollisionNew)
+		case FingerprintCollisionNew:
+			fingerprint := saltFingerprint(b.Iteration.Fingerprint, b.Iteration.RunUUID)
+			log.Printf("[TRACE] the iteration %s already exists for the fingerprint %s, creating a new iteration with the fingerprint %s",
+				iteration.ID, b.Iteration.Fingerprint, fingerprint)
+			b.Iteration.Fingerprint = fingerprint
+			iteration, err = b.createIteration()
+		}
+	}
 	if checkErrorCode(err, codes.Aborted) {
 		// probably means Iteration doesn't exist need a way to check the error
 		iteration, err = b.createIteration()
@@ -310,17 +547,41 @@ func (b *Bucket) initializeIteration(ctx context.Context) error {
 	return nil
 }
 
+// saltFingerprint returns a fingerprint unique to the run, derived from fingerprint.
+func saltFingerprint(fingerprint, runUUID string) string {
+	salt := runUUID
+	if salt == "" {
+		salt = time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return fingerprint + "-" + salt
+}
+
 // populateIteration populates the bucket iteration with the details needed for tracking builds for a Packer run.
 // If an existing Packer registry iteration exists for the said iteration fingerprint, calling initialize on iteration
 // that doesn't yet exist will call createIteration to create the entry on the HCP packer registry for the given bucket.
 // All build details will be created (if they don't exists) and added to b.Iteration.builds for tracking during runtime.
 func (b *Bucket) PopulateIteration(ctx context.Context) error {
+	if err := b.checkOwners(); err != nil {
+		return err
+	}
+
 	// list all this iteration's builds so we can figure out which ones
 	// we want to run against. TODO: pagination?
 	existingBuilds, err := b.client.ListBuilds(ctx, b.Slug, b.Iteration.ID)
 	if err != nil {
 		return fmt.Errorf("error listing builds for this existing iteration: %s", err)
 	}
+	if b.ConcurrentBuildsWait > 0 {
+		existingBuilds, err = b.waitForConcurrentBuilds(ctx, existingBuilds)
+		if err != nil {
+			return fmt.Errorf("error waiting for the builds of this iteration running in another Packer run: %s", err)
+		}
+	}
+	if b.LockIteration {
+		if err := b.checkIterationLock(existingBuilds); err != nil {
+			return err
+		}
+	}
 
 	var toCreate []string
 	for _, expected := range b.Iteration.expectedBuilds {
@@ -333,7 +594,15 @@ func (b *Bucket) PopulateIteration(ctx context.Context) error {
 					ComponentType: existing.ComponentType,
 					RunUUID:       b.Iteration.RunUUID,
 					Status:        existing.Status,
-					Labels:        existing.Labels,
+					Labels:        make(map[string]string, len(existing.Labels)),
+				}
+				for k, v := range existing.Labels {
+					build.Labels[k] = v
+				}
+				build.labelsSynced(existing.Labels)
+				// Sent with the next update of the build, when it is run again.
+				for k, v := range b.OwnerOf(existing.ComponentType).labels() {
+					build.Labels[k] = v
 				}
 				b.Iteration.builds.Store(existing.ComponentType, build)
 
@@ -392,15 +661,28 @@ func (b *Bucket) PopulateIteration(ctx context.Context) error {
 // and is not marked as DONE on the HCP Packer registry.
 func (b *Bucket) IsExpectingBuildForComponent(buildName string) bool {
 
-	v, ok := b.Iteration.builds.Load(buildName)
+	build, ok := b.Iteration.builds.Get(buildName)
 	if !ok {
 		return false
 	}
 
-	build := v.(*Build)
 	hasBuildID := build.ID != ""
+	if b.ForceRebuild {
+		return hasBuildID
+	}
+
 	hasImages := len(build.Images) == 0
 	isNotDone := build.Status != models.HashicorpCloudPackerBuildStatusDONE
 
 	return hasBuildID && hasImages && isNotDone
 }
+
+// ResetBuildForComponent forgets the images and the status of the build referred to by buildName, so that a forced
+// rebuild publishes its own images only. See ForceRebuild.
+func (b *Bucket) ResetBuildForComponent(buildName string) error {
+	return b.Iteration.builds.Update(buildName, func(build *Build) error {
+		build.Images = make(map[string]registryimage.Image)
+		build.Status = models.HashicorpCloudPackerBuildStatusUNSET
+		return nil
+	})
+}
@@ -4,15 +4,18 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"github.com/hashicorp/packer/packer/registrytest"
 )
 
 func TestInitialize_NewBucketNewIteration(t *testing.T) {
 	//nolint:errcheck
 	os.Setenv("HCP_PACKER_BUILD_FINGEPRINT", "testnumber")
 	defer os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
-	mockService := NewMockPackerClientService()
+	mockService := registrytest.NewMockPackerClientService()
 
 	b := &Bucket{
 		Slug: "TestBucket",
@@ -58,7 +61,7 @@ func TestInitialize_NewBucketNewIteration(t *testing.T) {
 		t.Errorf("Expected a call to CreateBuild but it didn't happen")
 	}
 
-	if _, ok := b.Iteration.builds.Load("happycloud.image"); !ok {
+	if _, ok := b.Iteration.builds.Get("happycloud.image"); !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
@@ -68,7 +71,7 @@ func TestInitialize_ExistingBucketNewIteration(t *testing.T) {
 	//nolint:errcheck
 	os.Setenv("HCP_PACKER_BUILD_FINGEPRINT", "testnumber")
 	defer os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
-	mockService := NewMockPackerClientService()
+	mockService := registrytest.NewMockPackerClientService()
 	mockService.BucketAlreadyExist = true
 
 	b := &Bucket{
@@ -115,7 +118,7 @@ func TestInitialize_ExistingBucketNewIteration(t *testing.T) {
 		t.Errorf("Expected a call to CreateBuild but it didn't happen")
 	}
 
-	if _, ok := b.Iteration.builds.Load("happycloud.image"); !ok {
+	if _, ok := b.Iteration.builds.Get("happycloud.image"); !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
@@ -125,7 +128,7 @@ func TestInitialize_ExistingBucketExistingIteration(t *testing.T) {
 	//nolint:errcheck
 	os.Setenv("HCP_PACKER_BUILD_FINGEPRINT", "testnumber")
 	defer os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
-	mockService := NewMockPackerClientService()
+	mockService := registrytest.NewMockPackerClientService()
 	mockService.BucketAlreadyExist = true
 	mockService.IterationAlreadyExist = true
 
@@ -182,16 +185,11 @@ func TestInitialize_ExistingBucketExistingIteration(t *testing.T) {
 	if err != nil {
 		t.Errorf("unexpected failure: %v", err)
 	}
-	loadedBuild, ok := b.Iteration.builds.Load("happycloud.image")
+	existingBuild, ok := b.Iteration.builds.Get("happycloud.image")
 	if !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
-	existingBuild, ok := loadedBuild.(*Build)
-	if !ok {
-		t.Errorf("expected the existing build loaded from an existing bucket to be valid")
-	}
-
 	if existingBuild.Status != models.HashicorpCloudPackerBuildStatusUNSET {
 		t.Errorf("expected the existing build to be in the default state")
 	}
@@ -201,7 +199,7 @@ func TestInitialize_ExistingBucketCompleteIteration(t *testing.T) {
 	//nolint:errcheck
 	os.Setenv("HCP_PACKER_BUILD_FINGEPRINT", "testnumber")
 	defer os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
-	mockService := NewMockPackerClientService()
+	mockService := registrytest.NewMockPackerClientService()
 	mockService.BucketAlreadyExist = true
 	mockService.IterationAlreadyExist = true
 	mockService.IterationCompleted = true
@@ -249,7 +247,7 @@ func TestUpdateBuildStatus(t *testing.T) {
 	//nolint:errcheck
 	os.Setenv("HCP_PACKER_BUILD_FINGEPRINT", "testnumber")
 	defer os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
-	mockService := NewMockPackerClientService()
+	mockService := registrytest.NewMockPackerClientService()
 	mockService.BucketAlreadyExist = true
 	mockService.IterationAlreadyExist = true
 
@@ -278,16 +276,11 @@ func TestUpdateBuildStatus(t *testing.T) {
 		t.Errorf("unexpected failure: %v", err)
 	}
 
-	loadedBuild, ok := b.Iteration.builds.Load("happycloud.image")
+	existingBuild, ok := b.Iteration.builds.Get("happycloud.image")
 	if !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
-	existingBuild, ok := loadedBuild.(*Build)
-	if !ok {
-		t.Errorf("expected the existing build loaded from an existing bucket to be valid")
-	}
-
 	if existingBuild.Status != models.HashicorpCloudPackerBuildStatusUNSET {
 		t.Errorf("expected the existing build to be in the default state")
 	}
@@ -297,16 +290,11 @@ func TestUpdateBuildStatus(t *testing.T) {
 		t.Errorf("unexpected failure for PublishBuildStatus: %v", err)
 	}
 
-	reloadedBuild, ok := b.Iteration.builds.Load("happycloud.image")
+	existingBuild, ok = b.Iteration.builds.Get("happycloud.image")
 	if !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
-	existingBuild, ok = reloadedBuild.(*Build)
-	if !ok {
-		t.Errorf("expected the existing build loaded from an existing bucket to be valid")
-	}
-
 	if existingBuild.Status != models.HashicorpCloudPackerBuildStatusRUNNING {
 		t.Errorf("expected the existing build to be in the running state")
 	}
@@ -316,7 +304,7 @@ func TestUpdateBuildStatus_DONENoImages(t *testing.T) {
 	//nolint:errcheck
 	os.Setenv("HCP_PACKER_BUILD_FINGEPRINT", "testnumber")
 	defer os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
-	mockService := NewMockPackerClientService()
+	mockService := registrytest.NewMockPackerClientService()
 	mockService.BucketAlreadyExist = true
 	mockService.IterationAlreadyExist = true
 
@@ -345,16 +333,11 @@ func TestUpdateBuildStatus_DONENoImages(t *testing.T) {
 		t.Errorf("unexpected failure: %v", err)
 	}
 
-	loadedBuild, ok := b.Iteration.builds.Load("happycloud.image")
+	existingBuild, ok := b.Iteration.builds.Get("happycloud.image")
 	if !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
-	existingBuild, ok := loadedBuild.(*Build)
-	if !ok {
-		t.Errorf("expected the existing build loaded from an existing bucket to be valid")
-	}
-
 	if existingBuild.Status != models.HashicorpCloudPackerBuildStatusUNSET {
 		t.Errorf("expected the existing build to be in the default state")
 	}
@@ -367,19 +350,145 @@ func TestUpdateBuildStatus_DONENoImages(t *testing.T) {
 		t.Errorf("expected failure for PublishBuildStatus when setting status to DONE with no images")
 	}
 
-	reloadedBuild, ok := b.Iteration.builds.Load("happycloud.image")
+	existingBuild, ok = b.Iteration.builds.Get("happycloud.image")
 	if !ok {
 		t.Errorf("expected a basic build entry to be created but it didn't")
 	}
 
-	existingBuild, ok = reloadedBuild.(*Build)
-	if !ok {
-		t.Errorf("expected the existing build loaded from an existing bucket to be valid")
-	}
-
 	if existingBuild.Status != models.HashicorpCloudPackerBuildStatusRUNNING {
 		t.Errorf("expected the existing build to be in the running state")
 	}
 }
 
 //func (b *Bucket) PublishBuildStatus(ctx context.Context, name string, status models.HashicorpCloudPackerBuildStatus) error {}
+
+func TestInitialize_IterationLabels(t *testing.T) {
+	mockService := registrytest.NewMockPackerClientService()
+
+	b := &Bucket{
+		Slug:            "TestBucket",
+		BuildLabels:     map[string]string{"version": "1.7.0"},
+		IterationLabels: map[string]string{"release": "2022.03", "version": "ignored"},
+		client: &Client{
+			Packer: mockService,
+		},
+	}
+
+	var err error
+	b.Iteration, err = NewIteration(IterationOptions{})
+	if err != nil {
+		t.Errorf("unexpected failure: %v", err)
+	}
+	b.Iteration.expectedBuilds = append(b.Iteration.expectedBuilds, "happycloud.image")
+
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if diff := cmp.Diff(b.IterationLabels, b.Iteration.Labels); diff != "" {
+		t.Errorf("expected the iteration to have the iteration labels: %s", diff)
+	}
+
+	if err := b.PopulateIteration(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	build, ok := b.Iteration.builds.Get("happycloud.image")
+	if !ok {
+		t.Fatalf("expected a build entry to be created")
+	}
+	expected := map[string]string{"release": "2022.03", "version": "1.7.0"}
+	if diff := cmp.Diff(expected, build.Labels); diff != "" {
+		t.Errorf("expected the build to have the iteration labels, overridden by the build labels: %s", diff)
+	}
+}
+
+func TestInitialize_ExpiresAfter(t *testing.T) {
+	mockService := registrytest.NewMockPackerClientService()
+
+	b := &Bucket{
+		Slug:         "TestBucket",
+		ExpiresAfter: 30 * 24 * time.Hour,
+		client: &Client{
+			Packer: mockService,
+		},
+	}
+
+	var err error
+	b.Iteration, err = NewIteration(IterationOptions{})
+	if err != nil {
+		t.Errorf("unexpected failure: %v", err)
+	}
+	b.Iteration.expectedBuilds = append(b.Iteration.expectedBuilds, "happycloud.image")
+
+	before := time.Now().Truncate(time.Second)
+	if err := b.Initialize(context.TODO()); err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	at, err := time.Parse(time.RFC3339, b.Iteration.Labels[ExpiresAtLabel])
+	if err != nil {
+		t.Fatalf("expected the iteration to have an expiry date: %v", err)
+	}
+	if at.Before(before.Add(b.ExpiresAfter)) || at.After(time.Now().Add(b.ExpiresAfter)) {
+		t.Errorf("expected the iteration to expire in 30 days, got %s", at)
+	}
+}
+
+func TestInitialize_FingerprintCollision(t *testing.T) {
+	tests := []struct {
+		strategy              FingerprintCollision
+		wantErr               bool
+		wantIterationID       string
+		wantSaltedFingerprint bool
+	}{
+		{"", false, "iteration-id", false},
+		{FingerprintCollisionReuse, false, "iteration-id", false},
+		{FingerprintCollisionFail, true, "", false},
+		{FingerprintCollisionNew, false, "new-iteration-id", true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			mockService := registrytest.NewMockPackerClientService()
+			mockService.BucketAlreadyExist = true
+			mockService.IterationAlreadyExist = true
+			mockService.CreateIterationResp.Iteration.ID = "new-iteration-id"
+
+			b := &Bucket{
+				Slug:                 "TestBucket",
+				FingerprintCollision: tt.strategy,
+				client: &Client{
+					Packer: mockService,
+				},
+			}
+
+			var err error
+			b.Iteration, err = NewIteration(IterationOptions{})
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+			b.Iteration.RunUUID = "run-uuid"
+			fingerprint := b.Iteration.Fingerprint
+			mockService.GetIterationResp.Iteration.Fingerprint = fingerprint
+
+			err = b.Initialize(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Initialize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if b.Iteration.ID != tt.wantIterationID {
+				t.Errorf("expected the iteration %q, got %q", tt.wantIterationID, b.Iteration.ID)
+			}
+			if mockService.CreateIterationCalled != tt.wantSaltedFingerprint {
+				t.Errorf("unexpected call to CreateIteration: %t", mockService.CreateIterationCalled)
+			}
+			expected := fingerprint
+			if tt.wantSaltedFingerprint {
+				expected = fingerprint + "-run-uuid"
+			}
+			if b.Iteration.Fingerprint != expected {
+				t.Errorf("expected the fingerprint %q, got %q", expected, b.Iteration.Fingerprint)
+			}
+		})
+	}
+}
@@ -2,10 +2,17 @@ package registry
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+	"github.com/hashicorp/packer/packer/registrytest"
 )
 
 func createInitialBucket(t testing.TB) *Bucket {
@@ -27,7 +34,7 @@ func createInitialBucket(t testing.TB) *Bucket {
 		"based_off": "alpine",
 	}
 	subject.client = &Client{
-		Packer: NewMockPackerClientService(),
+		Packer: registrytest.NewMockPackerClientService(),
 	}
 	return subject
 }
@@ -51,12 +58,7 @@ func TestBucket_CreateInitialBuildForIteration(t *testing.T) {
 	checkError(t, err)
 
 	// Assert that a build stored on the iteration
-	iBuild, ok := subject.Iteration.builds.Load(componentName)
-	if !ok {
-		t.Errorf("expected an initial build for %s to be created, but it failed", componentName)
-	}
-
-	build, ok := iBuild.(*Build)
+	build, ok := subject.Iteration.builds.Get(componentName)
 	if !ok {
 		t.Errorf("expected an initial build for %s to be created, but it failed", componentName)
 	}
@@ -109,12 +111,7 @@ func TestBucket_UpdateLabelsForBuild(t *testing.T) {
 				checkError(t, err)
 
 				// Assert that the build is stored on the iteration
-				iBuild, ok := subject.Iteration.builds.Load(componentName)
-				if !ok {
-					t.Errorf("expected an initial build for %s to be created, but it failed", componentName)
-				}
-
-				build, ok := iBuild.(*Build)
+				build, ok := subject.Iteration.builds.Get(componentName)
 				if !ok {
 					t.Errorf("expected an initial build for %s to be created, but it failed", componentName)
 				}
@@ -165,12 +162,7 @@ func TestBucket_UpdateLabelsForBuild_withMultipleBuilds(t *testing.T) {
 	expectedComponents := []string{firstComponent, secondComponent}
 	for _, componentName := range expectedComponents {
 		// Assert that a build stored on the iteration
-		iBuild, ok := subject.Iteration.builds.Load(componentName)
-		if !ok {
-			t.Errorf("expected an initial build for %s to be created, but it failed", componentName)
-		}
-
-		build, ok := iBuild.(*Build)
+		build, ok := subject.Iteration.builds.Get(componentName)
 		if !ok {
 			t.Errorf("expected an initial build for %s to be created, but it failed", componentName)
 		}
@@ -194,3 +186,237 @@ func TestBucket_UpdateLabelsForBuild_withMultipleBuilds(t *testing.T) {
 	}
 
 }
+
+func TestBucket_UpdateLogForBuild(t *testing.T) {
+	subject := createInitialBucket(t)
+
+	componentName := "happycloud.image"
+	subject.RegisterBuildForComponent(componentName)
+	err := subject.CreateInitialBuildForIteration(context.TODO(), componentName)
+	checkError(t, err)
+
+	err = subject.UpdateLogForBuild(componentName, "first run\n")
+	checkError(t, err)
+	// A new log replaces the one of a previous run and only its end is kept.
+	longLog := strings.Repeat("é", BuildLogMaxSize) + "the end\n"
+	err = subject.UpdateLogForBuild(componentName, longLog)
+	checkError(t, err)
+
+	build, ok := subject.Iteration.builds.Get(componentName)
+	if !ok {
+		t.Fatalf("expected a build for %s", componentName)
+	}
+	got := build.Labels[BuildLogLabel]
+	if len(got) > BuildLogMaxSize {
+		t.Errorf("expected the log to be truncated to %d bytes, got %d", BuildLogMaxSize, len(got))
+	}
+	if !strings.HasSuffix(got, "the end\n") {
+		t.Errorf("expected the end of the log to be kept, got %q", got[len(got)-20:])
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("expected the truncated log to be valid UTF-8")
+	}
+	if build.Labels["version"] != "1.7.0" {
+		t.Errorf("expected the other labels to be kept, got %v", build.Labels)
+	}
+
+	if err := subject.UpdateLogForBuild("unknown.image", "log"); err == nil {
+		t.Errorf("expected an error for an unknown build")
+	}
+}
+
+func TestBucket_ForceRebuild(t *testing.T) {
+	subject := createInitialBucket(t)
+
+	componentName := "happycloud.image"
+	subject.Iteration.builds.Store(componentName, &Build{
+		ID:            "build-id",
+		ComponentType: componentName,
+		Status:        models.HashicorpCloudPackerBuildStatusDONE,
+		Images: map[string]registryimage.Image{
+			"west": {ImageID: "image-id", ProviderName: "happycloud", ProviderRegion: "west"},
+		},
+	})
+
+	if subject.IsExpectingBuildForComponent(componentName) {
+		t.Fatalf("didn't expect a build already done to be expected")
+	}
+
+	subject.ForceRebuild = true
+	if !subject.IsExpectingBuildForComponent(componentName) {
+		t.Fatalf("expected a build already done to be expected when forced")
+	}
+
+	err := subject.ResetBuildForComponent(componentName)
+	checkError(t, err)
+	build, _ := subject.Iteration.builds.Get(componentName)
+	if len(build.Images) != 0 || build.Status != models.HashicorpCloudPackerBuildStatusUNSET {
+		t.Errorf("expected the build to be reset, got %d images and status %s", len(build.Images), build.Status)
+	}
+}
+
+func TestBucket_ResolveLabelsForBuild(t *testing.T) {
+	subject := createInitialBucket(t)
+
+	componentName := "happycloud.image"
+	subject.RegisterBuildForComponent(componentName)
+	err := subject.CreateInitialBuildForIteration(context.TODO(), componentName)
+	checkError(t, err)
+
+	subject.BuildLabelsResolver = func(componentType string, generatedData map[string]interface{}) (map[string]string, error) {
+		return map[string]string{"image_id": generatedData["ID"].(string)}, nil
+	}
+	err = subject.ResolveLabelsForBuild(componentName, map[string]interface{}{"ID": "image-id"})
+	checkError(t, err)
+
+	build, _ := subject.Iteration.builds.Get(componentName)
+	if build.Labels["image_id"] != "image-id" || build.Labels["version"] != "1.7.0" {
+		t.Errorf("expected the resolved labels to be merged to the build labels, got %v", build.Labels)
+	}
+}
+
+func TestBucket_UpdateBuildStatus_LabelUpdates(t *testing.T) {
+	subject := createInitialBucket(t)
+	subject.Iteration.ID = "iteration-id"
+	mockService := subject.client.Packer.(*registrytest.MockPackerClientService)
+
+	componentName := "happycloud.image"
+	subject.RegisterBuildForComponent(componentName)
+	build := &Build{
+		ID:            "build-id",
+		ComponentType: componentName,
+		Labels:        map[string]string{"version": "1.7.0", "based_off": "alpine"},
+		Images:        map[string]registryimage.Image{},
+		Status:        models.HashicorpCloudPackerBuildStatusUNSET,
+	}
+	build.labelsSynced(map[string]string{"version": "1.7.0", "based_off": "debian", "removed": "true"})
+	subject.Iteration.builds.Store(componentName, build)
+
+	// All the labels are sent, replacing the ones of the registry, removed
+	// labels included.
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), componentName, models.HashicorpCloudPackerBuildStatusRUNNING))
+	if diff := cmp.Diff(map[string]string{"version": "1.7.0", "based_off": "alpine"}, mockService.BuildUpdates["build-id"].Labels); diff != "" {
+		t.Errorf("expected all the labels to be sent: %s", diff)
+	}
+
+	// Nothing changed since the last update.
+	mockService.BuildUpdates = nil
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), componentName, models.HashicorpCloudPackerBuildStatusRUNNING))
+	if len(mockService.BuildUpdates) != 0 {
+		t.Errorf("expected no update, got %#v", mockService.BuildUpdates)
+	}
+
+	checkError(t, subject.UpdateLabelsForBuild(componentName, map[string]string{"image_id": "image-id", "version": "ignored"}))
+	checkError(t, subject.UpdateImageForBuild(componentName, registryimage.Image{ImageID: "image-id", ProviderName: "happycloud", ProviderRegion: "west"}))
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), componentName, models.HashicorpCloudPackerBuildStatusDONE))
+	update := mockService.BuildUpdates["build-id"]
+	if update == nil || update.Status != models.HashicorpCloudPackerBuildStatusDONE {
+		t.Fatalf("expected the build to be set to DONE, got %#v", update)
+	}
+	if diff := cmp.Diff(map[string]string{"version": "1.7.0", "based_off": "alpine", "image_id": "image-id"}, update.Labels); diff != "" {
+		t.Errorf("expected all the labels to be sent: %s", diff)
+	}
+}
+
+func TestBucket_UpdateLabelsForBuild_Coalesced(t *testing.T) {
+	subject := createInitialBucket(t)
+	subject.Iteration.ID = "iteration-id"
+	mockService := subject.client.Packer.(*registrytest.MockPackerClientService)
+
+	componentName := "happycloud.image"
+	subject.RegisterBuildForComponent(componentName)
+	build := &Build{
+		ID:            "build-id",
+		ComponentType: componentName,
+		Labels:        map[string]string{},
+		Images:        map[string]registryimage.Image{},
+		Status:        models.HashicorpCloudPackerBuildStatusRUNNING,
+	}
+	build.labelsSynced(nil)
+	subject.Iteration.builds.Store(componentName, build)
+
+	for _, k := range []string{"shell", "ansible", "file"} {
+		checkError(t, subject.UpdateLabelsForBuild(componentName, map[string]string{k: "done"}))
+	}
+	if mockService.UpdateBuildCalled {
+		t.Fatalf("expected the labels to wait for the next status update, got %#v", mockService.BuildUpdates)
+	}
+
+	// The build fails right after its last labels changed, they are sent with
+	// its status before the run exits.
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), componentName, models.HashicorpCloudPackerBuildStatusFAILED))
+	update := mockService.BuildUpdates["build-id"]
+	if update == nil || update.Status != models.HashicorpCloudPackerBuildStatusFAILED {
+		t.Fatalf("expected the build to be set to FAILED, got %#v", update)
+	}
+	if diff := cmp.Diff(map[string]string{"shell": "done", "ansible": "done", "file": "done"}, update.Labels); diff != "" {
+		t.Errorf("expected the labels to be sent in one update: %s", diff)
+	}
+}
+func TestCancellationReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.Canceled, "the build was interrupted"},
+		{context.DeadlineExceeded, "the build timed out"},
+		{fmt.Errorf("wrapped: %w", context.Canceled), "the build was interrupted"},
+		{errors.New("boom"), "boom"},
+		{nil, "the build was cancelled"},
+	}
+	for _, tt := range tests {
+		if got := CancellationReason(tt.err); got != tt.want {
+			t.Errorf("CancellationReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBucket_CancelPendingBuilds(t *testing.T) {
+	subject := createInitialBucket(t)
+	subject.Iteration.ID = "iteration-id"
+	mockService := subject.client.Packer.(*registrytest.MockPackerClientService)
+
+	statuses := map[string]models.HashicorpCloudPackerBuildStatus{
+		"happycloud.unset":   models.HashicorpCloudPackerBuildStatusUNSET,
+		"happycloud.running": models.HashicorpCloudPackerBuildStatusRUNNING,
+		"happycloud.done":    models.HashicorpCloudPackerBuildStatusDONE,
+		"happycloud.failed":  models.HashicorpCloudPackerBuildStatusFAILED,
+	}
+	for name, status := range statuses {
+		subject.RegisterBuildForComponent(name)
+		subject.Iteration.builds.Store(name, &Build{
+			ID:            name + "-build",
+			ComponentType: name,
+			Labels:        map[string]string{},
+			Images:        map[string]registryimage.Image{},
+			Status:        status,
+		})
+	}
+
+	checkError(t, subject.CancelPendingBuilds(context.TODO(), "the build was interrupted"))
+
+	for name, status := range statuses {
+		update, updated := mockService.BuildUpdates[name+"-build"]
+		switch status {
+		case models.HashicorpCloudPackerBuildStatusUNSET, models.HashicorpCloudPackerBuildStatusRUNNING:
+			if !updated || update.Status != models.HashicorpCloudPackerBuildStatusCANCELLED {
+				t.Errorf("expected %q to be cancelled, got %#v", name, update)
+				continue
+			}
+			if got := update.Labels[BuildCancellationReasonLabel]; got != "the build was interrupted" {
+				t.Errorf("unexpected cancellation reason for %q: %q", name, got)
+			}
+		default:
+			if updated {
+				t.Errorf("expected %q to be left alone, got %#v", name, update)
+			}
+		}
+	}
+
+	// Cancelled builds are not cancelled again.
+	mockService.BuildUpdates = nil
+	checkError(t, subject.CancelPendingBuilds(context.TODO(), "the build was interrupted"))
+	if len(mockService.BuildUpdates) != 0 {
+		t.Errorf("expected no update, got %#v", mockService.BuildUpdates)
+	}
+}
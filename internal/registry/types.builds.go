@@ -1,6 +1,10 @@
 package registry
 
 import (
+	"fmt"
+	"sort"
+	"sync"
+
 	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
 	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
 )
@@ -14,4 +18,125 @@ type Build struct {
 	Labels        map[string]string
 	Images        map[string]registryimage.Image
 	Status        models.HashicorpCloudPackerBuildStatus
+
+	// syncedLabels are the labels of the build on the HCP Packer registry, as of its last update.
+	syncedLabels map[string]string
+}
+
+// labelsChanged tells whether labels were added, changed or removed since the build was last updated on the HCP Packer
+// registry.
+func (build *Build) labelsChanged() bool {
+	if len(build.Labels) != len(build.syncedLabels) {
+		return true
+	}
+	for k, v := range build.Labels {
+		if synced, ok := build.syncedLabels[k]; !ok || synced != v {
+			return true
+		}
+	}
+	return false
+}
+
+// labelsSynced records that labels are the labels of the build on the HCP Packer registry.
+func (build *Build) labelsSynced(labels map[string]string) {
+	build.syncedLabels = copyLabels(labels)
+	if build.syncedLabels == nil {
+		build.syncedLabels = map[string]string{}
+	}
+}
+
+// clone returns a copy of build, sharing none of its maps.
+func (build *Build) clone() *Build {
+	c := *build
+	c.Labels = copyLabels(build.Labels)
+	c.syncedLabels = copyLabels(build.syncedLabels)
+	if build.Images != nil {
+		c.Images = make(map[string]registryimage.Image, len(build.Images))
+		for k, v := range build.Images {
+			c.Images[k] = v
+		}
+	}
+	return &c
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+// iterationBuilds are the builds of an iteration, by component type. It is safe for concurrent use: the builds it
+// returns are copies, builds are changed with Update.
+type iterationBuilds struct {
+	l      sync.RWMutex
+	builds map[string]*Build
+}
+
+// Get returns a copy of the build of the component type name.
+func (ib *iterationBuilds) Get(name string) (*Build, bool) {
+	ib.l.RLock()
+	defer ib.l.RUnlock()
+
+	build, ok := ib.builds[name]
+	if !ok {
+		return nil, false
+	}
+	return build.clone(), true
+}
+
+// Store sets the build of the component type name.
+func (ib *iterationBuilds) Store(name string, build *Build) {
+	ib.l.Lock()
+	defer ib.l.Unlock()
+
+	if ib.builds == nil {
+		ib.builds = make(map[string]*Build)
+	}
+	ib.builds[name] = build.clone()
+}
+
+// Update calls fn with the build of the component type name, for it to change the build. Other calls to the builds
+// wait for fn to return. It returns the error of fn, or an error when there is no build for name.
+func (ib *iterationBuilds) Update(name string, fn func(build *Build) error) error {
+	ib.l.Lock()
+	defer ib.l.Unlock()
+
+	build, ok := ib.builds[name]
+	if !ok {
+		return fmt.Errorf("no build found for the name %s", name)
+	}
+	return fn(build)
+}
+
+// Range calls fn with a copy of each build, by component type, until fn returns false. The builds are a Snapshot:
+// fn can call the other methods.
+func (ib *iterationBuilds) Range(fn func(name string, build *Build) bool) {
+	snapshot := ib.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !fn(name, snapshot[name]) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the builds, by component type.
+func (ib *iterationBuilds) Snapshot() map[string]*Build {
+	ib.l.RLock()
+	defer ib.l.RUnlock()
+
+	snapshot := make(map[string]*Build, len(ib.builds))
+	for name, build := range ib.builds {
+		snapshot[name] = build.clone()
+	}
+	return snapshot
 }
@@ -1,10 +1,9 @@
 package registry
 
 import (
-	"errors"
 	"fmt"
 	"os"
-	"sync"
+	"unicode/utf8"
 
 	git "github.com/go-git/go-git/v5"
 	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
@@ -16,12 +15,15 @@ type Iteration struct {
 	Fingerprint    string
 	RunUUID        string
 	Labels         map[string]string
-	builds         sync.Map
+	builds         iterationBuilds
 	expectedBuilds []string
 }
 
 type IterationOptions struct {
 	TemplateBaseDir string
+	// Fingerprint is the fingerprint of the iteration. When empty, it is read from the HCP_PACKER_BUILD_FINGERPRINT
+	// environment variable, or else from the git HEAD of TemplateBaseDir.
+	Fingerprint string
 }
 
 // NewIteration returns a pointer to an Iteration that can be used for storing Packer build details needed by PAR.
@@ -30,9 +32,12 @@ func NewIteration(opts IterationOptions) (*Iteration, error) {
 		expectedBuilds: make([]string, 0),
 	}
 
-	// By default we try to load a Fingerprint from the environment variable.
-	// If no variable is defined we should try to load a fingerprint from Git, or other VCS.
-	i.Fingerprint = os.Getenv("HCP_PACKER_BUILD_FINGERPRINT")
+	// A Fingerprint set through the options takes precedence, then we try to load a Fingerprint from the environment
+	// variable. If no variable is defined we should try to load a fingerprint from Git, or other VCS.
+	i.Fingerprint = opts.Fingerprint
+	if i.Fingerprint == "" {
+		i.Fingerprint = os.Getenv("HCP_PACKER_BUILD_FINGERPRINT")
+	}
 
 	// get a Git SHA
 	if i.Fingerprint != "" {
@@ -84,63 +89,85 @@ func GetGitFingerprint(opts IterationOptions) (string, error) {
 
 // AddImageToBuild appends one or more images artifacts to the build referred to by buildName.
 func (i *Iteration) AddImageToBuild(buildName string, images ...registryimage.Image) error {
-	existingBuild, ok := i.builds.Load(buildName)
-	if !ok {
-		return errors.New("no build found for the name " + buildName)
-	}
+	return i.builds.Update(buildName, func(build *Build) error {
+		if build.Images == nil {
+			build.Images = make(map[string]registryimage.Image)
+		}
 
-	build, ok := existingBuild.(*Build)
-	if !ok {
-		return fmt.Errorf("the build for the component %q does not appear to be a valid registry Build", buildName)
-	}
+		for _, image := range images {
+			if err := image.Validate(); err != nil {
+				return fmt.Errorf("failed to add image to build %q: %v", buildName, err)
+			}
 
-	if build.Images == nil {
-		build.Images = make(map[string]registryimage.Image)
-	}
+			if build.CloudProvider == "" {
+				build.CloudProvider = image.ProviderName
+			}
 
-	for _, image := range images {
-		if err := image.Validate(); err != nil {
-			return fmt.Errorf("failed to add image to build %q: %v", buildName, err)
-		}
+			for k, v := range image.Labels {
+				if _, ok := build.Labels[k]; ok {
+					continue
+				}
+				build.Labels[k] = v
+			}
 
-		if build.CloudProvider == "" {
-			build.CloudProvider = image.ProviderName
+			build.Images[image.String()] = image
 		}
+		return nil
+	})
+}
 
-		for k, v := range image.Labels {
+// AddLabelsToBuild merges the contents of data to the labels associated with the build referred to by buildName.
+func (i *Iteration) AddLabelsToBuild(buildName string, data map[string]string) error {
+	return i.builds.Update(buildName, func(build *Build) error {
+		for k, v := range data {
 			if _, ok := build.Labels[k]; ok {
 				continue
 			}
 			build.Labels[k] = v
 		}
-
-		build.Images[image.String()] = image
-	}
-
-	i.builds.Store(buildName, build)
-	return nil
+		return nil
+	})
 }
 
-// AddLabelsToBuild merges the contents of data to the labels associated with the build referred to by buildName.
-func (i *Iteration) AddLabelsToBuild(buildName string, data map[string]string) error {
-	existingBuild, ok := i.builds.Load(buildName)
-	if !ok {
-		return errors.New("no associated build found for the name " + buildName)
-	}
+const (
+	// BuildLogLabel is the build label holding the tail of the build log.
+	BuildLogLabel = "packer_build_log"
+	// BuildLogMaxSize is the maximum size, in bytes, of the log stored in
+	// BuildLogLabel.
+	BuildLogMaxSize = 4096
+)
 
-	build, ok := existingBuild.(*Build)
-	if !ok {
-		return fmt.Errorf("the build for the component %q does not appear to be a valid registry Build", buildName)
+// SetBuildLog stores the log of the build referred to by buildName in its labels, replacing the log of any previous
+// run. Logs longer than BuildLogMaxSize are truncated from the start, so that the end of the log, usually holding the
+// error of a failed build, is kept.
+func (i *Iteration) SetBuildLog(buildName, buildLog string) error {
+	if len(buildLog) > BuildLogMaxSize {
+		buildLog = buildLog[len(buildLog)-BuildLogMaxSize:]
+		// Do not start in the middle of a multi-byte character.
+		for len(buildLog) > 0 && !utf8.RuneStart(buildLog[0]) {
+			buildLog = buildLog[1:]
+		}
 	}
 
-	for k, v := range data {
-		if _, ok := build.Labels[k]; ok {
-			continue
+	return i.builds.Update(buildName, func(build *Build) error {
+		if build.Labels == nil {
+			build.Labels = make(map[string]string)
 		}
-		build.Labels[k] = v
-	}
+		build.Labels[BuildLogLabel] = buildLog
+		return nil
+	})
+}
 
-	i.builds.Store(buildName, build)
+// BuildCancellationReasonLabel is the build label holding the reason a build was marked as CANCELLED.
+const BuildCancellationReasonLabel = "packer_cancellation_reason"
 
-	return nil
+// SetBuildCancellationReason records why the build referred to by buildName was cancelled in its labels.
+func (i *Iteration) SetBuildCancellationReason(buildName, reason string) error {
+	return i.builds.Update(buildName, func(build *Build) error {
+		if build.Labels == nil {
+			build.Labels = make(map[string]string)
+		}
+		build.Labels[BuildCancellationReasonLabel] = reason
+		return nil
+	})
 }
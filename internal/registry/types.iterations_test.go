@@ -1,8 +1,10 @@
 package registry
 
 import (
+	"fmt"
 	"os"
 	"path"
+	"sync"
 	"testing"
 
 	git "github.com/go-git/go-git/v5"
@@ -26,6 +28,19 @@ func TestNewIteration(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:        "using fingerprint option over env variable",
+			fingerprint: "a1b2c3d4e5f6",
+			opts: IterationOptions{
+				Fingerprint: "a1b2c3d4e5f6",
+			},
+			setupFn: func() func() {
+				os.Setenv("HCP_PACKER_BUILD_FINGERPRINT", "6825d1ad0d5e")
+				return func() {
+					os.Unsetenv("HCP_PACKER_BUILD_FINGERPRINT")
+				}
+			},
+		},
 		{
 			name:        "using git fingerprint",
 			fingerprint: "4ec004e18e977a5b8a3a28f4b24279b6993d7e7c",
@@ -103,6 +118,46 @@ func TestNewIteration(t *testing.T) {
 	}
 }
 
+func TestIteration_buildsConcurrentAccess(t *testing.T) {
+	i := &Iteration{}
+	i.builds.Store("happycloud.image", &Build{ComponentType: "happycloud.image", Labels: map[string]string{}})
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		n := n
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("label-%d", n)
+			if err := i.AddLabelsToBuild("happycloud.image", map[string]string{key: "value"}); err != nil {
+				t.Errorf("unexpected failure: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			i.builds.Range(func(name string, build *Build) bool {
+				_ = len(build.Labels)
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+
+	build, ok := i.builds.Get("happycloud.image")
+	if !ok {
+		t.Fatalf("expected a build for happycloud.image")
+	}
+	if len(build.Labels) != 10 {
+		t.Errorf("expected 10 labels, got %v", build.Labels)
+	}
+
+	// The builds returned are copies.
+	build.Labels["changed"] = "value"
+	if snapshot := i.builds.Snapshot(); snapshot["happycloud.image"].Labels["changed"] != "" {
+		t.Errorf("expected the build of the iteration not to be changed through a copy")
+	}
+}
+
 func tempdir(dirname string) string {
 	return path.Join(os.TempDir(), dirname)
 }
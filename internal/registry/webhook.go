@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+)
+
+const (
+	// WebhookSignatureHeader holds the hex encoded HMAC-SHA256 of the payload,
+	// keyed with the webhook secret, ex: "sha256=4f2a...".
+	WebhookSignatureHeader = "X-Packer-Signature"
+	// WebhookEventIterationComplete is sent once all the required builds of
+	// an iteration are done.
+	WebhookEventIterationComplete = "iteration.complete"
+)
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// Webhook is a URL notified once all the required builds of an iteration are
+// done.
+type Webhook struct {
+	URL string
+	// Secret signs the payloads, so that the receiver can check they were
+	// sent by Packer.
+	Secret string
+}
+
+// WebhookPayload describes a completed iteration and its images.
+type WebhookPayload struct {
+	Event       string `json:"event"`
+	BucketSlug  string `json:"bucket_slug"`
+	IterationID string `json:"iteration_id"`
+	Fingerprint string `json:"fingerprint"`
+	// Channel is the channel the iteration is to be promoted to, for the
+	// WebhookEventPromotionApproval events.
+	Channel string         `json:"channel,omitempty"`
+	Builds  []WebhookBuild `json:"builds"`
+}
+
+type WebhookBuild struct {
+	ID            string            `json:"id"`
+	ComponentType string            `json:"component_type"`
+	CloudProvider string            `json:"cloud_provider"`
+	Labels        map[string]string `json:"labels"`
+	Images        []WebhookImage    `json:"images"`
+}
+
+type WebhookImage struct {
+	ImageID string `json:"image_id"`
+	Region  string `json:"region"`
+}
+
+// WebhookError is returned when a webhook could not be notified. The builds
+// are published anyway, so it should not be treated as a build failure.
+type WebhookError struct {
+	URL string
+	Err error
+}
+
+func (e *WebhookError) Error() string {
+	return fmt.Sprintf("failed to notify the webhook %q: %s", e.URL, e.Err)
+}
+
+func (e *WebhookError) Unwrap() error {
+	return e.Err
+}
+
+// Sign returns the value of the WebhookSignatureHeader for body.
+func (w *Webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify POSTs the signed payload to the webhook URL.
+func (w *Webhook) Notify(ctx context.Context, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return &WebhookError{URL: w.URL, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return &WebhookError{URL: w.URL, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, w.Sign(body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return &WebhookError{URL: w.URL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &WebhookError{
+			URL: w.URL,
+			Err: fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(b))),
+		}
+	}
+	return nil
+}
+
+// completedIterationPayload returns the payload describing the iteration of
+// b and its builds done, and whether the iteration is complete, see
+// IterationCompletion.
+func (b *Bucket) completedIterationPayload() (WebhookPayload, bool) {
+	payload := WebhookPayload{
+		Event:       WebhookEventIterationComplete,
+		BucketSlug:  b.Slug,
+		IterationID: b.Iteration.ID,
+		Fingerprint: b.Iteration.Fingerprint,
+		Builds:      []WebhookBuild{},
+	}
+
+	if complete, _ := b.IterationCompletion(); !complete {
+		return payload, false
+	}
+	for _, name := range b.Iteration.expectedBuilds {
+		build, ok := b.Iteration.builds.Get(name)
+		// The optional builds that are not done are left out.
+		if !ok || build.Status != models.HashicorpCloudPackerBuildStatusDONE {
+			continue
+		}
+		payload.Builds = append(payload.Builds, newWebhookBuild(build))
+	}
+	return payload, true
+}
+
+// newWebhookBuild describes build and its images, sorted by region.
+func newWebhookBuild(build *Build) WebhookBuild {
+	wb := WebhookBuild{
+		ID:            build.ID,
+		ComponentType: build.ComponentType,
+		CloudProvider: build.CloudProvider,
+		Labels:        build.Labels,
+		Images:        []WebhookImage{},
+	}
+	for _, image := range build.Images {
+		wb.Images = append(wb.Images, WebhookImage{
+			ImageID: image.ImageID,
+			Region:  image.ProviderRegion,
+		})
+	}
+	sort.Slice(wb.Images, func(i, j int) bool {
+		return wb.Images[i].Region+wb.Images[i].ImageID < wb.Images[j].Region+wb.Images[j].ImageID
+	})
+	return wb
+}
+
+// notifyIterationComplete notifies the OnCompleteWebhook of b once all the
+// required builds of the iteration are done. It only notifies once per run.
+func (b *Bucket) notifyIterationComplete(ctx context.Context) error {
+	if b.OnCompleteWebhook == nil {
+		return nil
+	}
+
+	b.webhookLock.Lock()
+	defer b.webhookLock.Unlock()
+	if b.webhookNotified {
+		return nil
+	}
+
+	payload, complete := b.completedIterationPayload()
+	if !complete {
+		return nil
+	}
+	b.webhookNotified = true
+	return b.OnCompleteWebhook.Notify(ctx, payload)
+}
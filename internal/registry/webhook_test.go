@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+)
+
+func TestBucket_OnCompleteWebhook(t *testing.T) {
+	var received []WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		webhook := &Webhook{Secret: "s3cr3t"}
+		if got := r.Header.Get(WebhookSignatureHeader); got != webhook.Sign(body) {
+			t.Errorf("unexpected signature %q", got)
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("failed to decode payload: %s", err)
+		}
+		received = append(received, payload)
+	}))
+	defer server.Close()
+
+	subject := createInitialBucket(t)
+	subject.Iteration.ID = "iteration-id"
+	subject.OnCompleteWebhook = &Webhook{URL: server.URL, Secret: "s3cr3t"}
+
+	components := []string{"happycloud.image", "happycloud.image2"}
+	for _, name := range components {
+		subject.RegisterBuildForComponent(name)
+		subject.Iteration.builds.Store(name, &Build{
+			ID:            name + "-build",
+			ComponentType: name,
+			Labels:        map[string]string{},
+			Images:        map[string]registryimage.Image{},
+		})
+		checkError(t, subject.UpdateImageForBuild(name, registryimage.Image{
+			ImageID:        name + "-id",
+			ProviderName:   "happycloud",
+			ProviderRegion: "west",
+		}))
+	}
+
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), components[0], models.HashicorpCloudPackerBuildStatusDONE))
+	if len(received) != 0 {
+		t.Fatalf("expected no notification before all builds are done, got %d", len(received))
+	}
+
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), components[1], models.HashicorpCloudPackerBuildStatusDONE))
+	if len(received) != 1 {
+		t.Fatalf("expected one notification once all builds are done, got %d", len(received))
+	}
+
+	got := received[0]
+	if got.Event != WebhookEventIterationComplete || got.IterationID != "iteration-id" || got.BucketSlug != "TestBucket" {
+		t.Errorf("unexpected payload %#v", got)
+	}
+	var images []WebhookImage
+	for _, b := range got.Builds {
+		images = append(images, b.Images...)
+	}
+	expected := []WebhookImage{
+		{ImageID: "happycloud.image-id", Region: "west"},
+		{ImageID: "happycloud.image2-id", Region: "west"},
+	}
+	if diff := cmp.Diff(expected, images); diff != "" {
+		t.Errorf("unexpected images: %s", diff)
+	}
+
+	// Builds already done do not notify again.
+	checkError(t, subject.UpdateBuildStatus(context.TODO(), components[1], models.HashicorpCloudPackerBuildStatusDONE))
+	if len(received) != 1 {
+		t.Errorf("expected a single notification, got %d", len(received))
+	}
+}
+
+func TestWebhook_Notify_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := (&Webhook{URL: server.URL, Secret: "s3cr3t"}).Notify(context.TODO(), WebhookPayload{})
+	var webhookErr *WebhookError
+	if !errors.As(err, &webhookErr) {
+		t.Fatalf("expected a *WebhookError, got %v", err)
+	}
+}
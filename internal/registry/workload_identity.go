@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer/internal/registry/env"
+	"golang.org/x/oauth2"
+)
+
+// SubjectTokenFunc returns the OIDC token identifying the workload running
+// Packer. It is called every time an HCP access token needs to be refreshed.
+type SubjectTokenFunc func(ctx context.Context) (string, error)
+
+// workloadIdentityTokenSource is an oauth2.TokenSource exchanging the OIDC
+// token of a workload (a GitHub Actions or GitLab CI job for example) for an
+// HCP access token, through an HCP workload identity provider.
+//
+// It is meant to be wrapped in an oauth2.ReuseTokenSource so that a new
+// exchange only happens once the previous access token expired.
+type workloadIdentityTokenSource struct {
+	ctx context.Context
+
+	// exchangeURL is the URL of the token exchange endpoint of the
+	// workload identity provider.
+	exchangeURL  string
+	subjectToken SubjectTokenFunc
+	client       *http.Client
+}
+
+// exchangeTokenResponse is the payload returned by the HCP token exchange
+// endpoint.
+type exchangeTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// AccessTokenExpiresIn is a duration, ex: "3600s".
+	AccessTokenExpiresIn string `json:"access_token_expires_in"`
+}
+
+// newWorkloadIdentityTokenSource returns a token source exchanging the tokens
+// returned by subjectToken through the workload identity provider. hostPath is
+// the host of the HCP API, without scheme.
+func newWorkloadIdentityTokenSource(ctx context.Context, hostPath, provider string, subjectToken SubjectTokenFunc, client *http.Client) oauth2.TokenSource {
+	ts := &workloadIdentityTokenSource{
+		ctx:          ctx,
+		exchangeURL:  fmt.Sprintf("https://%s/2019-12-10/%s/exchange-token", hostPath, strings.Trim(provider, "/")),
+		subjectToken: subjectToken,
+		client:       client,
+	}
+	return oauth2.ReuseTokenSource(nil, ts)
+}
+
+// subjectTokenFromEnv picks the source of the OIDC token to exchange. A token
+// given directly takes precedence over a token file, which takes precedence
+// over the GitHub Actions OIDC provider.
+func subjectTokenFromEnv(client *http.Client) (SubjectTokenFunc, error) {
+	if token, ok := os.LookupEnv(env.HCPWorkloadIdentityToken); ok {
+		return func(context.Context) (string, error) {
+			return token, nil
+		}, nil
+	}
+
+	if path, ok := os.LookupEnv(env.HCPWorkloadIdentityTokenFile); ok {
+		return func(context.Context) (string, error) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read the workload identity token: %w", err)
+			}
+			return strings.TrimSpace(string(b)), nil
+		}, nil
+	}
+
+	if requestURL, ok := os.LookupEnv(env.GitHubActionsIDTokenRequestURL); ok {
+		requestToken := os.Getenv(env.GitHubActionsIDTokenRequestToken)
+		audience := os.Getenv(env.HCPWorkloadIdentityAudience)
+		return func(ctx context.Context) (string, error) {
+			return githubActionsIDToken(ctx, client, requestURL, requestToken, audience)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no workload identity token found, either %s, %s or the GitHub Actions %s environment variable must be set",
+		env.HCPWorkloadIdentityToken, env.HCPWorkloadIdentityTokenFile, env.GitHubActionsIDTokenRequestURL)
+}
+
+// githubActionsIDToken requests an OIDC token to the GitHub Actions provider
+// of the current job.
+func githubActionsIDToken(ctx context.Context, client *http.Client, requestURL, requestToken, audience string) (string, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", env.GitHubActionsIDTokenRequestURL, err)
+	}
+	if audience != "" {
+		q := u.Query()
+		q.Set("audience", audience)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+
+	var payload struct {
+		Value string `json:"value"`
+	}
+	if err := doJSON(client, req, &payload); err != nil {
+		return "", fmt.Errorf("failed to request a GitHub Actions OIDC token: %w", err)
+	}
+	if payload.Value == "" {
+		return "", errors.New("the GitHub Actions OIDC provider returned an empty token")
+	}
+	return payload.Value, nil
+}
+
+// Token exchanges a fresh OIDC token for an HCP access token.
+func (ts *workloadIdentityTokenSource) Token() (*oauth2.Token, error) {
+	subjectToken, err := ts.subjectToken(ts.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{"jwt_token": subjectToken})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ts.ctx, http.MethodPost, ts.exchangeURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp exchangeTokenResponse
+	if err := doJSON(ts.client, req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to exchange the workload identity token: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("failed to exchange the workload identity token: empty access token")
+	}
+
+	token := &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   "Bearer",
+	}
+	if resp.AccessTokenExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(resp.AccessTokenExpiresIn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access token expiration %q: %w", resp.AccessTokenExpiresIn, err)
+		}
+		token.Expiry = time.Now().Add(expiresIn)
+	}
+	return token, nil
+}
+
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return json.Unmarshal(b, v)
+}
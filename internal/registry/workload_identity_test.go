@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer/internal/registry/env"
+	"golang.org/x/oauth2"
+)
+
+func TestWorkloadIdentityTokenSource_Token(t *testing.T) {
+	var exchanged []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected a POST request, got %s", r.Method)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode exchange request: %s", err)
+		}
+		exchanged = append(exchanged, body["jwt_token"])
+		if body["jwt_token"] == "bad-jwt" {
+			http.Error(w, `{"message":"invalid token"}`, http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(exchangeTokenResponse{
+			AccessToken:          "access-for-" + body["jwt_token"],
+			AccessTokenExpiresIn: "3600s",
+		})
+	}))
+	defer server.Close()
+
+	jwt := "first-jwt"
+	ts := &workloadIdentityTokenSource{
+		ctx:          context.Background(),
+		exchangeURL:  server.URL,
+		subjectToken: func(context.Context) (string, error) { return jwt, nil },
+		client:       server.Client(),
+	}
+
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.AccessToken != "access-for-first-jwt" {
+		t.Errorf("unexpected access token %q", token.AccessToken)
+	}
+	if time.Until(token.Expiry) < 59*time.Minute {
+		t.Errorf("unexpected expiry %s", token.Expiry)
+	}
+
+	// A valid token is reused, an expired one is exchanged again with a
+	// fresh subject token.
+	reuse := oauth2.ReuseTokenSource(token, ts)
+	if _, err := reuse.Token(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(exchanged) != 1 {
+		t.Fatalf("expected the valid token to be reused, got %d exchanges", len(exchanged))
+	}
+
+	expired := *token
+	expired.Expiry = time.Now().Add(-time.Minute)
+	jwt = "second-jwt"
+	refreshed, err := oauth2.ReuseTokenSource(&expired, ts).Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if refreshed.AccessToken != "access-for-second-jwt" {
+		t.Errorf("expected the token to be refreshed, got %q", refreshed.AccessToken)
+	}
+
+	jwt = "bad-jwt"
+	if _, err := ts.Token(); err == nil {
+		t.Errorf("expected a rejected exchange to fail")
+	}
+}
+
+func TestSubjectTokenFromEnv(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer request-token" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		if got := r.URL.Query().Get("audience"); got != "hcp.example" {
+			t.Errorf("unexpected audience %q", got)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": "github-jwt"})
+	}))
+	defer github.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name     string
+		env      map[string]string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "token",
+			env:      map[string]string{env.HCPWorkloadIdentityToken: "env-jwt", env.HCPWorkloadIdentityTokenFile: tokenFile},
+			expected: "env-jwt",
+		},
+		{
+			name:     "token file",
+			env:      map[string]string{env.HCPWorkloadIdentityTokenFile: tokenFile},
+			expected: "file-jwt",
+		},
+		{
+			name: "github actions",
+			env: map[string]string{
+				env.GitHubActionsIDTokenRequestURL:   github.URL + "/token?api-version=2.0",
+				env.GitHubActionsIDTokenRequestToken: "request-token",
+				env.HCPWorkloadIdentityAudience:      "hcp.example",
+			},
+			expected: "github-jwt",
+		},
+		{
+			name:    "no token source",
+			env:     map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, name := range []string{
+				env.HCPWorkloadIdentityToken,
+				env.HCPWorkloadIdentityTokenFile,
+				env.GitHubActionsIDTokenRequestURL,
+				env.GitHubActionsIDTokenRequestToken,
+				env.HCPWorkloadIdentityAudience,
+			} {
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			subjectToken, err := subjectTokenFromEnv(github.Client())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := subjectToken(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package serve
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// logBuffer keeps the whole log of a job, and lets readers follow it while it
+// is written.
+type logBuffer struct {
+	l    sync.Mutex
+	buf  []byte
+	done bool
+	// changed is closed, and replaced, every time the log is written to or
+	// closed.
+	changed chan struct{}
+}
+
+var _ io.Writer = new(logBuffer)
+
+func newLogBuffer() *logBuffer {
+	return &logBuffer{changed: make(chan struct{})}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.done {
+		return 0, io.ErrClosedPipe
+	}
+	b.buf = append(b.buf, p...)
+	b.notify()
+	return len(p), nil
+}
+
+// Close marks the log as complete.
+func (b *logBuffer) Close() {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if !b.done {
+		b.done = true
+		b.notify()
+	}
+}
+
+// notify wakes up the followers. b.l must be held.
+func (b *logBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// next returns the log written from offset on, whether the log is complete and
+// a channel closed once there is more.
+func (b *logBuffer) next(offset int) ([]byte, bool, <-chan struct{}) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.buf[offset:], b.done, b.changed
+}
+
+// copyTo writes the log to w. With follow, it keeps writing what is added to
+// the log until it is complete or ctx is done.
+func (b *logBuffer) copyTo(ctx context.Context, w io.Writer, follow bool) {
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		chunk, done, changed := b.next(offset)
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			offset += len(chunk)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if !follow || done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,498 @@
+// Package serve runs a long-running build server: templates are submitted to
+// a small HTTP API, their builds are queued and run with a concurrency limit,
+// and their logs and status can be queried while they run.
+package serve
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The statuses of a job.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// maxRequestSize is the maximum size of a build request, uploaded files
+// included.
+const maxRequestSize = 10 << 20
+
+// BuildRequest is a build submitted to the server.
+type BuildRequest struct {
+	// Template is the path of the template or directory to build, relative
+	// to the template root of the server, or to the uploaded Files.
+	Template string            `json:"template"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	// VarFiles are relative to the template root of the server, or to the
+	// uploaded Files.
+	VarFiles []string `json:"var_files,omitempty"`
+	Only     []string `json:"only,omitempty"`
+	Except   []string `json:"except,omitempty"`
+	// Files are the contents of uploaded files by their relative path. When
+	// set, the build runs in a temporary directory holding only these files
+	// instead of the template root.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// JobStatus describes a job of the server.
+type JobStatus struct {
+	ID          string       `json:"id"`
+	Request     BuildRequest `json:"request"`
+	Status      string       `json:"status"`
+	SubmittedAt time.Time    `json:"submitted_at"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	// Uploaded are the paths of the uploaded files of the request, whose
+	// contents are not kept in Request.
+	Uploaded []string `json:"uploaded,omitempty"`
+}
+
+// RunFunc runs the build of req, writing its log to w, until it is over or
+// ctx is cancelled. The paths of req are absolute.
+type RunFunc func(ctx context.Context, req BuildRequest, w io.Writer) error
+
+// Server queues the builds submitted to its Handler and runs at most
+// MaxConcurrent of them at a time, in the order they were submitted.
+type Server struct {
+	// TemplateRoot is the directory the templates and variable files of the
+	// requests must be in.
+	TemplateRoot  string
+	MaxConcurrent int
+	Run           RunFunc
+	// Token, when set, must be sent as a bearer token in the Authorization
+	// header of every request to the Handler.
+	Token string
+
+	l       sync.Mutex
+	jobs    map[string]*job
+	order   []string
+	pending []*job
+	running int
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type job struct {
+	status JobStatus
+	// root is the directory the paths of the request are relative to, and
+	// upload the temporary directory of the uploaded files, removed once the
+	// job is over.
+	root   string
+	upload string
+	ctx    context.Context
+	cancel context.CancelFunc
+	log    *logBuffer
+}
+
+// Submit queues the build of req and returns its job.
+func (s *Server) Submit(req BuildRequest) (JobStatus, error) {
+	root, upload := s.TemplateRoot, ""
+	var uploaded []string
+	if len(req.Files) > 0 {
+		var err error
+		if upload, uploaded, err = writeUpload(req.Files); err != nil {
+			return JobStatus{}, err
+		}
+		root = upload
+		req.Files = nil
+	}
+	if _, err := resolve(root, req); err != nil {
+		removeUpload(upload)
+		return JobStatus{}, err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.closed {
+		removeUpload(upload)
+		return JobStatus{}, errors.New("the server is shutting down")
+	}
+	if s.jobs == nil {
+		s.jobs = map[string]*job{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: JobStatus{
+			ID:          newJobID(),
+			Request:     req,
+			Uploaded:    uploaded,
+			Status:      StatusQueued,
+			SubmittedAt: time.Now().UTC(),
+		},
+		root:   root,
+		upload: upload,
+		ctx:    ctx,
+		cancel: cancel,
+		log:    newLogBuffer(),
+	}
+	s.jobs[j.status.ID] = j
+	s.order = append(s.order, j.status.ID)
+	s.pending = append(s.pending, j)
+	log.Printf("[INFO] (serve) queued job %s building %s", j.status.ID, req.Template)
+	s.schedule()
+	return j.status, nil
+}
+
+// resolve returns req with its paths made absolute, checking that they are in
+// root.
+func resolve(root string, req BuildRequest) (BuildRequest, error) {
+	if req.Template == "" {
+		return req, errors.New("a template is required")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return req, err
+	}
+
+	resolved := req
+	if resolved.Template, err = inRoot(root, req.Template); err != nil {
+		return req, err
+	}
+	resolved.VarFiles = make([]string, len(req.VarFiles))
+	for i, path := range req.VarFiles {
+		if resolved.VarFiles[i], err = inRoot(root, path); err != nil {
+			return req, err
+		}
+	}
+	return resolved, nil
+}
+
+// inRoot returns the absolute path of path, relative to root, checking that
+// it does not escape it.
+func inRoot(root, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("%q must be relative to the template root", path)
+	}
+	abs := filepath.Join(root, path)
+	if rel, err := filepath.Rel(root, abs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is outside of the template root", path)
+	}
+	return abs, nil
+}
+
+// writeUpload writes files to a new temporary directory, returning it and the
+// sorted paths of the files.
+func writeUpload(files map[string]string) (string, []string, error) {
+	dir, err := os.MkdirTemp("", "packer-serve-")
+	if err != nil {
+		return "", nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		abs, err := inRoot(dir, filepath.FromSlash(path))
+		if err == nil && abs == dir {
+			err = fmt.Errorf("%q is not a file", path)
+		}
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(abs), 0700)
+		}
+		if err == nil {
+			err = os.WriteFile(abs, []byte(files[path]), 0600)
+		}
+		if err != nil {
+			removeUpload(dir)
+			return "", nil, fmt.Errorf("failed to write the uploaded file %q: %s", path, err)
+		}
+	}
+	return dir, paths, nil
+}
+
+func removeUpload(dir string) {
+	if dir == "" {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("[WARN] (serve) failed to remove the uploaded files in %s: %s", dir, err)
+	}
+}
+
+// schedule starts the pending jobs while fewer than MaxConcurrent are running.
+// s.l must be held.
+func (s *Server) schedule() {
+	max := s.MaxConcurrent
+	if max < 1 {
+		max = 1
+	}
+	for s.running < max && len(s.pending) > 0 {
+		j := s.pending[0]
+		s.pending = s.pending[1:]
+		if j.ctx.Err() != nil {
+			continue
+		}
+		req, err := resolve(j.root, j.status.Request)
+		now := time.Now().UTC()
+		j.status.StartedAt = &now
+		if err != nil {
+			s.finish(j, err)
+			continue
+		}
+		j.status.Status = StatusRunning
+		s.running++
+		s.wg.Add(1)
+		go s.run(j, req)
+	}
+}
+
+func (s *Server) run(j *job, req BuildRequest) {
+	defer s.wg.Done()
+	log.Printf("[INFO] (serve) starting job %s", j.status.ID)
+	err := s.Run(j.ctx, req, j.log)
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.running--
+	s.finish(j, err)
+	s.schedule()
+}
+
+// finish records the end of j. s.l must be held.
+func (s *Server) finish(j *job, err error) {
+	now := time.Now().UTC()
+	j.status.FinishedAt = &now
+	switch {
+	case j.ctx.Err() != nil:
+		j.status.Status = StatusCancelled
+	case err != nil:
+		j.status.Status = StatusFailed
+		j.status.Error = err.Error()
+	default:
+		j.status.Status = StatusSucceeded
+	}
+	j.cancel()
+	j.log.Close()
+	removeUpload(j.upload)
+	log.Printf("[INFO] (serve) job %s %s", j.status.ID, j.status.Status)
+}
+
+// Cancel cancels the job with the given ID, whether it is queued or running.
+func (s *Server) Cancel(id string) (JobStatus, bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return JobStatus{}, false
+	}
+	if j.status.FinishedAt != nil {
+		return j.status, true
+	}
+	j.cancel()
+	if j.status.Status == StatusQueued {
+		for i, p := range s.pending {
+			if p == j {
+				s.pending = append(s.pending[:i:i], s.pending[i+1:]...)
+				break
+			}
+		}
+		s.finish(j, nil)
+	}
+	return j.status, true
+}
+
+// Job returns the status of the job with the given ID.
+func (s *Server) Job(id string) (JobStatus, bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return JobStatus{}, false
+	}
+	return j.status, true
+}
+
+// Jobs returns the status of all the jobs, in the order they were submitted.
+func (s *Server) Jobs() []JobStatus {
+	s.l.Lock()
+	defer s.l.Unlock()
+	jobs := make([]JobStatus, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, s.jobs[id].status)
+	}
+	return jobs
+}
+
+// Shutdown stops accepting jobs, cancels the queued and running ones and
+// waits for the running ones to be over, or for ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.l.Lock()
+	s.closed = true
+	for _, j := range s.jobs {
+		if j.status.FinishedAt == nil {
+			j.cancel()
+		}
+	}
+	for _, j := range s.pending {
+		s.finish(j, nil)
+	}
+	s.pending = nil
+	s.l.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handler returns the HTTP API of the server:
+//
+//	POST   /v1/builds                 submits a BuildRequest, returns its JobStatus
+//	GET    /v1/builds                 lists the jobs
+//	GET    /v1/builds/{id}            returns the status of a job
+//	DELETE /v1/builds/{id}            cancels a job
+//	GET    /v1/builds/{id}/logs       returns the log of a job, streamed
+//	                                  until the job is over with ?follow=true
+//
+// When Token is set, requests without it are refused.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/builds", s.handleBuilds)
+	mux.HandleFunc("/v1/builds/", s.handleBuild)
+	if s.Token == "" {
+		return mux
+	}
+	want := []byte("Bearer " + s.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="packer"`)
+			writeError(w, http.StatusUnauthorized, errors.New("a valid token is required"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleBuilds(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.Jobs())
+	case http.MethodPost:
+		var req BuildRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid build request: %s", err))
+			return
+		}
+		status, err := s.Submit(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.Header().Set("Location", "/v1/builds/"+status.ID)
+		writeJSON(w, http.StatusAccepted, status)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleBuild(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/builds/"), "/")
+	id := parts[0]
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		status, ok := s.Job(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		status, ok := s.Cancel(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	case len(parts) == 2 && parts[1] == "logs" && r.Method == http.MethodGet:
+		s.l.Lock()
+		j, ok := s.jobs[id]
+		s.l.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", id))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		j.log.copyTo(r.Context(), w, r.URL.Query().Get("follow") == "true")
+	case len(parts) <= 2:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %q", r.URL.Path))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("[WARN] (serve) failed to write response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back on the time, IDs only have to be unique to this server.
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// BuildArgs returns the arguments of the `packer build` command running the
+// build of r, the template last.
+func (r BuildRequest) BuildArgs() []string {
+	var args []string
+	keys := make([]string, 0, len(r.Vars))
+	for k := range r.Vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-var", k+"="+r.Vars[k])
+	}
+	for _, path := range r.VarFiles {
+		args = append(args, "-var-file", path)
+	}
+	if len(r.Only) > 0 {
+		args = append(args, "-only", strings.Join(r.Only, ","))
+	}
+	if len(r.Except) > 0 {
+		args = append(args, "-except", strings.Join(r.Except, ","))
+	}
+	return append(args, r.Template)
+}
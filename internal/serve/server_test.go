@@ -0,0 +1,362 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRunner records the builds run, and runs each until it is released.
+type fakeRunner struct {
+	l        sync.Mutex
+	started  []string
+	running  int
+	max      int
+	releases map[string]chan error
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{releases: map[string]chan error{}}
+}
+
+func (r *fakeRunner) release(template string) chan error {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if _, ok := r.releases[template]; !ok {
+		r.releases[template] = make(chan error, 1)
+	}
+	return r.releases[template]
+}
+
+func (r *fakeRunner) Run(ctx context.Context, req BuildRequest, w io.Writer) error {
+	name := filepath.Base(req.Template)
+	r.l.Lock()
+	r.started = append(r.started, name)
+	r.running++
+	if r.running > r.max {
+		r.max = r.running
+	}
+	r.l.Unlock()
+	defer func() {
+		r.l.Lock()
+		r.running--
+		r.l.Unlock()
+	}()
+
+	fmt.Fprintf(w, "building %s\n", name)
+	select {
+	case err := <-r.release(name):
+		fmt.Fprintf(w, "done %s\n", name)
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func waitForStatus(t *testing.T, s *Server, id, status string) JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := s.Job(id)
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s: expected status %q, got %q", id, status, job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServer_queue(t *testing.T) {
+	runner := newFakeRunner()
+	s := &Server{TemplateRoot: t.TempDir(), MaxConcurrent: 2, Run: runner.Run}
+
+	var ids []string
+	for _, name := range []string{"a", "b", "c"} {
+		job, err := s.Submit(BuildRequest{Template: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	waitForStatus(t, s, ids[0], StatusRunning)
+	waitForStatus(t, s, ids[1], StatusRunning)
+	if job, _ := s.Job(ids[2]); job.Status != StatusQueued {
+		t.Fatalf("expected the third job to be queued, got %q", job.Status)
+	}
+
+	runner.release("a") <- nil
+	waitForStatus(t, s, ids[0], StatusSucceeded)
+	waitForStatus(t, s, ids[2], StatusRunning)
+
+	runner.release("b") <- fmt.Errorf("boom")
+	if job := waitForStatus(t, s, ids[1], StatusFailed); job.Error != "boom" {
+		t.Errorf("expected the error of the failed job, got %q", job.Error)
+	}
+	runner.release("c") <- nil
+	waitForStatus(t, s, ids[2], StatusSucceeded)
+
+	if runner.max != 2 {
+		t.Errorf("expected at most 2 builds at a time, got %d", runner.max)
+	}
+}
+
+func TestServer_Cancel(t *testing.T) {
+	runner := newFakeRunner()
+	s := &Server{TemplateRoot: t.TempDir(), MaxConcurrent: 1, Run: runner.Run}
+
+	running, _ := s.Submit(BuildRequest{Template: "a"})
+	queued, _ := s.Submit(BuildRequest{Template: "b"})
+	waitForStatus(t, s, running.ID, StatusRunning)
+
+	if job, _ := s.Cancel(queued.ID); job.Status != StatusCancelled {
+		t.Errorf("expected the queued job to be cancelled, got %q", job.Status)
+	}
+	s.Cancel(running.ID)
+	waitForStatus(t, s, running.ID, StatusCancelled)
+
+	if want := []string{"a"}; !reflect.DeepEqual(runner.started, want) {
+		t.Errorf("expected only %v to start, got %v", want, runner.started)
+	}
+	if _, ok := s.Cancel("unknown"); ok {
+		t.Error("expected an unknown job not to be found")
+	}
+}
+
+func TestServer_Submit_outsideTemplateRoot(t *testing.T) {
+	s := &Server{TemplateRoot: t.TempDir(), Run: newFakeRunner().Run}
+	for _, req := range []BuildRequest{
+		{},
+		{Template: "../a.pkr.hcl"},
+		{Template: filepath.Join(t.TempDir(), "a.pkr.hcl")},
+		{Template: "a.pkr.hcl", VarFiles: []string{"../vars.pkrvars.hcl"}},
+	} {
+		if _, err := s.Submit(req); err == nil {
+			t.Errorf("expected %#v to be refused", req)
+		}
+	}
+	if jobs := s.Jobs(); len(jobs) != 0 {
+		t.Errorf("expected no jobs, got %v", jobs)
+	}
+}
+
+func TestServer_Handler(t *testing.T) {
+	runner := newFakeRunner()
+	s := &Server{TemplateRoot: t.TempDir(), MaxConcurrent: 1, Run: runner.Run}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/builds", "application/json",
+		strings.NewReader(`{"template": "a.pkr.hcl", "vars": {"version": "1.2"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+	if job.Request.Vars["version"] != "1.2" {
+		t.Errorf("expected the request to be recorded, got %#v", job.Request)
+	}
+
+	// Follow the log until the build is over.
+	logs := make(chan string)
+	go func() {
+		resp, err := http.Get(ts.URL + "/v1/builds/" + job.ID + "/logs?follow=true")
+		if err != nil {
+			logs <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		logs <- string(b)
+	}()
+	waitForStatus(t, s, job.ID, StatusRunning)
+	runner.release("a.pkr.hcl") <- nil
+	if got, want := <-logs, "building a.pkr.hcl\ndone a.pkr.hcl\n"; got != want {
+		t.Errorf("expected the log %q, got %q", want, got)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/builds/" + job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if job.Status != StatusSucceeded {
+		t.Errorf("expected the job to have succeeded, got %q", job.Status)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodGet, "/v1/builds", "", http.StatusOK},
+		{http.MethodGet, "/v1/builds/unknown", "", http.StatusNotFound},
+		{http.MethodDelete, "/v1/builds/unknown", "", http.StatusNotFound},
+		{http.MethodPost, "/v1/builds", `{"template": "../a.pkr.hcl"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/builds", `{"templates": "a.pkr.hcl"}`, http.StatusBadRequest},
+		{http.MethodPut, "/v1/builds", "", http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tc.method, ts.URL+tc.path, bytes.NewBufferString(tc.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.code, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_Handler_token(t *testing.T) {
+	s := &Server{TemplateRoot: t.TempDir(), Run: newFakeRunner().Run, Token: "secret"}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/builds", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("%q: expected %d, got %d", tc.auth, tc.code, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_Submit_upload(t *testing.T) {
+	root := t.TempDir()
+	var dir string
+	contents := map[string]string{}
+	release := make(chan struct{})
+	s := &Server{TemplateRoot: root, Run: func(ctx context.Context, req BuildRequest, w io.Writer) error {
+		dir = req.Template
+		for _, path := range append([]string{filepath.Join(dir, "a.pkr.hcl")}, req.VarFiles...) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			contents[filepath.Base(path)] = string(b)
+		}
+		<-release
+		return nil
+	}}
+
+	job, err := s.Submit(BuildRequest{
+		Template: ".",
+		VarFiles: []string{"vars/prod.pkrvars.hcl"},
+		Files: map[string]string{
+			"a.pkr.hcl":             "source {}",
+			"vars/prod.pkrvars.hcl": `version = "1.2"`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.pkr.hcl", "vars/prod.pkrvars.hcl"}; !reflect.DeepEqual(job.Uploaded, want) {
+		t.Errorf("expected the uploaded files %v, got %v", want, job.Uploaded)
+	}
+	if job.Request.Files != nil {
+		t.Errorf("expected the contents of the files not to be kept, got %v", job.Request.Files)
+	}
+	waitForStatus(t, s, job.ID, StatusRunning)
+	close(release)
+	if job := waitForStatus(t, s, job.ID, StatusSucceeded); job.Error != "" {
+		t.Fatal(job.Error)
+	}
+
+	want := map[string]string{"a.pkr.hcl": "source {}", "prod.pkrvars.hcl": `version = "1.2"`}
+	if !reflect.DeepEqual(contents, want) {
+		t.Errorf("expected the build to read %v, got %v", want, contents)
+	}
+	if dir == root {
+		t.Error("expected the upload to be built outside of the template root")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the uploaded files to be removed, got %v", err)
+	}
+
+	for _, files := range []map[string]string{
+		{"../a.pkr.hcl": ""},
+		{"/a.pkr.hcl": ""},
+		{".": ""},
+	} {
+		if _, err := s.Submit(BuildRequest{Template: ".", Files: files}); err == nil {
+			t.Errorf("expected %v to be refused", files)
+		}
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	runner := newFakeRunner()
+	s := &Server{TemplateRoot: t.TempDir(), MaxConcurrent: 1, Run: runner.Run}
+
+	running, _ := s.Submit(BuildRequest{Template: "a"})
+	queued, _ := s.Submit(BuildRequest{Template: "b"})
+	waitForStatus(t, s, running.ID, StatusRunning)
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{running.ID, queued.ID} {
+		if job, _ := s.Job(id); job.Status != StatusCancelled {
+			t.Errorf("job %s: expected to be cancelled, got %q", id, job.Status)
+		}
+	}
+	if _, err := s.Submit(BuildRequest{Template: "c"}); err == nil {
+		t.Error("expected submitting after shutdown to fail")
+	}
+}
+
+func TestBuildRequest_BuildArgs(t *testing.T) {
+	req := BuildRequest{
+		Template: "/templates/a.pkr.hcl",
+		Vars:     map[string]string{"b": "2", "a": "1"},
+		VarFiles: []string{"/templates/a.pkrvars.hcl"},
+		Only:     []string{"amazon-ebs.a", "docker.b"},
+		Except:   []string{"vagrant"},
+	}
+	want := []string{
+		"-var", "a=1", "-var", "b=2",
+		"-var-file", "/templates/a.pkrvars.hcl",
+		"-only", "amazon-ebs.a,docker.b",
+		"-except", "vagrant",
+		"/templates/a.pkr.hcl",
+	}
+	if got := req.BuildArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,331 @@
+// Package shelllocal runs the scripts of the shell-local provisioner and
+// post-processor on the host, through hostexec. Their configuration is the one
+// of the SDK, along with the shell running the scripts.
+package shelllocal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	sl "github.com/hashicorp/packer-plugin-sdk/shell-local"
+	configHelper "github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer-plugin-sdk/tmp"
+	"github.com/hashicorp/packer/internal/hostexec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Config is the configuration of the shell-local provisioner and
+// post-processor.
+type Config struct {
+	sl.Config
+
+	// Shell runs the scripts, see hostexec.Shell. By default, the scripts run
+	// following their shebang on Linux and macOS, and with cmd on Windows. It
+	// can't be set with execute_command.
+	Shell string
+
+	// shell runs the scripts when execute_command is not set.
+	shell hostexec.Shell
+	// executeCommand tells whether execute_command is set, or else only
+	// defaulted by the SDK.
+	executeCommand bool
+	// envVarFormat tells whether env_var_format is set.
+	envVarFormat bool
+	ctx          interpolate.Context
+}
+
+// ConfigSpec returns the HCL2 spec of the configuration of the SDK, with the
+// shell.
+func (c *Config) ConfigSpec() hcldec.ObjectSpec {
+	spec := hcldec.ObjectSpec(c.Config.FlatMapstructure().HCL2Spec())
+	spec["shell"] = &hcldec.AttrSpec{Name: "shell", Type: cty.String, Required: false}
+	return spec
+}
+
+// Decode decodes the raw configurations into c, like the SDK does.
+func Decode(c *Config, raws ...interface{}) error {
+	raws, err := c.decodeShell(raws)
+	if err != nil {
+		return err
+	}
+	err = configHelper.Decode(&c.Config, &configHelper.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &c.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"execute_command",
+			},
+		},
+	}, raws...)
+	if err != nil {
+		return fmt.Errorf("Error decoding config: %s", err)
+	}
+	return nil
+}
+
+// decodeShell sets the shell of c from raws, and returns raws without it, as
+// the configuration of the SDK has no shell.
+func (c *Config) decodeShell(raws []interface{}) ([]interface{}, error) {
+	res := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		switch raw := raw.(type) {
+		case cty.Value:
+			if raw.IsNull() || !raw.Type().IsObjectType() || !raw.Type().HasAttribute("shell") {
+				break
+			}
+			attrs := raw.AsValueMap()
+			if shell := attrs["shell"]; !shell.IsNull() && shell.IsKnown() {
+				c.Shell = shell.AsString()
+			}
+			delete(attrs, "shell")
+			res[i] = cty.ObjectVal(attrs)
+			continue
+		case map[string]interface{}:
+			shell, ok := raw["shell"]
+			if !ok {
+				break
+			}
+			if shell != nil {
+				s, ok := shell.(string)
+				if !ok {
+					return nil, fmt.Errorf("shell must be a string, got %v", shell)
+				}
+				c.Shell = s
+			}
+			m := make(map[string]interface{}, len(raw))
+			for k, v := range raw {
+				if k != "shell" {
+					m[k] = v
+				}
+			}
+			res[i] = m
+			continue
+		}
+		res[i] = raw
+	}
+	return res, nil
+}
+
+// Validate validates c and sets its defaults, like the SDK does.
+func Validate(c *Config) error {
+	c.executeCommand = len(c.ExecuteCommand) > 0
+	c.envVarFormat = c.EnvVarFormat != ""
+	if c.Shell != "" {
+		shell, err := hostexec.ParseShell(c.Shell)
+		if err != nil {
+			return err
+		}
+		if c.executeCommand {
+			return fmt.Errorf("You may only specify one of shell and execute_command.")
+		}
+		c.shell = shell
+		if c.TempfileExtension == "" {
+			c.TempfileExtension = shell.ScriptExtension()
+		}
+	} else if runtime.GOOS == "windows" {
+		c.shell = hostexec.ShellCmd
+	}
+	return sl.Validate(&c.Config)
+}
+
+// Run runs the scripts of c, or its inline commands. generatedData is the data
+// generated by the build.
+func Run(ctx context.Context, ui packersdk.Ui, c *Config, generatedData map[string]interface{}) (bool, error) {
+	if generatedData == nil {
+		// No fear; probably just in the post-processor, not provisioner.
+		generatedData = make(map[string]interface{})
+	}
+	c.ctx.Data = generatedData
+	// Check if shell-local can even execute against this runtime OS
+	if len(c.OnlyOn) > 0 {
+		runCommand := false
+		for _, os := range c.OnlyOn {
+			if os == runtime.GOOS {
+				runCommand = true
+				break
+			}
+		}
+		if !runCommand {
+			ui.Say("Skipping shell-local due to runtime OS")
+			log.Printf("[INFO] (shell-local): skipping shell-local due to missing runtime OS")
+			return true, nil
+		}
+	}
+
+	scripts := make([]string, len(c.Scripts))
+	copy(scripts, c.Scripts)
+	if len(scripts) == 0 && c.Inline != nil {
+		script, err := c.inlineScript()
+		if err != nil {
+			return false, err
+		}
+		defer os.Remove(script)
+		scripts = append(scripts, script)
+	}
+
+	env, err := c.env(generatedData)
+	if err != nil {
+		return false, err
+	}
+
+	for _, script := range scripts {
+		// use absolute path in case the script is linked with forward slashes
+		// on windows.
+		absScript, err := filepath.Abs(script)
+		if err != nil {
+			return false, fmt.Errorf("Error executing script: %s\n%v\n", absScript, err)
+		}
+		args, cmdEnv, err := c.command(absScript, env, generatedData)
+		if err != nil {
+			return false, err
+		}
+		ui.Say(fmt.Sprintf("Running local shell script: %s", script))
+		log.Printf("[INFO] (shell-local): starting local command: %s", strings.Join(args, " "))
+
+		code, err := hostexec.Run(hostexec.Command(ctx, args, cmdEnv, ""), ui)
+		if err != nil {
+			return false, fmt.Errorf("Error executing script: %s: %s\n\n"+
+				"Please see output above for more information.", absScript, err)
+		}
+		if err := c.ValidExitCode(code); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// inlineScript writes the inline commands of c to a temporary script.
+func (c *Config) inlineScript() (string, error) {
+	tf, err := tmp.File("packer-shell")
+	if err != nil {
+		return "", fmt.Errorf("Error preparing shell script: %s", err)
+	}
+	defer tf.Close()
+	writer := bufio.NewWriter(tf)
+	// cmd would run the shebang as a command.
+	if c.InlineShebang != "" && c.shell != hostexec.ShellCmd {
+		shebang := fmt.Sprintf("#!%s\n", c.InlineShebang)
+		log.Printf("[INFO] (shell-local): Prepending inline script with %s", shebang)
+		writer.WriteString(shebang)
+	}
+	for _, command := range c.Inline {
+		// interpolate command to check for template variables.
+		command, err := interpolate.Render(command, &c.ctx)
+		if err != nil {
+			return "", err
+		}
+		if _, err := writer.WriteString(command + "\n"); err != nil {
+			return "", fmt.Errorf("Error preparing shell script: %s", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return "", fmt.Errorf("Error preparing shell script: %s", err)
+	}
+	if err := os.Chmod(tf.Name(), 0700); err != nil {
+		log.Printf("[ERROR] (shell-local): error modifying permissions of temp script file: %s", err.Error())
+	}
+
+	name := tf.Name()
+	if c.TempfileExtension != "" {
+		tf.Close()
+		if err := os.Rename(name, name+"."+c.TempfileExtension); err != nil {
+			return "", fmt.Errorf("Error preparing shell script: %s", err)
+		}
+		name += "." + c.TempfileExtension
+	}
+	return name, nil
+}
+
+// env returns the environment variables of the scripts.
+func (c *Config) env(generatedData map[string]interface{}) (map[string]string, error) {
+	env := map[string]string{
+		"PACKER_BUILD_NAME":   c.PackerBuildName,
+		"PACKER_BUILDER_TYPE": c.PackerBuilderType,
+	}
+	// expose ip address variables
+	if v, ok := generatedData["PackerHTTPAddr"].(string); ok && v != commonsteps.HttpAddrNotImplemented {
+		env["PACKER_HTTP_ADDR"] = v
+	}
+	if v, ok := generatedData["PackerHTTPIP"].(string); ok && v != commonsteps.HttpIPNotImplemented {
+		env["PACKER_HTTP_IP"] = v
+	}
+	if v, ok := generatedData["PackerHTTPPort"].(string); ok && v != commonsteps.HttpPortNotImplemented {
+		env["PACKER_HTTP_PORT"] = v
+	}
+	for _, kv := range c.Vars {
+		kv, err := interpolate.Render(kv, &c.ctx)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		env[parts[0]] = parts[1]
+	}
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// command returns the command line running script, and the environment
+// variables it is run with. The environment is set by the command line of
+// execute_command, through its Vars, or else directly.
+func (c *Config) command(script string, env map[string]string, generatedData map[string]interface{}) ([]string, map[string]string, error) {
+	if !c.executeCommand {
+		if c.shell == "" {
+			// sh runs the script following its shebang, if any.
+			return []string{"/bin/sh", "-c", hostexec.ShellSh.Quote(script)}, env, nil
+		}
+		return c.shell.ScriptArgs(script), env, nil
+	}
+
+	generatedData["Vars"] = c.flattenEnv(env)
+	generatedData["Script"] = script
+	generatedData["Command"] = script
+	c.ctx.Data = generatedData
+	args := make([]string, len(c.ExecuteCommand))
+	for i, arg := range c.ExecuteCommand {
+		arg, err := interpolate.Render(arg, &c.ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error processing command: %s", err)
+		}
+		args[i] = arg
+	}
+	return args, nil, nil
+}
+
+// flattenEnv returns the Vars of execute_command, setting env with
+// env_var_format.
+func (c *Config) flattenEnv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		if c.envVarFormat {
+			// The custom formats quote the values themselves.
+			fmt.Fprintf(&b, c.EnvVarFormat, k, strings.Replace(env[k], "'", `'"'"'`, -1))
+			continue
+		}
+		shell := c.shell
+		if shell == "" || c.UseLinuxPathing {
+			shell = hostexec.ShellSh
+		}
+		b.WriteString(shell.SetEnv(k, env[k]))
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package shelllocal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/hostexec"
+)
+
+// decodeHCL decodes src into c, like HCL2 templates are.
+func decodeHCL(t *testing.T, c *Config, src string) error {
+	t.Helper()
+	f, diags := hclparse.NewParser().ParseHCL([]byte(src), "shell-local.pkr.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	raw, diags := hcldec.Decode(f.Body, c.ConfigSpec(), nil)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	return Decode(c, raw)
+}
+
+func TestDecode_shell(t *testing.T) {
+	var c Config
+	if err := decodeHCL(t, &c, `
+inline = ["echo hello"]
+shell  = "pwsh"
+`); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if err := Validate(&c); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if c.shell != hostexec.ShellPwsh || c.TempfileExtension != "ps1" {
+		t.Errorf("expected the scripts to run with pwsh, got %q with the %q extension", c.shell, c.TempfileExtension)
+	}
+
+	c = Config{}
+	if err := Decode(&c, map[string]interface{}{
+		"inline":          []string{"echo hello"},
+		"shell":           "bash",
+		"execute_command": []string{"bash", "{{.Script}}"},
+	}); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if err := Validate(&c); err == nil {
+		t.Error("expected shell and execute_command to be exclusive")
+	}
+
+	c = Config{}
+	if err := Decode(&c, map[string]interface{}{"inline": []string{"echo hello"}, "shell": "zsh"}); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if err := Validate(&c); err == nil || !strings.Contains(err.Error(), "zsh") {
+		t.Errorf("expected the unknown shell to be reported, got %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test scripts need a POSIX shell")
+	}
+
+	for name, extra := range map[string]map[string]interface{}{
+		"shell":           {"shell": "sh"},
+		"execute_command": {"execute_command": []string{"/bin/sh", "-c", "{{.Vars}} /bin/sh {{.Script}}"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			raw := map[string]interface{}{
+				"inline":           []string{`echo "$GREETING" > ` + out},
+				"environment_vars": []string{"GREETING=it's $HOME"},
+			}
+			for k, v := range extra {
+				raw[k] = v
+			}
+			var c Config
+			if err := Decode(&c, raw); err != nil {
+				t.Fatalf("unexpected failure: %s", err)
+			}
+			if err := Validate(&c); err != nil {
+				t.Fatalf("unexpected failure: %s", err)
+			}
+			if _, err := Run(context.Background(), packersdk.TestUi(t), &c, nil); err != nil {
+				t.Fatalf("unexpected failure: %s", err)
+			}
+			b, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(b)); got != "it's $HOME" {
+				t.Errorf("expected the variable to be set verbatim, got %q", got)
+			}
+		})
+	}
+}
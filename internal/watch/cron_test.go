@@ -0,0 +1,57 @@
+package watch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2022, 3, 2, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2022, 3, 2, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2022, 3, 2, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2022, 3, 2, 10, 40, 0, 0, time.UTC)},
+		{"15/20 * * * *", time.Date(2022, 3, 2, 10, 35, 0, 0, time.UTC)},
+		{"0 3 * * 1", time.Date(2022, 3, 7, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2022, 3, 6, 3, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2022, 3, 2, 13, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// The day of month or the day of week.
+		{"0 0 15 * 5", time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %s", tt.expr, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: expected %s, got %s", tt.expr, tt.want, got)
+		}
+	}
+}
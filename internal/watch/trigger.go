@@ -0,0 +1,152 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Trigger tells when the builds of a watched template must run again.
+type Trigger interface {
+	// Check returns why the builds must run again at now, an empty reason
+	// when they must not.
+	Check(ctx context.Context, now time.Time) (reason string, err error)
+	String() string
+}
+
+// Scheduler is implemented by the triggers firing at given times, so that
+// the watcher checks them on time rather than at its next poll.
+type Scheduler interface {
+	Trigger
+	// Next returns the time the trigger fires next, the zero time when
+	// unknown.
+	Next() time.Time
+}
+
+// CronTrigger fires at the times of a cron schedule. The first check only
+// schedules the next time, so that starting a watcher does not build.
+type CronTrigger struct {
+	Expr     string
+	Schedule *Schedule
+
+	next time.Time
+}
+
+// NewCronTrigger returns the trigger firing at the times of the cron
+// expression expr, see ParseCron.
+func NewCronTrigger(expr string) (*CronTrigger, error) {
+	s, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &CronTrigger{Expr: expr, Schedule: s}, nil
+}
+
+func (t *CronTrigger) Check(_ context.Context, now time.Time) (string, error) {
+	if t.next.IsZero() {
+		t.next = t.Schedule.Next(now)
+		return "", nil
+	}
+	if now.Before(t.next) {
+		return "", nil
+	}
+	scheduled := t.next
+	t.next = t.Schedule.Next(now)
+	return fmt.Sprintf("scheduled at %s", scheduled.Format(time.RFC3339)), nil
+}
+
+func (t *CronTrigger) Next() time.Time { return t.next }
+
+func (t *CronTrigger) String() string { return fmt.Sprintf("cron %q", t.Expr) }
+
+// ChangeTrigger fires when Value changes, like the hash of the values of the
+// data sources of a template. The first check only records the value.
+type ChangeTrigger struct {
+	Name  string
+	Value func(ctx context.Context) (string, error)
+
+	last   string
+	primed bool
+}
+
+func (t *ChangeTrigger) Check(ctx context.Context, _ time.Time) (string, error) {
+	v, err := t.Value(ctx)
+	if err != nil {
+		return "", err
+	}
+	changed := t.primed && v != t.last
+	t.last, t.primed = v, true
+	if !changed {
+		return "", nil
+	}
+	return fmt.Sprintf("%s changed", t.Name), nil
+}
+
+func (t *ChangeTrigger) String() string { return t.Name }
+
+// DefaultFeedPattern matches CVE identifiers.
+var DefaultFeedPattern = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
+
+// FeedTrigger polls a feed, like the RSS or JSON feed of security advisories
+// of a distribution, and fires when an entry matching Pattern appears in it.
+// The first poll only records the entries already there.
+type FeedTrigger struct {
+	URL string
+	// Pattern matches the entries of the feed, DefaultFeedPattern when nil.
+	Pattern *regexp.Regexp
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+
+	seen   map[string]bool
+	primed bool
+}
+
+func (t *FeedTrigger) Check(ctx context.Context, _ time.Time) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %s", t.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", t.URL, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", t.URL, err)
+	}
+
+	pattern := t.Pattern
+	if pattern == nil {
+		pattern = DefaultFeedPattern
+	}
+	if t.seen == nil {
+		t.seen = map[string]bool{}
+	}
+	var added []string
+	for _, entry := range pattern.FindAllString(string(body), -1) {
+		if t.seen[entry] {
+			continue
+		}
+		t.seen[entry] = true
+		added = append(added, entry)
+	}
+	primed := t.primed
+	t.primed = true
+	if !primed || len(added) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("new entries in %s: %v", t.URL, added), nil
+}
+
+func (t *FeedTrigger) String() string { return fmt.Sprintf("feed %s", t.URL) }
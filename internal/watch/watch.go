@@ -0,0 +1,202 @@
+// Package watch runs the builds of a template again whenever one of its
+// triggers fires: a cron schedule, a change of the values of its data sources
+// or a new entry in a security feed.
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// DefaultLockFilename is the name of the lock file written next to a
+// template when no other path is given.
+const DefaultLockFilename = "packer.watch.lock"
+
+// The states of a watcher.
+const (
+	StateWaiting  = "waiting"
+	StateBuilding = "building"
+	StateStopped  = "stopped"
+)
+
+// Status reports what a watcher is doing.
+type Status struct {
+	Template string   `json:"template"`
+	State    string   `json:"state"`
+	Triggers []string `json:"triggers"`
+
+	LastCheck time.Time `json:"last_check"`
+	NextCheck time.Time `json:"next_check"`
+	// Errors are the errors of the triggers at the last check.
+	Errors []string `json:"errors,omitempty"`
+
+	// Builds counts the builds run since the watcher started.
+	Builds    int          `json:"builds"`
+	LastBuild *BuildStatus `json:"last_build,omitempty"`
+}
+
+// BuildStatus describes a build run by a watcher.
+type BuildStatus struct {
+	Reasons    []string  `json:"reasons"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Succeeded  bool      `json:"succeeded"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Watcher checks its triggers every Interval and runs Build when any of them
+// fires. Builds never overlap: the triggers firing during a build are checked
+// once it is over.
+type Watcher struct {
+	Template string
+	Triggers []Trigger
+	Interval time.Duration
+
+	// LockPath is the file locked while the watcher runs, so that a template
+	// is watched once at a time.
+	LockPath string
+	// StatusPath, when set, is where the status of the watcher is written
+	// each time it changes.
+	StatusPath string
+
+	Build func(ctx context.Context, reasons []string) error
+	Ui    packersdk.Ui
+}
+
+// Run watches until ctx is done. It fails when the lock is held by another
+// watcher; the failures of the triggers and of the builds are reported, and
+// the watcher goes on.
+func (w *Watcher) Run(ctx context.Context) error {
+	lock := flock.New(w.LockPath)
+	locked, err := lock.TryLock()
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %s", w.LockPath, err)
+	}
+	if !locked {
+		return fmt.Errorf("%s is locked, the template is already watched", w.LockPath)
+	}
+	defer lock.Unlock()
+
+	status := &Status{Template: w.Template}
+	for _, t := range w.Triggers {
+		status.Triggers = append(status.Triggers, t.String())
+	}
+	w.Ui.Say(fmt.Sprintf("Watching %s, checking %s every %s",
+		w.Template, strings.Join(status.Triggers, ", "), w.Interval))
+
+	for {
+		now := time.Now()
+		status.LastCheck = now
+		status.Errors = nil
+		var reasons []string
+		for _, t := range w.Triggers {
+			reason, err := t.Check(ctx, now)
+			if ctx.Err() != nil {
+				return w.stop(status)
+			}
+			if err != nil {
+				w.Ui.Error(fmt.Sprintf("Failed to check %s: %s", t, err))
+				status.Errors = append(status.Errors, fmt.Sprintf("%s: %s", t, err))
+				continue
+			}
+			if reason != "" {
+				reasons = append(reasons, reason)
+			}
+		}
+
+		if len(reasons) > 0 {
+			w.Ui.Say(fmt.Sprintf("Building %s: %s", w.Template, strings.Join(reasons, ", ")))
+			build := &BuildStatus{Reasons: reasons, StartedAt: time.Now()}
+			status.State = StateBuilding
+			status.Builds++
+			status.LastBuild = build
+			w.writeStatus(status)
+
+			err := w.Build(ctx, reasons)
+			build.FinishedAt = time.Now()
+			build.Succeeded = err == nil
+			if err != nil {
+				build.Error = err.Error()
+				w.Ui.Error(fmt.Sprintf("Build of %s failed: %s", w.Template, err))
+			} else {
+				w.Ui.Say(fmt.Sprintf("Build of %s succeeded", w.Template))
+			}
+			if ctx.Err() != nil {
+				return w.stop(status)
+			}
+		}
+
+		next := w.nextCheck(time.Now())
+		status.State = StateWaiting
+		status.NextCheck = next
+		w.writeStatus(status)
+
+		select {
+		case <-ctx.Done():
+			return w.stop(status)
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// nextCheck returns when the triggers are checked next: after Interval, or
+// earlier when a scheduled trigger fires before.
+func (w *Watcher) nextCheck(now time.Time) time.Time {
+	next := now.Add(w.Interval)
+	for _, t := range w.Triggers {
+		if s, ok := t.(Scheduler); ok {
+			if at := s.Next(); !at.IsZero() && at.Before(next) {
+				next = at
+			}
+		}
+	}
+	return next
+}
+
+func (w *Watcher) stop(status *Status) error {
+	status.State = StateStopped
+	status.NextCheck = time.Time{}
+	w.writeStatus(status)
+	w.Ui.Say(fmt.Sprintf("Stopped watching %s", w.Template))
+	return nil
+}
+
+// writeStatus writes the status to StatusPath through a temporary file, so
+// that readers never see a partial status. Failures are reported only, as
+// they do not prevent watching.
+func (w *Watcher) writeStatus(status *Status) {
+	if w.StatusPath == "" {
+		return
+	}
+	raw, err := json.MarshalIndent(status, "", "  ")
+	if err == nil {
+		err = writeFile(w.StatusPath, raw)
+	}
+	if err != nil {
+		w.Ui.Error(fmt.Sprintf("Failed to write the status to %s: %s", w.StatusPath, err))
+	}
+}
+
+func writeFile(path string, raw []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
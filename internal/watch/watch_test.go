@@ -0,0 +1,193 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestCronTrigger(t *testing.T) {
+	trigger, err := NewCronTrigger("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	start := time.Date(2022, 3, 2, 10, 30, 0, 0, time.UTC)
+
+	// Starting does not fire.
+	if reason, _ := trigger.Check(ctx, start); reason != "" {
+		t.Errorf("expected the first check not to fire, got %q", reason)
+	}
+	if want := time.Date(2022, 3, 2, 11, 0, 0, 0, time.UTC); !trigger.Next().Equal(want) {
+		t.Errorf("expected the next time to be %s, got %s", want, trigger.Next())
+	}
+	if reason, _ := trigger.Check(ctx, start.Add(10*time.Minute)); reason != "" {
+		t.Errorf("expected no fire before the scheduled time, got %q", reason)
+	}
+	if reason, _ := trigger.Check(ctx, start.Add(31*time.Minute)); reason == "" {
+		t.Error("expected the trigger to fire")
+	}
+	if want := time.Date(2022, 3, 2, 12, 0, 0, 0, time.UTC); !trigger.Next().Equal(want) {
+		t.Errorf("expected the next time to be %s, got %s", want, trigger.Next())
+	}
+}
+
+func TestChangeTrigger(t *testing.T) {
+	values := []string{"a", "a", "b", "b"}
+	wantFired := []bool{false, false, true, false}
+	i := 0
+	trigger := &ChangeTrigger{
+		Name:  "data sources",
+		Value: func(context.Context) (string, error) { return values[i], nil },
+	}
+	for ; i < len(values); i++ {
+		reason, err := trigger.Check(context.Background(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (reason != "") != wantFired[i] {
+			t.Errorf("check %d: expected fired to be %t, got %q", i, wantFired[i], reason)
+		}
+	}
+}
+
+func TestFeedTrigger(t *testing.T) {
+	bodies := []string{
+		"CVE-2022-0001",
+		"CVE-2022-0001",
+		"CVE-2022-0002 openssl\nCVE-2022-0001",
+		"CVE-2022-0003 zlib",
+	}
+	i := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, bodies[i])
+	}))
+	defer server.Close()
+
+	trigger := &FeedTrigger{URL: server.URL}
+	wantFired := []bool{false, false, true, true}
+	for ; i < len(bodies); i++ {
+		reason, err := trigger.Check(context.Background(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (reason != "") != wantFired[i] {
+			t.Errorf("poll %d: expected fired to be %t, got %q", i, wantFired[i], reason)
+		}
+	}
+}
+
+func TestFeedTrigger_error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	trigger := &FeedTrigger{URL: server.URL}
+	if _, err := trigger.Check(context.Background(), time.Now()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// countTrigger fires at each check, once it was checked skip times.
+type countTrigger struct {
+	skip, checks int
+	err          error
+}
+
+func (t *countTrigger) Check(context.Context, time.Time) (string, error) {
+	t.checks++
+	if t.err != nil {
+		return "", t.err
+	}
+	if t.checks <= t.skip {
+		return "", nil
+	}
+	return fmt.Sprintf("check %d", t.checks), nil
+}
+
+func (t *countTrigger) String() string { return "count" }
+
+func TestWatcher_Run(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reasons [][]string
+	w := &Watcher{
+		Template: "template.pkr.hcl",
+		Triggers: []Trigger{
+			&countTrigger{skip: 1},
+			&countTrigger{err: errors.New("unreachable")},
+		},
+		Interval:   time.Millisecond,
+		LockPath:   filepath.Join(dir, DefaultLockFilename),
+		StatusPath: filepath.Join(dir, "status.json"),
+		Ui:         packersdk.TestUi(t),
+		Build: func(_ context.Context, r []string) error {
+			reasons = append(reasons, r)
+			if len(reasons) == 2 {
+				cancel()
+			}
+			return errors.New("failed")
+		},
+	}
+	if err := w.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reasons) != 2 || reasons[0][0] != "check 2" || reasons[1][0] != "check 3" {
+		t.Errorf("unexpected builds: %v", reasons)
+	}
+
+	raw, err := os.ReadFile(w.StatusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status Status
+	if err := json.Unmarshal(raw, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.State != StateStopped || status.Builds != 2 {
+		t.Errorf("unexpected status: %s", raw)
+	}
+	if status.LastBuild == nil || status.LastBuild.Succeeded || status.LastBuild.Error != "failed" {
+		t.Errorf("unexpected last build: %s", raw)
+	}
+	if len(status.Errors) != 1 || !strings.Contains(status.Errors[0], "unreachable") {
+		t.Errorf("unexpected errors: %s", raw)
+	}
+}
+
+func TestWatcher_Run_locked(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), DefaultLockFilename)
+	lock := flock.New(lockPath)
+	if _, err := lock.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	w := &Watcher{
+		Template: "template.pkr.hcl",
+		Interval: time.Millisecond,
+		LockPath: lockPath,
+		Ui:       packersdk.TestUi(t),
+		Build: func(context.Context, []string) error {
+			t.Error("the build should not run")
+			return nil
+		},
+	}
+	err := w.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "already watched") {
+		t.Errorf("expected the watcher to fail on the lock, got %v", err)
+	}
+}
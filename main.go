@@ -11,8 +11,8 @@ import (
 	"math/rand"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/hashicorp/go-uuid"
@@ -55,6 +55,21 @@ func realMain() int {
 	UUID, _ := uuid.GenerateUUID()
 	os.Setenv("PACKER_RUN_UUID", UUID)
 
+	// Disable logging here
+	log.SetOutput(ioutil.Discard)
+
+	// The profile selected with -profile may enable logging. Errors are
+	// reported by the wrapped process, which loads the profile again.
+	config, _ := loadConfig()
+	if _, name, err := extractProfile(os.Args[1:]); err == nil && name != "" && config != nil {
+		if p, err := config.Profile(name); err == nil {
+			if err := p.SetupLogging(UUID); err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't setup log output: %s", err)
+				return 1
+			}
+		}
+	}
+
 	// Determine where logs should go in general (requested by the user)
 	logWriter, err := logOutput()
 	if err != nil {
@@ -67,9 +82,6 @@ func realMain() int {
 
 	packersdk.LogSecretFilter.SetOutput(logWriter)
 
-	// Disable logging here
-	log.SetOutput(ioutil.Discard)
-
 	// We always send logs to a temporary file that we use in case
 	// there is a panic. Otherwise, we delete it.
 	logTempFile, err := tmp.File("packer-log")
@@ -87,7 +99,7 @@ func realMain() int {
 	go copyOutput(outR, doneCh)
 
 	// Enable checkpoint for panic reporting
-	if config, _ := loadConfig(); config != nil && !config.DisableCheckpoint {
+	if config != nil && !config.DisableCheckpoint {
 		packer.CheckpointReporter = packer.NewCheckpointReporter(
 			config.DisableCheckpointSignature,
 		)
@@ -98,7 +110,7 @@ func realMain() int {
 	wrapConfig.Writer = io.MultiWriter(logTempFile, &packersdk.LogSecretFilter)
 	wrapConfig.Stdout = outW
 	wrapConfig.DetectDuration = 500 * time.Millisecond
-	wrapConfig.ForwardSignals = []os.Signal{syscall.SIGTERM}
+	wrapConfig.ForwardSignals = forwardedSignals(os.Args[1:])
 	exitStatus, err := panicwrap.Wrap(&wrapConfig)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Couldn't start Packer: %s", err)
@@ -140,8 +152,9 @@ func wrappedMain() int {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 	}
 
-	packersdk.LogSecretFilter.SetOutput(os.Stderr)
-	log.SetOutput(&packersdk.LogSecretFilter)
+	// The logs, including the ones of the plugins, are masked from the
+	// secrets, see packer.Secrets.
+	log.SetOutput(packer.Secrets.Writer(os.Stderr))
 
 	inPlugin := inPlugin()
 	if inPlugin {
@@ -176,6 +189,7 @@ func wrappedMain() int {
 			config.DisableCheckpointSignature,
 		)
 	}
+	packer.Tracer = packer.NewTracerFromEnv()
 
 	cacheDir, err := packersdk.CachePath()
 	if err != nil {
@@ -188,17 +202,56 @@ func wrappedMain() int {
 	}
 	log.Printf("[INFO] Setting cache directory: %s", cacheDir)
 
+	// Select the profile of the command line, if any, and apply its flags.
+	args, profileName, err := extractProfile(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%s Error parsing the command line: %s\n", ErrorPrefix, err)
+		return 1
+	}
+	var selected *profile
+	if profileName != "" {
+		selected, err = config.Profile(profileName)
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "%s Error loading configuration: %s\n", ErrorPrefix, err)
+			return 1
+		}
+		log.Printf("[INFO] Using profile %q", profileName)
+	}
+
 	// Determine if we're in machine-readable mode by mucking around with
 	// the arguments...
-	args, machineReadable := extractMachineReadable(os.Args[1:])
+	args, machineReadable := extractMachineReadable(args)
+	args, jsonOutput := extractJSON(args)
+	args, sensitiveOutput, err := extractSensitiveOutput(args)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%s Error parsing the command line: %s\n", ErrorPrefix, err)
+		return 1
+	}
+	if selected != nil {
+		args = selected.Apply(args)
+		machineReadable = machineReadable || selected.MachineReadable
+		jsonOutput = jsonOutput || selected.JSON
+	}
 
 	defer packer.CleanupClients()
 
 	var ui packersdk.Ui
-	if machineReadable {
+	if jsonOutput {
+		// Every message is a JSON object, written to stdout.
+		ui = &packer.JSONUi{
+			Writer:    os.Stdout,
+			Sensitive: sensitiveOutput,
+		}
+
+		if err := os.Setenv("PACKER_NO_COLOR", "1"); err != nil {
+			ui.Error(fmt.Sprintf("Packer failed to initialize UI: %s\n", err))
+			return 1
+		}
+	} else if machineReadable {
 		// Setup the UI as we're being machine-readable
 		ui = &packer.MachineReadableUi{
-			Writer: os.Stdout,
+			Writer:    os.Stdout,
+			Sensitive: sensitiveOutput,
 		}
 
 		// Set this so that we don't get colored output in our machine-
@@ -211,8 +264,8 @@ func wrappedMain() int {
 	} else {
 		basicUi := &packersdk.BasicUi{
 			Reader:      os.Stdin,
-			Writer:      os.Stdout,
-			ErrorWriter: os.Stdout,
+			Writer:      packer.Secrets.Writer(os.Stdout),
+			ErrorWriter: packer.Secrets.Writer(os.Stdout),
 			PB:          &packersdk.NoopProgressTracker{},
 		}
 		ui = basicUi
@@ -244,7 +297,11 @@ func wrappedMain() int {
 				Hook:         config.StarHook,
 				PluginConfig: config.Plugins,
 			},
-			Version: version.Version,
+			Version:                version.Version,
+			LocalExec:              config.LocalExec,
+			CachePolicy:            config.Cache,
+			Notifications:          config.Notifications,
+			DisableArtifactHistory: config.DisableArtifactHistory,
 		},
 		Ui: ui,
 	}
@@ -303,8 +360,47 @@ func excludeHelpFunc(commands map[string]cli.CommandFactory, exclude []string) c
 // flag and returns whether or not it is on. It modifies the args
 // to remove this flag.
 func extractMachineReadable(args []string) ([]string, bool) {
+	return extractBoolFlag(args, "-machine-readable")
+}
+
+// jsonFlagCommands are the commands defining a -json flag of their own, which
+// is left to them.
+var jsonFlagCommands = map[string]bool{
+	"artifacts": true,
+	"cache":     true,
+	"console":   true,
+}
+
+// extractJSON checks the args for the -json flag, enabling the output of
+// one JSON object per message, and returns whether or not it is on. It
+// modifies the args to remove this flag.
+func extractJSON(args []string) ([]string, bool) {
+	if len(args) > 0 && jsonFlagCommands[args[0]] {
+		return args, false
+	}
+	return extractBoolFlag(args, "-json")
+}
+
+// extractSensitiveOutput checks the args for the -sensitive-output=policy
+// flag, setting how the machine-readable and JSON outputs handle secrets, and
+// returns the policy, the one of packer.SensitiveOutputEnvVar when the flag is
+// not set. It modifies the args to remove this flag.
+func extractSensitiveOutput(args []string) ([]string, packer.SensitiveOutput, error) {
+	value := os.Getenv(packer.SensitiveOutputEnvVar)
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-sensitive-output=") {
+			value = strings.TrimPrefix(arg, "-sensitive-output=")
+			args = append(args[:i:i], args[i+1:]...)
+			break
+		}
+	}
+	policy, err := packer.ParseSensitiveOutput(value)
+	return args, policy, err
+}
+
+func extractBoolFlag(args []string, flag string) ([]string, bool) {
 	for i, arg := range args {
-		if arg == "-machine-readable" {
+		if arg == flag {
 			// We found it. Slice it out.
 			result := make([]string, len(args)-1)
 			copy(result, args[:i])
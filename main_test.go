@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/packer/command"
+	"github.com/hashicorp/packer/packer"
 	"github.com/mitchellh/cli"
 )
 
@@ -62,6 +63,43 @@ func TestExtractMachineReadable(t *testing.T) {
 	}
 }
 
+func TestExtractJSON(t *testing.T) {
+	result, json := extractJSON([]string{"build", "-json", "template.pkr.hcl"})
+	expected := []string{"build", "template.pkr.hcl"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if !json {
+		t.Fatal("should be json")
+	}
+
+	if _, json = extractJSON(expected); json {
+		t.Fatal("should not be json")
+	}
+
+	// The -json flag of the console is its own.
+	args := []string{"console", "-file", "exprs.hcl", "-json"}
+	if result, json = extractJSON(args); json || !reflect.DeepEqual(result, args) {
+		t.Fatalf("expected the -json flag to be left to the console, got %#v", result)
+	}
+}
+
+func TestExtractSensitiveOutput(t *testing.T) {
+	result, policy, err := extractSensitiveOutput([]string{"build", "-json", "-sensitive-output=mark", "template.pkr.hcl"})
+	expected := []string{"build", "-json", "template.pkr.hcl"}
+	if err != nil || !reflect.DeepEqual(result, expected) || policy != packer.SensitiveOutputMark {
+		t.Fatalf("bad: %#v, %q, %v", result, policy, err)
+	}
+
+	t.Setenv(packer.SensitiveOutputEnvVar, "omit")
+	if _, policy, _ = extractSensitiveOutput(expected); policy != packer.SensitiveOutputOmit {
+		t.Fatalf("expected the policy of the environment, got %q", policy)
+	}
+	if _, _, err = extractSensitiveOutput([]string{"build", "-sensitive-output=plain"}); err == nil {
+		t.Fatal("expected an unknown policy to fail")
+	}
+}
+
 func TestRandom(t *testing.T) {
 	if rand.Intn(9999999) == 8498210 {
 		t.Fatal("math.rand is not seeded properly")
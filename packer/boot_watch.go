@@ -0,0 +1,196 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ConsoleReader is implemented by builders able to read the console, or the
+// serial output, of the machine they build. While the machine boots, until
+// the communicator connects, the core watches its console to fail the build
+// as soon as the machine cannot boot, instead of waiting for the
+// communicator to time out.
+type ConsoleReader interface {
+	// ReadConsole returns the output of the console since the machine
+	// started, empty when it did not start yet.
+	ReadConsole(ctx context.Context) (string, error)
+}
+
+// consoleReader returns the ConsoleReader capability of b, looking through the
+// builders wrapped by the core.
+func consoleReader(b packersdk.Builder) (ConsoleReader, bool) {
+	if rb, ok := b.(*RegistryBuilder); ok {
+		b = rb.Builder
+	}
+	c, ok := b.(ConsoleReader)
+	return c, ok
+}
+
+// The console is read often while it changes, and less and less often while
+// it does not, like when the machine waits for a network timeout.
+var (
+	bootWatchMinInterval = time.Second
+	bootWatchMaxInterval = 15 * time.Second
+)
+
+// bootFailure is a sign, on the console, that a machine will never boot.
+type bootFailure struct {
+	reason  string
+	pattern *regexp.Regexp
+	// count is the number of matches of pattern that make a failure.
+	count int
+}
+
+var bootFailures = []bootFailure{
+	{"a kernel panic", regexp.MustCompile(`Kernel panic - not syncing|Your (PC|device) ran into a problem|\*\*\* STOP: 0x`), 1},
+	// Installers reboot once or twice, a machine booting more often than
+	// that is stuck in a loop.
+	{"a boot loop", regexp.MustCompile(`Linux version \d`), 4},
+	{"a boot loop", regexp.MustCompile(`SeaBIOS \(version`), 4},
+	{"wrong credentials", regexp.MustCompile(`Login incorrect|The user name or password is incorrect`), 1},
+}
+
+// BootFailureError is returned by a build whose machine failed to boot.
+type BootFailureError struct {
+	Reason string
+	// Excerpt is the part of the console showing the failure.
+	Excerpt string
+}
+
+func (e *BootFailureError) Error() string {
+	return fmt.Sprintf("the machine failed to boot, %s was detected on its console:\n%s", e.Reason, e.Excerpt)
+}
+
+// detectBootFailure returns the first failure shown by the console output.
+func detectBootFailure(output string) *BootFailureError {
+	for _, f := range bootFailures {
+		matches := f.pattern.FindAllStringIndex(output, -1)
+		if len(matches) < f.count {
+			continue
+		}
+		return &BootFailureError{Reason: f.reason, Excerpt: consoleExcerpt(output, matches[f.count-1][0])}
+	}
+	return nil
+}
+
+// consoleExcerpt returns the lines of output around offset.
+func consoleExcerpt(output string, offset int) string {
+	const before, after = 15, 5
+	lines := strings.Split(output[:offset], "\n")
+	if len(lines) > before {
+		lines = lines[len(lines)-before:]
+	}
+	start := strings.Join(lines, "\n")
+	lines = strings.SplitN(output[offset:], "\n", after+2)
+	if len(lines) > after+1 {
+		lines = lines[:after+1]
+	}
+	end := strings.Join(lines, "\n")
+	return strings.TrimRight(start+end, "\n")
+}
+
+// bootWatch watches the console of a machine until its communicator connects,
+// that is when the builder runs the provision hook. A nil bootWatch watches
+// nothing.
+type bootWatch struct {
+	console   ConsoleReader
+	cancel    context.CancelFunc
+	connected chan struct{}
+	once      sync.Once
+	done      chan struct{}
+	err       *BootFailureError
+}
+
+// watchBoot starts watching the boot of the machine of the build, when its
+// builder is a ConsoleReader. The builder runs with the returned context,
+// cancelled when the machine fails to boot.
+func (b *CoreBuild) watchBoot(ctx context.Context) (context.Context, *bootWatch) {
+	console, ok := consoleReader(b.Builder)
+	if !ok {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &bootWatch{
+		console:   console,
+		cancel:    cancel,
+		connected: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go w.run(ctx)
+	return ctx, w
+}
+
+func (w *bootWatch) run(ctx context.Context) {
+	defer close(w.done)
+	interval := bootWatchMinInterval
+	last := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.connected:
+			return
+		case <-time.After(interval):
+		}
+
+		output, err := w.console.ReadConsole(ctx)
+		if err != nil {
+			log.Printf("[DEBUG] failed to read the console of the machine: %s", err)
+		}
+		if err != nil || output == last {
+			if interval *= 2; interval > bootWatchMaxInterval {
+				interval = bootWatchMaxInterval
+			}
+			continue
+		}
+		last = output
+		interval = bootWatchMinInterval
+
+		if failure := detectBootFailure(output); failure != nil {
+			w.err = failure
+			w.cancel()
+			return
+		}
+	}
+}
+
+// hook returns hook, telling the watch when the communicator connected.
+func (w *bootWatch) hook(hook packersdk.Hook) packersdk.Hook {
+	if w == nil {
+		return hook
+	}
+	return &bootWatchHook{Hook: hook, watch: w}
+}
+
+// stop stops watching and returns the boot failure detected, if any.
+func (w *bootWatch) stop() error {
+	if w == nil {
+		return nil
+	}
+	w.once.Do(func() { close(w.connected) })
+	<-w.done
+	w.cancel()
+	if w.err == nil {
+		return nil
+	}
+	return w.err
+}
+
+type bootWatchHook struct {
+	packersdk.Hook
+	watch *bootWatch
+}
+
+func (h *bootWatchHook) Run(ctx context.Context, name string, ui packersdk.Ui, comm packersdk.Communicator, data interface{}) error {
+	if name == packersdk.HookProvision {
+		h.watch.once.Do(func() { close(h.watch.connected) })
+	}
+	return h.Hook.Run(ctx, name, ui, comm, data)
+}
@@ -0,0 +1,115 @@
+package packer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestDetectBootFailure(t *testing.T) {
+	banner := "SeaBIOS (version 1.13.0)\nBooting from Hard Disk...\n[    0.000000] Linux version 5.4.0\n"
+	tests := []struct {
+		name           string
+		output         string
+		expectedReason string
+		expectedLines  []string
+	}{
+		{"booting", banner + "Ubuntu 20.04 LTS ubuntu ttyS0\nubuntu login: ", "", nil},
+		{"installer reboot", strings.Repeat(banner, 2), "", nil},
+		{"kernel panic", banner + "[    1.2] VFS: Unable to mount root fs\n[    1.3] Kernel panic - not syncing: VFS: Unable to mount root fs on unknown-block(0,0)\n[    1.4] CPU: 0 PID: 1\n",
+			"a kernel panic", []string{"Unable to mount root fs", "CPU: 0 PID: 1"}},
+		{"boot loop", strings.Repeat(banner, 4) + "[    0.1] booting\n", "a boot loop", []string{"SeaBIOS (version 1.13.0)"}},
+		{"wrong credentials", banner + "ubuntu login: packer\nPassword:\n\nLogin incorrect\nubuntu login: ", "wrong credentials", []string{"Login incorrect"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := detectBootFailure(tt.output)
+			if tt.expectedReason == "" {
+				if failure != nil {
+					t.Fatalf("unexpected failure: %s", failure)
+				}
+				return
+			}
+			if failure == nil {
+				t.Fatalf("expected %s to be detected", tt.expectedReason)
+			}
+			if failure.Reason != tt.expectedReason {
+				t.Errorf("expected %s, got %s", tt.expectedReason, failure.Reason)
+			}
+			for _, line := range tt.expectedLines {
+				if !strings.Contains(failure.Excerpt, line) {
+					t.Errorf("expected %q in the excerpt, got:\n%s", line, failure.Excerpt)
+				}
+			}
+		})
+	}
+}
+
+func TestConsoleExcerpt(t *testing.T) {
+	var lines []string
+	for i := 0; i < 40; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	output := strings.Join(lines, "\n")
+	offset := strings.Index(output, "\n"+strings.Repeat("x", 20)+"\n") + 1
+
+	excerpt := strings.Split(consoleExcerpt(output, offset), "\n")
+	if len(excerpt) != 20 {
+		t.Fatalf("expected 20 lines, got %d:\n%s", len(excerpt), strings.Join(excerpt, "\n"))
+	}
+	if excerpt[0] != strings.Repeat("x", 6) || excerpt[19] != strings.Repeat("x", 25) {
+		t.Errorf("unexpected excerpt:\n%s", strings.Join(excerpt, "\n"))
+	}
+}
+
+// consoleBuilder is a builder whose machine shows console on its console.
+type consoleBuilder struct {
+	packersdk.MockBuilder
+	console string
+}
+
+func (b *consoleBuilder) ReadConsole(context.Context) (string, error) {
+	return b.console, nil
+}
+
+func TestBuild_Run_BootFailure(t *testing.T) {
+	defer func(interval time.Duration) { bootWatchMinInterval = interval }(bootWatchMinInterval)
+	bootWatchMinInterval = 10 * time.Millisecond
+
+	panicked := "[    0.000000] Linux version 5.4.0\n[    1.0] Kernel panic - not syncing: Attempted to kill init!\n"
+
+	t.Run("machine fails to boot", func(t *testing.T) {
+		builder := &consoleBuilder{console: panicked}
+		// The communicator never connects.
+		builder.RunFn = func(ctx context.Context) { <-ctx.Done() }
+		build := testBuild()
+		build.Builder = builder
+		build.Prepare()
+
+		_, err := build.Run(context.Background(), testUi())
+		var failure *BootFailureError
+		if !errors.As(err, &failure) {
+			t.Fatalf("expected a boot failure, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "Attempted to kill init!") {
+			t.Errorf("expected the console excerpt in the error, got %s", err)
+		}
+	})
+
+	t.Run("communicator connected", func(t *testing.T) {
+		// The console is only watched until the communicator connects,
+		// later output does not fail the build.
+		builder := &consoleBuilder{console: panicked}
+		build := testBuild()
+		build.Builder = builder
+		build.Prepare()
+
+		if _, err := build.Run(context.Background(), testUi()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
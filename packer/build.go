@@ -3,9 +3,14 @@ package packer
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
@@ -32,11 +37,129 @@ type CoreBuild struct {
 	// Indicates whether the build is already initialized before calling Prepare(..)
 	Prepared bool
 
-	debug         bool
-	force         bool
-	onError       string
-	l             sync.Mutex
-	prepareCalled bool
+	// SerialGroup, when set, is shared by the builds that must not run
+	// concurrently, for example because they use the same physical host.
+	SerialGroup string
+
+	// HostRequirements, when set, is what the machine running Packer must
+	// provide for the build to succeed, see CheckHost.
+	HostRequirements *HostRequirements
+
+	// DependsOn lists the names of the build blocks, see BuildName, whose
+	// builds must all succeed before this build starts.
+	DependsOn []string
+
+	// TempDir, when set, is the scratch directory of the build, see
+	// BuildTempDir. It is created when the build starts and removed once
+	// the build and its post-processors completed, so that concurrent builds
+	// do not share their temporary files.
+	TempDir string
+
+	// Priority orders the builds when -parallel-builds limits how many run
+	// at once: the builds of higher priority start first.
+	Priority int
+
+	// ResolveDependencies, when set, is called before the build runs with the
+	// artifacts of the builds it depends on, by build block name then by
+	// build type, so that the builder can be configured with them.
+	ResolveDependencies func(artifacts map[string]map[string][]packersdk.Artifact) error
+
+	// RetryAttempts is how many times the builder runs at most when it fails,
+	// waiting RetryBackoff between two attempts. Each new attempt runs with a
+	// fresh run UUID.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+
+	// Checkpoints, when set, records the progress of the build, so that a
+	// later run can clean it up or continue it, see Resume, if Packer
+	// crashes. The builder reports its progress when it is a Checkpointer.
+	Checkpoints *CheckpointFile
+	// Resume tells what to do with the resources left behind by a previous
+	// run of the build: ResumeCleanup destroys them, ResumeContinue goes on
+	// from the last step completed. The build fails when resources were left
+	// behind and Resume is not set.
+	Resume string
+
+	// Timeout, when set, is how long the build can run, retries and
+	// post-processors included. Once it is over the build is cancelled, so
+	// that the builder cleans up, and fails.
+	Timeout time.Duration
+
+	// Pause, when set, pauses the provisioners of the build between two of
+	// them, see PauseGate. The cleanup provisioner is never paused.
+	Pause *PauseGate
+
+	// TranscriptPath, when set, is where the transcript of the commands run
+	// on the guest by the provisioners is written once the build ran.
+	TranscriptPath string
+	// TranscriptHashOutput records the sha256 of the outputs of the
+	// commands in the transcript.
+	TranscriptHashOutput bool
+
+	// RecordingPath, when set, is where the recording of the interactions of
+	// the build with its plugins is written once the build ran, for a later
+	// run to Replay it.
+	RecordingPath string
+
+	// PreBuild are local commands run before the builder starts, the build
+	// fails when one of them fails. PostBuild are local commands run once the
+	// build and its post-processors succeeded.
+	PreBuild  []LocalCommand
+	PostBuild []LocalCommand
+
+	// EncryptionPolicy, when set, is checked against the images produced by
+	// the builder before the post-processors run.
+	EncryptionPolicy *EncryptionPolicy
+
+	// ResourceLedger, when set, records the resources the builder reports
+	// creating, until it reports them destroyed, so that the ones left behind
+	// can be destroyed by `packer cleanup`. See ResourceMachineType.
+	ResourceLedger *ResourceLedger
+
+	// PostProcessLedger, when set, records the post-processor chains that
+	// failed along with the builder artifact, kept for them to run again
+	// with `packer postprocess -retry`, see RetryPostProcessors.
+	PostProcessLedger *PostProcessLedger
+
+	// ConsoleLogPath, when set, is where the console output of the machine
+	// is captured while the builder runs, when the builder can read it, see
+	// ConsoleStreamer.
+	ConsoleLogPath string
+
+	// DebugEvaluator, when set, evaluates the expressions typed at the pauses
+	// of the build, see DebugEvaluator.
+	DebugEvaluator DebugEvaluator
+
+	// OnGeneratedData, when set, is called with the data generated by the
+	// builder once it connected to the machine, before the provisioners run.
+	OnGeneratedData func(data map[string]interface{})
+
+	// BuilderInputHash identifies the configuration of the builder, see
+	// InputHash. Incremental builds resume from a snapshot only when it did
+	// not change.
+	BuilderInputHash string
+	// PostProcessorsInputHash identifies the configuration of the
+	// post-processors, see InputHash.
+	PostProcessorsInputHash string
+
+	debug           bool
+	force           bool
+	forceDeregister bool
+	incremental     bool
+	fromStage       string
+	onError         string
+	onErrorRetries  int
+	l               sync.Mutex
+	prepareCalled   bool
+
+	// recorder records the progress of the build in Checkpoints.
+	recorder *buildRecorder
+	// recording records the interactions of the build with its plugins,
+	// when RecordingPath is set.
+	recording *BuildRecording
+	// timer records the time spent by the steps of the last run of the
+	// build.
+	timer *buildTimer
 }
 
 // CoreBuildPostProcessor Keeps track of the post-processor and the
@@ -55,7 +178,13 @@ type CoreBuildProvisioner struct {
 	PType       string
 	PName       string
 	Provisioner packersdk.Provisioner
-	config      []interface{}
+	// InputHash identifies the configuration of the provisioner, see
+	// InputHash.
+	InputHash string
+	// Stage is the name of the stage grouping the provisioner with the
+	// provisioners around it, if any.
+	Stage  string
+	config []interface{}
 }
 
 // Returns the name of the build.
@@ -94,10 +223,19 @@ func (b *CoreBuild) Prepare() (warn []string, err error) {
 		common.CoreVersionConfigKey:   version.FormattedVersion(),
 		common.DebugConfigKey:         b.debug,
 		common.ForceConfigKey:         b.force,
-		common.OnErrorConfigKey:       b.onError,
+		common.OnErrorConfigKey:       b.pluginOnError(),
 		common.TemplatePathKey:        b.TemplatePath,
 		common.UserVariablesConfigKey: b.Variables,
 	}
+	if b.forceDeregister && BuilderSupportsForceDeregister(b.Builder) {
+		packerConfig[ForceDeregisterConfigKey] = true
+	}
+
+	// The communicator passwords are masked in the output of the build.
+	Secrets.RegisterConfigSecrets(b.BuilderConfig)
+	for _, coreProv := range b.Provisioners {
+		Secrets.RegisterConfigSecrets(coreProv.config...)
+	}
 
 	// Prepare the builder
 	generatedVars, warn, err := b.Builder.Prepare(b.BuilderConfig, packerConfig)
@@ -161,6 +299,56 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 		panic("Prepare must be called first")
 	}
 
+	b.timer = &buildTimer{}
+	b.recording = nil
+	if originalUi == nil {
+		// Builds run without a Ui, like in tests, output nothing: neither
+		// their events nor the report of their timings.
+		originalUi = &packersdk.BasicUi{
+			Reader:      strings.NewReader(""),
+			Writer:      ioutil.Discard,
+			ErrorWriter: ioutil.Discard,
+		}
+	}
+	defer func() { reportTimings(&TargetedUI{Target: b.Name(), Ui: originalUi}, b.timer.Timings()) }()
+	start := time.Now()
+
+	removeTempDir, err := b.createTempDir(originalUi)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTempDir()
+
+	var artifacts []packersdk.Artifact
+	if b.Timeout > 0 {
+		parent := ctx
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+		defer cancel()
+		artifacts, err = b.run(ctx, originalUi)
+		if (err != nil || artifacts == nil) && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+			err = fmt.Errorf("Build '%s' timed out after %s", b.Name(), b.Timeout)
+		}
+	} else {
+		artifacts, err = b.run(ctx, originalUi)
+	}
+	// A cancelled build did not complete either.
+	outcome := err
+	if outcome == nil && artifacts == nil && ctx.Err() != nil {
+		outcome = ctx.Err()
+	}
+	if b.recorder != nil {
+		b.recorder.finish(outcome)
+		err = outcome
+	}
+	if b.recording != nil {
+		b.writeRecording(&TargetedUI{Target: b.Name(), Ui: originalUi})
+	}
+	Tracer.ExportBuild(b.Name(), start, outcome, b.timer)
+	return artifacts, err
+}
+
+func (b *CoreBuild) run(ctx context.Context, originalUi packersdk.Ui) ([]packersdk.Artifact, error) {
 	// Copy the hooks
 	hooks := make(map[string][]packersdk.Hook)
 	for hookName, hookList := range b.hooks {
@@ -168,6 +356,25 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 		copy(hooks[hookName], hookList)
 	}
 
+	var transcript *Transcript
+	if b.TranscriptPath != "" {
+		transcript = NewTranscript(b.Name(), b.TranscriptHashOutput)
+	}
+
+	var labels func(map[string]string)
+	if rb, ok := b.Builder.(*RegistryBuilder); ok {
+		labels = func(l map[string]string) {
+			if err := rb.ArtifactMetadataPublisher.UpdateLabelsForBuild(rb.Name, l); err != nil {
+				log.Printf("[TRACE] failed to record the provisioner labels of %q for the HCP Packer registry: %s", b.Name(), err)
+			}
+		}
+	}
+
+	// The provision hooks pass the run UUID of each attempt of the builder to
+	// the provisioners, see runBuilder.
+	var provisionHooks []*ProvisionHook
+	var mainProvisionHook *ProvisionHook
+
 	// Add a hook for the provisioners if we have provisioners
 	if len(b.Provisioners) > 0 {
 		hookedProvisioners := make([]*HookedProvisioner, len(b.Provisioners))
@@ -195,9 +402,31 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 			hooks[packersdk.HookProvision] = make([]packersdk.Hook, 0, 1)
 		}
 
-		hooks[packersdk.HookProvision] = append(hooks[packersdk.HookProvision], &ProvisionHook{
+		var stages *StagePlan
+		switch {
+		case b.incremental:
+			var err error
+			stages, err = b.planStages(&TargetedUI{Target: b.Name(), Ui: originalUi})
+			if err != nil {
+				return nil, err
+			}
+		case b.hasStages():
+			stages = &StagePlan{Stages: b.stages()}
+		}
+
+		provisionHook := &ProvisionHook{
 			Provisioners: hookedProvisioners,
-		})
+			Transcript:   transcript,
+			Labels:       labels,
+			Stages:       stages,
+			Retries:      b.stepRetries(),
+			Evaluate:     b.DebugEvaluator,
+			Pause:        b.Pause,
+			timer:        b.timer,
+		}
+		mainProvisionHook = provisionHook
+		provisionHooks = append(provisionHooks, provisionHook)
+		hooks[packersdk.HookProvision] = append(hooks[packersdk.HookProvision], provisionHook)
 	}
 
 	if b.CleanupProvisioner.PType != "" {
@@ -206,12 +435,25 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 			b.CleanupProvisioner.config,
 			b.CleanupProvisioner.PType,
 		}
-		hooks[packersdk.HookCleanupProvision] = []packersdk.Hook{&ProvisionHook{
+		cleanupHook := &ProvisionHook{
 			Provisioners: []*HookedProvisioner{hookedCleanupProvisioner},
-		}}
+			Transcript:   transcript,
+			Labels:       labels,
+			Evaluate:     b.DebugEvaluator,
+			timer:        b.timer,
+		}
+		provisionHooks = append(provisionHooks, cleanupHook)
+		hooks[packersdk.HookCleanupProvision] = []packersdk.Hook{cleanupHook}
 	}
 
-	hook := &packersdk.DispatchHook{Mapping: hooks}
+	var hook packersdk.Hook = &packersdk.DispatchHook{Mapping: hooks}
+	if b.RecordingPath != "" {
+		b.recording = NewBuildRecording(b.Name())
+		hook = b.recording.hook(hook)
+	}
+	if b.OnGeneratedData != nil {
+		hook = &generatedDataHook{Hook: hook, report: b.OnGeneratedData}
+	}
 	artifacts := make([]packersdk.Artifact, 0, 1)
 
 	// The builder just has a normal Ui, but targeted
@@ -220,11 +462,45 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 		Ui:     originalUi,
 	}
 
+	if b.Checkpoints != nil {
+		rec, skip, err := b.startCheckpoint(ctx, builderUi)
+		if err != nil {
+			return nil, err
+		}
+		b.recorder = rec
+		if mainProvisionHook != nil {
+			mainProvisionHook.Skip = skip
+			mainProvisionHook.Provisioned = rec.provisioned
+		}
+	}
+
+	if err := b.runLocalCommands(ctx, builderUi, "pre-build", b.PreBuild, nil); err != nil {
+		return nil, err
+	}
+
+	b.setCollectorTags("")
+
 	log.Printf("Running builder: %s", b.BuilderType)
-	ts := CheckpointReporter.AddSpan(b.Type, "builder", b.BuilderConfig)
-	builderArtifact, err := b.Builder.Run(ctx, builderUi, hook)
-	ts.End(err)
+	// The pauses between the steps of the builder evaluate the expressions
+	// typed, the data of the builder is not known yet.
+	var runUi packersdk.Ui = builderUi
+	if b.DebugEvaluator != nil {
+		runUi = &debugUi{Ui: builderUi, evaluate: b.DebugEvaluator}
+	}
+	builderArtifact, err := b.runBuilder(ctx, runUi, hook, provisionHooks)
+	if b.recording != nil {
+		b.recording.builderDone(builderArtifact, err)
+	}
+	if transcript != nil {
+		b.writeTranscript(transcript, builderUi)
+	}
 	if err != nil {
+		switch {
+		case provisionersFailed(provisionHooks):
+			err = classifyFailure(err, FailureProvisioner)
+		case ctx.Err() == nil:
+			err = classifyBuilderFailure(err)
+		}
 		return nil, err
 	}
 
@@ -234,8 +510,12 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 		return nil, nil
 	}
 
-	errors := make([]error, 0)
-	keepOriginalArtifact := len(b.PostProcessors) == 0
+	if err := b.EncryptionPolicy.Check(builderArtifact); err != nil {
+		if rb, ok := b.Builder.(*RegistryBuilder); ok {
+			markBuildUnsuccessful(ctx, rb.ArtifactMetadataPublisher, rb.Name)
+		}
+		return nil, err
+	}
 
 	select {
 	case <-ctx.Done():
@@ -244,9 +524,56 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 	default:
 	}
 
-	// Run the post-processors
+	ppArtifacts, keepOriginalArtifact, failedChains, errors := b.runPostProcessors(ctx, originalUi, builderUi, builderArtifact, nil)
+	artifacts = append(artifacts, ppArtifacts...)
+	if b.PostProcessLedger != nil {
+		if len(failedChains) > 0 {
+			// The builder artifact is kept for the failed chains to run
+			// again with `packer postprocess -retry`.
+			keepOriginalArtifact = true
+			b.recordFailedPostProcessors(builderUi, builderArtifact, failedChains, errors)
+		} else if err := b.PostProcessLedger.Forget(b.Name()); err != nil {
+			log.Printf("[WARN] failed to update the post-process ledger: %s", err)
+		}
+	}
+
+	if keepOriginalArtifact {
+		artifacts = append(artifacts, nil)
+		copy(artifacts[1:], artifacts)
+		artifacts[0] = builderArtifact
+	} else {
+		log.Printf("Deleting original artifact for build '%s'", b.Type)
+		if err := builderArtifact.Destroy(); err != nil {
+			errors = append(errors, fmt.Errorf("Error destroying builder artifact: %s; bad artifact: %#v", err, builderArtifact.Files()))
+		}
+	}
+
+	if len(errors) == 0 {
+		if err := b.runLocalCommands(ctx, builderUi, "post-build", b.PostBuild, artifacts); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	if len(errors) > 0 {
+		err = &packersdk.MultiError{Errors: errors}
+		return artifacts, err
+	}
+
+	return artifacts, nil
+}
+
+// runPostProcessors runs the post-processor chains of the build against
+// builderArtifact, only the chains whose index is in only when it is set. It
+// returns the artifacts of the chains, whether builderArtifact must be kept,
+// and the indexes of the chains that failed along with their errors.
+func (b *CoreBuild) runPostProcessors(ctx context.Context, originalUi, builderUi packersdk.Ui, builderArtifact packersdk.Artifact, only map[int]bool) (artifacts []packersdk.Artifact, keepOriginalArtifact bool, failedChains []int, errs []error) {
+	keepOriginalArtifact = len(b.PostProcessors) == 0
+
 PostProcessorRunSeqLoop:
-	for _, ppSeq := range b.PostProcessors {
+	for chain, ppSeq := range b.PostProcessors {
+		if only != nil && !only[chain] {
+			continue
+		}
 		priorArtifact := builderArtifact
 		for i, corePP := range ppSeq {
 			ppUi := &TargetedUI{
@@ -259,11 +586,31 @@ PostProcessorRunSeqLoop:
 			} else {
 				builderUi.Say(fmt.Sprintf("Running post-processor: %s (type %s)", corePP.PName, corePP.PType))
 			}
+			builderUi.Machine("post-processor", "started", corePP.PType)
 			ts := CheckpointReporter.AddSpan(corePP.PType, "post-processor", corePP.config)
-			artifact, defaultKeep, forceOverride, err := corePP.PostProcessor.PostProcess(ctx, ppUi, priorArtifact)
+			var artifact packersdk.Artifact
+			var defaultKeep, forceOverride bool
+			var err error
+			for attempt, retries := 0, b.stepRetries(); ; attempt++ {
+				endTiming := b.timer.start(TimingPostProcessor, corePP.PName)
+				artifact, defaultKeep, forceOverride, err = corePP.PostProcessor.PostProcess(ctx, ppUi, priorArtifact)
+				endTiming(err)
+				if b.recording != nil {
+					b.recording.postProcessorDone(corePP.PType, artifact, defaultKeep, forceOverride, err)
+				}
+				if err == nil || attempt >= retries || ctx.Err() != nil {
+					break
+				}
+				builderUi.Error(fmt.Sprintf("Post-processor %s failed, running it again (retry %d of %d): %s", corePP.PName, attempt+1, retries, err))
+			}
 			ts.End(err)
 			if err != nil {
-				errors = append(errors, fmt.Errorf("Post-processor failed: %s", err))
+				class := ClassifyFailure(err)
+				if class == FailureOther {
+					class = FailurePostProcessor
+				}
+				errs = append(errs, &FailureError{Class: class, Err: fmt.Errorf("Post-processor failed: %s", err)})
+				failedChains = append(failedChains, chain)
 				continue PostProcessorRunSeqLoop
 			}
 
@@ -310,7 +657,7 @@ PostProcessorRunSeqLoop:
 					log.Printf("Deleting prior artifact from post-processor '%s'", corePP.PType)
 					if err := priorArtifact.Destroy(); err != nil {
 						log.Printf("Error is %#v", err)
-						errors = append(errors, fmt.Errorf("Failed cleaning up prior artifact: %s; pp is %s", err, corePP.PType))
+						errs = append(errs, fmt.Errorf("Failed cleaning up prior artifact: %s; pp is %s", err, corePP.PType))
 					}
 				}
 			}
@@ -324,23 +671,76 @@ PostProcessorRunSeqLoop:
 		}
 	}
 
-	if keepOriginalArtifact {
-		artifacts = append(artifacts, nil)
-		copy(artifacts[1:], artifacts)
-		artifacts[0] = builderArtifact
-	} else {
-		log.Printf("Deleting original artifact for build '%s'", b.Type)
-		if err := builderArtifact.Destroy(); err != nil {
-			errors = append(errors, fmt.Errorf("Error destroying builder artifact: %s; bad artifact: %#v", err, builderArtifact.Files()))
+	return artifacts, keepOriginalArtifact, failedChains, errs
+}
+
+// runBuilder runs the builder, running it again while it fails and the build
+// has attempts left. Each new attempt gets a fresh run UUID, passed to the
+// provisioners by provisionHooks.
+func (b *CoreBuild) runBuilder(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook, provisionHooks []*ProvisionHook) (packersdk.Artifact, error) {
+	for attempt := 1; ; attempt++ {
+		ts := CheckpointReporter.AddSpan(b.Type, "builder", b.BuilderConfig)
+		builderCtx, watch := b.watchBoot(ctx)
+		capture := b.captureConsole(ctx, attempt)
+		endTiming := b.timer.start(TimingBuilder, b.Type)
+		artifact, err := b.Builder.Run(builderCtx, b.trackResources(ui), watch.hook(capture.hook(hook)))
+		if bootErr := watch.stop(); bootErr != nil {
+			err = bootErr
+		}
+		err = capture.stop(err)
+		endTiming(err)
+		ts.End(err)
+		// Registry builders add the digests themselves, before publishing
+		// them.
+		if _, published := b.Builder.(*RegistryBuilder); err == nil && !published {
+			artifact = withDigests(ctx, ui, b.Builder, artifact)
 		}
+		if err == nil || artifact != nil || attempt >= b.RetryAttempts || ctx.Err() != nil {
+			return artifact, err
+		}
+
+		ui.Error(fmt.Sprintf("Attempt %d of %d failed: %s", attempt, b.RetryAttempts, err))
+		ui.Say(fmt.Sprintf("Retrying the build in %s...", b.RetryBackoff))
+		select {
+		case <-time.After(b.RetryBackoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+
+		runUUID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the run UUID of attempt %d: %s", attempt+1, err)
+		}
+		log.Printf("Running attempt %d of %d of build '%s' with run UUID %s", attempt+1, b.RetryAttempts, b.Name(), runUUID)
+		for _, h := range provisionHooks {
+			h.RunUUID = runUUID
+			// The builder starts over, the provisioners too.
+			h.Skip = 0
+		}
+		if b.recorder != nil {
+			b.recorder.restart()
+		}
+		if b.recording != nil {
+			b.recording.restart()
+		}
+		b.setCollectorTags(runUUID)
 	}
+}
 
-	if len(errors) > 0 {
-		err = &packersdk.MultiError{Errors: errors}
-		return artifacts, err
+// provisionersFailed tells whether a provisioner failed in the last run of the
+// hooks.
+func provisionersFailed(hooks []*ProvisionHook) bool {
+	for _, h := range hooks {
+		if h.failed {
+			return true
+		}
 	}
+	return false
+}
 
-	return artifacts, nil
+// Timings returns the time spent by the steps of the last run of the build.
+func (b *CoreBuild) Timings() []StepTiming {
+	return b.timer.Timings()
 }
 
 func (b *CoreBuild) SetDebug(val bool) {
@@ -359,6 +759,35 @@ func (b *CoreBuild) SetForce(val bool) {
 	b.force = val
 }
 
+func (b *CoreBuild) SetForceDeregister(val bool) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.forceDeregister = val
+}
+
+// SetIncremental makes the build snapshot the machine between its
+// provisioners, when the builder is a Snapshotter, and resume from the last
+// snapshot whose inputs did not change.
+func (b *CoreBuild) SetIncremental(val bool) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.incremental = val
+}
+
+// SetFromStage makes an incremental build resume from the snapshot taken
+// before the named stage, running it again along with the stages after it.
+func (b *CoreBuild) SetFromStage(val string) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.fromStage = val
+}
+
 func (b *CoreBuild) SetOnError(val string) {
 	if b.prepareCalled {
 		panic("prepare has already been called")
@@ -366,3 +795,96 @@ func (b *CoreBuild) SetOnError(val string) {
 
 	b.onError = val
 }
+
+// OnErrorRetry is the -on-error value running a failed provisioner or
+// post-processor again, up to the retries set with SetOnErrorRetries, before
+// cleaning up. The steps of the builders run in their plugins and cannot be
+// run again on their own, a failing builder cleans up.
+const OnErrorRetry = "retry"
+
+// SetOnErrorRetries sets how many times a failed step runs again with
+// -on-error=retry.
+func (b *CoreBuild) SetOnErrorRetries(val int) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.onErrorRetries = val
+}
+
+// stepRetries returns how many times a failed provisioner or post-processor
+// runs again.
+func (b *CoreBuild) stepRetries() int {
+	if b.onError != OnErrorRetry {
+		return 0
+	}
+	return b.onErrorRetries
+}
+
+// pluginOnError returns the -on-error value passed to the plugins. Core runs
+// the failed steps again with -on-error=retry, the plugins clean up once the
+// retries are exhausted.
+func (b *CoreBuild) pluginOnError() string {
+	if b.onError == OnErrorRetry {
+		return "cleanup"
+	}
+	return b.onError
+}
+
+// transcriptWaitTimeout bounds the time spent waiting for the commands of a
+// transcript to report their exit status.
+var transcriptWaitTimeout = 30 * time.Second
+
+// writeRecording writes the recording of the build, see RecordingPath.
+func (b *CoreBuild) writeRecording(ui packersdk.Ui) {
+	if err := b.recording.Write(b.RecordingPath, transcriptWaitTimeout); err != nil {
+		ui.Error(fmt.Sprintf("Failed to write the recording to %s: %s", b.RecordingPath, err))
+		return
+	}
+	ui.Say(fmt.Sprintf("Recording of the build written to %s", b.RecordingPath))
+}
+
+// writeTranscript writes the transcript of the build and, when the build is
+// published to the HCP Packer registry, attaches its digest to the build
+// labels.
+func (b *CoreBuild) writeTranscript(t *Transcript, ui packersdk.Ui) {
+	if !t.Wait(transcriptWaitTimeout) {
+		log.Printf("[WARN] some commands of %q did not report their exit status in time", b.Name())
+	}
+	if err := t.Write(b.TranscriptPath); err != nil {
+		ui.Error(fmt.Sprintf("Failed to write the transcript to %s: %s", b.TranscriptPath, err))
+		return
+	}
+	ui.Say(fmt.Sprintf("Transcript of the guest commands written to %s", b.TranscriptPath))
+
+	rb, ok := b.Builder.(*RegistryBuilder)
+	if !ok {
+		return
+	}
+	digest, err := t.Digest()
+	if err != nil {
+		log.Printf("[TRACE] failed to compute the transcript digest of %q: %s", b.Name(), err)
+		return
+	}
+	err = rb.ArtifactMetadataPublisher.UpdateLabelsForBuild(rb.Name, map[string]string{
+		"transcript_sha256":   digest,
+		"transcript_commands": strconv.Itoa(len(t.Commands)),
+	})
+	if err != nil {
+		log.Printf("[TRACE] failed to record the transcript of %q for the HCP Packer registry: %s", b.Name(), err)
+	}
+}
+
+// generatedDataHook reports the data generated by the builder, passed to the
+// provision hook.
+type generatedDataHook struct {
+	packersdk.Hook
+	report func(map[string]interface{})
+}
+
+func (h *generatedDataHook) Run(ctx context.Context, name string, ui packersdk.Ui, comm packersdk.Communicator, data interface{}) error {
+	if data, ok := data.(map[string]interface{}); ok && name == packersdk.HookProvision {
+		h.report(data)
+	}
+	return h.Hook.Run(ctx, name, ui, comm, data)
+}
@@ -0,0 +1,52 @@
+package packer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// TempDirDataKey is the key of the scratch directory of a build, see
+// CoreBuild.TempDir, in the data of the build: HCL2 provisioners and
+// post-processors read it as build.temp_dir.
+const TempDirDataKey = "temp_dir"
+
+// unsafePathChars are the characters of a build name replaced to name its
+// scratch directory.
+var unsafePathChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// BuildTempDir returns the scratch directory of the build named name, under
+// root or else the system temporary directory. The directories of the builds
+// of a run share a parent directory named after the PID of Packer, to keep
+// apart the builds of concurrent runs.
+func BuildTempDir(root, name string) string {
+	if root == "" {
+		root = os.TempDir()
+	}
+	return filepath.Join(root, fmt.Sprintf("packer-%d", os.Getpid()), unsafePathChars.ReplaceAllString(name, "_"))
+}
+
+// createTempDir creates the scratch directory of the build, and returns the
+// function removing it once the build completed.
+func (b *CoreBuild) createTempDir(ui packersdk.Ui) (func(), error) {
+	if b.TempDir == "" {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(b.TempDir, 0700); err != nil {
+		return nil, fmt.Errorf("Build '%s' failed to create its temporary directory: %s", b.Name(), err)
+	}
+	log.Printf("[INFO] (%s) using the temporary directory %s", b.Name(), b.TempDir)
+	return func() {
+		if err := os.RemoveAll(b.TempDir); err != nil {
+			ui.Error(fmt.Sprintf("Build '%s' failed to remove its temporary directory: %s", b.Name(), err))
+			return
+		}
+		// The parent directory is shared by the builds of the run, the last
+		// build to complete removes it.
+		_ = os.Remove(filepath.Dir(b.TempDir))
+	}, nil
+}
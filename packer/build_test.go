@@ -2,8 +2,12 @@ package packer
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -463,6 +467,26 @@ func TestBuild_Run_Artifacts(t *testing.T) {
 	}
 }
 
+func TestBuild_Run_OnGeneratedData(t *testing.T) {
+	var reported map[string]interface{}
+	build := testBuild()
+	build.OnGeneratedData = func(data map[string]interface{}) { reported = data }
+	build.Prepare()
+	ctx := context.Background()
+	if _, err := build.Run(ctx, testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data := map[string]interface{}{"SSHPublicKey": "ssh-ed25519 AAAA"}
+	hook := build.Builder.(*packersdk.MockBuilder).RunHook
+	if err := hook.Run(ctx, packersdk.HookProvision, nil, new(packersdk.MockCommunicator), data); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(reported, data) {
+		t.Fatalf("expected the generated data to be reported, got %#v", reported)
+	}
+}
+
 func TestBuild_RunBeforePrepare(t *testing.T) {
 	defer func() {
 		p := recover()
@@ -496,3 +520,203 @@ func TestBuild_Cancel(t *testing.T) {
 		t.Fatal("build should err")
 	}
 }
+
+// flakyBuilder fails its first runs.
+type flakyBuilder struct {
+	packersdk.MockBuilder
+	failures int
+	runs     int
+}
+
+func (b *flakyBuilder) Run(ctx context.Context, ui packersdk.Ui, h packersdk.Hook) (packersdk.Artifact, error) {
+	b.runs++
+	if b.runs <= b.failures {
+		return nil, errors.New("transient failure")
+	}
+	return b.MockBuilder.Run(ctx, ui, h)
+}
+
+// runUUIDProvisioner records the run UUID of the builds it provisions.
+type runUUIDProvisioner struct {
+	packersdk.MockProvisioner
+	runUUIDs []interface{}
+}
+
+func (p *runUUIDProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, data map[string]interface{}) error {
+	p.runUUIDs = append(p.runUUIDs, data["PackerRunUUID"])
+	return nil
+}
+
+func TestBuild_Run_Retries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		wantRuns  int
+		expectErr bool
+	}{
+		{"no retries", 1, 0, 1, true},
+		{"succeeds on retry", 2, 3, 3, false},
+		{"out of attempts", 3, 3, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &flakyBuilder{failures: tt.failures}
+			provisioner := &runUUIDProvisioner{}
+			build := testBuild()
+			build.Builder = builder
+			build.Provisioners[0].Provisioner = provisioner
+			build.RetryAttempts = tt.attempts
+			build.RetryBackoff = time.Millisecond
+			build.Prepare()
+
+			_, err := build.Run(context.Background(), testUi())
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if builder.runs != tt.wantRuns {
+				t.Errorf("expected %d runs of the builder, got %d", tt.wantRuns, builder.runs)
+			}
+			if tt.expectErr {
+				return
+			}
+			// The attempt that succeeded runs with a fresh run UUID.
+			if len(provisioner.runUUIDs) != 1 {
+				t.Fatalf("expected the provisioner to run once, got %v", provisioner.runUUIDs)
+			}
+			if runUUID, _ := provisioner.runUUIDs[0].(string); runUUID == "" {
+				t.Errorf("expected a fresh run UUID, got %v", provisioner.runUUIDs[0])
+			}
+		})
+	}
+}
+
+// flakyProvisioner fails its first runs.
+type flakyProvisioner struct {
+	packersdk.MockProvisioner
+	failures int
+	runs     int
+}
+
+func (p *flakyProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, data map[string]interface{}) error {
+	p.runs++
+	if p.runs <= p.failures {
+		return errors.New("transient failure")
+	}
+	return nil
+}
+
+// flakyPostProcessor fails its first runs.
+type flakyPostProcessor struct {
+	MockPostProcessor
+	failures int
+	runs     int
+}
+
+func (p *flakyPostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, a packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	p.runs++
+	if p.runs <= p.failures {
+		return nil, false, false, errors.New("transient failure")
+	}
+	return p.MockPostProcessor.PostProcess(ctx, ui, a)
+}
+
+func TestBuild_Run_OnErrorRetry(t *testing.T) {
+	tests := []struct {
+		name                                             string
+		onError                                          string
+		retries                                          int
+		builderFailures, provisionerFailures, ppFailures int
+		wantBuilderRuns, wantProvisionerRuns, wantPPRuns int
+		expectErr                                        bool
+	}{
+		{"cleanup", "cleanup", 2, 0, 1, 0, 1, 1, 0, true},
+		// The builder runs its steps itself, it is not run again.
+		{"builder not retried", OnErrorRetry, 2, 1, 0, 0, 1, 0, 0, true},
+		{"provisioner retried", OnErrorRetry, 2, 0, 2, 0, 1, 3, 1, false},
+		{"provisioner out of retries", OnErrorRetry, 2, 0, 3, 0, 1, 3, 0, true},
+		{"post-processor retried", OnErrorRetry, 2, 0, 0, 1, 1, 1, 2, false},
+		{"post-processor out of retries", OnErrorRetry, 1, 0, 0, 2, 1, 1, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &flakyBuilder{failures: tt.builderFailures}
+			provisioner := &flakyProvisioner{failures: tt.provisionerFailures}
+			pp := &flakyPostProcessor{failures: tt.ppFailures, MockPostProcessor: MockPostProcessor{ArtifactId: "pp"}}
+			build := testBuild()
+			build.Builder = builder
+			build.Provisioners[0].Provisioner = provisioner
+			build.PostProcessors[0][0].PostProcessor = pp
+			build.SetOnError(tt.onError)
+			build.SetOnErrorRetries(tt.retries)
+			build.Prepare()
+
+			_, err := build.Run(context.Background(), testUi())
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if builder.runs != tt.wantBuilderRuns || provisioner.runs != tt.wantProvisionerRuns || pp.runs != tt.wantPPRuns {
+				t.Errorf("expected %d, %d and %d runs of the builder, provisioner and post-processor, got %d, %d and %d",
+					tt.wantBuilderRuns, tt.wantProvisionerRuns, tt.wantPPRuns, builder.runs, provisioner.runs, pp.runs)
+			}
+		})
+	}
+}
+
+func TestBuild_Prepare_OnErrorRetry(t *testing.T) {
+	build := testBuild()
+	builder := build.Builder.(*packersdk.MockBuilder)
+	build.SetOnError(OnErrorRetry)
+	build.Prepare()
+
+	// The plugins clean up once the steps ran out of retries.
+	packerConfig := testDefaultPackerConfig()
+	if !reflect.DeepEqual(builder.PrepareConfig, []interface{}{42, packerConfig}) {
+		t.Fatalf("bad: %#v", builder.PrepareConfig)
+	}
+}
+
+func TestBuild_Run_Timeout(t *testing.T) {
+	cleanedUp := false
+	build := testBuild()
+	build.Builder = &packersdk.MockBuilder{
+		RunFn: func(ctx context.Context) {
+			<-ctx.Done()
+			cleanedUp = true
+		},
+	}
+	build.Timeout = 10 * time.Millisecond
+	build.Prepare()
+
+	artifacts, err := build.Run(context.Background(), testUi())
+	if err == nil || err.Error() != "Build 'test' timed out after 10ms" {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if len(artifacts) != 0 {
+		t.Errorf("expected no artifacts, got %v", artifacts)
+	}
+	if !cleanedUp {
+		t.Error("the builder should have been cancelled")
+	}
+}
+
+func TestBuild_Run_TempDir(t *testing.T) {
+	build := testBuild()
+	build.TempDir = BuildTempDir(t.TempDir(), "example.null.build")
+	var existed bool
+	build.Builder.(*packersdk.MockBuilder).RunFn = func(context.Context) {
+		_, err := os.Stat(build.TempDir)
+		existed = err == nil
+	}
+
+	build.Prepare()
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !existed {
+		t.Fatal("the temporary directory should exist while the builder runs")
+	}
+	if _, err := os.Stat(filepath.Dir(build.TempDir)); !os.IsNotExist(err) {
+		t.Fatalf("the temporary directories should be removed once the build completed, got %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// DefaultCheckpointFilename is the name of the checkpoint file written next to
+// a template when no other path is given.
+const DefaultCheckpointFilename = "packer.checkpoint.json"
+
+// Checkpointer is implemented by builders able to report the steps they
+// complete and the resources they create, so that a build interrupted by a
+// crash of Packer can be cleaned up, or continued from its last completed
+// step, by a later run.
+type Checkpointer interface {
+	// SetCheckpointRecorder is called before Run with the recorder the
+	// builder reports its progress to.
+	SetCheckpointRecorder(r CheckpointRecorder)
+	// ResumeFromCheckpoint makes the next Run continue after the last step
+	// completed in c, reusing the resources recorded in c. It is called
+	// before Run.
+	ResumeFromCheckpoint(c *BuildCheckpoint) error
+	// CleanupCheckpoint destroys the resources recorded in c.
+	CleanupCheckpoint(ctx context.Context, ui packersdk.Ui, c *BuildCheckpoint) error
+}
+
+// CheckpointRecorder receives the progress of a builder, see Checkpointer.
+type CheckpointRecorder interface {
+	StepCompleted(step string)
+	ResourceCreated(r CheckpointResource)
+	ResourceDestroyed(id string)
+}
+
+// checkpointer returns the Checkpointer capability of b, looking through the
+// builders wrapped by the core.
+func checkpointer(b packersdk.Builder) (Checkpointer, bool) {
+	if rb, ok := b.(*RegistryBuilder); ok {
+		b = rb.Builder
+	}
+	c, ok := b.(Checkpointer)
+	return c, ok
+}
+
+// CheckpointResource is a resource created by a builder.
+type CheckpointResource struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Data holds what the builder needs to find the resource again, like
+	// its region.
+	Data map[string]string `json:"data,omitempty"`
+}
+
+func (r CheckpointResource) String() string {
+	return fmt.Sprintf("%s %s", r.Type, r.ID)
+}
+
+// The statuses of a build checkpoint.
+const (
+	CheckpointRunning = "running"
+	CheckpointFailed  = "failed"
+	CheckpointDone    = "done"
+)
+
+// The ways builds resume from their checkpoints, see CoreBuild.Resume.
+const (
+	ResumeContinue = "continue"
+	ResumeCleanup  = "cleanup"
+)
+
+// BuildCheckpoint records the progress of a build. A build still running
+// when its checkpoint is read again was interrupted by a crash.
+type BuildCheckpoint struct {
+	Status string `json:"status"`
+	// BuilderInputHash is the input hash of the builder, a build only
+	// continues from a checkpoint of the same builder configuration.
+	BuilderInputHash string `json:"builder_input_hash"`
+	// Steps are the steps completed by the builder, in order.
+	Steps []string `json:"steps,omitempty"`
+	// Resources are the resources created by the builder and not destroyed
+	// yet.
+	Resources []CheckpointResource `json:"resources,omitempty"`
+	// Provisioners is the number of provisioners that ran successfully.
+	Provisioners int       `json:"provisioners"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CheckpointFile holds the checkpoints of the builds of a run, by build name,
+// in a JSON file written every time a checkpoint changes. It is safe for use
+// by builds running in parallel.
+type CheckpointFile struct {
+	Path string
+
+	mu     sync.Mutex
+	builds map[string]*BuildCheckpoint
+}
+
+// OpenCheckpointFile reads the checkpoint file at path, an empty one when it
+// does not exist yet.
+func OpenCheckpointFile(path string) (*CheckpointFile, error) {
+	f := &CheckpointFile{Path: path, builds: map[string]*BuildCheckpoint{}}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &f.builds); err != nil {
+		return nil, fmt.Errorf("failed to read the checkpoint file %s: %s", path, err)
+	}
+	return f, nil
+}
+
+// Get returns a copy of the checkpoint of the named build, nil when there is
+// none.
+func (f *CheckpointFile) Get(build string) *BuildCheckpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.builds[build]
+	if !ok {
+		return nil
+	}
+	cp := *c
+	cp.Steps = append([]string(nil), c.Steps...)
+	cp.Resources = append([]CheckpointResource(nil), c.Resources...)
+	return &cp
+}
+
+// Update changes the checkpoint of the named build with fn, creating it when
+// needed, and writes the file.
+func (f *CheckpointFile) Update(build string, fn func(c *BuildCheckpoint)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.builds[build]
+	if !ok {
+		c = &BuildCheckpoint{}
+		f.builds[build] = c
+	}
+	fn(c)
+	c.UpdatedAt = time.Now().UTC()
+	return f.write()
+}
+
+// Completed tells whether the named build completed in the recorded run.
+func (f *CheckpointFile) Completed(build string) bool {
+	c := f.Get(build)
+	return c != nil && c.Status == CheckpointDone
+}
+
+// Remove removes the file, once all the builds it tracked completed.
+func (f *CheckpointFile) Remove() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.builds = map[string]*BuildCheckpoint{}
+	err := os.Remove(f.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// write writes the file through a temporary file synced to disk before it is
+// renamed over the file, so that a crash never leaves a partial checkpoint.
+func (f *CheckpointFile) write() error {
+	raw, err := json.MarshalIndent(f.builds, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// buildRecorder records the progress of a build in its checkpoint. Failing to
+// write the checkpoint does not fail the build.
+type buildRecorder struct {
+	file  *CheckpointFile
+	build string
+}
+
+func (r *buildRecorder) update(fn func(c *BuildCheckpoint)) {
+	if err := r.file.Update(r.build, fn); err != nil {
+		log.Printf("[WARN] failed to record the checkpoint of build %s: %s", r.build, err)
+	}
+}
+
+func (r *buildRecorder) StepCompleted(step string) {
+	r.update(func(c *BuildCheckpoint) { c.Steps = append(c.Steps, step) })
+}
+
+func (r *buildRecorder) ResourceCreated(res CheckpointResource) {
+	r.update(func(c *BuildCheckpoint) { c.Resources = append(c.Resources, res) })
+}
+
+func (r *buildRecorder) ResourceDestroyed(id string) {
+	r.update(func(c *BuildCheckpoint) {
+		for i, res := range c.Resources {
+			if res.ID == id {
+				c.Resources = append(c.Resources[:i], c.Resources[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+func (r *buildRecorder) provisioned(index int) {
+	r.update(func(c *BuildCheckpoint) { c.Provisioners = index + 1 })
+}
+
+// restart forgets the progress of a build whose builder runs again from
+// scratch, like when it is retried. Its resources are still tracked.
+func (r *buildRecorder) restart() {
+	r.update(func(c *BuildCheckpoint) {
+		c.Steps = nil
+		c.Provisioners = 0
+	})
+}
+
+func (r *buildRecorder) finish(err error) {
+	r.update(func(c *BuildCheckpoint) {
+		c.Status = CheckpointDone
+		if err != nil {
+			c.Status = CheckpointFailed
+		}
+	})
+}
+
+// startCheckpoint starts the checkpoint of the build, resuming from the
+// checkpoint of a previous run according to b.Resume. It returns the number
+// of provisioners to skip, that ran before the checkpoint.
+func (b *CoreBuild) startCheckpoint(ctx context.Context, ui packersdk.Ui) (*buildRecorder, int, error) {
+	rec := &buildRecorder{file: b.Checkpoints, build: b.Name()}
+	previous := b.Checkpoints.Get(b.Name())
+	c, canCheckpoint := checkpointer(b.Builder)
+
+	continued := false
+	leftovers := previous != nil && len(previous.Resources) > 0
+	switch {
+	case !leftovers:
+		// Nothing to clean up, the build starts over.
+	case b.Resume == ResumeCleanup:
+		if !canCheckpoint {
+			return nil, 0, fmt.Errorf("the %s builder cannot clean up the resources of the previous run, destroy them manually: %s",
+				b.BuilderType, resourcesString(previous.Resources))
+		}
+		ui.Say(fmt.Sprintf("Cleaning up the resources of the previous run: %s", resourcesString(previous.Resources)))
+		if err := c.CleanupCheckpoint(ctx, ui, previous); err != nil {
+			return nil, 0, fmt.Errorf("failed to clean up the resources of the previous run: %s", err)
+		}
+	case b.Resume == ResumeContinue:
+		if !canCheckpoint {
+			return nil, 0, fmt.Errorf("the %s builder cannot continue from a checkpoint, destroy the resources of the previous run manually: %s",
+				b.BuilderType, resourcesString(previous.Resources))
+		}
+		if previous.BuilderInputHash != b.BuilderInputHash {
+			return nil, 0, fmt.Errorf("the configuration of the builder changed since the previous run, it cannot continue; use cleanup instead")
+		}
+		if err := c.ResumeFromCheckpoint(previous); err != nil {
+			return nil, 0, fmt.Errorf("failed to continue from the checkpoint: %s", err)
+		}
+		ui.Say(fmt.Sprintf("Continuing the previous run after %d step(s) and %d provisioner(s)",
+			len(previous.Steps), previous.Provisioners))
+		continued = true
+	default:
+		return nil, 0, fmt.Errorf("the previous run left resources behind: %s; resume it, to continue it or to clean them up",
+			resourcesString(previous.Resources))
+	}
+
+	skip := 0
+	var err error
+	if continued {
+		// The checkpoint goes on from where it was.
+		skip = previous.Provisioners
+		err = b.Checkpoints.Update(b.Name(), func(cp *BuildCheckpoint) { cp.Status = CheckpointRunning })
+	} else {
+		err = b.Checkpoints.Update(b.Name(), func(cp *BuildCheckpoint) {
+			*cp = BuildCheckpoint{Status: CheckpointRunning, BuilderInputHash: b.BuilderInputHash}
+		})
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to write the checkpoint: %s", err)
+	}
+	if canCheckpoint {
+		c.SetCheckpointRecorder(rec)
+	}
+	return rec, skip, nil
+}
+
+func resourcesString(resources []CheckpointResource) string {
+	names := make([]string, 0, len(resources))
+	for _, r := range resources {
+		names = append(names, r.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
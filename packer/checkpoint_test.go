@@ -0,0 +1,192 @@
+package packer
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// checkpointBuilder creates a resource, kept when the build fails like with
+// -on-error=abort, and reports its progress.
+type checkpointBuilder struct {
+	packersdk.MockBuilder
+	fail bool
+
+	recorder CheckpointRecorder
+	resumed  *BuildCheckpoint
+	cleaned  *BuildCheckpoint
+}
+
+func (b *checkpointBuilder) SetCheckpointRecorder(r CheckpointRecorder) { b.recorder = r }
+
+func (b *checkpointBuilder) ResumeFromCheckpoint(c *BuildCheckpoint) error {
+	b.resumed = c
+	return nil
+}
+
+func (b *checkpointBuilder) CleanupCheckpoint(_ context.Context, _ packersdk.Ui, c *BuildCheckpoint) error {
+	b.cleaned = c
+	return nil
+}
+
+func (b *checkpointBuilder) Run(ctx context.Context, ui packersdk.Ui, h packersdk.Hook) (packersdk.Artifact, error) {
+	if b.resumed == nil {
+		b.recorder.ResourceCreated(CheckpointResource{Type: "instance", ID: "i-1"})
+		b.recorder.StepCompleted("create instance")
+	}
+	if b.fail {
+		return nil, context.Canceled
+	}
+	artifact, err := b.MockBuilder.Run(ctx, ui, h)
+	b.recorder.ResourceDestroyed("i-1")
+	return artifact, err
+}
+
+// countingProvisioner counts the times it provisions.
+type countingProvisioner struct {
+	packersdk.MockProvisioner
+	runs int
+}
+
+func (p *countingProvisioner) Provision(context.Context, packersdk.Ui, packersdk.Communicator, map[string]interface{}) error {
+	p.runs++
+	return nil
+}
+
+func testCheckpointBuild(t *testing.T, path string, builder packersdk.Builder) (*CoreBuild, []*countingProvisioner) {
+	f, err := OpenCheckpointFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provisioners := []*countingProvisioner{{}, {}}
+	build := testBuild()
+	build.Builder = builder
+	build.BuilderInputHash = "builder"
+	build.Provisioners = []CoreBuildProvisioner{
+		{PType: "first", Provisioner: provisioners[0]},
+		{PType: "second", Provisioner: provisioners[1]},
+	}
+	build.Checkpoints = f
+	build.Prepare()
+	return build, provisioners
+}
+
+// leftCheckpoint records a build interrupted after its first provisioner, with
+// an instance left behind.
+func leftCheckpoint(t *testing.T, path string) {
+	f, err := OpenCheckpointFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Update("test", func(c *BuildCheckpoint) {
+		*c = BuildCheckpoint{
+			Status:           CheckpointRunning,
+			BuilderInputHash: "builder",
+			Steps:            []string{"create instance"},
+			Resources:        []CheckpointResource{{Type: "instance", ID: "i-0"}},
+			Provisioners:     1,
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuild_Run_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultCheckpointFilename)
+
+	// A failed build keeps its resources in the checkpoint.
+	builder := &checkpointBuilder{fail: true}
+	build, _ := testCheckpointBuild(t, path, builder)
+	if _, err := build.Run(context.Background(), testUi()); err == nil {
+		t.Fatal("expected the build to fail")
+	}
+	got := build.Checkpoints.Get("test")
+	if got.Status != CheckpointFailed || len(got.Resources) != 1 || got.BuilderInputHash != "builder" {
+		t.Fatalf("unexpected checkpoint: %#v", got)
+	}
+
+	// The next run does not start over without resuming.
+	build, _ = testCheckpointBuild(t, path, &checkpointBuilder{})
+	_, err := build.Run(context.Background(), testUi())
+	if err == nil || !strings.Contains(err.Error(), "instance i-1") {
+		t.Fatalf("expected the leftover resources to be reported, got %v", err)
+	}
+
+	// It succeeds once they are cleaned up.
+	builder = &checkpointBuilder{}
+	build, provisioners := testCheckpointBuild(t, path, builder)
+	build.Resume = ResumeCleanup
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatal(err)
+	}
+	if builder.cleaned == nil || builder.cleaned.Resources[0].ID != "i-1" {
+		t.Errorf("expected the previous resources to be cleaned up, got %#v", builder.cleaned)
+	}
+	if provisioners[0].runs != 1 || provisioners[1].runs != 1 {
+		t.Errorf("expected all the provisioners to run")
+	}
+	want := &BuildCheckpoint{
+		Status:           CheckpointDone,
+		BuilderInputHash: "builder",
+		Steps:            []string{"create instance"},
+		Provisioners:     2,
+	}
+	got = build.Checkpoints.Get("test")
+	got.UpdatedAt = want.UpdatedAt
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected checkpoint: %#v", got)
+	}
+}
+
+func TestBuild_Run_CheckpointContinue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultCheckpointFilename)
+	leftCheckpoint(t, path)
+
+	builder := &checkpointBuilder{}
+	build, provisioners := testCheckpointBuild(t, path, builder)
+	build.Resume = ResumeContinue
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatal(err)
+	}
+	if builder.resumed == nil || builder.resumed.Resources[0].ID != "i-0" {
+		t.Errorf("expected the builder to continue from the checkpoint, got %#v", builder.resumed)
+	}
+	if provisioners[0].runs != 0 || provisioners[1].runs != 1 {
+		t.Errorf("expected only the second provisioner to run, got %d and %d runs", provisioners[0].runs, provisioners[1].runs)
+	}
+	got := build.Checkpoints.Get("test")
+	if got.Status != CheckpointDone || got.Provisioners != 2 || !reflect.DeepEqual(got.Steps, []string{"create instance"}) {
+		t.Errorf("unexpected checkpoint: %#v", got)
+	}
+}
+
+func TestBuild_Run_CheckpointContinue_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder packersdk.Builder
+		hash    string
+		wantErr string
+	}{
+		{"builder changed", &checkpointBuilder{}, "changed", "configuration of the builder changed"},
+		{"not a checkpointer", &packersdk.MockBuilder{}, "builder", "cannot continue from a checkpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), DefaultCheckpointFilename)
+			leftCheckpoint(t, path)
+
+			build, _ := testCheckpointBuild(t, path, tt.builder)
+			build.BuilderInputHash = tt.hash
+			build.Resume = ResumeContinue
+			_, err := build.Run(context.Background(), testUi())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
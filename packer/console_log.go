@@ -0,0 +1,190 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ConsoleStreamer is implemented by builders able to stream the console, or
+// the serial output, of the machine they build. The core captures it to the
+// console log of the build, see CoreBuild.ConsoleLogPath. The console of
+// builders only implementing ConsoleReader is captured by reading it
+// periodically.
+type ConsoleStreamer interface {
+	// StreamConsole writes the output of the console to w as it comes, until
+	// ctx is done or the machine is gone.
+	StreamConsole(ctx context.Context, w io.Writer) error
+}
+
+// consoleStreamer returns the ConsoleStreamer capability of b, looking through
+// the builders wrapped by the core.
+func consoleStreamer(b packersdk.Builder) (ConsoleStreamer, bool) {
+	if rb, ok := b.(*RegistryBuilder); ok {
+		b = rb.Builder
+	}
+	s, ok := b.(ConsoleStreamer)
+	return s, ok
+}
+
+// consoleCaptureInterval is how often the console of builders only
+// implementing ConsoleReader is read.
+var consoleCaptureInterval = 2 * time.Second
+
+// ConsoleLogError is returned by a build whose communicator never connected,
+// when its console was captured: the console log likely tells why the machine
+// did not come up.
+type ConsoleLogError struct {
+	Err error
+	// Path is the console log of the build.
+	Path string
+}
+
+func (e *ConsoleLogError) Error() string {
+	return fmt.Sprintf("%s\nThe communicator never connected, the console output of the machine was captured to %s", e.Err, e.Path)
+}
+
+func (e *ConsoleLogError) Unwrap() error {
+	return e.Err
+}
+
+// consoleCapture captures the console of the machine of a build to its console
+// log while the builder runs. A nil consoleCapture captures nothing.
+type consoleCapture struct {
+	path      string
+	file      *os.File
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	connected chan struct{}
+	once      sync.Once
+}
+
+// captureConsole starts capturing the console of the machine of the build to
+// its console log, when one is set and the builder can read the console. The
+// log is truncated by the first attempt of the builder, the following
+// attempts append to it.
+func (b *CoreBuild) captureConsole(ctx context.Context, attempt int) *consoleCapture {
+	if b.ConsoleLogPath == "" {
+		return nil
+	}
+	stream, ok := consoleStreamer(b.Builder)
+	if !ok {
+		reader, ok := consoleReader(b.Builder)
+		if !ok {
+			return nil
+		}
+		stream = &polledConsole{reader: reader}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if attempt == 1 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(b.ConsoleLogPath, flags, 0644)
+	if err != nil {
+		log.Printf("[WARN] failed to open the console log of %q: %s", b.Name(), err)
+		return nil
+	}
+	if attempt > 1 {
+		fmt.Fprintf(f, "\n==> Attempt %d\n", attempt)
+	}
+
+	c := &consoleCapture{
+		path:      b.ConsoleLogPath,
+		file:      f,
+		ctx:       ctx,
+		done:      make(chan struct{}),
+		connected: make(chan struct{}),
+	}
+	ctx, c.cancel = context.WithCancel(ctx)
+	go func() {
+		defer close(c.done)
+		if err := stream.StreamConsole(ctx, f); err != nil && ctx.Err() == nil {
+			log.Printf("[DEBUG] stopped capturing the console of %q: %s", b.Name(), err)
+		}
+	}()
+	return c
+}
+
+// hook returns hook, telling the capture when the communicator connected.
+func (c *consoleCapture) hook(hook packersdk.Hook) packersdk.Hook {
+	if c == nil {
+		return hook
+	}
+	return &consoleCaptureHook{Hook: hook, capture: c}
+}
+
+// stop stops capturing and returns err, referencing the console log when the
+// communicator never connected and the build was not cancelled.
+func (c *consoleCapture) stop(err error) error {
+	if c == nil {
+		return err
+	}
+	c.cancel()
+	<-c.done
+	if closeErr := c.file.Close(); closeErr != nil {
+		log.Printf("[WARN] failed to write the console log %s: %s", c.path, closeErr)
+	}
+	if err == nil || c.ctx.Err() != nil {
+		return err
+	}
+	select {
+	case <-c.connected:
+		return err
+	default:
+		return &ConsoleLogError{Err: err, Path: c.path}
+	}
+}
+
+type consoleCaptureHook struct {
+	packersdk.Hook
+	capture *consoleCapture
+}
+
+func (h *consoleCaptureHook) Run(ctx context.Context, name string, ui packersdk.Ui, comm packersdk.Communicator, data interface{}) error {
+	if name == packersdk.HookProvision {
+		h.capture.once.Do(func() { close(h.capture.connected) })
+	}
+	return h.Hook.Run(ctx, name, ui, comm, data)
+}
+
+// polledConsole streams the console of a ConsoleReader by reading it
+// periodically and writing what changed.
+type polledConsole struct {
+	reader ConsoleReader
+}
+
+func (p *polledConsole) StreamConsole(ctx context.Context, w io.Writer) error {
+	last := ""
+	for {
+		output, err := p.reader.ReadConsole(ctx)
+		if err != nil {
+			log.Printf("[DEBUG] failed to read the console of the machine: %s", err)
+		}
+		if err == nil && output != last {
+			// The console starts over when the machine is recreated.
+			diff := output
+			if strings.HasPrefix(output, last) {
+				diff = output[len(last):]
+			}
+			if _, err := io.WriteString(w, diff); err != nil {
+				return err
+			}
+			last = output
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(consoleCaptureInterval):
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package packer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// streamingBuilder is a builder whose machine streams console on its console.
+type streamingBuilder struct {
+	packersdk.MockBuilder
+	console string
+}
+
+func (b *streamingBuilder) StreamConsole(ctx context.Context, w io.Writer) error {
+	if _, err := io.WriteString(w, b.console); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestBuild_Run_ConsoleLog(t *testing.T) {
+	defer func(interval time.Duration) { consoleCaptureInterval = interval }(consoleCaptureInterval)
+	consoleCaptureInterval = 10 * time.Millisecond
+
+	console := "SeaBIOS (version 1.13.0)\nBooting from Hard Disk...\nubuntu login: "
+
+	readLog := func(t *testing.T, path string) string {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read the console log: %s", err)
+		}
+		return string(b)
+	}
+
+	t.Run("communicator never connects", func(t *testing.T) {
+		builder := &streamingBuilder{console: console}
+		builder.RunErrResult = true
+		build := testBuild()
+		build.Builder = builder
+		build.ConsoleLogPath = filepath.Join(t.TempDir(), "build.console.log")
+		build.Prepare()
+
+		_, err := build.Run(context.Background(), testUi())
+		var logErr *ConsoleLogError
+		if !errors.As(err, &logErr) {
+			t.Fatalf("expected the error to reference the console log, got %v", err)
+		}
+		if logErr.Path != build.ConsoleLogPath {
+			t.Errorf("expected %s to be referenced, got %s", build.ConsoleLogPath, logErr.Path)
+		}
+		if got := readLog(t, build.ConsoleLogPath); got != console {
+			t.Errorf("unexpected console log:\n%s", got)
+		}
+	})
+
+	t.Run("communicator connected", func(t *testing.T) {
+		builder := &streamingBuilder{console: console}
+		build := testBuild()
+		build.Builder = builder
+		build.ConsoleLogPath = filepath.Join(t.TempDir(), "build.console.log")
+		build.Prepare()
+
+		if _, err := build.Run(context.Background(), testUi()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := readLog(t, build.ConsoleLogPath); got != console {
+			t.Errorf("unexpected console log:\n%s", got)
+		}
+	})
+
+	t.Run("console read periodically", func(t *testing.T) {
+		builder := &consoleBuilder{console: console}
+		builder.RunFn = func(context.Context) { time.Sleep(50 * time.Millisecond) }
+		build := testBuild()
+		build.Builder = builder
+		build.ConsoleLogPath = filepath.Join(t.TempDir(), "build.console.log")
+		build.Prepare()
+
+		if _, err := build.Run(context.Background(), testUi()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := readLog(t, build.ConsoleLogPath); got != console {
+			t.Errorf("unexpected console log:\n%s", got)
+		}
+	})
+
+	t.Run("no console", func(t *testing.T) {
+		build := testBuild()
+		build.Builder = &packersdk.MockBuilder{RunErrResult: true}
+		build.ConsoleLogPath = filepath.Join(t.TempDir(), "build.console.log")
+		build.Prepare()
+
+		_, err := build.Run(context.Background(), testUi())
+		var logErr *ConsoleLogError
+		if err == nil || errors.As(err, &logErr) {
+			t.Fatalf("expected the error of the builder, got %v", err)
+		}
+		if _, err := os.Stat(build.ConsoleLogPath); !os.IsNotExist(err) {
+			t.Errorf("expected no console log, got %v", err)
+		}
+	})
+}
+
+func TestPolledConsole_StreamConsole(t *testing.T) {
+	defer func(interval time.Duration) { consoleCaptureInterval = interval }(consoleCaptureInterval)
+	consoleCaptureInterval = time.Millisecond
+
+	reader := &consoleBuilder{console: "first boot\n"}
+	var out strings.Builder
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- (&polledConsole{reader: reader}).StreamConsole(ctx, &out) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "first boot\n" {
+		t.Errorf("expected the console to be written once, got %q", out.String())
+	}
+}
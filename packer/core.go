@@ -19,6 +19,8 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer/internal/cache"
+	"github.com/hashicorp/packer/internal/notify"
 	packerregistry "github.com/hashicorp/packer/internal/registry"
 	"github.com/hashicorp/packer/internal/registry/env"
 	packerversion "github.com/hashicorp/packer/version"
@@ -48,6 +50,16 @@ type CoreConfig struct {
 	Variables          map[string]string
 	SensitiveVariables []string
 	Version            string
+	// LocalExec, when set, restricts the components running commands on the
+	// machine running Packer.
+	LocalExec *LocalExecPolicy
+	// CachePolicy, when set, evicts cached files at the end of the builds.
+	CachePolicy *cache.Policy
+	// Notifications are notified of the outcome of the builds.
+	Notifications []*notify.Target
+	// DisableArtifactHistory stops packer build from recording the artifacts
+	// of the builds in the artifact history.
+	DisableArtifactHistory bool
 
 	// These are set by command-line flags
 	Except []string
@@ -139,9 +151,7 @@ func (core *Core) Initialize() error {
 	if err := core.init(); err != nil {
 		return err
 	}
-	for _, secret := range core.secrets {
-		packersdk.LogSecretFilter.Set(secret)
-	}
+	Secrets.Register(core.secrets...)
 
 	if env.IsPAREnabled() {
 		var err error
@@ -220,17 +230,20 @@ func (c *Core) generateCoreBuildProvisioner(rawP *template.Provisioner, rawName
 			config = append(config, override)
 		}
 	}
+	// The timeout wraps the provisioner before the pauser does, so that the
+	// pause does not count against the timeout.
+	if rawP.Timeout != 0 {
+		provisioner = &TimeoutProvisioner{
+			Timeout:     rawP.Timeout,
+			Provisioner: provisioner,
+		}
+	}
 	// If we're pausing, we wrap the provisioner in a special pauser.
 	if rawP.PauseBefore != 0 {
 		provisioner = &PausedProvisioner{
 			PauseBefore: rawP.PauseBefore,
 			Provisioner: provisioner,
 		}
-	} else if rawP.Timeout != 0 {
-		provisioner = &TimeoutProvisioner{
-			Timeout:     rawP.Timeout,
-			Provisioner: provisioner,
-		}
 	}
 	maxRetries := 0
 	if rawP.MaxRetries != "" {
@@ -261,10 +274,20 @@ func (c *Core) generateCoreBuildProvisioner(rawP *template.Provisioner, rawName
 // This is used for json templates to launch the build plugins.
 // They will be prepared via b.Prepare() later.
 func (c *Core) GetBuilds(opts GetBuildsOptions) ([]packersdk.Build, hcl.Diagnostics) {
-	buildNames := c.BuildNames(opts.Only, opts.Except)
 	builds := []packersdk.Build{}
 	diags := hcl.Diagnostics{}
+	if len(opts.Tags) > 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Builds cannot be selected by tag in JSON templates",
+			Detail:   "Tags are only supported by HCL2 templates, select the builds by name with -only and -except.",
+		})
+		return builds, diags
+	}
+	buildNames := c.BuildNames(opts.Only, opts.Except)
+	defer c.components.PluginConfig.AttributeProcesses("")
 	for _, n := range buildNames {
+		c.components.PluginConfig.AttributeProcesses(n)
 		b, err := c.Build(n)
 		if err != nil {
 			diags = append(diags, &hcl.Diagnostic{
@@ -279,7 +302,28 @@ func (c *Core) GetBuilds(opts GetBuildsOptions) ([]packersdk.Build, hcl.Diagnost
 		log.Printf("Preparing build: %s", b.Name())
 		b.SetDebug(opts.Debug)
 		b.SetForce(opts.Force)
+		if cb, ok := b.(*CoreBuild); ok {
+			cb.SetForceDeregister(opts.ForceDeregister)
+			cb.SetIncremental(opts.Incremental)
+			cb.SetFromStage(opts.FromStage)
+			if opts.Incremental || opts.HashInputs {
+				if err := cb.hashInputs(); err != nil {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  fmt.Sprintf("Failed to hash the inputs of build %q", n),
+						Detail:   err.Error(),
+					})
+					continue
+				}
+			}
+		}
 		b.SetOnError(opts.OnError)
+		if cb, ok := b.(*CoreBuild); ok {
+			cb.SetOnErrorRetries(opts.OnErrorRetries)
+			if opts.TargetHost != "" {
+				cb.Builder = &ProvisionOnlyBuilder{Builder: cb.Builder, Host: opts.TargetHost}
+			}
+		}
 
 		warnings, err := b.Prepare()
 		if err != nil {
@@ -448,6 +492,7 @@ func (c *Core) Build(n string) (packersdk.Build, error) {
 		CleanupProvisioner: cleanupProvisioner,
 		TemplatePath:       c.Template.Path,
 		Variables:          c.variables,
+		DebugEvaluator:     c.evaluateDebugExpression,
 	}, nil
 }
 
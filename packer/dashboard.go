@@ -0,0 +1,261 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// dashboardRefreshInterval is how often the dashboard is redrawn, for the
+// elapsed times to stay current.
+var dashboardRefreshInterval = time.Second
+
+// Dashboard renders builds running in parallel as a live view in a terminal,
+// each build in its own pane with its status, elapsed time and last line of
+// output, rather than interleaving their output. The UI of each build is
+// returned by Ui.
+type Dashboard struct {
+	Writer io.Writer
+	// Width is the width of the terminal, longer lines are cut.
+	Width int
+
+	l      sync.Mutex
+	names  []string
+	builds map[string]*dashboardBuild
+	// drawn is the number of lines drawn by the last render, moved over by
+	// the next one.
+	drawn   int
+	now     func() time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// dashboardBuild is the pane of a build.
+type dashboardBuild struct {
+	status   string
+	started  time.Time
+	ended    time.Time
+	last     string
+	progress string
+}
+
+// NewDashboard returns a dashboard of builds, in that order, writing to w.
+func NewDashboard(w io.Writer, width int, builds []string) *Dashboard {
+	d := &Dashboard{
+		Writer: w,
+		Width:  width,
+		names:  builds,
+		builds: make(map[string]*dashboardBuild, len(builds)),
+		now:    time.Now,
+	}
+	for _, name := range builds {
+		d.builds[name] = &dashboardBuild{status: "waiting"}
+	}
+	return d
+}
+
+// Start draws the dashboard, and redraws it periodically until Stop.
+func (d *Dashboard) Start() {
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+	d.draw()
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(dashboardRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.draw()
+			}
+		}
+	}()
+}
+
+// Stop stops redrawing the dashboard, leaving its last state on the terminal.
+func (d *Dashboard) Stop() {
+	if d.stop != nil {
+		close(d.stop)
+		<-d.stopped
+	}
+	d.draw()
+}
+
+// Ui returns the UI of build, whose output goes to its pane.
+func (d *Dashboard) Ui(build string) packersdk.Ui {
+	return &dashboardUi{dashboard: d, build: build}
+}
+
+// update updates the pane of build, and redraws the dashboard.
+func (d *Dashboard) update(build string, fn func(b *dashboardBuild)) {
+	d.l.Lock()
+	b, ok := d.builds[build]
+	if !ok {
+		b = &dashboardBuild{status: "waiting"}
+		d.builds[build] = b
+		d.names = append(d.names, build)
+	}
+	fn(b)
+	d.l.Unlock()
+	d.draw()
+}
+
+func (d *Dashboard) draw() {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	var out strings.Builder
+	if d.drawn > 0 {
+		fmt.Fprintf(&out, "\033[%dA", d.drawn)
+	}
+	lines := d.render()
+	for _, line := range lines {
+		out.WriteString("\033[2K")
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	d.drawn = len(lines)
+	_, _ = io.WriteString(d.Writer, out.String())
+}
+
+// render returns the lines of the dashboard. d.l must be held.
+func (d *Dashboard) render() []string {
+	width := 0
+	counts := map[string]int{}
+	for _, name := range d.names {
+		if len(name) > width {
+			width = len(name)
+		}
+		counts[d.builds[name].status]++
+	}
+
+	var summary []string
+	for _, status := range []string{"waiting", "running", "finished", "errored"} {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	lines := []string{d.cut(fmt.Sprintf("==> %d builds: %s", len(d.names), strings.Join(summary, ", ")))}
+
+	now := d.now()
+	for _, name := range d.names {
+		b := d.builds[name]
+		elapsed := "-"
+		if !b.started.IsZero() {
+			end := now
+			if !b.ended.IsZero() {
+				end = b.ended
+			}
+			elapsed = end.Sub(b.started).Round(time.Second).String()
+		}
+		header := fmt.Sprintf("%-*s  %-8s  %7s", width, name, b.status, elapsed)
+		if b.progress != "" && b.ended.IsZero() {
+			header += "  " + b.progress
+		}
+		lines = append(lines, d.cut(header), d.cut("    "+b.last))
+	}
+	return lines
+}
+
+// cut cuts line to the width of the terminal.
+func (d *Dashboard) cut(line string) string {
+	if d.Width <= 0 {
+		return line
+	}
+	runes := []rune(line)
+	if len(runes) <= d.Width {
+		return line
+	}
+	return string(runes[:d.Width])
+}
+
+// dashboardUi is the UI of a build of a Dashboard.
+type dashboardUi struct {
+	dashboard *Dashboard
+	build     string
+}
+
+var _ packersdk.Ui = new(dashboardUi)
+
+func (u *dashboardUi) Ask(query string) (string, error) {
+	return "", errors.New("the dashboard can't ask")
+}
+
+func (u *dashboardUi) Say(message string) {
+	u.targetedMessage("", "say", message)
+}
+
+func (u *dashboardUi) Message(message string) {
+	u.targetedMessage("", "message", message)
+}
+
+func (u *dashboardUi) Error(message string) {
+	u.targetedMessage("", "error", message)
+}
+
+// targetedMessage shows the last non-empty line of message in the pane of its
+// build.
+func (u *dashboardUi) targetedMessage(target, level, message string) {
+	if target == "" {
+		target = u.build
+	}
+	message = Secrets.Redact(message)
+	// The whole output stays in the log.
+	if level == "error" {
+		log.Printf("ui error: %s: %s", target, message)
+	} else {
+		log.Printf("ui: %s: %s", target, message)
+	}
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if last == "" {
+		return
+	}
+	u.dashboard.update(target, func(b *dashboardBuild) {
+		b.last = last
+	})
+}
+
+func (u *dashboardUi) Machine(category string, args ...string) {
+	log.Printf("machine readable: %s %#v", category, args)
+	if build, step, percent, ok := parseProgress(category, args); ok {
+		if build == "" {
+			build = u.build
+		}
+		u.dashboard.update(build, func(b *dashboardBuild) {
+			b.progress = fmt.Sprintf("%s %.0f%%", step, percent)
+		})
+		return
+	}
+
+	target, t := splitTarget(category)
+	if t != "build" || len(args) == 0 {
+		return
+	}
+	if target == "" {
+		target = u.build
+	}
+	now := u.dashboard.now()
+	u.dashboard.update(target, func(b *dashboardBuild) {
+		switch args[0] {
+		case "started":
+			b.status = "running"
+			b.started = now
+		case "finished", "errored":
+			b.status = args[0]
+			b.ended = now
+		}
+	})
+}
+
+func (u *dashboardUi) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) io.ReadCloser {
+	return stream
+}
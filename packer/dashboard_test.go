@@ -0,0 +1,74 @@
+package packer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	d := NewDashboard(buf, 60, []string{"amazon-ebs.ubuntu", "vbox.debian", "docker.alpine"})
+	d.now = func() time.Time { return now }
+
+	// The builds are wrapped by a TargetedUI when they run.
+	ubuntu := &TargetedUI{Target: "amazon-ebs.ubuntu", Ui: d.Ui("amazon-ebs.ubuntu")}
+	debian := &TargetedUI{Target: "vbox.debian", Ui: d.Ui("vbox.debian")}
+
+	ubuntu.Machine("build", "started")
+	debian.Machine("build", "started")
+	ubuntu.Say("Creating temporary keypair...")
+	ubuntu.Message("Hit:1 http://archive.ubuntu.com/ubuntu jammy InRelease\nGet:2 http://security.ubuntu.com/ubuntu jammy-security InRelease [110 kB]\n")
+	ReportProgress(debian, "download", 42)
+	now = now.Add(90 * time.Second)
+	debian.Error("Build 'vbox.debian' errored: the checksum of the ISO does not match")
+	debian.Machine("build", "errored", "the checksum of the ISO does not match")
+	now = now.Add(30 * time.Second)
+
+	d.l.Lock()
+	got := d.render()
+	d.l.Unlock()
+	expected := []string{
+		"==> 3 builds: 1 waiting, 1 running, 1 errored",
+		"amazon-ebs.ubuntu  running      2m0s",
+		"    Get:2 http://security.ubuntu.com/ubuntu jammy-security I",
+		"vbox.debian        errored     1m30s",
+		"    Build 'vbox.debian' errored: the checksum of the ISO doe",
+		"docker.alpine      waiting         -",
+		"    ",
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected dashboard: %s", diff)
+	}
+
+	// Every update redraws the dashboard over the previous one.
+	buf.Reset()
+	ubuntu.Machine("build", "finished")
+	if !strings.HasPrefix(buf.String(), "\033[7A") {
+		t.Errorf("expected the dashboard to be redrawn in place, got %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "amazon-ebs.ubuntu  finished     2m0s") {
+		t.Errorf("expected the build to be finished, got %q", buf.String())
+	}
+}
+
+func TestDashboard_progress(t *testing.T) {
+	d := NewDashboard(new(bytes.Buffer), 0, []string{"vbox.debian"})
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	ui := &TargetedUI{Target: "vbox.debian", Ui: d.Ui("vbox.debian")}
+
+	ui.Machine("build", "started")
+	ReportProgress(ui, "download", 42.4)
+
+	d.l.Lock()
+	got := d.render()[1]
+	d.l.Unlock()
+	if got != "vbox.debian  running        0s  download 42%" {
+		t.Errorf("unexpected pane: %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package packer
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// DebugEvaluator evaluates an expression typed at a pause of a build, like the
+// ones of -debug or of the breakpoint provisioner, in the context of the build:
+// its variables and generatedData, the data generated by its builder, like the
+// connection info of the machine. generatedData is nil while the builder runs.
+type DebugEvaluator func(expr string, generatedData map[string]interface{}) (string, hcl.Diagnostics)
+
+// debugPausePrompt ends the questions asked at the pauses of a build: the
+// pauses between the steps of the builders and before the provisioners with
+// -debug, and the pauses of the breakpoint provisioner.
+const debugPausePrompt = "Press enter to continue."
+
+// debugExpressionPrompt replaces debugPausePrompt at the pauses evaluating
+// expressions. A build can pause in a nested Ui, like in the provisioner
+// hook called by the builder, so it must not end with debugPausePrompt.
+const debugExpressionPrompt = "Type an expression to evaluate, or press enter to continue:"
+
+const debugPromptHelp = `Expressions are evaluated in the context of the build, like build.Host or
+var.region in HCL2 templates, or {{ build ` + "`Host`" + ` }} in JSON templates.`
+
+// debugUi turns the pauses of a build into prompts evaluating the expressions
+// typed, until enter is pressed on an empty line.
+type debugUi struct {
+	packersdk.Ui
+	evaluate DebugEvaluator
+	data     map[string]interface{}
+}
+
+func (u *debugUi) Ask(query string) (string, error) {
+	if !strings.HasSuffix(query, debugPausePrompt) {
+		return u.Ui.Ask(query)
+	}
+	query = strings.TrimSuffix(query, debugPausePrompt) + debugExpressionPrompt
+	for {
+		line, err := u.Ui.Ask(query)
+		line = strings.TrimSpace(line)
+		if err != nil || line == "" {
+			return line, err
+		}
+		if line == "help" {
+			u.Ui.Say(debugPromptHelp)
+			continue
+		}
+		out, diags := u.evaluate(line, u.data)
+		if diags.HasErrors() {
+			for _, diag := range diags {
+				if diag.Severity == hcl.DiagError {
+					u.Ui.Error(diag.Summary + ": " + diag.Detail)
+				}
+			}
+			continue
+		}
+		u.Ui.Say(out)
+	}
+}
+
+// evaluateDebugExpression renders expr like the console does, with the
+// generated data available to the build function.
+func (c *Core) evaluateDebugExpression(expr string, generatedData map[string]interface{}) (string, hcl.Diagnostics) {
+	ctx := c.Context()
+	ctx.Data = generatedData
+	rendered, err := interpolate.Render(expr, ctx)
+	if err != nil {
+		return "", hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Interpolation error",
+			Detail:   err.Error(),
+		}}
+	}
+	return rendered, nil
+}
@@ -0,0 +1,97 @@
+package packer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template"
+)
+
+// linesTTY reads its lines one after the other.
+type linesTTY struct {
+	lines []string
+}
+
+func (tty *linesTTY) Close() error { return nil }
+func (tty *linesTTY) ReadString() (string, error) {
+	line := tty.lines[0]
+	tty.lines = tty.lines[1:]
+	return line + "\n", nil
+}
+
+func TestDebugUi_Ask(t *testing.T) {
+	core := &Core{
+		Template:  &template.Template{},
+		variables: map[string]string{"region": "us-east-1"},
+	}
+	bufferUi := testUi()
+	bufferUi.TTY = &linesTTY{lines: []string{
+		"{{user `region`}}",
+		"{{build `Host`}}",
+		"{{ nope",
+		"help",
+		"",
+		"yes",
+	}}
+	ui := &debugUi{
+		Ui:       bufferUi,
+		evaluate: core.evaluateDebugExpression,
+		data:     map[string]interface{}{"Host": "10.0.0.1"},
+	}
+
+	line, err := ui.Ask("Pausing before the next provisioner . Press enter to continue.")
+	if err != nil || line != "" {
+		t.Fatalf("unexpected answer %q: %v", line, err)
+	}
+	out := readWriter(bufferUi)
+	for _, expected := range []string{
+		"Pausing before the next provisioner . " + debugExpressionPrompt,
+		"us-east-1\n",
+		"10.0.0.1\n",
+		debugPromptHelp,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the output to contain %q, got %q", expected, out)
+		}
+	}
+	if strings.Contains(out, debugPausePrompt) {
+		t.Errorf("the pause prompt should be replaced, got %q", out)
+	}
+	if errOut := readErrorWriter(bufferUi); !strings.Contains(errOut, "Interpolation error") {
+		t.Errorf("expected an interpolation error, got %q", errOut)
+	}
+
+	// The other questions are left as is.
+	line, err = ui.Ask("Continue?")
+	if err != nil || line != "yes" {
+		t.Fatalf("unexpected answer %q: %v", line, err)
+	}
+	if out := readWriter(bufferUi); out != "Continue? " {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestDebugUi_nested(t *testing.T) {
+	bufferUi := testUi()
+	bufferUi.TTY = &linesTTY{lines: []string{"expr", ""}}
+	var evaluated []map[string]interface{}
+	evaluate := func(expr string, data map[string]interface{}) (string, hcl.Diagnostics) {
+		evaluated = append(evaluated, data)
+		return expr, nil
+	}
+	// Like a provisioner hook called with the Ui of the builder.
+	var ui packersdk.Ui = &debugUi{Ui: bufferUi, evaluate: evaluate}
+	ui = &debugUi{Ui: ui, evaluate: evaluate, data: map[string]interface{}{"ID": "i-1"}}
+
+	if _, err := ui.Ask(debugPausePrompt); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(evaluated) != 1 || evaluated[0]["ID"] != "i-1" {
+		t.Errorf("expected the outer Ui to evaluate the expression, got %v", evaluated)
+	}
+	if out := readWriter(bufferUi); strings.Count(out, debugExpressionPrompt) != 2 {
+		t.Errorf("expected a prompt per line, got %q", out)
+	}
+}
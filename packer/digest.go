@@ -0,0 +1,82 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Digester is implemented by builders able to compute a verifiable digest of
+// the remote artifacts they build, like the digest of a container image or the
+// checksum of a snapshot, so that downstream pipelines can pin images by
+// digest rather than by mutable IDs. The digests are reported in the
+// ArtifactChecksumsStateKey state of the artifact of the build, recorded by
+// the manifest post-processor and the HCP Packer registry.
+type Digester interface {
+	// Digests returns the digests of the images of artifact, by image ID,
+	// like "sha256:9f86d0…".
+	Digests(ctx context.Context, artifact packersdk.Artifact) (map[string]string, error)
+}
+
+// digester returns the Digester capability of b, looking through the
+// builders wrapped by the core.
+func digester(b packersdk.Builder) (Digester, bool) {
+	if rb, ok := b.(*RegistryBuilder); ok {
+		b = rb.Builder
+	}
+	d, ok := b.(Digester)
+	return d, ok
+}
+
+// withDigests returns artifact with the digests computed by builder added to
+// the ones it reports, when builder is a Digester. Failing to compute them
+// does not fail the build, artifact is returned as is.
+func withDigests(ctx context.Context, ui packersdk.Ui, builder packersdk.Builder, artifact packersdk.Artifact) packersdk.Artifact {
+	d, ok := digester(builder)
+	if !ok || artifact == nil {
+		return artifact
+	}
+	digests, err := d.Digests(ctx, artifact)
+	if err == nil {
+		digests, err = mergeDigests(artifact, digests)
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("Failed to compute the digests of the artifact: %s", err))
+		return artifact
+	}
+	if len(digests) == 0 {
+		return artifact
+	}
+	return &digestArtifact{Artifact: artifact, digests: digests}
+}
+
+// mergeDigests returns digests along with the ones artifact already reports,
+// the computed ones taking precedence.
+func mergeDigests(artifact packersdk.Artifact, digests map[string]string) (map[string]string, error) {
+	res := map[string]string{}
+	if state := artifact.State(ArtifactChecksumsStateKey); state != nil {
+		if err := mapstructure.WeakDecode(state, &res); err != nil {
+			return nil, fmt.Errorf("failed to decode the checksums reported by the artifact: %w", err)
+		}
+	}
+	for id, digest := range digests {
+		res[id] = digest
+	}
+	return res, nil
+}
+
+// digestArtifact is an artifact whose digests were computed by its builder,
+// see withDigests.
+type digestArtifact struct {
+	packersdk.Artifact
+	digests map[string]string
+}
+
+func (a *digestArtifact) State(name string) interface{} {
+	if name == ArtifactChecksumsStateKey {
+		return a.digests
+	}
+	return a.Artifact.State(name)
+}
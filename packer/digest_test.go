@@ -0,0 +1,77 @@
+package packer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// digestBuilder computes the digests of the artifacts it builds.
+type digestBuilder struct {
+	packersdk.MockBuilder
+	digests map[string]string
+	err     error
+}
+
+func (b *digestBuilder) Digests(context.Context, packersdk.Artifact) (map[string]string, error) {
+	return b.digests, b.err
+}
+
+func TestBuild_Run_digests(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *digestBuilder
+		want    interface{}
+	}{
+		{
+			"digests are reported by the artifact",
+			&digestBuilder{
+				MockBuilder: packersdk.MockBuilder{ArtifactId: "b"},
+				digests:     map[string]string{"registry.example.com/app:1.0": "sha256:9f86d0"},
+			},
+			map[string]string{"registry.example.com/app:1.0": "sha256:9f86d0"},
+		},
+		{
+			"failing to compute the digests does not fail the build",
+			&digestBuilder{
+				MockBuilder: packersdk.MockBuilder{ArtifactId: "b"},
+				err:         errors.New("registry unreachable"),
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			build := testBuild()
+			build.Builder = tt.builder
+			build.Prepare()
+			artifacts, err := build.Run(context.Background(), testUi())
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if got := artifacts[0].State(ArtifactChecksumsStateKey); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected the builder artifact to report the digests %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_mergeDigests(t *testing.T) {
+	artifact := &packersdk.MockArtifact{
+		StateValues: map[string]interface{}{
+			ArtifactChecksumsStateKey: map[string]interface{}{"a": "sha256:old", "b": "sha256:b"},
+		},
+	}
+	got, err := mergeDigests(artifact, map[string]string{"a": "sha256:new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "sha256:new", "b": "sha256:b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the computed digests to take precedence, got %v", got)
+	}
+}
@@ -0,0 +1,109 @@
+package packer
+
+import (
+	"fmt"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ArtifactEncryptionState is the artifact state, see packersdk.Artifact, in
+// which builders report the encryption at rest of the images they produced,
+// as a list of ImageEncryption.
+const ArtifactEncryptionState = "packer.encryption"
+
+// ImageEncryption is the encryption at rest of an image produced by a builder.
+type ImageEncryption struct {
+	// Image is the ID of the image.
+	Image string `mapstructure:"image"`
+	// Location is where the image lives, like a region, if any.
+	Location  string `mapstructure:"location"`
+	Encrypted bool   `mapstructure:"encrypted"`
+	// KMSKeyID identifies the key the image is encrypted with, empty when
+	// encrypted with a key managed by the provider.
+	KMSKeyID string `mapstructure:"kms_key_id"`
+}
+
+func (e ImageEncryption) String() string {
+	if e.Location == "" {
+		return e.Image
+	}
+	return e.Image + " in " + e.Location
+}
+
+// ArtifactEncryption returns the encryption of the images of artifact,
+// reported in its ArtifactEncryptionState. ok is false when the builder did not
+// report it.
+func ArtifactEncryption(artifact packersdk.Artifact) (images []ImageEncryption, ok bool, err error) {
+	state := artifact.State(ArtifactEncryptionState)
+	if state == nil {
+		return nil, false, nil
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &images,
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := decoder.Decode(state); err != nil {
+		return nil, false, fmt.Errorf("failed to read the encryption of the images: %s", err)
+	}
+	return images, true, nil
+}
+
+// EncryptionPolicy is what a template requires of the encryption at rest of
+// the images of its builds. Builds producing images that do not comply fail,
+// before their post-processors run and their images are published to the HCP
+// Packer registry.
+type EncryptionPolicy struct {
+	// Required fails the builds of unencrypted images, or whose builder does
+	// not report their encryption.
+	Required bool
+	// AllowedKMSKeys, when set, are the only keys the images can be
+	// encrypted with. It implies Required.
+	AllowedKMSKeys []string
+}
+
+// Check returns an error when the images of artifact do not comply with the
+// policy.
+func (p *EncryptionPolicy) Check(artifact packersdk.Artifact) error {
+	if p == nil || (!p.Required && len(p.AllowedKMSKeys) == 0) {
+		return nil
+	}
+	images, ok, err := ArtifactEncryption(artifact)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("encryption is required but the builder did not report the encryption of its images (%s)", artifact.Id())
+	}
+
+	var errs []string
+	for _, image := range images {
+		switch {
+		case !image.Encrypted:
+			errs = append(errs, fmt.Sprintf("%s is not encrypted", image))
+		case len(p.AllowedKMSKeys) > 0 && !p.allowed(image.KMSKeyID):
+			key := image.KMSKeyID
+			if key == "" {
+				key = "a key managed by the provider"
+			}
+			errs = append(errs, fmt.Sprintf("%s is encrypted with %s, which is not an allowed key", image, key))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("the images do not comply with the encryption policy of the build:\n* %s", strings.Join(errs, "\n* "))
+	}
+	return nil
+}
+
+func (p *EncryptionPolicy) allowed(key string) bool {
+	for _, allowed := range p.AllowedKMSKeys {
+		if key != "" && key == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package packer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestEncryptionPolicy_Check(t *testing.T) {
+	encrypted := []interface{}{
+		map[string]interface{}{"image": "ami-1", "location": "us-east-1", "encrypted": true, "kms_key_id": "alias/images"},
+		map[string]interface{}{"image": "ami-2", "location": "eu-west-1", "encrypted": true, "kms_key_id": "alias/images"},
+	}
+	mixed := []ImageEncryption{
+		{Image: "ami-1", Location: "us-east-1", Encrypted: true},
+		{Image: "ami-2", Location: "eu-west-1"},
+	}
+
+	tests := []struct {
+		name          string
+		policy        *EncryptionPolicy
+		state         interface{}
+		expectedError string
+	}{
+		{"no policy", nil, nil, ""},
+		{"encrypted", &EncryptionPolicy{Required: true}, encrypted, ""},
+		{"not reported", &EncryptionPolicy{Required: true}, nil, "did not report the encryption of its images (id)"},
+		{"not encrypted", &EncryptionPolicy{Required: true}, mixed, "ami-2 in eu-west-1 is not encrypted"},
+		{"allowed key", &EncryptionPolicy{AllowedKMSKeys: []string{"alias/images"}}, encrypted, ""},
+		{"other key", &EncryptionPolicy{AllowedKMSKeys: []string{"alias/other"}}, encrypted,
+			"ami-1 in us-east-1 is encrypted with alias/images, which is not an allowed key"},
+		{"provider key", &EncryptionPolicy{AllowedKMSKeys: []string{"alias/images"}}, mixed[:1],
+			"ami-1 in us-east-1 is encrypted with a key managed by the provider"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact := &packersdk.MockArtifact{StateValues: map[string]interface{}{}}
+			if tt.state != nil {
+				artifact.StateValues[ArtifactEncryptionState] = tt.state
+			}
+			err := tt.policy.Check(artifact)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected an error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestBuild_Run_EncryptionPolicy(t *testing.T) {
+	build := testBuild()
+	build.EncryptionPolicy = &EncryptionPolicy{Required: true}
+	build.Prepare()
+
+	artifacts, err := build.Run(context.Background(), testUi())
+	if err == nil || !strings.Contains(err.Error(), "encryption is required") {
+		t.Fatalf("expected the build to fail the encryption policy, got %v", err)
+	}
+	if len(artifacts) != 0 {
+		t.Errorf("expected no artifact, got %v", artifacts)
+	}
+	pp := build.PostProcessors[0][0].PostProcessor.(*MockPostProcessor)
+	if pp.PostProcessCalled {
+		t.Error("expected the post-processors not to run")
+	}
+}
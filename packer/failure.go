@@ -0,0 +1,123 @@
+package packer
+
+import (
+	"errors"
+	"regexp"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// FailureClass tells what failed in a run, so that scripts can branch on the
+// type of failure, see FailureClass.ExitCode.
+type FailureClass string
+
+const (
+	// FailureOther is any failure not classified otherwise.
+	FailureOther FailureClass = "other"
+	// FailureTemplate is a template that can't be parsed or is invalid.
+	FailureTemplate FailureClass = "template"
+	// FailureVariable is a variable without a value, or with an invalid one.
+	FailureVariable FailureClass = "variable"
+	// FailureBuilderAuth is a builder failing to authenticate to its
+	// platform, told apart from other builder failures by its message, see
+	// classifyBuilderFailure.
+	FailureBuilderAuth FailureClass = "builder-auth"
+	// FailureBuilder is a builder failing.
+	FailureBuilder FailureClass = "builder"
+	// FailureProvisioner is a provisioner failing.
+	FailureProvisioner FailureClass = "provisioner"
+	// FailurePostProcessor is a post-processor failing.
+	FailurePostProcessor FailureClass = "post-processor"
+	// FailureRegistry is a failure of the HCP Packer registry.
+	FailureRegistry FailureClass = "hcp-registry"
+	// FailureInterrupted is a run interrupted before its builds completed.
+	FailureInterrupted FailureClass = "interrupted"
+	// FailureTimedOut is a run that exceeded its maximum duration before its
+	// builds completed.
+	FailureTimedOut FailureClass = "timed-out"
+)
+
+// failureExitCodes are the documented exit codes of the failures. 2 is left
+// out, as it usually means a misuse of the command line.
+var failureExitCodes = map[FailureClass]int{
+	FailureOther:         1,
+	FailureTemplate:      3,
+	FailureVariable:      4,
+	FailureBuilderAuth:   5,
+	FailureBuilder:       6,
+	FailureProvisioner:   7,
+	FailurePostProcessor: 8,
+	FailureRegistry:      9,
+	FailureTimedOut:      124,
+	FailureInterrupted:   130,
+}
+
+// ExitCode returns the exit code of the failure class, 1 for an unknown one.
+func (c FailureClass) ExitCode() int {
+	if code, ok := failureExitCodes[c]; ok {
+		return code
+	}
+	return 1
+}
+
+// FailureError is an error classified by what failed.
+type FailureError struct {
+	Class FailureClass
+	Err   error
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+// classifyFailure returns err classified as class, unless it is already
+// classified.
+func classifyFailure(err error, class FailureClass) error {
+	if err == nil || ClassifyFailure(err) != FailureOther {
+		return err
+	}
+	return &FailureError{Class: class, Err: err}
+}
+
+// ClassifyFailure returns the class of err, FailureOther when it is not
+// classified. The class of a MultiError is the one of its first classified
+// error.
+func ClassifyFailure(err error) FailureClass {
+	var failure *FailureError
+	if errors.As(err, &failure) {
+		return failure.Class
+	}
+	var multi *packersdk.MultiError
+	if errors.As(err, &multi) {
+		for _, err := range multi.Errors {
+			if class := ClassifyFailure(err); class != FailureOther {
+				return class
+			}
+		}
+	}
+	return FailureOther
+}
+
+// builderAuthFailures matches the messages of the builders failing to
+// authenticate to their platform. Builders report their failures as text
+// only, so they are told apart from other failures by the error codes and
+// messages of the usual platforms. A communicator failing to authenticate to
+// the machine is a builder failure.
+var builderAuthFailures = regexp.MustCompile(`(AuthFailure|UnauthorizedOperation|InvalidClientTokenId|` +
+	`SignatureDoesNotMatch|ExpiredToken|NoCredentialProviders|no valid credential sources|` +
+	`could not find default credentials|invalid_grant|AADSTS\d+|Unable to authenticate you|` +
+	`incorrect user name or password)`)
+
+// classifyBuilderFailure classifies err, returned by a builder: as
+// FailureBuilderAuth when it looks like an authentication failure, as
+// FailureBuilder otherwise.
+func classifyBuilderFailure(err error) error {
+	if err != nil && builderAuthFailures.MatchString(err.Error()) {
+		return classifyFailure(err, FailureBuilderAuth)
+	}
+	return classifyFailure(err, FailureBuilder)
+}
@@ -0,0 +1,61 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tc := []struct {
+		name string
+		err  error
+		want FailureClass
+	}{
+		{"unclassified", errors.New("boom"), FailureOther},
+		{"classified", classifyFailure(errors.New("boom"), FailureProvisioner), FailureProvisioner},
+		{"wrapped", fmt.Errorf("build: %w", classifyFailure(errors.New("boom"), FailureRegistry)), FailureRegistry},
+		{"kept", classifyFailure(classifyFailure(errors.New("boom"), FailureRegistry), FailureBuilder), FailureRegistry},
+		{"multi", &packersdk.MultiError{Errors: []error{
+			errors.New("boom"),
+			classifyFailure(errors.New("boom"), FailurePostProcessor),
+		}}, FailurePostProcessor},
+		{"builder", classifyBuilderFailure(errors.New("Timeout waiting for SSH.")), FailureBuilder},
+		{"aws auth", classifyBuilderFailure(errors.New("AuthFailure: AWS was not able to validate the provided access credentials")), FailureBuilderAuth},
+		{"aws token", classifyBuilderFailure(errors.New("ExpiredToken: The security token included in the request is expired")), FailureBuilderAuth},
+		{"azure auth", classifyBuilderFailure(errors.New("AADSTS7000215: Invalid client secret provided.")), FailureBuilderAuth},
+		{"gcp auth", classifyBuilderFailure(errors.New("google: could not find default credentials.")), FailureBuilderAuth},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyFailure(tt.err); got != tt.want {
+				t.Errorf("ClassifyFailure(%q) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+	if err := classifyFailure(nil, FailureBuilder); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestFailureClass_ExitCode(t *testing.T) {
+	seen := map[int]FailureClass{}
+	for class, code := range failureExitCodes {
+		if code == 0 || code == 2 {
+			t.Errorf("%s exits with the reserved code %d", class, code)
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("%s and %s exit with the same code %d", class, other, code)
+		}
+		seen[code] = class
+		if class.ExitCode() != code {
+			t.Errorf("%s exits with %d, want %d", class, class.ExitCode(), code)
+		}
+	}
+	if code := FailureClass("unknown").ExitCode(); code != 1 {
+		t.Errorf("unknown failure exits with %d, want 1", code)
+	}
+}
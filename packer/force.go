@@ -0,0 +1,62 @@
+package packer
+
+import (
+	"fmt"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ForceDeregisterConfigKey is the builder setting, exposed by builders like
+// the Amazon ones, deregistering existing images conflicting with the build.
+const ForceDeregisterConfigKey = "force_deregister"
+
+// outputDirectoryConfigKeys are the builder settings pointing to a local
+// directory that a forced build overwrites.
+var outputDirectoryConfigKeys = []string{"output_directory", "output_dir"}
+
+func builderHasSetting(builder packersdk.Builder, key string) bool {
+	if builder == nil {
+		return false
+	}
+	spec := builder.ConfigSpec()
+	if spec == nil {
+		return false
+	}
+	_, ok := spec[key]
+	return ok
+}
+
+// BuilderSupportsForceDeregister returns true when builder can be asked to
+// deregister existing images, see ForceDeregisterConfigKey.
+func BuilderSupportsForceDeregister(builder packersdk.Builder) bool {
+	return builderHasSetting(builder, ForceDeregisterConfigKey)
+}
+
+// ForceEffects describes, in a human readable form, what the build may
+// destroy given the force settings it was configured with. Builders do not
+// report what they do when forced, so the effects are inferred from the
+// settings they expose.
+func (b *CoreBuild) ForceEffects() []string {
+	var effects []string
+
+	if b.force {
+		effect := "packer_force is set, the builder may delete or overwrite the artifacts of a previous build"
+		for _, key := range outputDirectoryConfigKeys {
+			if builderHasSetting(b.Builder, key) {
+				effect = fmt.Sprintf("packer_force is set, the local output directory (%s) will be overwritten", key)
+				break
+			}
+		}
+		effects = append(effects, effect)
+	}
+
+	if b.forceDeregister {
+		if BuilderSupportsForceDeregister(b.Builder) {
+			effects = append(effects, fmt.Sprintf("existing images conflicting with this build will be deregistered (%s)", ForceDeregisterConfigKey))
+		} else {
+			effects = append(effects, "the builder does not support deregistering existing images, -force-deregister has no effect")
+		}
+	}
+
+	return effects
+}
@@ -0,0 +1,89 @@
+package packer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// specBuilder is a MockBuilder exposing the given settings.
+type specBuilder struct {
+	packersdk.MockBuilder
+	settings []string
+}
+
+func (b *specBuilder) ConfigSpec() hcldec.ObjectSpec {
+	spec := hcldec.ObjectSpec{}
+	for _, name := range b.settings {
+		spec[name] = &hcldec.AttrSpec{Name: name, Type: cty.String}
+	}
+	return spec
+}
+
+func TestCoreBuild_ForceEffects(t *testing.T) {
+	tcs := []struct {
+		name            string
+		settings        []string
+		force           bool
+		forceDeregister bool
+		expected        []string
+	}{
+		{
+			name:     "not forced",
+			settings: []string{"output_directory", ForceDeregisterConfigKey},
+			expected: nil,
+		},
+		{
+			name:     "forced with an output directory",
+			settings: []string{"output_directory"},
+			force:    true,
+			expected: []string{"packer_force is set, the local output directory (output_directory) will be overwritten"},
+		},
+		{
+			name:     "forced without an output directory",
+			force:    true,
+			expected: []string{"packer_force is set, the builder may delete or overwrite the artifacts of a previous build"},
+		},
+		{
+			name:            "deregister supported",
+			settings:        []string{ForceDeregisterConfigKey},
+			forceDeregister: true,
+			expected:        []string{"existing images conflicting with this build will be deregistered (force_deregister)"},
+		},
+		{
+			name:            "deregister unsupported",
+			forceDeregister: true,
+			expected:        []string{"the builder does not support deregistering existing images, -force-deregister has no effect"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &CoreBuild{Builder: &specBuilder{settings: tc.settings}}
+			b.SetForce(tc.force)
+			b.SetForceDeregister(tc.forceDeregister)
+
+			if diff := cmp.Diff(tc.expected, b.ForceEffects()); diff != "" {
+				t.Errorf("unexpected effects: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCoreBuild_Prepare_forceDeregister(t *testing.T) {
+	builder := &specBuilder{settings: []string{ForceDeregisterConfigKey}}
+	b := &CoreBuild{Builder: builder}
+	b.SetForceDeregister(true)
+
+	if _, err := b.Prepare(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	packerConfig := builder.PrepareConfig[1].(map[string]interface{})
+	if packerConfig[ForceDeregisterConfigKey] != true {
+		t.Errorf("expected %s to be set, got %#v", ForceDeregisterConfigKey, packerConfig)
+	}
+}
@@ -0,0 +1,123 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The tags Packer asks Collector builders to set on the resources they create,
+// so that `packer gc` can find them again.
+const (
+	CollectorBuildNameTag = "packer_build_name"
+	CollectorRunUUIDTag   = "packer_run_uuid"
+)
+
+// The kinds of the resources found by a Collector.
+const (
+	// OrphanTemporary is a resource only needed while building, like an
+	// instance or a key pair, that the build failed to destroy.
+	OrphanTemporary = "temporary"
+	// OrphanImage is an image produced by a build.
+	OrphanImage = "image"
+)
+
+// Collector is implemented by builders able to find the resources created by
+// their previous builds, in all the accounts and regions they are configured
+// for, and to destroy them. `packer gc` uses it to reap the temporary
+// resources left behind by failed builds and the images superseded by newer
+// builds.
+type Collector interface {
+	// SetCollectorTags is called before Run with the tags the builder sets
+	// on the resources it creates, temporary ones and images.
+	SetCollectorTags(tags map[string]string)
+	// ListOrphans returns the resources carrying all the tags of filter.
+	ListOrphans(ctx context.Context, filter map[string]string) ([]Orphan, error)
+	// Destroy destroys resources returned by ListOrphans.
+	Destroy(ctx context.Context, ui packersdk.Ui, orphans []Orphan) error
+}
+
+// Orphan is a resource found by a Collector.
+type Orphan struct {
+	// Kind is OrphanTemporary or OrphanImage.
+	Kind string
+	Type string
+	ID   string
+	// Location is where the resource lives, like an account and a region.
+	Location  string
+	Tags      map[string]string
+	CreatedAt time.Time
+}
+
+func (o Orphan) String() string {
+	s := fmt.Sprintf("%s %s", o.Type, o.ID)
+	if o.Location != "" {
+		s += " in " + o.Location
+	}
+	return s
+}
+
+// Collector returns the Collector capability of the builder of b, looking
+// through the builders wrapped by the core.
+func (b *CoreBuild) Collector() (Collector, bool) {
+	builder := b.Builder
+	if rb, ok := builder.(*RegistryBuilder); ok {
+		builder = rb.Builder
+	}
+	c, ok := builder.(Collector)
+	return c, ok
+}
+
+// setCollectorTags tags the resources the builder creates during the run
+// runUUID, when it is a Collector.
+func (b *CoreBuild) setCollectorTags(runUUID string) {
+	c, ok := b.Collector()
+	if !ok {
+		return
+	}
+	if runUUID == "" {
+		runUUID = os.Getenv("PACKER_RUN_UUID")
+	}
+	c.SetCollectorTags(map[string]string{
+		CollectorBuildNameTag: b.Name(),
+		CollectorRunUUIDTag:   runUUID,
+	})
+}
+
+// SelectGarbage returns the orphans to destroy, oldest first: the temporary
+// resources created more than minAge ago, so that the resources of running
+// builds are left alone, and, when keepImages is positive, the images older
+// than minAge superseded by the keepImages newest images.
+func SelectGarbage(orphans []Orphan, now time.Time, minAge time.Duration, keepImages int) []Orphan {
+	var images, garbage []Orphan
+	for _, o := range orphans {
+		switch o.Kind {
+		case OrphanTemporary:
+			if now.Sub(o.CreatedAt) >= minAge {
+				garbage = append(garbage, o)
+			}
+		case OrphanImage:
+			images = append(images, o)
+		}
+	}
+
+	if keepImages > 0 {
+		sort.SliceStable(images, func(i, j int) bool {
+			return images[i].CreatedAt.After(images[j].CreatedAt)
+		})
+		for i, o := range images {
+			if i >= keepImages && now.Sub(o.CreatedAt) >= minAge {
+				garbage = append(garbage, o)
+			}
+		}
+	}
+
+	sort.SliceStable(garbage, func(i, j int) bool {
+		return garbage[i].CreatedAt.Before(garbage[j].CreatedAt)
+	})
+	return garbage
+}
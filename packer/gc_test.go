@@ -0,0 +1,81 @@
+package packer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestSelectGarbage(t *testing.T) {
+	now := time.Date(2022, 3, 2, 12, 0, 0, 0, time.UTC)
+	orphans := []Orphan{
+		{Kind: OrphanImage, ID: "image-new", CreatedAt: now.Add(-2 * time.Hour)},
+		{Kind: OrphanTemporary, ID: "temp-recent", CreatedAt: now.Add(-10 * time.Minute)},
+		{Kind: OrphanImage, ID: "image-old", CreatedAt: now.Add(-48 * time.Hour)},
+		{Kind: OrphanTemporary, ID: "temp-old", CreatedAt: now.Add(-3 * time.Hour)},
+		{Kind: OrphanImage, ID: "image-oldest", CreatedAt: now.Add(-72 * time.Hour)},
+		{Kind: OrphanImage, ID: "image-superseded-recent", CreatedAt: now.Add(-30 * time.Minute)},
+	}
+	ids := func(orphans []Orphan) []string {
+		var res []string
+		for _, o := range orphans {
+			res = append(res, o.ID)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name       string
+		keepImages int
+		want       []string
+	}{
+		{"images kept", 0, []string{"temp-old"}},
+		{"newest image kept", 1, []string{"image-oldest", "image-old", "temp-old", "image-new"}},
+		{"newest images kept", 3, []string{"image-oldest", "temp-old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(SelectGarbage(orphans, now, time.Hour, tt.keepImages))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// collectorBuilder records the tags it is asked to set.
+type collectorBuilder struct {
+	packersdk.MockBuilder
+	tags map[string]string
+}
+
+func (b *collectorBuilder) SetCollectorTags(tags map[string]string) { b.tags = tags }
+
+func (b *collectorBuilder) ListOrphans(context.Context, map[string]string) ([]Orphan, error) {
+	return nil, nil
+}
+
+func (b *collectorBuilder) Destroy(context.Context, packersdk.Ui, []Orphan) error { return nil }
+
+func TestBuild_Run_CollectorTags(t *testing.T) {
+	t.Setenv("PACKER_RUN_UUID", "run-uuid")
+
+	builder := &collectorBuilder{}
+	build := testBuild()
+	build.Builder = builder
+	build.Prepare()
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		CollectorBuildNameTag: "test",
+		CollectorRunUUIDTag:   "run-uuid",
+	}
+	if !reflect.DeepEqual(builder.tags, want) {
+		t.Errorf("expected the tags %v, got %v", want, builder.tags)
+	}
+}
@@ -0,0 +1,133 @@
+package packer
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// The hardware virtualization features a build can require from the host.
+const (
+	// VirtualizationKVM is the Linux kernel virtual machine.
+	VirtualizationKVM = "kvm"
+	// VirtualizationHVF is the hypervisor framework of macOS.
+	VirtualizationHVF = "hvf"
+	// VirtualizationNested is KVM allowing guests to run virtual machines
+	// themselves.
+	VirtualizationNested = "nested"
+)
+
+// VirtualizationFeatures lists the features a build can require.
+var VirtualizationFeatures = []string{VirtualizationKVM, VirtualizationHVF, VirtualizationNested}
+
+// HostRequirements are what the machine running Packer must provide for a
+// build to succeed. They are checked before building, and by validate, so
+// that a missing accelerator or a full disk is reported up front instead of
+// failing the build half way through.
+type HostRequirements struct {
+	// Virtualization lists the virtualization features the builder uses,
+	// see VirtualizationFeatures.
+	Virtualization []string
+	// MinMemory is the memory, in bytes, that must be available.
+	MinMemory uint64
+	// MinFreeDisk is the disk space, in bytes, that must be free on the
+	// file system of DiskPath, the current directory when empty.
+	MinFreeDisk uint64
+	DiskPath    string
+	// Commands lists the programs that must be found in the PATH.
+	Commands []string
+}
+
+// Host reports what a machine provides, see LocalHost.
+type Host interface {
+	// Virtualization returns nil when feature is usable, and an error
+	// telling how to make it usable otherwise.
+	Virtualization(feature string) error
+	AvailableMemory() (uint64, error)
+	FreeDisk(path string) (uint64, error)
+	LookPath(command string) (string, error)
+}
+
+// LocalHost is the machine running Packer.
+var LocalHost Host = localHost{}
+
+type localHost struct{}
+
+func (localHost) Virtualization(feature string) error {
+	return hostVirtualization(feature)
+}
+
+func (localHost) AvailableMemory() (uint64, error) {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return vm.Available, nil
+}
+
+func (localHost) FreeDisk(path string) (uint64, error) {
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return 0, err
+	}
+	return usage.Free, nil
+}
+
+func (localHost) LookPath(command string) (string, error) {
+	return exec.LookPath(command)
+}
+
+// Check returns an error for each requirement the host does not meet.
+func (r *HostRequirements) Check(host Host) []error {
+	var errs []error
+	for _, feature := range r.Virtualization {
+		if err := host.Virtualization(feature); err != nil {
+			errs = append(errs, fmt.Errorf("%s virtualization is not available: %s", feature, err))
+		}
+	}
+
+	if r.MinMemory > 0 {
+		available, err := host.AvailableMemory()
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to read the available memory: %s", err))
+		case available < r.MinMemory:
+			errs = append(errs, fmt.Errorf("%s of memory are required but only %s are available; stop other virtual machines or applications",
+				datasize.ByteSize(r.MinMemory).HumanReadable(), datasize.ByteSize(available).HumanReadable()))
+		}
+	}
+
+	if r.MinFreeDisk > 0 {
+		path := r.DiskPath
+		if path == "" {
+			path = "."
+		}
+		free, err := host.FreeDisk(path)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to read the free disk space of %s: %s", path, err))
+		case free < r.MinFreeDisk:
+			errs = append(errs, fmt.Errorf("%s of disk space are required in %s but only %s are free; free some space or build elsewhere",
+				datasize.ByteSize(r.MinFreeDisk).HumanReadable(), path, datasize.ByteSize(free).HumanReadable()))
+		}
+	}
+
+	for _, command := range r.Commands {
+		if _, err := host.LookPath(command); err != nil {
+			errs = append(errs, fmt.Errorf("the %s command is not installed: it was not found in the PATH", command))
+		}
+	}
+	return errs
+}
+
+// CheckHost returns an error for each host requirement of the build that host
+// does not meet.
+func (b *CoreBuild) CheckHost(host Host) []error {
+	if b.HostRequirements == nil {
+		return nil
+	}
+	return b.HostRequirements.Check(host)
+}
@@ -0,0 +1,20 @@
+package packer
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func hostVirtualization(feature string) error {
+	switch feature {
+	case VirtualizationHVF:
+		if v, err := unix.SysctlUint32("kern.hv_support"); err != nil || v != 1 {
+			return fmt.Errorf("the hypervisor framework is not supported by this Mac, or it runs in a virtual machine without nested virtualization")
+		}
+		return nil
+	case VirtualizationKVM, VirtualizationNested:
+		return fmt.Errorf("it is only available on Linux, use hvf on macOS")
+	}
+	return fmt.Errorf("unknown feature")
+}
@@ -0,0 +1,46 @@
+package packer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func hostVirtualization(feature string) error {
+	switch feature {
+	case VirtualizationKVM:
+		return kvmAvailable()
+	case VirtualizationNested:
+		if err := kvmAvailable(); err != nil {
+			return err
+		}
+		for _, module := range []string{"kvm_intel", "kvm_amd"} {
+			raw, err := os.ReadFile("/sys/module/" + module + "/parameters/nested")
+			if err != nil {
+				continue
+			}
+			if v := strings.TrimSpace(string(raw)); v == "Y" || v == "1" {
+				return nil
+			}
+			return fmt.Errorf("the nested parameter of the %s module is disabled; reload it with nested=1", module)
+		}
+		return fmt.Errorf("neither the kvm_intel nor the kvm_amd module is loaded")
+	case VirtualizationHVF:
+		return fmt.Errorf("it is only available on macOS, use kvm on Linux")
+	}
+	return fmt.Errorf("unknown feature")
+}
+
+func kvmAvailable() error {
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("/dev/kvm does not exist; enable virtualization in the firmware settings " +
+			"and load the kvm_intel or kvm_amd module, or on a virtual machine enable nested virtualization on its host")
+	case os.IsPermission(err):
+		return fmt.Errorf("/dev/kvm cannot be opened by the current user; add the user to the group owning it, usually kvm")
+	case err != nil:
+		return err
+	}
+	return f.Close()
+}
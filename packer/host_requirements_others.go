@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package packer
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func hostVirtualization(feature string) error {
+	return fmt.Errorf("Packer cannot check for it on %s", runtime.GOOS)
+}
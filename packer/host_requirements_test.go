@@ -0,0 +1,79 @@
+package packer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeHost is a machine with 4GB of memory available, 10GB free on its disk
+// and only KVM and the sh command.
+type fakeHost struct {
+	diskPath string
+}
+
+func (fakeHost) Virtualization(feature string) error {
+	if feature == VirtualizationKVM {
+		return nil
+	}
+	return fmt.Errorf("not supported")
+}
+
+func (fakeHost) AvailableMemory() (uint64, error) { return 4 << 30, nil }
+
+func (h *fakeHost) FreeDisk(path string) (uint64, error) {
+	h.diskPath = path
+	return 10 << 30, nil
+}
+
+func (fakeHost) LookPath(command string) (string, error) {
+	if command == "sh" {
+		return "/bin/sh", nil
+	}
+	return "", fmt.Errorf("not found")
+}
+
+func TestHostRequirements_Check(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements HostRequirements
+		wantErrs     []string
+		wantDiskPath string
+	}{
+		{"met", HostRequirements{
+			Virtualization: []string{VirtualizationKVM},
+			MinMemory:      2 << 30,
+			MinFreeDisk:    10 << 30,
+			DiskPath:       "output",
+			Commands:       []string{"sh"},
+		}, nil, "output"},
+		{"not met", HostRequirements{
+			Virtualization: []string{VirtualizationKVM, VirtualizationNested},
+			MinMemory:      8 << 30,
+			MinFreeDisk:    20 << 30,
+			Commands:       []string{"sh", "qemu-img"},
+		}, []string{
+			"nested virtualization is not available: not supported",
+			"8.0 GB of memory are required but only 4.0 GB are available",
+			"20.0 GB of disk space are required in . but only 10.0 GB are free",
+			"the qemu-img command is not installed",
+		}, "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := &fakeHost{}
+			errs := tt.requirements.Check(host)
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("expected %d errors, got %v", len(tt.wantErrs), errs)
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.wantErrs[i]) {
+					t.Errorf("expected %q in error %d, got %q", tt.wantErrs[i], i, err)
+				}
+			}
+			if host.diskPath != tt.wantDiskPath {
+				t.Errorf("expected the free disk space of %q to be checked, got %q", tt.wantDiskPath, host.diskPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/internal/hostexec"
+)
+
+// LocalCommand is a script run on the machine running Packer before a build
+// starts, see CoreBuild.PreBuild, or once it succeeded, see CoreBuild.PostBuild.
+// They warm caches or trigger downstream jobs without a provisioner or a
+// post-processor.
+type LocalCommand struct {
+	// Inline are the commands of the script, run until one fails.
+	Inline []string
+	// Shell runs the script, see hostexec.Shell: sh by default, or cmd on
+	// Windows.
+	Shell string
+	// Env are environment variables set for the script, in addition to the
+	// ones describing the build, see localCommandEnv.
+	Env map[string]string
+	// WorkingDir is where the script runs, the current directory when
+	// empty.
+	WorkingDir string
+}
+
+// Run runs the script, writing its output to ui. env describes the build.
+func (c *LocalCommand) Run(ctx context.Context, ui packersdk.Ui, env map[string]string) error {
+	shell, err := hostexec.ParseShell(c.Shell)
+	if err != nil {
+		return err
+	}
+	vars := make(map[string]string, len(env)+len(c.Env))
+	for _, m := range []map[string]string{env, c.Env} {
+		for k, v := range m {
+			vars[k] = v
+		}
+	}
+	cmd := hostexec.Command(ctx, shell.InlineArgs(c.Inline), vars, c.WorkingDir)
+	code, err := hostexec.Run(cmd, ui)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("%s exited with code %d", shell, code)
+	}
+	return nil
+}
+
+// localCommandEnv returns the environment variables describing the build to
+// its local commands. The post-build commands also get the IDs of the
+// artifacts of the build.
+func (b *CoreBuild) localCommandEnv(artifacts []packersdk.Artifact) map[string]string {
+	env := map[string]string{
+		"PACKER_BUILD_NAME": b.Name(),
+		"PACKER_BUILD_TYPE": b.Type,
+	}
+	if b.BuilderType != "" {
+		env["PACKER_BUILDER_TYPE"] = b.BuilderType
+	}
+	if b.TempDir != "" {
+		env["PACKER_BUILD_TEMP_DIR"] = b.TempDir
+	}
+	var ids []string
+	for _, a := range artifacts {
+		if a != nil {
+			ids = append(ids, a.Id())
+		}
+	}
+	if len(ids) > 0 {
+		// The last artifact went through all the post-processors.
+		env["PACKER_ARTIFACT_ID"] = ids[len(ids)-1]
+		env["PACKER_ARTIFACT_IDS"] = strings.Join(ids, ",")
+	}
+	return env
+}
+
+// runLocalCommands runs commands in order, stopping at the first one failing.
+// stage is pre-build or post-build.
+func (b *CoreBuild) runLocalCommands(ctx context.Context, ui packersdk.Ui, stage string, commands []LocalCommand, artifacts []packersdk.Artifact) (err error) {
+	if len(commands) == 0 {
+		return nil
+	}
+	endTiming := b.timer.start(TimingLocalCommands, stage)
+	defer func() { endTiming(err) }()
+	env := b.localCommandEnv(artifacts)
+	for i := range commands {
+		ui.Say(fmt.Sprintf("Running %s commands...", stage))
+		if err := commands[i].Run(ctx, ui, env); err != nil {
+			return fmt.Errorf("%s commands failed: %s", stage, err)
+		}
+	}
+	return nil
+}
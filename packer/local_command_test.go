@@ -0,0 +1,70 @@
+package packer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestBuild_Run_LocalCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a POSIX shell")
+	}
+
+	t.Run("pre and post build", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		build := testBuild()
+		build.PreBuild = []LocalCommand{
+			{Inline: []string{`echo "pre $PACKER_BUILD_NAME $STAGE" >> ` + out}, Env: map[string]string{"STAGE": "warm"}},
+		}
+		build.PostBuild = []LocalCommand{
+			{Inline: []string{`echo "post $PACKER_ARTIFACT_ID $PACKER_ARTIFACT_IDS" >> ` + out}},
+		}
+		build.Prepare()
+
+		if _, err := build.Run(context.Background(), testUi()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("expected the commands to run: %s", err)
+		}
+		expected := "pre test warm\npost pp b,pp\n"
+		if string(b) != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+		}
+	})
+
+	t.Run("pre build fails", func(t *testing.T) {
+		build := testBuild()
+		build.PreBuild = []LocalCommand{{Inline: []string{"false", "echo unreachable"}}}
+		build.Prepare()
+
+		_, err := build.Run(context.Background(), testUi())
+		if err == nil || !strings.Contains(err.Error(), "pre-build commands failed") {
+			t.Fatalf("expected the pre-build commands to fail the build, got %v", err)
+		}
+		if build.Builder.(*packersdk.MockBuilder).RunCalled {
+			t.Error("expected the builder not to run")
+		}
+	})
+
+	t.Run("post build fails", func(t *testing.T) {
+		build := testBuild()
+		build.PostBuild = []LocalCommand{{Inline: []string{"exit 3"}}}
+		build.Prepare()
+
+		artifacts, err := build.Run(context.Background(), testUi())
+		if err == nil || !strings.Contains(err.Error(), "post-build commands failed") {
+			t.Fatalf("expected the post-build commands to fail the build, got %v", err)
+		}
+		if len(artifacts) == 0 {
+			t.Error("expected the artifacts to be returned")
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package packer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// RestrictLocalExecEnvVar enables the restricted mode of the LocalExecPolicy
+// when set to a true value, regardless of the Packer config file.
+const RestrictLocalExecEnvVar = "PACKER_RESTRICT_LOCAL_EXEC"
+
+// The components running the commands of the template on the machine running
+// Packer, as named in LocalExecPolicy.Allow: provisioners, post-processors and
+// data sources are named by kind and type, like "provisioner.shell-local",
+// the commands of builds by block, like "pre_build".
+var localExecComponents = map[string]bool{
+	"provisioner.shell-local":    true,
+	"provisioner.ansible":        true,
+	"post-processor.shell-local": true,
+	"data.external":              true,
+	"pre_build":                  true,
+	"post_build":                 true,
+}
+
+// LocalExecPolicy restricts the components running commands on the machine
+// running Packer, so that shared CI runners can build third-party templates
+// without running arbitrary code on the host. Plugins are host code too: the
+// templates of a restricted runner should only use the plugins it installed.
+type LocalExecPolicy struct {
+	// Restricted disables the components running local commands, except the
+	// ones in Allow.
+	Restricted bool `json:"restricted"`
+	// Allow are the components allowed in restricted mode, see
+	// localExecComponents.
+	Allow []string `json:"allow"`
+}
+
+// Enabled tells whether the policy restricts anything, either as configured
+// or because of RestrictLocalExecEnvVar.
+func (p *LocalExecPolicy) Enabled() bool {
+	if p != nil && p.Restricted {
+		return true
+	}
+	restricted, _ := strconv.ParseBool(os.Getenv(RestrictLocalExecEnvVar))
+	return restricted
+}
+
+// Check returns an error when the named component runs local commands and is
+// not allowed.
+func (p *LocalExecPolicy) Check(component string) error {
+	if !localExecComponents[component] || !p.Enabled() {
+		return nil
+	}
+	if p != nil {
+		for _, allowed := range p.Allow {
+			if allowed == component {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s runs commands on the machine running Packer, which is disabled in restricted mode; "+
+		"allow it in the local_exec settings of the Packer config file", component)
+}
+
+// CheckBuild returns the errors of the components of b that run local
+// commands and are not allowed, once per component.
+func (p *LocalExecPolicy) CheckBuild(b *CoreBuild) []error {
+	var components []string
+	for _, prov := range b.Provisioners {
+		components = append(components, "provisioner."+prov.PType)
+	}
+	if b.CleanupProvisioner.PType != "" {
+		components = append(components, "provisioner."+b.CleanupProvisioner.PType)
+	}
+	for _, chain := range b.PostProcessors {
+		for _, pp := range chain {
+			components = append(components, "post-processor."+pp.PType)
+		}
+	}
+	if len(b.PreBuild) > 0 {
+		components = append(components, "pre_build")
+	}
+	if len(b.PostBuild) > 0 {
+		components = append(components, "post_build")
+	}
+
+	var errs []error
+	checked := map[string]bool{}
+	for _, component := range components {
+		if checked[component] {
+			continue
+		}
+		checked[component] = true
+		if err := p.Check(component); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
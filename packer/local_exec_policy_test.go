@@ -0,0 +1,42 @@
+package packer
+
+import (
+	"testing"
+)
+
+func TestLocalExecPolicy_CheckBuild(t *testing.T) {
+	build := &CoreBuild{
+		Type: "test",
+		Provisioners: []CoreBuildProvisioner{
+			{PType: "shell"},
+			{PType: "shell-local"},
+			{PType: "shell-local"},
+		},
+		PostProcessors: [][]CoreBuildPostProcessor{
+			{{PType: "shell-local"}},
+		},
+		PostBuild: []LocalCommand{{Inline: []string{"echo done"}}},
+	}
+
+	tests := []struct {
+		name    string
+		policy  *LocalExecPolicy
+		env     string
+		wantErr int
+	}{
+		{"no policy", nil, "", 0},
+		{"not restricted", &LocalExecPolicy{Allow: []string{"pre_build"}}, "", 0},
+		{"restricted", &LocalExecPolicy{Restricted: true}, "", 3},
+		{"restricted by the environment", nil, "1", 3},
+		{"allowed", &LocalExecPolicy{Restricted: true, Allow: []string{"provisioner.shell-local", "post_build"}}, "", 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(RestrictLocalExecEnvVar, tt.env)
+			if errs := tt.policy.CheckBuild(build); len(errs) != tt.wantErr {
+				t.Errorf("expected %d errors, got %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// PauseGate pauses the provisioning of the builds of a run between two
+// provisioners, like when a shared hypervisor or a cloud quota needs some
+// relief, until it is resumed. The provisioners running when the gate is
+// paused run to completion. The zero value is a resumed gate, a nil gate is
+// never paused.
+type PauseGate struct {
+	l sync.Mutex
+	// resumed is closed when the gate is resumed, nil when it is not paused.
+	resumed chan struct{}
+}
+
+// Pause pauses the gate, it tells whether it was not paused already.
+func (g *PauseGate) Pause() bool {
+	g.l.Lock()
+	defer g.l.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	return true
+}
+
+// Resume resumes the gate, it tells whether it was paused.
+func (g *PauseGate) Resume() bool {
+	g.l.Lock()
+	defer g.l.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+// Paused tells whether the gate is paused.
+func (g *PauseGate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	g.l.Lock()
+	defer g.l.Unlock()
+	return g.resumed != nil
+}
+
+// Wait blocks while the gate is paused, before the provisioner named next
+// runs. It returns the error of ctx when it is done first.
+func (g *PauseGate) Wait(ctx context.Context, ui packersdk.Ui, next string) error {
+	if g == nil {
+		return nil
+	}
+	g.l.Lock()
+	resumed := g.resumed
+	g.l.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	if ui != nil {
+		ui.Machine("provisioning", "paused", next)
+		ui.Say(fmt.Sprintf("Provisioning is paused, the %s provisioner will run once it is resumed", next))
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+	}
+	if ui != nil {
+		ui.Machine("provisioning", "resumed", next)
+		ui.Say("Provisioning resumed")
+	}
+	return nil
+}
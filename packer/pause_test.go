@@ -0,0 +1,67 @@
+package packer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestProvisionHook_pause(t *testing.T) {
+	gate := &PauseGate{}
+	pA := &packersdk.MockProvisioner{}
+	pB := &packersdk.MockProvisioner{}
+	// The gate pauses while pA runs, pB waits for it to resume.
+	pA.ProvFunc = func(context.Context) error {
+		gate.Pause()
+		return nil
+	}
+	hook := &ProvisionHook{
+		Provisioners: []*HookedProvisioner{
+			{pA, nil, "a"},
+			{pB, nil, "b"},
+		},
+		Pause: gate,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- hook.Run(context.Background(), "foo", testUi(), new(packersdk.MockCommunicator), nil)
+	}()
+	select {
+	case err := <-errCh:
+		t.Fatalf("expected the hook to wait for the gate to resume, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if pB.ProvCalled {
+		t.Fatal("expected the provisioner not to run while provisioning is paused")
+	}
+
+	if !gate.Resume() {
+		t.Fatal("expected the gate to be paused")
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !pB.ProvCalled {
+		t.Error("expected the provisioner to run once provisioning resumed")
+	}
+}
+
+func TestPauseGate_Wait_cancelled(t *testing.T) {
+	gate := &PauseGate{}
+	if !gate.Pause() || gate.Pause() {
+		t.Fatal("expected the gate to pause once")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gate.Wait(ctx, testUi(), "shell"); err != context.Canceled {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+
+	var nilGate *PauseGate
+	if err := nilGate.Wait(ctx, testUi(), "shell"); err != nil || nilGate.Paused() {
+		t.Errorf("expected a nil gate never to pause, got %v", err)
+	}
+}
@@ -9,10 +9,12 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/pathing"
 	pluginsdk "github.com/hashicorp/packer-plugin-sdk/plugin"
+	"github.com/zclconf/go-cty/cty/function"
 )
 
 // PluginConfig helps load and use packer plugins
@@ -24,6 +26,9 @@ type PluginConfig struct {
 	Provisioners       ProvisionerSet
 	PostProcessors     PostProcessorSet
 	DataSources        DatasourceSet
+	// Functions are the HCL functions of the plugins, available to HCL2
+	// templates, see FunctionDescription.
+	Functions map[string]function.Function
 
 	// Redirects are only set when a plugin was completely moved out; they allow
 	// telling where a plugin has moved by checking if a known component of this
@@ -41,8 +46,33 @@ type PluginConfig struct {
 	DatasourceRedirects    map[string]string
 	ProvisionerRedirects   map[string]string
 	PostProcessorRedirects map[string]string
+
+	// ProcessGroup starts the plugin processes in process groups of their
+	// own, so that the signals of the terminal only reach Packer, like the
+	// SIGTSTP of packer build -pause-signals.
+	ProcessGroup bool
+
+	// tempDir, when set, is the temporary directory of the plugin processes
+	// started, see StartBuilder.
+	tempDir string
+	// processBuild, when set, is the build the plugin processes started are
+	// attributed to, see AttributeProcesses.
+	processBuild string
+	processes    *buildProcesses
+
+	// builderPlugins are the builders of multi-component plugins, by builder
+	// type, see ResourceCleaner.
+	builderPlugins map[string]builderPlugin
+
+	// registeredComponents are the in-process components, see
+	// RegisterBuilder.
+	registeredComponents *registeredComponents
 }
 
+// startBuilderLock serializes StartBuilder, which sets the temporary directory
+// of the plugin process it starts through PluginConfig.tempDir.
+var startBuilderLock sync.Mutex
+
 // PACKERSPACE is used to represent the spaces that separate args for a command
 // without being confused with spaces in the path to the command itself.
 const PACKERSPACE = "-PACKERSPACE-"
@@ -67,6 +97,10 @@ func (c *PluginConfig) Discover() error {
 	if c.DataSources == nil {
 		c.DataSources = MapOfDatasource{}
 	}
+	if c.Functions == nil {
+		c.Functions = map[string]function.Function{}
+	}
+	defer c.applyRegistered()
 
 	// If we are already inside a plugin process we should not need to
 	// discover anything.
@@ -283,6 +317,10 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 		c.Builders.Set(key, func() (packersdk.Builder, error) {
 			return c.Client(pluginPath, "start", "builder", builderName).Builder()
 		})
+		if c.builderPlugins == nil {
+			c.builderPlugins = map[string]builderPlugin{}
+		}
+		c.builderPlugins[key] = builderPlugin{path: pluginPath, name: builderName}
 	}
 
 	if len(desc.Builders) > 0 {
@@ -332,7 +370,58 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 		log.Printf("found external %v datasource from %s plugin", desc.Datasources, pluginName)
 	}
 
-	return nil
+	return c.discoverFunctions(pluginName, pluginPath, out)
+}
+
+// StartBuilder starts the builder named name, like Builders.Start. When
+// tempDir is set, the plugin process of the builder creates its temporary
+// files, like the floppy or CD files it stages, in tempDir rather than in the
+// temporary directory shared by all the builds; see CoreBuild.TempDir.
+func (c *PluginConfig) StartBuilder(name, tempDir string) (packersdk.Builder, error) {
+	startBuilderLock.Lock()
+	defer startBuilderLock.Unlock()
+
+	c.tempDir = tempDir
+	defer func() { c.tempDir = "" }()
+	return c.Builders.Start(name)
+}
+
+// AttributeProcesses attributes the plugin processes started from now on to
+// the named build, until it is called again; an empty name stops attributing
+// them. The components of a build are started when its template is parsed,
+// one build after the other.
+func (c *PluginConfig) AttributeProcesses(build string) {
+	if c.processes == nil {
+		c.processes = &buildProcesses{pids: map[string][]int32{}}
+	}
+	c.processBuild = build
+}
+
+// BuildProcesses returns the IDs of the plugin processes started for the
+// named build, see AttributeProcesses.
+func (c *PluginConfig) BuildProcesses(build string) []int32 {
+	return c.processes.of(build)
+}
+
+// buildProcesses are the plugin processes started for each build.
+type buildProcesses struct {
+	mu   sync.Mutex
+	pids map[string][]int32
+}
+
+func (p *buildProcesses) add(build string, pid int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pids[build] = append(p.pids[build], int32(pid))
+}
+
+func (p *buildProcesses) of(build string) []int32 {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int32(nil), p.pids[build]...)
 }
 
 func (c *PluginConfig) Client(path string, args ...string) *PluginClient {
@@ -373,8 +462,20 @@ func (c *PluginConfig) Client(path string, args ...string) *PluginClient {
 	}
 	var config PluginClientConfig
 	config.Cmd = exec.Command(path, args...)
+	if c.ProcessGroup {
+		config.Cmd.SysProcAttr = processGroupAttr()
+	}
 	config.Managed = true
 	config.MinPort = c.PluginMinPort
 	config.MaxPort = c.PluginMaxPort
+	if c.tempDir != "" {
+		// The temporary files of the plugins are created in the directory
+		// returned by os.TempDir.
+		config.Env = []string{"TMPDIR=" + c.tempDir, "TMP=" + c.tempDir, "TEMP=" + c.tempDir}
+	}
+	if build := c.processBuild; build != "" {
+		processes := c.processes
+		config.Started = func(pid int) { processes.add(build, pid) }
+	}
 	return NewClient(&config)
 }
@@ -66,6 +66,14 @@ type PluginClientConfig struct {
 	// If non-nil, then the stderr of the client will be written to here
 	// (as well as the log).
 	Stderr io.Writer
+
+	// Env are environment variables set for the subprocess, over the ones of
+	// Packer, in the key=value form.
+	Env []string
+
+	// If non-nil, Started is called with the ID of the subprocess once it
+	// started.
+	Started func(pid int)
 }
 
 // This makes sure all the managed subprocesses are killed and properly
@@ -230,6 +238,7 @@ func (c *PluginClient) Start() (net.Addr, error) {
 	cmd := c.config.Cmd
 	cmd.Env = append(cmd.Env, os.Environ()...)
 	cmd.Env = append(cmd.Env, env...)
+	cmd.Env = append(cmd.Env, c.config.Env...)
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = stderr_w
 	cmd.Stdout = stdout_w
@@ -239,6 +248,9 @@ func (c *PluginClient) Start() (net.Addr, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.config.Started != nil {
+		c.config.Started(cmd.Process.Pid)
+	}
 
 	// Make sure the command is properly cleaned up if there is an error
 	defer func() {
@@ -206,7 +206,19 @@ func TestHelperPlugins(t *testing.T) {
 
 	pluginName, args := args[0], args[1:]
 
-	allMocks := []map[string]pluginsdk.Set{mockPlugins, defaultNameMock, doubleDefaultMock, badDefaultNameMock}
+	if funcs, found := mockFunctions[pluginName]; found {
+		set := mockFunctionPlugins[pluginName]
+		served, err := ServeFunctions(args, &set, funcs, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if served {
+			os.Exit(0)
+		}
+	}
+
+	allMocks := []map[string]pluginsdk.Set{mockPlugins, defaultNameMock, doubleDefaultMock, badDefaultNameMock, mockFunctionPlugins}
 	for _, mock := range allMocks {
 		plugin, found := mock[pluginName]
 		if found {
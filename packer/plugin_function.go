@@ -0,0 +1,317 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	pluginsdk "github.com/hashicorp/packer-plugin-sdk/plugin"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// The commands of the plugin binaries contributing HCL functions. A plugin
+// lists its functions in the "functions" field of the output of its describe
+// command, see FunctionDescription, and Packer calls a function by running
+// the plugin with the CallFunctionCommand, see ServeFunctions.
+const (
+	DescribeCommand     = "describe"
+	CallFunctionCommand = "call-function"
+)
+
+// FunctionDescription describes an HCL function of a plugin: its parameters
+// and the type of its result. Types are encoded like ctyjson.MarshalType does,
+// "dynamic" accepting any type.
+type FunctionDescription struct {
+	Description   string          `json:"description,omitempty"`
+	Params        []FunctionParam `json:"params"`
+	VariadicParam *FunctionParam  `json:"variadic_param,omitempty"`
+	ReturnType    json.RawMessage `json:"return_type"`
+}
+
+// FunctionParam is a parameter of a function of a plugin.
+type FunctionParam struct {
+	Name      string          `json:"name"`
+	Type      json.RawMessage `json:"type"`
+	AllowNull bool            `json:"allow_null,omitempty"`
+}
+
+// functionCall is the input of the CallFunctionCommand, and functionResult its
+// output. Values are encoded like ctyjson.Marshal does with
+// cty.DynamicPseudoType, along with their type.
+type functionCall struct {
+	Args []json.RawMessage `json:"args"`
+}
+
+type functionResult struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// functionsDescription is the part of the output of the describe command of a
+// plugin listing its functions.
+type functionsDescription struct {
+	Functions map[string]FunctionDescription `json:"functions"`
+}
+
+// DescribeFunction returns the description of fn, for a plugin to list it.
+// The return type of fn is the one it returns for the types of its parameters.
+func DescribeFunction(fn function.Function, description string) (FunctionDescription, error) {
+	desc := FunctionDescription{Description: description}
+	var argTypes []cty.Type
+	for _, p := range fn.Params() {
+		param, err := describeParam(p)
+		if err != nil {
+			return desc, err
+		}
+		desc.Params = append(desc.Params, param)
+		argTypes = append(argTypes, p.Type)
+	}
+	if p := fn.VarParam(); p != nil {
+		param, err := describeParam(*p)
+		if err != nil {
+			return desc, err
+		}
+		desc.VariadicParam = &param
+	}
+	ret, err := fn.ReturnType(argTypes)
+	if err != nil {
+		ret = cty.DynamicPseudoType
+	}
+	desc.ReturnType, err = ctyjson.MarshalType(ret)
+	return desc, err
+}
+
+func describeParam(p function.Parameter) (FunctionParam, error) {
+	ty, err := ctyjson.MarshalType(p.Type)
+	return FunctionParam{Name: p.Name, Type: ty, AllowNull: p.AllowNull}, err
+}
+
+// spec returns the spec of the function described by d, calling call to run
+// it.
+func (d FunctionDescription) spec(call function.ImplFunc) (*function.Spec, error) {
+	param := func(p FunctionParam) (function.Parameter, error) {
+		ty, err := ctyjson.UnmarshalType(p.Type)
+		if err != nil {
+			return function.Parameter{}, fmt.Errorf("invalid type of parameter %q: %s", p.Name, err)
+		}
+		return function.Parameter{Name: p.Name, Type: ty, AllowNull: p.AllowNull}, nil
+	}
+	spec := &function.Spec{Impl: call}
+	for _, p := range d.Params {
+		param, err := param(p)
+		if err != nil {
+			return nil, err
+		}
+		spec.Params = append(spec.Params, param)
+	}
+	if d.VariadicParam != nil {
+		param, err := param(*d.VariadicParam)
+		if err != nil {
+			return nil, err
+		}
+		spec.VarParam = &param
+	}
+	ret, err := ctyjson.UnmarshalType(d.ReturnType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid return type: %s", err)
+	}
+	spec.Type = function.StaticReturnType(ret)
+	return spec, nil
+}
+
+// pluginFunction returns the function name of the plugin binary at
+// pluginPath, described by desc.
+func pluginFunction(pluginPath, name string, desc FunctionDescription) (function.Function, error) {
+	spec, err := desc.spec(func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var call functionCall
+		for _, arg := range args {
+			b, err := ctyjson.Marshal(arg, cty.DynamicPseudoType)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			call.Args = append(call.Args, b)
+		}
+		in, err := json.Marshal(call)
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(pluginPath, CallFunctionCommand, name)
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		runErr := cmd.Run()
+
+		var res functionResult
+		if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+			if runErr != nil {
+				return cty.NilVal, fmt.Errorf("running the plugin failed: %s: %s", runErr, strings.TrimSpace(stderr.String()))
+			}
+			return cty.NilVal, fmt.Errorf("invalid result: %s", err)
+		}
+		if res.Error != "" {
+			return cty.NilVal, errors.New(res.Error)
+		}
+		val, err := ctyjson.Unmarshal(res.Result, cty.DynamicPseudoType)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("invalid result: %s", err)
+		}
+		return val, nil
+	})
+	if err != nil {
+		return function.Function{}, err
+	}
+	return function.New(spec), nil
+}
+
+// discoverFunctions sets the functions listed in out, the output of the
+// describe command of the plugin pluginName, see DiscoverMultiPlugin.
+func (c *PluginConfig) discoverFunctions(pluginName, pluginPath string, out []byte) error {
+	var desc functionsDescription
+	if err := json.Unmarshal(out, &desc); err != nil {
+		return err
+	}
+	if len(desc.Functions) == 0 {
+		return nil
+	}
+	if c.Functions == nil {
+		c.Functions = map[string]function.Function{}
+	}
+	var names []string
+	for name, fnDesc := range desc.Functions {
+		fn, err := pluginFunction(pluginPath, name, fnDesc)
+		if err != nil {
+			return fmt.Errorf("function %s of the %s plugin: %s", name, pluginName, err)
+		}
+		key := functionName(pluginName, name)
+		c.Functions[key] = fn
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	log.Printf("[INFO] found external %v functions from %s plugin", names, pluginName)
+	return nil
+}
+
+// functionName returns the name of the function name of the plugin
+// pluginName in templates, like amazon_ami_name for the ami_name function of
+// the amazon plugin. Dashes would read as subtractions in expressions, so
+// they are replaced by underscores.
+func functionName(pluginName, name string) string {
+	pluginName = strings.ReplaceAll(pluginName, "-", "_")
+	if name == pluginsdk.DEFAULT_NAME {
+		return pluginName
+	}
+	return pluginName + "_" + name
+}
+
+// ServeFunctions runs the function commands of a plugin binary, for plugins
+// contributing HCL functions, and tells whether args is such a command:
+//
+//   - describe: writes the description of set, along with the description of
+//     funcs, to stdout.
+//   - call-function NAME: calls the function NAME of funcs with the arguments
+//     read from stdin, and writes its result to stdout.
+//
+// The other commands are left to set, so a plugin calls it before set.Run:
+//
+//	if ok, err := packer.ServeFunctions(os.Args[1:], pps, funcs, descriptions); ok {
+//		...
+//	}
+func ServeFunctions(args []string, set *pluginsdk.Set, funcs map[string]function.Function, descriptions map[string]string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case DescribeCommand:
+		return true, describeFunctions(os.Stdout, set, funcs, descriptions)
+	case CallFunctionCommand:
+		if len(args) != 2 {
+			return true, fmt.Errorf("usage: %s NAME", CallFunctionCommand)
+		}
+		return true, callFunction(os.Stdin, os.Stdout, funcs, args[1])
+	}
+	return false, nil
+}
+
+// describeFunctions writes the description of set to w, with the
+// description of funcs in its "functions" field.
+func describeFunctions(w io.Writer, set *pluginsdk.Set, funcs map[string]function.Function, descriptions map[string]string) error {
+	// The description of the set is only written to stdout by the SDK.
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdout := os.Stdout
+	os.Stdout = pw
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	err = set.RunCommand(DescribeCommand)
+	os.Stdout = stdout
+	pw.Close()
+	out := <-done
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	desc := map[string]interface{}{}
+	if err := json.Unmarshal(out, &desc); err != nil {
+		return err
+	}
+	fnDescs := map[string]FunctionDescription{}
+	for name, fn := range funcs {
+		fnDesc, err := DescribeFunction(fn, descriptions[name])
+		if err != nil {
+			return fmt.Errorf("function %s: %s", name, err)
+		}
+		fnDescs[name] = fnDesc
+	}
+	desc["functions"] = fnDescs
+	return json.NewEncoder(w).Encode(desc)
+}
+
+// callFunction calls the function name of funcs with the arguments read from
+// r, and writes its result, or error, to w.
+func callFunction(r io.Reader, w io.Writer, funcs map[string]function.Function, name string) error {
+	result := func() (cty.Value, error) {
+		fn, ok := funcs[name]
+		if !ok {
+			return cty.NilVal, fmt.Errorf("unknown function %q", name)
+		}
+		var call functionCall
+		if err := json.NewDecoder(r).Decode(&call); err != nil {
+			return cty.NilVal, fmt.Errorf("invalid call: %s", err)
+		}
+		args := make([]cty.Value, 0, len(call.Args))
+		for i, arg := range call.Args {
+			val, err := ctyjson.Unmarshal(arg, cty.DynamicPseudoType)
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("invalid argument %d: %s", i, err)
+			}
+			args = append(args, val)
+		}
+		return fn.Call(args)
+	}
+	var res functionResult
+	val, err := result()
+	if err == nil {
+		res.Result, err = ctyjson.Marshal(val, cty.DynamicPseudoType)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return json.NewEncoder(w).Encode(res)
+}
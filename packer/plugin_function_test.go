@@ -0,0 +1,149 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	pluginsdk "github.com/hashicorp/packer-plugin-sdk/plugin"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+var (
+	mockFunctionPlugins = map[string]pluginsdk.Set{
+		"cloud-names": pluginsdk.Set{
+			Builders: map[string]packersdk.Builder{
+				"image": nil,
+			},
+		},
+	}
+
+	mockFunctions = map[string]map[string]function.Function{
+		"cloud-names": {
+			"valid": function.New(&function.Spec{
+				Params: []function.Parameter{{Name: "name", Type: cty.String}},
+				Type:   function.StaticReturnType(cty.Bool),
+				Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+					return cty.BoolVal(!strings.Contains(args[0].AsString(), " ")), nil
+				},
+			}),
+			pluginsdk.DEFAULT_NAME: stdlib.JoinFunc,
+		},
+	}
+)
+
+func Test_multiplugin_functions(t *testing.T) {
+	createMockPlugins(t, mockFunctionPlugins)
+	pluginDir := os.Getenv("PACKER_PLUGIN_PATH")
+	defer os.RemoveAll(pluginDir)
+
+	c := PluginConfig{}
+	if err := c.Discover(); err != nil {
+		t.Fatalf("error discovering plugins; %s", err.Error())
+	}
+
+	if !c.Builders.Has("cloud-names-image") {
+		t.Fatalf("expected to find builder %q", "cloud-names-image")
+	}
+
+	valid, ok := c.Functions["cloud_names_valid"]
+	if !ok {
+		t.Fatalf("expected to find function %q; functions are %v", "cloud_names_valid", c.Functions)
+	}
+	got, err := valid.Call([]cty.Value{cty.StringVal("my image")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.True() {
+		t.Errorf("expected %q to be an invalid name", "my image")
+	}
+
+	join, ok := c.Functions["cloud_names"]
+	if !ok {
+		t.Fatalf("expected to find function %q; functions are %v", "cloud_names", c.Functions)
+	}
+	got, err = join.Call([]cty.Value{
+		cty.StringVal("-"),
+		cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !got.RawEquals(cty.StringVal("a-b")) {
+		t.Errorf("unexpected result %#v", got)
+	}
+
+	if _, err := valid.Call([]cty.Value{cty.NullVal(cty.String)}); err == nil {
+		t.Errorf("expected a null name to be rejected")
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	funcs := map[string]function.Function{"upper": stdlib.UpperFunc}
+
+	tests := []struct {
+		name       string
+		function   string
+		input      string
+		wantResult string
+		wantError  string
+	}{
+		{"valid call", "upper", `{"args":[{"value":"abc","type":"string"}]}`,
+			`{"value":"ABC","type":"string"}`, ""},
+		{"unknown function", "lower", `{"args":[]}`, "", `unknown function "lower"`},
+		{"invalid arguments", "upper", `{"args":[{"value":1,"type":"number"}, {"value":1,"type":"number"}]}`,
+			"", "wrong number of arguments (1 required; 2 given)"},
+		{"invalid call", "upper", `{`, "", "invalid call: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := callFunction(strings.NewReader(tt.input), &out, funcs, tt.function); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var res functionResult
+			if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+				t.Fatalf("invalid result %q: %s", out.String(), err)
+			}
+			if string(res.Result) != tt.wantResult {
+				t.Errorf("unexpected result %s, expected %s", res.Result, tt.wantResult)
+			}
+			if res.Error != tt.wantError {
+				t.Errorf("unexpected error %q, expected %q", res.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestDescribeFunction(t *testing.T) {
+	desc, err := DescribeFunction(stdlib.JoinFunc, "joins lists of strings")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := json.Marshal(desc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `{"description":"joins lists of strings","params":[{"name":"separator","type":"string"}],` +
+		`"variadic_param":{"name":"lists","type":["list","string"]},"return_type":"string"}`
+	if string(b) != expected {
+		t.Errorf("unexpected description %s, expected %s", b, expected)
+	}
+
+	spec, err := desc.spec(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(spec.Params) != 1 || !spec.Params[0].Type.Equals(cty.String) {
+		t.Errorf("unexpected params %#v", spec.Params)
+	}
+	if spec.VarParam == nil || !spec.VarParam.Type.Equals(cty.List(cty.String)) {
+		t.Errorf("unexpected variadic param %#v", spec.VarParam)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin freebsd linux netbsd openbsd solaris
+
+package packer
+
+import "syscall"
+
+// processGroupAttr starts a plugin process in a process group of its own, out
+// of the reach of the signals of the terminal, like SIGTSTP on Ctrl-Z.
+func processGroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
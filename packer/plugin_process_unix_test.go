@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin freebsd linux netbsd openbsd solaris
+
+package packer
+
+import "testing"
+
+func TestPluginConfig_Client_processGroup(t *testing.T) {
+	c := &PluginConfig{}
+	if attr := c.Client("packer-plugin-test").config.Cmd.SysProcAttr; attr != nil {
+		t.Errorf("expected the plugin to run in the process group of Packer, got %+v", attr)
+	}
+
+	c.ProcessGroup = true
+	if attr := c.Client("packer-plugin-test").config.Cmd.SysProcAttr; attr == nil || !attr.Setpgid {
+		t.Errorf("expected the plugin to run in a process group of its own, got %+v", attr)
+	}
+}
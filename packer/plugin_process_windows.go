@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package packer
+
+import "syscall"
+
+// processGroupAttr does nothing, Windows has no process groups receiving the
+// signals of the terminal.
+func processGroupAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,201 @@
+package packer
+
+import (
+	"fmt"
+	"reflect"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	pluginsdk "github.com/hashicorp/packer-plugin-sdk/plugin"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// registeredComponents are the in-process components registered on a
+// PluginConfig. They are kept aside so that they take precedence over the
+// plugins found by Discover, whenever it is called.
+type registeredComponents struct {
+	builders       MapOfBuilder
+	provisioners   MapOfProvisioner
+	postProcessors MapOfPostProcessor
+	dataSources    MapOfDatasource
+	functions      map[string]function.Function
+}
+
+func (c *PluginConfig) registered() *registeredComponents {
+	if c.registeredComponents == nil {
+		c.registeredComponents = &registeredComponents{
+			builders:       MapOfBuilder{},
+			provisioners:   MapOfProvisioner{},
+			postProcessors: MapOfPostProcessor{},
+			dataSources:    MapOfDatasource{},
+			functions:      map[string]function.Function{},
+		}
+	}
+	return c.registeredComponents
+}
+
+// RegisterBuilder makes the in-process builder started by starter available
+// as name, for programs embedding Packer, like test rigs, to use their own
+// builders without building plugin binaries. starter is called for each build
+// of the builder. Registered components take precedence over the plugins found
+// by Discover. Registering a name twice fails.
+func (c *PluginConfig) RegisterBuilder(name string, starter func() (packersdk.Builder, error)) error {
+	r := c.registered()
+	if r.builders.Has(name) {
+		return fmt.Errorf("registering duplicate %s builder", name)
+	}
+	r.builders.Set(name, starter)
+	if c.Builders == nil {
+		c.Builders = MapOfBuilder{}
+	}
+	c.Builders.Set(name, starter)
+	return nil
+}
+
+// RegisterProvisioner makes the in-process provisioner started by starter
+// available as name, see RegisterBuilder.
+func (c *PluginConfig) RegisterProvisioner(name string, starter func() (packersdk.Provisioner, error)) error {
+	r := c.registered()
+	if r.provisioners.Has(name) {
+		return fmt.Errorf("registering duplicate %s provisioner", name)
+	}
+	r.provisioners.Set(name, starter)
+	if c.Provisioners == nil {
+		c.Provisioners = MapOfProvisioner{}
+	}
+	c.Provisioners.Set(name, starter)
+	return nil
+}
+
+// RegisterPostProcessor makes the in-process post-processor started by
+// starter available as name, see RegisterBuilder.
+func (c *PluginConfig) RegisterPostProcessor(name string, starter func() (packersdk.PostProcessor, error)) error {
+	r := c.registered()
+	if r.postProcessors.Has(name) {
+		return fmt.Errorf("registering duplicate %s post-processor", name)
+	}
+	r.postProcessors.Set(name, starter)
+	if c.PostProcessors == nil {
+		c.PostProcessors = MapOfPostProcessor{}
+	}
+	c.PostProcessors.Set(name, starter)
+	return nil
+}
+
+// RegisterDatasource makes the in-process data source started by starter
+// available as name, see RegisterBuilder.
+func (c *PluginConfig) RegisterDatasource(name string, starter func() (packersdk.Datasource, error)) error {
+	r := c.registered()
+	if r.dataSources.Has(name) {
+		return fmt.Errorf("registering duplicate %s data source", name)
+	}
+	r.dataSources.Set(name, starter)
+	if c.DataSources == nil {
+		c.DataSources = MapOfDatasource{}
+	}
+	c.DataSources.Set(name, starter)
+	return nil
+}
+
+// RegisterFunction makes the in-process HCL function fn available to HCL2
+// templates as name, see RegisterBuilder.
+func (c *PluginConfig) RegisterFunction(name string, fn function.Function) error {
+	r := c.registered()
+	if _, exists := r.functions[name]; exists {
+		return fmt.Errorf("registering duplicate %s function", name)
+	}
+	r.functions[name] = fn
+	if c.Functions == nil {
+		c.Functions = map[string]function.Function{}
+	}
+	c.Functions[name] = fn
+	return nil
+}
+
+// RegisterPluginSet registers in-process the components of the plugin set of
+// a multi-component plugin, named as if the plugin binary pluginName was
+// discovered, see DiscoverMultiPlugin. This allows using a plugin from its Go
+// module without building it.
+//
+// The components of a set are values, shared by the processes of the plugin
+// binary: each start of a component returns a new zero value of its type, like
+// a new plugin process would.
+func (c *PluginConfig) RegisterPluginSet(pluginName string, set *pluginsdk.Set) error {
+	key := func(name string) string {
+		if name == pluginsdk.DEFAULT_NAME {
+			return pluginName
+		}
+		return pluginName + "-" + name
+	}
+	for name, builder := range set.Builders {
+		builder := builder
+		err := c.RegisterBuilder(key(name), func() (packersdk.Builder, error) {
+			return newComponent(builder).(packersdk.Builder), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for name, provisioner := range set.Provisioners {
+		provisioner := provisioner
+		err := c.RegisterProvisioner(key(name), func() (packersdk.Provisioner, error) {
+			return newComponent(provisioner).(packersdk.Provisioner), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for name, postProcessor := range set.PostProcessors {
+		postProcessor := postProcessor
+		err := c.RegisterPostProcessor(key(name), func() (packersdk.PostProcessor, error) {
+			return newComponent(postProcessor).(packersdk.PostProcessor), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for name, datasource := range set.Datasources {
+		datasource := datasource
+		err := c.RegisterDatasource(key(name), func() (packersdk.Datasource, error) {
+			return newComponent(datasource).(packersdk.Datasource), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newComponent returns a new zero value of the type component points to, or
+// component itself when it is not a pointer.
+func newComponent(component interface{}) interface{} {
+	v := reflect.ValueOf(component)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return component
+	}
+	return reflect.New(v.Elem().Type()).Interface()
+}
+
+// applyRegistered sets the registered components again, over the discovered
+// ones.
+func (c *PluginConfig) applyRegistered() {
+	r := c.registeredComponents
+	if r == nil {
+		return
+	}
+	for name, starter := range r.builders {
+		c.Builders.Set(name, starter)
+		delete(c.builderPlugins, name)
+	}
+	for name, starter := range r.provisioners {
+		c.Provisioners.Set(name, starter)
+	}
+	for name, starter := range r.postProcessors {
+		c.PostProcessors.Set(name, starter)
+	}
+	for name, starter := range r.dataSources {
+		c.DataSources.Set(name, starter)
+	}
+	for name, fn := range r.functions {
+		c.Functions[name] = fn
+	}
+}
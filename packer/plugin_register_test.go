@@ -0,0 +1,74 @@
+package packer
+
+import (
+	"os"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	pluginsdk "github.com/hashicorp/packer-plugin-sdk/plugin"
+)
+
+func TestPluginConfig_RegisterBuilder(t *testing.T) {
+	createMockPlugins(t, mockPlugins)
+	pluginDir := os.Getenv("PACKER_PLUGIN_PATH")
+	defer os.RemoveAll(pluginDir)
+
+	builder := &packersdk.MockBuilder{}
+	c := PluginConfig{}
+	err := c.RegisterBuilder("bird-feather", func() (packersdk.Builder, error) { return builder, nil })
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if err := c.RegisterBuilder("bird-feather", nil); err == nil {
+		t.Fatal("expected registering a builder twice to fail")
+	}
+
+	if err := c.Discover(); err != nil {
+		t.Fatalf("error discovering plugins; %s", err)
+	}
+	if !c.Builders.Has("bird-guacamole") {
+		t.Error("expected the plugin builders to be discovered")
+	}
+	got, err := c.Builders.Start("bird-feather")
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if got != builder {
+		t.Errorf("expected the registered builder to take precedence over the plugin one, got %#v", got)
+	}
+}
+
+func TestPluginConfig_RegisterPluginSet(t *testing.T) {
+	set := pluginsdk.NewSet()
+	set.RegisterBuilder(pluginsdk.DEFAULT_NAME, &packersdk.MockBuilder{})
+	set.RegisterProvisioner("shell", &packersdk.MockProvisioner{})
+	set.RegisterPostProcessor("upload", &MockPostProcessor{})
+
+	c := PluginConfig{}
+	if err := c.RegisterPluginSet("happycloud", set); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if !c.Builders.Has("happycloud") {
+		t.Error("expected the default builder to be registered as happycloud")
+	}
+	if !c.Provisioners.Has("happycloud-shell") {
+		t.Error("expected the happycloud-shell provisioner to be registered")
+	}
+	if !c.PostProcessors.Has("happycloud-upload") {
+		t.Error("expected the happycloud-upload post-processor to be registered")
+	}
+
+	// Each start returns a builder of its own.
+	b1, _ := c.Builders.Start("happycloud")
+	b2, _ := c.Builders.Start("happycloud")
+	if _, ok := b1.(*packersdk.MockBuilder); !ok {
+		t.Fatalf("expected a MockBuilder, got %#v", b1)
+	}
+	if b1 == b2 {
+		t.Error("expected each start to return a new builder")
+	}
+
+	if err := c.RegisterPluginSet("happycloud", set); err == nil {
+		t.Error("expected registering the plugin set twice to fail")
+	}
+}
@@ -0,0 +1,284 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+)
+
+// DefaultPostProcessLedgerFilename is the name of the post-process ledger of
+// a template, next to the template.
+const DefaultPostProcessLedgerFilename = "packer.postprocess.json"
+
+// recordedArtifactStates are the states of the builder artifacts recorded
+// along with them, the ones post-processors usually read.
+var recordedArtifactStates = []string{"generated_data", registryimage.ArtifactStateURI}
+
+// RecordedArtifact is the artifact of a builder recorded in a
+// PostProcessLedger, for its post-processors to run again in a later run. It
+// can't be destroyed by Packer, the builder that produced it is gone.
+type RecordedArtifact struct {
+	BuilderID   string                 `json:"builder_id"`
+	ID          string                 `json:"id"`
+	Files       []string               `json:"files,omitempty"`
+	Description string                 `json:"description"`
+	States      map[string]interface{} `json:"states,omitempty"`
+}
+
+// recordArtifact returns the record of a.
+func recordArtifact(a packersdk.Artifact) *RecordedArtifact {
+	rec := &RecordedArtifact{
+		BuilderID:   a.BuilderId(),
+		ID:          a.Id(),
+		Files:       a.Files(),
+		Description: a.String(),
+	}
+	for _, name := range recordedArtifactStates {
+		state := a.State(name)
+		if state == nil {
+			continue
+		}
+		// States are recorded as JSON, the ones that can't be are left out.
+		b, err := json.Marshal(jsonState(state))
+		if err != nil {
+			log.Printf("[WARN] not recording the %s state of artifact %s: %s", name, rec.ID, err)
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			continue
+		}
+		if rec.States == nil {
+			rec.States = map[string]interface{}{}
+		}
+		rec.States[name] = v
+	}
+	return rec
+}
+
+// jsonState returns state with the maps keyed by interface{}, like the ones
+// of the artifacts of plugins, keyed by strings instead.
+func jsonState(state interface{}) interface{} {
+	switch s := state.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(s))
+		for k, v := range s {
+			m[fmt.Sprint(k)] = jsonState(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(s))
+		for k, v := range s {
+			m[k] = jsonState(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(s))
+		for i, v := range s {
+			l[i] = jsonState(v)
+		}
+		return l
+	}
+	return state
+}
+
+// Artifact returns the recorded artifact as a packersdk.Artifact.
+func (a *RecordedArtifact) Artifact() packersdk.Artifact {
+	return &recordedArtifact{a}
+}
+
+type recordedArtifact struct {
+	*RecordedArtifact
+}
+
+func (a *recordedArtifact) BuilderId() string { return a.BuilderID }
+
+func (a *recordedArtifact) Id() string { return a.ID }
+
+func (a *recordedArtifact) Files() []string { return a.RecordedArtifact.Files }
+
+func (a *recordedArtifact) String() string { return a.Description }
+
+func (a *recordedArtifact) State(name string) interface{} { return a.States[name] }
+
+func (a *recordedArtifact) Destroy() error {
+	log.Printf("[INFO] not destroying the recorded artifact %s, it was built by a previous run", a.ID)
+	return nil
+}
+
+// FailedPostProcessors is the record of a build whose post-processor chains
+// failed while its builder artifact was kept.
+type FailedPostProcessors struct {
+	Artifact *RecordedArtifact `json:"artifact"`
+	// Chains are the indexes of the failed chains, in the post-processors
+	// of the build.
+	Chains     []int     `json:"chains"`
+	Error      string    `json:"error"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// PostProcessLedger records, by build, the post-processor chains of a
+// template that failed and the artifact of the builder they ran against, for
+// `packer postprocess -retry` to run them again without building the artifact
+// again. It is a JSON file, only written when there is something to record.
+type PostProcessLedger struct {
+	Path string
+
+	l sync.Mutex
+}
+
+// Get returns the failed post-processors of the named build, nil when none
+// is recorded.
+func (l *PostProcessLedger) Get(build string) (*FailedPostProcessors, error) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	builds, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	return builds[build], nil
+}
+
+// Builds returns the names of the builds with failed post-processors, sorted.
+func (l *PostProcessLedger) Builds() ([]string, error) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	builds, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(builds))
+	for name := range builds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Record records the failed post-processors of the named build, replacing
+// the ones recorded before.
+func (l *PostProcessLedger) Record(build string, failed *FailedPostProcessors) error {
+	return l.update(func(builds map[string]*FailedPostProcessors) {
+		builds[build] = failed
+	})
+}
+
+// Forget forgets the failed post-processors of the named build, once they
+// succeeded or the build ran again.
+func (l *PostProcessLedger) Forget(build string) error {
+	return l.update(func(builds map[string]*FailedPostProcessors) {
+		delete(builds, build)
+	})
+}
+
+// read returns the records of the ledger, none when it does not exist. The
+// ledger must be locked.
+func (l *PostProcessLedger) read() (map[string]*FailedPostProcessors, error) {
+	b, err := ioutil.ReadFile(l.Path)
+	if os.IsNotExist(err) {
+		return map[string]*FailedPostProcessors{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	builds := map[string]*FailedPostProcessors{}
+	if err := json.Unmarshal(b, &builds); err != nil {
+		return nil, fmt.Errorf("failed to read the post-process ledger %s: %s", l.Path, err)
+	}
+	return builds, nil
+}
+
+// update replaces the records of the ledger with the ones updated by fn. The
+// ledger is removed once it records nothing.
+func (l *PostProcessLedger) update(fn func(map[string]*FailedPostProcessors)) error {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	builds, err := l.read()
+	if err != nil {
+		return err
+	}
+	fn(builds)
+	if len(builds) == 0 {
+		if err := os.Remove(l.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(builds, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written aside then renamed, so that the ledger is never left truncated.
+	tmp := l.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.Path)
+}
+
+// recordFailedPostProcessors records the failed chains of the build in its
+// PostProcessLedger, along with builderArtifact.
+func (b *CoreBuild) recordFailedPostProcessors(ui packersdk.Ui, builderArtifact packersdk.Artifact, chains []int, errs []error) {
+	err := b.PostProcessLedger.Record(b.Name(), &FailedPostProcessors{
+		Artifact:   recordArtifact(builderArtifact),
+		Chains:     chains,
+		Error:      (&packersdk.MultiError{Errors: errs}).Error(),
+		RecordedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		ui.Error(fmt.Sprintf("Failed to record the failed post-processors: %s", err))
+		return
+	}
+	ui.Say("The builder artifact is kept, run `packer postprocess -retry` to run the failed post-processors again.")
+}
+
+// RetryPostProcessors runs the failed post-processor chains recorded for the
+// build again, against the recorded builder artifact. Once they all
+// succeeded the build is forgotten by the ledger, otherwise the chains still
+// failing are recorded. Prepare must be called first.
+func (b *CoreBuild) RetryPostProcessors(ctx context.Context, originalUi packersdk.Ui, failed *FailedPostProcessors) ([]packersdk.Artifact, error) {
+	if !b.prepareCalled {
+		panic("Prepare must be called first")
+	}
+	only := map[int]bool{}
+	for _, chain := range failed.Chains {
+		if chain < 0 || chain >= len(b.PostProcessors) {
+			return nil, fmt.Errorf("the post-processors of the build changed since they failed, build it again")
+		}
+		only[chain] = true
+	}
+
+	ui := &TargetedUI{Target: b.Name(), Ui: originalUi}
+	ui.Say(fmt.Sprintf("Running the failed post-processors against the artifact recorded at %s: %s",
+		failed.RecordedAt.Format(time.RFC3339), failed.Artifact.Description))
+	artifacts, _, failedChains, errs := b.runPostProcessors(ctx, originalUi, ui, failed.Artifact.Artifact(), only)
+
+	var err error
+	if len(failedChains) > 0 {
+		err = b.PostProcessLedger.Record(b.Name(), &FailedPostProcessors{
+			Artifact:   failed.Artifact,
+			Chains:     failedChains,
+			Error:      (&packersdk.MultiError{Errors: errs}).Error(),
+			RecordedAt: failed.RecordedAt,
+		})
+	} else {
+		err = b.PostProcessLedger.Forget(b.Name())
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to update the post-process ledger: %s", err))
+	}
+	if len(errs) > 0 {
+		return artifacts, &packersdk.MultiError{Errors: errs}
+	}
+	return artifacts, nil
+}
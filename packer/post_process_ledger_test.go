@@ -0,0 +1,54 @@
+package packer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestPostProcessLedger(t *testing.T) {
+	ledger := &PostProcessLedger{Path: filepath.Join(t.TempDir(), DefaultPostProcessLedgerFilename)}
+	artifact := &packersdk.MockArtifact{
+		BuilderIdValue: "packer.file",
+		IdValue:        "chocolate",
+		FilesValue:     []string{"chocolate.txt"},
+		StringValue:    "Stored file: chocolate.txt",
+		StateValues: map[string]interface{}{
+			"generated_data": map[interface{}]interface{}{"Host": "10.0.0.1"},
+		},
+	}
+	failed := &FailedPostProcessors{Artifact: recordArtifact(artifact), Chains: []int{1}, Error: "upload failed"}
+	if err := ledger.Record("file.chocolate", failed); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ledger.Get("file.chocolate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Chains, []int{1}) {
+		t.Errorf("expected chain 1 to be recorded, got %v", got.Chains)
+	}
+	replayed := got.Artifact.Artifact()
+	if replayed.BuilderId() != "packer.file" || replayed.Id() != "chocolate" ||
+		!reflect.DeepEqual(replayed.Files(), []string{"chocolate.txt"}) {
+		t.Errorf("expected the recorded artifact to match the builder artifact, got %#v", got.Artifact)
+	}
+	wantData := map[string]interface{}{"Host": "10.0.0.1"}
+	if data := replayed.State("generated_data"); !reflect.DeepEqual(data, wantData) {
+		t.Errorf("expected the generated data %v to be recorded, got %v", wantData, data)
+	}
+
+	if err := ledger.Forget("file.chocolate"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ledger.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the empty ledger to be removed, got %v", err)
+	}
+	if names, err := ledger.Builds(); err != nil || len(names) != 0 {
+		t.Errorf("expected no build to be recorded, got %v, %v", names, err)
+	}
+}
@@ -0,0 +1,93 @@
+package packer
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ProgressMachineType is the type of the machine-readable events reporting the
+// progress of a step of a build, like downloading an ISO or waiting for a
+// snapshot. Its data are the step and its progress, as a percentage:
+//
+//	progress,<step>,<percent>
+//
+// The events go through the UI of the build, builders running as plugins can
+// send them with Machine. See ReportProgress.
+const ProgressMachineType = "progress"
+
+// ReportProgress reports to the UI of a build the progress of one of its steps,
+// as a percentage. The terminal renders it as a progress bar, and the
+// machine-readable and JSON outputs as ProgressMachineType events.
+func ReportProgress(ui packersdk.Ui, step string, percent float64) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	ui.Machine(ProgressMachineType, step, strconv.FormatFloat(percent, 'f', 1, 64))
+}
+
+// ProgressReader returns a reader of r reporting to ui the progress of step as
+// it is read, size being the total number of bytes to read. It is reported
+// every percent.
+func ProgressReader(ui packersdk.Ui, step string, size int64, r io.Reader) io.Reader {
+	return &progressReader{ui: ui, step: step, size: size, r: r, reported: -1}
+}
+
+type progressReader struct {
+	ui       packersdk.Ui
+	step     string
+	size     int64
+	r        io.Reader
+	read     int64
+	reported int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.size > 0 {
+		if percent := p.read * 100 / p.size; percent != p.reported {
+			p.reported = percent
+			ReportProgress(p.ui, p.step, float64(percent))
+		}
+	}
+	return n, err
+}
+
+// StepProgressTracker is implemented by the progress trackers rendering the
+// progress of the steps of builds, see ProgressUi.
+type StepProgressTracker interface {
+	// TrackStepProgress updates the progress of step of build, as a
+	// percentage.
+	TrackStepProgress(build, step string, percent float64)
+	// FinishStepProgress stops tracking the steps of build, once it is done.
+	FinishStepProgress(build string)
+}
+
+// parseProgress returns the build, step and progress of a machine-readable
+// event, when it is a ProgressMachineType event. category is the type of the
+// event, prefixed with the build by TargetedUI.
+func parseProgress(category string, args []string) (build, step string, percent float64, ok bool) {
+	build, category = splitTarget(category)
+	if category != ProgressMachineType || len(args) != 2 {
+		return "", "", 0, false
+	}
+	percent, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return "", "", 0, false
+	}
+	return build, args[0], percent, true
+}
+
+// splitTarget splits the type of a machine-readable event from the target it is
+// prefixed with by TargetedUI, if any.
+func splitTarget(category string) (target, t string) {
+	if commaIdx := strings.Index(category, ","); commaIdx > -1 {
+		return category[:commaIdx], category[commaIdx+1:]
+	}
+	return "", category
+}
@@ -0,0 +1,102 @@
+package packer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// stepProgressRecorder records the progress it is given to track.
+type stepProgressRecorder struct {
+	events []string
+}
+
+func (r *stepProgressRecorder) TrackStepProgress(build, step string, percent float64) {
+	r.events = append(r.events, fmt.Sprintf("%s: %s %g%%", build, step, percent))
+}
+
+func (r *stepProgressRecorder) FinishStepProgress(build string) {
+	r.events = append(r.events, fmt.Sprintf("%s: done", build))
+}
+
+// machineLines returns the machine-readable lines written by a
+// MachineReadableUi to buf, without their timestamp.
+func machineLines(buf *bytes.Buffer) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		lines = append(lines, strings.SplitN(line, ",", 2)[1])
+	}
+	return lines
+}
+
+func TestReportProgress(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &TargetedUI{Target: "vbox.ubuntu", Ui: &MachineReadableUi{Writer: buf}}
+
+	ReportProgress(ui, "download", 42.25)
+	ReportProgress(ui, "download", 150)
+	ReportProgress(ui, "snapshot", -1)
+
+	expected := []string{
+		"vbox.ubuntu,progress,download,42.2",
+		"vbox.ubuntu,progress,download,100.0",
+		"vbox.ubuntu,progress,snapshot,0.0",
+	}
+	if diff := cmp.Diff(expected, machineLines(buf)); diff != "" {
+		t.Errorf("unexpected machine-readable output: %s", diff)
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &MachineReadableUi{Writer: buf}
+
+	r := ProgressReader(ui, "upload", 200, bytes.NewReader(make([]byte, 200)))
+	chunk := make([]byte, 50)
+	for {
+		if _, err := r.Read(chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	expected := []string{
+		",progress,upload,25.0",
+		",progress,upload,50.0",
+		",progress,upload,75.0",
+		",progress,upload,100.0",
+	}
+	if diff := cmp.Diff(expected, machineLines(buf)); diff != "" {
+		t.Errorf("expected the progress to be reported once per percent: %s", diff)
+	}
+}
+
+func TestProgressUi(t *testing.T) {
+	buf := new(bytes.Buffer)
+	recorder := &stepProgressRecorder{}
+	ui := &ProgressUi{Ui: &MachineReadableUi{Writer: buf}, PB: recorder}
+	targeted := &TargetedUI{Target: "vbox.ubuntu", Ui: ui}
+
+	ReportProgress(targeted, "download", 10)
+	targeted.Machine("artifact", "0", "id", "image")
+	ReportProgress(targeted, "download", 100)
+	targeted.Machine("progress", "not a percentage", "unknown")
+	targeted.Machine("build", "finished")
+
+	expected := []string{
+		"vbox.ubuntu: download 10%",
+		"vbox.ubuntu: download 100%",
+		"vbox.ubuntu: done",
+	}
+	if diff := cmp.Diff(expected, recorder.events); diff != "" {
+		t.Errorf("unexpected progress tracked: %s", diff)
+	}
+	if lines := machineLines(buf); len(lines) != 5 {
+		t.Errorf("expected the machine-readable events to be passed through, got %v", lines)
+	}
+}
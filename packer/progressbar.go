@@ -22,8 +22,16 @@ type UiProgressBar struct {
 	lock sync.Mutex
 	pool *pb.Pool
 	pbs  int
+	// steps are the bars of the steps of the builds, see TrackStepProgress.
+	steps map[stepProgress]*pb.ProgressBar
 }
 
+type stepProgress struct {
+	build, step string
+}
+
+var _ StepProgressTracker = new(UiProgressBar)
+
 func (p *UiProgressBar) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) io.ReadCloser {
 	if p == nil {
 		return stream
@@ -35,38 +43,99 @@ func (p *UiProgressBar) TrackProgress(src string, currentSize, totalSize int64,
 	newPb.Set64(currentSize)
 	ProgressBarConfig(newPb, filepath.Base(src))
 
-	if p.pool == nil {
-		pool := pb.NewPool()
-		err := pool.Start()
-		if err != nil {
-			// here, we probably cannot lock
-			// stdout, so let's just return
-			// stream to avoid any error.
-			return stream
-		}
-		p.pool = pool
+	if !p.add(newPb) {
+		// here, we probably cannot lock
+		// stdout, so let's just return
+		// stream to avoid any error.
+		return stream
 	}
-	p.pool.Add(newPb)
 	reader := newPb.NewProxyReader(stream)
 
-	p.pbs++
 	return &readCloser{
 		Reader: reader,
 		close: func() error {
 			p.lock.Lock()
 			defer p.lock.Unlock()
 
-			newPb.Finish()
-			p.pbs--
-			if p.pbs <= 0 {
-				p.pool.Stop()
-				p.pool = nil
-			}
+			p.finish(newPb)
 			return nil
 		},
 	}
 }
 
+// TrackStepProgress renders the progress of step of build as a bar, until it
+// reaches 100% or the build is done.
+func (p *UiProgressBar) TrackStepProgress(build, step string, percent float64) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := stepProgress{build: build, step: step}
+	bar, ok := p.steps[key]
+	if !ok {
+		bar = pb.New(100)
+		bar.ShowCounters = false
+		bar.Prefix(build + ": " + step)
+		if !p.add(bar) {
+			return
+		}
+		if p.steps == nil {
+			p.steps = make(map[stepProgress]*pb.ProgressBar)
+		}
+		p.steps[key] = bar
+	}
+	bar.Set(int(percent))
+	if percent >= 100 {
+		delete(p.steps, key)
+		p.finish(bar)
+	}
+}
+
+// FinishStepProgress stops rendering the steps of build.
+func (p *UiProgressBar) FinishStepProgress(build string) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for key, bar := range p.steps {
+		if key.build == build {
+			delete(p.steps, key)
+			p.finish(bar)
+		}
+	}
+}
+
+// add renders bar, starting the pool of bars if needed. It returns false when
+// the pool cannot be started. p.lock must be held.
+func (p *UiProgressBar) add(bar *pb.ProgressBar) bool {
+	if p.pool == nil {
+		pool := pb.NewPool()
+		err := pool.Start()
+		if err != nil {
+			return false
+		}
+		p.pool = pool
+	}
+	p.pool.Add(bar)
+	p.pbs++
+	return true
+}
+
+// finish stops rendering bar, stopping the pool of bars with the last one.
+// p.lock must be held.
+func (p *UiProgressBar) finish(bar *pb.ProgressBar) {
+	bar.Finish()
+	p.pbs--
+	if p.pbs <= 0 {
+		p.pool.Stop()
+		p.pool = nil
+	}
+}
+
 type readCloser struct {
 	io.Reader
 	close func() error
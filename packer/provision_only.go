@@ -0,0 +1,168 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ProvisionOnlyBuilder runs the provisioners of a build against an existing
+// machine instead of running the builder, like packer build -provision-only:
+// it connects to Host with the communicator configured for Builder, runs the
+// provisioners and returns no artifact, so that no post-processor runs.
+type ProvisionOnlyBuilder struct {
+	// Builder is the builder of the build, it only validates its
+	// configuration.
+	Builder packersdk.Builder
+	// Host is the address of the machine to provision, optionally followed
+	// by the port of the communicator, like 10.0.0.12:2222.
+	Host string
+
+	config provisionOnlyConfig
+}
+
+type provisionOnlyConfig struct {
+	common.PackerConfig `mapstructure:",squash"`
+	Comm                communicator.Config `mapstructure:",squash"`
+}
+
+var _ packersdk.Builder = new(ProvisionOnlyBuilder)
+
+func (b *ProvisionOnlyBuilder) ConfigSpec() hcldec.ObjectSpec { return b.Builder.ConfigSpec() }
+
+// Prepare validates the configuration of the builder, then reads the
+// communicator settings out of it.
+func (b *ProvisionOnlyBuilder) Prepare(raws ...interface{}) ([]string, []string, error) {
+	generatedVars, warnings, err := b.Builder.Prepare(raws...)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	commRaws := make([]interface{}, 0, len(raws))
+	for _, raw := range raws {
+		raw, err := communicatorSettings(raw)
+		if err != nil {
+			return nil, warnings, err
+		}
+		commRaws = append(commRaws, raw)
+	}
+	err = config.Decode(&b.config, &config.DecodeOpts{
+		Interpolate:       true,
+		InterpolateFilter: &interpolate.RenderFilter{},
+	}, commRaws...)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	host, port := b.Host, ""
+	if h, p, err := net.SplitHostPort(b.Host); err == nil {
+		host, port = h, p
+	}
+	if host == "" {
+		return nil, warnings, fmt.Errorf("the target host of a provision-only build can't be empty")
+	}
+	comm := &b.config.Comm
+	comm.SSHHost, comm.WinRMHost = host, host
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("invalid port in the target host %q: %s", b.Host, err)
+		}
+		comm.SSHPort, comm.WinRMPort = n, n
+	}
+
+	var errs *packersdk.MultiError
+	if es := comm.Prepare(nil); len(es) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, es...)
+	}
+	switch comm.Type {
+	case "ssh", "winrm":
+		if comm.User() == "" {
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("provision-only builds need the user of the %s communicator", comm.Type))
+		}
+	default:
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("provision-only builds connect with the ssh or winrm communicators, not %q", comm.Type))
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return nil, warnings, errs
+	}
+	return generatedVars, warnings, nil
+}
+
+// Run connects to the target host and runs the provisioners.
+func (b *ProvisionOnlyBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	ui.Say(fmt.Sprintf("Provisioning the existing machine at %s, the builder does not run", b.Host))
+
+	comm := &b.config.Comm
+	steps := []multistep.Step{
+		&communicator.StepConnect{
+			Config: comm,
+			Host: func(multistep.StateBag) (string, error) {
+				return comm.Host(), nil
+			},
+			SSHConfig: comm.SSHConfigFunc(),
+		},
+		new(commonsteps.StepProvision),
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("hook", hook)
+	state.Put("ui", ui)
+	state.Put("instance_id", b.Host)
+
+	runner := commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
+	runner.Run(ctx, state)
+
+	if rawErr, ok := state.GetOk("error"); ok {
+		return nil, rawErr.(error)
+	}
+	return nil, nil
+}
+
+// communicatorSettings returns the settings of raw, a configuration passed to
+// Prepare, read by the communicator or common to all the builders. The other
+// settings belong to the builder.
+func communicatorSettings(raw interface{}) (interface{}, error) {
+	if v, ok := raw.(cty.Value); ok {
+		if v.IsNull() || !v.IsWhollyKnown() {
+			return map[string]interface{}{}, nil
+		}
+		b, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		raw = m
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return raw, nil
+	}
+	spec := (*communicator.FlatConfig)(nil).HCL2Spec()
+	settings := map[string]interface{}{}
+	for k, v := range m {
+		if _, ok := spec[k]; ok || strings.HasPrefix(k, "packer_") {
+			settings[k] = v
+		}
+	}
+	return settings, nil
+}
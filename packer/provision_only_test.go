@@ -0,0 +1,158 @@
+package packer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestProvisionOnlyBuilder_Prepare(t *testing.T) {
+	packerConfig := map[string]interface{}{"packer_build_name": "test"}
+	cases := []struct {
+		name     string
+		host     string
+		config   interface{}
+		wantErr  bool
+		wantHost string
+		wantPort int
+	}{
+		{
+			name: "ssh",
+			host: "10.0.0.12",
+			config: map[string]interface{}{
+				"type":          "amazon-ebs",
+				"region":        "us-east-1",
+				"ssh_username":  "ubuntu",
+				"ssh_password":  "secret",
+				"ssh_host":      "ignored",
+				"instance_type": "t3.micro",
+			},
+			wantHost: "10.0.0.12",
+			wantPort: 22,
+		},
+		{
+			name: "port of the target host",
+			host: "10.0.0.12:2222",
+			config: cty.ObjectVal(map[string]cty.Value{
+				"region":       cty.StringVal("us-east-1"),
+				"ssh_username": cty.StringVal("ubuntu"),
+				"ssh_password": cty.StringVal("secret"),
+				"ssh_port":     cty.NumberIntVal(22),
+				"tags":         cty.MapValEmpty(cty.String),
+			}),
+			wantHost: "10.0.0.12",
+			wantPort: 2222,
+		},
+		{
+			name: "winrm",
+			host: "10.0.0.12",
+			config: map[string]interface{}{
+				"communicator":   "winrm",
+				"winrm_username": "Administrator",
+				"winrm_password": "secret",
+			},
+			wantHost: "10.0.0.12",
+			wantPort: 5985,
+		},
+		{
+			name: "no user",
+			host: "10.0.0.12",
+			config: map[string]interface{}{
+				"communicator": "winrm",
+			},
+			wantErr: true,
+		},
+		{
+			name: "no communicator",
+			host: "10.0.0.12",
+			config: map[string]interface{}{
+				"communicator": "none",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid port",
+			host: "10.0.0.12:ssh",
+			config: map[string]interface{}{
+				"ssh_username": "ubuntu",
+				"ssh_password": "secret",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &packersdk.MockBuilder{}
+			b := &ProvisionOnlyBuilder{Builder: mock, Host: tc.host}
+			_, _, err := b.Prepare(tc.config, packerConfig)
+			if !mock.PrepareCalled {
+				t.Fatal("the configuration of the builder was not validated")
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			comm := b.config.Comm
+			if comm.Host() != tc.wantHost || comm.Port() != tc.wantPort {
+				t.Fatalf("connecting to %s:%d, want %s:%d", comm.Host(), comm.Port(), tc.wantHost, tc.wantPort)
+			}
+			if b.config.PackerBuildName != "test" {
+				t.Fatalf("packer_build_name = %q", b.config.PackerBuildName)
+			}
+		})
+	}
+}
+
+func TestProvisionOnlyBuilder_Run_unreachable(t *testing.T) {
+	b := &ProvisionOnlyBuilder{Builder: &packersdk.MockBuilder{}, Host: "127.0.0.1:1"}
+	_, _, err := b.Prepare(map[string]interface{}{
+		"ssh_username": "ubuntu",
+		"ssh_password": "secret",
+		"ssh_timeout":  "1s",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hook := &packersdk.MockHook{}
+	artifact, err := b.Run(context.Background(), TestUi(t), &packersdk.DispatchHook{Mapping: map[string][]packersdk.Hook{
+		packersdk.HookProvision: {hook},
+	}})
+	if err == nil {
+		t.Fatal("expected the connection to fail")
+	}
+	if artifact != nil {
+		t.Fatalf("unexpected artifact %v", artifact)
+	}
+	if hook.RunCalled {
+		t.Fatal("the provisioners ran without a connection")
+	}
+}
+
+func TestCommunicatorSettings(t *testing.T) {
+	got, err := communicatorSettings(cty.ObjectVal(map[string]cty.Value{
+		"ami_name":          cty.StringVal("ubuntu"),
+		"communicator":      cty.StringVal("ssh"),
+		"ssh_username":      cty.StringVal("ubuntu"),
+		"packer_build_name": cty.StringVal("test"),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]interface{}{
+		"communicator":      "ssh",
+		"ssh_username":      "ubuntu",
+		"packer_build_name": "test",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("communicatorSettings() = %#v, want %#v", got, want)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/hako/durafmt"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
@@ -24,6 +25,73 @@ type ProvisionHook struct {
 	// The provisioners to run as part of the hook. These should already
 	// be prepared (by calling Prepare) at some earlier stage.
 	Provisioners []*HookedProvisioner
+
+	// Transcript, when set, records the commands run by the provisioners.
+	Transcript *Transcript
+
+	// Labels, when set, receives the labels sent by the provisioners with
+	// ProvisionerLabelsMachineType messages.
+	Labels func(map[string]string)
+
+	// Stages, when set, groups the provisioners in stages, whose duration is
+	// reported. With incremental builds, the machine is snapshotted after each
+	// stage, and the stages already restored from a snapshot are skipped.
+	Stages *StagePlan
+
+	// RunUUID, when set, replaces the PackerRunUUID of the data of the
+	// builder, like when a build is retried with a fresh run UUID.
+	RunUUID string
+
+	// Skip is the number of provisioners that already ran on the machine,
+	// like when a build continues from a checkpoint; they are skipped.
+	Skip int
+	// Provisioned, when set, is called once the provisioner at index ran
+	// successfully.
+	Provisioned func(index int)
+
+	// Retries is how many times a failing provisioner runs again before
+	// failing the build, like with -on-error=retry.
+	Retries int
+
+	// Evaluate, when set, evaluates the expressions typed at the pauses of
+	// the provisioners, with the data generated by the builder.
+	Evaluate DebugEvaluator
+
+	// Pause, when set, holds the provisioners back while it is paused.
+	Pause *PauseGate
+
+	// timer, when set, records the time spent by the provisioners.
+	timer *buildTimer
+	// failed tells whether a provisioner failed in the last run of the hook.
+	failed bool
+}
+
+// ProvisionerLabelsMachineType is the type of the machine-readable messages a
+// provisioner sends to attach labels to its build in the HCP Packer registry.
+// The arguments of the message are key/value pairs:
+//
+//	ui.Machine(ProvisionerLabelsMachineType, "key1", "value1", "key2", "value2")
+const ProvisionerLabelsMachineType = "registry-labels"
+
+// labelsUi passes the labels sent by a provisioner to labels.
+type labelsUi struct {
+	packersdk.Ui
+	labels func(map[string]string)
+}
+
+func (u *labelsUi) Machine(t string, args ...string) {
+	if t == ProvisionerLabelsMachineType {
+		if len(args)%2 != 0 {
+			log.Printf("[WARN] ignoring the odd number of %s arguments: %q", t, args)
+		} else {
+			labels := make(map[string]string, len(args)/2)
+			for i := 0; i < len(args); i += 2 {
+				labels[args[i]] = args[i+1]
+			}
+			u.labels(labels)
+		}
+	}
+	u.Ui.Machine(t, args...)
 }
 
 // BuilderDataCommonKeys is the list of common keys that all builder will
@@ -115,16 +183,89 @@ func (h *ProvisionHook) Run(ctx context.Context, name string, ui packersdk.Ui, c
 				"`communicator` config was set to \"none\". If you have any provisioners\n" +
 				"then a communicator is required. Please fix this to continue.")
 	}
-	for _, p := range h.Provisioners {
+	if h.Labels != nil {
+		ui = &labelsUi{Ui: ui, labels: h.Labels}
+	}
+	h.failed = false
+	stage, stageEnd := 0, 0
+	if h.Stages != nil && len(h.Stages.Stages) > 0 {
+		stageEnd = h.Stages.Stages[0].Provisioners
+	}
+	var stageStart time.Time
+	var stageSpan *TelemetrySpan
+	for i, p := range h.Provisioners {
+		if i < h.Skip {
+			log.Printf("[INFO] skipping the %s provisioner that already ran", p.TypeName)
+			continue
+		}
+		if h.Stages != nil {
+			for stage < len(h.Stages.Stages)-1 && i >= stageEnd {
+				stage++
+				stageEnd += h.Stages.Stages[stage].Provisioners
+			}
+			if stage < h.Stages.Resumed {
+				log.Printf("[INFO] skipping the %s provisioner of the unchanged stage %q", p.TypeName, h.Stages.Stages[stage].Name)
+				continue
+			}
+			if stageStart.IsZero() {
+				stageStart = time.Now()
+				stageSpan = CheckpointReporter.AddSpan(h.Stages.Stages[stage].Name, "stage", nil)
+			}
+		}
+
+		if err := h.Pause.Wait(ctx, ui, p.TypeName); err != nil {
+			h.failed = true
+			stageSpan.End(err)
+			return err
+		}
+
+		if ui != nil {
+			ui.Machine("provisioner", "started", p.TypeName)
+		}
 		ts := CheckpointReporter.AddSpan(p.TypeName, "provisioner", p.Config)
 
+		provComm := comm
+		if h.Transcript != nil {
+			provComm = h.Transcript.Communicator(comm, p.TypeName)
+		}
+
 		cast := CastDataToMap(data)
-		err := p.Provisioner.Provision(ctx, ui, comm, cast)
+		if h.RunUUID != "" {
+			cast["PackerRunUUID"] = h.RunUUID
+		}
+		provUi := ui
+		if h.Evaluate != nil {
+			provUi = &debugUi{Ui: ui, evaluate: h.Evaluate, data: cast}
+		}
+		var err error
+		for attempt := 0; ; attempt++ {
+			endTiming := h.timer.start(TimingProvisioner, p.TypeName)
+			err = p.Provisioner.Provision(ctx, provUi, provComm, cast)
+			endTiming(err)
+			if err == nil || attempt >= h.Retries || ctx.Err() != nil {
+				break
+			}
+			ui.Error(fmt.Sprintf("Provisioner %s failed, running it again (retry %d of %d): %s", p.TypeName, attempt+1, h.Retries, err))
+		}
 
 		ts.End(err)
 		if err != nil {
+			h.failed = true
+			stageSpan.End(err)
 			return err
 		}
+
+		if h.Provisioned != nil {
+			h.Provisioned(i)
+		}
+
+		if h.Stages != nil && i == stageEnd-1 {
+			stageSpan.End(nil)
+			ui.Say(fmt.Sprintf("Stage %q finished after %s.", h.Stages.Stages[stage].Name,
+				durafmt.Parse(time.Since(stageStart)).LimitFirstN(2)))
+			h.Stages.snapshot(ctx, ui, stage)
+			stageStart = time.Time{}
+		}
 	}
 
 	return nil
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -44,6 +45,36 @@ func TestProvisionHook(t *testing.T) {
 	}
 }
 
+func TestProvisionHook_labels(t *testing.T) {
+	pA := &packersdk.MockProvisioner{}
+	pA.ProvFunc = func(context.Context) error {
+		pA.ProvUi.Machine(ProvisionerLabelsMachineType, "curl", "7.81.0", "jq", "1.6")
+		pA.ProvUi.Machine(ProvisionerLabelsMachineType, "odd")
+		pA.ProvUi.Machine("other", "key", "value")
+		return nil
+	}
+
+	var received []map[string]string
+	hook := &ProvisionHook{
+		Provisioners: []*HookedProvisioner{
+			{pA, nil, ""},
+		},
+		Labels: func(l map[string]string) {
+			received = append(received, l)
+		},
+	}
+
+	err := hook.Run(context.Background(), "foo", testUi(), new(packersdk.MockCommunicator), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []map[string]string{{"curl": "7.81.0", "jq": "1.6"}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("unexpected labels: %#v", received)
+	}
+}
+
 func TestProvisionHook_nilComm(t *testing.T) {
 	pA := &packersdk.MockProvisioner{}
 	pB := &packersdk.MockProvisioner{}
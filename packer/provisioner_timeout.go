@@ -8,38 +8,61 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
+// DefaultTimeoutGracePeriod is how long a TimeoutProvisioner waits for a
+// cancelled provisioner to stop before giving up on it.
+const DefaultTimeoutGracePeriod = time.Minute
+
 // TimeoutProvisioner is a Provisioner implementation that can timeout after a
 // duration
 type TimeoutProvisioner struct {
 	packersdk.Provisioner
 	Timeout time.Duration
+
+	// GracePeriod is how long the provisioner has to stop once it timed out
+	// or got cancelled, DefaultTimeoutGracePeriod when zero. A provisioner
+	// still running after it is left behind, so that a hung provisioner does
+	// not hang the build: the build fails and its builder cleans up.
+	GracePeriod time.Duration
 }
 
 func (p *TimeoutProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, generatedData map[string]interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
 	defer cancel()
 
-	// Use a select to determine if we get cancelled during the wait
 	ui.Say(fmt.Sprintf("Setting a %s timeout for the next provisioner...", p.Timeout))
 
-	errC := make(chan interface{})
-
+	errC := make(chan error, 1)
 	go func() {
-		select {
-		case <-errC:
-			// all good
-		case <-ctx.Done():
-			switch ctx.Err() {
-			case context.DeadlineExceeded:
-				ui.Error("Cancelling provisioner after a timeout...")
-			default:
-				// the context also gets cancelled when the provisioner is
-				// successful
-			}
-		}
+		errC <- p.Provisioner.Provision(ctx, ui, comm, generatedData)
 	}()
 
-	err := p.Provisioner.Provision(ctx, ui, comm, generatedData)
-	close(errC)
+	// Use a select to determine if we get cancelled during the run
+	select {
+	case err := <-errC:
+		return p.timeoutErr(ctx, err)
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			ui.Error("Cancelling provisioner after a timeout...")
+		}
+	}
+
+	gracePeriod := p.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultTimeoutGracePeriod
+	}
+	select {
+	case err := <-errC:
+		return p.timeoutErr(ctx, err)
+	case <-time.After(gracePeriod):
+		return fmt.Errorf("the provisioner did not stop within %s of being cancelled, giving up on it", gracePeriod)
+	}
+}
+
+// timeoutErr tells that the provisioner timed out when it failed because of
+// the timeout.
+func (p *TimeoutProvisioner) timeoutErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("the provisioner timed out after %s: %s", p.Timeout, err)
+	}
 	return err
 }
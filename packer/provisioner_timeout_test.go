@@ -0,0 +1,69 @@
+package packer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestTimeoutProvisioner_impl(t *testing.T) {
+	var _ packersdk.Provisioner = new(TimeoutProvisioner)
+}
+
+func TestTimeoutProvisionerProvision(t *testing.T) {
+	mock := new(packersdk.MockProvisioner)
+	prov := &TimeoutProvisioner{
+		Timeout:     time.Minute,
+		Provisioner: mock,
+	}
+
+	err := prov.Provision(context.Background(), testUi(), new(packersdk.MockCommunicator), make(map[string]interface{}))
+	if err != nil {
+		t.Fatalf("prov failed: %v", err)
+	}
+	if !mock.ProvCalled {
+		t.Fatal("prov should be called")
+	}
+}
+
+func TestTimeoutProvisionerProvision_timesOut(t *testing.T) {
+	prov := &TimeoutProvisioner{
+		Timeout: 10 * time.Millisecond,
+		Provisioner: &packersdk.MockProvisioner{
+			ProvFunc: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+	}
+
+	err := prov.Provision(context.Background(), testUi(), new(packersdk.MockCommunicator), make(map[string]interface{}))
+	if err == nil || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestTimeoutProvisionerProvision_hung(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	prov := &TimeoutProvisioner{
+		Timeout:     10 * time.Millisecond,
+		GracePeriod: 10 * time.Millisecond,
+		Provisioner: &packersdk.MockProvisioner{
+			ProvFunc: func(context.Context) error {
+				// ignores the cancellation
+				<-release
+				return nil
+			},
+		},
+	}
+
+	err := prov.Provision(context.Background(), testUi(), new(packersdk.MockCommunicator), make(map[string]interface{}))
+	if err == nil || !strings.Contains(err.Error(), "did not stop") {
+		t.Fatalf("expected the hung provisioner to be left behind, got %v", err)
+	}
+}
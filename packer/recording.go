@@ -0,0 +1,541 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// BuildRecording records the interactions of the core with the plugins of a
+// build: the hooks run by the builder, like the provisioners, with the
+// traffic of their communicator, and what the builder and the post-processors
+// returned. Replaying it, see CoreBuild.Replay, runs the core and the
+// provisioners again against the recording, without running the builder nor
+// the post-processors, so that changes of the core or of the template can be
+// tested deterministically against real-world builds.
+//
+// The commands and their outputs are recorded redacted, see Secrets.
+type BuildRecording struct {
+	Build string `json:"build"`
+	// Hooks are the hooks run by the builder, in order, during its last
+	// attempt.
+	Hooks []*RecordedHook `json:"hooks"`
+	// Artifact and Error are what the builder returned.
+	Artifact *RecordedArtifact `json:"artifact,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	// PostProcessors are the post-processors run, in order.
+	PostProcessors []*RecordedPostProcessor `json:"post_processors,omitempty"`
+
+	l  sync.Mutex
+	wg sync.WaitGroup
+}
+
+// RecordedHook is a hook run by the builder.
+type RecordedHook struct {
+	Name string `json:"name"`
+	// Data is the data the builder passed to the hook, like the generated
+	// data of the provisioners.
+	Data interface{} `json:"data,omitempty"`
+	// Communicator tells whether the builder passed a communicator to the
+	// hook, Exchanges are its traffic.
+	Communicator bool                `json:"communicator"`
+	Exchanges    []*RecordedExchange `json:"exchanges,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// The operations of a RecordedExchange, one per method of a communicator.
+const (
+	ExchangeStart       = "start"
+	ExchangeUpload      = "upload"
+	ExchangeUploadDir   = "upload_dir"
+	ExchangeDownload    = "download"
+	ExchangeDownloadDir = "download_dir"
+)
+
+// RecordedExchange is a call to the communicator of a hook.
+type RecordedExchange struct {
+	Op string `json:"op"`
+	// Command is the command started.
+	Command string `json:"command,omitempty"`
+	// Path is the path on the guest uploaded to or downloaded from.
+	Path string `json:"path,omitempty"`
+	// SHA256 is the hex encoded sha256 of the file uploaded.
+	SHA256 string `json:"sha256,omitempty"`
+	// Content is the file downloaded.
+	Content []byte `json:"content,omitempty"`
+
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitStatus int    `json:"exit_status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RecordedPostProcessor is what a post-processor returned.
+type RecordedPostProcessor struct {
+	Type          string            `json:"type"`
+	Artifact      *RecordedArtifact `json:"artifact,omitempty"`
+	Keep          bool              `json:"keep"`
+	ForceOverride bool              `json:"force_override"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// NewBuildRecording returns an empty recording of the named build.
+func NewBuildRecording(build string) *BuildRecording {
+	return &BuildRecording{
+		Build: build,
+		Hooks: []*RecordedHook{},
+	}
+}
+
+// ReadBuildRecording reads the recording written at path by Write.
+func ReadBuildRecording(path string) (*BuildRecording, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec BuildRecording
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("failed to decode the recording %s: %s", path, err)
+	}
+	return &rec, nil
+}
+
+// Write stores the recording in the file at path, overwriting it if present.
+// It waits for the commands started to exit, for timeout at most.
+func (r *BuildRecording) Write(path string, timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("[WARN] some commands of %q did not exit in time to be recorded", r.Build)
+	}
+
+	r.l.Lock()
+	b, err := json.MarshalIndent(r, "", "  ")
+	r.l.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// hook returns a hook recording the runs of h.
+func (r *BuildRecording) hook(h packersdk.Hook) packersdk.Hook {
+	return &recordingHook{Hook: h, recording: r}
+}
+
+// restart forgets the hooks run by a failed attempt of the builder.
+func (r *BuildRecording) restart() {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.Hooks = []*RecordedHook{}
+}
+
+// builderDone records what the builder returned.
+func (r *BuildRecording) builderDone(artifact packersdk.Artifact, err error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if artifact != nil {
+		r.Artifact = recordArtifact(artifact)
+	}
+	r.Error = recordedError(err)
+}
+
+// postProcessorDone records what a post-processor returned.
+func (r *BuildRecording) postProcessorDone(ptype string, artifact packersdk.Artifact, keep, forceOverride bool, err error) {
+	rec := &RecordedPostProcessor{
+		Type:          ptype,
+		Keep:          keep,
+		ForceOverride: forceOverride,
+		Error:         recordedError(err),
+	}
+	if artifact != nil {
+		rec.Artifact = recordArtifact(artifact)
+	}
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.PostProcessors = append(r.PostProcessors, rec)
+}
+
+// update applies f to the recording under lock.
+func (r *BuildRecording) update(f func()) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	f()
+}
+
+func recordedError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Secrets.Redact(err.Error())
+}
+
+type recordingHook struct {
+	packersdk.Hook
+	recording *BuildRecording
+}
+
+func (h *recordingHook) Run(ctx context.Context, name string, ui packersdk.Ui, comm packersdk.Communicator, data interface{}) error {
+	rec := &RecordedHook{Name: name, Communicator: comm != nil}
+	if data != nil {
+		// The data is recorded as JSON, data that can't be is left out.
+		b, err := json.Marshal(jsonState(data))
+		if err == nil {
+			err = json.Unmarshal(b, &rec.Data)
+		}
+		if err != nil {
+			log.Printf("[WARN] not recording the data of the %s hook: %s", name, err)
+		}
+	}
+	h.recording.update(func() { h.recording.Hooks = append(h.recording.Hooks, rec) })
+
+	if comm != nil {
+		comm = &recordingCommunicator{Communicator: comm, recording: h.recording, hook: rec}
+	}
+	err := h.Hook.Run(ctx, name, ui, comm, data)
+	h.recording.update(func() { rec.Error = recordedError(err) })
+	return err
+}
+
+type recordingCommunicator struct {
+	packersdk.Communicator
+	recording *BuildRecording
+	hook      *RecordedHook
+}
+
+func (c *recordingCommunicator) add(e *RecordedExchange) {
+	c.recording.update(func() { c.hook.Exchanges = append(c.hook.Exchanges, e) })
+}
+
+func (c *recordingCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	e := &RecordedExchange{Op: ExchangeStart, Command: Secrets.Redact(cmd.Command)}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = teeWriter(cmd.Stdout, &stdout)
+	cmd.Stderr = teeWriter(cmd.Stderr, &stderr)
+
+	c.add(e)
+	if err := c.Communicator.Start(ctx, cmd); err != nil {
+		c.recording.update(func() {
+			e.ExitStatus = packersdk.CmdDisconnect
+			e.Error = recordedError(err)
+		})
+		return err
+	}
+
+	c.recording.wg.Add(1)
+	go func() {
+		defer c.recording.wg.Done()
+		status := cmd.Wait()
+		c.recording.update(func() {
+			e.ExitStatus = status
+			e.Stdout = Secrets.Redact(stdout.String())
+			e.Stderr = Secrets.Redact(stderr.String())
+		})
+	}()
+	return nil
+}
+
+func (c *recordingCommunicator) Upload(path string, r io.Reader, fi *os.FileInfo) error {
+	h := sha256.New()
+	err := c.Communicator.Upload(path, io.TeeReader(r, h), fi)
+	c.add(&RecordedExchange{
+		Op:     ExchangeUpload,
+		Path:   path,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Error:  recordedError(err),
+	})
+	return err
+}
+
+func (c *recordingCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	err := c.Communicator.UploadDir(dst, src, exclude)
+	c.add(&RecordedExchange{Op: ExchangeUploadDir, Path: dst, Error: recordedError(err)})
+	return err
+}
+
+func (c *recordingCommunicator) Download(path string, w io.Writer) error {
+	var content bytes.Buffer
+	err := c.Communicator.Download(path, io.MultiWriter(w, &content))
+	c.add(&RecordedExchange{
+		Op:      ExchangeDownload,
+		Path:    path,
+		Content: content.Bytes(),
+		Error:   recordedError(err),
+	})
+	return err
+}
+
+func (c *recordingCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	err := c.Communicator.DownloadDir(src, dst, exclude)
+	c.add(&RecordedExchange{Op: ExchangeDownloadDir, Path: src, Error: recordedError(err)})
+	return err
+}
+
+func teeWriter(w io.Writer, buf *bytes.Buffer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(w, buf)
+}
+
+// ReplayDivergenceError tells a replayed build did not interact with its
+// plugins like the recorded build did.
+type ReplayDivergenceError struct {
+	Build  string
+	Detail string
+}
+
+func (e *ReplayDivergenceError) Error() string {
+	return fmt.Sprintf("the replay of build %q diverged from the recording: %s", e.Build, e.Detail)
+}
+
+// Replay makes the build replay rec instead of running its builder and its
+// post-processors: the builder runs the recorded hooks, with communicators
+// answering like the recorded ones, and returns the recorded artifact, then
+// the post-processors return the recorded artifacts. The build fails with a
+// ReplayDivergenceError when it does not interact with them like the
+// recorded build did. Builds replayed are not published to the HCP Packer
+// registry.
+func (b *CoreBuild) Replay(rec *BuildRecording) {
+	builder := b.Builder
+	if rb, ok := builder.(*RegistryBuilder); ok {
+		builder = rb.Builder
+	}
+	b.Builder = &replayBuilder{Builder: builder, build: b.Name(), recording: rec}
+
+	replay := &replayPostProcessors{build: b.Name(), recording: rec}
+	for _, chain := range b.PostProcessors {
+		for i := range chain {
+			chain[i].PostProcessor = &replayPostProcessor{
+				PostProcessor: chain[i].PostProcessor,
+				ptype:         chain[i].PType,
+				replay:        replay,
+			}
+		}
+	}
+}
+
+// replayBuilder replays the recorded hooks of a build rather than running
+// Builder, which only validates its configuration.
+type replayBuilder struct {
+	packersdk.Builder
+	build     string
+	recording *BuildRecording
+}
+
+func (b *replayBuilder) ConfigSpec() hcldec.ObjectSpec { return b.Builder.ConfigSpec() }
+
+func (b *replayBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	ui.Say("Replaying the recording of the build, the builder does not run")
+	for _, rec := range b.recording.Hooks {
+		var comm *replayCommunicator
+		var hookComm packersdk.Communicator
+		if rec.Communicator {
+			comm = &replayCommunicator{build: b.build, hook: rec}
+			hookComm = comm
+		}
+		err := hook.Run(ctx, rec.Name, ui, hookComm, rec.Data)
+		if err == nil && comm != nil {
+			err = comm.done()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Error != "" {
+			return nil, &ReplayDivergenceError{Build: b.build, Detail: fmt.Sprintf(
+				"the %s hook succeeded, it failed in the recording: %s", rec.Name, rec.Error)}
+		}
+	}
+	if b.recording.Error != "" {
+		return nil, errors.New(b.recording.Error)
+	}
+	if b.recording.Artifact == nil {
+		return nil, nil
+	}
+	return b.recording.Artifact.Artifact(), nil
+}
+
+// replayCommunicator answers the calls of a hook with the recorded exchanges
+// of the hook, in order.
+type replayCommunicator struct {
+	build string
+	hook  *RecordedHook
+
+	l    sync.Mutex
+	next int
+}
+
+var _ packersdk.Communicator = new(replayCommunicator)
+
+// expect returns the next recorded exchange, when it is op on target.
+func (c *replayCommunicator) expect(op, target string) (*RecordedExchange, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.next >= len(c.hook.Exchanges) {
+		return nil, &ReplayDivergenceError{Build: c.build, Detail: fmt.Sprintf(
+			"the %s hook ran %s %q, after the %d exchanges recorded", c.hook.Name, op, target, len(c.hook.Exchanges))}
+	}
+	e := c.hook.Exchanges[c.next]
+	c.next++
+	if e.Op != op || e.target() != target {
+		return nil, &ReplayDivergenceError{Build: c.build, Detail: fmt.Sprintf(
+			"exchange %d of the %s hook ran %s %q, the recording ran %s %q", c.next, c.hook.Name, op, target, e.Op, e.target())}
+	}
+	return e, nil
+}
+
+// done checks that the hook ran all the recorded exchanges.
+func (c *replayCommunicator) done() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.next < len(c.hook.Exchanges) {
+		e := c.hook.Exchanges[c.next]
+		return &ReplayDivergenceError{Build: c.build, Detail: fmt.Sprintf(
+			"the %s hook ran %d of the %d exchanges recorded, the next one ran %s %q",
+			c.hook.Name, c.next, len(c.hook.Exchanges), e.Op, e.target())}
+	}
+	return nil
+}
+
+func (e *RecordedExchange) target() string {
+	if e.Op == ExchangeStart {
+		return e.Command
+	}
+	return e.Path
+}
+
+func (e *RecordedExchange) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	return errors.New(e.Error)
+}
+
+func (c *replayCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	e, err := c.expect(ExchangeStart, Secrets.Redact(cmd.Command))
+	if err != nil {
+		return err
+	}
+	if e.Error != "" {
+		return e.err()
+	}
+	go func() {
+		if cmd.Stdout != nil {
+			_, _ = io.Copy(cmd.Stdout, strings.NewReader(e.Stdout))
+		}
+		if cmd.Stderr != nil {
+			_, _ = io.Copy(cmd.Stderr, strings.NewReader(e.Stderr))
+		}
+		cmd.SetExited(e.ExitStatus)
+	}()
+	return nil
+}
+
+func (c *replayCommunicator) Upload(path string, r io.Reader, _ *os.FileInfo) error {
+	e, err := c.expect(ExchangeUpload, path)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != e.SHA256 {
+		return &ReplayDivergenceError{Build: c.build, Detail: fmt.Sprintf(
+			"the %s hook uploaded a file with the sha256 %s to %q, the recording uploaded %s", c.hook.Name, sum, path, e.SHA256)}
+	}
+	return e.err()
+}
+
+func (c *replayCommunicator) UploadDir(dst string, _ string, _ []string) error {
+	e, err := c.expect(ExchangeUploadDir, dst)
+	if err != nil {
+		return err
+	}
+	return e.err()
+}
+
+func (c *replayCommunicator) Download(path string, w io.Writer) error {
+	e, err := c.expect(ExchangeDownload, path)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.Content); err != nil {
+		return err
+	}
+	return e.err()
+}
+
+func (c *replayCommunicator) DownloadDir(src string, _ string, _ []string) error {
+	e, err := c.expect(ExchangeDownloadDir, src)
+	if err != nil {
+		return err
+	}
+	log.Printf("[WARN] not replaying the content of the directory %q downloaded by the %s hook", src, c.hook.Name)
+	return e.err()
+}
+
+// replayPostProcessors hands the recorded post-processors out in order.
+type replayPostProcessors struct {
+	build     string
+	recording *BuildRecording
+
+	l    sync.Mutex
+	next int
+}
+
+// replayPostProcessor returns what the next recorded post-processor returned
+// rather than running PostProcessor, which only validates its configuration.
+type replayPostProcessor struct {
+	packersdk.PostProcessor
+	ptype  string
+	replay *replayPostProcessors
+}
+
+func (p *replayPostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.PostProcessor.ConfigSpec() }
+
+func (p *replayPostProcessor) PostProcess(_ context.Context, _ packersdk.Ui, _ packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	r := p.replay
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.next >= len(r.recording.PostProcessors) {
+		return nil, false, false, &ReplayDivergenceError{Build: r.build, Detail: fmt.Sprintf(
+			"the %s post-processor ran after the %d post-processors recorded", p.ptype, len(r.recording.PostProcessors))}
+	}
+	rec := r.recording.PostProcessors[r.next]
+	r.next++
+	if rec.Type != p.ptype {
+		return nil, false, false, &ReplayDivergenceError{Build: r.build, Detail: fmt.Sprintf(
+			"post-processor %d is %s, it was %s in the recording", r.next, p.ptype, rec.Type)}
+	}
+	var artifact packersdk.Artifact
+	if rec.Artifact != nil {
+		artifact = rec.Artifact.Artifact()
+	}
+	var err error
+	if rec.Error != "" {
+		err = errors.New(rec.Error)
+	}
+	return artifact, rec.Keep, rec.ForceOverride, err
+}
@@ -0,0 +1,156 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// commandsProvisioner runs commands on the guest, uploads a file and
+// downloads one.
+type commandsProvisioner struct {
+	packersdk.MockProvisioner
+	commands   []string
+	upload     string
+	stdout     []string
+	downloaded string
+	data       map[string]interface{}
+}
+
+func (p *commandsProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, data map[string]interface{}) error {
+	p.data = data
+	for _, command := range p.commands {
+		var stdout bytes.Buffer
+		cmd := &packersdk.RemoteCmd{Command: command, Stdout: &stdout}
+		if err := cmd.RunWithUi(ctx, comm, packersdk.TestUi(nil)); err != nil {
+			return err
+		}
+		if cmd.ExitStatus() != 0 {
+			return errors.New("command failed")
+		}
+		p.stdout = append(p.stdout, stdout.String())
+	}
+	if err := comm.Upload("/tmp/script.sh", strings.NewReader(p.upload), nil); err != nil {
+		return err
+	}
+	var downloaded bytes.Buffer
+	if err := comm.Download("/etc/os-release", &downloaded); err != nil {
+		return err
+	}
+	p.downloaded = downloaded.String()
+	return nil
+}
+
+// hookingBuilder runs the provision hook with its communicator.
+type hookingBuilder struct {
+	packersdk.MockBuilder
+	comm packersdk.Communicator
+}
+
+func (b *hookingBuilder) Run(ctx context.Context, ui packersdk.Ui, h packersdk.Hook) (packersdk.Artifact, error) {
+	b.RunCalled = true
+	data := map[string]interface{}{"Host": "10.0.0.12"}
+	if err := h.Run(ctx, packersdk.HookProvision, ui, b.comm, data); err != nil {
+		return nil, err
+	}
+	return &packersdk.MockArtifact{IdValue: b.ArtifactId}, nil
+}
+
+func recordingBuild(builder packersdk.Builder, provisioner packersdk.Provisioner, pp *MockPostProcessor) *CoreBuild {
+	build := testBuild()
+	build.Builder = builder
+	build.Provisioners[0].Provisioner = provisioner
+	build.PostProcessors[0][0].PostProcessor = pp
+	build.Prepare()
+	return build
+}
+
+func TestBuildRecording_replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.recording.json")
+
+	builder := &hookingBuilder{
+		MockBuilder: packersdk.MockBuilder{ArtifactId: "ami-1234"},
+		comm:        &packersdk.MockCommunicator{StartStdout: "hello\n", DownloadData: "ID=ubuntu"},
+	}
+	recorded := &commandsProvisioner{commands: []string{"echo hello"}, upload: "#!/bin/sh"}
+	build := recordingBuild(builder, recorded, &MockPostProcessor{ArtifactId: "pp", Keep: true})
+	build.RecordingPath = path
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("failed to record the build: %s", err)
+	}
+
+	rec, err := ReadBuildRecording(path)
+	if err != nil {
+		t.Fatalf("failed to read the recording: %s", err)
+	}
+	if len(rec.Hooks) != 1 || len(rec.Hooks[0].Exchanges) != 3 || len(rec.PostProcessors) != 1 {
+		t.Fatalf("unexpected recording %#v", rec)
+	}
+	if e := rec.Hooks[0].Exchanges[0]; e.Op != ExchangeStart || e.Command != "echo hello" || e.Stdout != "hello\n" {
+		t.Errorf("unexpected recorded command %#v", e)
+	}
+
+	replayedBuilder := &hookingBuilder{}
+	pp := &MockPostProcessor{ArtifactId: "other"}
+	replayed := &commandsProvisioner{commands: []string{"echo hello"}, upload: "#!/bin/sh"}
+	build = recordingBuild(replayedBuilder, replayed, pp)
+	build.Replay(rec)
+	artifacts, err := build.Run(context.Background(), testUi())
+	if err != nil {
+		t.Fatalf("failed to replay the build: %s", err)
+	}
+	if replayedBuilder.RunCalled || pp.PostProcessCalled {
+		t.Error("the builder or the post-processor ran during the replay")
+	}
+	if len(artifacts) != 2 || artifacts[0].Id() != "ami-1234" || artifacts[1].Id() != "pp" {
+		t.Errorf("unexpected artifacts %v", artifacts)
+	}
+	if len(replayed.stdout) != 1 || replayed.stdout[0] != "hello\n" || replayed.downloaded != "ID=ubuntu" {
+		t.Errorf("unexpected replayed outputs %q, %q", replayed.stdout, replayed.downloaded)
+	}
+	if replayed.data["Host"] != "10.0.0.12" {
+		t.Errorf("unexpected replayed hook data %v", replayed.data)
+	}
+}
+
+func TestBuildRecording_replayDiverged(t *testing.T) {
+	builder := &hookingBuilder{
+		MockBuilder: packersdk.MockBuilder{ArtifactId: "ami-1234"},
+		comm:        &packersdk.MockCommunicator{StartStdout: "hello\n"},
+	}
+	path := filepath.Join(t.TempDir(), "test.recording.json")
+	build := recordingBuild(builder, &commandsProvisioner{commands: []string{"echo hello"}, upload: "a"}, &MockPostProcessor{})
+	build.RecordingPath = path
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("failed to record the build: %s", err)
+	}
+
+	cases := []struct {
+		name        string
+		provisioner *commandsProvisioner
+	}{
+		{"other command", &commandsProvisioner{commands: []string{"echo bye"}, upload: "a"}},
+		{"other upload", &commandsProvisioner{commands: []string{"echo hello"}, upload: "b"}},
+		{"more commands", &commandsProvisioner{commands: []string{"echo hello", "echo bye"}, upload: "a"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := ReadBuildRecording(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			build := recordingBuild(&hookingBuilder{}, tc.provisioner, &MockPostProcessor{})
+			build.Replay(rec)
+			_, err = build.Run(context.Background(), testUi())
+			var divergence *ReplayDivergenceError
+			if !errors.As(err, &divergence) {
+				t.Fatalf("expected the replay to diverge, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package packer
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// RedactedSecret replaces the secrets in the output of Packer.
+const RedactedSecret = "<sensitive>"
+
+// SecretMachineCategory is the type of the machine-readable message a plugin
+// sends to declare secrets, like a password it generated, see TargetedUI.
+const SecretMachineCategory = "secret"
+
+// secretConfigKeys are the keys of the configurations of the builders and
+// provisioners holding a communicator password, see RegisterConfigSecrets.
+var secretConfigKeys = map[string]bool{
+	"ssh_password":         true,
+	"ssh_bastion_password": true,
+	"ssh_proxy_password":   true,
+	"winrm_password":       true,
+	"elevated_password":    true,
+}
+
+// IsSecretConfigKey tells whether key is the key of a configuration holding a
+// communicator password.
+func IsSecretConfigKey(key string) bool {
+	return secretConfigKeys[key]
+}
+
+// SensitiveEnd closes the secrets opened with RedactedSecret in the outputs
+// marking them, see SensitiveOutputMark.
+const SensitiveEnd = "</sensitive>"
+
+// SensitiveOutputEnvVar sets the SensitiveOutput policy when the
+// -sensitive-output flag is not set.
+const SensitiveOutputEnvVar = "PACKER_SENSITIVE_OUTPUT"
+
+// SensitiveOutput is how the machine-readable and the JSON outputs handle the
+// secrets of their events, so that downstream log processors can enforce
+// their own redaction.
+type SensitiveOutput string
+
+const (
+	// SensitiveOutputRedact masks the secrets, the default.
+	SensitiveOutputRedact SensitiveOutput = "redact"
+	// SensitiveOutputMark outputs the secrets enclosed in RedactedSecret and
+	// SensitiveEnd. The secrets only known to the in-process plugins are
+	// still masked.
+	SensitiveOutputMark SensitiveOutput = "mark"
+	// SensitiveOutputOmit leaves out the events holding secrets.
+	SensitiveOutputOmit SensitiveOutput = "omit"
+)
+
+// ParseSensitiveOutput returns the policy named s, SensitiveOutputRedact when
+// s is empty.
+func ParseSensitiveOutput(s string) (SensitiveOutput, error) {
+	switch p := SensitiveOutput(s); p {
+	case "":
+		return SensitiveOutputRedact, nil
+	case SensitiveOutputRedact, SensitiveOutputMark, SensitiveOutputOmit:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown sensitive output policy %q, expected %s, %s or %s",
+		s, SensitiveOutputRedact, SensitiveOutputMark, SensitiveOutputOmit)
+}
+
+// Redactor masks the secrets registered to it. The zero value is ready to
+// use, and is safe for concurrent use.
+type Redactor struct {
+	l         sync.RWMutex
+	secrets   map[string]struct{}
+	replacers *redactReplacers
+
+	// setLogSecretFilter sets the registered secrets to
+	// packersdk.LogSecretFilter too, for the Uis of the SDK to mask them.
+	setLogSecretFilter bool
+}
+
+// Secrets is the redactor of the output of Packer: the messages of the Ui,
+// the machine-readable events and the logs are filtered through it. The
+// sensitive variables, the communicator passwords and the secrets declared by
+// the plugins are registered to it.
+var Secrets = &Redactor{setLogSecretFilter: true}
+
+// Register registers secrets to be masked, along with their quoted and URL
+// encoded forms. Empty secrets are ignored.
+func (r *Redactor) Register(secrets ...string) {
+	if r.setLogSecretFilter {
+		packersdk.LogSecretFilter.Set(secrets...)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.secrets == nil {
+		r.secrets = make(map[string]struct{})
+	}
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		r.secrets[s] = struct{}{}
+		quoted := strconv.Quote(s)
+		r.secrets[quoted[1:len(quoted)-1]] = struct{}{}
+		r.secrets[url.QueryEscape(s)] = struct{}{}
+	}
+	r.replacers = nil
+}
+
+// Redact returns s with the registered secrets masked, and the ones set to
+// packersdk.LogSecretFilter by in-process plugins.
+func (r *Redactor) Redact(s string) string {
+	if replacers := r.getReplacers(); replacers != nil {
+		s = replacers.redact.Replace(s)
+	}
+	return packersdk.LogSecretFilter.FilterString(s)
+}
+
+// Output returns s as output by policy, and whether it holds secrets. The
+// secrets are masked or marked, s is returned as is by SensitiveOutputOmit.
+func (r *Redactor) Output(policy SensitiveOutput, s string) (string, bool) {
+	redacted := r.Redact(s)
+	sensitive := redacted != s
+	switch {
+	case !sensitive:
+		return s, false
+	case policy == SensitiveOutputOmit:
+		return s, true
+	case policy != SensitiveOutputMark:
+		return redacted, true
+	}
+	// The registered secrets are swapped for placeholders while the ones of
+	// the in-process plugins are masked, then marked.
+	replacers := r.getReplacers()
+	if replacers == nil {
+		return redacted, true
+	}
+	return replacers.unplaceholder.Replace(packersdk.LogSecretFilter.FilterString(replacers.placeholder.Replace(s))), true
+}
+
+// redactReplacers replace the registered secrets.
+type redactReplacers struct {
+	// redact masks the secrets.
+	redact *strings.Replacer
+	// placeholder swaps the secrets for placeholders, which unplaceholder
+	// swaps for the marked secrets, see SensitiveOutputMark.
+	placeholder   *strings.Replacer
+	unplaceholder *strings.Replacer
+}
+
+// getReplacers returns the replacers of the registered secrets, nil when there
+// are none. Longer secrets come first, so that a secret containing another
+// one is replaced as a whole.
+func (r *Redactor) getReplacers() *redactReplacers {
+	r.l.RLock()
+	replacers := r.replacers
+	r.l.RUnlock()
+	if replacers != nil {
+		return replacers
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.replacers != nil || len(r.secrets) == 0 {
+		return r.replacers
+	}
+	secrets := make([]string, 0, len(r.secrets))
+	for s := range r.secrets {
+		secrets = append(secrets, s)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	redact := make([]string, 0, 2*len(secrets))
+	placeholder := make([]string, 0, 2*len(secrets))
+	unplaceholder := make([]string, 0, 2*len(secrets))
+	for i, s := range secrets {
+		p := "\x00" + strconv.Itoa(i) + "\x00"
+		redact = append(redact, s, RedactedSecret)
+		placeholder = append(placeholder, s, p)
+		unplaceholder = append(unplaceholder, p, RedactedSecret+s+SensitiveEnd)
+	}
+	r.replacers = &redactReplacers{
+		redact:        strings.NewReplacer(redact...),
+		placeholder:   strings.NewReplacer(placeholder...),
+		unplaceholder: strings.NewReplacer(unplaceholder...),
+	}
+	return r.replacers
+}
+
+// Writer returns a writer masking the secrets of what is written to w. Each
+// write is masked on its own, like the lines of a log.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &redactedWriter{r: r, w: w}
+}
+
+type redactedWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *redactedWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RegisterConfigSecrets registers to r the communicator passwords found in
+// the raw configurations of a JSON template, see IsSecretConfigKey.
+func (r *Redactor) RegisterConfigSecrets(raws ...interface{}) {
+	for _, raw := range raws {
+		switch raw := raw.(type) {
+		case map[string]interface{}:
+			for k, v := range raw {
+				if s, ok := v.(string); ok && IsSecretConfigKey(k) {
+					r.Register(s)
+					continue
+				}
+				r.RegisterConfigSecrets(v)
+			}
+		case map[interface{}]interface{}:
+			for k, v := range raw {
+				if s, ok := v.(string); ok && IsSecretConfigKey(fmt.Sprint(k)) {
+					r.Register(s)
+					continue
+				}
+				r.RegisterConfigSecrets(v)
+			}
+		case []interface{}:
+			r.RegisterConfigSecrets(raw...)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package packer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	r := new(Redactor)
+	if got := r.Redact("nothing registered"); got != "nothing registered" {
+		t.Fatalf("unexpected redaction: %q", got)
+	}
+
+	r.Register("", "pass", "password-42", `quo"ted`, "sp ace&amp")
+	tc := []struct {
+		in, want string
+	}{
+		{"login with pass", "login with <sensitive>"},
+		// The longest secret is masked as a whole.
+		{"login with password-42", "login with <sensitive>"},
+		{`{"secret": "quo\"ted"}`, `{"secret": "<sensitive>"}`},
+		{"https://host/?p=sp+ace%26amp", "https://host/?p=<sensitive>"},
+		{"sp ace&amp", "<sensitive>"},
+	}
+	for _, tt := range tc {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSecrets_Redact(t *testing.T) {
+	// The secrets registered to Secrets are masked by the Uis of the SDK too.
+	Secrets.Register("registered-secret-1138")
+	if got := Secrets.Redact("the registered-secret-1138"); got != "the <sensitive>" {
+		t.Errorf("Redact() = %q, want %q", got, "the <sensitive>")
+	}
+	if got := packersdk.LogSecretFilter.FilterString("the registered-secret-1138"); got != "the <sensitive>" {
+		t.Errorf("LogSecretFilter.FilterString() = %q, want %q", got, "the <sensitive>")
+	}
+
+	// The secrets set by in-process plugins are masked by Secrets too.
+	packersdk.LogSecretFilter.Set("plugin-secret-1138")
+	if got := Secrets.Redact("the plugin-secret-1138"); got != "the <sensitive>" {
+		t.Errorf("Redact() = %q, want %q", got, "the <sensitive>")
+	}
+}
+
+func TestRedactor_Writer(t *testing.T) {
+	r := new(Redactor)
+	r.Register("hunter2")
+	buf := new(bytes.Buffer)
+	w := r.Writer(buf)
+
+	in := "[DEBUG] ssh password is hunter2\n"
+	n, err := w.Write([]byte(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != len(in) {
+		t.Errorf("expected %d bytes written, got %d", len(in), n)
+	}
+	if got := buf.String(); got != "[DEBUG] ssh password is <sensitive>\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestRedactor_RegisterConfigSecrets(t *testing.T) {
+	r := new(Redactor)
+	r.RegisterConfigSecrets(map[string]interface{}{
+		"ssh_username": "packer",
+		"ssh_password": "ssh-secret",
+		"nested": []interface{}{
+			map[interface{}]interface{}{"winrm_password": "winrm-secret"},
+		},
+	})
+
+	got := r.Redact("packer ssh-secret winrm-secret")
+	if got != "packer <sensitive> <sensitive>" {
+		t.Errorf("unexpected redaction %q", got)
+	}
+}
+
+func TestTargetedUI_secret(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &TargetedUI{Target: "foo", Ui: &MachineReadableUi{Writer: buf}}
+
+	ui.Machine(SecretMachineCategory, "declared-by-plugin-8c2f")
+	if buf.Len() != 0 {
+		t.Fatalf("expected the secret not to be output, got %q", buf.String())
+	}
+	ui.Machine("artifact", "0", "id", "declared-by-plugin-8c2f")
+	if out := buf.String(); strings.Contains(out, "declared-by-plugin") || !strings.Contains(out, "<sensitive>") {
+		t.Errorf("expected the secret to be masked, got %q", out)
+	}
+}
+
+func TestRedactor_Output(t *testing.T) {
+	r := new(Redactor)
+	r.Register("hunter2")
+
+	tc := []struct {
+		policy SensitiveOutput
+		want   string
+	}{
+		{SensitiveOutputRedact, "password <sensitive>"},
+		{SensitiveOutputMark, "password <sensitive>hunter2</sensitive>"},
+		{SensitiveOutputOmit, "password hunter2"},
+	}
+	for _, tt := range tc {
+		got, sensitive := r.Output(tt.policy, "password hunter2")
+		if got != tt.want || !sensitive {
+			t.Errorf("Output(%q) = %q, %t, want %q, true", tt.policy, got, sensitive, tt.want)
+		}
+		if got, sensitive := r.Output(tt.policy, "no secret"); got != "no secret" || sensitive {
+			t.Errorf("Output(%q) = %q, %t, want the message as is", tt.policy, got, sensitive)
+		}
+	}
+}
+
+func TestJSONUi_sensitive(t *testing.T) {
+	Secrets.Register("json-ui-secret-51b7")
+	buf := new(bytes.Buffer)
+	ui := &TargetedUI{Target: "foo", Ui: &JSONUi{Writer: buf, Sensitive: SensitiveOutputMark}}
+
+	ui.Say("token is json-ui-secret-51b7")
+	ui.Machine("artifact", "0", "id", "ami-1")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 events, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], `"message":"token is \u003csensitive\u003ejson-ui-secret-51b7\u003c/sensitive\u003e"`) ||
+		!strings.Contains(lines[0], `"sensitive":true`) {
+		t.Errorf("expected the secret to be marked, got %s", lines[0])
+	}
+	if strings.Contains(lines[1], `"sensitive"`) {
+		t.Errorf("expected the event without secrets not to be marked, got %s", lines[1])
+	}
+
+	buf.Reset()
+	ui = &TargetedUI{Target: "foo", Ui: &MachineReadableUi{Writer: buf, Sensitive: SensitiveOutputOmit}}
+	ui.Say("token is json-ui-secret-51b7")
+	ui.Machine("artifact", "0", "id", "ami-1")
+	if out := buf.String(); strings.Contains(out, "json-ui-secret") || !strings.Contains(out, "ami-1") {
+		t.Errorf("expected the event holding the secret to be omitted only, got %q", out)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -30,38 +31,43 @@ func (b *RegistryBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packers
 		return nil, nil
 	}
 
-	runCompleted := make(chan struct{})
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				log.Printf("[TRACE] marking build %q as cancelled in HCP Packer registry", b.Name)
-				if err := b.ArtifactMetadataPublisher.UpdateBuildStatus(context.TODO(), b.Name, models.HashicorpCloudPackerBuildStatusCANCELLED); err != nil {
-					log.Printf("[TRACE] failed to update HCP Packer registry status for %q: %s", b.Name, err)
-				}
-				return
-			case <-runCompleted:
-				return
-			}
+	if b.ArtifactMetadataPublisher.ForceRebuild {
+		if err := b.ArtifactMetadataPublisher.ResetBuildForComponent(b.Name); err != nil {
+			return nil, classifyFailure(fmt.Errorf("failed to reset the HCP Packer registry build of %q: %w", b.Name, err), FailureRegistry)
 		}
-	}()
+	}
 
 	if err := b.ArtifactMetadataPublisher.UpdateBuildStatus(ctx, b.Name, models.HashicorpCloudPackerBuildStatusRUNNING); err != nil {
 		log.Printf("[TRACE] failed to update HCP Packer registry status for %q: %s", b.Name, err)
 	}
 
 	ui.Say(fmt.Sprintf("Publishing build details for %s to the HCP Packer registry", b.Name))
+
+	var logUi *buildLogUi
+	if b.ArtifactMetadataPublisher.UploadBuildLogs {
+		logUi = &buildLogUi{Ui: ui}
+		ui = logUi
+	}
+
 	artifact, err := b.Builder.Run(ctx, ui, hook)
-	if err != nil {
-		if parErr := b.ArtifactMetadataPublisher.UpdateBuildStatus(ctx, b.Name, models.HashicorpCloudPackerBuildStatusFAILED); parErr != nil {
-			log.Printf("[TRACE] failed to update HCP Packer registry status for %q: %s", b.Name, parErr)
-		}
+	if err == nil {
+		// The digests are published along with the images.
+		artifact = withDigests(ctx, ui, b.Builder, artifact)
 	}
 
-	// close chan to mark completion
-	close(runCompleted)
+	if logUi != nil {
+		buildLog := logUi.String()
+		if err != nil {
+			buildLog += fmt.Sprintf("Build '%s' errored: %s\n", b.Name, err)
+		}
+		// The log is published along with the next status update of the build.
+		if logErr := b.ArtifactMetadataPublisher.UpdateLogForBuild(b.Name, buildLog); logErr != nil {
+			log.Printf("[TRACE] failed to record the build log of %q for the HCP Packer registry: %s", b.Name, logErr)
+		}
+	}
 
 	if err != nil {
+		markBuildUnsuccessful(ctx, b.ArtifactMetadataPublisher, b.Name)
 		return nil, err
 	}
 
@@ -87,8 +93,75 @@ func (b *RegistryBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packers
 
 	err = b.ArtifactMetadataPublisher.UpdateImageForBuild(b.Name, images...)
 	if err != nil {
-		return artifact, fmt.Errorf("failed to add image artifact for %q: %s", b.Name, err)
+		return artifact, classifyFailure(fmt.Errorf("failed to add image artifact for %q: %s", b.Name, err), FailureRegistry)
+	}
+
+	if err := recordArtifactChecksums(b.ArtifactMetadataPublisher, b.Name, artifact); err != nil {
+		return artifact, classifyFailure(fmt.Errorf("failed to record the checksums of the artifact of %q: %s", b.Name, err), FailureRegistry)
 	}
 
 	return artifact, nil
 }
+
+// markBuildUnsuccessful marks the build referred to by name as CANCELLED on the
+// HCP Packer registry when ctx was cancelled, as FAILED otherwise.
+func markBuildUnsuccessful(ctx context.Context, publisher *packerregistry.Bucket, name string) {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		log.Printf("[TRACE] marking build %q as cancelled in HCP Packer registry", name)
+		// ctx is done, the status is updated regardless.
+		if err := publisher.MarkBuildCancelled(context.Background(), name, packerregistry.CancellationReason(ctxErr)); err != nil {
+			log.Printf("[TRACE] failed to update HCP Packer registry status for %q: %s", name, err)
+		}
+		return
+	}
+	if err := publisher.UpdateBuildStatus(ctx, name, models.HashicorpCloudPackerBuildStatusFAILED); err != nil {
+		log.Printf("[TRACE] failed to update HCP Packer registry status for %q: %s", name, err)
+	}
+}
+
+// buildLogUi is a Ui that records everything said to the wrapped Ui, so that
+// the log of a build can be published to the HCP Packer registry. Only the end
+// of the log is kept, see packerregistry.BuildLogMaxSize.
+type buildLogUi struct {
+	packersdk.Ui
+
+	l   sync.Mutex
+	buf []byte
+}
+
+var _ packersdk.Ui = new(buildLogUi)
+
+func (u *buildLogUi) record(message string) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.buf = append(u.buf, message...)
+	u.buf = append(u.buf, '\n')
+	// Keep some headroom to avoid reallocating on every message.
+	if len(u.buf) > 2*packerregistry.BuildLogMaxSize {
+		u.buf = append(u.buf[:0], u.buf[len(u.buf)-packerregistry.BuildLogMaxSize:]...)
+	}
+}
+
+func (u *buildLogUi) Say(message string) {
+	u.record(message)
+	u.Ui.Say(message)
+}
+
+func (u *buildLogUi) Message(message string) {
+	u.record(message)
+	u.Ui.Message(message)
+}
+
+func (u *buildLogUi) Error(message string) {
+	u.record(message)
+	u.Ui.Error(message)
+}
+
+// String returns the recorded log.
+func (u *buildLogUi) String() string {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	return string(u.buf)
+}
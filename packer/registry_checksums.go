@@ -0,0 +1,68 @@
+package packer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	packerregistry "github.com/hashicorp/packer/internal/registry"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ArtifactChecksumsStateKey is the key of the artifact state by which a
+// builder or a post-processor reports the digests of its images, like the
+// digest of a container image, as a map of image ID to digest:
+//
+//	{"registry.example.com/app:1.0": "sha256:9f86d0…"}
+//
+// They are recorded in the packerregistry.ChecksumsLabel of the build.
+const ArtifactChecksumsStateKey = "par.artifact.checksums"
+
+// recordArtifactChecksums records the checksums of artifact in the HCP Packer
+// registry build of name, see artifactChecksums.
+func recordArtifactChecksums(publisher *packerregistry.Bucket, name string, artifact packersdk.Artifact) error {
+	checksums, err := artifactChecksums(artifact, publisher.HashArtifactFiles)
+	if err != nil {
+		return err
+	}
+	return publisher.UpdateChecksumsForBuild(name, checksums)
+}
+
+// artifactChecksums returns the digests reported by artifact and, when
+// hashFiles is set, the SHA256 of its local files, by image ID or file path.
+func artifactChecksums(artifact packersdk.Artifact, hashFiles bool) (map[string]string, error) {
+	checksums := map[string]string{}
+	if state := artifact.State(ArtifactChecksumsStateKey); state != nil {
+		if err := mapstructure.WeakDecode(state, &checksums); err != nil {
+			return nil, fmt.Errorf("failed to decode the checksums reported by the artifact: %w", err)
+		}
+	}
+	if hashFiles {
+		for _, path := range artifact.Files() {
+			digest, err := fileSHA256(path)
+			if err != nil {
+				return nil, err
+			}
+			checksums[path] = digest
+		}
+	}
+	return checksums, nil
+}
+
+// fileSHA256 returns the SHA256 digest of the file at path, like sha256:<hex>.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the artifact file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash the artifact file %s: %w", path, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,46 @@
+package packer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestArtifactChecksums(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.raw")
+	if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	artifact := &packersdk.MockArtifact{
+		FilesValue: []string{path},
+		StateValues: map[string]interface{}{
+			ArtifactChecksumsStateKey: map[string]interface{}{"registry.example.com/app:1": "sha256:dddd"},
+		},
+	}
+
+	got, err := artifactChecksums(artifact, false)
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	expected := map[string]string{"registry.example.com/app:1": "sha256:dddd"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected only the reported digests %v, got %v", expected, got)
+	}
+
+	got, err = artifactChecksums(artifact, true)
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	expected[path] = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the files to be hashed %v, got %v", expected, got)
+	}
+
+	artifact.FilesValue = []string{filepath.Join(t.TempDir(), "missing")}
+	if _, err := artifactChecksums(artifact, true); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
@@ -2,6 +2,7 @@ package packer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
@@ -39,9 +40,35 @@ func (p *RegistryPostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui
 	// This is a bit of a hack for now to denote that this pp should just update the state of a build in the Packer registry.
 	// TODO create an actual post-processor that we can embed here that will do the updating and printing.
 	if p.PostProcessor == nil {
-		if parErr := p.ArtifactMetadataPublisher.UpdateBuildStatus(ctx, p.BuilderType, models.HashicorpCloudPackerBuildStatusDONE); parErr != nil {
-			err := fmt.Errorf("[TRACE] failed to update Packer registry with image artifacts for %q: %s", p.BuilderType, parErr)
-			return nil, false, true, err
+		// Labels referencing the data generated by the build are resolved
+		// before publishing them along with the DONE status.
+		generatedData := make(map[string]interface{})
+		switch state := source.State("generated_data").(type) {
+		case map[interface{}]interface{}:
+			for k, v := range state {
+				generatedData[fmt.Sprint(k)] = v
+			}
+		case map[string]interface{}:
+			generatedData = state
+		}
+		if err := p.ArtifactMetadataPublisher.ResolveLabelsForBuild(p.BuilderType, generatedData); err != nil {
+			ui.Error(fmt.Sprintf("Failed to publish the build labels of %q to the HCP Packer registry: %s", p.BuilderType, err))
+		}
+
+		parErr := p.ArtifactMetadataPublisher.UpdateBuildStatus(ctx, p.BuilderType, models.HashicorpCloudPackerBuildStatusDONE)
+		var webhookErr *packerregistry.WebhookError
+		if errors.As(parErr, &webhookErr) {
+			// The build is published, only the notification failed.
+			ui.Error(webhookErr.Error())
+			parErr = nil
+		}
+		if len(p.ArtifactMetadataPublisher.Targets) == 0 {
+			if parErr != nil {
+				err := fmt.Errorf("[TRACE] failed to update Packer registry with image artifacts for %q: %s", p.BuilderType, parErr)
+				return nil, false, true, classifyFailure(err, FailureRegistry)
+			}
+		} else if err := p.publishToTargets(ctx, ui, parErr); err != nil {
+			return nil, false, true, classifyFailure(err, FailureRegistry)
 		}
 
 		r := &RegistryArtifact{
@@ -53,11 +80,9 @@ func (p *RegistryPostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui
 		return r, true, false, nil
 	}
 
-	source, keep, override, err := p.PostProcessor.PostProcess(ctx, ui, source)
+	source, keep, override, err := p.PostProcessor.PostProcess(ctx, ui, p.withIterationStatus(ctx, source))
 	if err != nil {
-		if parErr := p.ArtifactMetadataPublisher.UpdateBuildStatus(ctx, p.BuilderType, models.HashicorpCloudPackerBuildStatusFAILED); parErr != nil {
-			log.Printf("[TRACE] failed to update Packer registry with image artifacts for %q: %s", p.BuilderType, parErr)
-		}
+		markBuildUnsuccessful(ctx, p.ArtifactMetadataPublisher, p.BuilderType)
 		return source, false, false, err
 	}
 
@@ -79,8 +104,96 @@ func (p *RegistryPostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui
 	err = p.ArtifactMetadataPublisher.UpdateImageForBuild(p.BuilderType, images...)
 
 	if err != nil {
-		return source, keep, override, fmt.Errorf("[TRACE] failed to add image artifact for %q: %s", p.BuilderType, err)
+		return source, keep, override, classifyFailure(fmt.Errorf("[TRACE] failed to add image artifact for %q: %s", p.BuilderType, err), FailureRegistry)
+	}
+
+	if err := recordArtifactChecksums(p.ArtifactMetadataPublisher, p.BuilderType, source); err != nil {
+		return source, keep, override, classifyFailure(fmt.Errorf("failed to record the checksums of the artifact of %q: %s", p.BuilderType, err), FailureRegistry)
 	}
 
 	return source, keep, override, nil
 }
+
+// publishToTargets publishes the completed build to the other targets of the
+// bucket, reports the outcome for each target, the HCP Packer registry
+// included, and returns an error when they fail the build according to the
+// failure policy of the bucket. parErr is the error of the HCP Packer
+// registry.
+func (p *RegistryPostProcessor) publishToTargets(ctx context.Context, ui packersdk.Ui, parErr error) error {
+	results := append([]packerregistry.TargetResult{{Target: packerregistry.HCPTargetName, Err: parErr}},
+		p.ArtifactMetadataPublisher.PublishBuildToTargets(ctx, p.BuilderType)...)
+	for _, r := range results {
+		if r.Err != nil {
+			ui.Error(fmt.Sprintf("Failed to publish %q to the %s: %s", p.BuilderType, r.Target, r.Err))
+			continue
+		}
+		ui.Say(fmt.Sprintf("Published %q to the %s", p.BuilderType, r.Target))
+	}
+	return p.ArtifactMetadataPublisher.TargetFailure.Check(results)
+}
+
+// The data generated for the post-processors of the builds published to the
+// HCP Packer registry, like build.HCPIterationID in HCL2 templates, so that
+// they can act upon the status of the iteration.
+const (
+	HCPBucketSlugDataKey        = "HCPBucketSlug"
+	HCPIterationIDDataKey       = "HCPIterationID"
+	HCPBuildStatusesDataKey     = "HCPBuildStatuses"
+	HCPChannelsDataKey          = "HCPChannels"
+	HCPSiblingBuildsDoneDataKey = "HCPSiblingBuildsDone"
+)
+
+// withIterationStatus returns source with the status of the iteration added to
+// the data generated by its build. source is returned as is when the status
+// can't be read.
+func (p *RegistryPostProcessor) withIterationStatus(ctx context.Context, source packersdk.Artifact) packersdk.Artifact {
+	if source == nil {
+		return nil
+	}
+	status, err := p.ArtifactMetadataPublisher.IterationStatus(ctx)
+	if err != nil {
+		log.Printf("[TRACE] failed to read the HCP Packer registry iteration status for %q: %s", p.BuilderType, err)
+		return source
+	}
+
+	generatedData := make(map[interface{}]interface{})
+	switch state := source.State("generated_data").(type) {
+	case map[interface{}]interface{}:
+		for k, v := range state {
+			generatedData[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range state {
+			generatedData[k] = v
+		}
+	}
+	builds := make(map[string]string, len(status.Builds))
+	for name, s := range status.Builds {
+		builds[name] = string(s)
+	}
+	channels := status.Channels
+	if channels == nil {
+		channels = []string{}
+	}
+	generatedData[HCPBucketSlugDataKey] = status.BucketSlug
+	generatedData[HCPIterationIDDataKey] = status.IterationID
+	generatedData[HCPBuildStatusesDataKey] = builds
+	generatedData[HCPChannelsDataKey] = channels
+	generatedData[HCPSiblingBuildsDoneDataKey] = status.SiblingBuildsDone(p.BuilderType)
+
+	return &iterationStatusArtifact{Artifact: source, generatedData: generatedData}
+}
+
+// iterationStatusArtifact is an artifact whose generated data hold the status
+// of the iteration, see withIterationStatus.
+type iterationStatusArtifact struct {
+	packersdk.Artifact
+	generatedData map[interface{}]interface{}
+}
+
+func (a *iterationStatusArtifact) State(name string) interface{} {
+	if name == "generated_data" {
+		return a.generatedData
+	}
+	return a.Artifact.State(name)
+}
@@ -0,0 +1,29 @@
+package registrytest_test
+
+import (
+	"fmt"
+
+	packerSvc "github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/client/packer_service"
+	"github.com/hashicorp/packer/packer/registrytest"
+)
+
+func ExampleMockPackerClientService() {
+	svc := registrytest.NewMockPackerClientService()
+	svc.ExistingBuilds = []string{"amazon-ebs.ubuntu"}
+	svc.BuildAlreadyDone = true
+
+	params := packerSvc.NewPackerServiceListBuildsParams()
+	params.BucketSlug = "ubuntu"
+	params.IterationID = "iteration-id"
+	resp, err := svc.PackerServiceListBuilds(params, nil)
+	if err != nil {
+		panic(err)
+	}
+	for _, build := range resp.Payload.Builds {
+		fmt.Println(build.ComponentType, build.Status)
+	}
+	fmt.Println(svc.ListBuildsCalled)
+	// Output:
+	// amazon-ebs.ubuntu DONE
+	// true
+}
@@ -0,0 +1,442 @@
+// Package registrytest provides a mock of the HCP Packer registry service, to
+// unit test code publishing to or reading from the registry without reaching
+// the HCP API.
+package registrytest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	packerSvc "github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/client/packer_service"
+	"github.com/hashicorp/hcp-sdk-go/clients/cloud-packer-service/preview/2021-04-30/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockPackerClientService is an in-memory packer_service.ClientService. Its
+// XxxCalled fields record the calls made to it, and its other fields configure
+// what the registry holds and how it answers.
+//
+// Only the methods used by Packer are mocked, calling any other method panics.
+// A MockPackerClientService must not be used concurrently.
+type MockPackerClientService struct {
+	CreateBucketCalled, UpdateBucketCalled                 bool
+	CreateIterationCalled, GetIterationCalled              bool
+	CreateBuildCalled, UpdateBuildCalled, ListBuildsCalled bool
+	ListIterationsCalled, UpdateIterationCalled            bool
+	GetBucketCalled, ListBucketsCalled, ListChannelsCalled bool
+	CreateChannelCalled, UpdateChannelCalled               bool
+
+	// BucketAlreadyExist makes CreateBucket fail with an AlreadyExists error,
+	// like when publishing to an existing bucket.
+	BucketAlreadyExist bool
+	// IterationAlreadyExist makes CreateIteration fail with an AlreadyExists
+	// error for the fingerprint of GetIterationResp. GetIteration fails
+	// unless it is set.
+	IterationAlreadyExist bool
+	// IterationCompleted makes GetIteration return a complete iteration,
+	// with a DONE build for the first of ExistingBuilds.
+	IterationCompleted bool
+	// BuildAlreadyDone makes ListBuilds return the ExistingBuilds as DONE.
+	BuildAlreadyDone bool
+
+	// Mock Creates
+	CreateBucketResp    *models.HashicorpCloudPackerCreateBucketResponse
+	CreateIterationResp *models.HashicorpCloudPackerCreateIterationResponse
+	CreateBuildResp     *models.HashicorpCloudPackerCreateBuildResponse
+
+	// Mock Gets
+	GetIterationResp *models.HashicorpCloudPackerGetIterationResponse
+
+	// ExistingBuilds are the component types of the builds returned when
+	// listing the builds of an iteration.
+	ExistingBuilds []string
+	// ExistingBuildLabels are the labels of the ExistingBuilds, by component
+	// type.
+	ExistingBuildLabels map[string]map[string]string
+	// ExistingBuildStatuses are the statuses of the ExistingBuilds returned by
+	// the successive listings of the builds, by component type; the last
+	// status is returned once they are all used. It overrides
+	// BuildAlreadyDone.
+	ExistingBuildStatuses map[string][]models.HashicorpCloudPackerBuildStatus
+	// ListBuildsCount is the number of calls to ListBuilds.
+	ListBuildsCount int
+	// ExistingIterationLabels are labels added to the ExistingBuilds of an
+	// iteration, by iteration ID, like the iteration labels.
+	ExistingIterationLabels map[string]map[string]string
+
+	// ExistingIterations are returned when listing the iterations of a bucket.
+	ExistingIterations []*models.HashicorpCloudPackerIterationforList
+	// ExistingBuckets are returned when listing the buckets of a project.
+	ExistingBuckets []*models.HashicorpCloudPackerBucket
+	// ExistingChannels are returned when listing the channels of a bucket.
+	ExistingChannels []*models.HashicorpCloudPackerChannel
+	// RevokedIterations keeps track of the iterations revoked by calls to UpdateIteration.
+	RevokedIterations []string
+	// BuildUpdates keeps track of the last update of each build, by build ID, made by calls to UpdateBuild.
+	BuildUpdates map[string]*models.HashicorpCloudPackerBuildUpdates
+
+	packerSvc.ClientService
+}
+
+// NewMockPackerClientService returns a MockPackerClientService holding no
+// bucket, with default responses for the created resources.
+func NewMockPackerClientService() *MockPackerClientService {
+	m := MockPackerClientService{
+		ExistingBuilds: make([]string, 0),
+	}
+
+	m.CreateBucketResp = &models.HashicorpCloudPackerCreateBucketResponse{
+		Bucket: &models.HashicorpCloudPackerBucket{
+			ID: "bucket-id",
+		},
+	}
+
+	m.CreateIterationResp = &models.HashicorpCloudPackerCreateIterationResponse{
+		Iteration: &models.HashicorpCloudPackerIteration{
+			ID: "iteration-id",
+		},
+	}
+
+	m.CreateBuildResp = &models.HashicorpCloudPackerCreateBuildResponse{
+		Build: &models.HashicorpCloudPackerBuild{
+			PackerRunUUID: "test-uuid",
+			Status:        models.HashicorpCloudPackerBuildStatusUNSET,
+		},
+	}
+
+	m.GetIterationResp = &models.HashicorpCloudPackerGetIterationResponse{
+		Iteration: &models.HashicorpCloudPackerIteration{
+			ID:     "iteration-id",
+			Builds: make([]*models.HashicorpCloudPackerBuild, 0),
+		},
+	}
+
+	return &m
+}
+
+func (svc *MockPackerClientService) PackerServiceCreateBucket(params *packerSvc.PackerServiceCreateBucketParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceCreateBucketOK, error) {
+	if svc.BucketAlreadyExist {
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Code:%d %s", codes.AlreadyExists, codes.AlreadyExists.String()))
+	}
+
+	if params.Body == nil {
+		return nil, errors.New("No body provided.")
+	}
+	if params.Body.BucketSlug == "" {
+		return nil, errors.New("No bucket slug was passed in")
+	}
+
+	svc.CreateBucketCalled = true
+	// This is set in NewMockPackerClientService()
+	svc.CreateBucketResp.Bucket.Slug = params.Body.BucketSlug
+
+	ok := &packerSvc.PackerServiceCreateBucketOK{
+		Payload: svc.CreateBucketResp,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceUpdateBucket(params *packerSvc.PackerServiceUpdateBucketParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceUpdateBucketOK, error) {
+	svc.UpdateBucketCalled = true
+
+	return packerSvc.NewPackerServiceUpdateBucketOK(), nil
+}
+
+func (svc *MockPackerClientService) PackerServiceCreateIteration(params *packerSvc.PackerServiceCreateIterationParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceCreateIterationOK, error) {
+	if svc.IterationAlreadyExist && params.Body.Fingerprint == svc.GetIterationResp.Iteration.Fingerprint {
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Code:%d %s", codes.AlreadyExists, codes.AlreadyExists.String()))
+	}
+
+	if params.Body.BucketSlug == "" {
+		return nil, errors.New("No valid BucketSlug was passed in")
+	}
+
+	if params.Body.Fingerprint == "" {
+		return nil, errors.New("No valid Fingerprint was passed in")
+	}
+
+	svc.CreateIterationCalled = true
+	svc.CreateIterationResp.Iteration.BucketSlug = params.Body.BucketSlug
+	svc.CreateIterationResp.Iteration.Fingerprint = params.Body.Fingerprint
+
+	ok := &packerSvc.PackerServiceCreateIterationOK{
+		Payload: svc.CreateIterationResp,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceGetIteration(params *packerSvc.PackerServiceGetIterationParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceGetIterationOK, error) {
+	if !svc.IterationAlreadyExist {
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Code:%d %s", codes.Aborted, codes.Aborted.String()))
+	}
+
+	if params.BucketSlug == "" {
+		return nil, errors.New("No valid BucketSlug was passed in")
+	}
+
+	if params.Fingerprint == nil {
+		return nil, errors.New("No valid Fingerprint was passed in")
+	}
+
+	svc.GetIterationCalled = true
+
+	//
+	ok := &packerSvc.PackerServiceGetIterationOK{
+		Payload: svc.GetIterationResp,
+	}
+
+	if svc.IterationCompleted {
+		ok.Payload.Iteration.Complete = true
+		ok.Payload.Iteration.IncrementalVersion = 1
+		ok.Payload.Iteration.Builds = append(ok.Payload.Iteration.Builds, &models.HashicorpCloudPackerBuild{
+			ID:            "build-id",
+			ComponentType: svc.ExistingBuilds[0],
+			Status:        models.HashicorpCloudPackerBuildStatusDONE,
+			Images: []*models.HashicorpCloudPackerImage{
+				{ImageID: "image-id", Region: "somewhere"},
+			},
+		})
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceCreateBuild(params *packerSvc.PackerServiceCreateBuildParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceCreateBuildOK, error) {
+	if params.Body.BucketSlug == "" {
+		return nil, errors.New("No valid BucketSlug was passed in")
+	}
+
+	if params.Body.Fingerprint == "" {
+		return nil, errors.New("No valid Fingerprint was passed in")
+	}
+
+	if params.Body.Build.ComponentType == "" {
+		return nil, errors.New("No build componentType was passed in")
+	}
+
+	svc.CreateBuildCalled = true
+
+	svc.CreateBuildResp.Build.ComponentType = params.Body.Build.ComponentType
+	svc.CreateBuildResp.Build.IterationID = params.IterationID
+
+	ok := packerSvc.NewPackerServiceCreateBuildOK()
+	ok.Payload = svc.CreateBuildResp
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceUpdateBuild(params *packerSvc.PackerServiceUpdateBuildParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceUpdateBuildOK, error) {
+	if params.Body.BuildID == "" {
+		return nil, errors.New("No valid BuildID was passed in")
+	}
+
+	if params.Body.Updates == nil {
+		return nil, errors.New("No valid Updates were passed in")
+	}
+
+	if params.Body.Updates.Status == "" {
+		return nil, errors.New("No build status was passed in")
+	}
+
+	svc.UpdateBuildCalled = true
+	if svc.BuildUpdates == nil {
+		svc.BuildUpdates = make(map[string]*models.HashicorpCloudPackerBuildUpdates)
+	}
+	svc.BuildUpdates[params.Body.BuildID] = params.Body.Updates
+	ok := packerSvc.NewPackerServiceUpdateBuildOK()
+	ok.Payload = &models.HashicorpCloudPackerUpdateBuildResponse{
+		Build: &models.HashicorpCloudPackerBuild{
+			ID: params.Body.BuildID,
+		},
+	}
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceListBuilds(params *packerSvc.PackerServiceListBuildsParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceListBuildsOK, error) {
+	svc.ListBuildsCalled = true
+	svc.ListBuildsCount++
+
+	status := models.HashicorpCloudPackerBuildStatusUNSET
+	images := make([]*models.HashicorpCloudPackerImage, 0)
+	if svc.BuildAlreadyDone {
+		status = models.HashicorpCloudPackerBuildStatusDONE
+		images = append(images, &models.HashicorpCloudPackerImage{ID: "image-id", Region: "somewhere"})
+	}
+
+	builds := make([]*models.HashicorpCloudPackerBuild, 0, len(svc.ExistingBuilds))
+	for i, name := range svc.ExistingBuilds {
+		labels := svc.ExistingBuildLabels[name]
+		if iterationLabels, ok := svc.ExistingIterationLabels[params.IterationID]; ok {
+			labels = make(map[string]string)
+			for k, v := range iterationLabels {
+				labels[k] = v
+			}
+			for k, v := range svc.ExistingBuildLabels[name] {
+				labels[k] = v
+			}
+		}
+		buildStatus := status
+		if statuses := svc.ExistingBuildStatuses[name]; len(statuses) > 0 {
+			call := svc.ListBuildsCount - 1
+			if call >= len(statuses) {
+				call = len(statuses) - 1
+			}
+			buildStatus = statuses[call]
+		}
+		builds = append(builds, &models.HashicorpCloudPackerBuild{
+			ID:            name + "--" + strconv.Itoa(i),
+			ComponentType: name,
+			Status:        buildStatus,
+			Images:        images,
+			Labels:        labels,
+		})
+	}
+
+	ok := packerSvc.NewPackerServiceListBuildsOK()
+	ok.Payload = &models.HashicorpCloudPackerListBuildsResponse{
+		Builds: builds,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceListIterations(params *packerSvc.PackerServiceListIterationsParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceListIterationsOK, error) {
+	if params.BucketSlug == "" {
+		return nil, errors.New("No valid BucketSlug was passed in")
+	}
+
+	svc.ListIterationsCalled = true
+
+	ok := packerSvc.NewPackerServiceListIterationsOK()
+	ok.Payload = &models.HashicorpCloudPackerListIterationsResponse{
+		Iterations: svc.ExistingIterations,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceUpdateIteration(params *packerSvc.PackerServiceUpdateIterationParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceUpdateIterationOK, error) {
+	if params.IterationID == "" {
+		return nil, errors.New("No valid IterationID was passed in")
+	}
+
+	if params.Body == nil {
+		return nil, errors.New("No body provided.")
+	}
+
+	svc.UpdateIterationCalled = true
+	if params.Body.RevokeIn != "" || !time.Time(params.Body.RevokeAt).IsZero() {
+		svc.RevokedIterations = append(svc.RevokedIterations, params.IterationID)
+	}
+
+	ok := packerSvc.NewPackerServiceUpdateIterationOK()
+	ok.Payload = &models.HashicorpCloudPackerUpdateIterationResponse{
+		Iteration: &models.HashicorpCloudPackerIteration{
+			ID: params.IterationID,
+		},
+	}
+
+	return ok, nil
+}
+
+// PackerServiceGetBucket returns the bucket of ExistingBuckets with the
+// requested slug, or fails with a NotFound error.
+func (svc *MockPackerClientService) PackerServiceGetBucket(params *packerSvc.PackerServiceGetBucketParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceGetBucketOK, error) {
+	svc.GetBucketCalled = true
+
+	for _, bucket := range svc.ExistingBuckets {
+		if bucket.Slug == params.BucketSlug {
+			ok := packerSvc.NewPackerServiceGetBucketOK()
+			ok.Payload = &models.HashicorpCloudPackerGetBucketResponse{
+				Bucket: bucket,
+			}
+			return ok, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, fmt.Sprintf("Code:%d %s", codes.NotFound, codes.NotFound.String()))
+}
+
+func (svc *MockPackerClientService) PackerServiceListBuckets(params *packerSvc.PackerServiceListBucketsParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceListBucketsOK, error) {
+	svc.ListBucketsCalled = true
+
+	ok := packerSvc.NewPackerServiceListBucketsOK()
+	ok.Payload = &models.HashicorpCloudPackerListBucketsResponse{
+		Buckets: svc.ExistingBuckets,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceListChannels(params *packerSvc.PackerServiceListChannelsParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceListChannelsOK, error) {
+	if params.BucketSlug == "" {
+		return nil, errors.New("No valid BucketSlug was passed in")
+	}
+
+	svc.ListChannelsCalled = true
+
+	ok := packerSvc.NewPackerServiceListChannelsOK()
+	ok.Payload = &models.HashicorpCloudPackerListChannelsResponse{
+		Channels: svc.ExistingChannels,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceCreateChannel(params *packerSvc.PackerServiceCreateChannelParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceCreateChannelOK, error) {
+	if params.BucketSlug == "" {
+		return nil, errors.New("No valid BucketSlug was passed in")
+	}
+
+	if params.Body == nil {
+		return nil, errors.New("No body provided.")
+	}
+
+	svc.CreateChannelCalled = true
+	channel := &models.HashicorpCloudPackerChannel{
+		BucketSlug: params.BucketSlug,
+		Slug:       params.Body.Slug,
+		Iteration:  &models.HashicorpCloudPackerIteration{ID: params.Body.IterationID},
+	}
+	svc.ExistingChannels = append(svc.ExistingChannels, channel)
+
+	ok := packerSvc.NewPackerServiceCreateChannelOK()
+	ok.Payload = &models.HashicorpCloudPackerCreateChannelResponse{
+		Channel: channel,
+	}
+
+	return ok, nil
+}
+
+func (svc *MockPackerClientService) PackerServiceUpdateChannel(params *packerSvc.PackerServiceUpdateChannelParams, _ runtime.ClientAuthInfoWriter) (*packerSvc.PackerServiceUpdateChannelOK, error) {
+	if params.BucketSlug == "" || params.Slug == "" {
+		return nil, errors.New("No valid BucketSlug or Slug was passed in")
+	}
+
+	if params.Body == nil {
+		return nil, errors.New("No body provided.")
+	}
+
+	svc.UpdateChannelCalled = true
+	for i, channel := range svc.ExistingChannels {
+		if channel.Slug != params.Slug {
+			continue
+		}
+		updated := *channel
+		updated.Iteration = &models.HashicorpCloudPackerIteration{ID: params.Body.IterationID}
+		svc.ExistingChannels[i] = &updated
+
+		ok := packerSvc.NewPackerServiceUpdateChannelOK()
+		ok.Payload = &models.HashicorpCloudPackerUpdateChannelResponse{
+			Channel: &updated,
+		}
+		return ok, nil
+	}
+
+	return nil, status.Error(codes.NotFound, fmt.Sprintf("Code:%d %s", codes.NotFound, codes.NotFound.String()))
+}
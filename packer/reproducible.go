@@ -0,0 +1,15 @@
+package packer
+
+import "os"
+
+// SourceDateEpochEnvVar is the environment variable the reproducible builds
+// tooling sets to the timestamp to use instead of the current time. Packer
+// runs in reproducible mode when it is set.
+const SourceDateEpochEnvVar = "SOURCE_DATE_EPOCH"
+
+// Reproducible tells whether Packer runs in reproducible mode, see
+// SourceDateEpochEnvVar.
+func Reproducible() bool {
+	_, ok := os.LookupEnv(SourceDateEpochEnvVar)
+	return ok
+}
@@ -0,0 +1,111 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ErrCleanupUnsupported is returned by PluginConfig.ResourceCleaner when the
+// builder cannot destroy the resources it left behind.
+var ErrCleanupUnsupported = errors.New("the builder does not support cleanup")
+
+// ResourceCleaner is implemented by builders able to destroy the resources
+// they reported creating, see ResourceMachineType, once the builds that
+// created them are over. `packer cleanup` uses it to destroy the resources
+// recorded in the ResourceLedger.
+type ResourceCleaner interface {
+	// CleanupResources destroys resources and returns the ones destroyed,
+	// along with an error when some could not be.
+	CleanupResources(ctx context.Context, ui packersdk.Ui, resources []TrackedResource) ([]TrackedResource, error)
+}
+
+// builderPlugin is a builder of a multi-component plugin.
+type builderPlugin struct {
+	path string
+	name string
+}
+
+// pluginResourceCleaner is the ResourceCleaner of a builder of a
+// multi-component plugin. The builder RPC server of the plugins cannot be
+// extended, so the plugin is run as
+//
+//	<plugin> cleanup builder <name>
+//
+// with the resources to destroy as JSON on its standard input, and writes the
+// resources it destroyed as JSON on its standard output, in the format of the
+// ledger. The messages it writes on its standard error are shown. A plugin not
+// supporting cleanup fails, or writes something else.
+type pluginResourceCleaner struct {
+	builderPlugin
+}
+
+type pluginCleanupResult struct {
+	Destroyed []TrackedResource `json:"destroyed"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func (p *pluginResourceCleaner) CleanupResources(ctx context.Context, ui packersdk.Ui, resources []TrackedResource) ([]TrackedResource, error) {
+	in, err := json.Marshal(resources)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.path, "cleanup", "builder", p.name)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if line != "" {
+			ui.Message(line)
+		}
+	}
+
+	var res pluginCleanupResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		log.Printf("[TRACE] %s cleanup builder %s: %v, %s", p.path, p.name, runErr, err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrCleanupUnsupported
+	}
+	if res.Error != "" {
+		return res.Destroyed, errors.New(res.Error)
+	}
+	if runErr != nil {
+		return res.Destroyed, runErr
+	}
+	return res.Destroyed, nil
+}
+
+// ResourceCleaner returns the ResourceCleaner of the builder builderType, or
+// ErrCleanupUnsupported when the builder has none.
+func (c *PluginConfig) ResourceCleaner(builderType string) (ResourceCleaner, error) {
+	if p, ok := c.builderPlugins[builderType]; ok {
+		return &pluginResourceCleaner{builderPlugin: p}, nil
+	}
+	if c.Builders == nil || !c.Builders.Has(builderType) {
+		return nil, fmt.Errorf("unknown builder %q", builderType)
+	}
+	builder, err := c.Builders.Start(builderType)
+	if err != nil {
+		return nil, err
+	}
+	if rb, ok := builder.(*RegistryBuilder); ok {
+		builder = rb.Builder
+	}
+	cleaner, ok := builder.(ResourceCleaner)
+	if !ok {
+		return nil, ErrCleanupUnsupported
+	}
+	return cleaner, nil
+}
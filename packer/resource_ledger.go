@@ -0,0 +1,301 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/pathing"
+)
+
+// ResourceLedgerEnvVar, when set, is the path of the resource ledger used
+// instead of the one in the Packer config directory.
+const ResourceLedgerEnvVar = "PACKER_RESOURCE_LEDGER"
+
+// The machine-readable messages a builder sends to report the resources it
+// creates while building, like instances, key pairs or temporary security
+// groups, and the ones it destroys:
+//
+//	ui.Machine(ResourceMachineType, ResourceCreated, kind, id[, region])
+//	ui.Machine(ResourceMachineType, ResourceDeleted, kind, id[, region])
+//
+// The resources created and not deleted are left behind, and recorded in the
+// ResourceLedger until `packer cleanup` destroys them.
+const (
+	ResourceMachineType = "resource"
+	ResourceCreated     = "created"
+	ResourceDeleted     = "deleted"
+)
+
+// TrackedResource is a resource created by a builder, recorded in a
+// ResourceLedger.
+type TrackedResource struct {
+	BuilderType string `json:"builder_type"`
+	Kind        string `json:"kind"`
+	ID          string `json:"id"`
+	Region      string `json:"region,omitempty"`
+	// Build is the name of the build that created the resource.
+	Build string `json:"build"`
+	// RunUUID identifies the Packer run of the build, see
+	// ResourceLedger.HoldRun.
+	RunUUID   string    `json:"run_uuid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r TrackedResource) String() string {
+	s := fmt.Sprintf("%s %s", r.Kind, r.ID)
+	if r.Region != "" {
+		s += " in " + r.Region
+	}
+	return s
+}
+
+// same tells whether r and o are the same resource.
+func (r TrackedResource) same(o TrackedResource) bool {
+	return r.BuilderType == o.BuilderType && r.Kind == o.Kind && r.ID == o.ID && r.Region == o.Region
+}
+
+// ResourceLedger records the resources created by the builds of all the Packer
+// runs of the machine, until the builders report them destroyed, so that the
+// resources left behind by interrupted builds can be destroyed later by
+// `packer cleanup`. It is a JSON file, locked while it is updated so that
+// concurrent runs can share it.
+type ResourceLedger struct {
+	Path string
+}
+
+// DefaultResourceLedger returns the ledger set by ResourceLedgerEnvVar, or
+// else resources.json in the Packer config directory.
+func DefaultResourceLedger() (*ResourceLedger, error) {
+	if path := os.Getenv(ResourceLedgerEnvVar); path != "" {
+		return &ResourceLedger{Path: path}, nil
+	}
+	dir, err := pathing.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &ResourceLedger{Path: filepath.Join(dir, "resources.json")}, nil
+}
+
+// List returns the resources of the ledger, oldest first.
+func (l *ResourceLedger) List() ([]TrackedResource, error) {
+	lock, err := l.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return l.read()
+}
+
+// Add records r in the ledger.
+func (l *ResourceLedger) Add(r TrackedResource) error {
+	return l.update(func(resources []TrackedResource) []TrackedResource {
+		for _, existing := range resources {
+			if existing.same(r) {
+				return resources
+			}
+		}
+		return append(resources, r)
+	})
+}
+
+// Remove forgets rs, once they are destroyed.
+func (l *ResourceLedger) Remove(rs ...TrackedResource) error {
+	return l.update(func(resources []TrackedResource) []TrackedResource {
+		kept := resources[:0]
+		for _, existing := range resources {
+			removed := false
+			for _, r := range rs {
+				if existing.same(r) {
+					removed = true
+					break
+				}
+			}
+			if !removed {
+				kept = append(kept, existing)
+			}
+		}
+		return kept
+	})
+}
+
+func (l *ResourceLedger) lock() (*flock.Flock, error) {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return nil, err
+	}
+	lock := flock.New(l.Path + ".lock")
+	if err := lock.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock the resource ledger %s: %s", l.Path, err)
+	}
+	return lock, nil
+}
+
+// read returns the resources of the ledger, none when it does not exist. The
+// ledger must be locked.
+func (l *ResourceLedger) read() ([]TrackedResource, error) {
+	b, err := ioutil.ReadFile(l.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resources []TrackedResource
+	if err := json.Unmarshal(b, &resources); err != nil {
+		return nil, fmt.Errorf("failed to read the resource ledger %s: %s", l.Path, err)
+	}
+	return resources, nil
+}
+
+// update replaces the resources of the ledger with the ones returned by fn.
+func (l *ResourceLedger) update(fn func([]TrackedResource) []TrackedResource) error {
+	lock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	resources, err := l.read()
+	if err != nil {
+		return err
+	}
+	resources = fn(resources)
+	if len(resources) == 0 {
+		if err := os.Remove(l.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(resources, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written aside then renamed, so that the ledger is never left truncated.
+	tmp := l.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.Path)
+}
+
+// runLockPath returns the file locked by the run runUUID while it builds.
+func (l *ResourceLedger) runLockPath(runUUID string) string {
+	return filepath.Join(l.Path+".runs", runUUID+".lock")
+}
+
+// HoldRun locks the run runUUID until release is called, or until the process
+// exits, so that `packer cleanup` leaves the resources of its running builds
+// alone, see RunActive.
+func (l *ResourceLedger) HoldRun(runUUID string) (release func(), err error) {
+	path := l.runLockPath(runUUID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	lock := flock.New(path)
+	if err := lock.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %s", path, err)
+	}
+	return func() {
+		lock.Unlock()
+		os.Remove(path)
+	}, nil
+}
+
+// RunActive tells whether the run runUUID is still building, its lock being
+// held.
+func (l *ResourceLedger) RunActive(runUUID string) bool {
+	path := l.runLockPath(runUUID)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	lock := flock.New(path)
+	locked, err := lock.TryLock()
+	if err != nil {
+		log.Printf("[WARN] failed to check whether run %s is active: %s", runUUID, err)
+		return true
+	}
+	if !locked {
+		return true
+	}
+	lock.Unlock()
+	// The run is over, its lock is stale.
+	os.Remove(path)
+	return false
+}
+
+// resourceTrackingUi records in a ResourceLedger the resources the builder of
+// a build reports creating and destroying, see ResourceMachineType.
+type resourceTrackingUi struct {
+	packersdk.Ui
+
+	ledger      *ResourceLedger
+	build       string
+	builderType string
+	runUUID     string
+}
+
+var _ packersdk.Ui = new(resourceTrackingUi)
+
+func (u *resourceTrackingUi) Machine(category string, args ...string) {
+	u.Ui.Machine(category, args...)
+	if category != ResourceMachineType {
+		return
+	}
+	if len(args) < 3 {
+		log.Printf("[WARN] ignoring the malformed resource message %q", strings.Join(args, ","))
+		return
+	}
+	r := TrackedResource{
+		BuilderType: u.builderType,
+		Kind:        args[1],
+		ID:          args[2],
+		Build:       u.build,
+		RunUUID:     u.runUUID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if len(args) > 3 {
+		r.Region = args[3]
+	}
+
+	var err error
+	switch args[0] {
+	case ResourceCreated:
+		err = u.ledger.Add(r)
+	case ResourceDeleted:
+		err = u.ledger.Remove(r)
+	default:
+		log.Printf("[WARN] ignoring the resource message %q", strings.Join(args, ","))
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to record %s %s in the resource ledger: %s", args[0], r, err)
+	}
+}
+
+// trackResources returns ui recording the resources created by the builder of
+// b, when b has a ResourceLedger.
+func (b *CoreBuild) trackResources(ui packersdk.Ui) packersdk.Ui {
+	if b.ResourceLedger == nil {
+		return ui
+	}
+	builderType := b.BuilderType
+	if builderType == "" {
+		// The type of an HCL2 build is the source type followed by its name.
+		builderType = strings.SplitN(b.Type, ".", 2)[0]
+	}
+	return &resourceTrackingUi{
+		Ui:          ui,
+		ledger:      b.ResourceLedger,
+		build:       b.Name(),
+		builderType: builderType,
+		// Retried attempts have run UUIDs of their own, but the resources
+		// belong to the run of the process, see ResourceLedger.HoldRun.
+		runUUID: os.Getenv("PACKER_RUN_UUID"),
+	}
+}
@@ -0,0 +1,59 @@
+package packer
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestResourceTrackingUi(t *testing.T) {
+	ledger := &ResourceLedger{Path: filepath.Join(t.TempDir(), "resources.json")}
+	t.Setenv("PACKER_RUN_UUID", "run-1")
+	b := &CoreBuild{Type: "amazon-ebs.ubuntu", ResourceLedger: ledger}
+	ui := b.trackResources(packersdk.TestUi(t))
+
+	ui.Machine(ResourceMachineType, ResourceCreated, "instance", "i-1", "eu-west-1")
+	ui.Machine(ResourceMachineType, ResourceCreated, "key_pair", "kp-1")
+	ui.Machine(ResourceMachineType, ResourceCreated, "instance", "i-1", "eu-west-1")
+	ui.Machine(ResourceMachineType, ResourceDeleted, "key_pair", "kp-1")
+	ui.Machine("artifact", "0", "id", "ami-1")
+
+	resources, err := ledger.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 {
+		t.Fatalf("expected only the instance to be left, got %v", resources)
+	}
+	r := resources[0]
+	want := TrackedResource{BuilderType: "amazon-ebs", Kind: "instance", ID: "i-1", Region: "eu-west-1",
+		Build: "amazon-ebs.ubuntu", RunUUID: "run-1", CreatedAt: r.CreatedAt}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("expected %#v, got %#v", want, r)
+	}
+
+	ui.Machine(ResourceMachineType, ResourceDeleted, "instance", "i-1", "eu-west-1")
+	if resources, _ := ledger.List(); len(resources) != 0 {
+		t.Errorf("expected the ledger to be empty, got %v", resources)
+	}
+}
+
+func TestResourceLedger_RunActive(t *testing.T) {
+	ledger := &ResourceLedger{Path: filepath.Join(t.TempDir(), "resources.json")}
+	if ledger.RunActive("run-1") {
+		t.Fatal("expected an unknown run not to be active")
+	}
+	release, err := ledger.HoldRun("run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ledger.RunActive("run-1") {
+		t.Error("expected the held run to be active")
+	}
+	release()
+	if ledger.RunActive("run-1") {
+		t.Error("expected the released run not to be active")
+	}
+}
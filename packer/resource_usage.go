@@ -0,0 +1,220 @@
+package packer
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// DefaultResourceSampleInterval is how often a ResourceMonitor samples the
+// processes by default.
+const DefaultResourceSampleInterval = 2 * time.Second
+
+// ResourceUsage is what a build, or a whole run, used of the machine running
+// Packer.
+type ResourceUsage struct {
+	// CPUTime is the user and system CPU time of the processes.
+	CPUTime time.Duration
+	// PeakMemory is the highest resident memory of the processes sampled, in
+	// bytes.
+	PeakMemory uint64
+	// NetSent and NetReceived are the bytes sent and received by the network
+	// interfaces of the machine while the build ran, including the traffic of
+	// the builds running at the same time.
+	NetSent     uint64
+	NetReceived uint64
+}
+
+// ResourceMonitor samples the CPU and memory used by the plugin processes of
+// each build, see PluginConfig.AttributeProcesses, and by the Packer process
+// itself.
+type ResourceMonitor struct {
+	// Plugins tells the plugin processes of the builds.
+	Plugins *PluginConfig
+	// Interval is how often the processes are sampled, the default is
+	// DefaultResourceSampleInterval.
+	Interval time.Duration
+
+	mu       sync.Mutex
+	builds   map[string]*buildResources
+	packer   processResources
+	peak     uint64
+	netStart net.IOCountersStat
+}
+
+// processResources are the samples of a set of processes.
+type processResources struct {
+	// cpu is the last CPU time sampled per process: the processes exiting
+	// keep the CPU time of their last sample.
+	cpu  map[int32]time.Duration
+	peak uint64
+}
+
+type buildResources struct {
+	processResources
+	running  bool
+	netStart net.IOCountersStat
+	usage    ResourceUsage
+}
+
+// NewResourceMonitor returns a monitor of the builds of plugins.
+func NewResourceMonitor(plugins *PluginConfig) *ResourceMonitor {
+	return &ResourceMonitor{
+		Plugins:  plugins,
+		Interval: DefaultResourceSampleInterval,
+		builds:   map[string]*buildResources{},
+		packer:   processResources{cpu: map[int32]time.Duration{}},
+		netStart: netCounters(),
+	}
+}
+
+// Run samples the processes until ctx is done.
+func (m *ResourceMonitor) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultResourceSampleInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sample()
+		}
+	}
+}
+
+// BuildStarted starts sampling the processes of the named build.
+func (m *ResourceMonitor) BuildStarted(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builds[name] = &buildResources{
+		processResources: processResources{cpu: map[int32]time.Duration{}},
+		running:          true,
+		netStart:         netCounters(),
+	}
+}
+
+// BuildDone stops sampling the processes of the named build, once sampled a
+// last time.
+func (m *ResourceMonitor) BuildDone(name string) {
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.builds[name]
+	if !ok {
+		return
+	}
+	b.running = false
+	sent, received := netDelta(b.netStart, netCounters())
+	b.usage = ResourceUsage{
+		CPUTime:     b.cpuTime(),
+		PeakMemory:  b.peak,
+		NetSent:     sent,
+		NetReceived: received,
+	}
+}
+
+// Usage returns what the named build used, once done.
+func (m *ResourceMonitor) Usage(name string) (ResourceUsage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.builds[name]
+	if !ok || b.running {
+		return ResourceUsage{}, false
+	}
+	return b.usage, true
+}
+
+// Total returns what the Packer process and the plugin processes of the
+// builds used since the monitor was created.
+func (m *ResourceMonitor) Total() ResourceUsage {
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := ResourceUsage{CPUTime: m.packer.cpuTime(), PeakMemory: m.peak}
+	for _, b := range m.builds {
+		total.CPUTime += b.cpuTime()
+	}
+	total.NetSent, total.NetReceived = netDelta(m.netStart, netCounters())
+	return total
+}
+
+// sample samples the Packer process and the plugin processes of the running
+// builds.
+func (m *ResourceMonitor) sample() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	memory := m.packer.sample([]int32{int32(os.Getpid())})
+	for name, b := range m.builds {
+		if !b.running {
+			continue
+		}
+		var pids []int32
+		if m.Plugins != nil {
+			pids = m.Plugins.BuildProcesses(name)
+		}
+		memory += b.sample(pids)
+	}
+	if memory > m.peak {
+		m.peak = memory
+	}
+}
+
+// sample samples pids and returns their resident memory.
+func (r *processResources) sample(pids []int32) uint64 {
+	var memory uint64
+	for _, pid := range pids {
+		p, err := process.NewProcess(pid)
+		if err != nil {
+			// The process exited.
+			continue
+		}
+		if times, err := p.Times(); err == nil {
+			r.cpu[pid] = time.Duration((times.User + times.System) * float64(time.Second))
+		}
+		if info, err := p.MemoryInfo(); err == nil {
+			memory += info.RSS
+		}
+	}
+	if memory > r.peak {
+		r.peak = memory
+	}
+	return memory
+}
+
+func (r *processResources) cpuTime() time.Duration {
+	var total time.Duration
+	for _, d := range r.cpu {
+		total += d
+	}
+	return total
+}
+
+// netCounters returns the counters of all the network interfaces of the
+// machine.
+func netCounters() net.IOCountersStat {
+	counters, err := net.IOCounters(false)
+	if err != nil || len(counters) == 0 {
+		log.Printf("[DEBUG] failed to read the network counters: %v", err)
+		return net.IOCountersStat{}
+	}
+	return counters[0]
+}
+
+func netDelta(start, end net.IOCountersStat) (sent, received uint64) {
+	if end.BytesSent >= start.BytesSent {
+		sent = end.BytesSent - start.BytesSent
+	}
+	if end.BytesRecv >= start.BytesRecv {
+		received = end.BytesRecv - start.BytesRecv
+	}
+	return sent, received
+}
@@ -0,0 +1,52 @@
+package packer
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestResourceMonitor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test process needs sh")
+	}
+	plugins := &PluginConfig{}
+	plugins.AttributeProcesses("busy")
+	monitor := NewResourceMonitor(plugins)
+
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 200000 ]; do i=$((i+1)); done; sleep 60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	plugins.processes.add("busy", cmd.Process.Pid)
+
+	monitor.BuildStarted("busy")
+	monitor.BuildStarted("idle")
+	if _, ok := monitor.Usage("busy"); ok {
+		t.Fatal("expected no usage for a running build")
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		monitor.sample()
+		if monitor.builds["busy"].cpuTime() > 0 {
+			break
+		}
+	}
+	monitor.BuildDone("busy")
+	monitor.BuildDone("idle")
+
+	busy, ok := monitor.Usage("busy")
+	if !ok || busy.CPUTime == 0 || busy.PeakMemory == 0 {
+		t.Errorf("expected the CPU and memory of the busy build to be sampled, got %#v", busy)
+	}
+	if idle, _ := monitor.Usage("idle"); idle.CPUTime != 0 || idle.PeakMemory != 0 {
+		t.Errorf("expected the build without plugin processes to use nothing, got %#v", idle)
+	}
+	if total := monitor.Total(); total.CPUTime < busy.CPUTime || total.PeakMemory <= busy.PeakMemory {
+		t.Errorf("expected the total to include the busy build and Packer, got %#v", total)
+	}
+}
@@ -1,18 +1,46 @@
 package packer
 
 import (
+	"context"
+
 	"github.com/hashicorp/hcl/v2"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	packerregistry "github.com/hashicorp/packer/internal/registry"
 	plugingetter "github.com/hashicorp/packer/packer/plugin-getter"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type GetBuildsOptions struct {
 	// Get builds except the ones that match with except and with only the ones
-	// that match with Only. When those are empty everything matches.
+	// that match with Only. When those are empty everything matches. In HCL2
+	// templates, the patterns prefixed with tag: match the tags of the builds.
 	Except, Only []string
+	// Tags only keeps the builds tagged with all of them.
+	Tags         []string
 	Debug, Force bool
-	OnError      string
+	// ForceDeregister sets force_deregister on builders supporting it, so
+	// that existing cloud images conflicting with the build are deregistered.
+	ForceDeregister bool
+	OnError         string
+	// OnErrorRetries is how many times a failed provisioner or
+	// post-processor runs again with OnError set to retry.
+	OnErrorRetries int
+	// Incremental snapshots the machines between provisioners, with the
+	// builders supporting it, and resumes from the last unchanged snapshot.
+	Incremental bool
+	// FromStage makes incremental builds resume from the snapshot taken
+	// before the named stage.
+	FromStage string
+	// HashInputs computes the input hashes of the builds even when they are
+	// not incremental, see CoreBuild.InputHash.
+	HashInputs bool
+	// TempDirRoot is where the scratch directory of each build is created,
+	// see CoreBuild.TempDir. Defaults to the system temporary directory.
+	TempDirRoot string
+	// TargetHost, when set, runs the provisioners of the builds against the
+	// existing machine at this address instead of running their builders,
+	// see ProvisionOnlyBuilder.
+	TargetHost string
 
 	// count only/except match count; so say something when nothing matched.
 	ExceptMatches, OnlyMatches int
@@ -30,6 +58,10 @@ type Evaluator interface {
 	// It parses the input string and returns what needs to be displayed. In
 	// case of an error the error should be displayed.
 	EvaluateExpression(expr string) (output string, exit bool, diags hcl.Diagnostics)
+	// EvaluateExpressionsFile evaluates the named expressions of the file at
+	// path, its attributes like `name = expr`, and returns their values by
+	// name. It is meant to be used by `packer console -file`.
+	EvaluateExpressionsFile(path string) (map[string]cty.Value, hcl.Diagnostics)
 }
 
 type InitializeOptions struct {
@@ -52,6 +84,55 @@ type Handler interface {
 	ConfigFixer
 	ConfigInspector
 	HCPHandler
+	AssetsFetcher
+	HTTPServersStarter
+	SecretScanner
+	TemplateSnapshotter
+	VariablesChecker
+}
+
+type VariablesChecker interface {
+	// InvalidVariables tells whether the errors of parsing or initializing
+	// the config include variables without a value or with an invalid one,
+	// to tell variable failures apart from template failures.
+	InvalidVariables() bool
+}
+
+type TemplateSnapshotter interface {
+	// SnapshotTemplate returns a copy of the template files and var files,
+	// and the values of the variables, with the sensitive values redacted.
+	SnapshotTemplate() (*TemplateSnapshot, hcl.Diagnostics)
+}
+
+type SecretScanner interface {
+	// ScanSecrets returns a warning for each value of the config that looks
+	// like a secret written in clear, like a password or an access key.
+	ScanSecrets() hcl.Diagnostics
+}
+
+type FetchAssetsOptions struct {
+	Ui packersdk.Ui
+	// Builds are the names of the builds that run: only the assets they
+	// reference are fetched. All the assets are fetched when nil.
+	Builds []string
+}
+
+type AssetsFetcher interface {
+	// FetchAssets downloads and verifies the external files declared in the
+	// config, so that builds can use them from the cache.
+	FetchAssets(context.Context, FetchAssetsOptions) hcl.Diagnostics
+}
+
+type StartHTTPServersOptions struct {
+	Ui packersdk.Ui
+}
+
+type HTTPServersStarter interface {
+	// StartHTTPServers starts the HTTP servers declared in the config, which
+	// serve files to the machines being built until ctx is done. They are
+	// started before the builds are prepared, for the builds to use their
+	// URLs.
+	StartHTTPServers(context.Context, StartHTTPServersOptions) hcl.Diagnostics
 }
 
 // The HCPHandler handles Packer things needed for communicating with a HCP Packer Registry.
@@ -0,0 +1,401 @@
+package packer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Snapshotter is implemented by builders able to capture the machine they
+// build between provisioners, and to start a later build from such a capture
+// instead of their configured source. Incremental builds use it to skip the
+// stages of a build whose inputs did not change since a previous run.
+type Snapshotter interface {
+	// Snapshot captures the current state of the machine being built, once
+	// the provisioners of the named stage ran. It returns an ID identifying
+	// the snapshot for ResumeFrom.
+	Snapshot(ctx context.Context, ui packersdk.Ui, stage string) (string, error)
+	// ResumeFrom makes the next Run of the builder start from the machine
+	// captured by a previous Snapshot. It is called before Run.
+	ResumeFrom(snapshotID string) error
+}
+
+// snapshotter returns the Snapshotter capability of b, looking through the
+// builders wrapped by the core.
+func snapshotter(b packersdk.Builder) (Snapshotter, bool) {
+	if rb, ok := b.(*RegistryBuilder); ok {
+		b = rb.Builder
+	}
+	s, ok := b.(Snapshotter)
+	return s, ok
+}
+
+// SupportsSnapshots tells whether builder b is able to snapshot the machine it
+// builds, and so to run incremental builds.
+func SupportsSnapshots(b packersdk.Builder) bool {
+	_, ok := snapshotter(b)
+	return ok
+}
+
+// InputHash returns a hash of the configuration of a component, identifying
+// the inputs of a build stage. The strings of config naming local files
+// contribute the content of the files, so that changing a script invalidates
+// the stages running it.
+func InputHash(componentType string, config interface{}) (string, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the configuration of %s: %s", componentType, err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", componentType, raw)
+
+	files := map[string]bool{}
+	collectFiles(normalized, files)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file %s\n", path)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// collectFiles records the strings of v that are the path of a local file.
+func collectFiles(v interface{}, files map[string]bool) {
+	switch v := v.(type) {
+	case string:
+		if v == "" || len(v) > 4096 {
+			return
+		}
+		if info, err := os.Stat(v); err == nil && info.Mode().IsRegular() {
+			files[v] = true
+		}
+	case []interface{}:
+		for _, e := range v {
+			collectFiles(e, files)
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			collectFiles(e, files)
+		}
+	}
+}
+
+// hashInputs sets the input hashes of the builder and the provisioners of a
+// build from a JSON template.
+func (b *CoreBuild) hashInputs() error {
+	var err error
+	if b.BuilderInputHash, err = InputHash(b.BuilderType, b.BuilderConfig); err != nil {
+		return err
+	}
+	for i, p := range b.Provisioners {
+		if b.Provisioners[i].InputHash, err = InputHash(p.PType, p.config); err != nil {
+			return err
+		}
+	}
+	configs := make([][]interface{}, 0, len(b.PostProcessors))
+	for _, seq := range b.PostProcessors {
+		seqConfigs := make([]interface{}, 0, len(seq))
+		for _, pp := range seq {
+			seqConfigs = append(seqConfigs, map[string]interface{}{"type": pp.PType, "config": pp.config})
+		}
+		configs = append(configs, seqConfigs)
+	}
+	b.PostProcessorsInputHash, err = InputHash("post-processors", configs)
+	return err
+}
+
+// InputHash identifies all the inputs of the build: the configuration of its
+// builder, provisioners and post-processors, and the files they use. The input
+// hashes of the build are only set with GetBuildsOptions.HashInputs or
+// Incremental.
+func (b *CoreBuild) InputHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "builder %s\n", b.BuilderInputHash)
+	for _, p := range b.Provisioners {
+		fmt.Fprintf(h, "provisioner %s\n", p.InputHash)
+	}
+	fmt.Fprintf(h, "post-processors %s\n", b.PostProcessorsInputHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Stage is a group of consecutive provisioners of a build, after which the
+// machine can be snapshotted.
+type Stage struct {
+	Name string
+	// Provisioners is the number of provisioners of the stage.
+	Provisioners int
+	// InputHash identifies the inputs of the stage and of all the stages
+	// before it.
+	InputHash string
+}
+
+// StageCache records the snapshots taken after the stages of a build, by the
+// hash of their inputs, so that a later run can resume from the last stage
+// that did not change.
+type StageCache struct {
+	// Path is the JSON file holding the cache.
+	Path string
+}
+
+// StageSnapshot is a snapshot recorded in a StageCache.
+type StageSnapshot struct {
+	Stage      string    `json:"stage"`
+	InputHash  string    `json:"input_hash"`
+	SnapshotID string    `json:"snapshot_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewStageCache returns the stage cache of the named build, in the Packer
+// cache directory.
+func NewStageCache(build string) (*StageCache, error) {
+	path, err := packersdk.CachePath("stages", build+".json")
+	if err != nil {
+		return nil, err
+	}
+	return &StageCache{Path: path}, nil
+}
+
+// Load returns the snapshots of the cache, in the order of the stages. An
+// empty list is returned when the cache does not exist yet.
+func (c *StageCache) Load() ([]StageSnapshot, error) {
+	raw, err := os.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []StageSnapshot
+	if err := json.Unmarshal(raw, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to read the stage cache %s: %s", c.Path, err)
+	}
+	return snapshots, nil
+}
+
+// Record records the snapshot of the stage at index, forgetting the snapshots
+// of the stages after it since they were taken from a different machine.
+func (c *StageCache) Record(index int, snapshot StageSnapshot) error {
+	snapshots, err := c.Load()
+	if err != nil {
+		return err
+	}
+	if index > len(snapshots) {
+		return fmt.Errorf("cannot record the snapshot of stage %d, only %d stages are cached", index, len(snapshots))
+	}
+	snapshots = append(snapshots[:index], snapshot)
+
+	raw, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.Path, append(raw, '\n'), 0644)
+}
+
+// StagePlan drives the stages of a build, and the snapshots taken between them
+// by incremental builds.
+type StagePlan struct {
+	// Snapshotter and Cache are only set for incremental builds whose builder
+	// can snapshot.
+	Snapshotter Snapshotter
+	Cache       *StageCache
+	Stages      []Stage
+	// Resumed is the number of stages restored from a snapshot, their
+	// provisioners are skipped.
+	Resumed int
+
+	// failed is set once a snapshot failed: the snapshots of the next stages
+	// could not be resumed from.
+	failed bool
+}
+
+// hasStages tells whether provisioners of b are grouped in named stages.
+func (b *CoreBuild) hasStages() bool {
+	for _, p := range b.Provisioners {
+		if p.Stage != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// stages returns the stages of b: the consecutive provisioners of a named stage
+// are grouped, and every other provisioner is a stage of its own, named after
+// it.
+func (b *CoreBuild) stages() []Stage {
+	var stages []Stage
+	// Each stage hashes the stages before it, the first one hashes the
+	// builder.
+	previous := b.BuilderInputHash
+	for i, p := range b.Provisioners {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\n%s\n", previous, p.InputHash)
+		previous = hex.EncodeToString(h.Sum(nil))
+
+		if p.Stage != "" && i > 0 && b.Provisioners[i-1].Stage == p.Stage {
+			stage := &stages[len(stages)-1]
+			stage.Provisioners++
+			stage.InputHash = previous
+			continue
+		}
+
+		name := p.Stage
+		if name == "" {
+			name = p.PName
+		}
+		if name == "" {
+			name = p.PType
+		}
+		stages = append(stages, Stage{Name: name, Provisioners: 1, InputHash: previous})
+	}
+	return stages
+}
+
+// planStages returns the stage plan of an incremental build, resuming the
+// builder from the last stage whose inputs did not change, or from the stage
+// set with SetFromStage. When the builder cannot snapshot, the stages are run
+// without snapshots; an error is returned if a stage was explicitly targeted.
+func (b *CoreBuild) planStages(ui packersdk.Ui) (*StagePlan, error) {
+	plan := &StagePlan{Stages: b.stages()}
+
+	from := -1
+	if b.fromStage != "" {
+		for i, stage := range plan.Stages {
+			if stage.Name == b.fromStage {
+				from = i
+				break
+			}
+		}
+		if from == -1 {
+			return nil, fmt.Errorf("build %s has no stage named %q", b.Name(), b.fromStage)
+		}
+	}
+
+	s, ok := snapshotter(b.Builder)
+	if !ok {
+		if from != -1 {
+			return nil, fmt.Errorf("the %s builder does not support snapshots, build %s cannot resume from stage %q",
+				b.BuilderType, b.Name(), b.fromStage)
+		}
+		ui.Error(fmt.Sprintf("The %s builder does not support snapshots, building %s from scratch.", b.BuilderType, b.Name()))
+		return plan, nil
+	}
+	cache, err := NewStageCache(b.Name())
+	if err != nil {
+		if from != -1 {
+			return nil, fmt.Errorf("failed to open the stage cache of build %s: %s", b.Name(), err)
+		}
+		ui.Error(fmt.Sprintf("Failed to open the stage cache, building %s from scratch: %s", b.Name(), err))
+		return plan, nil
+	}
+	plan.Snapshotter = s
+	plan.Cache = cache
+
+	snapshots, err := cache.Load()
+	if err != nil {
+		if from != -1 {
+			return nil, err
+		}
+		ui.Error(fmt.Sprintf("Building %s from scratch: %s", b.Name(), err))
+		return plan, nil
+	}
+
+	if from != -1 {
+		if from == 0 {
+			ui.Say(fmt.Sprintf("Building %s from scratch, from its first stage %q", b.Name(), b.fromStage))
+			return plan, nil
+		}
+		// The snapshot of the stage before the targeted stage is the
+		// machine the targeted stage ran on.
+		previous := from - 1
+		if previous >= len(snapshots) || snapshots[previous].InputHash != plan.Stages[previous].InputHash {
+			return nil, fmt.Errorf("build %s cannot resume from stage %q: no snapshot of the unchanged stage %q before it",
+				b.Name(), b.fromStage, plan.Stages[previous].Name)
+		}
+		if err := plan.resume(ui, previous, snapshots[previous]); err != nil {
+			return nil, err
+		}
+		return plan, nil
+	}
+
+	for i := len(plan.Stages) - 1; i >= 0; i-- {
+		if i >= len(snapshots) || snapshots[i].InputHash != plan.Stages[i].InputHash {
+			continue
+		}
+		if err := plan.resume(ui, i, snapshots[i]); err != nil {
+			ui.Error(fmt.Sprintf("%s, building %s from scratch", err, b.Name()))
+		}
+		break
+	}
+	return plan, nil
+}
+
+// resume resumes the builder from the snapshot of the stage at index, skipping
+// the stages up to it.
+func (p *StagePlan) resume(ui packersdk.Ui, index int, snapshot StageSnapshot) error {
+	if err := p.Snapshotter.ResumeFrom(snapshot.SnapshotID); err != nil {
+		return fmt.Errorf("failed to resume from the snapshot %s of stage %q: %s", snapshot.SnapshotID, snapshot.Stage, err)
+	}
+	ui.Say(fmt.Sprintf("Resuming from the snapshot %s of stage %q, %d stage(s) skipped",
+		snapshot.SnapshotID, snapshot.Stage, index+1))
+	p.Resumed = index + 1
+	return nil
+}
+
+// snapshot snapshots the machine after the stage at index, and records the
+// snapshot in the cache, when the builder can snapshot. Failing to snapshot
+// does not fail the build.
+func (p *StagePlan) snapshot(ctx context.Context, ui packersdk.Ui, index int) {
+	if p.Snapshotter == nil || p.failed {
+		return
+	}
+	stage := p.Stages[index]
+	ui.Say(fmt.Sprintf("Snapshotting the machine after stage %q", stage.Name))
+	id, err := p.Snapshotter.Snapshot(ctx, ui, stage.Name)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Failed to snapshot stage %q, the next run will not resume from it: %s", stage.Name, err))
+		p.failed = true
+		return
+	}
+	err = p.Cache.Record(index, StageSnapshot{
+		Stage:      stage.Name,
+		InputHash:  stage.InputHash,
+		SnapshotID: id,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		ui.Error(fmt.Sprintf("Failed to record the snapshot of stage %q: %s", stage.Name, err))
+		p.failed = true
+		return
+	}
+	log.Printf("[INFO] snapshot %s of stage %q recorded in %s", id, stage.Name, p.Cache.Path)
+}
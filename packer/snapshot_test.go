@@ -0,0 +1,283 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// snapshottingBuilder is a MockBuilder implementing Snapshotter.
+type snapshottingBuilder struct {
+	packersdk.MockBuilder
+
+	snapshots []string
+	resumedAt string
+}
+
+func (b *snapshottingBuilder) Snapshot(_ context.Context, _ packersdk.Ui, stage string) (string, error) {
+	id := fmt.Sprintf("snapshot-%d-%s", len(b.snapshots), stage)
+	b.snapshots = append(b.snapshots, id)
+	return id, nil
+}
+
+func (b *snapshottingBuilder) ResumeFrom(id string) error {
+	b.resumedAt = id
+	return nil
+}
+
+func incrementalBuild(builder packersdk.Builder, inputHashes ...string) *CoreBuild {
+	build := &CoreBuild{
+		Type:             "test",
+		Builder:          builder,
+		BuilderType:      "foo",
+		BuilderInputHash: "builder",
+		Variables:        make(map[string]string),
+		onError:          "cleanup",
+	}
+	for i, h := range inputHashes {
+		build.Provisioners = append(build.Provisioners, CoreBuildProvisioner{
+			PType:       fmt.Sprintf("p%d", i),
+			Provisioner: &packersdk.MockProvisioner{},
+			InputHash:   h,
+		})
+	}
+	build.SetIncremental(true)
+	return build
+}
+
+func provisionersCalled(b *CoreBuild) []bool {
+	var res []bool
+	for _, p := range b.Provisioners {
+		res = append(res, p.Provisioner.(*packersdk.MockProvisioner).ProvCalled)
+	}
+	return res
+}
+
+func TestBuild_Run_incremental(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	builder := &snapshottingBuilder{MockBuilder: packersdk.MockBuilder{ArtifactId: "b"}}
+	build := incrementalBuild(builder, "a", "b", "c")
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if builder.resumedAt != "" {
+		t.Errorf("the first build should not resume, resumed at %s", builder.resumedAt)
+	}
+	if got, want := provisionersCalled(build), []bool{true, true, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected provisioners run: %v", got)
+	}
+	if len(builder.snapshots) != 3 {
+		t.Fatalf("expected a snapshot per stage, got %v", builder.snapshots)
+	}
+
+	// The second provisioner changed: the build resumes from the first
+	// stage.
+	builder = &snapshottingBuilder{MockBuilder: packersdk.MockBuilder{ArtifactId: "b"}}
+	build = incrementalBuild(builder, "a", "b2", "c")
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if builder.resumedAt != "snapshot-0-p0" {
+		t.Errorf("unexpected resume snapshot %q", builder.resumedAt)
+	}
+	if got, want := provisionersCalled(build), []bool{false, true, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected provisioners run: %v", got)
+	}
+
+	cache, err := NewStageCache(build.Name())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	snapshots, err := cache.Load()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var ids []string
+	for _, s := range snapshots {
+		ids = append(ids, s.SnapshotID)
+	}
+	if want := []string{"snapshot-0-p0", "snapshot-0-p1", "snapshot-1-p2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("unexpected cached snapshots %v", ids)
+	}
+
+	// The builder changed: nothing can be resumed.
+	builder = &snapshottingBuilder{MockBuilder: packersdk.MockBuilder{ArtifactId: "b"}}
+	build = incrementalBuild(builder, "a", "b2", "c")
+	build.BuilderInputHash = "other builder"
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if builder.resumedAt != "" {
+		t.Errorf("the build should not resume, resumed at %s", builder.resumedAt)
+	}
+}
+
+func TestBuild_Run_incrementalUnsupported(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	build := incrementalBuild(&packersdk.MockBuilder{ArtifactId: "b"}, "a", "b")
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got, want := provisionersCalled(build), []bool{true, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected provisioners run: %v", got)
+	}
+}
+
+func TestInputHash(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(script, []byte("echo one"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	config := map[string]interface{}{
+		"scripts": []interface{}{script},
+		"inline":  "echo",
+	}
+
+	first, err := InputHash("shell", config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if again, _ := InputHash("shell", config); again != first {
+		t.Errorf("the hash should be stable, got %s and %s", first, again)
+	}
+	if other, _ := InputHash("file", config); other == first {
+		t.Errorf("the hash should depend on the component type")
+	}
+
+	if err := os.WriteFile(script, []byte("echo two"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if changed, _ := InputHash("shell", config); changed == first {
+		t.Errorf("the hash should depend on the content of the local files")
+	}
+}
+
+func TestCoreBuild_InputHash(t *testing.T) {
+	build := testBuild()
+	if err := build.hashInputs(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	first := build.InputHash()
+
+	build.PostProcessors[0][0].config["output"] = "manifest.json"
+	if err := build.hashInputs(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if changed := build.InputHash(); changed == first {
+		t.Errorf("the hash should depend on the configuration of the post-processors")
+	}
+}
+
+func TestCoreBuild_stages(t *testing.T) {
+	build := incrementalBuild(&packersdk.MockBuilder{}, "a", "b", "c", "d")
+	build.Provisioners[1].Stage = "harden"
+	build.Provisioners[2].Stage = "harden"
+	build.Provisioners[3].PName = "cleanup"
+
+	var got []string
+	for _, stage := range build.stages() {
+		got = append(got, fmt.Sprintf("%s:%d", stage.Name, stage.Provisioners))
+	}
+	if want := []string{"p0:1", "harden:2", "cleanup:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stages %v", got)
+	}
+
+	// The hash of a stage covers all of its provisioners.
+	before := build.stages()
+	build.Provisioners[1].InputHash = "changed"
+	after := build.stages()
+	if before[0].InputHash != after[0].InputHash {
+		t.Errorf("the first stage did not change")
+	}
+	for i := 1; i < len(before); i++ {
+		if before[i].InputHash == after[i].InputHash {
+			t.Errorf("the stage %q changed", before[i].Name)
+		}
+	}
+}
+
+func TestBuild_Run_fromStage(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	newBuild := func(builder packersdk.Builder, fromStage string) *CoreBuild {
+		build := incrementalBuild(builder, "a", "b", "c")
+		build.Provisioners[1].Stage = "harden"
+		build.Provisioners[2].Stage = "harden"
+		build.SetFromStage(fromStage)
+		if _, err := build.Prepare(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return build
+	}
+
+	builder := &snapshottingBuilder{MockBuilder: packersdk.MockBuilder{ArtifactId: "b"}}
+	build := newBuild(builder, "")
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if want := []string{"snapshot-0-p0", "snapshot-1-harden"}; !reflect.DeepEqual(builder.snapshots, want) {
+		t.Fatalf("unexpected snapshots %v", builder.snapshots)
+	}
+
+	// Nothing changed, but the harden stage runs again.
+	builder = &snapshottingBuilder{MockBuilder: packersdk.MockBuilder{ArtifactId: "b"}}
+	build = newBuild(builder, "harden")
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if builder.resumedAt != "snapshot-0-p0" {
+		t.Errorf("unexpected resume snapshot %q", builder.resumedAt)
+	}
+	if got, want := provisionersCalled(build), []bool{false, true, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected provisioners run: %v", got)
+	}
+
+	for name, tc := range map[string]struct {
+		builder        packersdk.Builder
+		fromStage      string
+		builderChanged bool
+		expectedErr    bool
+	}{
+		"unknown stage":            {builder: &snapshottingBuilder{}, fromStage: "unknown", expectedErr: true},
+		"unsupported builder":      {builder: &packersdk.MockBuilder{}, fromStage: "harden", expectedErr: true},
+		"changed stage before":     {builder: &snapshottingBuilder{}, fromStage: "harden", builderChanged: true, expectedErr: true},
+		"first stage from scratch": {builder: &snapshottingBuilder{}, fromStage: "p0"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			build := newBuild(tc.builder, tc.fromStage)
+			if tc.builderChanged {
+				build.BuilderInputHash = "changed"
+			}
+			_, err := build.Run(context.Background(), testUi())
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := []bool{true, true, true}
+			if tc.expectedErr {
+				want = []bool{false, false, false}
+			}
+			if got := provisionersCalled(build); !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected provisioners run: %v", got)
+			}
+		})
+	}
+}
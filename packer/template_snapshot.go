@@ -0,0 +1,178 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SnapshotRedacted replaces the sensitive values in a template snapshot.
+const SnapshotRedacted = "<sensitive>"
+
+// The layout of a template snapshot directory.
+const (
+	SnapshotTemplateDir    = "template"
+	SnapshotVarFilesDir    = "var-files"
+	SnapshotValuesFilename = "values.json"
+)
+
+// TemplateSnapshot is a copy of the template of a run, of its var files, and
+// a summary of the values of its variables, with the sensitive values
+// redacted. Written next to the artifacts of the run, it describes how they
+// were built without access to the template repository.
+type TemplateSnapshot struct {
+	// Files are the contents of the template files and var files, by path
+	// relative to the snapshot directory.
+	Files  map[string][]byte
+	Values SnapshotValues
+}
+
+// SnapshotValues is the summary of the values of a run, written in
+// SnapshotValuesFilename.
+type SnapshotValues struct {
+	Template      string    `json:"template"`
+	VarFiles      []string  `json:"var_files,omitempty"`
+	PackerVersion string    `json:"packer_version,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Variables and Locals are the values of the variables by name, the
+	// sensitive ones being SnapshotRedacted.
+	Variables map[string]interface{} `json:"variables"`
+	Locals    map[string]interface{} `json:"locals,omitempty"`
+}
+
+// AddFile adds the file read at path to the snapshot, with its redacted
+// content, in dir. Files with the same name are suffixed with their rank.
+func (s *TemplateSnapshot) AddFile(dir, path string, content []byte) {
+	if s.Files == nil {
+		s.Files = map[string][]byte{}
+	}
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := filepath.Join(dir, base)
+	for i := 2; ; i++ {
+		if _, exists := s.Files[name]; !exists {
+			break
+		}
+		name = filepath.Join(dir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), i, ext))
+	}
+	s.Files[name] = content
+}
+
+// Write writes the snapshot in dir.
+func (s *TemplateSnapshot) Write(dir string) error {
+	for name, content := range s.Files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			return err
+		}
+	}
+	b, err := MarshalSnapshotJSON(s.Values)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, SnapshotValuesFilename), b, 0600)
+}
+
+// MarshalSnapshotJSON encodes v, indented, for a snapshot. Unlike
+// json.MarshalIndent, it does not escape SnapshotRedacted.
+func MarshalSnapshotJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// SnapshotTemplate returns a copy of the template and of its varFiles, and
+// the values of its user variables. The defaults and values of the sensitive
+// variables are redacted. A template read from stdin is snapshotted from its
+// raw contents.
+func (c *Core) SnapshotTemplate(varFiles []string) (*TemplateSnapshot, error) {
+	sensitive := map[string]bool{}
+	for _, v := range c.Template.SensitiveVariables {
+		sensitive[v.Key] = true
+	}
+	snapshot := &TemplateSnapshot{
+		Values: SnapshotValues{
+			VarFiles:  varFiles,
+			Variables: make(map[string]interface{}, len(c.variables)),
+		},
+	}
+	for k, v := range c.variables {
+		switch {
+		case k == "":
+			// Left by the rendering of the variables.
+		case sensitive[k]:
+			snapshot.Values.Variables[k] = SnapshotRedacted
+		default:
+			snapshot.Values.Variables[k] = v
+		}
+	}
+
+	path, content := c.Template.Path, c.Template.RawContents
+	if path != "" && path != "-" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content = b
+	} else {
+		path = "template.json"
+	}
+	content, err := redactJSONVariables(content, func(root map[string]interface{}) {
+		vars, _ := root["variables"].(map[string]interface{})
+		for k := range vars {
+			if sensitive[k] {
+				vars[k] = SnapshotRedacted
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %s", path, err)
+	}
+	snapshot.AddFile(SnapshotTemplateDir, path, content)
+
+	for _, path := range varFiles {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content, err := redactJSONVariables(b, func(root map[string]interface{}) {
+			for k := range root {
+				if sensitive[k] {
+					root[k] = SnapshotRedacted
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %s", path, err)
+		}
+		snapshot.AddFile(SnapshotVarFilesDir, path, content)
+	}
+	return snapshot, nil
+}
+
+// redactJSONVariables decodes the JSON object src, lets redact redact it, and
+// encodes it again.
+func redactJSONVariables(src []byte, redact func(map[string]interface{})) ([]byte, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(src, &root); err != nil {
+		return nil, err
+	}
+	redact(root)
+	return MarshalSnapshotJSON(root)
+}
@@ -0,0 +1,153 @@
+package packer
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hako/durafmt"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// TimingMachineType is the type of the machine-readable events reporting, once
+// a build is done, the time spent by each of its steps. Its data are the kind
+// of the step, its name and its duration in seconds:
+//
+//	timing,<kind>,<name>,<seconds>
+const TimingMachineType = "timing"
+
+// The kinds of the steps of a build whose time is reported.
+const (
+	// TimingLocalCommands are the pre-build or post-build local commands.
+	TimingLocalCommands = "local-commands"
+	// TimingBuilder is the time the builder spent on its own: before the
+	// provisioners ran, like downloading, creating and booting the machine,
+	// and after them, like shutting down and exporting the image.
+	TimingBuilder       = "builder"
+	TimingProvisioner   = "provisioner"
+	TimingPostProcessor = "post-processor"
+)
+
+// StepTiming is the time spent by a step of a build.
+type StepTiming struct {
+	Kind     string
+	Name     string
+	Duration time.Duration
+	// Err is the error the step failed with.
+	Err error
+}
+
+// buildTimer records when the steps of a build start and end. A nil
+// buildTimer records nothing.
+type buildTimer struct {
+	l     sync.Mutex
+	spans []timingSpan
+}
+
+type timingSpan struct {
+	kind, name string
+	start, end time.Time
+	// err is the error the step failed with.
+	err error
+}
+
+// start records the start of a step, the returned function records its end
+// and its error.
+func (t *buildTimer) start(kind, name string) func(error) {
+	if t == nil {
+		return func(error) {}
+	}
+	t.l.Lock()
+	defer t.l.Unlock()
+	i := len(t.spans)
+	t.spans = append(t.spans, timingSpan{kind: kind, name: name, start: time.Now()})
+	return func(err error) {
+		t.l.Lock()
+		defer t.l.Unlock()
+		t.spans[i].end = time.Now()
+		t.spans[i].err = err
+	}
+}
+
+// snapshot returns the recorded spans, the ones of the steps still running
+// ending now.
+func (t *buildTimer) snapshot() []timingSpan {
+	if t == nil {
+		return nil
+	}
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	now := time.Now()
+	spans := make([]timingSpan, len(t.spans))
+	for i, s := range t.spans {
+		if s.end.IsZero() {
+			s.end = now
+		}
+		spans[i] = s
+	}
+	return spans
+}
+
+// Timings returns the time spent by the steps, in the order they ran. As the
+// provisioners run while the builder does, each run of the builder is split
+// in the time before and the time after its provisioners.
+func (t *buildTimer) Timings() []StepTiming {
+	spans := t.snapshot()
+	var timings []StepTiming
+	for i := 0; i < len(spans); i++ {
+		s := spans[i]
+		if s.kind != TimingBuilder {
+			timings = append(timings, StepTiming{Kind: s.kind, Name: s.name, Duration: s.end.Sub(s.start), Err: s.err})
+			continue
+		}
+		// The provisioners run by this run of the builder follow it.
+		j := i + 1
+		for j < len(spans) && spans[j].kind == TimingProvisioner && !spans[j].start.After(s.end) {
+			j++
+		}
+		provisioners := spans[i+1 : j]
+		if len(provisioners) == 0 {
+			timings = append(timings, StepTiming{Kind: s.kind, Name: s.name, Duration: s.end.Sub(s.start), Err: s.err})
+			continue
+		}
+		timings = append(timings, StepTiming{Kind: s.kind, Name: s.name + " (before provisioners)", Duration: provisioners[0].start.Sub(s.start)})
+		for _, p := range provisioners {
+			timings = append(timings, StepTiming{Kind: p.kind, Name: p.name, Duration: p.end.Sub(p.start), Err: p.err})
+		}
+		timings = append(timings, StepTiming{Kind: s.kind, Name: s.name + " (after provisioners)", Duration: s.end.Sub(provisioners[len(provisioners)-1].end), Err: s.err})
+		i = j - 1
+	}
+	return timings
+}
+
+// reportTimings says the time spent by the steps of the build, and sends them
+// as TimingMachineType events.
+func reportTimings(ui packersdk.Ui, timings []StepTiming) {
+	if len(timings) == 0 {
+		return
+	}
+	var total time.Duration
+	for _, t := range timings {
+		total += t.Duration
+	}
+	ui.Say("Time spent by the steps of the build:")
+	for _, t := range timings {
+		percent := 0
+		if total > 0 {
+			percent = int(t.Duration * 100 / total)
+		}
+		ui.Say(fmt.Sprintf("  %-15s %-40s %s (%d%%)", t.Kind, t.Name, formatTiming(t.Duration), percent))
+		ui.Machine(TimingMachineType, t.Kind, t.Name, strconv.FormatFloat(t.Duration.Seconds(), 'f', 3, 64))
+	}
+}
+
+// formatTiming formats d like the other durations of the UI, to the
+// millisecond below a second.
+func formatTiming(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return durafmt.Parse(d).LimitFirstN(2).String()
+}
@@ -0,0 +1,65 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildTimer_Timings(t *testing.T) {
+	start := time.Now()
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	timer := &buildTimer{spans: []timingSpan{
+		{kind: TimingLocalCommands, name: "pre-build", start: at(0), end: at(1)},
+		// A first attempt of the builder failing before provisioning.
+		{kind: TimingBuilder, name: "happycloud", start: at(1), end: at(3)},
+		{kind: TimingBuilder, name: "happycloud", start: at(3), end: at(20)},
+		{kind: TimingProvisioner, name: "shell", start: at(10), end: at(14)},
+		{kind: TimingProvisioner, name: "file", start: at(14), end: at(15)},
+		{kind: TimingPostProcessor, name: "manifest", start: at(20), end: at(22)},
+	}}
+
+	expected := []StepTiming{
+		{Kind: TimingLocalCommands, Name: "pre-build", Duration: 1 * time.Second},
+		{Kind: TimingBuilder, Name: "happycloud", Duration: 2 * time.Second},
+		{Kind: TimingBuilder, Name: "happycloud (before provisioners)", Duration: 7 * time.Second},
+		{Kind: TimingProvisioner, Name: "shell", Duration: 4 * time.Second},
+		{Kind: TimingProvisioner, Name: "file", Duration: 1 * time.Second},
+		{Kind: TimingBuilder, Name: "happycloud (after provisioners)", Duration: 5 * time.Second},
+		{Kind: TimingPostProcessor, Name: "manifest", Duration: 2 * time.Second},
+	}
+	if diff := cmp.Diff(expected, timer.Timings()); diff != "" {
+		t.Errorf("unexpected timings: %s", diff)
+	}
+}
+
+func TestBuild_Run_reportsTimings(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &MachineReadableUi{Writer: buf}
+
+	build := testBuild()
+	build.Prepare()
+	if _, err := build.Run(context.Background(), ui); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var kinds []string
+	for _, timing := range build.Timings() {
+		kinds = append(kinds, timing.Kind+" "+timing.Name)
+	}
+	expected := []string{
+		"builder test (before provisioners)",
+		"provisioner mock-provisioner",
+		"builder test (after provisioners)",
+		"post-processor testPPName",
+	}
+	if diff := cmp.Diff(expected, kinds); diff != "" {
+		t.Errorf("unexpected timings: %s", diff)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(",test,timing,provisioner,mock-provisioner,")) {
+		t.Errorf("expected a timing event for the provisioner, got %s", buf)
+	}
+}
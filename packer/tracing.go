@@ -0,0 +1,264 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	packerVersion "github.com/hashicorp/packer/version"
+)
+
+// Tracer exports the spans of the builds to an OpenTelemetry collector. It is
+// nil, and nothing is exported, unless an OTLP endpoint is configured, see
+// NewTracerFromEnv.
+var Tracer *OTLPTracer
+
+// OTLPTracer exports a span per build, with a child span per step of the
+// build, over OTLP/HTTP with the JSON encoding. All the builds of a run share
+// the same trace.
+type OTLPTracer struct {
+	// Endpoint is the URL the spans are posted to.
+	Endpoint string
+	// Headers are added to the export requests, like an API key.
+	Headers     map[string]string
+	ServiceName string
+	// TraceID is the hex-encoded ID of the trace of the run.
+	TraceID string
+	Client  *http.Client
+}
+
+// NewTracerFromEnv returns a tracer configured from the standard
+// OTEL_EXPORTER_OTLP_* and OTEL_SERVICE_NAME environment variables, or nil when
+// no endpoint is set. The trace ID is the run UUID.
+func NewTracerFromEnv() *OTLPTracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	t := &OTLPTracer{
+		Endpoint:    endpoint,
+		Headers:     parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		TraceID:     strings.ReplaceAll(os.Getenv("PACKER_RUN_UUID"), "-", ""),
+		Client:      &http.Client{Timeout: 5 * time.Second},
+	}
+	if t.ServiceName == "" {
+		t.ServiceName = "packer"
+	}
+	if _, err := hex.DecodeString(t.TraceID); err != nil || len(t.TraceID) != 32 {
+		t.TraceID = randomHex(16)
+	}
+	log.Printf("[INFO] (tracing) exporting the spans of trace %s to %s", t.TraceID, t.Endpoint)
+	return t
+}
+
+// parseOTLPHeaders parses headers in the key1=value1,key2=value2 format of
+// OTEL_EXPORTER_OTLP_HEADERS, whose values are URL encoded.
+func parseOTLPHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		k, v := kv[0], kv[1]
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = unescaped
+		}
+		headers[strings.TrimSpace(k)] = v
+	}
+	return headers
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// Only the uniqueness of the IDs suffers.
+		log.Printf("[WARN] (tracing) failed to generate a random ID: %s", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ExportBuild exports the span of the named build, from start until now, with
+// the spans of its steps recorded by timer. The provisioner spans are children
+// of the builder span they ran in. A failure to export is only logged.
+func (t *OTLPTracer) ExportBuild(name string, start time.Time, buildErr error, timer *buildTimer) {
+	if t == nil {
+		return
+	}
+
+	buildSpan := otlpSpan{
+		TraceID:           t.TraceID,
+		SpanID:            randomHex(8),
+		Name:              "build " + name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(time.Now()),
+		Attributes:        []otlpAttribute{stringAttribute("packer.build.name", name)},
+		Status:            otlpStatusOf(buildErr),
+	}
+	spans := []otlpSpan{buildSpan}
+
+	var builder otlpSpan
+	var builderEnd time.Time
+	for _, s := range timer.snapshot() {
+		span := otlpSpan{
+			TraceID:           t.TraceID,
+			SpanID:            randomHex(8),
+			ParentSpanID:      buildSpan.SpanID,
+			Name:              s.kind + " " + s.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: otlpTime(s.start),
+			EndTimeUnixNano:   otlpTime(s.end),
+			Attributes: []otlpAttribute{
+				stringAttribute("packer.build.name", name),
+				stringAttribute("packer.step.kind", s.kind),
+				stringAttribute("packer.step.name", s.name),
+			},
+			Status: otlpStatusOf(s.err),
+		}
+		switch {
+		case s.kind == TimingBuilder:
+			builder, builderEnd = span, s.end
+		case s.kind == TimingProvisioner && builder.SpanID != "" && !s.start.After(builderEnd):
+			span.ParentSpanID = builder.SpanID
+		}
+		spans = append(spans, span)
+	}
+
+	if err := t.export(spans); err != nil {
+		log.Printf("[WARN] (tracing) failed to export the spans of build %q: %s", name, err)
+	}
+}
+
+func (t *OTLPTracer) export(spans []otlpSpan) error {
+	payload := otlpTracesRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpAttribute{
+				stringAttribute("service.name", t.ServiceName),
+				stringAttribute("service.version", packerVersion.FormattedVersion()),
+			}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/hashicorp/packer", Version: packerVersion.FormattedVersion()},
+				Spans: spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of the spans, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+func stringAttribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpStatusOf(err error) otlpStatus {
+	if err != nil {
+		return otlpStatus{Code: otlpStatusCodeError, Message: err.Error()}
+	}
+	return otlpStatus{Code: otlpStatusCodeOK}
+}
@@ -0,0 +1,126 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewTracerFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	if tracer := NewTracerFromEnv(); tracer != nil {
+		t.Fatalf("expected no tracer without an endpoint, got %#v", tracer)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://collector:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret%3D,x-team = images")
+	t.Setenv("PACKER_RUN_UUID", "6d6e1c3c-93a1-4f5b-8d0e-2b7f4d1c2a9e")
+	tracer := NewTracerFromEnv()
+	if tracer == nil {
+		t.Fatal("expected a tracer")
+	}
+	if tracer.Endpoint != "https://collector:4318/v1/traces" {
+		t.Errorf("unexpected endpoint %q", tracer.Endpoint)
+	}
+	if diff := cmp.Diff(map[string]string{"api-key": "secret=", "x-team": "images"}, tracer.Headers); diff != "" {
+		t.Errorf("unexpected headers: %s", diff)
+	}
+	if tracer.TraceID != "6d6e1c3c93a14f5b8d0e2b7f4d1c2a9e" {
+		t.Errorf("expected the trace ID to be the run UUID, got %q", tracer.TraceID)
+	}
+	if tracer.ServiceName != "packer" {
+		t.Errorf("unexpected service name %q", tracer.ServiceName)
+	}
+}
+
+func TestOTLPTracer_ExportBuild(t *testing.T) {
+	var received otlpTracesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "secret" {
+			t.Errorf("expected the configured headers to be sent")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode the exported spans: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	timer := &buildTimer{spans: []timingSpan{
+		{kind: TimingBuilder, name: "happycloud", start: at(0), end: at(10)},
+		{kind: TimingProvisioner, name: "shell", start: at(2), end: at(4), err: errors.New("exit status 1")},
+		{kind: TimingPostProcessor, name: "manifest", start: at(10), end: at(11)},
+	}}
+	tracer := &OTLPTracer{
+		Endpoint:    server.URL,
+		Headers:     map[string]string{"api-key": "secret"},
+		ServiceName: "packer",
+		TraceID:     "6d6e1c3c93a14f5b8d0e2b7f4d1c2a9e",
+	}
+	tracer.ExportBuild("happycloud.image", start, errors.New("build failed"), timer)
+
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload: %#v", received)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name)
+		if span.TraceID != tracer.TraceID {
+			t.Errorf("expected span %q to be part of the trace of the run, got %q", span.Name, span.TraceID)
+		}
+	}
+	expected := []string{"build happycloud.image", "builder happycloud", "provisioner shell", "post-processor manifest"}
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Fatalf("unexpected spans: %s", diff)
+	}
+
+	build, builder, provisioner, postProcessor := spans[0], spans[1], spans[2], spans[3]
+	if build.ParentSpanID != "" || builder.ParentSpanID != build.SpanID || postProcessor.ParentSpanID != build.SpanID {
+		t.Errorf("expected the steps to be children of the build span")
+	}
+	if provisioner.ParentSpanID != builder.SpanID {
+		t.Errorf("expected the provisioner to be a child of the builder span")
+	}
+	if build.Status.Code != otlpStatusCodeError || build.Status.Message != "build failed" {
+		t.Errorf("unexpected build status %#v", build.Status)
+	}
+	if provisioner.Status.Code != otlpStatusCodeError || builder.Status.Code != otlpStatusCodeOK {
+		t.Errorf("unexpected step statuses %#v, %#v", provisioner.Status, builder.Status)
+	}
+}
+
+func TestBuild_Run_exportsSpans(t *testing.T) {
+	exported := make(chan otlpTracesRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload otlpTracesRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode the exported spans: %s", err)
+		}
+		exported <- payload
+	}))
+	defer server.Close()
+
+	defer func(tracer *OTLPTracer) { Tracer = tracer }(Tracer)
+	Tracer = &OTLPTracer{Endpoint: server.URL, ServiceName: "packer", TraceID: "6d6e1c3c93a14f5b8d0e2b7f4d1c2a9e"}
+
+	build := testBuild()
+	build.Prepare()
+	if _, err := build.Run(context.Background(), testUi()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	payload := <-exported
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 4 || spans[0].Name != "build test" {
+		t.Errorf("expected a build span and a span per step, got %#v", spans)
+	}
+}
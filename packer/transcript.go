@@ -0,0 +1,174 @@
+package packer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Transcript records every command run on the guest of a build by its
+// provisioners, so that auditors can tell exactly what was executed.
+type Transcript struct {
+	Build    string               `json:"build"`
+	Commands []*TranscriptCommand `json:"commands"`
+
+	hashOutput bool
+	l          sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// TranscriptCommand describes a single command run on the guest.
+type TranscriptCommand struct {
+	Provisioner string    `json:"provisioner"`
+	Command     string    `json:"command"`
+	Start       time.Time `json:"start"`
+	// End is zero while the command is running.
+	End        time.Time `json:"end"`
+	ExitStatus int       `json:"exit_status"`
+	// The hex encoded sha256 of the outputs of the command, only set when
+	// output hashing is enabled.
+	StdoutSHA256 string `json:"stdout_sha256,omitempty"`
+	StderrSHA256 string `json:"stderr_sha256,omitempty"`
+}
+
+// NewTranscript returns an empty transcript for the named build. When
+// hashOutput is set, the outputs of the commands are hashed and recorded too.
+func NewTranscript(build string, hashOutput bool) *Transcript {
+	return &Transcript{
+		Build:      build,
+		Commands:   []*TranscriptCommand{},
+		hashOutput: hashOutput,
+	}
+}
+
+// Communicator returns a communicator recording in the transcript every
+// command started through comm by the named provisioner.
+func (t *Transcript) Communicator(comm packersdk.Communicator, provisioner string) packersdk.Communicator {
+	return &transcriptCommunicator{
+		Communicator: comm,
+		transcript:   t,
+		provisioner:  provisioner,
+	}
+}
+
+// Wait blocks until every recorded command exited, or the timeout expires.
+// It returns false when the timeout expired.
+func (t *Transcript) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Write stores the transcript in the file at path, overwriting it if present.
+func (t *Transcript) Write(path string) error {
+	b, err := t.encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Digest returns the hex encoded sha256 of the encoded transcript.
+func (t *Transcript) Digest() (string, error) {
+	b, err := t.encode()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (t *Transcript) encode() ([]byte, error) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (t *Transcript) add(c *TranscriptCommand) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	t.Commands = append(t.Commands, c)
+}
+
+// update applies f to the recorded commands under lock.
+func (t *Transcript) update(f func()) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	f()
+}
+
+type transcriptCommunicator struct {
+	packersdk.Communicator
+
+	transcript  *Transcript
+	provisioner string
+}
+
+func (c *transcriptCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	entry := &TranscriptCommand{
+		Provisioner: c.provisioner,
+		Command:     cmd.Command,
+		Start:       time.Now().UTC(),
+	}
+
+	var stdout, stderr hash.Hash
+	if c.transcript.hashOutput {
+		stdout, stderr = sha256.New(), sha256.New()
+		cmd.Stdout = teeOutput(cmd.Stdout, stdout)
+		cmd.Stderr = teeOutput(cmd.Stderr, stderr)
+	}
+
+	c.transcript.add(entry)
+	if err := c.Communicator.Start(ctx, cmd); err != nil {
+		c.transcript.update(func() {
+			entry.End = time.Now().UTC()
+			entry.ExitStatus = packersdk.CmdDisconnect
+		})
+		return err
+	}
+
+	c.transcript.wg.Add(1)
+	go func() {
+		defer c.transcript.wg.Done()
+		status := cmd.Wait()
+		c.transcript.update(func() {
+			entry.End = time.Now().UTC()
+			entry.ExitStatus = status
+			if stdout != nil {
+				entry.StdoutSHA256 = hex.EncodeToString(stdout.Sum(nil))
+				entry.StderrSHA256 = hex.EncodeToString(stderr.Sum(nil))
+			}
+		})
+	}()
+	return nil
+}
+
+func teeOutput(w io.Writer, h hash.Hash) io.Writer {
+	if w == nil {
+		return h
+	}
+	return io.MultiWriter(w, h)
+}
@@ -0,0 +1,78 @@
+package packer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestTranscript(t *testing.T) {
+	mock := &packersdk.MockCommunicator{
+		StartStdout:     "hello",
+		StartExitStatus: 3,
+	}
+
+	transcript := NewTranscript("file.test", true)
+	comm := transcript.Communicator(mock, "shell")
+
+	cmd := &packersdk.RemoteCmd{Command: "echo hello"}
+	if err := cmd.RunWithUi(context.Background(), comm, TestUi(t)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !transcript.Wait(time.Second) {
+		t.Fatalf("expected the command to report its exit status")
+	}
+
+	if len(transcript.Commands) != 1 {
+		t.Fatalf("expected one recorded command, got %d", len(transcript.Commands))
+	}
+	c := transcript.Commands[0]
+	if c.Provisioner != "shell" || c.Command != "echo hello" || c.ExitStatus != 3 {
+		t.Errorf("unexpected recorded command %#v", c)
+	}
+	if c.Start.IsZero() || c.End.Before(c.Start) {
+		t.Errorf("unexpected timestamps %s - %s", c.Start, c.End)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+	if c.StdoutSHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected stdout hash %q", c.StdoutSHA256)
+	}
+
+	path := filepath.Join(t.TempDir(), "file.test.transcript.json")
+	if err := transcript.Write(path); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Transcript
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to decode the transcript: %s", err)
+	}
+	if got.Build != "file.test" || len(got.Commands) != 1 {
+		t.Errorf("unexpected written transcript %s", b)
+	}
+}
+
+func TestTranscript_noOutputHash(t *testing.T) {
+	mock := &packersdk.MockCommunicator{StartStdout: "hello"}
+
+	transcript := NewTranscript("file.test", false)
+	cmd := &packersdk.RemoteCmd{Command: "echo hello"}
+	if err := cmd.RunWithUi(context.Background(), transcript.Communicator(mock, "shell"), TestUi(t)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	transcript.Wait(time.Second)
+
+	if c := transcript.Commands[0]; c.StdoutSHA256 != "" || c.StderrSHA256 != "" {
+		t.Errorf("expected outputs not to be hashed, got %#v", c)
+	}
+}
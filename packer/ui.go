@@ -2,6 +2,7 @@ package packer
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unicode"
@@ -119,18 +121,35 @@ func (u *TargetedUI) Ask(query string) (string, error) {
 }
 
 func (u *TargetedUI) Say(message string) {
+	if t, ok := u.Ui.(targetedUi); ok {
+		t.targetedMessage(u.Target, "say", message)
+		return
+	}
 	u.Ui.Say(u.prefixLines(true, message))
 }
 
 func (u *TargetedUI) Message(message string) {
+	if t, ok := u.Ui.(targetedUi); ok {
+		t.targetedMessage(u.Target, "message", message)
+		return
+	}
 	u.Ui.Message(u.prefixLines(false, message))
 }
 
 func (u *TargetedUI) Error(message string) {
+	if t, ok := u.Ui.(targetedUi); ok {
+		t.targetedMessage(u.Target, "error", message)
+		return
+	}
 	u.Ui.Error(u.prefixLines(true, message))
 }
 
 func (u *TargetedUI) Machine(t string, args ...string) {
+	// The secrets declared by the plugins are masked, not output.
+	if t == SecretMachineCategory {
+		Secrets.Register(args...)
+		return
+	}
 	// Prefix in the target, then pass through
 	u.Ui.Machine(fmt.Sprintf("%s,%s", u.Target, t), args...)
 }
@@ -159,6 +178,9 @@ func (u *TargetedUI) TrackProgress(src string, currentSize, totalSize int64, str
 type MachineReadableUi struct {
 	Writer io.Writer
 	PB     packersdk.NoopProgressTracker
+	// Sensitive is how the secrets of the events are output, redacted when
+	// empty.
+	Sensitive SensitiveOutput
 }
 
 var _ packersdk.Ui = new(MachineReadableUi)
@@ -191,13 +213,20 @@ func (u *MachineReadableUi) Machine(category string, args ...string) {
 	}
 
 	// Prepare the args
+	sensitive := false
 	for i, v := range args {
-		// Use packersdk.LogSecretFilter to scrub out sensitive variables
-		args[i] = packersdk.LogSecretFilter.FilterString(args[i])
-		args[i] = strings.Replace(v, ",", "%!(PACKER_COMMA)", -1)
+		// Scrub out the secrets, see Secrets
+		var s bool
+		args[i], s = Secrets.Output(u.Sensitive, v)
+		sensitive = sensitive || s
+		args[i] = strings.Replace(args[i], ",", "%!(PACKER_COMMA)", -1)
 		args[i] = strings.Replace(args[i], "\r", "\\r", -1)
 		args[i] = strings.Replace(args[i], "\n", "\\n", -1)
 	}
+	if sensitive && u.Sensitive == SensitiveOutputOmit {
+		log.Printf("[DEBUG] omitting the %s event holding secrets", category)
+		return
+	}
 	argsString := strings.Join(args, ",")
 
 	_, err := fmt.Fprintf(u.Writer, "%d,%s,%s,%s\n", now.Unix(), target, category, argsString)
@@ -216,6 +245,119 @@ func (u *MachineReadableUi) TrackProgress(src string, currentSize, totalSize int
 	return u.PB.TrackProgress(src, currentSize, totalSize, stream)
 }
 
+// JSONUi is a UI writing each message and machine-readable event as a JSON
+// object, see JSONEvent, on its own line of the given Writer.
+type JSONUi struct {
+	Writer io.Writer
+	PB     packersdk.NoopProgressTracker
+	// Sensitive is how the secrets of the events are output, redacted when
+	// empty.
+	Sensitive SensitiveOutput
+
+	l sync.Mutex
+}
+
+var _ packersdk.Ui = new(JSONUi)
+
+// JSONEvent is a line of the output of the JSONUi.
+type JSONEvent struct {
+	Timestamp time.Time `json:"@timestamp"`
+	// Type is "ui" for messages, or the type of a machine-readable event,
+	// like "artifact".
+	Type string `json:"type"`
+	// Build is the name of the build the event is about, if any.
+	Build string `json:"build,omitempty"`
+	// Level is "say", "message" or "error" for messages.
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Data are the values of a machine-readable event.
+	Data []string `json:"data,omitempty"`
+	// Sensitive tells whether the message or the data hold secrets, redacted
+	// or marked, see SensitiveOutput.
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+func (u *JSONUi) Ask(query string) (string, error) {
+	return "", errors.New("JSON UI can't ask")
+}
+
+func (u *JSONUi) Say(message string) {
+	u.targetedMessage("", "say", message)
+}
+
+func (u *JSONUi) Message(message string) {
+	u.targetedMessage("", "message", message)
+}
+
+func (u *JSONUi) Error(message string) {
+	u.targetedMessage("", "error", message)
+}
+
+func (u *JSONUi) targetedMessage(target, level, message string) {
+	message, sensitive := Secrets.Output(u.Sensitive, message)
+	u.write(JSONEvent{
+		Type:      "ui",
+		Build:     target,
+		Level:     level,
+		Message:   message,
+		Sensitive: sensitive,
+	})
+}
+
+func (u *JSONUi) Machine(category string, args ...string) {
+	target, category := splitTarget(category)
+
+	data := make([]string, len(args))
+	sensitive := false
+	for i, v := range args {
+		var s bool
+		data[i], s = Secrets.Output(u.Sensitive, v)
+		sensitive = sensitive || s
+	}
+	u.write(JSONEvent{
+		Type:      category,
+		Build:     target,
+		Data:      data,
+		Sensitive: sensitive,
+	})
+}
+
+func (u *JSONUi) write(event JSONEvent) {
+	if event.Sensitive && u.Sensitive == SensitiveOutputOmit {
+		log.Printf("[DEBUG] omitting the %s event holding secrets", event.Type)
+		return
+	}
+	event.Timestamp = time.Now().UTC()
+	b, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[ERROR] failed to encode the %s event: %s", event.Type, err)
+		return
+	}
+
+	u.l.Lock()
+	defer u.l.Unlock()
+	_, err = fmt.Fprintf(u.Writer, "%s\n", b)
+	if err != nil {
+		if err == syscall.EPIPE || strings.Contains(err.Error(), "broken pipe") {
+			// Ignore epipe errors because that just means that the file
+			// is probably closed or going to /dev/null or something.
+		} else {
+			panic(err)
+		}
+	}
+	log.Printf("%s\n", b)
+}
+
+func (u *JSONUi) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) (body io.ReadCloser) {
+	return u.PB.TrackProgress(src, currentSize, totalSize, stream)
+}
+
+// targetedUi is implemented by the UIs reporting the target of the messages
+// of a TargetedUI on its own, rather than as a prefix of the messages.
+type targetedUi interface {
+	targetedMessage(target, level, message string)
+}
+
 // TimestampedUi is a UI that wraps another UI implementation and
 // prefixes each message with an RFC3339 timestamp
 type TimestampedUi struct {
@@ -252,3 +394,42 @@ func (u *TimestampedUi) TrackProgress(src string, currentSize, totalSize int64,
 func (u *TimestampedUi) timestampLine(string string) string {
 	return fmt.Sprintf("%v: %v", time.Now().Format(time.RFC3339), string)
 }
+
+// ProgressUi is a UI that wraps another UI implementation and renders the
+// progress of the steps of the builds, reported with ReportProgress, with its
+// progress tracker. The machine-readable events are passed through.
+type ProgressUi struct {
+	Ui packersdk.Ui
+	PB StepProgressTracker
+}
+
+var _ packersdk.Ui = new(ProgressUi)
+
+func (u *ProgressUi) Ask(query string) (string, error) {
+	return u.Ui.Ask(query)
+}
+
+func (u *ProgressUi) Say(message string) {
+	u.Ui.Say(message)
+}
+
+func (u *ProgressUi) Message(message string) {
+	u.Ui.Message(message)
+}
+
+func (u *ProgressUi) Error(message string) {
+	u.Ui.Error(message)
+}
+
+func (u *ProgressUi) Machine(category string, args ...string) {
+	if build, step, percent, ok := parseProgress(category, args); ok {
+		u.PB.TrackStepProgress(build, step, percent)
+	} else if build, t := splitTarget(category); t == "build" && len(args) > 0 && (args[0] == "finished" || args[0] == "errored") {
+		u.PB.FinishStepProgress(build)
+	}
+	u.Ui.Machine(category, args...)
+}
+
+func (u *ProgressUi) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) (body io.ReadCloser) {
+	return u.Ui.TrackProgress(src, currentSize, totalSize, stream)
+}
@@ -2,10 +2,13 @@ package packer
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
@@ -298,3 +301,38 @@ func TestMachineReadableUi(t *testing.T) {
 		t.Fatalf("bad: %#v", data)
 	}
 }
+
+func TestJSONUi(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &JSONUi{Writer: buf}
+	targeted := &TargetedUI{Target: "vbox.ubuntu", Ui: ui}
+
+	ui.Say("starting")
+	targeted.Message("line 1\nline 2")
+	targeted.Error("failed")
+	targeted.Machine("artifact", "0", "id", "image,1")
+
+	expected := []JSONEvent{
+		{Type: "ui", Level: "say", Message: "starting"},
+		{Type: "ui", Build: "vbox.ubuntu", Level: "message", Message: "line 1\nline 2"},
+		{Type: "ui", Build: "vbox.ubuntu", Level: "error", Message: "failed"},
+		{Type: "artifact", Build: "vbox.ubuntu", Data: []string{"0", "id", "image,1"}},
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected one line per event, got:\n%s", buf.String())
+	}
+	for i, line := range lines {
+		var event JSONEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %d is not a JSON object: %s", i, err)
+		}
+		if event.Timestamp.IsZero() {
+			t.Errorf("line %d has no timestamp", i)
+		}
+		event.Timestamp = time.Time{}
+		if diff := cmp.Diff(expected[i], event); diff != "" {
+			t.Errorf("unexpected event %d: %s", i, diff)
+		}
+	}
+}
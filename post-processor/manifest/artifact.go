@@ -4,6 +4,10 @@ import "fmt"
 
 const BuilderId = "packer.post-processor.manifest"
 
+// artifactDigestsStateKey is the state of the artifacts reporting the digests
+// of their images, by image ID, see packer.ArtifactChecksumsStateKey.
+const artifactDigestsStateKey = "par.artifact.checksums"
+
 type ArtifactFile struct {
 	Name string `json:"name"`
 	Size int64  `json:"size"`
@@ -15,6 +19,7 @@ type Artifact struct {
 	BuildTime     int64             `json:"build_time,omitempty"`
 	ArtifactFiles []ArtifactFile    `json:"files"`
 	ArtifactId    string            `json:"artifact_id"`
+	Digests       map[string]string `json:"digests,omitempty"`
 	PackerRunUUID string            `json:"packer_run_uuid"`
 	CustomData    map[string]string `json:"custom_data"`
 }
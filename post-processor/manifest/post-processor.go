@@ -18,6 +18,7 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/mitchellh/mapstructure"
 )
 
 type Config struct {
@@ -108,6 +109,11 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source
 		artifact.ArtifactFiles = append(artifact.ArtifactFiles, af)
 	}
 	artifact.ArtifactId = source.Id()
+	if state := source.State(artifactDigestsStateKey); state != nil {
+		if err := mapstructure.WeakDecode(state, &artifact.Digests); err != nil {
+			log.Printf("[WARN] not recording the digests of artifact %s: %s", artifact.ArtifactId, err)
+		}
+	}
 	artifact.CustomData = p.config.CustomData
 	artifact.BuilderType = p.config.PackerBuilderType
 	artifact.BuildName = p.config.PackerBuildName
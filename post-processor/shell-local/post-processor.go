@@ -5,7 +5,7 @@ import (
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
-	sl "github.com/hashicorp/packer-plugin-sdk/shell-local"
+	sl "github.com/hashicorp/packer/internal/shelllocal"
 )
 
 type PostProcessor struct {
@@ -17,7 +17,7 @@ type ExecuteCommandTemplate struct {
 	Script string
 }
 
-func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.ConfigSpec() }
 
 func (p *PostProcessor) Configure(raws ...interface{}) error {
 	err := sl.Decode(&p.config, raws...)
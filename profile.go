@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profile is a named preset of command line flags, defined in the profiles
+// of the Packer config file and selected with -profile. Flags given on the
+// command line take precedence over the flags of the profile.
+type profile struct {
+	MachineReadable bool `json:"machine_readable"`
+	// JSON enables the output of one JSON object per message, see -json.
+	JSON bool `json:"json"`
+	// LogDir enables logging, each run logging to its own file of the
+	// directory. It is ignored when PACKER_LOG_PATH is set.
+	LogDir string `json:"log_dir"`
+
+	// The following settings are flags of the build command.
+	ParallelBuilds *int   `json:"parallel_builds"`
+	TimestampUI    bool   `json:"timestamp_ui"`
+	OnError        string `json:"on_error"`
+	// ParallelBuildsPerType limits the builds running in parallel by
+	// builder type or plugin, for example {"vsphere": 2}.
+	ParallelBuildsPerType map[string]int `json:"parallel_builds_per_type"`
+
+	// Flags are additional flags by command, for example
+	// {"build": ["-force"], "hcp deprecate": ["-keep=3"]}.
+	Flags map[string][]string `json:"flags"`
+}
+
+// extractProfile checks the args for the -profile flag and returns the name of
+// the profile it selects. It modifies the args to remove this flag.
+func extractProfile(args []string) ([]string, string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			continue
+		}
+		switch {
+		case name == "profile":
+			if i+1 == len(args) {
+				return nil, "", fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			result := make([]string, 0, len(args)-2)
+			result = append(result, args[:i]...)
+			return append(result, args[i+2:]...), args[i+1], nil
+		case strings.HasPrefix(name, "profile="):
+			result := make([]string, 0, len(args)-1)
+			result = append(result, args[:i]...)
+			return append(result, args[i+1:]...), strings.TrimPrefix(name, "profile="), nil
+		}
+	}
+	return args, "", nil
+}
+
+// Profile returns the named profile of the config file.
+func (c *config) Profile(name string) (*profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok || p == nil {
+		known := make([]string, 0, len(c.Profiles))
+		for name := range c.Profiles {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown profile %q, known profiles: %v", name, known)
+	}
+	return p, nil
+}
+
+// flags returns the flags of the profile for a command, like "build".
+func (p *profile) flags(command string) []string {
+	var flags []string
+	if command == "build" {
+		if p.ParallelBuilds != nil {
+			flags = append(flags, fmt.Sprintf("-parallel-builds=%d", *p.ParallelBuilds))
+		}
+		if p.TimestampUI {
+			flags = append(flags, "-timestamp-ui")
+		}
+		if p.OnError != "" {
+			flags = append(flags, "-on-error="+p.OnError)
+		}
+		types := make([]string, 0, len(p.ParallelBuildsPerType))
+		for typ := range p.ParallelBuildsPerType {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		for _, typ := range types {
+			flags = append(flags, fmt.Sprintf("-parallel-builds-per-type=%s=%d", typ, p.ParallelBuildsPerType[typ]))
+		}
+	}
+	return append(flags, p.Flags[command]...)
+}
+
+// Apply returns args, the command line without the global flags, with the
+// flags of the profile inserted right after the command name so that the
+// flags given on the command line take precedence.
+func (p *profile) Apply(args []string) []string {
+	words := 0
+	for words < len(args) && !strings.HasPrefix(args[words], "-") {
+		words++
+	}
+	// Commands can be made of several words, like "hcp deprecate": the longest
+	// one with flags is used.
+	for i := words; i > 0; i-- {
+		flags := p.flags(strings.Join(args[:i], " "))
+		if len(flags) == 0 {
+			continue
+		}
+		result := make([]string, 0, len(args)+len(flags))
+		result = append(result, args[:i]...)
+		result = append(result, flags...)
+		return append(result, args[i:]...)
+	}
+	return args
+}
+
+// SetupLogging enables logging to a new file of the log directory of the
+// profile, unless the log file is already set by the environment. id
+// identifies the file of the run.
+func (p *profile) SetupLogging(id string) error {
+	if p.LogDir == "" || os.Getenv(EnvLogFile) != "" {
+		return nil
+	}
+	if err := os.MkdirAll(p.LogDir, 0755); err != nil {
+		return fmt.Errorf("failed to create the log directory of the profile: %s", err)
+	}
+	os.Setenv(EnvLog, "1")
+	os.Setenv(EnvLogFile, filepath.Join(p.LogDir, fmt.Sprintf("packer-%s.log", id)))
+	return nil
+}
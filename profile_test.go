@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExtractProfile(t *testing.T) {
+	tests := []struct {
+		args         []string
+		expectedArgs []string
+		expectedName string
+		expectErr    bool
+	}{
+		{[]string{"build", "template.pkr.hcl"}, []string{"build", "template.pkr.hcl"}, "", false},
+		{[]string{"build", "-profile", "ci", "."}, []string{"build", "."}, "ci", false},
+		{[]string{"--profile=ci", "build", "."}, []string{"build", "."}, "ci", false},
+		{[]string{"build", "-var", "profile=ci", "."}, []string{"build", "-var", "profile=ci", "."}, "", false},
+		{[]string{"build", "--", "-profile=ci"}, []string{"build", "--", "-profile=ci"}, "", false},
+		{[]string{"build", "-profile"}, nil, "", true},
+	}
+	for _, tt := range tests {
+		args, name, err := extractProfile(tt.args)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("%v: unexpected error: %v", tt.args, err)
+		}
+		if diff := cmp.Diff(tt.expectedArgs, args); diff != "" {
+			t.Errorf("%v: unexpected args: %s", tt.args, diff)
+		}
+		if name != tt.expectedName {
+			t.Errorf("%v: expected profile %q, got %q", tt.args, tt.expectedName, name)
+		}
+	}
+}
+
+func TestConfig_Profile(t *testing.T) {
+	packerConfig := `
+	{
+		"profiles": {
+			"ci": {
+				"parallel_builds": 4,
+				"machine_readable": true,
+				"on_error": "abort",
+				"parallel_builds_per_type": {"vsphere": 2, "docker": 0},
+				"flags": {
+					"build": ["-color=false"],
+					"hcp deprecate": ["-keep=3"]
+				}
+			}
+		}
+	}`
+	var cfg config
+	if err := decodeConfig(strings.NewReader(packerConfig), &cfg); err != nil {
+		t.Fatalf("error encountered decoding configuration: %v", err)
+	}
+
+	if _, err := cfg.Profile("dev"); err == nil {
+		t.Fatalf("expected an unknown profile to fail")
+	}
+	p, err := cfg.Profile("ci")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !p.MachineReadable {
+		t.Errorf("expected the profile to be machine readable")
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			[]string{"build", "-parallel-builds=1", "template.pkr.hcl"},
+			[]string{"build", "-parallel-builds=4", "-on-error=abort", "-parallel-builds-per-type=docker=0",
+				"-parallel-builds-per-type=vsphere=2", "-color=false", "-parallel-builds=1", "template.pkr.hcl"},
+		},
+		{
+			[]string{"hcp", "deprecate", "-dry-run", "bucket"},
+			[]string{"hcp", "deprecate", "-keep=3", "-dry-run", "bucket"},
+		},
+		{
+			[]string{"validate", "template.pkr.hcl"},
+			[]string{"validate", "template.pkr.hcl"},
+		},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.expected, p.Apply(tt.args)); diff != "" {
+			t.Errorf("%v: unexpected args: %s", tt.args, diff)
+		}
+	}
+}
+
+func TestProfile_SetupLogging(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	t.Setenv(EnvLog, "")
+	t.Setenv(EnvLogFile, "")
+
+	p := &profile{LogDir: dir}
+	if err := p.SetupLogging("run-id"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if os.Getenv(EnvLog) != "1" {
+		t.Errorf("expected logging to be enabled")
+	}
+	if path := os.Getenv(EnvLogFile); path != filepath.Join(dir, "packer-run-id.log") {
+		t.Errorf("unexpected log file %q", path)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected the log directory to be created: %s", err)
+	}
+
+	// A log file set by the environment is kept.
+	t.Setenv(EnvLogFile, "packer.log")
+	if err := p.SetupLogging("other-id"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if path := os.Getenv(EnvLogFile); path != "packer.log" {
+		t.Errorf("unexpected log file %q", path)
+	}
+}
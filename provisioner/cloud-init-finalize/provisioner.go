@@ -0,0 +1,223 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package cloudinit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/mitchellh/mapstructure"
+)
+
+var DefaultExecuteCommand = `sudo -n sh -c '{{ .Command }}'`
+
+var CleanCloudInitCommand = "cloud-init clean --logs"
+
+// The machine-id is emptied rather than removed so that systemd generates a
+// new one on the next boot. /var/lib/dbus/machine-id is often a link to it.
+var ResetMachineIDCommand = "truncate -s 0 /etc/machine-id && " +
+	"if [ ! -L /var/lib/dbus/machine-id ]; then rm -f /var/lib/dbus/machine-id; fi"
+
+var RemoveHostKeysCommand = "rm -f /etc/ssh/ssh_host_*"
+
+// Checks are the built-in validations, by name, run once the guest is
+// finalized. Each command must exit with a zero status.
+var Checks = map[string]string{
+	// cloud-init is not disabled
+	"cloud_init_enabled": "test ! -e /etc/cloud/cloud-init.disabled",
+	// cloud-init will consider the next boot a new instance
+	"instance_state_cleaned": "test ! -e /var/lib/cloud/instance",
+	"machine_id_reset":       "test ! -s /etc/machine-id",
+	"host_keys_removed":      "! ls /etc/ssh/ssh_host_* >/dev/null 2>&1",
+}
+
+var DefaultChecks = []string{
+	"cloud_init_enabled",
+	"instance_state_cleaned",
+	"machine_id_reset",
+	"host_keys_removed",
+}
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The command used to run each step on the guest, as root. The step is
+	// available as `{{ .Command }}`. Defaults to
+	// `sudo -n sh -c '{{ .Command }}'`.
+	ExecuteCommand string `mapstructure:"execute_command"`
+
+	// Skip `cloud-init clean`, which removes the instance state and logs so
+	// that cloud-init runs again on the next boot.
+	SkipClean bool `mapstructure:"skip_clean"`
+
+	// Skip emptying /etc/machine-id.
+	SkipMachineID bool `mapstructure:"skip_machine_id"`
+
+	// Skip removing the SSH host keys.
+	SkipHostKeys bool `mapstructure:"skip_host_keys"`
+
+	// The built-in checks run once the guest is finalized. Defaults to all
+	// the checks of the steps that are not skipped. Set it to an empty list
+	// to disable them.
+	Checks []string `mapstructure:"checks"`
+
+	// Additional commands validating the guest, each must exit with a zero
+	// status.
+	ExtraChecks []string `mapstructure:"extra_checks"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+type ExecuteCommandTemplate struct {
+	Command string
+}
+
+func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	var md mapstructure.Metadata
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Metadata:           &md,
+		PluginType:         "cloud-init-finalize",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"execute_command",
+			},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.ExecuteCommand == "" {
+		p.config.ExecuteCommand = DefaultExecuteCommand
+	}
+
+	// An explicitly empty list disables the checks.
+	checksSet := false
+	for _, key := range md.Keys {
+		if key == "checks" {
+			checksSet = true
+		}
+	}
+	if !checksSet {
+		p.config.Checks = p.defaultChecks()
+	}
+
+	var errs *packersdk.MultiError
+	for _, check := range p.config.Checks {
+		if _, ok := Checks[check]; !ok {
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("Unknown check %q, valid checks are: %s",
+					check, strings.Join(DefaultChecks, ", ")))
+		}
+	}
+	if p.config.SkipClean && p.config.SkipMachineID && p.config.SkipHostKeys {
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("skip_clean, skip_machine_id and skip_host_keys cannot all be set"))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// defaultChecks returns the checks of the steps that are not skipped.
+func (p *Provisioner) defaultChecks() []string {
+	checks := []string{}
+	for _, check := range DefaultChecks {
+		switch {
+		case check == "instance_state_cleaned" && p.config.SkipClean,
+			check == "machine_id_reset" && p.config.SkipMachineID,
+			check == "host_keys_removed" && p.config.SkipHostKeys:
+			continue
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, _ map[string]interface{}) error {
+	ui.Say("Finalizing the guest for cloud-init...")
+
+	steps := []struct {
+		description string
+		skip        bool
+		command     string
+	}{
+		{"Cleaning the cloud-init state", p.config.SkipClean, CleanCloudInitCommand},
+		{"Resetting the machine-id", p.config.SkipMachineID, ResetMachineIDCommand},
+		{"Removing the SSH host keys", p.config.SkipHostKeys, RemoveHostKeysCommand},
+	}
+	for _, step := range steps {
+		if step.skip {
+			continue
+		}
+		ui.Message(step.description)
+		status, err := p.run(ctx, ui, comm, step.command)
+		if err != nil {
+			return fmt.Errorf("%s: %s", step.description, err)
+		}
+		if status != 0 {
+			return fmt.Errorf("%s: command exited with non-zero exit status: %d", step.description, status)
+		}
+	}
+
+	checks := [][2]string{}
+	for _, check := range p.config.Checks {
+		checks = append(checks, [2]string{check, Checks[check]})
+	}
+	for _, command := range p.config.ExtraChecks {
+		checks = append(checks, [2]string{command, command})
+	}
+
+	var failed []string
+	for _, check := range checks {
+		name, command := check[0], check[1]
+		log.Printf("Running cloud-init finalization check %q: %s", name, command)
+		status, err := p.run(ctx, ui, comm, command)
+		if err != nil {
+			return fmt.Errorf("Error running check %q: %s", name, err)
+		}
+		if status != 0 {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cloud-init will not run again on the next boot, failed checks: %s",
+			strings.Join(failed, ", "))
+	}
+
+	ui.Say("Guest finalized, cloud-init will run again on the next boot")
+	return nil
+}
+
+func (p *Provisioner) run(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, command string) (int, error) {
+	p.config.ctx.Data = &ExecuteCommandTemplate{
+		Command: command,
+	}
+	command, err := interpolate.Render(p.config.ExecuteCommand, &p.config.ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Error processing command: %s", err)
+	}
+
+	cmd := &packersdk.RemoteCmd{Command: command}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return 0, err
+	}
+	return cmd.ExitStatus(), nil
+}
@@ -0,0 +1,130 @@
+package cloudinit
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/provisioner/provisionertest"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packersdk.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.ExecuteCommand != DefaultExecuteCommand {
+		t.Errorf("unexpected execute command: %s", p.config.ExecuteCommand)
+	}
+	if !reflect.DeepEqual(p.config.Checks, DefaultChecks) {
+		t.Errorf("unexpected checks: %#v", p.config.Checks)
+	}
+}
+
+func TestProvisionerPrepare_Checks(t *testing.T) {
+	cases := map[string]struct {
+		config map[string]interface{}
+		checks []string
+	}{
+		"skipped steps are not checked": {
+			config: map[string]interface{}{"skip_host_keys": true, "skip_machine_id": true},
+			checks: []string{"cloud_init_enabled", "instance_state_cleaned"},
+		},
+		"explicit checks": {
+			config: map[string]interface{}{"checks": []string{"machine_id_reset"}},
+			checks: []string{"machine_id_reset"},
+		},
+		"no checks": {
+			config: map[string]interface{}{"checks": []string{}},
+			checks: []string{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var p Provisioner
+			if err := p.Prepare(tc.config); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if len(p.config.Checks) != len(tc.checks) ||
+				(len(tc.checks) > 0 && !reflect.DeepEqual(p.config.Checks, tc.checks)) {
+				t.Errorf("unexpected checks: %#v", p.config.Checks)
+			}
+		})
+	}
+}
+
+func TestProvisionerPrepare_ConfigErrors(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"unknown check": {"checks": []string{"i_dont_exist"}},
+		"nothing to do": {"skip_clean": true, "skip_machine_id": true, "skip_host_keys": true},
+		"invalid key":   {"i_should_not_be_valid": true},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			var p Provisioner
+			if err := p.Prepare(config); err == nil {
+				t.Fatal("should have error")
+			}
+		})
+	}
+}
+
+func TestProvisionerProvision(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["execute_command"] = "{{ .Command }}"
+	config["skip_host_keys"] = true
+	config["extra_checks"] = []string{"cloud-init status"}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &provisionertest.RecordingCommunicator{MockCommunicator: new(packersdk.MockCommunicator)}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		CleanCloudInitCommand,
+		ResetMachineIDCommand,
+		Checks["cloud_init_enabled"],
+		Checks["instance_state_cleaned"],
+		Checks["machine_id_reset"],
+		"cloud-init status",
+	}
+	if !reflect.DeepEqual(comm.Commands, expected) {
+		t.Fatalf("unexpected commands: %#v", comm.Commands)
+	}
+}
+
+func TestProvisionerProvision_Failure(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["skip_clean"] = true
+	config["skip_machine_id"] = true
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packersdk.MockCommunicator{StartExitStatus: 1}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -5,9 +5,12 @@ package file
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,6 +21,7 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/hashicorp/packer-plugin-sdk/tmp"
+	"github.com/hashicorp/packer/internal/agent"
 )
 
 type Config struct {
@@ -148,9 +152,19 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packe
 
 	if p.config.Direction == "download" {
 		return p.ProvisionDownload(ui, comm)
-	} else {
-		return p.ProvisionUpload(ui, comm)
 	}
+
+	// When available, the packer agent verifies the checksum of the uploaded
+	// files.
+	agt, err := agent.Install(ctx, comm)
+	if err != nil {
+		if !errors.Is(err, agent.ErrUnavailable) {
+			ui.Error(fmt.Sprintf("Failed to install the packer agent, uploaded files will not be verified: %s", err))
+		}
+		log.Printf("[INFO] not using the packer agent: %s", err)
+		agt = nil
+	}
+	return p.provisionUpload(ctx, ui, comm, agt)
 }
 
 func (p *Provisioner) ProvisionDownload(ui packersdk.Ui, comm packersdk.Communicator) error {
@@ -205,6 +219,12 @@ func (p *Provisioner) ProvisionDownload(ui packersdk.Ui, comm packersdk.Communic
 }
 
 func (p *Provisioner) ProvisionUpload(ui packersdk.Ui, comm packersdk.Communicator) error {
+	return p.provisionUpload(context.TODO(), ui, comm, nil)
+}
+
+// provisionUpload uploads the sources, verifying the checksum of the uploaded
+// files with agt when it is not nil.
+func (p *Provisioner) provisionUpload(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, agt *agent.Agent) error {
 	dst, err := interpolate.Render(p.config.Destination, &p.config.ctx)
 	if err != nil {
 		return fmt.Errorf("Error interpolating destination: %s", err)
@@ -261,6 +281,38 @@ func (p *Provisioner) ProvisionUpload(ui packersdk.Ui, comm packersdk.Communicat
 			ui.Error(fmt.Sprintf("Upload failed: %s", err))
 			return err
 		}
+
+		if agt != nil {
+			if err := verifyUpload(ctx, comm, agt, src, filedst); err != nil {
+				ui.Error(fmt.Sprintf("Upload failed: %s", err))
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyUpload compares the checksum of the local file src with the one of the
+// uploaded file dst.
+func verifyUpload(ctx context.Context, comm packersdk.Communicator, agt *agent.Agent, src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	want := hex.EncodeToString(h.Sum(nil))
+
+	got, err := agt.SHA256(ctx, comm, dst)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("the checksum of %s is %s, expected %s: the upload is corrupted", dst, got, want)
 	}
+	log.Printf("[INFO] verified the checksum of %s", dst)
 	return nil
 }
@@ -0,0 +1,201 @@
+package packages
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// packageManager describes how to drive a package manager of the guest.
+type packageManager struct {
+	// windows package managers do not run through the execute_command.
+	windows bool
+
+	// updateCache refreshes the package metadata, empty when not needed.
+	updateCache string
+	// cleanCache removes the downloaded packages and metadata, empty when
+	// not needed.
+	cleanCache string
+
+	install func(pkgs []string) []string
+	remove  func(pkgs []string) []string
+
+	// query lists the installed versions of pkgs; parse reads its output.
+	query func(pkgs []string) string
+	parse func(output string, pkgs []string) map[string]string
+}
+
+// all returns a function running command once, with all the packages.
+func all(command string) func([]string) []string {
+	return func(pkgs []string) []string {
+		return []string{command + " " + strings.Join(pkgs, " ")}
+	}
+}
+
+// each returns a function running command once per package.
+func each(command string) func([]string) []string {
+	return func(pkgs []string) []string {
+		commands := make([]string, 0, len(pkgs))
+		for _, pkg := range pkgs {
+			commands = append(commands, command+" "+pkg)
+		}
+		return commands
+	}
+}
+
+// pinnedName returns the name of pkg without its version constraint, ex:
+// "curl=7.81.0-1" is "curl".
+func pinnedName(pkg string) string {
+	for i, c := range pkg {
+		if c == '=' || c == '<' || c == '>' || c == '~' {
+			return pkg[:i]
+		}
+	}
+	return pkg
+}
+
+func names(pkgs []string) []string {
+	res := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		res = append(res, pinnedName(pkg))
+	}
+	return res
+}
+
+// parseFields reads the lines of output in the form "<name><sep><version>".
+func parseFields(sep string) func(string, []string) map[string]string {
+	return func(output string, pkgs []string) map[string]string {
+		wanted := map[string]string{}
+		for _, name := range names(pkgs) {
+			wanted[strings.ToLower(name)] = name
+		}
+
+		versions := map[string]string{}
+		scanner := bufio.NewScanner(strings.NewReader(output))
+		for scanner.Scan() {
+			parts := strings.SplitN(strings.TrimSpace(scanner.Text()), sep, 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if name, ok := wanted[strings.ToLower(parts[0])]; ok {
+				versions[name] = strings.TrimSpace(parts[1])
+			}
+		}
+		return versions
+	}
+}
+
+var rpmQuery = func(pkgs []string) string {
+	return `rpm -q --qf "%{NAME} %{VERSION}-%{RELEASE}\n" ` + strings.Join(names(pkgs), " ")
+}
+
+var packageManagers = map[string]*packageManager{
+	"apt": {
+		updateCache: "apt-get update",
+		cleanCache:  "apt-get clean && rm -rf /var/lib/apt/lists/*",
+		install:     all("DEBIAN_FRONTEND=noninteractive apt-get install -y"),
+		remove:      all("DEBIAN_FRONTEND=noninteractive apt-get remove -y"),
+		query: func(pkgs []string) string {
+			return `dpkg-query -W -f="\${Package} \${Version}\n" ` + strings.Join(names(pkgs), " ")
+		},
+		parse: parseFields(" "),
+	},
+	"dnf": {
+		updateCache: "dnf makecache -y",
+		cleanCache:  "dnf clean all",
+		install:     all("dnf install -y"),
+		remove:      all("dnf remove -y"),
+		query:       rpmQuery,
+		parse:       parseFields(" "),
+	},
+	"zypper": {
+		updateCache: "zypper --non-interactive refresh",
+		cleanCache:  "zypper clean --all",
+		install:     all("zypper --non-interactive install"),
+		remove:      all("zypper --non-interactive remove"),
+		query:       rpmQuery,
+		parse:       parseFields(" "),
+	},
+	"apk": {
+		updateCache: "apk update",
+		cleanCache:  "rm -rf /var/cache/apk/*",
+		install:     all("apk add"),
+		remove:      all("apk del"),
+		query: func(pkgs []string) string {
+			return "apk info -v " + strings.Join(names(pkgs), " ")
+		},
+		parse: parseApk,
+	},
+	"choco": {
+		windows: true,
+		install: all("choco install -y --no-progress"),
+		remove:  all("choco uninstall -y"),
+		query: func([]string) string {
+			return "choco list --local-only --limit-output"
+		},
+		parse: parseFields("|"),
+	},
+	"winget": {
+		windows:     true,
+		updateCache: "winget source update",
+		install:     each("winget install --silent --exact --accept-package-agreements --accept-source-agreements --id"),
+		remove:      each("winget uninstall --silent --exact --id"),
+		query: func([]string) string {
+			return "winget list --accept-source-agreements"
+		},
+		parse: parseWinget,
+	},
+}
+
+// parseApk reads the output of `apk info -v`, ex: "curl-7.83.1-r2".
+func parseApk(output string, pkgs []string) map[string]string {
+	versions := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for _, name := range names(pkgs) {
+			version := strings.TrimPrefix(line, name+"-")
+			if version != line && version != "" && version[0] >= '0' && version[0] <= '9' {
+				versions[name] = version
+			}
+		}
+	}
+	return versions
+}
+
+// parseWinget reads the table printed by `winget list`, where the version
+// follows the package ID.
+func parseWinget(output string, pkgs []string) map[string]string {
+	versions := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 0; i < len(fields)-1; i++ {
+			for _, id := range pkgs {
+				if strings.EqualFold(fields[i], id) {
+					versions[id] = fields[i+1]
+				}
+			}
+		}
+	}
+	return versions
+}
+
+// DetectCommands find the package manager of the guest, they print its name.
+var DetectCommands = []string{
+	`for pm in apt-get dnf zypper apk; do if command -v $pm >/dev/null 2>&1; then echo $pm; exit 0; fi; done; exit 1`,
+	`powershell -NoProfile -Command "if (Get-Command choco -ErrorAction SilentlyContinue) { 'choco' } elseif (Get-Command winget -ErrorAction SilentlyContinue) { 'winget' } else { exit 1 }"`,
+}
+
+// detectedName returns the name of the package manager printed by one of the
+// DetectCommands.
+func detectedName(output string) (string, error) {
+	name := strings.TrimSpace(output)
+	if name == "apt-get" {
+		name = "apt"
+	}
+	if _, ok := packageManagers[name]; !ok {
+		return "", fmt.Errorf("unsupported package manager %q", name)
+	}
+	return name, nil
+}
@@ -0,0 +1,304 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package packages
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer/packer"
+)
+
+var DefaultExecuteCommand = `sudo -n sh -c '{{ .Command }}'`
+
+// RegistryLabelPrefix prefixes the name of the packages in the labels
+// published to the HCP Packer registry.
+var RegistryLabelPrefix = "package_"
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The packages to install. A version can be pinned with the syntax of the
+	// package manager, ex: `curl=7.81.0-1ubuntu1` with apt.
+	Install []string `mapstructure:"install"`
+
+	// The packages to remove. They are removed before the packages to
+	// install are installed.
+	Remove []string `mapstructure:"remove"`
+
+	// The package manager of the guest, one of `apt`, `dnf`, `zypper`, `apk`,
+	// `choco` or `winget`. Detected when unset.
+	PackageManager string `mapstructure:"package_manager"`
+
+	// The command used to run the package manager as root on Linux guests.
+	// The package manager command is available as `{{ .Command }}`. Defaults
+	// to `sudo -n sh -c '{{ .Command }}'`.
+	ExecuteCommand string `mapstructure:"execute_command"`
+
+	// Do not refresh the package metadata before installing the packages.
+	SkipUpdateCache bool `mapstructure:"skip_update_cache"`
+
+	// Remove the downloaded packages and the package metadata once done, to
+	// keep the image small.
+	CleanCache bool `mapstructure:"clean_cache"`
+
+	// How many times a failed package manager command is retried, for
+	// example when another process holds the package manager lock. Defaults
+	// to 3.
+	Retries int `mapstructure:"retries"`
+
+	// How long to wait between retries. Defaults to 10s.
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+
+	// A local file where the installed versions of the packages are written,
+	// as JSON, for later steps.
+	ReportPath string `mapstructure:"report_path"`
+
+	// Publish the installed versions of the packages as labels of the build
+	// in the HCP Packer registry, ex: `package_curl = "7.81.0-1ubuntu1"`.
+	RegistryLabels bool `mapstructure:"registry_labels"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+type ExecuteCommandTemplate struct {
+	Command string
+}
+
+// Report is the content of the report_path file.
+type Report struct {
+	PackageManager string `json:"package_manager"`
+	// Installed maps the name of the installed packages to their version.
+	Installed map[string]string `json:"installed"`
+	Removed   []string          `json:"removed"`
+}
+
+func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "packages",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"execute_command",
+			},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.ExecuteCommand == "" {
+		p.config.ExecuteCommand = DefaultExecuteCommand
+	}
+
+	if p.config.Retries == 0 {
+		p.config.Retries = 3
+	}
+
+	if p.config.RetryDelay == 0 {
+		p.config.RetryDelay = 10 * time.Second
+	}
+
+	var errs *packersdk.MultiError
+	if len(p.config.Install) == 0 && len(p.config.Remove) == 0 {
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("At least one package to install or remove must be set"))
+	}
+	if p.config.PackageManager != "" {
+		if _, ok := packageManagers[p.config.PackageManager]; !ok {
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("Unsupported package_manager %q", p.config.PackageManager))
+		}
+	}
+	if p.config.Retries < 0 {
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("retries cannot be negative"))
+	}
+	for _, pkg := range append(append([]string{}, p.config.Install...), p.config.Remove...) {
+		if pkg == "" || strings.ContainsAny(pkg, " \t\n'\"`;&|$") {
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("Invalid package name %q", pkg))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, _ map[string]interface{}) error {
+	name := p.config.PackageManager
+	if name == "" {
+		var err error
+		name, err = p.detect(ctx, ui, comm)
+		if err != nil {
+			return err
+		}
+	}
+	pm := packageManagers[name]
+	ui.Say(fmt.Sprintf("Managing packages with %s", name))
+
+	if !p.config.SkipUpdateCache && pm.updateCache != "" && len(p.config.Install) > 0 {
+		ui.Message("Updating the package cache...")
+		if err := p.runWithRetry(ctx, ui, comm, pm, pm.updateCache); err != nil {
+			return fmt.Errorf("Error updating the package cache: %s", err)
+		}
+	}
+
+	if len(p.config.Remove) > 0 {
+		ui.Message(fmt.Sprintf("Removing %s", strings.Join(p.config.Remove, ", ")))
+		for _, command := range pm.remove(p.config.Remove) {
+			if err := p.runWithRetry(ctx, ui, comm, pm, command); err != nil {
+				return fmt.Errorf("Error removing packages: %s", err)
+			}
+		}
+	}
+
+	if len(p.config.Install) > 0 {
+		ui.Message(fmt.Sprintf("Installing %s", strings.Join(p.config.Install, ", ")))
+		for _, command := range pm.install(p.config.Install) {
+			if err := p.runWithRetry(ctx, ui, comm, pm, command); err != nil {
+				return fmt.Errorf("Error installing packages: %s", err)
+			}
+		}
+	}
+
+	report := Report{
+		PackageManager: name,
+		Installed:      map[string]string{},
+		Removed:        p.config.Remove,
+	}
+	if report.Removed == nil {
+		report.Removed = []string{}
+	}
+	if len(p.config.Install) > 0 {
+		var stdout bytes.Buffer
+		// Querying packages that are missing fails, the versions found are
+		// reported anyway.
+		if _, err := p.run(ctx, ui, comm, pm, pm.query(p.config.Install), &stdout); err != nil {
+			return fmt.Errorf("Error querying the installed packages: %s", err)
+		}
+		report.Installed = pm.parse(stdout.String(), p.config.Install)
+		for _, pkg := range names(p.config.Install) {
+			if _, ok := report.Installed[pkg]; !ok {
+				ui.Error(fmt.Sprintf("Could not find the installed version of %s", pkg))
+			}
+		}
+	}
+
+	if p.config.CleanCache && pm.cleanCache != "" {
+		ui.Message("Cleaning the package cache...")
+		if err := p.runWithRetry(ctx, ui, comm, pm, pm.cleanCache); err != nil {
+			return fmt.Errorf("Error cleaning the package cache: %s", err)
+		}
+	}
+
+	return p.publishReport(ui, report)
+}
+
+// detect runs the DetectCommands until one finds the package manager.
+func (p *Provisioner) detect(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator) (string, error) {
+	for _, command := range DetectCommands {
+		var stdout bytes.Buffer
+		cmd := &packersdk.RemoteCmd{Command: command, Stdout: &stdout}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return "", fmt.Errorf("Error detecting the package manager: %s", err)
+		}
+		if cmd.ExitStatus() != 0 {
+			continue
+		}
+		name, err := detectedName(stdout.String())
+		if err != nil {
+			log.Printf("Ignoring the package manager detected by %q: %s", command, err)
+			continue
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("Could not detect the package manager of the guest, please set package_manager")
+}
+
+func (p *Provisioner) publishReport(ui packersdk.Ui, report Report) error {
+	pkgs := make([]string, 0, len(report.Installed))
+	for pkg := range report.Installed {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	labels := make([]string, 0, 2*len(pkgs))
+	for _, pkg := range pkgs {
+		ui.Message(fmt.Sprintf("Installed %s %s", pkg, report.Installed[pkg]))
+		labels = append(labels, RegistryLabelPrefix+pkg, report.Installed[pkg])
+	}
+
+	if p.config.ReportPath != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(p.config.ReportPath, append(b, '\n'), 0644); err != nil {
+			return fmt.Errorf("Error writing the package report: %s", err)
+		}
+	}
+
+	if p.config.RegistryLabels && len(labels) > 0 {
+		ui.Machine(packer.ProvisionerLabelsMachineType, labels...)
+	}
+	return nil
+}
+
+func (p *Provisioner) runWithRetry(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, pm *packageManager, command string) error {
+	return retry.Config{
+		Tries:      p.config.Retries + 1,
+		RetryDelay: func() time.Duration { return p.config.RetryDelay },
+	}.Run(ctx, func(ctx context.Context) error {
+		status, err := p.run(ctx, ui, comm, pm, command, nil)
+		if err != nil {
+			return err
+		}
+		if status != 0 {
+			return fmt.Errorf("%q exited with non-zero exit status: %d", command, status)
+		}
+		return nil
+	})
+}
+
+func (p *Provisioner) run(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, pm *packageManager, command string, stdout io.Writer) (int, error) {
+	if !pm.windows {
+		p.config.ctx.Data = &ExecuteCommandTemplate{
+			Command: command,
+		}
+		var err error
+		command, err = interpolate.Render(p.config.ExecuteCommand, &p.config.ctx)
+		if err != nil {
+			return 0, fmt.Errorf("Error processing command: %s", err)
+		}
+	}
+
+	cmd := &packersdk.RemoteCmd{Command: command, Stdout: stdout}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return 0, err
+	}
+	return cmd.ExitStatus(), nil
+}
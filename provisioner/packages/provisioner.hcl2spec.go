@@ -0,0 +1,65 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package packages
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Install             []string          `mapstructure:"install" cty:"install" hcl:"install"`
+	Remove              []string          `mapstructure:"remove" cty:"remove" hcl:"remove"`
+	PackageManager      *string           `mapstructure:"package_manager" cty:"package_manager" hcl:"package_manager"`
+	ExecuteCommand      *string           `mapstructure:"execute_command" cty:"execute_command" hcl:"execute_command"`
+	SkipUpdateCache     *bool             `mapstructure:"skip_update_cache" cty:"skip_update_cache" hcl:"skip_update_cache"`
+	CleanCache          *bool             `mapstructure:"clean_cache" cty:"clean_cache" hcl:"clean_cache"`
+	Retries             *int              `mapstructure:"retries" cty:"retries" hcl:"retries"`
+	RetryDelay          *string           `mapstructure:"retry_delay" cty:"retry_delay" hcl:"retry_delay"`
+	ReportPath          *string           `mapstructure:"report_path" cty:"report_path" hcl:"report_path"`
+	RegistryLabels      *bool             `mapstructure:"registry_labels" cty:"registry_labels" hcl:"registry_labels"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"install":                    &hcldec.AttrSpec{Name: "install", Type: cty.List(cty.String), Required: false},
+		"remove":                     &hcldec.AttrSpec{Name: "remove", Type: cty.List(cty.String), Required: false},
+		"package_manager":            &hcldec.AttrSpec{Name: "package_manager", Type: cty.String, Required: false},
+		"execute_command":            &hcldec.AttrSpec{Name: "execute_command", Type: cty.String, Required: false},
+		"skip_update_cache":          &hcldec.AttrSpec{Name: "skip_update_cache", Type: cty.Bool, Required: false},
+		"clean_cache":                &hcldec.AttrSpec{Name: "clean_cache", Type: cty.Bool, Required: false},
+		"retries":                    &hcldec.AttrSpec{Name: "retries", Type: cty.Number, Required: false},
+		"retry_delay":                &hcldec.AttrSpec{Name: "retry_delay", Type: cty.String, Required: false},
+		"report_path":                &hcldec.AttrSpec{Name: "report_path", Type: cty.String, Required: false},
+		"registry_labels":            &hcldec.AttrSpec{Name: "registry_labels", Type: cty.Bool, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,207 @@
+package packages
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/provisioner/provisionertest"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"install": []string{"curl", "jq=1.6-2.1ubuntu3"},
+	}
+}
+
+// machineUi records the machine-readable messages.
+type machineUi struct {
+	packersdk.BasicUi
+	machine [][]string
+}
+
+func (u *machineUi) Machine(t string, args ...string) {
+	u.machine = append(u.machine, append([]string{t}, args...))
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packersdk.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.ExecuteCommand != DefaultExecuteCommand {
+		t.Errorf("unexpected execute command: %s", p.config.ExecuteCommand)
+	}
+	if p.config.Retries != 3 {
+		t.Errorf("unexpected retries: %d", p.config.Retries)
+	}
+	if p.config.RetryDelay != 10*time.Second {
+		t.Errorf("unexpected retry delay: %s", p.config.RetryDelay)
+	}
+}
+
+func TestProvisionerPrepare_ConfigErrors(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"no packages":             {},
+		"unknown package manager": {"install": []string{"curl"}, "package_manager": "pacman"},
+		"negative retries":        {"install": []string{"curl"}, "retries": -1},
+		"bad retry delay":         {"install": []string{"curl"}, "retry_delay": "m"},
+		"injected command":        {"install": []string{"curl; rm -rf /"}},
+		"empty package":           {"remove": []string{""}},
+		"invalid key":             {"install": []string{"curl"}, "i_should_not_be_valid": true},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			var p Provisioner
+			if err := p.Prepare(config); err == nil {
+				t.Fatal("should have error")
+			}
+		})
+	}
+}
+
+func TestProvisionerProvision(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "packages.json")
+
+	var p Provisioner
+	config := testConfig()
+	config["package_manager"] = "apt"
+	config["execute_command"] = "{{ .Command }}"
+	config["remove"] = []string{"nano"}
+	config["clean_cache"] = true
+	config["report_path"] = report
+	config["registry_labels"] = true
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &provisionertest.RecordingCommunicator{MockCommunicator: &packersdk.MockCommunicator{
+		StartStdout: "curl 7.81.0-1ubuntu1.4\njq 1.6-2.1ubuntu3\n",
+	}}
+	ui := &machineUi{BasicUi: packersdk.BasicUi{Writer: new(bytes.Buffer)}}
+	if err := p.Provision(context.Background(), ui, comm, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"apt-get update",
+		"DEBIAN_FRONTEND=noninteractive apt-get remove -y nano",
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y curl jq=1.6-2.1ubuntu3",
+		`dpkg-query -W -f="\${Package} \${Version}\n" curl jq`,
+		"apt-get clean && rm -rf /var/lib/apt/lists/*",
+	}
+	if !reflect.DeepEqual(comm.Commands, expected) {
+		t.Fatalf("unexpected commands: %#v", comm.Commands)
+	}
+
+	b, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var got Report
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expectedReport := Report{
+		PackageManager: "apt",
+		Installed:      map[string]string{"curl": "7.81.0-1ubuntu1.4", "jq": "1.6-2.1ubuntu3"},
+		Removed:        []string{"nano"},
+	}
+	if !reflect.DeepEqual(got, expectedReport) {
+		t.Errorf("unexpected report: %#v", got)
+	}
+
+	expectedMachine := [][]string{{packer.ProvisionerLabelsMachineType,
+		"package_curl", "7.81.0-1ubuntu1.4", "package_jq", "1.6-2.1ubuntu3"}}
+	if !reflect.DeepEqual(ui.machine, expectedMachine) {
+		t.Errorf("unexpected machine-readable messages: %#v", ui.machine)
+	}
+}
+
+func TestProvisionerProvision_Detect(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["skip_update_cache"] = true
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &provisionertest.RecordingCommunicator{MockCommunicator: &packersdk.MockCommunicator{
+		StartStdout: "apk\n",
+	}}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(comm.Commands) < 2 || comm.Commands[0] != DetectCommands[0] ||
+		comm.Commands[1] != "sudo -n sh -c 'apk add curl jq=1.6-2.1ubuntu3'" {
+		t.Fatalf("unexpected commands: %#v", comm.Commands)
+	}
+}
+
+func TestProvisionerProvision_Retries(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["package_manager"] = "dnf"
+	config["retries"] = 2
+	config["retry_delay"] = "1ms"
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &provisionertest.RecordingCommunicator{MockCommunicator: &packersdk.MockCommunicator{
+		StartExitStatus: 1,
+	}}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err == nil {
+		t.Fatal("should have error")
+	}
+	if len(comm.Commands) != 3 {
+		t.Fatalf("expected the cache update to be tried 3 times: %#v", comm.Commands)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		manager string
+		output  string
+		pkgs    []string
+		want    map[string]string
+	}{
+		{"dnf", "curl 7.61.1-22.el8\npackage jq is not installed\n", []string{"curl", "jq"},
+			map[string]string{"curl": "7.61.1-22.el8"}},
+		{"apk", "curl-7.83.1-r2\ncurl-dev-7.83.1-r2\n", []string{"curl"},
+			map[string]string{"curl": "7.83.1-r2"}},
+		{"choco", "Chocolatey v1.1.0\ngit|2.37.1\nGit.install|2.37.1\n7zip|22.1\n", []string{"git", "7Zip"},
+			map[string]string{"git": "2.37.1", "7Zip": "22.1"}},
+		{"winget", "Name   Id          Version Available Source\n" +
+			"------------------------------------------\n" +
+			"Git    Git.Git     2.37.1  2.38.0    winget\n", []string{"Git.Git"},
+			map[string]string{"Git.Git": "2.37.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.manager, func(t *testing.T) {
+			got := packageManagers[tt.manager].parse(tt.output, tt.pkgs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected versions: %#v", got)
+			}
+		})
+	}
+}
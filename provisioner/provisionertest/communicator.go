@@ -0,0 +1,22 @@
+// Package provisionertest provides helpers to unit test the provisioners
+// against a mock communicator.
+package provisionertest
+
+import (
+	"context"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// RecordingCommunicator is a MockCommunicator recording every command started
+// on it, where the MockCommunicator only keeps the last one.
+type RecordingCommunicator struct {
+	*packersdk.MockCommunicator
+	// Commands are the commands started, in order.
+	Commands []string
+}
+
+func (c *RecordingCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	c.Commands = append(c.Commands, cmd.Command)
+	return c.MockCommunicator.Start(ctx, cmd)
+}
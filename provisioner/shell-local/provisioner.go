@@ -5,14 +5,14 @@ import (
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
-	sl "github.com/hashicorp/packer-plugin-sdk/shell-local"
+	sl "github.com/hashicorp/packer/internal/shelllocal"
 )
 
 type Provisioner struct {
 	config sl.Config
 }
 
-func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec { return p.config.ConfigSpec() }
 
 func (p *Provisioner) Prepare(raws ...interface{}) error {
 	err := sl.Decode(&p.config, raws...)
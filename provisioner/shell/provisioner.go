@@ -25,6 +25,7 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/hashicorp/packer-plugin-sdk/tmp"
+	"github.com/hashicorp/packer/internal/agent"
 )
 
 type Config struct {
@@ -274,6 +275,17 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packe
 	// Create environment variables to set before executing the command
 	flattenedEnvVars := p.createFlattenedEnvVars()
 
+	// When available, the scripts run under the supervision of the packer
+	// agent, so that they survive a loss of the connection.
+	agt, err := agent.Install(ctx, comm)
+	if err != nil {
+		if !errors.Is(err, agent.ErrUnavailable) {
+			ui.Error(fmt.Sprintf("Failed to install the packer agent, running the scripts without it: %s", err))
+		}
+		log.Printf("[INFO] not using the packer agent: %s", err)
+		agt = nil
+	}
+
 	for _, path := range scripts {
 		ui.Say(fmt.Sprintf("Provisioning with shell script: %s", path))
 
@@ -302,6 +314,7 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packe
 		// and then the command is executed but the file doesn't exist
 		// any longer.
 		var cmd *packersdk.RemoteCmd
+		var exitStatus int
 		err = retry.Config{StartTimeout: p.config.StartRetryTimeout}.Run(ctx, func(ctx context.Context) error {
 			if _, err := f.Seek(0, 0); err != nil {
 				return err
@@ -326,8 +339,16 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packe
 			}
 			cmd.Wait()
 
+			if agt != nil {
+				var err error
+				exitStatus, err = agt.Run(ctx, comm, ui, command)
+				return err
+			}
+
 			cmd = &packersdk.RemoteCmd{Command: command}
-			return cmd.RunWithUi(ctx, comm, ui)
+			err := cmd.RunWithUi(ctx, comm, ui)
+			exitStatus = cmd.ExitStatus()
+			return err
 		})
 
 		if err != nil {
@@ -336,7 +357,7 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packe
 
 		// If the exit code indicates a remote disconnect, fail unless
 		// we were expecting it.
-		if cmd.ExitStatus() == packersdk.CmdDisconnect {
+		if exitStatus == packersdk.CmdDisconnect {
 			if !p.config.ExpectDisconnect {
 				return fmt.Errorf("Script disconnected unexpectedly. " +
 					"If you expected your script to disconnect, i.e. from a " +
@@ -344,7 +365,7 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packe
 					"or `\"valid_exit_codes\": [0, 2300218]` to the shell " +
 					"provisioner parameters.")
 			}
-		} else if err := p.config.ValidExitCode(cmd.ExitStatus()); err != nil {
+		} else if err := p.config.ValidExitCode(exitStatus); err != nil {
 			return err
 		}
 
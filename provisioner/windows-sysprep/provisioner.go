@@ -0,0 +1,220 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package sysprep
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/masterzen/winrm"
+)
+
+var DefaultSysprepPath = `C:\Windows\System32\Sysprep\sysprep.exe`
+var DefaultSysprepFlags = []string{"/generalize", "/oobe", "/quiet"}
+var DefaultUnattendPath = `C:\Windows\Temp\packer-unattend.xml`
+
+// GeneralizedImageState is the image state of a machine that was generalized
+// and will run the OOBE on its next boot.
+var GeneralizedImageState = "IMAGE_STATE_GENERALIZE_RESEAL_TO_OOBE"
+var ImageStateCommand = winrm.Powershell(`(Get-ItemProperty -Path 'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\Setup\State').ImageState`)
+var retryableSleep = 5 * time.Second
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Path to a local answer file template. It is rendered with Go template
+	// syntax, the `unattend_vars` being available as `{{ .name }}`, then
+	// uploaded to `unattend_path` and passed to sysprep with `/unattend`.
+	// When unset, sysprep runs without an answer file.
+	UnattendTemplate string `mapstructure:"unattend_template"`
+
+	// Variables made available to the `unattend_template`.
+	UnattendVars map[string]string `mapstructure:"unattend_vars"`
+
+	// Where the rendered answer file is uploaded on the guest. Defaults to
+	// `C:\Windows\Temp\packer-unattend.xml`.
+	UnattendPath string `mapstructure:"unattend_path"`
+
+	// Path to sysprep on the guest. Defaults to
+	// `C:\Windows\System32\Sysprep\sysprep.exe`.
+	SysprepPath string `mapstructure:"sysprep_path"`
+
+	// The flags passed to sysprep. Defaults to
+	// `["/generalize", "/oobe", "/quiet"]`. `/quit` or `/shutdown` is added
+	// depending on `shutdown`.
+	SysprepFlags []string `mapstructure:"sysprep_flags"`
+
+	// When true, sysprep shuts the guest down itself, and the builder must be
+	// configured to wait for the shutdown instead of issuing its own. When
+	// false, the default, sysprep quits once the guest is generalized and
+	// the builder shuts the guest down as usual.
+	Shutdown bool `mapstructure:"shutdown"`
+
+	// How long to wait for sysprep to generalize the guest. Defaults to 15m.
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	ctx interpolate.Context
+}
+
+type Provisioner struct {
+	config Config
+}
+
+func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "windows-sysprep",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.UnattendPath == "" {
+		p.config.UnattendPath = DefaultUnattendPath
+	}
+
+	if p.config.SysprepPath == "" {
+		p.config.SysprepPath = DefaultSysprepPath
+	}
+
+	if len(p.config.SysprepFlags) == 0 {
+		p.config.SysprepFlags = DefaultSysprepFlags
+	}
+
+	if p.config.Timeout == 0 {
+		p.config.Timeout = 15 * time.Minute
+	}
+
+	var errs *packersdk.MultiError
+	if p.config.UnattendTemplate != "" {
+		if _, err := os.Stat(p.config.UnattendTemplate); err != nil {
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("Bad unattend_template %q: %s", p.config.UnattendTemplate, err))
+		}
+	} else if len(p.config.UnattendVars) > 0 {
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("unattend_vars can only be used with an unattend_template"))
+	}
+
+	for _, flag := range p.config.SysprepFlags {
+		switch strings.ToLower(flag) {
+		case "/quit", "/shutdown", "/reboot":
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("sysprep_flags cannot contain %s, use shutdown instead", flag))
+		}
+		if strings.HasPrefix(strings.ToLower(flag), "/unattend") {
+			errs = packersdk.MultiErrorAppend(errs,
+				fmt.Errorf("sysprep_flags cannot contain %s, use unattend_template instead", flag))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, _ map[string]interface{}) error {
+	if p.config.UnattendTemplate != "" {
+		ui.Say(fmt.Sprintf("Uploading answer file rendered from %s", p.config.UnattendTemplate))
+		unattend, err := p.renderUnattend(p.config.UnattendTemplate)
+		if err != nil {
+			return fmt.Errorf("Error rendering unattend_template: %s", err)
+		}
+		if err := comm.Upload(p.config.UnattendPath, strings.NewReader(unattend), nil); err != nil {
+			return fmt.Errorf("Error uploading answer file: %s", err)
+		}
+	}
+
+	ui.Say("Running sysprep...")
+	cmd := &packersdk.RemoteCmd{Command: p.sysprepCommand()}
+	err := cmd.RunWithUi(ctx, comm, ui)
+
+	if err != nil {
+		// Sysprep could not be started, the guest is not shutting down.
+		return err
+	}
+	if p.config.Shutdown && cmd.ExitStatus() == packersdk.CmdDisconnect {
+		// The guest shuts down while sysprep runs, so losing the connection
+		// once it started is expected.
+		log.Printf("Connection lost while running sysprep, assuming the guest is shutting down")
+		ui.Say("Sysprep is shutting the guest down, the builder must wait for the shutdown")
+		return nil
+	}
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("Sysprep exited with non-zero exit status: %d", cmd.ExitStatus())
+	}
+	if p.config.Shutdown {
+		ui.Say("Sysprep is shutting the guest down, the builder must wait for the shutdown")
+		return nil
+	}
+
+	return p.waitForGeneralize(ctx, ui, comm)
+}
+
+func (p *Provisioner) sysprepCommand() string {
+	args := []string{fmt.Sprintf(`"%s"`, p.config.SysprepPath)}
+	args = append(args, p.config.SysprepFlags...)
+	if p.config.UnattendTemplate != "" {
+		args = append(args, fmt.Sprintf(`/unattend:"%s"`, p.config.UnattendPath))
+	}
+	if p.config.Shutdown {
+		args = append(args, "/shutdown")
+	} else {
+		args = append(args, "/quit")
+	}
+	return strings.Join(args, " ")
+}
+
+// waitForGeneralize polls the image state of the guest until sysprep reports
+// it as generalized, so that the builder only shuts the guest down once it is
+// ready to be captured.
+func (p *Provisioner) waitForGeneralize(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator) error {
+	ui.Say("Waiting for the guest to be generalized...")
+	return retry.Config{
+		StartTimeout: p.config.Timeout,
+		RetryDelay:   func() time.Duration { return retryableSleep },
+	}.Run(ctx, func(ctx context.Context) error {
+		var stdout bytes.Buffer
+		cmd := &packersdk.RemoteCmd{Command: ImageStateCommand, Stdout: &stdout}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return err
+		}
+		state := strings.TrimSpace(stdout.String())
+		if state != GeneralizedImageState {
+			log.Printf("Guest image state is %q, waiting...", state)
+			return fmt.Errorf("unexpected image state %q", state)
+		}
+		ui.Say("Guest successfully generalized")
+		return nil
+	})
+}
+
+// renderUnattend renders the answer file template at path with the
+// unattend_vars, using Go template syntax and the template engine functions.
+// The template is rendered once, so that the values of the variables are not
+// interpolated.
+func (p *Provisioner) renderUnattend(path string) (string, error) {
+	tpl, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	ictx := p.config.ctx
+	ictx.Data = p.config.UnattendVars
+	return (&interpolate.I{Value: string(tpl)}).Render(&ictx)
+}
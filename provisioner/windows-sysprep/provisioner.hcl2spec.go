@@ -0,0 +1,59 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package sysprep
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	UnattendTemplate    *string           `mapstructure:"unattend_template" cty:"unattend_template" hcl:"unattend_template"`
+	UnattendVars        map[string]string `mapstructure:"unattend_vars" cty:"unattend_vars" hcl:"unattend_vars"`
+	UnattendPath        *string           `mapstructure:"unattend_path" cty:"unattend_path" hcl:"unattend_path"`
+	SysprepPath         *string           `mapstructure:"sysprep_path" cty:"sysprep_path" hcl:"sysprep_path"`
+	SysprepFlags        []string          `mapstructure:"sysprep_flags" cty:"sysprep_flags" hcl:"sysprep_flags"`
+	Shutdown            *bool             `mapstructure:"shutdown" cty:"shutdown" hcl:"shutdown"`
+	Timeout             *string           `mapstructure:"timeout" cty:"timeout" hcl:"timeout"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"unattend_template":          &hcldec.AttrSpec{Name: "unattend_template", Type: cty.String, Required: false},
+		"unattend_vars":              &hcldec.AttrSpec{Name: "unattend_vars", Type: cty.Map(cty.String), Required: false},
+		"unattend_path":              &hcldec.AttrSpec{Name: "unattend_path", Type: cty.String, Required: false},
+		"sysprep_path":               &hcldec.AttrSpec{Name: "sysprep_path", Type: cty.String, Required: false},
+		"sysprep_flags":              &hcldec.AttrSpec{Name: "sysprep_flags", Type: cty.List(cty.String), Required: false},
+		"shutdown":                   &hcldec.AttrSpec{Name: "shutdown", Type: cty.Bool, Required: false},
+		"timeout":                    &hcldec.AttrSpec{Name: "timeout", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,190 @@
+package sysprep
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/provisioner/provisionertest"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func TestProvisioner_Impl(t *testing.T) {
+	var raw interface{}
+	raw = &Provisioner{}
+	if _, ok := raw.(packersdk.Provisioner); !ok {
+		t.Fatalf("must be a Provisioner")
+	}
+}
+
+func TestProvisionerPrepare_Defaults(t *testing.T) {
+	var p Provisioner
+	err := p.Prepare(testConfig())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.Timeout != 15*time.Minute {
+		t.Errorf("unexpected timeout: %s", p.config.Timeout)
+	}
+	if p.config.SysprepPath != DefaultSysprepPath {
+		t.Errorf("unexpected sysprep path: %s", p.config.SysprepPath)
+	}
+	if p.config.UnattendPath != DefaultUnattendPath {
+		t.Errorf("unexpected unattend path: %s", p.config.UnattendPath)
+	}
+	expected := `"C:\Windows\System32\Sysprep\sysprep.exe" /generalize /oobe /quiet /quit`
+	if cmd := p.sysprepCommand(); cmd != expected {
+		t.Errorf("unexpected sysprep command: %s", cmd)
+	}
+}
+
+func TestProvisionerPrepare_ConfigErrors(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"bad timeout":            {"timeout": "m"},
+		"missing template":       {"unattend_template": "/i/dont/exist.xml"},
+		"vars without template":  {"unattend_vars": map[string]string{"a": "b"}},
+		"shutdown flag":          {"sysprep_flags": []string{"/generalize", "/shutdown"}},
+		"unattend flag":          {"sysprep_flags": []string{"/unattend:C:/unattend.xml"}},
+		"i_should_not_be_valid":  {"i_should_not_be_valid": true},
+		"reboot flag mixed case": {"sysprep_flags": []string{"/Reboot"}},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			var p Provisioner
+			if err := p.Prepare(config); err == nil {
+				t.Fatal("should have error")
+			}
+		})
+	}
+}
+
+func TestProvisionerProvision_Unattend(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "unattend.xml.pkrtpl")
+	err := os.WriteFile(tmpl, []byte(`<ComputerName>{{ upper .hostname }}</ComputerName>`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var p Provisioner
+	config := testConfig()
+	config["unattend_template"] = tmpl
+	config["unattend_vars"] = map[string]string{"hostname": "packer"}
+	config["sysprep_flags"] = []string{"/generalize", "/oobe"}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &provisionertest.RecordingCommunicator{MockCommunicator: &packersdk.MockCommunicator{
+		StartStdout: GeneralizedImageState + "\r\n",
+	}}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if comm.UploadPath != DefaultUnattendPath {
+		t.Errorf("unexpected upload path: %s", comm.UploadPath)
+	}
+	if comm.UploadData != "<ComputerName>PACKER</ComputerName>" {
+		t.Errorf("unexpected answer file: %s", comm.UploadData)
+	}
+	expected := []string{
+		`"C:\Windows\System32\Sysprep\sysprep.exe" /generalize /oobe /unattend:"C:\Windows\Temp\packer-unattend.xml" /quit`,
+		ImageStateCommand,
+	}
+	if len(comm.Commands) != len(expected) {
+		t.Fatalf("unexpected commands: %#v", comm.Commands)
+	}
+	for i := range expected {
+		if comm.Commands[i] != expected[i] {
+			t.Errorf("unexpected command %d: %s", i, comm.Commands[i])
+		}
+	}
+}
+
+func TestProvisionerProvision_WaitForGeneralize(t *testing.T) {
+	retryableSleep = 10 * time.Millisecond
+	defer func() { retryableSleep = 5 * time.Second }()
+
+	var p Provisioner
+	config := testConfig()
+	config["timeout"] = "100ms"
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packersdk.MockCommunicator{StartStdout: "IMAGE_STATE_COMPLETE"}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err == nil {
+		t.Fatal("should time out waiting for the guest to be generalized")
+	}
+}
+
+func TestProvisionerProvision_Shutdown(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["shutdown"] = true
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &provisionertest.RecordingCommunicator{MockCommunicator: &packersdk.MockCommunicator{
+		StartExitStatus: packersdk.CmdDisconnect,
+	}}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err != nil {
+		t.Fatalf("a disconnect should be expected: %s", err)
+	}
+
+	expected := `"C:\Windows\System32\Sysprep\sysprep.exe" /generalize /oobe /quiet /shutdown`
+	if len(comm.Commands) != 1 || comm.Commands[0] != expected {
+		t.Fatalf("unexpected commands: %#v", comm.Commands)
+	}
+}
+
+// unreachableCommunicator fails to start any command.
+type unreachableCommunicator struct {
+	packersdk.MockCommunicator
+}
+
+func (c *unreachableCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	return errors.New("connection refused")
+}
+
+func TestProvisionerProvision_ShutdownStartFailure(t *testing.T) {
+	var p Provisioner
+	config := testConfig()
+	config["shutdown"] = true
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Sysprep never started, the guest is not shutting down.
+	comm := &unreachableCommunicator{}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestProvisionerProvision_Failure(t *testing.T) {
+	var p Provisioner
+	if err := p.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packersdk.MockCommunicator{StartExitStatus: 1}
+	ui := &packersdk.BasicUi{Writer: new(bytes.Buffer)}
+	if err := p.Provision(context.Background(), ui, comm, nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
@@ -0,0 +1,52 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// forwardedSignals returns the signals the panicwrap parent forwards to the
+// Packer process it wraps to run args. SIGTSTP and SIGCONT are only forwarded
+// to packer build -pause-signals, which pauses and resumes the provisioning of
+// the builds on them, the parent is not stopped by them then. Otherwise they
+// stop and continue Packer as usual.
+func forwardedSignals(args []string) []os.Signal {
+	if pauseSignals(args) {
+		return []os.Signal{syscall.SIGTERM, syscall.SIGTSTP, syscall.SIGCONT}
+	}
+	return []os.Signal{syscall.SIGTERM}
+}
+
+// pauseSignals checks whether args run packer build with -pause-signals.
+func pauseSignals(args []string) bool {
+	command := -1
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			command = i
+			break
+		}
+	}
+	if command < 0 || args[command] != "build" {
+		return false
+	}
+	enabled := false
+	for _, arg := range args[command+1:] {
+		if arg == "--" {
+			break
+		}
+		flag := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=", 2)
+		if flag[0] != "pause-signals" {
+			continue
+		}
+		enabled = true
+		if len(flag) == 2 {
+			enabled, _ = strconv.ParseBool(flag[1])
+		}
+	}
+	return enabled
+}
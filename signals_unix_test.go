@@ -0,0 +1,196 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/panicwrap"
+	"github.com/shirou/gopsutil/process"
+)
+
+func TestPauseSignals(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"build", "-pause-signals", "t.pkr.hcl"}, true},
+		{[]string{"-machine-readable", "build", "--pause-signals", "t.pkr.hcl"}, true},
+		{[]string{"build", "-var", "a=b", "-pause-signals=true", "t.pkr.hcl"}, true},
+		{[]string{"build", "-pause-signals=false", "t.pkr.hcl"}, false},
+		{[]string{"build", "t.pkr.hcl"}, false},
+		{[]string{"validate", "-pause-signals", "t.pkr.hcl"}, false},
+		{[]string{"console"}, false},
+		{nil, false},
+	} {
+		if got := pauseSignals(tc.args); got != tc.want {
+			t.Errorf("pauseSignals(%q) = %t, want %t", tc.args, got, tc.want)
+		}
+	}
+
+	want := []os.Signal{syscall.SIGTERM}
+	if got := forwardedSignals([]string{"console"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected console to only forward %v, got %v", want, got)
+	}
+}
+
+const wrapSignalsTestEnv = "PACKER_TEST_WRAP_SIGNALS"
+
+// wrapSignalsHelper runs in the process started by startWrapped: it wraps
+// itself like main does to run the args in wrapSignalsTestEnv, and the wrapped
+// process reports the pause signals it receives.
+func wrapSignalsHelper() {
+	wrapConfig := panicwrap.WrapConfig{
+		CookieKey:      "PACKER_TEST_WRAP_COOKIE",
+		CookieValue:    "signals",
+		Handler:        func(string) {},
+		ForwardSignals: forwardedSignals(strings.Fields(os.Getenv(wrapSignalsTestEnv))),
+	}
+	exitStatus, err := panicwrap.Wrap(&wrapConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to wrap: %s\n", err)
+		os.Exit(1)
+	}
+	if exitStatus >= 0 {
+		os.Exit(exitStatus)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	if pauseSignals(strings.Fields(os.Getenv(wrapSignalsTestEnv))) {
+		signal.Notify(sigCh, syscall.SIGTSTP, syscall.SIGCONT)
+	} else {
+		// Packer is stopped by SIGTSTP as usual.
+		signal.Notify(sigCh, syscall.SIGCONT)
+	}
+	fmt.Println("ready")
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGTSTP:
+			fmt.Println("paused")
+		case syscall.SIGCONT:
+			fmt.Println("resumed")
+			os.Exit(0)
+		}
+	}
+}
+
+// startWrapped starts the test run by name in a wrapper running args, in a
+// process group of its own like a job of a shell. It returns the wrapper and
+// a func waiting for the wrapped process to print a line.
+func startWrapped(t *testing.T, name, args string) (*exec.Cmd, func(string)) {
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(os.Environ(), wrapSignalsTestEnv+"="+args)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) //nolint:errcheck
+	})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	expect := func(want string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("the wrapped process exited before printing %q", want)
+				}
+				if line == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for the wrapped process to print %q", want)
+			}
+		}
+	}
+	return cmd, expect
+}
+
+func processStatus(t *testing.T, pid int) string {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := p.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestForwardedSignals_pause(t *testing.T) {
+	if os.Getenv(wrapSignalsTestEnv) != "" {
+		wrapSignalsHelper()
+		return
+	}
+
+	cmd, expect := startWrapped(t, "TestForwardedSignals_pause", "build -pause-signals")
+	expect("ready")
+	// The signals are sent to the wrapper, the process users see.
+	if err := cmd.Process.Signal(syscall.SIGTSTP); err != nil {
+		t.Fatal(err)
+	}
+	expect("paused")
+	if processStatus(t, cmd.Process.Pid) == "T" {
+		t.Fatal("the wrapper was stopped by SIGTSTP")
+	}
+	if err := cmd.Process.Signal(syscall.SIGCONT); err != nil {
+		t.Fatal(err)
+	}
+	expect("resumed")
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("the wrapper failed: %s", err)
+	}
+}
+
+func TestForwardedSignals_suspend(t *testing.T) {
+	if os.Getenv(wrapSignalsTestEnv) != "" {
+		wrapSignalsHelper()
+		return
+	}
+
+	cmd, expect := startWrapped(t, "TestForwardedSignals_suspend", "validate")
+	expect("ready")
+	// Like Ctrl-Z, the signal is sent to the whole job.
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTSTP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for processStatus(t, cmd.Process.Pid) != "T" {
+		if time.Now().After(deadline) {
+			t.Fatal("the wrapper was not stopped by SIGTSTP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGCONT); err != nil {
+		t.Fatal(err)
+	}
+	expect("resumed")
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("the wrapper failed: %s", err)
+	}
+}
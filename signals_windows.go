@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals returns the signals the panicwrap parent forwards to the
+// Packer process it wraps.
+func forwardedSignals([]string) []os.Signal {
+	return []os.Signal{syscall.SIGTERM}
+}